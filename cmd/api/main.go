@@ -1,20 +1,48 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"tonapp/internal/config"
 	"tonapp/internal/database"
 	"tonapp/internal/handler"
+	"tonapp/internal/keystore"
+	"tonapp/internal/listener"
+	"tonapp/internal/memstore"
 	"tonapp/internal/middleware"
+	"tonapp/internal/model"
+	"tonapp/internal/tonmock"
+	"tonapp/internal/tracing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	memory := flag.Bool("memory", false, "keep all data in memory instead of SQLite, for local development")
+	mockTon := flag.Bool("mock-ton", false, "fake the blockchain with wallets holding 1000 TON where every deposit arrives, for local development")
+	sandbox := flag.Bool("sandbox", false, "serve the sandbox API for frontend integration: sandbox.json instead of config.json, demo accounts in memory, the fake TON client and no admin routes")
+	sandboxSeed := flag.Int64("sandbox-seed", 1, "seed of the sandbox demo data, the same seed gives the same accounts")
+	encrypt := flag.Bool("encrypt-mnemonic", false, "read a mnemonic and a passphrase from two lines of stdin, print the encrypted mnemonic for config.json and exit")
+	flag.Parse()
+
+	if *encrypt {
+		encryptMnemonic()
+		return
+	}
+
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
@@ -22,105 +50,512 @@ func main() {
 
 	// Load configuration
 	cfg := config.Load()
+	configPath := "config.json"
+	if *sandbox {
+		log.Println("Running as sandbox, nothing is read from config.json or the database")
+		configPath = "sandbox.json"
+		*memory, *mockTon = true, true
+	}
+
+	// Export traces to the OpenTelemetry collector
+	if cfg.Tracing.Enabled() {
+		shutdown := tracing.Setup(tracing.Config{
+			Endpoint:    cfg.Tracing.Endpoint,
+			ServiceName: cfg.Tracing.ServiceName,
+			SampleRatio: cfg.Tracing.SampleRatio,
+			Headers:     cfg.Tracing.Headers,
+		})
+		defer shutdown(context.Background())
+		log.Printf("Exporting traces to %s", cfg.Tracing.Endpoint)
+	}
 
 	// Initialize database
-	db, err := database.New(cfg.Database.Path)
-	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	var db handler.Store
+	var sqlite *database.Database
+	if *memory {
+		log.Println("Using the in-memory store, data is lost on exit")
+		db = memstore.New()
+	} else {
+		var err error
+		sqlite, err = database.New(cfg.Database.Path, database.QueryLogConfig{
+			LogAll:        cfg.Database.QueryLog,
+			SlowThreshold: cfg.Database.SlowQueryThreshold,
+			Trace:         cfg.Tracing.Enabled(),
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		log.Printf("Using SQLite database %s (%s driver)", cfg.Database.Path, database.DriverName)
+		db = sqlite
 	}
 	defer db.Close()
 
 	// Initialize handler
-	h, err := handler.NewHandler(db, "config.json")
+	var h *handler.Handler
+	var err error
+	if *mockTon {
+		log.Println("Using the fake TON client, nothing is sent on chain")
+		fake := tonmock.New(tonmock.Options{WalletBalance: 1000, AutoConfirmDeposits: true})
+		h, err = handler.NewHandlerWithTonClient(db, fake, configPath)
+		if err == nil {
+			for name := range h.GetConfig().TON.TreasuryWallets {
+				fake.AddTreasuryWallet(name, 1000)
+			}
+		}
+	} else {
+		h, err = handler.NewHandler(db, configPath)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize handler: %v", err)
 	}
+	if *sandbox {
+		if err := h.SeedSandbox(*sandboxSeed); err != nil {
+			log.Fatalf("Failed to seed the sandbox: %v", err)
+		}
+		log.Println("Seeded the sandbox demo accounts, GET /api/v1/sandbox/wallets lists them with sessions")
+	}
+	if sqlite != nil && cfg.Tracing.Enabled() {
+		h.SetRequestStore(func(ctx context.Context) handler.Store {
+			return sqlite.WithContext(ctx)
+		})
+	}
 
-	// Initialize router
-	router := setupRouter(h)
+	// Start background jobs, SIGINT and SIGTERM stop them and the servers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	var jobs sync.WaitGroup
+	for _, job := range []func(context.Context){
+		h.StartWarmUp,
+		h.StartIntegrityCheck,
+		h.StartReadOnlyProbe,
+		h.StartIdempotencyCleanup,
+		h.StartVIPTiers,
+		h.StartTelegramBot,
+		h.StartNotificationDispatcher,
+		h.StartEventFeed,
+		h.StartBalanceSnapshots,
+		h.StartProfitAccrual,
+		h.StartSunsetRefunds,
+		h.StartAccessLogRetention,
+		h.StartWithdrawalWorker,
+		h.StartLiquidityQueue,
+		h.StartWithdrawalBatcher,
+		h.StartGiftExpiry,
+		h.StartChainIndexer,
+		h.StartChainWebhooks,
+		h.StartDepositWatcher,
+		h.StartDepositSweeper,
+		h.StartDormancyPolicy,
+		h.StartDepositReminders,
+		h.StartDepositExpiry,
+		h.StartAlerts,
+		h.StartRateRefresher,
+	} {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job(ctx)
+		}()
+	}
 
 	// Create rate limiter
 	rateLimiter := middleware.NewIPRateLimiter(h.GetConfig().RateLimit)
+	rateLimiter.SetTokenResolver(h.RateLimitTokenTier)
+	rateLimiter.SetWalletResolver(h.RateLimitSessionWallet)
+	h.OnConfigReload(func(c model.Config) {
+		rateLimiter.SetConfig(c.RateLimit)
+	})
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		rateLimiter.StartJanitor(ctx)
+	}()
 
-	// Apply rate limiter to all routes
-	router.Use(rateLimiter.RateLimit())
+	// Reload config.json on SIGHUP, a file with errors leaves the running config as is
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if _, err := h.ReloadConfigFile(); err != nil {
+				log.Printf("Failed to reload config: %v", err)
+			}
+		}
+	}()
 
-	// Configure server
-	server := &http.Server{
-		Addr:         ":" + cfg.Server.Port,
-		Handler:      router,
-		ReadTimeout:  cfg.Server.ReadTimeout,
-		WriteTimeout: cfg.Server.WriteTimeout,
+	// Open listeners, claiming named systemd sockets for the admin listener first
+	activation, err := listener.Activated()
+	if err != nil {
+		log.Fatalf("Failed to read activated sockets: %v", err)
 	}
-
-	// Start server
-	log.Printf("Server starting on port %s\n", cfg.Server.Port)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Failed to start server: %v\n", err)
+	var adminListeners []net.Listener
+	if cfg.Server.AdminListen != "" && !*sandbox {
+		adminListeners, err = listener.Open(cfg.Server.AdminListen, activation)
+		if err != nil {
+			log.Fatalf("Failed to open admin listener: %v", err)
+		}
+		for _, ln := range adminListeners {
+			if !listener.IsLocal(ln) {
+				log.Fatalf("Admin listener %s must be bound to localhost or a unix socket", listener.Describe(ln))
+			}
+		}
+	}
+	var apiListeners []net.Listener
+	for _, addr := range cfg.Server.Listen {
+		lns, err := listener.Open(addr, activation)
+		if err != nil {
+			log.Fatalf("Failed to open listener: %v", err)
+		}
+		apiListeners = append(apiListeners, lns...)
+	}
+	if names := activation.Remaining(); len(names) > 0 {
+		log.Printf("Closing unused systemd sockets: %s\n", strings.Join(names, ", "))
+		activation.Close()
 	}
-}
 
-func setupRouter(h *handler.Handler) *gin.Engine {
-	// Create default gin router
-	router := gin.Default()
+	// Initialize routers, admin routes move to their own listener when configured
+	separateAdmin := len(adminListeners) > 0
+	middlewares := globalMiddlewares(h, rateLimiter)
 
-	// Add basic middleware
-	router.Use(gin.Recovery())
-	router.Use(gin.Logger())
+	// Start servers
+	errs := make(chan error, len(apiListeners)+len(adminListeners))
+	var servers []*http.Server
+	serve := func(handler http.Handler, lns []net.Listener) {
+		server := &http.Server{
+			Handler:      handler,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			WriteTimeout: cfg.Server.WriteTimeout,
+		}
+		servers = append(servers, server)
+		for _, ln := range lns {
+			log.Printf("Server listening on %s\n", listener.Describe(ln))
+			go func(ln net.Listener) {
+				errs <- server.Serve(ln)
+			}(ln)
+		}
+	}
+	serve(setupRouter(h, rateLimiter, middlewares, !separateAdmin && !*sandbox, *sandbox), apiListeners)
+	if separateAdmin {
+		serve(setupAdminRouter(h, middlewares), adminListeners)
+	}
 
-	//Access-Control-Allow-Origin
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	select {
+	case err := <-errs:
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v\n", err)
+		}
+	case <-ctx.Done():
+	}
+	stop()
 
-		// if preflight request, immediately return 200
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(200)
-			return
+	// Stop accepting connections and let in-flight requests such as withdrawals finish,
+	// while the background jobs finish their current run
+	log.Printf("Shutting down, waiting up to %s for requests and background jobs", cfg.Server.ShutdownTimeout)
+	drain, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(drain); err != nil {
+			log.Printf("Requests still running at shutdown: %v", err)
 		}
+	}
 
-		c.Next()
-	})
+	stopped := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-drain.Done():
+		log.Println("Background jobs still running at shutdown")
+	}
+	log.Println("Server stopped")
+}
+
+// encryptMnemonic prints the encrypted form of the mnemonic on the first line of stdin,
+// sealed with the passphrase on the second
+func encryptMnemonic() {
+	lines := bufio.NewScanner(os.Stdin)
+	var input []string
+	for len(input) < 2 && lines.Scan() {
+		input = append(input, strings.TrimSpace(lines.Text()))
+	}
+	if len(input) < 2 {
+		log.Fatal("Expected the mnemonic and the passphrase on two lines of stdin")
+	}
+	if words := len(strings.Fields(input[0])); words != 24 {
+		log.Fatalf("The mnemonic has %d words, expected 24", words)
+	}
+	encrypted, err := keystore.Encrypt(input[0], input[1])
+	if err != nil {
+		log.Fatalf("Failed to encrypt the mnemonic: %v", err)
+	}
+	fmt.Println(encrypted)
+}
+
+// globalMiddlewares builds the middlewares in the order configured in config.json
+func globalMiddlewares(h *handler.Handler, rateLimiter *middleware.IPRateLimiter) []gin.HandlerFunc {
+	pipeline := middleware.NewPipeline()
+	pipeline.Register("rate_limit", rateLimiter.RateLimit())
+	middlewares, err := pipeline.Build(h.GetConfig().Middleware.Pipeline)
+	if err != nil {
+		log.Fatalf("Invalid middleware pipeline: %v", err)
+	}
+	return middlewares
+}
 
-	// Health check endpoint
+// registerHealthCheck adds the liveness and readiness endpoints
+func registerHealthCheck(router *gin.Engine, h *handler.Handler) {
 	router.GET("/api/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"status": "ok",
 			"time":   time.Now().Format(time.RFC3339),
 		})
 	})
+	router.GET("/readyz", h.Readyz)
+}
+
+func setupRouter(h *handler.Handler, rateLimiter *middleware.IPRateLimiter, middlewares []gin.HandlerFunc, withAdmin, sandbox bool) *gin.Engine {
+	// Create gin router without default middlewares, the pipeline adds them
+	router := gin.New()
+	router.Use(middlewares...)
 
-	// API v1 routes
-	v1 := router.Group("/api/v1")
+	registerHealthCheck(router, h)
+
+	// API v1 routes, errors carry a code and mutations are rejected in read-only mode
+	v1 := router.Group("/api/v1", h.ErrorCodes(), h.ReadOnly())
 	{
 		// Public routes
-		v1.GET("/config", func(c *gin.Context) {
-			c.JSON(http.StatusOK, h.GetConfigPublic())
-		})
+		v1.GET("/config", h.ServeConfigPublic)
+		v1.GET("/errors", h.GetErrorCatalog)                     // Error codes with their default messages
+		v1.GET("/rates", h.GetRates)                             // TON price in fiat currencies
+		v1.GET("/withdrawals/batching", h.GetWithdrawalBatching) // Batched withdrawal amounts and the next batch time
+		v1.GET("/ratelimit/token", rateLimiter.IssueBypassToken())
+		v1.GET("/gifts/:code", h.GetGift)
+		v1.GET("/terms/:type", h.GetTerms)
+		v1.GET("/terms/:type/document", h.GetTermsDocument)
+		v1.POST("/payments/:provider/webhook", h.PaymentWebhook)
+		v1.POST("/chain/webhooks/:provider", h.ChainWebhook)      // tonapi / toncenter v3 account events
+		v1.POST("/partners/applications", h.ApplyForPartnerToken) // Apply for a partner rate limit tier
+		// Sign in with TON Connect, issues the session required by account routes
+		v1.POST("/auth/ton-proof/payload", h.CreateTonProofPayload)
+		v1.POST("/auth/ton-proof", h.AccessLog(), h.VerifyTonProof)
+		// Pushes balance, operation and withdrawal events, authenticated with a session
+		v1.GET("/ws", h.ServeWebSocket)
+
 		// User routes
 		users := v1.Group("/users")
 		{
-			// Public routes
-			users.POST("", h.CreateUser)                                     // Create new user
-			users.GET("/by-pubkey/:pub_key", h.GetUser)                      // Get user by public key
-			users.GET("/by-pubkey/:pub_key/referrals", h.GetReferralStats)   // Get referral stats
-			users.GET("/by-pubkey/:pub_key/operations", h.GetUserOperations) // Get operation history
-			users.POST("/withdraw", h.WithdrawFunds)                         // Withdraw TON to user's wallet
+			users.POST("", h.CreateUser) // Create new user
+		}
+
+		// Account routes, only the wallet owner can call them
+		account := users.Group("", h.WalletAuth())
+		{
+			account.GET("/by-pubkey/:pub_key", h.GetUser)                                      // Get user by public key
+			account.PATCH("/by-pubkey/:pub_key/profile", h.UpdateProfile)                      // Update profile and display preferences
+			account.POST("/by-pubkey/:pub_key/close", h.AccessLog(), h.CloseAccount)           // Close account, with balance payout unless kept
+			account.GET("/by-pubkey/:pub_key/referrals", h.GetReferralStats)                   // Get referral stats
+			account.GET("/by-pubkey/:pub_key/referrals/earnings", h.GetReferralEarningHistory) // Referral earnings history
+			account.GET("/by-pubkey/:pub_key/referrals/qr", h.GetReferralQR)                   // QR code of the referral deep link
+			account.GET("/by-pubkey/:pub_key/operations", h.GetUserOperations)                 // Get operation history
+			account.GET("/by-pubkey/:pub_key/operations/export", h.ExportUserOperations)       // Stream full operation history
+			account.POST("/withdraw", h.AccessLog(), h.Idempotency(), h.WithdrawFunds)         // Withdraw TON to user's wallet
+			account.GET("/by-pubkey/:pub_key/withdrawals", h.GetWithdrawalHistory)             // Completed withdrawals
+			account.GET("/by-pubkey/:pub_key/withdrawals/queue", h.GetWithdrawalQueue)         // Queued withdrawals and positions
+			account.GET("/by-pubkey/:pub_key/withdrawals/:id", h.GetUserWithdrawal)            // Status and tx_hash of a withdrawal
+			account.GET("/by-pubkey/:pub_key/balance-history", h.GetBalanceHistory)            // Daily balance snapshots
+
+			// Tags and notes on operations
+			account.PUT("/by-pubkey/:pub_key/operations/:operation_id/annotation", h.SetOperationAnnotation)
+			account.DELETE("/by-pubkey/:pub_key/operations/:operation_id/annotation", h.ClearOperationAnnotation)
+
+			// Address book of withdrawal destinations
+			account.GET("/by-pubkey/:pub_key/address-book", h.GetAddressBook)
+			account.POST("/by-pubkey/:pub_key/address-book", h.CreateAddressBookEntry)
+			account.PATCH("/by-pubkey/:pub_key/address-book/:id", h.UpdateAddressBookEntry)
+			account.DELETE("/by-pubkey/:pub_key/address-book/:id", h.DeleteAddressBookEntry)
+
+			// In-app notification inbox
+			account.GET("/by-pubkey/:pub_key/notifications", h.GetNotifications)
+			account.PATCH("/by-pubkey/:pub_key/notifications", h.MarkNotificationsRead)
+			account.GET("/by-pubkey/:pub_key/notifications/preferences", h.GetNotificationPreferences)
+			account.PUT("/by-pubkey/:pub_key/notifications/preferences", h.UpdateNotificationPreferences)
 
 			// Investment routes
-			users.POST("/by-pubkey/:pub_key/investments", h.CreateInvestment)
-			users.DELETE("/by-pubkey/:pub_key/investments/:investment_id", h.DeleteInvestment)
+			account.POST("/by-pubkey/:pub_key/investments", h.Idempotency(), h.CreateInvestment)
+			account.DELETE("/by-pubkey/:pub_key/investments/:investment_id", h.DeleteInvestment)
 
 			// Deposit routes
-			users.POST("/by-pubkey/:pub_key/deposit", h.CreateDeposit)
-			users.POST("/by-pubkey/:pub_key/deposit/confirm", h.ConfirmDeposit)
+			account.POST("/by-pubkey/:pub_key/deposit", h.Idempotency(), h.CreateDeposit)
+			account.POST("/by-pubkey/:pub_key/deposit/confirm", h.ConfirmDeposit)
+			account.GET("/by-pubkey/:pub_key/deposits", h.GetDepositHistory)
+			account.GET("/by-pubkey/:pub_key/deposit/:id/events", h.StreamDepositEvents) // Deposit status as server-sent events
+			account.POST("/by-pubkey/:pub_key/deposit/:id/cancel", h.CancelDeposit)      // Cancel an unpaid deposit
+			account.GET("/by-pubkey/:pub_key/deposit/:id/qr", h.GetDepositQR)            // QR code of the payment link
+			account.POST("/by-pubkey/:pub_key/payments/:provider", h.CreatePayment)      // Top up via alternative payment rail
 
-			// Admin routes
-			users.DELETE("/:id", h.AdminAuth(), h.DeleteUser)             // Delete user (admin only)
-			users.PUT("/:id/balance", h.AdminAuth(), h.UpdateUserBalance) // Update user balance (admin only)
+			// Investment terms
+			account.POST("/by-pubkey/:pub_key/terms/:type/accept", h.AcceptTerms)
+			account.GET("/by-pubkey/:pub_key/terms", h.GetTermsAcceptances)
+			account.GET("/by-pubkey/:pub_key/products", h.GetProducts) // Investment terms offered to the user
+
+			// Risk disclaimers of high-APY products
+			account.GET("/by-pubkey/:pub_key/risk-disclaimer/:type", h.GetRiskDisclaimer)
+			account.POST("/by-pubkey/:pub_key/risk-disclaimer/:type/acknowledge", h.AcknowledgeRisk)
+			account.GET("/by-pubkey/:pub_key/risk-acknowledgments", h.GetRiskAcknowledgments)
+
+			// Gift routes
+			account.POST("/by-pubkey/:pub_key/gifts", h.CreateGift)
+			account.GET("/by-pubkey/:pub_key/gifts", h.GetGifts)
+			account.POST("/by-pubkey/:pub_key/gifts/claim", h.ClaimGift)
+
+			// Wallet proof and personal API tokens
+			account.POST("/by-pubkey/:pub_key/challenge", h.CreateChallenge)
+			account.POST("/by-pubkey/:pub_key/tokens", h.AccessLog(), h.CreateAPIToken)
+			account.GET("/by-pubkey/:pub_key/tokens", h.GetAPITokens)
+			account.DELETE("/by-pubkey/:pub_key/tokens/:token_id", h.RevokeAPIToken)
+		}
+
+		// Read-only routes for personal API tokens
+		me := v1.Group("/me", h.APITokenAuth())
+		{
+			me.GET("", h.GetUser)
+			me.GET("/referrals", h.GetReferralStats)
+			me.GET("/referrals/earnings", h.GetReferralEarningHistory)
+			me.GET("/operations", h.GetUserOperations)
+			me.GET("/operations/export", h.ExportUserOperations)
+			me.GET("/balance-history", h.GetBalanceHistory)
+			me.GET("/deposits", h.GetDepositHistory)
+			me.GET("/withdrawals", h.GetWithdrawalHistory)
+			me.GET("/withdrawals/queue", h.GetWithdrawalQueue)
+			me.GET("/withdrawals/:id", h.GetUserWithdrawal)
+			me.GET("/address-book", h.GetAddressBook)
+			me.GET("/notifications", h.GetNotifications)
+			me.GET("/products", h.GetProducts)
+		}
+
+		// Demo accounts and sign-in without TON Connect, only in the sandbox
+		if sandbox {
+			sb := v1.Group("/sandbox")
+			{
+				sb.GET("/wallets", h.GetSandboxWallets)
+				sb.POST("/session", h.CreateSandboxSession)
+			}
+		}
+
+		if withAdmin {
+			registerAdminRoutes(v1, h)
 		}
 	}
 
 	return router
 }
+
+// setupAdminRouter serves only the admin routes, for the local admin listener
+func setupAdminRouter(h *handler.Handler, middlewares []gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(middlewares...)
+
+	registerHealthCheck(router, h)
+	registerAdminRoutes(router.Group("/api/v1", h.ErrorCodes(), h.ReadOnly()), h)
+
+	return router
+}
+
+// registerAdminRoutes adds the routes requiring an admin key, AdminAuth checks the role
+// of the key against each route
+func registerAdminRoutes(v1 *gin.RouterGroup, h *handler.Handler) {
+	// Admin user management, in the access log including rejected keys
+	users := v1.Group("/users", h.AccessLog(), h.AdminAuth())
+	{
+		users.DELETE("/:id", h.DeleteUser)             // Delete user
+		users.PUT("/:id/balance", h.UpdateUserBalance) // Update user balance
+	}
+
+	// Admin routes
+	admin := v1.Group("/admin", h.AdminAuth())
+	{
+		admin.GET("/reports/profit-fairness", h.GetProfitFairnessReport) // Configured vs distributed profit
+		admin.GET("/treasury/forecast", h.GetTreasuryForecast)           // Upcoming obligations vs expected inflows
+		admin.GET("/treasury/wallets", h.GetTreasuryWallets)             // Ledger flows vs on-chain balance per wallet
+		admin.GET("/treasury/reserves", h.GetTreasuryReserves)           // Reserves vs liabilities per currency
+		admin.POST("/simulations", h.SimulateConfigChange)               // Replay past weeks with different APYs/referral percents
+		admin.GET("/experiments/:name/report", h.GetExperimentReport)    // Deposit conversion per pricing variant
+		admin.POST("/accruals/run", h.RunProfitAccrual)                  // Run profit accrual now (forced as_of on testnet)
+		admin.POST("/referrals/recompute", h.RecomputeReferralEarnings)  // Diff and compensate referral earnings of a past period
+		admin.GET("/stats", h.GetAdminStats)                             // Query timings and deposit abandonment
+		admin.GET("/toncenter", h.GetToncenterBudget)                    // Toncenter request budget and queue depth
+		admin.GET("/indexer", h.GetIndexerStatus)                        // Treasury indexer cursors
+		admin.GET("/chain/transactions", h.GetChainTransactions)         // Indexed treasury transactions
+		admin.POST("/deposit-addresses/sweep", h.RunDepositSweep)        // Sweep personal deposit addresses to the main wallet
+		admin.PUT("/chain/transactions/:id/investigation", h.SetChainInvestigation)
+		admin.GET("/pauses", h.GetInvestmentPauses)        // Active incident switches
+		admin.PUT("/pauses/:scope", h.SetInvestmentPause)  // Pause investments/accrual globally or per product
+		admin.PUT("/users/:id/referrer", h.ChangeReferrer) // Fix wrong referral attribution
+		admin.GET("/users/:id/attribution-history", h.GetAttributionHistory)
+		admin.GET("/users/:id/risk-acknowledgments", h.GetUserRiskAcknowledgments)
+		admin.GET("/accounts/:number", h.GetUserByAccountNumber)              // Look up a user by account number
+		admin.GET("/users/:id/ledger", h.GetUserLedger)                       // Ledger entries of a user balance
+		admin.GET("/users/:id/balance-as-of", h.GetBalanceAsOf)               // Balance and investments at a past time
+		admin.GET("/ledger/reconcile", h.ReconcileLedger)                     // Check balances against the ledger
+		admin.GET("/alerts", h.GetAlerts)                                     // Firing operator alerts
+		admin.GET("/withdrawals/approvals", h.GetHeldWithdrawals)             // Withdrawals above the approval threshold
+		admin.POST("/withdrawals/approvals/:id/approve", h.ApproveWithdrawal) // Send a held withdrawal
+		admin.POST("/withdrawals/approvals/:id/reject", h.RejectWithdrawal)   // Refund a held withdrawal
+		admin.GET("/withdrawals/transfers", h.GetWithdrawalTransfers)         // Retrying and stuck withdrawal transfers
+		admin.GET("/partners", h.GetPartners)                                 // Partner applications and tokens
+		admin.POST("/partners/:id/approve", h.ApprovePartner)                 // Issue a token in a rate limit tier
+		admin.POST("/partners/:id/revoke", h.RevokePartner)                   // Reject or revoke a partner
+
+		// Why a user can't withdraw, without sending anything
+		admin.POST("/users/:id/withdrawal-check", h.CheckWithdrawal)
+
+		// Deposits the archive lookup couldn't reach
+		admin.GET("/deposits/reviews", h.GetEscalatedDeposits)
+		admin.POST("/deposits/reviews/:id/credit", h.CreditEscalatedDeposit)
+		admin.POST("/deposits/reviews/:id/reject", h.RejectEscalatedDeposit)
+
+		// Payments charged by their provider that couldn't be credited
+		admin.GET("/payments/reviews", h.GetEscalatedPayments)
+
+		// Reverse referral earnings paid on a reversed or fraudulent deposit
+		admin.POST("/users/:id/referral-clawback", h.ClawBackReferralEarnings)
+
+		// Apply config.json without a restart, like SIGHUP
+		admin.POST("/config/reload", h.ReloadConfig)
+
+		// Persisted requests to sensitive routes, for investigations
+		admin.GET("/access-logs", h.GetAccessLogs)
+		admin.GET("/users/:id/access-logs", h.GetAccessLogs)
+
+		// Open the wallets of encrypted mnemonics after a start
+		admin.POST("/wallet/unlock", h.AccessLog(), h.UnlockWallets)
+
+		// Orphaned records, negative balances and other inconsistencies, and their safe repairs
+		admin.GET("/integrity", h.GetIntegrityReport)
+		admin.POST("/integrity/repair", h.AccessLog(), h.RepairIntegrity)
+
+		// Read-only mode, entered on its own when database writes fail
+		admin.GET("/read-only", h.GetReadOnly)
+		admin.PUT("/read-only", h.AccessLog(), h.SetReadOnly)
+
+		// Identity (KYC) verification, raises the deposit limits
+		admin.GET("/users/:id/verification", h.GetUserVerification)
+		admin.PUT("/users/:id/verification", h.AccessLog(), h.SetUserVerification)
+
+		// Freeze accounts under investigation, they can only read their data
+		admin.GET("/users/:id/freeze", h.GetUserFreeze)
+		admin.PUT("/users/:id/freeze", h.AccessLog(), h.FreezeUser)
+		admin.DELETE("/users/:id/freeze", h.AccessLog(), h.UnfreezeUser)
+
+		// Per-user overrides of the withdrawal limits
+		admin.GET("/users/:id/withdrawal-limits", h.GetUserWithdrawalLimits)
+		admin.PUT("/users/:id/withdrawal-limits", h.AccessLog(), h.SetUserWithdrawalLimits)
+		admin.DELETE("/users/:id/withdrawal-limits", h.AccessLog(), h.DeleteUserWithdrawalLimits)
+
+		// Named admin keys with roles, for superadmins
+		admin.GET("/keys", h.GetAdminKeys)
+		admin.POST("/keys", h.AccessLog(), h.CreateAdminKey)
+		admin.DELETE("/keys/:id", h.AccessLog(), h.RevokeAdminKey)
+	}
+}
@@ -0,0 +1,415 @@
+// Command smoketest runs a full user cycle against a testnet deployment:
+// sign in with ton_proof, create user, create deposit, send the transfer from
+// a test wallet, confirm, invest, force an accrual and withdraw with a signed challenge. It reports pass/fail per step and
+// exits non-zero if any step fails, for release validation.
+//
+// The test wallet mnemonic is read from SMOKETEST_MNEMONIC. Its public key is
+// used as the user's pub_key, so the withdrawal is paid back to the test wallet.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/tonproof"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/liteclient"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+	"github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+const testnetConfigURL = "https://ton-blockchain.github.io/testnet-global.config.json"
+
+type smokeTest struct {
+	apiURL   string
+	config   model.Config
+	http     *http.Client
+	wallet   *wallet.Wallet
+	version  wallet.Version
+	pubKey   string
+	domain   string
+	session  string
+	deposit  model.DepositResponse
+	balance  float64
+	failures int
+}
+
+func main() {
+	apiURL := flag.String("api", "http://localhost:8080/api/v1", "base URL of the API under test")
+	configPath := flag.String("config", "config.json", "config of the deployment under test")
+	depositAmount := flag.Float64("deposit", 0, "amount to deposit in TON (default: investment min amount + 2)")
+	investType := flag.String("type", "bronze", "investment type to use")
+	withdrawAmount := flag.Float64("withdraw", 1, "amount to withdraw in TON")
+	confirmTimeout := flag.Duration("confirm-timeout", 5*time.Minute, "how long to wait for the deposit to be confirmed")
+	domain := flag.String("domain", "", "app domain to sign the ton_proof for (default: first auth.allowed_domains entry or the web app host)")
+	flag.Parse()
+
+	configFile, err := os.ReadFile(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to read config file: %v", err)
+	}
+	var config model.Config
+	if err := json.Unmarshal(configFile, &config); err != nil {
+		log.Fatalf("Failed to parse config file: %v", err)
+	}
+	if config.TON.Network != "testnet" {
+		log.Fatalf("Refusing to run against network %q, smoke test is testnet only", config.TON.Network)
+	}
+
+	investConfig, ok := config.InvestmentTypes[*investType]
+	if !ok {
+		log.Fatalf("Unknown investment type %s", *investType)
+	}
+	if *depositAmount == 0 {
+		*depositAmount = investConfig.MinAmount + 2
+	}
+	if *domain == "" {
+		if len(config.Auth.AllowedDomains) > 0 {
+			*domain = config.Auth.AllowedDomains[0]
+		} else if u, err := url.Parse(config.Telegram.WebAppURL); err == nil {
+			*domain = u.Host
+		}
+	}
+
+	mnemonic := strings.TrimSpace(os.Getenv("SMOKETEST_MNEMONIC"))
+	if mnemonic == "" {
+		log.Fatal("SMOKETEST_MNEMONIC is not set")
+	}
+
+	ctx := context.Background()
+	version := walletVersion(config.TON.WalletVersion)
+	w, err := testWallet(ctx, mnemonic, version)
+	if err != nil {
+		log.Fatalf("Failed to open test wallet: %v", err)
+	}
+
+	t := &smokeTest{
+		apiURL:  strings.TrimRight(*apiURL, "/"),
+		config:  config,
+		http:    &http.Client{Timeout: 60 * time.Second},
+		wallet:  w,
+		version: version,
+		pubKey:  hex.EncodeToString(w.PrivateKey().Public().(ed25519.PublicKey)),
+		domain:  *domain,
+	}
+	fmt.Printf("Test wallet %s, pub_key %s\n", w.WalletAddress().String(), t.pubKey)
+
+	steps := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"sign in", t.signIn},
+		{"create user", t.createUser},
+		{"create deposit", func(ctx context.Context) error { return t.createDeposit(*depositAmount) }},
+		{"send transfer", t.sendTransfer},
+		{"confirm deposit", func(ctx context.Context) error { return t.confirmDeposit(*confirmTimeout) }},
+		{"invest", func(ctx context.Context) error { return t.invest(*investType, investConfig.MinAmount) }},
+		{"accrue", t.accrue},
+		{"withdraw", func(ctx context.Context) error { return t.withdraw(*withdrawAmount) }},
+	}
+
+	for _, step := range steps {
+		start := time.Now()
+		err := step.run(ctx)
+		if err != nil {
+			t.failures++
+			fmt.Printf("FAIL  %-16s %v (%s)\n", step.name, err, time.Since(start).Round(time.Millisecond))
+			// Every step depends on the previous one
+			break
+		}
+		fmt.Printf("PASS  %-16s (%s)\n", step.name, time.Since(start).Round(time.Millisecond))
+	}
+
+	if t.failures > 0 {
+		fmt.Println("Smoke test FAILED")
+		os.Exit(1)
+	}
+	fmt.Println("Smoke test PASSED")
+}
+
+func walletVersion(name string) wallet.Version {
+	switch name {
+	case "V3R1":
+		return wallet.V3R1
+	case "V3R2":
+		return wallet.V3R2
+	case "V4R1":
+		return wallet.V4R1
+	case "HighloadV2R2":
+		return wallet.HighloadV2R2
+	}
+	return wallet.V4R2
+}
+
+func testWallet(ctx context.Context, mnemonic string, version wallet.Version) (*wallet.Wallet, error) {
+	pool := liteclient.NewConnectionPool()
+	if err := pool.AddConnectionsFromConfigUrl(ctx, testnetConfigURL); err != nil {
+		return nil, fmt.Errorf("failed to connect to TON: %v", err)
+	}
+	api := ton.NewAPIClient(pool).WithRetry()
+
+	return wallet.FromSeed(api, strings.Fields(mnemonic), version)
+}
+
+// call sends a JSON request and decodes the response envelope into data
+func (t *smokeTest) call(method, path string, body interface{}, admin bool, data interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, t.apiURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if admin {
+		req.Header.Set("X-API-Key", t.config.AdminAPIKey)
+	} else if t.session != "" {
+		req.Header.Set("Authorization", "Bearer "+t.session)
+	}
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Error   string          `json:"error"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return resp.StatusCode, fmt.Errorf("unexpected response (%d): %s", resp.StatusCode, raw)
+	}
+	if !envelope.Success {
+		return resp.StatusCode, fmt.Errorf("%s (%d)", envelope.Error, resp.StatusCode)
+	}
+	if data != nil && len(envelope.Data) > 0 {
+		if err := json.Unmarshal(envelope.Data, data); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (t *smokeTest) userPath(suffix string) string {
+	return "/users/by-pubkey/" + t.pubKey + suffix
+}
+
+func (t *smokeTest) refreshBalance() error {
+	var user model.User
+	if _, err := t.call(http.MethodGet, t.userPath(""), nil, false, &user); err != nil {
+		return err
+	}
+	t.balance = user.Balance
+	return nil
+}
+
+// signIn signs a ton_proof with the test wallet key and stores the session
+func (t *smokeTest) signIn(ctx context.Context) error {
+	var payload model.TonProofPayload
+	if _, err := t.call(http.MethodPost, "/auth/ton-proof/payload", nil, false, &payload); err != nil {
+		return err
+	}
+
+	stateInit, err := wallet.GetStateInit(t.wallet.PrivateKey().Public().(ed25519.PublicKey), t.version, wallet.DefaultSubwallet)
+	if err != nil {
+		return err
+	}
+	stateInitCell, err := tlb.ToCell(stateInit)
+	if err != nil {
+		return err
+	}
+
+	addr := t.wallet.WalletAddress()
+	timestamp := time.Now().Unix()
+	body := model.TonProofRequest{
+		Address:   fmt.Sprintf("%d:%s", addr.Workchain(), hex.EncodeToString(addr.Data())),
+		Network:   "-3",
+		PublicKey: t.pubKey,
+		Proof: model.TonProof{
+			Timestamp: timestamp,
+			Domain:    model.TonProofDomain{LengthBytes: uint32(len(t.domain)), Value: t.domain},
+			Payload:   payload.Payload,
+			Signature: tonproof.Sign(t.wallet.PrivateKey(), addr.Workchain(), addr.Data(), t.domain, timestamp, payload.Payload),
+			StateInit: base64.StdEncoding.EncodeToString(stateInitCell.ToBOC()),
+		},
+	}
+
+	var session model.AuthSession
+	if _, err := t.call(http.MethodPost, "/auth/ton-proof", body, false, &session); err != nil {
+		return err
+	}
+	t.session = session.Token
+	return nil
+}
+
+func (t *smokeTest) createUser(ctx context.Context) error {
+	if _, err := t.call(http.MethodPost, "/users", map[string]string{"pub_key": t.pubKey}, false, nil); err != nil {
+		return err
+	}
+	return t.refreshBalance()
+}
+
+func (t *smokeTest) createDeposit(amount float64) error {
+	body := model.CreateDepositRequest{PubKey: t.pubKey, Amount: amount}
+	if _, err := t.call(http.MethodPost, t.userPath("/deposit"), body, false, &t.deposit); err != nil {
+		return err
+	}
+	// Personal deposit addresses don't need a memo
+	if t.deposit.WalletAddress == "" {
+		return fmt.Errorf("deposit %d has no wallet address", t.deposit.ID)
+	}
+	return nil
+}
+
+func (t *smokeTest) sendTransfer(ctx context.Context) error {
+	to, err := address.ParseAddr(t.deposit.WalletAddress)
+	if err != nil {
+		return fmt.Errorf("invalid deposit address %s: %v", t.deposit.WalletAddress, err)
+	}
+	amount, err := tlb.FromTON(strconv.FormatFloat(t.deposit.Amount, 'f', -1, 64))
+	if err != nil {
+		return err
+	}
+	return t.wallet.Transfer(ctx, to, amount, t.deposit.Memo, true)
+}
+
+func (t *smokeTest) confirmDeposit(timeout time.Duration) error {
+	body := model.ConfirmDepositRequest{PubKey: t.pubKey, ID: t.deposit.ID}
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := t.call(http.MethodPost, t.userPath("/deposit/confirm"), body, false, nil)
+		if err == nil && status == http.StatusOK {
+			break
+		}
+		if err != nil && status != http.StatusBadRequest {
+			return err
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("still awaiting confirmations")
+			}
+			return fmt.Errorf("deposit not confirmed after %s: %v", timeout, err)
+		}
+		time.Sleep(10 * time.Second)
+	}
+
+	before := t.balance
+	if err := t.refreshBalance(); err != nil {
+		return err
+	}
+	if t.balance < before+t.deposit.Amount-1e-9 {
+		return fmt.Errorf("balance %.9f wasn't credited with %.9f", t.balance, t.deposit.Amount)
+	}
+	return nil
+}
+
+func (t *smokeTest) invest(investType string, amount float64) error {
+	body := map[string]interface{}{
+		"type":                 investType,
+		"amount":               amount,
+		"accept_terms_version": t.config.Terms[investType].Version,
+	}
+	if _, err := t.call(http.MethodPost, t.userPath("/investments"), body, false, nil); err != nil {
+		return err
+	}
+	return t.refreshBalance()
+}
+
+func (t *smokeTest) accrue(ctx context.Context) error {
+	// Accrue as if a week (plus a margin) has passed since the investment was made
+	body := map[string]int64{"as_of": time.Now().Unix() + 7*24*60*60 + 60}
+	var result struct {
+		AccruedPeriods int `json:"accrued_periods"`
+	}
+	if _, err := t.call(http.MethodPost, "/admin/accruals/run", body, true, &result); err != nil {
+		return err
+	}
+	if result.AccruedPeriods == 0 {
+		return fmt.Errorf("no profit periods were accrued")
+	}
+
+	before := t.balance
+	if err := t.refreshBalance(); err != nil {
+		return err
+	}
+	if t.balance <= before {
+		return fmt.Errorf("balance %.9f didn't grow after accrual", t.balance)
+	}
+	return nil
+}
+
+// withdrawTimeout bounds the wait for the withdrawal worker to send the withdrawal
+const withdrawTimeout = 2 * time.Minute
+
+// withdraw confirms the withdrawal by signing its challenge with the test wallet key and
+// waits until it is sent
+func (t *smokeTest) withdraw(amount float64) error {
+	var challenge model.SignatureChallenge
+	challengeReq := model.ChallengeRequest{Purpose: "withdrawal", Amount: amount}
+	if _, err := t.call(http.MethodPost, t.userPath("/challenge"), challengeReq, false, &challenge); err != nil {
+		return fmt.Errorf("challenge: %w", err)
+	}
+	signature := ed25519.Sign(t.wallet.PrivateKey(), []byte(challenge.Message))
+
+	body := model.WithdrawalRequest{PubKey: t.pubKey, Amount: amount, Nonce: challenge.Nonce, Signature: hex.EncodeToString(signature)}
+	var withdrawal model.QueuedWithdrawal
+	if _, err := t.call(http.MethodPost, "/users/withdraw", body, false, &withdrawal); err != nil {
+		return err
+	}
+
+	// The withdrawal worker sends it in the background
+	deadline := time.Now().Add(withdrawTimeout)
+	for withdrawal.Status == model.QueueStatusProcessing || withdrawal.Status == model.QueueStatusSending {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("withdrawal %d still %s after %s", withdrawal.ID, withdrawal.Status, withdrawTimeout)
+		}
+		time.Sleep(2 * time.Second)
+		if _, err := t.call(http.MethodGet, t.userPath(fmt.Sprintf("/withdrawals/%d", withdrawal.ID)), nil, false, &withdrawal); err != nil {
+			return fmt.Errorf("withdrawal status: %w", err)
+		}
+	}
+	switch withdrawal.Status {
+	case model.QueueStatusSent:
+	case model.QueueStatusQueued:
+		return fmt.Errorf("withdrawal was queued, hot wallet lacks liquidity")
+	case model.QueueStatusFailed:
+		return fmt.Errorf("withdrawal failed: %s", withdrawal.Error)
+	default:
+		return fmt.Errorf("withdrawal is %s", withdrawal.Status)
+	}
+	if withdrawal.TxHash == "" {
+		return fmt.Errorf("withdrawal returned no tx hash")
+	}
+	fmt.Printf("      withdrawal tx %s\n", withdrawal.TxHash)
+	return nil
+}
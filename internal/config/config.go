@@ -3,37 +3,83 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Tracing  TracingConfig
 }
 
 type ServerConfig struct {
 	Port         string
+	Listen       []string // addresses serving the API; defaults to :Port
+	AdminListen  string   // separate local-only address for admin routes; empty serves them with the API
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// ShutdownTimeout bounds how long a shutdown waits for requests and background jobs
+	ShutdownTimeout time.Duration
 }
 
 type DatabaseConfig struct {
-	Path string
+	Path               string
+	QueryLog           bool          // log every query with its duration
+	SlowQueryThreshold time.Duration // log and count queries slower than this; 0 disables
+}
+
+// TracingConfig is read from the standard OpenTelemetry exporter variables
+type TracingConfig struct {
+	Endpoint    string            // OTLP/HTTP traces URL; empty disables tracing
+	ServiceName string            // service.name of the spans
+	SampleRatio float64           // share of traces recorded
+	Headers     map[string]string // sent with every export
+}
+
+// Enabled reports whether spans are exported
+func (c TracingConfig) Enabled() bool {
+	return c.Endpoint != ""
 }
 
 func Load() *Config {
+	port := getEnv("PORT", "8080")
 	return &Config{
 		Server: ServerConfig{
-			Port:         getEnv("PORT", "8080"),
+			Port:         port,
+			Listen:       getEnvAsList("LISTEN", []string{":" + port}),
+			AdminListen:  getEnv("ADMIN_LISTEN", ""),
 			ReadTimeout:  time.Duration(getEnvAsInt("READ_TIMEOUT", 10)) * time.Second,
 			WriteTimeout: time.Duration(getEnvAsInt("WRITE_TIMEOUT", 10)) * time.Second,
+
+			ShutdownTimeout: time.Duration(getEnvAsInt("SHUTDOWN_TIMEOUT", 30)) * time.Second,
 		},
 		Database: DatabaseConfig{
-			Path: getEnv("DB_PATH", "./tonapp.db"),
+			Path:               getEnv("DB_PATH", "./tonapp.db"),
+			QueryLog:           getEnvAsBool("DB_QUERY_LOG", false),
+			SlowQueryThreshold: time.Duration(getEnvAsInt("DB_SLOW_QUERY_MS", 0)) * time.Millisecond,
+		},
+		Tracing: TracingConfig{
+			Endpoint:    tracesEndpoint(),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "tonapp"),
+			SampleRatio: getEnvAsFloat("OTEL_TRACES_SAMPLER_ARG", 1),
+			Headers:     getEnvAsMap("OTEL_EXPORTER_OTLP_HEADERS"),
 		},
 	}
 }
 
+// tracesEndpoint returns OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or the traces path of
+// OTEL_EXPORTER_OTLP_ENDPOINT
+func tracesEndpoint() string {
+	if endpoint := getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
 func getEnv(key string, defaultVal string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -48,3 +94,44 @@ func getEnvAsInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+// getEnvAsList splits a comma separated variable, skipping empty items
+func getEnvAsList(key string, defaultVal []string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return defaultVal
+	}
+	return items
+}
+
+func getEnvAsFloat(key string, defaultVal float64) float64 {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+		return value
+	}
+	return defaultVal
+}
+
+// getEnvAsMap parses a comma separated list of key=value pairs
+func getEnvAsMap(key string) map[string]string {
+	items := make(map[string]string)
+	for _, item := range getEnvAsList(key, nil) {
+		if k, v, ok := strings.Cut(item, "="); ok && strings.TrimSpace(k) != "" {
+			items[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return items
+}
+
+func getEnvAsBool(key string, defaultVal bool) bool {
+	valueStr := getEnv(key, "")
+	if value, err := strconv.ParseBool(valueStr); err == nil {
+		return value
+	}
+	return defaultVal
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret returns the environment variable key or, when it isn't set, the contents of
+// the file named by key_FILE without surrounding whitespace. Files are how Docker and
+// Kubernetes secrets and secret store agents such as Vault Agent hand out values.
+// ok is false when neither is set.
+func Secret(key string) (value string, ok bool, err error) {
+	if value, exists := os.LookupEnv(key); exists {
+		return value, true, nil
+	}
+	path, exists := os.LookupEnv(key + "_FILE")
+	if !exists || path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s_FILE: %v", key, err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// SecretName turns a config name such as a treasury wallet name into the part of a
+// variable name, like "cold-1" into "COLD_1"
+func SecretName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+}
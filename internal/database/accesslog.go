@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// AddAccessLog records a request to a sensitive route
+func (d *Database) AddAccessLog(entry *model.AccessLogEntry) error {
+	var userID sql.NullInt64
+	if entry.UserID != nil {
+		userID = sql.NullInt64{Int64: int64(*entry.UserID), Valid: true}
+	}
+	result, err := d.db.Exec(`
+		INSERT INTO access_logs (created_at, request_id, method, route, path, status, duration_ms,
+			user_id, pub_key, admin, admin_key, client_ip, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.CreatedAt, entry.RequestID, entry.Method, entry.Route, entry.Path, entry.Status, entry.DurationMs,
+		userID, entry.PubKey, entry.Admin, entry.AdminKey, entry.ClientIP, entry.UserAgent)
+	if err != nil {
+		return err
+	}
+	entry.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetAccessLogs returns access log entries matching the filter, newest first
+func (d *Database) GetAccessLogs(filter model.AccessLogFilter, page pagination.Params) (*model.AccessLogPage, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.PubKey != "" {
+		conditions = append(conditions, "pub_key = ?")
+		args = append(args, strings.ToLower(filter.PubKey))
+	}
+	if filter.Route != "" {
+		conditions = append(conditions, "route = ?")
+		args = append(args, filter.Route)
+	}
+	if filter.Method != "" {
+		conditions = append(conditions, "method = ?")
+		args = append(args, strings.ToUpper(filter.Method))
+	}
+	if filter.Status != 0 {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.ClientIP != "" {
+		conditions = append(conditions, "client_ip = ?")
+		args = append(args, filter.ClientIP)
+	}
+	if filter.AdminKey != "" {
+		conditions = append(conditions, "admin_key = ?")
+		args = append(args, filter.AdminKey)
+	}
+	if filter.From != 0 {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To != 0 {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM access_logs"+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	if cond, condArgs := page.Where("created_at", "id"); cond != "" {
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, condArgs...)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, created_at, request_id, method, route, path, status, duration_ms,
+			user_id, pub_key, admin, admin_key, client_ip, user_agent
+		FROM access_logs`+where+` ORDER BY created_at DESC, id DESC LIMIT ?`,
+		append(args, page.FetchLimit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]model.AccessLogEntry, 0)
+	for rows.Next() {
+		var e model.AccessLogEntry
+		var userID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.RequestID, &e.Method, &e.Route, &e.Path, &e.Status, &e.DurationMs,
+			&userID, &e.PubKey, &e.Admin, &e.AdminKey, &e.ClientIP, &e.UserAgent); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			e.UserID = &id
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, next := pagination.Trim(entries, page, func(e model.AccessLogEntry) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	return &model.AccessLogPage{
+		Entries:    entries,
+		Total:      total,
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// DeleteAccessLogsBefore removes the access log entries created before a unix time and
+// returns how many were removed
+func (d *Database) DeleteAccessLogsBefore(before int64) (int, error) {
+	result, err := d.db.Exec(`DELETE FROM access_logs WHERE created_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+	"tonapp/internal/model"
+)
+
+// backfillAccountNumbers assigns account numbers to the users registered before they
+// existed, in registration order, so the oldest accounts get the lowest numbers.
+// Users keep their random IDs; numbers are only a mapping to them.
+func backfillAccountNumbers(db *sql.DB) error {
+	result, err := db.Exec(`
+		INSERT INTO account_numbers (user_id, assigned_at)
+		SELECT id, ? FROM users
+		WHERE id NOT IN (SELECT user_id FROM account_numbers)
+		ORDER BY created_at, id`,
+		time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		slog.Info("Assigned account numbers", "count", n)
+	}
+	return nil
+}
+
+// accountNumber returns the formatted account number of a user
+func (d *Database) accountNumber(userID int) (string, error) {
+	var number int64
+	err := d.db.QueryRow("SELECT number FROM account_numbers WHERE user_id = ?", userID).Scan(&number)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return model.FormatAccountNumber(number), nil
+}
+
+// GetUserByAccountNumber returns the user with the given account number
+func (d *Database) GetUserByAccountNumber(number int64) (*model.User, error) {
+	var userID int
+	err := d.db.QueryRow("SELECT user_id FROM account_numbers WHERE number = ?", number).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetUser(userID)
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// GetInvestmentsDueForAccrual returns investments whose last accrual
+// (or creation, if never accrued) happened at or before the given time
+func (d *Database) GetInvestmentsDueForAccrual(before int64) ([]model.Investment, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, type, amount, created_at, last_accrued_at
+		FROM investments
+		WHERE (CASE WHEN last_accrued_at > 0 THEN last_accrued_at ELSE created_at END) <= ?
+		ORDER BY id`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var investments []model.Investment
+	for rows.Next() {
+		var inv model.Investment
+		if err := rows.Scan(&inv.ID, &inv.UserID, &inv.Type, &inv.Amount, &inv.CreatedAt, &inv.LastAccruedAt); err != nil {
+			return nil, err
+		}
+		investments = append(investments, inv)
+	}
+
+	return investments, rows.Err()
+}
+
+// AccrueInvestmentProfit credits net profit of one accrual period to the user,
+// moves the investment accrual cursor to periodEnd and records the operation
+func (d *Database) AccrueInvestmentProfit(inv model.Investment, grossProfit, fee float64, weeklyPercent float64, periodEnd int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	netProfit := money.Round(grossProfit - fee)
+
+	result, err := tx.Exec("UPDATE investments SET last_accrued_at = ? WHERE id = ? AND last_accrued_at = ?",
+		periodEnd, inv.ID, inv.LastAccruedAt)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("investment %d was already accrued", inv.ID)
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindInvestmentProfit,
+		Reference: fmt.Sprintf("investment:%d", inv.ID),
+		From:      systemAccount(model.LedgerAccountProfit),
+		To:        userAccount(inv.UserID),
+		Amount:    netProfit,
+		CreatedAt: periodEnd,
+	})
+	if err != nil {
+		return err
+	}
+
+	extraJSON, err := json.Marshal(map[string]interface{}{
+		"investment_id":  inv.ID,
+		"type":           inv.Type,
+		"weekly_percent": weeklyPercent,
+		"gross_profit":   grossProfit,
+		"fee":            fee,
+		"period_end":     periodEnd,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO operations (user_id, type, amount, description, created_at, extra)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		inv.UserID, model.OperationTypeInvestmentProfit, netProfit,
+		fmt.Sprintf("Profit from %s investment", inv.Type), periodEnd, extraJSON)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
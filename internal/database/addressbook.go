@@ -0,0 +1,100 @@
+package database
+
+import (
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreateAddressBookEntry saves a labeled address of a user
+func (d *Database) CreateAddressBookEntry(userID int, label, address string) (*model.AddressBookEntry, error) {
+	now := time.Now().Unix()
+	result, err := d.db.Exec(`
+		INSERT INTO address_book (user_id, label, address, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, label, address, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AddressBookEntry{
+		ID:        id,
+		UserID:    userID,
+		Label:     label,
+		Address:   address,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// GetAddressBook returns the saved addresses of a user, oldest first
+func (d *Database) GetAddressBook(userID int) ([]model.AddressBookEntry, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, label, address, created_at, updated_at
+		FROM address_book WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]model.AddressBookEntry, 0)
+	for rows.Next() {
+		var e model.AddressBookEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Label, &e.Address, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetAddressBookEntry returns a saved address of a user
+func (d *Database) GetAddressBookEntry(userID int, id int64) (*model.AddressBookEntry, error) {
+	var e model.AddressBookEntry
+	err := d.db.QueryRow(`
+		SELECT id, user_id, label, address, created_at, updated_at
+		FROM address_book WHERE id = ? AND user_id = ?`, id, userID).
+		Scan(&e.ID, &e.UserID, &e.Label, &e.Address, &e.CreatedAt, &e.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// UpdateAddressBookLabel renames a saved address of a user
+func (d *Database) UpdateAddressBookLabel(userID int, id int64, label string) error {
+	result, err := d.db.Exec("UPDATE address_book SET label = ?, updated_at = ? WHERE id = ? AND user_id = ?",
+		label, time.Now().Unix(), id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("address book entry not found")
+	}
+	return nil
+}
+
+// DeleteAddressBookEntry removes a saved address of a user
+func (d *Database) DeleteAddressBookEntry(userID int, id int64) error {
+	result, err := d.db.Exec("DELETE FROM address_book WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("address book entry not found")
+	}
+	return nil
+}
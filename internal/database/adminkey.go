@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreateAdminKey stores a new admin key by its hash
+func (d *Database) CreateAdminKey(name, role, prefix, keyHash, createdBy string) (*model.AdminKey, error) {
+	now := time.Now().Unix()
+	result, err := d.db.Exec(`
+		INSERT INTO admin_keys (name, role, prefix, key_hash, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		name, role, prefix, keyHash, createdBy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.AdminKey{
+		ID:        id,
+		Name:      name,
+		Role:      role,
+		Prefix:    prefix,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}, nil
+}
+
+// GetAdminKeyByHash returns an active admin key by its hash and updates its last usage
+// time. A failed update doesn't reject the key, so admins can still sign in to fix a
+// database that can't be written.
+func (d *Database) GetAdminKeyByHash(keyHash string) (*model.AdminKey, error) {
+	var key model.AdminKey
+	var lastUsedAt sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT id, name, role, prefix, created_by, created_at, last_used_at
+		FROM admin_keys
+		WHERE key_hash = ? AND revoked_at IS NULL`, keyHash).
+		Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.CreatedBy, &key.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Int64
+	}
+
+	d.db.Exec("UPDATE admin_keys SET last_used_at = ? WHERE id = ?", time.Now().Unix(), key.ID)
+	return &key, nil
+}
+
+// GetAdminKeys lists all admin keys including revoked ones
+func (d *Database) GetAdminKeys() ([]model.AdminKey, error) {
+	rows, err := d.db.Query(`
+		SELECT id, name, role, prefix, created_by, created_at, last_used_at, revoked_at
+		FROM admin_keys
+		ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]model.AdminKey, 0)
+	for rows.Next() {
+		var key model.AdminKey
+		var lastUsedAt, revokedAt sql.NullInt64
+		if err := rows.Scan(&key.ID, &key.Name, &key.Role, &key.Prefix, &key.CreatedBy, &key.CreatedAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Int64
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Int64
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAdminKey revokes an admin key, it stops working right away
+func (d *Database) RevokeAdminKey(id int64) error {
+	result, err := d.db.Exec("UPDATE admin_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("admin key not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+)
+
+// SetOperationAnnotation replaces the tags and note of a user's operation, returning
+// sql.ErrNoRows if the operation isn't the user's
+func (d *Database) SetOperationAnnotation(userID int, operationID int64, tags []string, note string) (*model.OperationAnnotation, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var owner int
+	if err := tx.QueryRow("SELECT user_id FROM operations WHERE id = ?", operationID).Scan(&owner); err != nil {
+		return nil, err
+	}
+	if owner != userID {
+		return nil, sql.ErrNoRows
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(`
+		INSERT INTO operation_annotations (operation_id, user_id, note, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(operation_id) DO UPDATE SET note = excluded.note, updated_at = excluded.updated_at`,
+		operationID, userID, note, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM operation_tags WHERE operation_id = ?", operationID); err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		_, err := tx.Exec("INSERT INTO operation_tags (operation_id, user_id, tag) VALUES (?, ?, ?)", operationID, userID, tag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &model.OperationAnnotation{
+		OperationID: operationID,
+		UserID:      userID,
+		Tags:        tags,
+		Note:        note,
+		UpdatedAt:   now,
+	}, nil
+}
+
+// ClearOperationAnnotation removes the tags and note of a user's operation
+func (d *Database) ClearOperationAnnotation(userID int, operationID int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM operation_tags WHERE operation_id = ? AND user_id = ?", operationID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM operation_annotations WHERE operation_id = ? AND user_id = ?", operationID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetOperationAnnotations returns the annotations of a user's operations by operation ID
+func (d *Database) GetOperationAnnotations(userID int) (map[int64]model.OperationAnnotation, error) {
+	rows, err := d.db.Query(`
+		SELECT operation_id, note, updated_at
+		FROM operation_annotations WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(map[int64]model.OperationAnnotation)
+	for rows.Next() {
+		a := model.OperationAnnotation{UserID: userID, Tags: []string{}}
+		if err := rows.Scan(&a.OperationID, &a.Note, &a.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		annotations[a.OperationID] = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.db.Query("SELECT operation_id, tag FROM operation_tags WHERE user_id = ? ORDER BY operation_id, tag", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var operationID int64
+		var tag string
+		if err := rows.Scan(&operationID, &tag); err != nil {
+			return nil, err
+		}
+		if a, ok := annotations[operationID]; ok {
+			a.Tags = append(a.Tags, tag)
+			annotations[operationID] = a
+		}
+	}
+	return annotations, rows.Err()
+}
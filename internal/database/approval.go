@@ -0,0 +1,237 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// HoldWithdrawal reserves the amount from the user balance and records a withdrawal
+// request waiting for admin approval
+func (d *Database) HoldWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.HeldWithdrawal, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(`
+		INSERT INTO withdrawal_requests (user_id, amount, status, created_at, destination)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, amount, model.WithdrawalStatusPendingApproval, now, destination)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWithdrawalCaps(tx, userID, caps); err != nil {
+		return nil, err
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalHeld,
+		Reference: fmt.Sprintf("withdrawal_request:%d", id),
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountWithdrawalApproval),
+		Amount:    amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetHeldWithdrawal(id)
+}
+
+// GetHeldWithdrawal returns a withdrawal request of the approval queue
+func (d *Database) GetHeldWithdrawal(id int64) (*model.HeldWithdrawal, error) {
+	var w model.HeldWithdrawal
+	var txHash sql.NullString
+	var reviewedAt sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT w.id, w.user_id, u.pub_key, w.amount, w.status, w.tx_hash, w.reason, w.created_at, w.reviewed_at, w.treasury_wallet, w.destination, w.queue_id
+		FROM withdrawal_requests w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.id = ? AND w.status IN (?, ?, ?, ?, ?, ?)`,
+		id, model.WithdrawalStatusPendingApproval, model.WithdrawalStatusApproved, model.WithdrawalStatusSending, model.WithdrawalStatusSent,
+		model.WithdrawalStatusRejected, model.WithdrawalStatusFailed).
+		Scan(&w.ID, &w.UserID, &w.PubKey, &w.Amount, &w.Status, &txHash, &w.Reason, &w.CreatedAt, &reviewedAt, &w.TreasuryWallet, &w.Destination, &w.QueueID)
+	if err != nil {
+		return nil, err
+	}
+
+	w.TxHash = txHash.String
+	if reviewedAt.Valid {
+		w.ReviewedAt = &reviewedAt.Int64
+	}
+
+	return &w, nil
+}
+
+// GetHeldWithdrawals returns the withdrawal requests of the approval queue with the given
+// status, oldest first; an empty status returns every status
+func (d *Database) GetHeldWithdrawals(status string) ([]model.HeldWithdrawal, error) {
+	query := "SELECT id FROM withdrawal_requests WHERE status IN (?, ?, ?, ?, ?, ?)"
+	args := []interface{}{
+		model.WithdrawalStatusPendingApproval, model.WithdrawalStatusApproved, model.WithdrawalStatusSending, model.WithdrawalStatusSent,
+		model.WithdrawalStatusRejected, model.WithdrawalStatusFailed,
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	return d.getHeldWithdrawals(query+" ORDER BY id", args...)
+}
+
+// GetUserHeldWithdrawals returns the user's withdrawal requests of the approval queue, newest first
+func (d *Database) GetUserHeldWithdrawals(userID int) ([]model.HeldWithdrawal, error) {
+	return d.getHeldWithdrawals(`
+		SELECT id FROM withdrawal_requests
+		WHERE user_id = ? AND status IN (?, ?, ?, ?, ?, ?)
+		ORDER BY id DESC LIMIT 50`,
+		userID, model.WithdrawalStatusPendingApproval, model.WithdrawalStatusApproved, model.WithdrawalStatusSending, model.WithdrawalStatusSent,
+		model.WithdrawalStatusRejected, model.WithdrawalStatusFailed)
+}
+
+// getHeldWithdrawals loads the requests whose IDs the query selects
+func (d *Database) getHeldWithdrawals(query string, args ...interface{}) ([]model.HeldWithdrawal, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	withdrawals := make([]model.HeldWithdrawal, 0, len(ids))
+	for _, id := range ids {
+		w, err := d.GetHeldWithdrawal(id)
+		if err == sql.ErrNoRows {
+			continue // user deleted
+		}
+		if err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, *w)
+	}
+	return withdrawals, nil
+}
+
+// ApproveHeldWithdrawal moves a request waiting for approval to the withdrawal worker: its
+// reserved amount moves to a processing withdrawal_queue entry, dated like the request
+// so withdrawal limits count it the same, and the request becomes approved. Fails if the
+// request was changed concurrently.
+func (d *Database) ApproveHeldWithdrawal(w model.HeldWithdrawal) (*model.QueuedWithdrawal, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO withdrawal_queue (user_id, amount, status, created_at, destination)
+		VALUES (?, ?, ?, ?, ?)`,
+		w.UserID, w.Amount, model.QueueStatusProcessing, w.CreatedAt, w.Destination)
+	if err != nil {
+		return nil, err
+	}
+	queueID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	result, err = tx.Exec(`
+		UPDATE withdrawal_requests SET status = ?, reviewed_at = ?, queue_id = ?
+		WHERE id = ? AND status = ?`,
+		model.WithdrawalStatusApproved, now, queueID, w.ID, model.WithdrawalStatusPendingApproval)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("withdrawal request %d is not %s", w.ID, model.WithdrawalStatusPendingApproval)
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalApproved,
+		Reference: fmt.Sprintf("withdrawal_request:%d", w.ID),
+		From:      systemAccount(model.LedgerAccountWithdrawalApproval),
+		To:        systemAccount(model.LedgerAccountWithdrawalQueue),
+		Amount:    w.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return d.GetQueuedWithdrawal(queueID)
+}
+
+// ReleaseHeldWithdrawal rejects a request waiting for approval, or fails one being sent
+// (status failed), and returns the reserved funds to the user
+func (d *Database) ReleaseHeldWithdrawal(w model.HeldWithdrawal, status string, reason string) error {
+	from, kind := model.WithdrawalStatusPendingApproval, model.LedgerKindWithdrawalRejected
+	if status == model.WithdrawalStatusFailed {
+		from, kind = model.WithdrawalStatusSending, model.LedgerKindWithdrawalFailed
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE withdrawal_requests SET status = ?, reason = ?, reviewed_at = ?
+		WHERE id = ? AND status = ?`,
+		status, reason, time.Now().Unix(), w.ID, from)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("withdrawal request %d can't be %s", w.ID, status)
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      kind,
+		Reference: fmt.Sprintf("withdrawal_request:%d", w.ID),
+		From:      systemAccount(model.LedgerAccountWithdrawalApproval),
+		To:        userAccount(w.UserID),
+		Amount:    w.Amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
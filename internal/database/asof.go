@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// archiveClosedInvestment keeps a closed investment, which is deleted from the investments
+// table, so the positions of a user can be reconstructed for any past time
+func archiveClosedInvestment(tx *sql.Tx, userID int, inv model.HistoricalInvestment) error {
+	_, err := tx.Exec(`
+		INSERT INTO closed_investments (id, user_id, type, amount, created_at, closed_at, closed_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		inv.ID, userID, inv.Type, inv.Amount, inv.CreatedAt, *inv.ClosedAt, inv.ClosedBy)
+	return err
+}
+
+// backfillClosedInvestments fills closed_investments from the investment_closed operations
+// recorded before the table existed. It does nothing once the table has rows.
+func backfillClosedInvestments(db *sql.DB) error {
+	var archived int
+	if err := db.QueryRow("SELECT COUNT(*) FROM closed_investments").Scan(&archived); err != nil {
+		return err
+	}
+	if archived > 0 {
+		return nil
+	}
+
+	rows, err := db.Query("SELECT user_id, amount, created_at, extra FROM operations WHERE type = ?", model.OperationTypeInvestmentClosed)
+	if err != nil {
+		return err
+	}
+	type closed struct {
+		userID int
+		inv    model.HistoricalInvestment
+	}
+	var investments []closed
+	for rows.Next() {
+		var c closed
+		var closedAt int64
+		var extra []byte
+		if err := rows.Scan(&c.userID, &c.inv.Amount, &closedAt, &extra); err != nil {
+			rows.Close()
+			return err
+		}
+		var details struct {
+			Type              string `json:"type"`
+			InvestmentID      int64  `json:"investment_id"`
+			InvestmentCreated int64  `json:"investment_created"`
+			ClosedBy          string `json:"closed_by"`
+		}
+		if err := json.Unmarshal(extra, &details); err != nil || details.InvestmentID == 0 {
+			continue
+		}
+		c.inv.ID = details.InvestmentID
+		c.inv.Type = details.Type
+		c.inv.CreatedAt = details.InvestmentCreated
+		c.inv.ClosedAt = &closedAt
+		c.inv.ClosedBy = details.ClosedBy
+		investments = append(investments, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(investments) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range investments {
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO closed_investments (id, user_id, type, amount, created_at, closed_at, closed_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			c.inv.ID, c.userID, c.inv.Type, c.inv.Amount, c.inv.CreatedAt, *c.inv.ClosedAt, c.inv.ClosedBy)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBalanceAsOf reconstructs the balance and open investments of a user at a past time.
+// The balance sums the user's ledger entries up to at; before the ledger was opened it
+// falls back to the last daily snapshot. Investments come from the open and closed ones.
+func (d *Database) GetBalanceAsOf(userID int, at int64) (*model.BalanceAsOf, error) {
+	result := &model.BalanceAsOf{
+		UserID:      userID,
+		At:          at,
+		Source:      model.BalanceSourceLedger,
+		Investments: make([]model.HistoricalInvestment, 0),
+	}
+
+	var ledgerStart sql.NullInt64
+	err := d.db.QueryRow("SELECT MIN(created_at) FROM ledger_transfers WHERE kind = ?", model.LedgerKindOpeningBalance).Scan(&ledgerStart)
+	if err != nil {
+		return nil, err
+	}
+	if ledgerStart.Valid {
+		result.LedgerStart = &ledgerStart.Int64
+	}
+
+	err = d.db.QueryRow(`
+		SELECT COALESCE(SUM(e.credit - e.debit), 0), COUNT(*)
+		FROM ledger_entries e
+		JOIN ledger_transfers t ON t.id = e.transfer_id
+		WHERE e.account = ? AND e.user_id = ? AND t.created_at <= ?`,
+		model.LedgerAccountUser, userID, at).Scan(&result.Balance, &result.LedgerEntries)
+	if err != nil {
+		return nil, err
+	}
+	result.Balance = money.Round(result.Balance)
+
+	var snapshot model.BalanceSnapshot
+	err = d.db.QueryRow(`
+		SELECT user_id, snapshot_date, balance, invested, total_earnings, created_at
+		FROM balance_snapshots
+		WHERE user_id = ? AND created_at <= ?
+		ORDER BY created_at DESC
+		LIMIT 1`,
+		userID, at).Scan(&snapshot.UserID, &snapshot.Date, &snapshot.Balance, &snapshot.Invested, &snapshot.TotalEarnings, &snapshot.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		result.Snapshot = &snapshot
+	}
+
+	if ledgerStart.Valid && at < ledgerStart.Int64 {
+		result.Source = model.BalanceSourceNone
+		result.Balance = 0
+		if result.Snapshot != nil {
+			result.Source = model.BalanceSourceSnapshot
+			result.Balance = result.Snapshot.Balance
+		}
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, type, amount, created_at, NULL, ''
+		FROM investments
+		WHERE user_id = ? AND created_at <= ?
+		UNION ALL
+		SELECT id, type, amount, created_at, closed_at, closed_by
+		FROM closed_investments
+		WHERE user_id = ? AND created_at <= ? AND closed_at > ?
+		ORDER BY 4, 1`,
+		userID, at, userID, at, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inv model.HistoricalInvestment
+		var closedAt sql.NullInt64
+		if err := rows.Scan(&inv.ID, &inv.Type, &inv.Amount, &inv.CreatedAt, &closedAt, &inv.ClosedBy); err != nil {
+			return nil, err
+		}
+		if closedAt.Valid {
+			inv.ClosedAt = &closedAt.Int64
+		}
+		result.Invested += inv.Amount
+		result.Investments = append(result.Investments, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.Invested = money.Round(result.Invested)
+
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// maxReferrerChainDepth bounds the walk up the referrer chain when checking for cycles
+const maxReferrerChainDepth = 1000
+
+// ChangeReferrer replaces the referrer of a user and records the change in attribution history.
+// A nil newRefID removes the attribution.
+func (d *Database) ChangeReferrer(userID int, newRefID *int, reason string, changedBy string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldRefID sql.NullInt64
+	err = tx.QueryRow("SELECT ref_id FROM users WHERE id = ?", userID).Scan(&oldRefID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if newRefID != nil {
+		if *newRefID == userID {
+			return fmt.Errorf("user can't refer themselves")
+		}
+
+		// Walk up from the new referrer to make sure the user isn't part of its chain
+		current := int64(*newRefID)
+		for i := 0; i < maxReferrerChainDepth; i++ {
+			var refID sql.NullInt64
+			err := tx.QueryRow("SELECT ref_id FROM users WHERE id = ?", current).Scan(&refID)
+			if err == sql.ErrNoRows {
+				if i == 0 {
+					return fmt.Errorf("referrer not found")
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if !refID.Valid {
+				break
+			}
+			if int(refID.Int64) == userID {
+				return fmt.Errorf("referrer change would create a referral cycle")
+			}
+			current = refID.Int64
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE users SET ref_id = ? WHERE id = ?", newRefID, userID); err != nil {
+		return err
+	}
+
+	var oldRef interface{}
+	if oldRefID.Valid {
+		oldRef = oldRefID.Int64
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO attribution_history (user_id, old_ref_id, new_ref_id, reason, changed_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, oldRef, newRefID, reason, changedBy, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAttributionHistory returns all referrer changes of a user, oldest first
+func (d *Database) GetAttributionHistory(userID int) ([]model.AttributionChange, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, old_ref_id, new_ref_id, reason, changed_by, created_at
+		FROM attribution_history
+		WHERE user_id = ?
+		ORDER BY created_at ASC, id ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]model.AttributionChange, 0)
+	for rows.Next() {
+		var change model.AttributionChange
+		var oldRefID, newRefID sql.NullInt64
+		if err := rows.Scan(&change.ID, &change.UserID, &oldRefID, &newRefID, &change.Reason, &change.ChangedBy, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		if oldRefID.Valid {
+			v := int(oldRefID.Int64)
+			change.OldRefID = &v
+		}
+		if newRefID.Valid {
+			v := int(newRefID.Int64)
+			change.NewRefID = &v
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,19 @@
+package database
+
+import "time"
+
+// SetBotReferral remembers the referrer of a Telegram user who opened the bot with a
+// referral link, until they register. The first referral link opened is kept.
+func (d *Database) SetBotReferral(telegramID, refID int) error {
+	_, err := d.db.Exec("INSERT OR IGNORE INTO bot_referrals (telegram_id, ref_id, created_at) VALUES (?, ?, ?)",
+		telegramID, refID, time.Now().Unix())
+	return err
+}
+
+// GetBotReferral returns the referrer remembered for a Telegram user, sql.ErrNoRows
+// without one
+func (d *Database) GetBotReferral(telegramID int) (int, error) {
+	var refID int
+	err := d.db.QueryRow("SELECT ref_id FROM bot_referrals WHERE telegram_id = ?", telegramID).Scan(&refID)
+	return refID, err
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+)
+
+// GetIndexerCursor returns the last ingested transaction of a wallet, or a zero cursor
+func (d *Database) GetIndexerCursor(wallet string) (*model.IndexerCursor, error) {
+	cursor := model.IndexerCursor{Wallet: wallet}
+	err := d.db.QueryRow("SELECT last_lt, last_hash, updated_at FROM indexer_cursors WHERE wallet = ?", wallet).
+		Scan(&cursor.LastLT, &cursor.LastHash, &cursor.UpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// SaveChainTransactions stores ingested transactions (oldest first) and moves
+// the wallet cursor to the last one in the same transaction
+func (d *Database) SaveChainTransactions(wallet string, txs []model.ChainTransaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO chain_transactions (
+			wallet, lt, hash, utime, in_source, in_amount, in_comment, bounced,
+			out_destination, out_amount, out_comment, fee
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range txs {
+		_, err := stmt.Exec(wallet, t.LT, t.Hash, t.Utime, t.InSource, t.InAmount, t.InComment, t.Bounced,
+			t.OutDestination, t.OutAmount, t.OutComment, t.Fee)
+		if err != nil {
+			return err
+		}
+	}
+
+	last := txs[len(txs)-1]
+	_, err = tx.Exec(`
+		INSERT INTO indexer_cursors (wallet, last_lt, last_hash, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(wallet) DO UPDATE SET last_lt = excluded.last_lt, last_hash = excluded.last_hash, updated_at = excluded.updated_at`,
+		wallet, last.LT, last.Hash, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetIndexerCursors returns the cursors of all indexed wallets
+func (d *Database) GetIndexerCursors() ([]model.IndexerCursor, error) {
+	rows, err := d.db.Query("SELECT wallet, last_lt, last_hash, updated_at FROM indexer_cursors ORDER BY wallet")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cursors := make([]model.IndexerCursor, 0)
+	for rows.Next() {
+		var c model.IndexerCursor
+		if err := rows.Scan(&c.Wallet, &c.LastLT, &c.LastHash, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, c)
+	}
+	return cursors, rows.Err()
+}
+
+// FindIndexedDeposits returns the non-bounced incoming transfers with the given comment
+// received after since, oldest first
+func (d *Database) FindIndexedDeposits(wallet string, memo string, since int64) ([]model.ChainTransaction, error) {
+	rows, err := d.db.Query(`
+		SELECT id, wallet, lt, hash, utime, in_source, in_amount, in_comment, bounced,
+			out_destination, out_amount, out_comment, fee
+		FROM chain_transactions
+		WHERE wallet = ? AND in_comment = ? AND bounced = 0 AND utime >= ? AND in_amount > 0
+		ORDER BY lt ASC`,
+		wallet, memo, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []model.ChainTransaction
+	for rows.Next() {
+		var t model.ChainTransaction
+		if err := rows.Scan(&t.ID, &t.Wallet, &t.LT, &t.Hash, &t.Utime, &t.InSource, &t.InAmount, &t.InComment, &t.Bounced,
+			&t.OutDestination, &t.OutAmount, &t.OutComment, &t.Fee); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+	}
+	return txs, rows.Err()
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreateSignatureChallenge stores a challenge to be signed by the user's wallet
+func (d *Database) CreateSignatureChallenge(ch *model.SignatureChallenge) error {
+	_, err := d.db.Exec(`
+		INSERT INTO signature_challenges (nonce, user_id, purpose, message, expires_at, used, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?)`,
+		ch.Nonce, ch.UserID, ch.Purpose, ch.Message, ch.ExpiresAt, time.Now().Unix())
+	return err
+}
+
+// ConsumeSignatureChallenge atomically marks an unexpired challenge as used and returns it.
+// Each challenge can be consumed only once.
+func (d *Database) ConsumeSignatureChallenge(nonce string, userID int, purpose string) (*model.SignatureChallenge, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ch model.SignatureChallenge
+	err = tx.QueryRow(`
+		SELECT nonce, user_id, purpose, message, expires_at
+		FROM signature_challenges
+		WHERE nonce = ? AND user_id = ? AND purpose = ? AND used = 0`,
+		nonce, userID, purpose).Scan(&ch.Nonce, &ch.UserID, &ch.Purpose, &ch.Message, &ch.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("challenge not found or already used")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().Unix() > ch.ExpiresAt {
+		return nil, fmt.Errorf("challenge expired")
+	}
+
+	if _, err := tx.Exec("UPDATE signature_challenges SET used = 1 WHERE nonce = ?", nonce); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &ch, nil
+}
+
+// CreateTonProofPayload stores a payload handed out for TON Connect sign-in
+func (d *Database) CreateTonProofPayload(p *model.TonProofPayload) error {
+	_, err := d.db.Exec(`
+		INSERT INTO ton_proof_payloads (payload, expires_at, used, created_at)
+		VALUES (?, ?, 0, ?)`,
+		p.Payload, p.ExpiresAt, time.Now().Unix())
+	return err
+}
+
+// ConsumeTonProofPayload marks an unexpired payload as used. Each payload can be consumed only once.
+func (d *Database) ConsumeTonProofPayload(payload string) error {
+	result, err := d.db.Exec(`
+		UPDATE ton_proof_payloads SET used = 1
+		WHERE payload = ? AND used = 0 AND expires_at >= ?`,
+		payload, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return fmt.Errorf("payload not found, expired or already used")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// walletHash identifies a closed wallet without keeping its public key
+func walletHash(pubKey string) string {
+	sum := sha256.Sum256([]byte(pubKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsWalletClosed reports whether an account registered with this wallet was closed before
+func (d *Database) IsWalletClosed(pubKey string) (bool, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM closed_wallets WHERE pub_key_hash = ?", walletHash(pubKey)).Scan(&count)
+	return count > 0, err
+}
+
+// CloseAccount marks an account closed. With payOut its balance is paid out to the
+// user's wallet: an account closed before may be paid out too, and it is anonymized by
+// anonymizeClosedAccount once the payout left. Otherwise the balance is kept for the user
+// to withdraw. The account must have no open investments left.
+func (d *Database) CloseAccount(userID int, payOut bool) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var open int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM investments WHERE user_id = ?", userID).Scan(&open); err != nil {
+		return 0, err
+	}
+	if open > 0 {
+		return 0, fmt.Errorf("account still has open investments")
+	}
+
+	var closedAt sql.NullInt64
+	if err := tx.QueryRow("SELECT closed_at FROM users WHERE id = ?", userID).Scan(&closedAt); err != nil {
+		return 0, err
+	}
+
+	if closedAt.Valid && !payOut {
+		return 0, fmt.Errorf("account is already closed")
+	}
+
+	now := time.Now().Unix()
+	if !closedAt.Valid {
+		closedAt.Int64 = now
+		description := "Account closed by user, the balance is kept for withdrawal"
+		if payOut {
+			description = "Account closed by user, the balance is paid out"
+		}
+		err = insertOperation(tx, &model.Operation{
+			UserID:      userID,
+			Type:        model.OperationTypeAccountClosed,
+			Amount:      0,
+			Description: description,
+			CreatedAt:   now,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE users SET closed_at = ? WHERE id = ?", now, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	if payOut {
+		if _, err := tx.Exec("UPDATE users SET anonymize_requested_at = ? WHERE id = ?", now, userID); err != nil {
+			return 0, err
+		}
+		if err := anonymizeClosedAccount(tx, userID, now); err != nil {
+			return 0, err
+		}
+	}
+
+	return closedAt.Int64, tx.Commit()
+}
+
+// anonymizeClosedAccount anonymizes an account closed with CloseAccount once nothing is
+// left to pay out: no balance of a nanoton or more and no open withdrawal. The wallet is
+// remembered so it can't sign up for bonuses again.
+func anonymizeClosedAccount(tx *sql.Tx, userID int, now int64) error {
+	var pubKey string
+	var balance float64
+	var requestedAt sql.NullInt64
+	err := tx.QueryRow("SELECT pub_key, balance, anonymize_requested_at FROM users WHERE id = ?", userID).
+		Scan(&pubKey, &balance, &requestedAt)
+	if err != nil {
+		return err
+	}
+	if !requestedAt.Valid || money.FloorPayout(balance) > 0 {
+		return nil
+	}
+
+	var open int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM withdrawal_queue WHERE user_id = ? AND status IN (?, ?, ?, ?))
+			+ (SELECT COUNT(*) FROM withdrawal_requests WHERE user_id = ? AND status IN (?, ?))`,
+		userID, model.QueueStatusQueued, model.QueueStatusSending, model.QueueStatusBatched, model.QueueStatusProcessing,
+		userID, model.WithdrawalStatusPendingApproval, model.WithdrawalStatusSending).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+
+	// The placeholder keeps pub_key unique and frees the wallet for a new registration
+	_, err = tx.Exec(`
+		UPDATE users
+		SET pub_key = ?, name = NULL, photo = NULL, fiat_currency = NULL, number_format = NULL, language = NULL, anonymize_requested_at = NULL
+		WHERE id = ?`,
+		fmt.Sprintf("closed_%d", userID), userID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO closed_wallets (pub_key_hash, user_id, closed_at) VALUES (?, ?, ?)",
+		walletHash(pubKey), userID, now)
+	return err
+}
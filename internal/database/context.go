@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// conn runs the queries of a Database under its context, so queries made while serving
+// a request are traced as part of it. database/sql passes the context of a transaction
+// only to BeginTx; the driver wrapper hands it on to the statements of the transaction.
+type conn struct {
+	*sql.DB
+	ctx context.Context
+}
+
+func (c conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.ExecContext(c.ctx, query, args...)
+}
+
+func (c conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.QueryContext(c.ctx, query, args...)
+}
+
+func (c conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c conn) Prepare(query string) (*sql.Stmt, error) {
+	return c.DB.PrepareContext(c.ctx, query)
+}
+
+func (c conn) Begin() (*sql.Tx, error) {
+	return c.DB.BeginTx(c.ctx, nil)
+}
+
+// WithContext returns the database running its queries under ctx, e.g. the context of
+// the request they serve. It shares the connection pool and everything else with d.
+func (d *Database) WithContext(ctx context.Context) *Database {
+	bound := *d
+	bound.db = conn{DB: d.db.DB, ctx: ctx}
+	return &bound
+}
@@ -1,34 +1,52 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"math/rand"
-	"net/http"
+	"strings"
 	"time"
 	"tonapp/internal/model"
-
-	_ "github.com/mattn/go-sqlite3"
+	"tonapp/internal/money"
+	"tonapp/internal/pagination"
+	"tonapp/internal/rates"
 )
 
 const (
 	// Transaction statuses
-	StatusPending   = "pending"
-	StatusCompleted = "completed"
-	StatusFailed    = "failed"
+	StatusPending    = "pending"
+	StatusProcessing = "processing" // deposit claimed by a confirmation in progress
+	StatusReview     = "review"     // deposit the archive lookup couldn't find, escalated to an admin
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusExpired    = "expired"   // deposit left unpaid for deposit.expire_after_minutes
+	StatusCancelled  = "cancelled" // deposit the user cancelled before paying it
 )
 
 // Database represents a connection to the SQLite database
 type Database struct {
-	db *sql.DB
+	db       conn
+	queryLog *queryLog
+	rates    *rates.Service
 }
 
-// New creates a new Database instance and initializes the schema
-func New(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening database: %v", err)
+// New creates a new Database instance and initializes the schema.
+// Queries are timed and logged when queryLogConfig is enabled.
+// The SQLite driver is chosen at build time, see DriverName.
+func New(dbPath string, queryLogConfig QueryLogConfig) (*Database, error) {
+	var db *sql.DB
+	var ql *queryLog
+	if queryLogConfig.Enabled() {
+		ql = newQueryLog(queryLogConfig)
+		db = sql.OpenDB(&loggedConnector{dsn: driverDSN(dbPath), driver: newDriver(), log: ql})
+	} else {
+		var err error
+		db, err = sql.Open(driverName, driverDSN(dbPath))
+		if err != nil {
+			return nil, fmt.Errorf("error opening database: %v", err)
+		}
 	}
 
 	if err := db.Ping(); err != nil {
@@ -39,7 +57,29 @@ func New(dbPath string) (*Database, error) {
 		return nil, fmt.Errorf("error creating tables: %v", err)
 	}
 
-	return &Database{db: db}, nil
+	if err := migrateTables(db); err != nil {
+		return nil, fmt.Errorf("error migrating tables: %v", err)
+	}
+
+	if err := openLedger(db); err != nil {
+		return nil, fmt.Errorf("error opening ledger: %v", err)
+	}
+
+	if err := backfillClosedInvestments(db); err != nil {
+		return nil, fmt.Errorf("error backfilling closed investments: %v", err)
+	}
+
+	if err := backfillAccountNumbers(db); err != nil {
+		return nil, fmt.Errorf("error backfilling account numbers: %v", err)
+	}
+
+	return &Database{db: conn{DB: db, ctx: context.Background()}, queryLog: ql, rates: rates.NewService(model.RatesConfig{})}, nil
+}
+
+// SetRateService replaces the TON price source of fiat conversions, the default one
+// asks the public price APIs without API keys
+func (d *Database) SetRateService(service *rates.Service) {
+	d.rates = service
 }
 
 func createTables(db *sql.DB) error {
@@ -54,6 +94,11 @@ func createTables(db *sql.DB) error {
 			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now')),
 			FOREIGN KEY (ref_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS account_numbers (
+			number INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER UNIQUE NOT NULL,
+			assigned_at INTEGER NOT NULL
+		)`,
 		`CREATE TABLE IF NOT EXISTS investments (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			user_id INTEGER NOT NULL,
@@ -69,6 +114,10 @@ func createTables(db *sql.DB) error {
 			amount REAL NOT NULL,
 			level INTEGER NOT NULL DEFAULT 1,
 			created_at INTEGER NOT NULL,
+			period_end INTEGER NOT NULL DEFAULT 0,
+			correction_id INTEGER,
+			reversal_of INTEGER,
+			reason TEXT NOT NULL DEFAULT '',
 			FOREIGN KEY (referrer_id) REFERENCES users(id),
 			FOREIGN KEY (referred_id) REFERENCES users(id)
 		)`,
@@ -79,6 +128,19 @@ func createTables(db *sql.DB) error {
 			status TEXT NOT NULL DEFAULT 'pending',
 			memo TEXT NOT NULL,
 			created_at INTEGER NOT NULL,
+			treasury_wallet TEXT NOT NULL DEFAULT '',
+			deposit_address TEXT NOT NULL DEFAULT '',
+			requested_amount REAL,
+			tx_hash TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS deposit_addresses (
+			user_id INTEGER PRIMARY KEY,
+			subwallet_id INTEGER NOT NULL UNIQUE,
+			created_at INTEGER NOT NULL,
+			used_at INTEGER NOT NULL,
+			swept_at INTEGER,
+			swept REAL NOT NULL DEFAULT 0,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 		`CREATE TABLE IF NOT EXISTS withdrawal_requests (
@@ -87,6 +149,12 @@ func createTables(db *sql.DB) error {
 			amount REAL NOT NULL,
 			status TEXT NOT NULL DEFAULT 'pending',
 			created_at INTEGER NOT NULL,
+			treasury_wallet TEXT NOT NULL DEFAULT '',
+			tx_hash TEXT,
+			reason TEXT NOT NULL DEFAULT '',
+			reviewed_at INTEGER,
+			destination TEXT NOT NULL DEFAULT '',
+			queue_id INTEGER NOT NULL DEFAULT 0,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
 		`CREATE TABLE IF NOT EXISTS operations (
@@ -99,6 +167,25 @@ func createTables(db *sql.DB) error {
 			extra TEXT,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		// History pages and date ranges, with or without a type; amount filters are
+		// checked on the rows of the user these select
+		`CREATE INDEX IF NOT EXISTS idx_operations_user_created ON operations(user_id, created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_operations_user_type ON operations(user_id, type, created_at, id)`,
+		`CREATE TABLE IF NOT EXISTS operation_annotations (
+			operation_id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL,
+			FOREIGN KEY (operation_id) REFERENCES operations(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS operation_tags (
+			operation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (operation_id, tag),
+			FOREIGN KEY (operation_id) REFERENCES operations(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_operation_tags_user_tag ON operation_tags(user_id, tag)`,
 		`CREATE TABLE IF NOT EXISTS withdrawals (
 			id INTEGER PRIMARY KEY,
 			user_id INTEGER NOT NULL,
@@ -108,6 +195,336 @@ func createTables(db *sql.DB) error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS attribution_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			old_ref_id INTEGER,
+			new_ref_id INTEGER,
+			reason TEXT NOT NULL,
+			changed_by TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS signature_challenges (
+			nonce TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			purpose TEXT NOT NULL,
+			message TEXT NOT NULL,
+			expires_at INTEGER NOT NULL,
+			used INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS ton_proof_payloads (
+			payload TEXT PRIMARY KEY,
+			expires_at INTEGER NOT NULL,
+			used INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			created_at INTEGER NOT NULL,
+			last_used_at INTEGER,
+			revoked_at INTEGER,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS withdrawal_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			amount REAL NOT NULL,
+			status TEXT NOT NULL,
+			tx_hash TEXT,
+			error TEXT,
+			created_at INTEGER NOT NULL,
+			processed_at INTEGER,
+			treasury_wallet TEXT NOT NULL DEFAULT '',
+			destination TEXT NOT NULL DEFAULT '',
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_attempt_at INTEGER,
+			next_attempt_at INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS terms_acceptances (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			version TEXT NOT NULL,
+			accepted_at INTEGER NOT NULL,
+			ip TEXT NOT NULL DEFAULT '',
+			UNIQUE(user_id, type, version),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS risk_acknowledgments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token TEXT NOT NULL UNIQUE,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			weekly_percent REAL NOT NULL,
+			version TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			acknowledged_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL,
+			used_at INTEGER,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_risk_acknowledgments_user ON risk_acknowledgments(user_id, type)`,
+		`CREATE TABLE IF NOT EXISTS closed_wallets (
+			pub_key_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			closed_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			title TEXT NOT NULL,
+			body TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			read_at INTEGER,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_deposit_requests_status ON deposit_requests(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_referral_earnings_referred ON referral_earnings(referred_id)`,
+		`CREATE TABLE IF NOT EXISTS dormancy_notices (
+			user_id INTEGER NOT NULL,
+			rule TEXT NOT NULL,
+			notified_at INTEGER NOT NULL,
+			executed_at INTEGER,
+			PRIMARY KEY (user_id, rule),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS chain_transactions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			wallet TEXT NOT NULL,
+			lt INTEGER NOT NULL,
+			hash TEXT NOT NULL,
+			utime INTEGER NOT NULL,
+			in_source TEXT NOT NULL DEFAULT '',
+			in_amount REAL NOT NULL DEFAULT 0,
+			in_comment TEXT NOT NULL DEFAULT '',
+			bounced INTEGER NOT NULL DEFAULT 0,
+			out_destination TEXT NOT NULL DEFAULT '',
+			out_amount REAL NOT NULL DEFAULT 0,
+			out_comment TEXT NOT NULL DEFAULT '',
+			fee REAL NOT NULL DEFAULT 0,
+			UNIQUE(wallet, lt)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_chain_transactions_comment ON chain_transactions(wallet, in_comment)`,
+		`CREATE TABLE IF NOT EXISTS chain_investigations (
+			tx_id INTEGER PRIMARY KEY,
+			status TEXT NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL,
+			FOREIGN KEY (tx_id) REFERENCES chain_transactions(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS indexer_cursors (
+			wallet TEXT PRIMARY KEY,
+			last_lt INTEGER NOT NULL,
+			last_hash TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS payments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			amount REAL NOT NULL,
+			provider_amount INTEGER NOT NULL DEFAULT 0,
+			currency TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL DEFAULT 'pending',
+			external_id TEXT,
+			error TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			completed_at INTEGER,
+			UNIQUE(provider, external_id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS gifts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT UNIQUE NOT NULL,
+			sender_id INTEGER NOT NULL,
+			recipient_id INTEGER,
+			amount REAL NOT NULL,
+			type TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL,
+			claimed_at INTEGER,
+			FOREIGN KEY (sender_id) REFERENCES users(id),
+			FOREIGN KEY (recipient_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS investment_pauses (
+			scope TEXT PRIMARY KEY,
+			pause_investments INTEGER NOT NULL DEFAULT 0,
+			pause_accrual INTEGER NOT NULL DEFAULT 0,
+			reason TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS balance_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			snapshot_date TEXT NOT NULL,
+			balance REAL NOT NULL,
+			invested REAL NOT NULL DEFAULT 0,
+			total_earnings REAL NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			UNIQUE (user_id, snapshot_date),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS ledger_transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			reference TEXT NOT NULL DEFAULT '',
+			amount REAL NOT NULL,
+			created_at INTEGER NOT NULL,
+			wallet TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS ledger_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			transfer_id INTEGER NOT NULL,
+			account TEXT NOT NULL,
+			user_id INTEGER,
+			debit REAL NOT NULL DEFAULT 0,
+			credit REAL NOT NULL DEFAULT 0,
+			FOREIGN KEY (transfer_id) REFERENCES ledger_transfers(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries(account, user_id)`,
+		`CREATE TABLE IF NOT EXISTS closed_investments (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			amount REAL NOT NULL,
+			created_at INTEGER NOT NULL,
+			closed_at INTEGER NOT NULL,
+			closed_by TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_closed_investments_user ON closed_investments(user_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS referral_recomputations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			period_from INTEGER NOT NULL,
+			period_to INTEGER NOT NULL,
+			level1_percent REAL NOT NULL,
+			level2_percent REAL NOT NULL,
+			level3_percent REAL NOT NULL,
+			compensated REAL NOT NULL,
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS experiment_exposures (
+			experiment TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			variant TEXT NOT NULL,
+			first_exposed_at INTEGER NOT NULL,
+			last_exposed_at INTEGER NOT NULL,
+			exposures INTEGER NOT NULL DEFAULT 1,
+			PRIMARY KEY (experiment, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS address_book (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			label TEXT NOT NULL,
+			address TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_address_book_user ON address_book(user_id)`,
+		`CREATE TABLE IF NOT EXISTS partners (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			contact TEXT NOT NULL,
+			use_case TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			tier TEXT NOT NULL DEFAULT '',
+			token_prefix TEXT NOT NULL DEFAULT '',
+			token_hash TEXT UNIQUE,
+			created_at INTEGER NOT NULL,
+			reviewed_at INTEGER,
+			last_used_at INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS access_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at INTEGER NOT NULL,
+			request_id TEXT NOT NULL DEFAULT '',
+			method TEXT NOT NULL,
+			route TEXT NOT NULL,
+			path TEXT NOT NULL,
+			status INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			user_id INTEGER,
+			pub_key TEXT NOT NULL DEFAULT '',
+			admin BOOLEAN NOT NULL DEFAULT 0,
+			client_ip TEXT NOT NULL,
+			user_agent TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_access_logs_user ON access_logs(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_access_logs_created ON access_logs(created_at)`,
+		`CREATE TABLE IF NOT EXISTS write_probe (
+			id INTEGER PRIMARY KEY,
+			checked_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			scope TEXT NOT NULL,
+			idempotency_key TEXT NOT NULL,
+			route TEXT NOT NULL,
+			request_hash TEXT NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			body BLOB,
+			created_at INTEGER NOT NULL,
+			PRIMARY KEY (scope, idempotency_key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created ON idempotency_keys(created_at)`,
+		`CREATE TABLE IF NOT EXISTS user_tiers (
+			user_id INTEGER PRIMARY KEY,
+			tier TEXT NOT NULL,
+			invested REAL NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS bot_referrals (
+			telegram_id INTEGER PRIMARY KEY,
+			ref_id INTEGER NOT NULL,
+			created_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_verifications (
+			user_id INTEGER PRIMARY KEY,
+			verified BOOLEAN NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS telegram_chats (
+			user_id INTEGER PRIMARY KEY,
+			chat_id INTEGER NOT NULL,
+			bound_at INTEGER NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS notification_opt_outs (
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			PRIMARY KEY (user_id, kind)
+		)`,
+		`CREATE TABLE IF NOT EXISTS admin_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT UNIQUE NOT NULL,
+			created_by TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			last_used_at INTEGER,
+			revoked_at INTEGER
+		)`,
+		`CREATE TABLE IF NOT EXISTS withdrawal_limit_overrides (
+			user_id INTEGER PRIMARY KEY,
+			min_amount REAL,
+			max_amount REAL,
+			daily_amount REAL,
+			note TEXT NOT NULL DEFAULT '',
+			updated_at INTEGER NOT NULL
+		)`,
 	}
 
 	for _, query := range queries {
@@ -119,6 +536,63 @@ func createTables(db *sql.DB) error {
 	return nil
 }
 
+// migrateTables adds columns introduced after the initial schema.
+// SQLite has no "ADD COLUMN IF NOT EXISTS", so duplicate column errors are ignored.
+func migrateTables(db *sql.DB) error {
+	queries := []string{
+		`ALTER TABLE investments ADD COLUMN last_accrued_at INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN fiat_currency TEXT`,
+		`ALTER TABLE users ADD COLUMN number_format TEXT`,
+		`ALTER TABLE users ADD COLUMN language TEXT`,
+		`ALTER TABLE users ADD COLUMN last_active_at INTEGER`,
+		`ALTER TABLE users ADD COLUMN closed_at INTEGER`,
+		// Deposit and withdrawal requests used to store created_at as a timestamp string
+		`UPDATE deposit_requests SET created_at = CAST(strftime('%s', created_at) AS INTEGER) WHERE typeof(created_at) = 'text'`,
+		`UPDATE withdrawal_requests SET created_at = CAST(strftime('%s', created_at) AS INTEGER) WHERE typeof(created_at) = 'text'`,
+		`ALTER TABLE deposit_requests ADD COLUMN funded_at INTEGER`,
+		`ALTER TABLE deposit_requests ADD COLUMN reminded_at INTEGER`,
+		`ALTER TABLE deposit_requests ADD COLUMN treasury_wallet TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE deposit_requests ADD COLUMN deposit_address TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE withdrawal_queue ADD COLUMN treasury_wallet TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE ledger_transfers ADD COLUMN wallet TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE referral_earnings ADD COLUMN period_end INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE referral_earnings ADD COLUMN correction_id INTEGER`,
+		`ALTER TABLE withdrawal_requests ADD COLUMN treasury_wallet TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE withdrawal_requests ADD COLUMN tx_hash TEXT`,
+		`ALTER TABLE withdrawal_requests ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE withdrawal_requests ADD COLUMN reviewed_at INTEGER`,
+		`ALTER TABLE withdrawal_queue ADD COLUMN destination TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE withdrawal_requests ADD COLUMN destination TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE deposit_requests ADD COLUMN claimed_at INTEGER`,
+		`ALTER TABLE referral_earnings ADD COLUMN reversal_of INTEGER`,
+		`ALTER TABLE referral_earnings ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE notifications ADD COLUMN dispatched_at INTEGER`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_undispatched ON notifications(id) WHERE dispatched_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_users_closed ON users(closed_at) WHERE closed_at IS NOT NULL`,
+		`ALTER TABLE users ADD COLUMN frozen_at INTEGER`,
+		`ALTER TABLE users ADD COLUMN frozen_reason TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_users_frozen ON users(frozen_at) WHERE frozen_at IS NOT NULL`,
+		`ALTER TABLE access_logs ADD COLUMN admin_key TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE withdrawal_queue ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE withdrawal_queue ADD COLUMN last_attempt_at INTEGER`,
+		`ALTER TABLE withdrawal_queue ADD COLUMN next_attempt_at INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE deposit_requests ADD COLUMN requested_amount REAL`,
+		`ALTER TABLE deposit_requests ADD COLUMN tx_hash TEXT NOT NULL DEFAULT ''`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_deposit_requests_tx_hash ON deposit_requests(tx_hash) WHERE tx_hash != ''`,
+		`ALTER TABLE payments ADD COLUMN error TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE withdrawal_requests ADD COLUMN queue_id INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN anonymize_requested_at INTEGER`,
+	}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return fmt.Errorf("error executing query: %v\nQuery: %s", err, query)
+		}
+	}
+
+	return nil
+}
+
 func (d *Database) Close() error {
 	return d.db.Close()
 }
@@ -127,16 +601,34 @@ func (d *Database) Close() error {
 // If customID is provided, it will be used as the user's ID.
 // If customID is nil, a random ID between 1000000000 and 1000000000000 will be generated.
 // If refID is provided, it will be used to establish a referral relationship.
-func (d *Database) CreateUser(pubKey string, refID *int, customID *int, name *string, photo *string) (*model.User, error) {
+// If a user with the public key already exists, it is returned unchanged with created set to false.
+func (d *Database) CreateUser(pubKey string, refID *int, customID *int, name *string, photo *string) (user *model.User, created bool, err error) {
 	// Check if user already exists
 	existingUser, err := d.GetUserByPubKey(pubKey)
 	if err != sql.ErrNoRows && err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	if existingUser != nil {
-		return existingUser, nil
+		return existingUser, false, nil
 	}
 
+	user, err = d.insertUser(pubKey, refID, customID, name, photo)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: users.pub_key") {
+		// Concurrent registration of the same key won the race
+		existingUser, err := d.GetUserByPubKey(pubKey)
+		if err != nil {
+			return nil, false, err
+		}
+		return existingUser, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, true, nil
+}
+
+func (d *Database) insertUser(pubKey string, refID *int, customID *int, name *string, photo *string) (*model.User, error) {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return nil, err
@@ -158,11 +650,26 @@ func (d *Database) CreateUser(pubKey string, refID *int, customID *int, name *st
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id, pubKey, 0, refID, name, photo, time.Now().Unix())
+	now := time.Now().Unix()
+	_, err = stmt.Exec(id, pubKey, 0, refID, name, photo, now)
 	if err != nil {
 		return nil, err
 	}
 
+	if _, err := tx.Exec("INSERT INTO account_numbers (user_id, assigned_at) VALUES (?, ?)", id, now); err != nil {
+		return nil, err
+	}
+
+	if refID != nil {
+		_, err = tx.Exec(`
+			INSERT INTO attribution_history (user_id, old_ref_id, new_ref_id, reason, changed_by, created_at)
+			VALUES (?, NULL, ?, ?, ?, ?)`,
+			id, *refID, "registration", model.AttributionByRegistration, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -175,14 +682,16 @@ func (d *Database) GetUserByPubKey(pubKey string) (*model.User, error) {
 	var user model.User
 	var refID sql.NullInt64
 	var name, photo sql.NullString
+	var fiatCurrency, numberFormat, language sql.NullString
+	var closedAt, frozenAt sql.NullInt64
 
-	stmt, err := d.db.Prepare("SELECT id, pub_key, balance, ref_id, name, photo, created_at FROM users WHERE pub_key = ?")
+	stmt, err := d.db.Prepare("SELECT id, pub_key, balance, ref_id, name, photo, created_at, fiat_currency, number_format, language, closed_at, frozen_at FROM users WHERE pub_key = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(pubKey).Scan(&user.ID, &user.PubKey, &user.Balance, &refID, &name, &photo, &user.CreatedAt)
+	err = stmt.QueryRow(pubKey).Scan(&user.ID, &user.PubKey, &user.Balance, &refID, &name, &photo, &user.CreatedAt, &fiatCurrency, &numberFormat, &language, &closedAt, &frozenAt)
 
 	if err == sql.ErrNoRows {
 		return nil, err
@@ -204,6 +713,19 @@ func (d *Database) GetUserByPubKey(pubKey string) (*model.User, error) {
 		user.Photo = &photo.String
 	}
 
+	user.Preferences = preferencesOrDefault(fiatCurrency, numberFormat, language)
+	if closedAt.Valid {
+		user.ClosedAt = &closedAt.Int64
+	}
+	if frozenAt.Valid {
+		user.FrozenAt = &frozenAt.Int64
+	}
+
+	user.AccountNumber, err = d.accountNumber(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	investments, err := d.getUserInvestments(user.ID)
 	if err != nil {
 		return nil, err
@@ -239,14 +761,16 @@ func (d *Database) GetUser(id int) (*model.User, error) {
 	var user model.User
 	var refID sql.NullInt64
 	var name, photo sql.NullString
+	var fiatCurrency, numberFormat, language sql.NullString
+	var closedAt, frozenAt sql.NullInt64
 
-	stmt, err := d.db.Prepare("SELECT id, pub_key, balance, ref_id, name, photo, created_at FROM users WHERE id = ?")
+	stmt, err := d.db.Prepare("SELECT id, pub_key, balance, ref_id, name, photo, created_at, fiat_currency, number_format, language, closed_at, frozen_at FROM users WHERE id = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(id).Scan(&user.ID, &user.PubKey, &user.Balance, &refID, &name, &photo, &user.CreatedAt)
+	err = stmt.QueryRow(id).Scan(&user.ID, &user.PubKey, &user.Balance, &refID, &name, &photo, &user.CreatedAt, &fiatCurrency, &numberFormat, &language, &closedAt, &frozenAt)
 
 	if err == sql.ErrNoRows {
 		return nil, err
@@ -268,6 +792,19 @@ func (d *Database) GetUser(id int) (*model.User, error) {
 		user.Photo = &photo.String
 	}
 
+	user.Preferences = preferencesOrDefault(fiatCurrency, numberFormat, language)
+	if closedAt.Valid {
+		user.ClosedAt = &closedAt.Int64
+	}
+	if frozenAt.Valid {
+		user.FrozenAt = &frozenAt.Int64
+	}
+
+	user.AccountNumber, err = d.accountNumber(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	investments, err := d.getUserInvestments(user.ID)
 	if err != nil {
 		return nil, err
@@ -298,6 +835,39 @@ func (d *Database) GetUser(id int) (*model.User, error) {
 	return &user, nil
 }
 
+// GetReferrerChain returns the user's referrer and theirs, up to levels referrers, with
+// when their accounts were closed
+func (d *Database) GetReferrerChain(userID int, levels int) ([]model.Referrer, error) {
+	rows, err := d.db.Query(`
+		WITH RECURSIVE chain(id, level) AS (
+			SELECT ref_id, 1 FROM users WHERE id = ? AND ref_id IS NOT NULL
+			UNION ALL
+			SELECT u.ref_id, chain.level + 1 FROM users u JOIN chain ON u.id = chain.id
+			WHERE u.ref_id IS NOT NULL AND chain.level < ?
+		)
+		SELECT chain.id, u.closed_at FROM chain LEFT JOIN users u ON u.id = chain.id
+		ORDER BY chain.level`,
+		userID, levels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chain []model.Referrer
+	for rows.Next() {
+		var r model.Referrer
+		var closedAt sql.NullInt64
+		if err := rows.Scan(&r.ID, &closedAt); err != nil {
+			return nil, err
+		}
+		if closedAt.Valid {
+			r.ClosedAt = &closedAt.Int64
+		}
+		chain = append(chain, r)
+	}
+	return chain, rows.Err()
+}
+
 func (d *Database) DeleteUser(id int) error {
 	tx, err := d.db.Begin()
 	if err != nil {
@@ -305,7 +875,44 @@ func (d *Database) DeleteUser(id int) error {
 	}
 	defer tx.Rollback()
 
-	// Delete user's investments first
+	// Write off the balance and open investments in the ledger
+	var balance, invested float64
+	err = tx.QueryRow(`
+		SELECT balance, COALESCE((SELECT SUM(amount) FROM investments WHERE user_id = users.id), 0)
+		FROM users WHERE id = ?`, id).Scan(&balance, &invested)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	reference := fmt.Sprintf("user:%d", id)
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindUserDeleted,
+		Reference: reference,
+		From:      userAccount(id),
+		To:        systemAccount(model.LedgerAccountAdjustments),
+		Amount:    balance,
+	})
+	if err != nil {
+		return err
+	}
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindUserDeleted,
+		Reference: reference,
+		From:      systemAccount(model.LedgerAccountInvestments),
+		To:        systemAccount(model.LedgerAccountAdjustments),
+		Amount:    invested,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep the investments for balance history, then delete them
+	_, err = tx.Exec(`
+		INSERT INTO closed_investments (id, user_id, type, amount, created_at, closed_at, closed_by)
+		SELECT id, user_id, type, amount, created_at, ?, ? FROM investments WHERE user_id = ?`,
+		time.Now().Unix(), model.LedgerKindUserDeleted, id)
+	if err != nil {
+		return err
+	}
 	stmt, err := tx.Prepare("DELETE FROM investments WHERE user_id = ?")
 	if err != nil {
 		return err
@@ -348,27 +955,32 @@ func (d *Database) CreateInvestment(userID int, investType string, amount float6
 		return fmt.Errorf("insufficient balance")
 	}
 
-	// Update user balance
-	stmt, err := tx.Prepare("UPDATE users SET balance = balance - ? WHERE id = ?")
+	// Create investment
+	stmt, err := tx.Prepare("INSERT INTO investments (user_id, type, amount, created_at) VALUES (?, ?, ?, ?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(amount, userID)
+	now := time.Now().Unix()
+	result, err := stmt.Exec(userID, investType, amount, now)
 	if err != nil {
 		return err
 	}
-
-	// Create investment
-	stmt, err = tx.Prepare("INSERT INTO investments (user_id, type, amount, created_at) VALUES (?, ?, ?, ?)")
+	investmentID, err := result.LastInsertId()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	now := time.Now().Unix()
-	_, err = stmt.Exec(userID, investType, amount, now)
+	// Move the amount from the user balance into the investment
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindInvestmentCreated,
+		Reference: fmt.Sprintf("investment:%d", investmentID),
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountInvestments),
+		Amount:    amount,
+		CreatedAt: now,
+	})
 	if err != nil {
 		return err
 	}
@@ -417,6 +1029,16 @@ func (d *Database) CreateInvestment(userID int, investType string, amount float6
 }
 
 func (d *Database) DeleteInvestment(userID int, investmentID int64) error {
+	return d.closeInvestment(userID, investmentID, "")
+}
+
+// CloseInvestmentByPolicy closes an investment on behalf of the platform.
+// The closing operation records closedBy so it isn't mistaken for user activity.
+func (d *Database) CloseInvestmentByPolicy(userID int, investmentID int64, closedBy string) error {
+	return d.closeInvestment(userID, investmentID, closedBy)
+}
+
+func (d *Database) closeInvestment(userID int, investmentID int64, closedBy string) error {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return err
@@ -461,20 +1083,33 @@ func (d *Database) DeleteInvestment(userID int, investmentID int64) error {
 		return fmt.Errorf("investment not found")
 	}
 
-	// Return funds to user
-	stmt, err = tx.Prepare("UPDATE users SET balance = balance + ? WHERE id = ?")
+	now := time.Now().Unix()
+	err = archiveClosedInvestment(tx, userID, model.HistoricalInvestment{
+		ID:        investmentID,
+		Type:      investment.Type,
+		Amount:    investment.Amount,
+		CreatedAt: investment.CreatedAt,
+		ClosedAt:  &now,
+		ClosedBy:  closedBy,
+	})
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(investment.Amount, userID)
+	// Return funds to user
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindInvestmentClosed,
+		Reference: fmt.Sprintf("investment:%d", investmentID),
+		From:      systemAccount(model.LedgerAccountInvestments),
+		To:        userAccount(userID),
+		Amount:    investment.Amount,
+		CreatedAt: now,
+	})
 	if err != nil {
 		return err
 	}
 
 	// Add operation
-	now := time.Now().Unix()
 	op := &model.Operation{
 		UserID:      userID,
 		Type:        model.OperationTypeInvestmentClosed,
@@ -488,6 +1123,9 @@ func (d *Database) DeleteInvestment(userID int, investmentID int64) error {
 			"duration_days":      (now - investment.CreatedAt) / 86400, // Convert seconds to days
 		},
 	}
+	if closedBy != "" {
+		op.Extra.(map[string]interface{})["closed_by"] = closedBy
+	}
 
 	stmt, err = tx.Prepare(`
 		INSERT INTO operations (user_id, type, amount, description, created_at, extra)
@@ -518,25 +1156,9 @@ func (d *Database) DeleteInvestment(userID int, investmentID int64) error {
 	return tx.Commit()
 }
 
-// Get USD rate from external API https://api.coingecko.com/api/v3/coins/the-open-network
-func (d *Database) GetUsdRate() float64 {
-	resp, err := http.Get("https://api.coingecko.com/api/v3/coins/the-open-network")
-	if err != nil {
-		return 0
-	}
-	defer resp.Body.Close()
-
-	var data map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return 0
-	}
-
-	rate, ok := data["market_data"].(map[string]interface{})["current_price"].(map[string]interface{})["usd"].(float64)
-	if !ok {
-		return 0
-	}
-
-	return rate
+// GetUsdRate returns the TON price in USD
+func (d *Database) GetUsdRate() (float64, error) {
+	return d.rates.Rate(context.Background(), "usd")
 }
 
 func (d *Database) getUserInvestments(userID int) ([]model.Investment, error) {
@@ -564,24 +1186,6 @@ func (d *Database) getUserInvestments(userID int) ([]model.Investment, error) {
 	return investments, nil
 }
 
-func getDollarRate() float64 {
-	resp, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=the-open-network&vs_currencies=usd")
-	if err != nil {
-		return 0
-	}
-	defer resp.Body.Close()
-
-	var data map[string]map[string]float64
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return 0
-	}
-
-	if rate, ok := data["the-open-network"]["usd"]; ok {
-		return rate
-	}
-	return 0
-}
-
 func (d *Database) GetReferralStats(pubKey string) (*model.ReferralStats, error) {
 	// Get user by public key
 	user, err := d.GetUserByPubKey(pubKey)
@@ -600,9 +1204,9 @@ func (d *Database) GetReferralStats(pubKey string) (*model.ReferralStats, error)
 		return nil, err
 	}
 	//Get Dollar rate
-	dollarRate := getDollarRate()
-	if dollarRate == 0 {
-		return nil, fmt.Errorf("failed to get dollar rate")
+	dollarRate, err := d.GetUsdRate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dollar rate: %v", err)
 	}
 	// Get referrals by level
 	var referralsByLevel []model.ReferralDetail
@@ -660,7 +1264,7 @@ func (d *Database) GetReferralStats(pubKey string) (*model.ReferralStats, error)
 			detail := &model.ReferralDetail{
 				UserID:              ref.UserID,
 				Name:                ref.Name,
-			    Photo:               ref.Photo,
+				Photo:               ref.Photo,
 				Level:               2,
 				TotalInvested:       ref.TotalInvested,
 				TotalInvestedUSD:    ref.TotalInvested * dollarRate,
@@ -686,7 +1290,7 @@ func (d *Database) GetReferralStats(pubKey string) (*model.ReferralStats, error)
 			detail := &model.ReferralDetail{
 				UserID:              ref.UserID,
 				Name:                ref.Name,
-			    Photo:               ref.Photo,
+				Photo:               ref.Photo,
 				Level:               3,
 				TotalInvested:       ref.TotalInvested,
 				TotalInvestedUSD:    ref.TotalInvested * dollarRate,
@@ -708,11 +1312,24 @@ func (d *Database) GetReferralStats(pubKey string) (*model.ReferralStats, error)
 		referralsByLevel = append(referralsByLevel, *detail)
 	}
 
+	// Convert to the user's preferred fiat currency
+	fiatCurrency := user.Preferences.FiatCurrency
+	fiatRate := dollarRate
+	if fiatCurrency != "usd" {
+		fiatRate, err = d.rates.Rate(context.Background(), fiatCurrency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s rate: %v", fiatCurrency, err)
+		}
+	}
+
 	return &model.ReferralStats{
-		TotalReferrals:   len(allReferrals),
-		TotalEarnings:    totalEarnings,
-		TotalEarningsUSD: totalEarnings * dollarRate,
-		ReferralsByLevel: referralsByLevel,
+		TotalReferrals:    len(allReferrals),
+		TotalEarnings:     totalEarnings,
+		TotalEarningsUSD:  totalEarnings * dollarRate,
+		FiatCurrency:      fiatCurrency,
+		FiatRate:          fiatRate,
+		TotalEarningsFiat: totalEarnings * fiatRate,
+		ReferralsByLevel:  referralsByLevel,
 	}, nil
 }
 
@@ -829,53 +1446,102 @@ func (d *Database) getLevelReferrals(userID int, level int) ([]model.Referral, e
 	return refs, nil
 }
 
-func (d *Database) AddReferralEarning(referrerID int, referredID int, amount float64, level int) error {
+// AddReferralEarning records a referral earning on the accrual period ending at periodEnd
+// and credits it to the referrer. The amount is reduced to what the caps leave, the
+// credited amount is returned and nothing is recorded when it is 0.
+func (d *Database) AddReferralEarning(referrerID int, referredID int, amount float64, level int, periodEnd int64, caps model.ReferralCaps) (float64, error) {
 	tx, err := d.db.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
+	now := time.Now().Unix()
+	var earnedToday, earned float64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN created_at >= ? THEN amount ELSE 0 END), 0), COALESCE(SUM(amount), 0)
+		FROM referral_earnings
+		WHERE referrer_id = ?`,
+		time.Unix(now, 0).UTC().Truncate(24*time.Hour).Unix(), referrerID).Scan(&earnedToday, &earned)
+	if err != nil {
+		return 0, err
+	}
+	if remaining, ok := caps.Remaining(earnedToday, earned); ok && remaining < amount {
+		amount = money.FloorPayout(remaining)
+	}
+	if amount <= 0 {
+		return 0, nil
+	}
+
 	// Add referral earning record
-	_, err = tx.Exec(`
-		INSERT INTO referral_earnings (referrer_id, referred_id, amount, level, created_at) 
-		VALUES (?, ?, ?, ?, ?)`,
-		referrerID, referredID, amount, level, time.Now().Unix())
+	result, err := tx.Exec(`
+		INSERT INTO referral_earnings (referrer_id, referred_id, amount, level, created_at, period_end)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		referrerID, referredID, amount, level, now, periodEnd)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	earningID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
 
 	// Update referrer's balance
-	_, err = tx.Exec("UPDATE users SET balance = balance + ? WHERE id = ?",
-		amount, referrerID)
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindReferralEarning,
+		Reference: fmt.Sprintf("referral_earning:%d", earningID),
+		From:      systemAccount(model.LedgerAccountReferrals),
+		To:        userAccount(referrerID),
+		Amount:    amount,
+		CreatedAt: now,
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return amount, nil
 }
 
-// UpdateUserBalance updates the balance of a user by their ID
+// UpdateUserBalance sets the balance of a user by their ID.
+// The difference to the current balance is posted to the ledger as an admin adjustment.
 func (d *Database) UpdateUserBalance(userID int, newBalance float64) error {
-	stmt, err := d.db.Prepare("UPDATE users SET balance = ? WHERE id = ?")
+	tx, err := d.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(newBalance, userID)
-	return err
+	var balance float64
+	if err := tx.QueryRow("SELECT balance FROM users WHERE id = ?", userID).Scan(&balance); err != nil {
+		return err
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:   model.LedgerKindAdjustment,
+		From:   systemAccount(model.LedgerAccountAdjustments),
+		To:     userAccount(userID),
+		Amount: newBalance - balance,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// CreateDepositRequest creates a new deposit request
-func (d *Database) CreateDepositRequest(userID int, amount float64, memo string) (*model.DepositRequest, error) {
-	stmt, err := d.db.Prepare("INSERT INTO deposit_requests (user_id, amount, memo, status, created_at) VALUES (?, ?, ?, ?, ?)")
+// CreateDepositRequest creates a new deposit request paid to the given treasury wallet,
+// empty for the main wallet, or to the user's personal deposit address
+func (d *Database) CreateDepositRequest(userID int, amount float64, memo string, treasuryWallet string, depositAddress string) (*model.DepositRequest, error) {
+	stmt, err := d.db.Prepare("INSERT INTO deposit_requests (user_id, amount, memo, status, created_at, treasury_wallet, deposit_address) VALUES (?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(userID, amount, memo, StatusPending, time.Now())
+	result, err := stmt.Exec(userID, amount, memo, StatusPending, time.Now().Unix(), treasuryWallet, depositAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -891,13 +1557,13 @@ func (d *Database) CreateDepositRequest(userID int, amount float64, memo string)
 // GetDepositRequest gets a deposit request by ID
 func (d *Database) GetDepositRequest(id int) (*model.DepositRequest, error) {
 	var req model.DepositRequest
-	stmt, err := d.db.Prepare("SELECT id, user_id, amount, memo, status, created_at FROM deposit_requests WHERE id = ?")
+	stmt, err := d.db.Prepare("SELECT id, user_id, amount, memo, status, created_at, treasury_wallet, deposit_address, requested_amount, tx_hash FROM deposit_requests WHERE id = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(id).Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt)
+	err = stmt.QueryRow(id).Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt, &req.TreasuryWallet, &req.DepositAddress, &req.RequestedAmount, &req.TxHash)
 	if err != nil {
 		return nil, err
 	}
@@ -906,7 +1572,7 @@ func (d *Database) GetDepositRequest(id int) (*model.DepositRequest, error) {
 
 func (d *Database) GetDepositsOfUser(userID int) ([]model.DepositRequest, error) {
 	var reqs []model.DepositRequest
-	stmt, err := d.db.Prepare("SELECT id, user_id, amount, memo, status, created_at FROM deposit_requests WHERE user_id = ?")
+	stmt, err := d.db.Prepare("SELECT id, user_id, amount, memo, status, created_at, treasury_wallet, deposit_address, requested_amount, tx_hash FROM deposit_requests WHERE user_id = ?")
 	if err != nil {
 		return nil, err
 	}
@@ -920,7 +1586,7 @@ func (d *Database) GetDepositsOfUser(userID int) ([]model.DepositRequest, error)
 
 	for rows.Next() {
 		var req model.DepositRequest
-		if err := rows.Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt); err != nil {
+		if err := rows.Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt, &req.TreasuryWallet, &req.DepositAddress, &req.RequestedAmount, &req.TxHash); err != nil {
 			return nil, err
 		}
 		reqs = append(reqs, req)
@@ -928,48 +1594,380 @@ func (d *Database) GetDepositsOfUser(userID int) ([]model.DepositRequest, error)
 	return reqs, nil
 }
 
-// UpdateDepositStatus updates the status of a deposit request
+// GetPendingDeposits returns the pending deposit requests created after since, oldest first
+func (d *Database) GetPendingDeposits(since int64) ([]model.DepositRequest, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, amount, memo, status, created_at, treasury_wallet, deposit_address
+		FROM deposit_requests WHERE status = ? AND created_at >= ?
+		ORDER BY id`, StatusPending, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reqs []model.DepositRequest
+	for rows.Next() {
+		var req model.DepositRequest
+		if err := rows.Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt, &req.TreasuryWallet, &req.DepositAddress); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+// GetDepositHistory returns a page of a user's deposit requests, newest first
+func (d *Database) GetDepositHistory(userID int, page pagination.Params) (*model.DepositHistory, error) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	// Ids grow with creation time, so the id alone orders the requests
+	if cond, condArgs := page.WhereID("id"); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, user_id, amount, memo, status, created_at, treasury_wallet, deposit_address, requested_amount, tx_hash
+		FROM deposit_requests
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY id DESC
+		LIMIT ?`, append(args, page.FetchLimit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deposits := make([]model.DepositRequest, 0)
+	for rows.Next() {
+		var req model.DepositRequest
+		if err := rows.Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt, &req.TreasuryWallet, &req.DepositAddress, &req.RequestedAmount, &req.TxHash); err != nil {
+			return nil, err
+		}
+		deposits = append(deposits, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	deposits, next := pagination.Trim(deposits, page, func(req model.DepositRequest) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: req.CreatedAt, ID: int64(req.ID)}
+	})
+
+	return &model.DepositHistory{
+		Deposits:   deposits,
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// GetReferralEarningHistory returns a page of the referral earnings of a referrer, newest first
+func (d *Database) GetReferralEarningHistory(referrerID int, page pagination.Params) (*model.ReferralEarningHistory, error) {
+	conditions := []string{"referrer_id = ?"}
+	args := []interface{}{referrerID}
+	if cond, condArgs := page.Where("created_at", "id"); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, referrer_id, referred_id, amount, level, created_at, period_end, correction_id, reversal_of, reason
+		FROM referral_earnings
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?`, append(args, page.FetchLimit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	earnings := make([]model.ReferralEarning, 0)
+	for rows.Next() {
+		e, err := scanReferralEarning(rows)
+		if err != nil {
+			return nil, err
+		}
+		earnings = append(earnings, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	earnings, next := pagination.Trim(earnings, page, func(e model.ReferralEarning) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	return &model.ReferralEarningHistory{
+		Earnings:   earnings,
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// UpdateDepositStatus updates the status of a deposit request.
+// Completing a request records when it was funded.
 func (d *Database) UpdateDepositStatus(id int, status string) error {
-	stmt, err := d.db.Prepare("UPDATE deposit_requests SET status = ? WHERE id = ?")
+	stmt, err := d.db.Prepare(`
+		UPDATE deposit_requests
+		SET status = ?, funded_at = CASE WHEN ? = 'completed' THEN ? ELSE funded_at END
+		WHERE id = ?`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(status, id)
+	_, err = stmt.Exec(status, status, time.Now().Unix(), id)
 	return err
 }
 
-// CreateWithdrawalRequest creates a new withdrawal request
-func (d *Database) CreateWithdrawalRequest(userID int, amount float64) (sql.Result, error) {
-	stmt, err := d.db.Prepare("INSERT INTO withdrawal_requests (user_id, amount, status, created_at) VALUES (?, ?, ?, ?)")
+// ClaimDeposit moves a pending deposit request to processing, so only one confirmation
+// checks the chain and forwards the platform share. Claims taken before staleBefore are
+// taken over, in case their confirmation died. Returns false if the request is not
+// pending or claimed by another confirmation.
+func (d *Database) ClaimDeposit(id int, staleBefore int64) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE deposit_requests SET status = ?, claimed_at = ?
+		WHERE id = ? AND (status = ? OR (status = ? AND claimed_at < ?))`,
+		StatusProcessing, time.Now().Unix(), id, StatusPending, StatusProcessing, staleBefore)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	defer stmt.Close()
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
 
-	result, err := stmt.Exec(userID, amount, StatusPending, time.Now())
+// ReleaseDeposit moves a claimed deposit request back to pending when its transfer
+// hasn't arrived yet, dropping the transaction hash the confirmation set
+func (d *Database) ReleaseDeposit(id int) error {
+	_, err := d.db.Exec("UPDATE deposit_requests SET status = ?, claimed_at = NULL, tx_hash = '' WHERE id = ? AND status = ?",
+		StatusPending, id, StatusProcessing)
+	return err
+}
+
+// SetDepositTxHash records the transaction a claimed deposit request is credited with.
+// Returns false if the transaction was already used for another request.
+func (d *Database) SetDepositTxHash(id int, txHash string) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE deposit_requests SET tx_hash = ?
+		WHERE id = ? AND status = ? AND NOT EXISTS (SELECT 1 FROM deposit_requests WHERE tx_hash = ? AND id != ?)`,
+		txHash, id, StatusProcessing, txHash, id)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return false, nil
+		}
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// ExpireDeposits marks the deposit requests still pending since before createdBefore as
+// expired and returns their IDs. Requests claimed by a confirmation are left to it.
+func (d *Database) ExpireDeposits(createdBefore int64) ([]int, error) {
+	rows, err := d.db.Query("SELECT id FROM deposit_requests WHERE status = ? AND created_at < ? ORDER BY id",
+		StatusPending, createdBefore)
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var expired []int
+	for _, id := range ids {
+		result, err := d.db.Exec("UPDATE deposit_requests SET status = ? WHERE id = ? AND status = ?",
+			StatusExpired, id, StatusPending)
+		if err != nil {
+			return expired, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return expired, err
+		} else if n > 0 {
+			expired = append(expired, id)
+		}
+	}
+	return expired, nil
 }
 
-// ConfirmWithdrawalRequest confirms a withdrawal request
-func (d *Database) ConfirmWithdrawalRequest(id int) (sql.Result, error) {
-	stmt, err := d.db.Prepare("UPDATE withdrawal_requests SET status = ? WHERE id = ?")
+// CancelDeposit marks a pending deposit request as cancelled. Returns false if it isn't
+// pending anymore.
+func (d *Database) CancelDeposit(id int) (bool, error) {
+	result, err := d.db.Exec("UPDATE deposit_requests SET status = ? WHERE id = ? AND status = ?",
+		StatusCancelled, id, StatusPending)
 	if err != nil {
-		return nil, err
+		return false, err
 	}
-	defer stmt.Close()
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// EscalateDeposit moves a claimed deposit request to review, for an admin to find its
+// transfer when the automatic checks couldn't
+func (d *Database) EscalateDeposit(id int) error {
+	result, err := d.db.Exec("UPDATE deposit_requests SET status = ?, claimed_at = NULL WHERE id = ? AND status = ?",
+		StatusReview, id, StatusProcessing)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("deposit request %d is not processing", id)
+	}
+	return nil
+}
 
-	result, err := stmt.Exec(StatusCompleted, id)
+// GetEscalatedDeposits returns the deposit requests waiting for an admin review, oldest first
+func (d *Database) GetEscalatedDeposits() ([]model.DepositRequest, error) {
+	rows, err := d.db.Query("SELECT id, user_id, amount, memo, status, created_at, treasury_wallet, deposit_address FROM deposit_requests WHERE status = ? ORDER BY id",
+		StatusReview)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return result, nil
+	reqs := []model.DepositRequest{}
+	for rows.Next() {
+		var req model.DepositRequest
+		if err := rows.Scan(&req.ID, &req.UserID, &req.Amount, &req.Memo, &req.Status, &req.CreatedAt, &req.TreasuryWallet, &req.DepositAddress); err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, rows.Err()
+}
+
+// ReviewEscalatedDeposit ends the review of a deposit request. A credited request is
+// claimed for CompleteDeposit, a rejected one failed. Returns false if the request isn't
+// under review.
+func (d *Database) ReviewEscalatedDeposit(id int, credit bool) (bool, error) {
+	status := StatusFailed
+	var claimedAt interface{}
+	if credit {
+		status, claimedAt = StatusProcessing, time.Now().Unix()
+	}
+	result, err := d.db.Exec("UPDATE deposit_requests SET status = ?, claimed_at = ? WHERE id = ? AND status = ?",
+		status, claimedAt, id, StatusReview)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CompleteDeposit credits a claimed deposit request with the amount received for it.
+// A request credited with another amount than requested keeps the requested one in
+// requested_amount.
+func (d *Database) CompleteDeposit(deposit model.DepositRequest, received float64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var requested *float64
+	if money.ToNano(received) != money.ToNano(deposit.Amount) {
+		requested = &deposit.Amount
+	}
+
+	now := time.Now().Unix()
+	result, err := tx.Exec("UPDATE deposit_requests SET status = ?, funded_at = ?, amount = ?, requested_amount = ? WHERE id = ? AND status = ?",
+		StatusCompleted, now, received, requested, deposit.ID, StatusProcessing)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("deposit request %d is not processing", deposit.ID)
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindDeposit,
+		Reference: fmt.Sprintf("deposit_request:%d", deposit.ID),
+		From:      systemAccount(model.LedgerAccountExternal),
+		To:        userAccount(deposit.UserID),
+		Amount:    received,
+		Wallet:    deposit.TreasuryWallet,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RecordWithdrawal debits a withdrawal sent from a treasury wallet and records the operation
+func (d *Database) RecordWithdrawal(userID int, amount float64, txHash string, treasuryWallet string, destination string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawal,
+		Reference: txHash,
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountExternal),
+		Amount:    amount,
+		Wallet:    treasuryWallet,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeWithdrawal,
+		Amount:      amount,
+		Description: fmt.Sprintf("Withdrawal of %s TON", money.Format(amount)),
+		CreatedAt:   now,
+		Extra:       withdrawalExtra(txHash, destination),
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withdrawalExtra is the extra of a withdrawal operation, the destination is only set
+// for withdrawals to an address book address
+func withdrawalExtra(txHash string, destination string) map[string]interface{} {
+	extra := map[string]interface{}{
+		"tx_hash": txHash,
+	}
+	if destination != "" {
+		extra["destination"] = destination
+	}
+	return extra
 }
 
 // TODO: Func for getting withdrawal requests by user ID
@@ -1007,7 +2005,7 @@ func (d *Database) GetWithdrawalRequestsByUser(userID int) ([]model.WithdrawalSt
 
 // DB returns the underlying database connection
 func (d *Database) DB() *sql.DB {
-	return d.db
+	return d.db.DB
 }
 
 // AddOperation adds a new operation to the database
@@ -1040,26 +2038,63 @@ func (d *Database) AddOperation(op *model.Operation) error {
 	return err
 }
 
-// GetUserOperations retrieves user operations with pagination
-func (d *Database) GetUserOperations(userID int, page, pageSize int) (*model.OperationHistory, error) {
+// operationConditions returns the WHERE conditions selecting the operations of a user
+// that pass a filter, and their arguments
+func operationConditions(userID int, filter model.OperationFilter) ([]string, []interface{}) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT operation_id FROM operation_tags WHERE user_id = ? AND tag = ?)")
+		args = append(args, userID, filter.Tag)
+	}
+	if filter.From > 0 {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if filter.To > 0 {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To)
+	}
+	if filter.MinAmount > 0 {
+		conditions = append(conditions, "amount >= ?")
+		args = append(args, filter.MinAmount)
+	}
+	if filter.MaxAmount > 0 {
+		conditions = append(conditions, "amount <= ?")
+		args = append(args, filter.MaxAmount)
+	}
+	return conditions, args
+}
+
+// GetUserOperations retrieves the operations of a user passing filter, newest first,
+// one page at a time
+func (d *Database) GetUserOperations(userID int, filter model.OperationFilter, page pagination.Params) (*model.OperationHistory, error) {
+	conditions, args := operationConditions(userID, filter)
+
 	// Get total count
 	var total int
-	err := d.db.QueryRow("SELECT COUNT(*) FROM operations WHERE user_id = ?", userID).Scan(&total)
+	err := d.db.QueryRow("SELECT COUNT(*) FROM operations WHERE "+strings.Join(conditions, " AND "), args...).Scan(&total)
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate offset
-	offset := (page - 1) * pageSize
+	if cond, condArgs := page.Where("created_at", "id"); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
 
 	// Get operations
 	rows, err := d.db.Query(`
 		SELECT id, user_id, type, amount, description, created_at, extra
 		FROM operations
-		WHERE user_id = ?
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
-	`, userID, pageSize, offset)
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, append(args, page.FetchLimit())...)
 	if err != nil {
 		return nil, err
 	}
@@ -1092,44 +2127,22 @@ func (d *Database) GetUserOperations(userID int, page, pageSize int) (*model.Ope
 
 		operations = append(operations, op)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	operations, next := pagination.Trim(operations, page, func(op model.Operation) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: op.CreatedAt, ID: op.ID}
+	})
 
 	return &model.OperationHistory{
 		Operations: operations,
 		Total:      total,
-		Page:       page,
-		PageSize:   pageSize,
+		PageSize:   page.Limit,
+		NextCursor: next,
 	}, nil
 }
 
-// UpdateWithdrawalTxHash updates the transaction hash for the latest withdrawal of a user
-func (d *Database) UpdateWithdrawalTxHash(userID int, txHash string) error {
-	query := `
-		UPDATE withdrawals 
-		SET tx_hash = ?, status = ?
-		WHERE user_id = ? AND id = (
-			SELECT id FROM withdrawals 
-			WHERE user_id = ? 
-			ORDER BY created_at DESC 
-			LIMIT 1
-		)`
-
-	result, err := d.db.Exec(query, txHash, StatusCompleted, userID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to update withdrawal tx hash: %v", err)
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
-	}
-
-	if rows == 0 {
-		return fmt.Errorf("no withdrawal found for user %d", userID)
-	}
-
-	return nil
-}
-
 func (d *Database) calculateTotalEarnings(userID int) (float64, error) {
 	var totalEarnings float64
 
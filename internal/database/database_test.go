@@ -0,0 +1,194 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db, err := New(filepath.Join(t.TempDir(), "tonapp.db"), QueryLogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newTestUser(t *testing.T, db *Database, pubKey string) *model.User {
+	t.Helper()
+	user, _, err := db.CreateUser(pubKey, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// fundUser credits the user through a completed deposit request
+func fundUser(t *testing.T, db *Database, userID int, amount float64) {
+	t.Helper()
+	deposit, err := db.CreateDepositRequest(userID, amount, fmt.Sprintf("fund%d", userID), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ClaimDeposit(deposit.ID, time.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompleteDeposit(*deposit, amount); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func balanceOf(t *testing.T, db *Database, userID int) float64 {
+	t.Helper()
+	user, err := db.GetUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Balance
+}
+
+func checkReconciled(t *testing.T, db *Database) {
+	t.Helper()
+	recon, err := db.ReconcileLedger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recon.Balanced {
+		t.Errorf("ledger is not balanced: %+v", recon.Mismatches)
+	}
+}
+
+func TestNewCreatesSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tonapp.db")
+	db, err := New(path, QueryLogConfig{})
+	if err != nil {
+		t.Fatalf("New with %s: %v", DriverName, err)
+	}
+	for _, table := range []string{"users", "deposit_requests", "withdrawal_queue", "ledger_transfers", "ledger_entries"} {
+		var name string
+		err := db.db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+		if err != nil {
+			t.Errorf("table %s: %v", table, err)
+		}
+	}
+	newTestUser(t, db, "pubkey")
+	db.Close()
+
+	// Opening an existing database runs the migrations again, which must not fail
+	db, err = New(path, QueryLogConfig{})
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.GetUserByPubKey("pubkey"); err != nil {
+		t.Errorf("user after reopening: %v", err)
+	}
+}
+
+func TestClaimAndCompleteDeposit(t *testing.T) {
+	db := newTestDatabase(t)
+	user := newTestUser(t, db, "pubkey")
+
+	deposit, err := db.CreateDepositRequest(user.ID, 25, "memo", "treasury", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := db.ClaimDeposit(deposit.ID, time.Now().Add(-time.Minute).Unix())
+	if err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v, want claimed", claimed, err)
+	}
+	claimed, err = db.ClaimDeposit(deposit.ID, time.Now().Add(-time.Minute).Unix())
+	if err != nil || claimed {
+		t.Fatalf("second claim = %v, %v, want not claimed", claimed, err)
+	}
+
+	if err := db.CompleteDeposit(*deposit, 25); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompleteDeposit(*deposit, 25); err == nil {
+		t.Error("completing the deposit twice succeeded")
+	}
+
+	if balance := balanceOf(t, db, user.ID); balance != 25 {
+		t.Errorf("balance = %v, want 25", balance)
+	}
+	completed, err := db.GetDepositRequest(deposit.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed.Status != StatusCompleted {
+		t.Errorf("deposit is %s, want %s", completed.Status, StatusCompleted)
+	}
+
+	ledger, err := db.GetUserLedger(user.ID, pagination.Params{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledger.Entries) != 1 || ledger.Entries[0].Kind != model.LedgerKindDeposit || ledger.Entries[0].Credit != 25 {
+		t.Errorf("ledger entries = %+v, want one deposit credit of 25", ledger.Entries)
+	}
+	if ledger.Balance != 25 {
+		t.Errorf("ledger balance = %v, want 25", ledger.Balance)
+	}
+	checkReconciled(t, db)
+}
+
+func TestProcessWithdrawalReservesBalance(t *testing.T) {
+	db := newTestDatabase(t)
+	user := newTestUser(t, db, "pubkey")
+	fundUser(t, db, user.ID, 100)
+
+	w, err := db.ProcessWithdrawal(user.ID, 40, "", model.WithdrawalCaps{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Status != model.QueueStatusProcessing || w.Amount != 40 {
+		t.Errorf("queued withdrawal = %+v, want 40 processing", w)
+	}
+	if balance := balanceOf(t, db, user.ID); balance != 60 {
+		t.Errorf("balance = %v, want 60", balance)
+	}
+
+	ledger, err := db.GetUserLedger(user.ID, pagination.Params{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ledger.Entries) != 2 {
+		t.Fatalf("ledger entries = %+v, want a deposit and a withdrawal", ledger.Entries)
+	}
+	entry := ledger.Entries[0]
+	if entry.Kind != model.LedgerKindWithdrawalQueued || entry.Debit != 40 || entry.Reference != fmt.Sprintf("withdrawal_queue:%d", w.ID) {
+		t.Errorf("newest ledger entry = %+v, want a queued withdrawal debit of 40", entry)
+	}
+	if ledger.Balance != 60 {
+		t.Errorf("ledger balance = %v, want 60", ledger.Balance)
+	}
+	checkReconciled(t, db)
+}
+
+func TestProcessWithdrawalInsufficientBalance(t *testing.T) {
+	db := newTestDatabase(t)
+	user := newTestUser(t, db, "pubkey")
+	fundUser(t, db, user.ID, 10)
+
+	if _, err := db.ProcessWithdrawal(user.ID, 15, "", model.WithdrawalCaps{}); err == nil {
+		t.Fatal("withdrawing more than the balance succeeded")
+	}
+	if balance := balanceOf(t, db, user.ID); balance != 10 {
+		t.Errorf("balance = %v, want 10", balance)
+	}
+	queued, err := db.GetUserQueuedWithdrawals(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 0 {
+		t.Errorf("queued withdrawals = %+v, want none", queued)
+	}
+	checkReconciled(t, db)
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+)
+
+// UseDepositAddress returns the personal deposit address of a user, assigning the next
+// subwallet ID on first use, and records the use so the sweeper checks the address
+func (d *Database) UseDepositAddress(userID int) (*model.DepositAddress, error) {
+	now := time.Now().Unix()
+	_, err := d.db.Exec(`
+		INSERT INTO deposit_addresses (user_id, subwallet_id, created_at, used_at)
+		VALUES (?, (SELECT COALESCE(MAX(subwallet_id), ?) + 1 FROM deposit_addresses), ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET used_at = excluded.used_at`,
+		userID, model.DepositSubwalletBase, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT user_id, subwallet_id, created_at, used_at, swept_at, swept
+		FROM deposit_addresses WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := scanDepositAddresses(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &addresses[0], nil
+}
+
+// GetDepositAddressesToSweep returns the deposit addresses used since their last sweep,
+// and since the given time
+func (d *Database) GetDepositAddressesToSweep(usedSince int64) ([]model.DepositAddress, error) {
+	rows, err := d.db.Query(`
+		SELECT user_id, subwallet_id, created_at, used_at, swept_at, swept
+		FROM deposit_addresses
+		WHERE used_at >= ? AND (swept_at IS NULL OR swept_at < used_at)
+		ORDER BY used_at`, usedSince)
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositAddresses(rows)
+}
+
+// RecordDepositSweep records that the balance of a deposit address was swept to the
+// main wallet
+func (d *Database) RecordDepositSweep(userID int, amount float64) error {
+	_, err := d.db.Exec("UPDATE deposit_addresses SET swept_at = ?, swept = swept + ? WHERE user_id = ?",
+		time.Now().Unix(), amount, userID)
+	return err
+}
+
+func scanDepositAddresses(rows *sql.Rows) ([]model.DepositAddress, error) {
+	defer rows.Close()
+
+	addresses := make([]model.DepositAddress, 0)
+	for rows.Next() {
+		var a model.DepositAddress
+		var sweptAt sql.NullInt64
+		if err := rows.Scan(&a.UserID, &a.SubwalletID, &a.CreatedAt, &a.UsedAt, &sweptAt, &a.Swept); err != nil {
+			return nil, err
+		}
+		if sweptAt.Valid {
+			a.SweptAt = &sweptAt.Int64
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, rows.Err()
+}
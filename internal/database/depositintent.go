@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+)
+
+func scanDepositIntents(rows *sql.Rows) ([]model.DepositIntent, error) {
+	defer rows.Close()
+
+	intents := make([]model.DepositIntent, 0)
+	for rows.Next() {
+		var in model.DepositIntent
+		var fundedAt, remindedAt sql.NullInt64
+		if err := rows.Scan(&in.ID, &in.UserID, &in.Amount, &in.Memo, &in.Status, &in.CreatedAt, &fundedAt, &remindedAt); err != nil {
+			return nil, err
+		}
+		if fundedAt.Valid {
+			in.FundedAt = &fundedAt.Int64
+		}
+		if remindedAt.Valid {
+			in.RemindedAt = &remindedAt.Int64
+		}
+		intents = append(intents, in)
+	}
+	return intents, rows.Err()
+}
+
+// GetDepositIntentsSince returns deposit requests created at or after since
+func (d *Database) GetDepositIntentsSince(since int64) ([]model.DepositIntent, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, amount, memo, status, created_at, funded_at, reminded_at
+		FROM deposit_requests
+		WHERE created_at >= ?
+		ORDER BY id`, since)
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositIntents(rows)
+}
+
+// GetDepositsToRemind returns pending deposit requests created between from and to
+// whose owner hasn't been reminded yet
+func (d *Database) GetDepositsToRemind(from, to int64) ([]model.DepositIntent, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, amount, memo, status, created_at, funded_at, reminded_at
+		FROM deposit_requests
+		WHERE status = ? AND reminded_at IS NULL AND created_at >= ? AND created_at <= ?
+		ORDER BY id`, StatusPending, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanDepositIntents(rows)
+}
+
+// MarkDepositReminded stores the reminder notification and marks the request as
+// reminded. It returns false if the request was funded or reminded in the meantime.
+func (d *Database) MarkDepositReminded(depositID int, n *model.Notification) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	result, err := tx.Exec("UPDATE deposit_requests SET reminded_at = ? WHERE id = ? AND status = ? AND reminded_at IS NULL",
+		now, depositID, StatusPending)
+	if err != nil {
+		return false, err
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return false, err
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO notifications (user_id, kind, title, body, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		n.UserID, n.Kind, n.Title, n.Body, now); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetStalePendingDeposits returns how many deposit requests created before the given
+// time are still pending and when the oldest of them was created
+func (d *Database) GetStalePendingDeposits(before int64) (count int, oldest int64, err error) {
+	err = d.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(MIN(created_at), 0)
+		FROM deposit_requests
+		WHERE status = ? AND created_at < ?`, StatusPending, before).Scan(&count, &oldest)
+	return count, oldest, err
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreateRiskAcknowledgment stores a risk acknowledgment with the token handed to the user
+func (d *Database) CreateRiskAcknowledgment(a *model.RiskAcknowledgment, token string) error {
+	result, err := d.db.Exec(`
+		INSERT INTO risk_acknowledgments (token, user_id, type, weekly_percent, version, ip, acknowledged_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		token, a.UserID, a.Type, a.WeeklyPercent, a.Version, a.IP, a.AcknowledgedAt, a.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	a.ID, err = result.LastInsertId()
+	return err
+}
+
+// UseRiskAcknowledgment atomically marks the unexpired acknowledgment of a token as used
+// and returns it. Each token can be used for one investment only.
+func (d *Database) UseRiskAcknowledgment(token string, userID int, investType string) (*model.RiskAcknowledgment, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var a model.RiskAcknowledgment
+	err = tx.QueryRow(`
+		SELECT id, user_id, type, weekly_percent, version, ip, acknowledged_at, expires_at
+		FROM risk_acknowledgments
+		WHERE token = ? AND user_id = ? AND type = ? AND used_at IS NULL`,
+		token, userID, investType).
+		Scan(&a.ID, &a.UserID, &a.Type, &a.WeeklyPercent, &a.Version, &a.IP, &a.AcknowledgedAt, &a.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("risk token not found or already used")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if now > a.ExpiresAt {
+		return nil, fmt.Errorf("risk token expired")
+	}
+
+	if _, err := tx.Exec("UPDATE risk_acknowledgments SET used_at = ? WHERE id = ?", now, a.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	a.UsedAt = &now
+	return &a, nil
+}
+
+// GetRiskAcknowledgments lists the risk acknowledgments of a user, newest first
+func (d *Database) GetRiskAcknowledgments(userID int) ([]model.RiskAcknowledgment, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, type, weekly_percent, version, ip, acknowledged_at, expires_at, used_at
+		FROM risk_acknowledgments
+		WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acknowledgments := make([]model.RiskAcknowledgment, 0)
+	for rows.Next() {
+		var a model.RiskAcknowledgment
+		var usedAt sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Type, &a.WeeklyPercent, &a.Version, &a.IP, &a.AcknowledgedAt, &a.ExpiresAt, &usedAt); err != nil {
+			return nil, err
+		}
+		if usedAt.Valid {
+			a.UsedAt = &usedAt.Int64
+		}
+		acknowledgments = append(acknowledgments, a)
+	}
+	return acknowledgments, rows.Err()
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+)
+
+// systemOperationTypes are recorded without user interaction and don't count as activity.
+// Investments closed by a policy are excluded through their closed_by marker.
+var systemOperationTypes = []interface{}{
+	model.OperationTypeInvestmentProfit,
+	model.OperationTypeGiftRefunded,
+	model.OperationTypeDormancyNotice,
+	model.OperationTypeDormancyAction,
+}
+
+// TouchUserActivity records that the user used the app
+func (d *Database) TouchUserActivity(userID int) error {
+	_, err := d.db.Exec("UPDATE users SET last_active_at = ? WHERE id = ?", time.Now().Unix(), userID)
+	return err
+}
+
+// GetInactiveUsers returns users whose last activity (app use or a user-initiated
+// operation) is before the given time
+func (d *Database) GetInactiveUsers(before int64) ([]model.DormantUser, error) {
+	args := append([]interface{}{}, systemOperationTypes...)
+	args = append(args, before)
+
+	rows, err := d.db.Query(`
+		SELECT id, last_active FROM (
+			SELECT u.id,
+				MAX(
+					u.created_at,
+					COALESCE(u.last_active_at, 0),
+					COALESCE((SELECT MAX(o.created_at) FROM operations o
+						WHERE o.user_id = u.id AND o.type NOT IN (?, ?, ?, ?)
+						AND json_extract(o.extra, '$.closed_by') IS NULL), 0)
+				) AS last_active
+			FROM users u
+		)
+		WHERE last_active < ?
+		ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.DormantUser
+	for rows.Next() {
+		var u model.DormantUser
+		if err := rows.Scan(&u.UserID, &u.LastActiveAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetDormancyNotice returns the progress of a rule for a user, or nil if the user wasn't notified
+func (d *Database) GetDormancyNotice(userID int, rule string) (*model.DormancyNotice, error) {
+	n := model.DormancyNotice{UserID: userID, Rule: rule}
+	var executedAt sql.NullInt64
+	err := d.db.QueryRow("SELECT notified_at, executed_at FROM dormancy_notices WHERE user_id = ? AND rule = ?", userID, rule).
+		Scan(&n.NotifiedAt, &executedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if executedAt.Valid {
+		n.ExecutedAt = &executedAt.Int64
+	}
+	return &n, nil
+}
+
+// RecordDormancyNotice stores the pre-notification of a rule and logs it as an operation
+func (d *Database) RecordDormancyNotice(userID int, rule model.DormancyRule, notification *model.Notification) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(`
+		INSERT INTO dormancy_notices (user_id, rule, notified_at, executed_at) VALUES (?, ?, ?, NULL)
+		ON CONFLICT(user_id, rule) DO UPDATE SET notified_at = excluded.notified_at, executed_at = NULL`,
+		userID, rule.Name, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO notifications (user_id, kind, title, body, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, notification.Kind, notification.Title, notification.Body, now)
+	if err != nil {
+		return err
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeDormancyNotice,
+		Amount:      0,
+		Description: notification.Body,
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"rule":          rule.Name,
+			"action":        rule.Action,
+			"inactive_days": rule.InactiveDays,
+			"grace_days":    rule.GraceDays,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MarkDormancyExecuted records that a rule's action ran and logs it as an operation
+func (d *Database) MarkDormancyExecuted(userID int, rule model.DormancyRule, amount float64, details map[string]interface{}) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	if _, err := tx.Exec("UPDATE dormancy_notices SET executed_at = ? WHERE user_id = ? AND rule = ?", now, userID, rule.Name); err != nil {
+		return err
+	}
+
+	extra := map[string]interface{}{
+		"rule":   rule.Name,
+		"action": rule.Action,
+	}
+	for k, v := range details {
+		extra[k] = v
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeDormancyAction,
+		Amount:      amount,
+		Description: "Inactivity policy applied: " + rule.Name,
+		CreatedAt:   now,
+		Extra:       extra,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClearDormancyNotice resets a rule once the user became active again
+func (d *Database) ClearDormancyNotice(userID int, rule string) error {
+	_, err := d.db.Exec("DELETE FROM dormancy_notices WHERE user_id = ? AND rule = ?", userID, rule)
+	return err
+}
+
+// GetDormancyNoticesByRule returns all notices of a rule
+func (d *Database) GetDormancyNoticesByRule(rule string) ([]model.DormancyNotice, error) {
+	rows, err := d.db.Query("SELECT user_id, notified_at, executed_at FROM dormancy_notices WHERE rule = ?", rule)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notices []model.DormancyNotice
+	for rows.Next() {
+		n := model.DormancyNotice{Rule: rule}
+		var executedAt sql.NullInt64
+		if err := rows.Scan(&n.UserID, &n.NotifiedAt, &executedAt); err != nil {
+			return nil, err
+		}
+		if executedAt.Valid {
+			n.ExecutedAt = &executedAt.Int64
+		}
+		notices = append(notices, n)
+	}
+	return notices, rows.Err()
+}
+
+// GetUserInvestments returns the open investments of a user
+func (d *Database) GetUserInvestments(userID int) ([]model.Investment, error) {
+	return d.getUserInvestments(userID)
+}
@@ -0,0 +1,40 @@
+//go:build !modernc
+
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DriverName is the SQLite driver the binary was built with
+const DriverName = "mattn/go-sqlite3"
+
+// driverName is the name the driver is registered under in database/sql
+const driverName = "sqlite3"
+
+func newDriver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+// driverDSN returns the data source name for a database file.
+// mattn/go-sqlite3 already waits 5 seconds on a locked database.
+func driverDSN(path string) string {
+	return path
+}
+
+// storageFailure reports whether err means the database file can't be written: it is
+// read-only, full, corrupt or failing to read or write
+func storageFailure(err error) bool {
+	var e sqlite3.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code {
+	case sqlite3.ErrReadonly, sqlite3.ErrIoErr, sqlite3.ErrCorrupt, sqlite3.ErrFull, sqlite3.ErrCantOpen, sqlite3.ErrNotADB:
+		return true
+	}
+	return false
+}
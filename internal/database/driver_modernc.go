@@ -0,0 +1,48 @@
+//go:build modernc
+
+package database
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DriverName is the SQLite driver the binary was built with
+const DriverName = "modernc.org/sqlite"
+
+// driverName is the name the driver is registered under in database/sql
+const driverName = "sqlite"
+
+func newDriver() driver.Driver {
+	return &sqlite.Driver{}
+}
+
+// driverDSN returns the data source name for a database file.
+// modernc.org/sqlite doesn't wait on a locked database by default, so the busy
+// timeout of mattn/go-sqlite3 is set explicitly to keep concurrent writes working.
+func driverDSN(path string) string {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return path + separator + "_pragma=busy_timeout(5000)"
+}
+
+// storageFailure reports whether err means the database file can't be written: it is
+// read-only, full, corrupt or failing to read or write
+func storageFailure(err error) bool {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	// The low byte of an extended result code is the primary one
+	switch e.Code() & 0xff {
+	case sqlite3.SQLITE_READONLY, sqlite3.SQLITE_IOERR, sqlite3.SQLITE_CORRUPT, sqlite3.SQLITE_FULL, sqlite3.SQLITE_CANTOPEN, sqlite3.SQLITE_NOTADB:
+		return true
+	}
+	return false
+}
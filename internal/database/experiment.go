@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// RecordExperimentExposure logs that a user was shown an experiment. The first exposure
+// assigns the given variant; later ones keep the stored variant, which is returned.
+func (d *Database) RecordExperimentExposure(experiment string, userID int, variant string) (*model.ExperimentExposure, error) {
+	now := time.Now().Unix()
+	_, err := d.db.Exec(`
+		INSERT INTO experiment_exposures (experiment, user_id, variant, first_exposed_at, last_exposed_at, exposures)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT(experiment, user_id) DO UPDATE SET last_exposed_at = excluded.last_exposed_at, exposures = exposures + 1`,
+		experiment, userID, variant, now, now)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetExperimentExposure(experiment, userID)
+}
+
+// GetExperimentExposure returns the variant assigned to a user, nil if the user was
+// never exposed to the experiment
+func (d *Database) GetExperimentExposure(experiment string, userID int) (*model.ExperimentExposure, error) {
+	e := model.ExperimentExposure{Experiment: experiment, UserID: userID}
+	err := d.db.QueryRow(`
+		SELECT variant, first_exposed_at, last_exposed_at, exposures
+		FROM experiment_exposures WHERE experiment = ? AND user_id = ?`,
+		experiment, userID).Scan(&e.Variant, &e.FirstExposedAt, &e.LastExposedAt, &e.Exposures)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetExperimentExposures returns the variants assigned in an experiment by user ID
+func (d *Database) GetExperimentExposures(experiment string) (map[int]model.ExperimentExposure, error) {
+	rows, err := d.db.Query(`
+		SELECT user_id, variant, first_exposed_at, last_exposed_at, exposures
+		FROM experiment_exposures WHERE experiment = ?`, experiment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exposures := make(map[int]model.ExperimentExposure)
+	for rows.Next() {
+		e := model.ExperimentExposure{Experiment: experiment}
+		if err := rows.Scan(&e.UserID, &e.Variant, &e.FirstExposedAt, &e.LastExposedAt, &e.Exposures); err != nil {
+			return nil, err
+		}
+		exposures[e.UserID] = e
+	}
+	return exposures, rows.Err()
+}
+
+// GetExperimentStats counts per variant the exposed users, and the users who deposited
+// or invested into investType after their first exposure, with the amounts. Deposits
+// include top-ups of alternative payment rails. Conversions are left to the caller.
+func (d *Database) GetExperimentStats(experiment string, investType string) ([]model.ExperimentVariantStats, error) {
+	rows, err := d.db.Query(`
+		SELECT variant, COUNT(*), SUM(exposures)
+		FROM experiment_exposures WHERE experiment = ?
+		GROUP BY variant ORDER BY variant`, experiment)
+	if err != nil {
+		return nil, err
+	}
+	var stats []model.ExperimentVariantStats
+	index := make(map[string]int)
+	for rows.Next() {
+		var s model.ExperimentVariantStats
+		if err := rows.Scan(&s.Variant, &s.Users, &s.Exposures); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[s.Variant] = len(stats)
+		stats = append(stats, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.db.Query(`
+		SELECT x.variant, COUNT(DISTINCT x.user_id), SUM(e.credit)
+		FROM experiment_exposures x
+		JOIN ledger_entries e ON e.account = ? AND e.user_id = x.user_id
+		JOIN ledger_transfers t ON t.id = e.transfer_id
+		WHERE x.experiment = ? AND t.kind IN (?, ?) AND t.created_at >= x.first_exposed_at AND e.credit > 0
+		GROUP BY x.variant`,
+		model.LedgerAccountUser, experiment, model.LedgerKindDeposit, model.LedgerKindPayment)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var variant string
+		var depositors int
+		var deposited float64
+		if err := rows.Scan(&variant, &depositors, &deposited); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[variant]; ok {
+			stats[i].Depositors = depositors
+			stats[i].Deposited = money.Round(deposited)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.db.Query(`
+		SELECT x.variant, COUNT(DISTINCT x.user_id), SUM(i.amount)
+		FROM experiment_exposures x
+		JOIN (
+			SELECT user_id, type, amount, created_at FROM investments
+			UNION ALL
+			SELECT user_id, type, amount, created_at FROM closed_investments
+		) i ON i.user_id = x.user_id
+		WHERE x.experiment = ? AND i.type = ? AND i.created_at >= x.first_exposed_at
+		GROUP BY x.variant`,
+		experiment, investType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var variant string
+		var investors int
+		var invested float64
+		if err := rows.Scan(&variant, &investors, &invested); err != nil {
+			return nil, err
+		}
+		if i, ok := index[variant]; ok {
+			stats[i].Investors = investors
+			stats[i].Invested = money.Round(invested)
+		}
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// explorerQuery links indexed transactions to deposit requests by memo and to
+// withdrawal operations by transaction hash
+const explorerQuery = `
+	SELECT * FROM (
+		SELECT c.id, c.wallet, c.lt, c.hash, c.utime, c.in_source, c.in_amount, c.in_comment, c.bounced,
+			c.out_destination, c.out_amount, c.out_comment, c.fee,
+			(SELECT d.id FROM deposit_requests d WHERE c.in_comment != '' AND d.memo = c.in_comment LIMIT 1) AS deposit_id,
+			(SELECT d.user_id FROM deposit_requests d WHERE c.in_comment != '' AND d.memo = c.in_comment LIMIT 1) AS deposit_user_id,
+			(SELECT o.id FROM operations o WHERE c.out_amount > 0 AND o.type = 'withdrawal' AND o.extra LIKE '%' || c.hash || '%' LIMIT 1) AS withdrawal_operation_id,
+			(SELECT o.user_id FROM operations o WHERE c.out_amount > 0 AND o.type = 'withdrawal' AND o.extra LIKE '%' || c.hash || '%' LIMIT 1) AS withdrawal_user_id,
+			i.status AS investigation_status, i.note, i.updated_at
+		FROM chain_transactions c
+		LEFT JOIN chain_investigations i ON i.tx_id = c.id
+	) t`
+
+// GetExplorerTransactions returns indexed treasury transactions, newest first
+func (d *Database) GetExplorerTransactions(filter model.ExplorerFilter, page pagination.Params) (*model.ExplorerPage, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.Wallet != "" {
+		conditions = append(conditions, "t.wallet = ?")
+		args = append(args, filter.Wallet)
+	}
+	switch filter.Direction {
+	case "in":
+		conditions = append(conditions, "t.in_amount > 0")
+	case "out":
+		conditions = append(conditions, "t.out_amount > 0")
+	}
+	if filter.UnmatchedOnly {
+		conditions = append(conditions, "t.in_amount > 0 AND t.bounced = 0 AND t.deposit_id IS NULL")
+	}
+	if filter.Investigation != "" {
+		conditions = append(conditions, "t.investigation_status = ?")
+		args = append(args, filter.Investigation)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM ("+explorerQuery+where+")", args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	if cond, condArgs := page.Where("t.utime", "t.id"); cond != "" {
+		if where == "" {
+			where = " WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		args = append(args, condArgs...)
+	}
+
+	rows, err := d.db.Query(explorerQuery+where+" ORDER BY t.utime DESC, t.id DESC LIMIT ?",
+		append(args, page.FetchLimit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := make([]model.ExplorerTransaction, 0)
+	for rows.Next() {
+		var t model.ExplorerTransaction
+		var depositID, depositUserID, withdrawalUserID sql.NullInt64
+		var withdrawalOpID sql.NullInt64
+		var invStatus, invNote sql.NullString
+		var invUpdatedAt sql.NullInt64
+
+		err := rows.Scan(&t.ID, &t.Wallet, &t.LT, &t.Hash, &t.Utime, &t.InSource, &t.InAmount, &t.InComment, &t.Bounced,
+			&t.OutDestination, &t.OutAmount, &t.OutComment, &t.Fee,
+			&depositID, &depositUserID, &withdrawalOpID, &withdrawalUserID,
+			&invStatus, &invNote, &invUpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if depositID.Valid {
+			id, userID := int(depositID.Int64), int(depositUserID.Int64)
+			t.DepositID = &id
+			t.DepositUserID = &userID
+		}
+		if withdrawalOpID.Valid {
+			userID := int(withdrawalUserID.Int64)
+			t.WithdrawalOperationID = &withdrawalOpID.Int64
+			t.WithdrawalUserID = &userID
+		}
+		if invStatus.Valid {
+			t.Investigation = &model.ChainInvestigation{
+				Status:    invStatus.String,
+				Note:      invNote.String,
+				UpdatedAt: invUpdatedAt.Int64,
+			}
+		}
+		t.Unmatched = t.InAmount > 0 && !t.Bounced && t.DepositID == nil
+
+		txs = append(txs, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	txs, next := pagination.Trim(txs, page, func(t model.ExplorerTransaction) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: t.Utime, ID: t.ID}
+	})
+
+	return &model.ExplorerPage{
+		Transactions: txs,
+		Total:        total,
+		PageSize:     page.Limit,
+		NextCursor:   next,
+	}, nil
+}
+
+// SetChainInvestigation marks an indexed transaction for investigation or resolves it
+func (d *Database) SetChainInvestigation(txID int64, status string, note string) error {
+	var exists int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM chain_transactions WHERE id = ?", txID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err := d.db.Exec(`
+		INSERT INTO chain_investigations (tx_id, status, note, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(tx_id) DO UPDATE SET status = excluded.status, note = excluded.note, updated_at = excluded.updated_at`,
+		txID, status, note, time.Now().Unix())
+	return err
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"tonapp/internal/model"
+)
+
+// ForEachUserOperation calls fn for every operation of a user passing filter, newest
+// first, without loading the whole history into memory
+func (d *Database) ForEachUserOperation(userID int, filter model.OperationFilter, fn func(op model.Operation) error) error {
+	conditions, args := operationConditions(userID, filter)
+	rows, err := d.db.Query(`
+		SELECT id, user_id, type, amount, description, created_at, extra
+		FROM operations
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var op model.Operation
+		var extraJSON []byte
+		if err := rows.Scan(&op.ID, &op.UserID, &op.Type, &op.Amount, &op.Description, &op.CreatedAt, &extraJSON); err != nil {
+			return err
+		}
+
+		if len(extraJSON) > 0 {
+			var extra interface{}
+			if err := json.Unmarshal(extraJSON, &extra); err != nil {
+				return err
+			}
+			op.Extra = extra
+		}
+
+		if err := fn(op); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"encoding/json"
+	"tonapp/internal/model"
+)
+
+// GetLastOperationID returns the ID of the latest operation, 0 without any
+func (d *Database) GetLastOperationID() (int64, error) {
+	var id int64
+	err := d.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM operations").Scan(&id)
+	return id, err
+}
+
+// GetOperationsAfter returns up to limit operations of every user recorded after the
+// operation with afterID, oldest first
+func (d *Database) GetOperationsAfter(afterID int64, limit int) ([]model.Operation, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, type, amount, description, created_at, extra
+		FROM operations
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	operations := make([]model.Operation, 0)
+	for rows.Next() {
+		var op model.Operation
+		var extraJSON []byte
+		if err := rows.Scan(&op.ID, &op.UserID, &op.Type, &op.Amount, &op.Description, &op.CreatedAt, &extraJSON); err != nil {
+			return nil, err
+		}
+
+		if len(extraJSON) > 0 {
+			var extra interface{}
+			if err := json.Unmarshal(extraJSON, &extra); err != nil {
+				return nil, err
+			}
+			op.Extra = extra
+		}
+		operations = append(operations, op)
+	}
+	return operations, rows.Err()
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+)
+
+// GetUserFreeze returns whether a user is frozen, sql.ErrNoRows for unknown users
+func (d *Database) GetUserFreeze(userID int) (*model.UserFreeze, error) {
+	f := &model.UserFreeze{UserID: userID}
+	var frozenAt sql.NullInt64
+	err := d.db.QueryRow("SELECT frozen_at, frozen_reason FROM users WHERE id = ?", userID).Scan(&frozenAt, &f.Reason)
+	if err != nil {
+		return nil, err
+	}
+	if frozenAt.Valid {
+		f.Frozen = true
+		f.FrozenAt = &frozenAt.Int64
+	}
+	return f, nil
+}
+
+// SetUserFrozen freezes or unfreezes a user. Freezing a frozen user only updates the
+// reason, unfreezing clears it.
+func (d *Database) SetUserFrozen(userID int, frozen bool, reason string) (*model.UserFreeze, error) {
+	var result sql.Result
+	var err error
+	if frozen {
+		result, err = d.db.Exec("UPDATE users SET frozen_at = COALESCE(frozen_at, ?), frozen_reason = ? WHERE id = ?", time.Now().Unix(), reason, userID)
+	} else {
+		result, err = d.db.Exec("UPDATE users SET frozen_at = NULL, frozen_reason = '' WHERE id = ?", userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return d.GetUserFreeze(userID)
+}
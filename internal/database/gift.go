@@ -0,0 +1,305 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// insertOperation records an operation inside a transaction
+func insertOperation(tx *sql.Tx, op *model.Operation) error {
+	var extraJSON []byte
+	if op.Extra != nil {
+		var err error
+		extraJSON, err = json.Marshal(op.Extra)
+		if err != nil {
+			return err
+		}
+	}
+
+	createdAt := op.CreatedAt
+	if createdAt == 0 {
+		createdAt = time.Now().Unix()
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO operations (user_id, type, amount, description, created_at, extra)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		op.UserID, op.Type, op.Amount, op.Description, createdAt, extraJSON)
+	return err
+}
+
+// CreateGift takes the gift amount from the sender balance and stores the gift with its claim code
+func (d *Database) CreateGift(senderID int, code string, investType string, amount float64, expiresAt int64) (*model.Gift, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(`
+		INSERT INTO gifts (code, sender_id, amount, type, status, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		code, senderID, amount, investType, model.GiftStatusActive, now, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindGiftSent,
+		Reference: fmt.Sprintf("gift:%d", id),
+		From:      userAccount(senderID),
+		To:        systemAccount(model.LedgerAccountGifts),
+		Amount:    amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      senderID,
+		Type:        model.OperationTypeGiftSent,
+		Amount:      amount,
+		Description: fmt.Sprintf("Sent %s investment gift", investType),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"gift_id": id,
+			"type":    investType,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetGiftByCode(code)
+}
+
+func scanGift(row interface{ Scan(...interface{}) error }) (*model.Gift, error) {
+	var g model.Gift
+	var recipientID, claimedAt sql.NullInt64
+	err := row.Scan(&g.ID, &g.Code, &g.SenderID, &recipientID, &g.Amount, &g.Type, &g.Status, &g.CreatedAt, &g.ExpiresAt, &claimedAt)
+	if err != nil {
+		return nil, err
+	}
+	if recipientID.Valid {
+		v := int(recipientID.Int64)
+		g.RecipientID = &v
+	}
+	if claimedAt.Valid {
+		g.ClaimedAt = &claimedAt.Int64
+	}
+	return &g, nil
+}
+
+const giftColumns = "id, code, sender_id, recipient_id, amount, type, status, created_at, expires_at, claimed_at"
+
+// GetGiftByCode returns a gift by its claim code
+func (d *Database) GetGiftByCode(code string) (*model.Gift, error) {
+	return scanGift(d.db.QueryRow("SELECT "+giftColumns+" FROM gifts WHERE code = ?", code))
+}
+
+// GetGiftsBySender lists gifts sent by a user, newest first
+func (d *Database) GetGiftsBySender(senderID int) ([]model.Gift, error) {
+	rows, err := d.db.Query("SELECT "+giftColumns+" FROM gifts WHERE sender_id = ? ORDER BY created_at DESC", senderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	gifts := make([]model.Gift, 0)
+	for rows.Next() {
+		g, err := scanGift(rows)
+		if err != nil {
+			return nil, err
+		}
+		gifts = append(gifts, *g)
+	}
+
+	return gifts, rows.Err()
+}
+
+// ClaimGift marks an active gift as claimed and opens the gifted investment for the recipient
+func (d *Database) ClaimGift(code string, recipientID int, config model.InvestmentTypeConfig) (*model.Gift, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	gift, err := scanGift(tx.QueryRow("SELECT "+giftColumns+" FROM gifts WHERE code = ?", code))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("gift not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	if gift.Status != model.GiftStatusActive {
+		return nil, fmt.Errorf("gift is already %s", gift.Status)
+	}
+	if now > gift.ExpiresAt {
+		return nil, fmt.Errorf("gift has expired")
+	}
+	if gift.SenderID == recipientID {
+		return nil, fmt.Errorf("you can't claim your own gift")
+	}
+
+	result, err := tx.Exec(`
+		UPDATE gifts SET status = ?, recipient_id = ?, claimed_at = ?
+		WHERE id = ? AND status = ?`,
+		model.GiftStatusClaimed, recipientID, now, gift.ID, model.GiftStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
+		return nil, fmt.Errorf("gift was claimed concurrently")
+	}
+
+	result, err = tx.Exec("INSERT INTO investments (user_id, type, amount, created_at) VALUES (?, ?, ?, ?)",
+		recipientID, gift.Type, gift.Amount, now)
+	if err != nil {
+		return nil, err
+	}
+	investmentID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindGiftClaimed,
+		Reference: fmt.Sprintf("gift:%d", gift.ID),
+		From:      systemAccount(model.LedgerAccountGifts),
+		To:        systemAccount(model.LedgerAccountInvestments),
+		Amount:    gift.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      recipientID,
+		Type:        model.OperationTypeGiftClaimed,
+		Amount:      gift.Amount,
+		Description: fmt.Sprintf("Claimed %s investment gift", gift.Type),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"gift_id":        gift.ID,
+			"sender_id":      gift.SenderID,
+			"investment_id":  investmentID,
+			"type":           gift.Type,
+			"weekly_percent": config.WeeklyPercent,
+			"lock_period":    config.LockPeriod,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	gift.Status = model.GiftStatusClaimed
+	gift.RecipientID = &recipientID
+	gift.ClaimedAt = &now
+	return gift, nil
+}
+
+// RefundExpiredGifts returns the amount of unclaimed expired gifts to their senders.
+// Returns the number of refunded gifts.
+func (d *Database) RefundExpiredGifts(now int64) (int, error) {
+	rows, err := d.db.Query("SELECT "+giftColumns+" FROM gifts WHERE status = ? AND expires_at < ?",
+		model.GiftStatusActive, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []model.Gift
+	for rows.Next() {
+		g, err := scanGift(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, *g)
+	}
+	rows.Close()
+
+	refunded := 0
+	for _, gift := range expired {
+		if err := d.refundGift(gift, now); err != nil {
+			return refunded, err
+		}
+		refunded++
+	}
+
+	return refunded, nil
+}
+
+func (d *Database) refundGift(gift model.Gift, now int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE gifts SET status = ? WHERE id = ? AND status = ?",
+		model.GiftStatusRefunded, gift.ID, model.GiftStatusActive)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		// Claimed in the meantime
+		return nil
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindGiftRefunded,
+		Reference: fmt.Sprintf("gift:%d", gift.ID),
+		From:      systemAccount(model.LedgerAccountGifts),
+		To:        userAccount(gift.SenderID),
+		Amount:    gift.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      gift.SenderID,
+		Type:        model.OperationTypeGiftRefunded,
+		Amount:      gift.Amount,
+		Description: fmt.Sprintf("Refund of unclaimed %s investment gift", gift.Type),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"gift_id": gift.ID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+package database
+
+import "tonapp/internal/model"
+
+// ClaimIdempotencyKey stores a record for a new key and returns nil, or returns the
+// record of a key already claimed. A record created before expiredBefore no longer
+// counts and is replaced.
+func (d *Database) ClaimIdempotencyKey(record *model.IdempotencyRecord, expiredBefore int64) (*model.IdempotencyRecord, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND idempotency_key = ? AND created_at < ?",
+		record.Scope, record.Key, expiredBefore)
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO idempotency_keys (scope, idempotency_key, route, request_hash, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(scope, idempotency_key) DO NOTHING`,
+		record.Scope, record.Key, record.Route, record.RequestHash, record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 1 {
+		return nil, tx.Commit()
+	}
+
+	existing := &model.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	err = tx.QueryRow(`
+		SELECT route, request_hash, status, content_type, body, created_at
+		FROM idempotency_keys
+		WHERE scope = ? AND idempotency_key = ?`,
+		record.Scope, record.Key).
+		Scan(&existing.Route, &existing.RequestHash, &existing.Status, &existing.ContentType, &existing.Body, &existing.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return existing, tx.Commit()
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed a key
+func (d *Database) CompleteIdempotencyKey(scope, key string, status int, contentType string, body []byte) error {
+	_, err := d.db.Exec(`
+		UPDATE idempotency_keys SET status = ?, content_type = ?, body = ?
+		WHERE scope = ? AND idempotency_key = ?`,
+		status, contentType, body, scope, key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a key whose request ended without a response
+func (d *Database) ReleaseIdempotencyKey(scope, key string) error {
+	_, err := d.db.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND idempotency_key = ?", scope, key)
+	return err
+}
+
+// DeleteIdempotencyKeysBefore removes the keys created before a unix time
+func (d *Database) DeleteIdempotencyKeysBefore(before int64) (int, error) {
+	result, err := d.db.Exec("DELETE FROM idempotency_keys WHERE created_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"fmt"
+	"tonapp/internal/model"
+)
+
+// integrityQuery finds the records of an integrity check. The sample query selects the
+// id, user_id, amount and detail of at most ? records.
+type integrityQuery struct {
+	name   string
+	tables []string
+	count  string
+	sample string
+	args   []interface{}
+}
+
+func integrityQueries() []integrityQuery {
+	return []integrityQuery{
+		{
+			name:   model.IntegrityOrphanedOperations,
+			tables: []string{"operations", "operation_annotations", "operation_tags"},
+			count:  "SELECT COUNT(*) FROM operations o WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = o.user_id)",
+			sample: `
+				SELECT o.id, o.user_id, o.amount, o.type
+				FROM operations o
+				WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = o.user_id)
+				ORDER BY o.id
+				LIMIT ?`,
+		},
+		{
+			name:   model.IntegrityOrphanedEarnings,
+			tables: []string{"referral_earnings"},
+			count:  "SELECT COUNT(*) FROM referral_earnings e WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = e.referrer_id)",
+			sample: `
+				SELECT e.id, e.referrer_id, e.amount, printf('level %d earning on user %d', e.level, e.referred_id)
+				FROM referral_earnings e
+				WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = e.referrer_id)
+				ORDER BY e.id
+				LIMIT ?`,
+		},
+		{
+			name:   model.IntegrityNegativeBalances,
+			tables: []string{"users"},
+			count:  "SELECT COUNT(*) FROM users WHERE balance < ?",
+			sample: `
+				SELECT id, id, balance, pub_key
+				FROM users
+				WHERE balance < ?
+				ORDER BY balance
+				LIMIT ?`,
+			args: []interface{}{-ledgerTolerance},
+		},
+		{
+			name:   model.IntegrityPendingWithdrawalsWithTxHash,
+			tables: []string{"withdrawals"},
+			count:  "SELECT COUNT(*) FROM withdrawals WHERE status IN (?, ?) AND COALESCE(tx_hash, '') != ''",
+			sample: `
+				SELECT id, user_id, amount, printf('%s, tx %s', status, tx_hash)
+				FROM withdrawals
+				WHERE status IN (?, ?) AND COALESCE(tx_hash, '') != ''
+				ORDER BY id
+				LIMIT ?`,
+			args: []interface{}{StatusPending, StatusProcessing},
+		},
+		{
+			name:   model.IntegrityUnsettledWithdrawalsWithTxHash,
+			tables: []string{"withdrawal_requests", "withdrawal_queue"},
+			count: `
+				SELECT (SELECT COUNT(*) FROM withdrawal_requests WHERE status IN (?, ?, ?) AND COALESCE(tx_hash, '') != '')
+					+ (SELECT COUNT(*) FROM withdrawal_queue WHERE status IN (?, ?, ?, ?) AND COALESCE(tx_hash, '') != '')`,
+			sample: `
+				SELECT id, user_id, amount, printf('withdrawal_requests %s, tx %s', status, tx_hash)
+				FROM withdrawal_requests
+				WHERE status IN (?, ?, ?) AND COALESCE(tx_hash, '') != ''
+				UNION ALL
+				SELECT id, user_id, amount, printf('withdrawal_queue %s, tx %s', status, tx_hash)
+				FROM withdrawal_queue
+				WHERE status IN (?, ?, ?, ?) AND COALESCE(tx_hash, '') != ''
+				LIMIT ?`,
+			args: []interface{}{StatusPending, model.WithdrawalStatusPendingApproval, model.WithdrawalStatusSending,
+				model.QueueStatusQueued, model.QueueStatusSending, model.QueueStatusBatched, model.QueueStatusProcessing},
+		},
+		{
+			name:   model.IntegrityDuplicatePubKeys,
+			tables: []string{"users"},
+			count:  "SELECT COUNT(*) FROM (SELECT 1 FROM users GROUP BY LOWER(pub_key) HAVING COUNT(*) > 1)",
+			sample: `
+				SELECT 0, MIN(id), 0, printf('%s: users %s', LOWER(pub_key), GROUP_CONCAT(id, ', '))
+				FROM users
+				GROUP BY LOWER(pub_key)
+				HAVING COUNT(*) > 1
+				ORDER BY MIN(id)
+				LIMIT ?`,
+		},
+	}
+}
+
+// CheckIntegrity runs the integrity checks, listing up to sampleSize records of each
+func (d *Database) CheckIntegrity(sampleSize int) ([]model.IntegrityCheck, error) {
+	queries := integrityQueries()
+	checks := make([]model.IntegrityCheck, 0, len(queries))
+	for _, q := range queries {
+		check := model.IntegrityCheck{Name: q.name, Tables: q.tables, Samples: make([]model.IntegritySample, 0)}
+		if err := d.db.QueryRow(q.count, q.args...).Scan(&check.Count); err != nil {
+			return nil, fmt.Errorf("%s: %v", q.name, err)
+		}
+		if check.Count > 0 {
+			rows, err := d.db.Query(q.sample, append(q.args, sampleSize)...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", q.name, err)
+			}
+			for rows.Next() {
+				var s model.IntegritySample
+				if err := rows.Scan(&s.ID, &s.UserID, &s.Amount, &s.Detail); err != nil {
+					rows.Close()
+					return nil, fmt.Errorf("%s: %v", q.name, err)
+				}
+				check.Samples = append(check.Samples, s)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return nil, fmt.Errorf("%s: %v", q.name, err)
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// RepairIntegrity fixes what an integrity check with an automatic repair found and
+// returns the number of records repaired. Orphaned operations are deleted with their
+// annotations and orphaned earnings deleted, the ledger keeps their balance movements.
+// Pending withdrawals with a tx hash are completed.
+func (d *Database) RepairIntegrity(check string) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var repaired int64
+	switch check {
+	case model.IntegrityOrphanedOperations:
+		for _, query := range []string{
+			"DELETE FROM operation_tags WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = operation_tags.user_id)",
+			"DELETE FROM operation_annotations WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = operation_annotations.user_id)",
+		} {
+			if _, err := tx.Exec(query); err != nil {
+				return 0, err
+			}
+		}
+		result, err := tx.Exec("DELETE FROM operations WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = operations.user_id)")
+		if err != nil {
+			return 0, err
+		}
+		repaired, err = result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	case model.IntegrityOrphanedEarnings:
+		result, err := tx.Exec("DELETE FROM referral_earnings WHERE NOT EXISTS (SELECT 1 FROM users WHERE id = referral_earnings.referrer_id)")
+		if err != nil {
+			return 0, err
+		}
+		repaired, err = result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	case model.IntegrityPendingWithdrawalsWithTxHash:
+		result, err := tx.Exec("UPDATE withdrawals SET status = ? WHERE status IN (?, ?) AND COALESCE(tx_hash, '') != ''",
+			StatusCompleted, StatusPending, StatusProcessing)
+		if err != nil {
+			return 0, err
+		}
+		repaired, err = result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("%s has no automatic repair", check)
+	}
+
+	return int(repaired), tx.Commit()
+}
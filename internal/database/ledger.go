@@ -0,0 +1,360 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/pagination"
+)
+
+// ledgerTolerance is the largest difference between a balance and its ledger sum
+// that is put down to floating point rounding: one nanoton
+const ledgerTolerance = 1e-9
+
+// ledgerAccount is an account of the ledger. User accounts carry the user ID.
+type ledgerAccount struct {
+	name   string
+	userID int
+}
+
+func userAccount(userID int) ledgerAccount {
+	return ledgerAccount{name: model.LedgerAccountUser, userID: userID}
+}
+
+func systemAccount(name string) ledgerAccount {
+	return ledgerAccount{name: name}
+}
+
+func (a ledgerAccount) isUser() bool {
+	return a.name == model.LedgerAccountUser
+}
+
+func (a ledgerAccount) userIDValue() interface{} {
+	if !a.isUser() {
+		return nil
+	}
+	return a.userID
+}
+
+// ledgerTransfer moves Amount from one account to another.
+// A negative amount moves it the other way.
+type ledgerTransfer struct {
+	Kind      string
+	Reference string
+	From      ledgerAccount
+	To        ledgerAccount
+	Amount    float64
+	// Wallet is the treasury wallet TON moved through, for transfers from or to the
+	// external account; empty for the main wallet
+	Wallet    string
+	CreatedAt int64 // now if not set
+}
+
+// postTransfer applies a transfer to the user balances involved and records it in the ledger.
+// All balance changes go through here. Debiting a user fails with "insufficient balance"
+// when the balance doesn't cover the amount.
+func postTransfer(tx *sql.Tx, t ledgerTransfer) error {
+	if t.Amount < 0 {
+		t.From, t.To, t.Amount = t.To, t.From, -t.Amount
+	}
+	if t.Amount == 0 {
+		return nil
+	}
+
+	if t.From.isUser() {
+		result, err := tx.Exec("UPDATE users SET balance = balance - ? WHERE id = ? AND balance >= ?", t.Amount, t.From.userID, t.Amount)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("insufficient balance")
+		}
+	}
+
+	if t.To.isUser() {
+		result, err := tx.Exec("UPDATE users SET balance = balance + ? WHERE id = ?", t.Amount, t.To.userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return fmt.Errorf("user %d not found", t.To.userID)
+		}
+	}
+
+	return recordTransfer(tx, t)
+}
+
+// recordTransfer writes the transfer and its debit and credit entries without touching balances.
+// Zero amounts aren't recorded.
+func recordTransfer(tx *sql.Tx, t ledgerTransfer) error {
+	if t.Amount < 0 {
+		t.From, t.To, t.Amount = t.To, t.From, -t.Amount
+	}
+	if t.Amount == 0 {
+		return nil
+	}
+	if t.CreatedAt == 0 {
+		t.CreatedAt = time.Now().Unix()
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO ledger_transfers (kind, reference, amount, created_at, wallet)
+		VALUES (?, ?, ?, ?, ?)`,
+		t.Kind, t.Reference, t.Amount, t.CreatedAt, t.Wallet)
+	if err != nil {
+		return err
+	}
+	transferID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO ledger_entries (transfer_id, account, user_id, debit, credit)
+		VALUES (?, ?, ?, ?, 0), (?, ?, ?, 0, ?)`,
+		transferID, t.From.name, t.From.userIDValue(), t.Amount,
+		transferID, t.To.name, t.To.userIDValue(), t.Amount)
+	return err
+}
+
+// openLedger records the balances that existed before the ledger was introduced as
+// opening transfers from the adjustments account, so reconciliation holds from the start.
+// It does nothing once the ledger has transfers.
+func openLedger(db *sql.DB) error {
+	var transfers int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ledger_transfers").Scan(&transfers); err != nil {
+		return err
+	}
+	if transfers > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type opening struct {
+		account ledgerAccount
+		amount  float64
+	}
+	var openings []opening
+
+	rows, err := tx.Query("SELECT id, balance FROM users WHERE balance != 0")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var userID int
+		var balance float64
+		if err := rows.Scan(&userID, &balance); err != nil {
+			rows.Close()
+			return err
+		}
+		openings = append(openings, opening{userAccount(userID), balance})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	held := []struct {
+		account string
+		query   string
+	}{
+		{model.LedgerAccountInvestments, "SELECT COALESCE(SUM(amount), 0) FROM investments"},
+		{model.LedgerAccountGifts, "SELECT COALESCE(SUM(amount), 0) FROM gifts WHERE status = 'active'"},
+		{model.LedgerAccountWithdrawalQueue, "SELECT COALESCE(SUM(amount), 0) FROM withdrawal_queue WHERE status IN ('queued', 'sending', 'batched', 'processing')"},
+	}
+	for _, h := range held {
+		var amount float64
+		if err := tx.QueryRow(h.query).Scan(&amount); err != nil {
+			return err
+		}
+		openings = append(openings, opening{systemAccount(h.account), amount})
+	}
+
+	for _, o := range openings {
+		err := recordTransfer(tx, ledgerTransfer{
+			Kind:   model.LedgerKindOpeningBalance,
+			From:   systemAccount(model.LedgerAccountAdjustments),
+			To:     o.account,
+			Amount: o.amount,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetUserLedger returns a page of the ledger entries of a user account, newest first,
+// with the account balance according to the ledger
+func (d *Database) GetUserLedger(userID int, page pagination.Params) (*model.LedgerHistory, error) {
+	var balance float64
+	err := d.db.QueryRow(`
+		SELECT COALESCE(SUM(credit - debit), 0) FROM ledger_entries
+		WHERE account = ? AND user_id = ?`,
+		model.LedgerAccountUser, userID).Scan(&balance)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []string{"e.account = ?", "e.user_id = ?"}
+	args := []interface{}{model.LedgerAccountUser, userID}
+	// Entries are listed in posting order, which the id follows
+	if cond, condArgs := page.WhereID("e.id"); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT e.id, e.transfer_id, e.account, e.user_id, e.debit, e.credit, t.kind, t.reference, t.wallet, t.created_at
+		FROM ledger_entries e
+		JOIN ledger_transfers t ON t.id = e.transfer_id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY e.id DESC
+		LIMIT ?`, append(args, page.FetchLimit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]model.LedgerEntry, 0)
+	for rows.Next() {
+		var e model.LedgerEntry
+		var entryUserID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.TransferID, &e.Account, &entryUserID, &e.Debit, &e.Credit, &e.Kind, &e.Reference, &e.Wallet, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if entryUserID.Valid {
+			id := int(entryUserID.Int64)
+			e.UserID = &id
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, next := pagination.Trim(entries, page, func(e model.LedgerEntry) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	return &model.LedgerHistory{
+		Entries:    entries,
+		Balance:    money.Round(balance),
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// ReconcileLedger verifies that every user balance equals the sum of its ledger account
+// and that the investment, gift and withdrawal queue accounts hold what their tables say
+func (d *Database) ReconcileLedger() (*model.LedgerReconciliation, error) {
+	report := &model.LedgerReconciliation{
+		CheckedAt:  time.Now().Unix(),
+		Accounts:   make([]model.LedgerAccountBalance, 0),
+		Mismatches: make([]model.LedgerMismatch, 0),
+	}
+
+	rows, err := d.db.Query(`
+		SELECT account, SUM(credit - debit), COUNT(*)
+		FROM ledger_entries
+		GROUP BY account
+		ORDER BY account`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var a model.LedgerAccountBalance
+		if err := rows.Scan(&a.Account, &a.Balance, &a.Entries); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.Total += a.Balance
+		a.Balance = money.Round(a.Balance)
+		if a.Account == model.LedgerAccountUser {
+			report.Users = a.Balance
+			continue
+		}
+		report.Accounts = append(report.Accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	held := map[string]string{
+		model.LedgerAccountInvestments:        "SELECT COALESCE(SUM(amount), 0) FROM investments",
+		model.LedgerAccountGifts:              "SELECT COALESCE(SUM(amount), 0) FROM gifts WHERE status = 'active'",
+		model.LedgerAccountWithdrawalQueue:    "SELECT COALESCE(SUM(amount), 0) FROM withdrawal_queue WHERE status IN ('queued', 'sending', 'batched', 'processing')",
+		model.LedgerAccountWithdrawalApproval: "SELECT COALESCE(SUM(amount), 0) FROM withdrawal_requests WHERE status IN ('pending_approval', 'sending')",
+	}
+	balanced := math.Abs(report.Total) <= ledgerTolerance
+	report.Total = money.Round(report.Total)
+	for i, a := range report.Accounts {
+		query, ok := held[a.Account]
+		if !ok {
+			continue
+		}
+		var expected float64
+		if err := d.db.QueryRow(query).Scan(&expected); err != nil {
+			return nil, err
+		}
+		report.Accounts[i].Expected = &expected
+		if math.Abs(a.Balance-expected) > ledgerTolerance {
+			balanced = false
+		}
+	}
+
+	// Users whose balance differs from their account, including accounts of deleted users
+	rows, err = d.db.Query(`
+		SELECT u.id, u.balance, COALESCE(SUM(e.credit - e.debit), 0) AS ledger_balance
+		FROM users u
+		LEFT JOIN ledger_entries e ON e.account = ? AND e.user_id = u.id
+		GROUP BY u.id
+		HAVING ABS(u.balance - ledger_balance) > ?
+		UNION ALL
+		SELECT e.user_id, 0, SUM(e.credit - e.debit) AS ledger_balance
+		FROM ledger_entries e
+		WHERE e.account = ? AND NOT EXISTS (SELECT 1 FROM users WHERE id = e.user_id)
+		GROUP BY e.user_id
+		HAVING ABS(ledger_balance) > ?
+		ORDER BY 1`,
+		model.LedgerAccountUser, ledgerTolerance, model.LedgerAccountUser, ledgerTolerance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m model.LedgerMismatch
+		if err := rows.Scan(&m.UserID, &m.Balance, &m.LedgerBalance); err != nil {
+			return nil, err
+		}
+		m.LedgerBalance = money.Round(m.LedgerBalance)
+		m.Difference = money.Round(m.Balance - m.LedgerBalance)
+		report.Mismatches = append(report.Mismatches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Balanced = balanced && len(report.Mismatches) == 0
+	return report, nil
+}
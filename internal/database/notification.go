@@ -0,0 +1,206 @@
+package database
+
+import (
+	"strings"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// AddNotification stores a notification for a user
+func (d *Database) AddNotification(n *model.Notification) error {
+	if n.CreatedAt == 0 {
+		n.CreatedAt = time.Now().Unix()
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO notifications (user_id, kind, title, body, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		n.UserID, n.Kind, n.Title, n.Body, n.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	n.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetNotifications returns a page of the notifications of a user, newest first,
+// optionally only the unread ones
+func (d *Database) GetNotifications(userID int, unreadOnly bool, page pagination.Params) (*model.NotificationInbox, error) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if unreadOnly {
+		conditions = append(conditions, "read_at IS NULL")
+	}
+	// Ids grow with creation time, so the id alone orders the notifications
+	if cond, condArgs := page.WhereID("id"); cond != "" {
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, user_id, kind, title, body, created_at, read_at
+		FROM notifications
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY id DESC
+		LIMIT ?`, append(args, page.FetchLimit())...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]model.Notification, 0)
+	for rows.Next() {
+		var n model.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	unread, err := d.CountUnreadNotifications(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications, next := pagination.Trim(notifications, page, func(n model.Notification) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+	})
+
+	return &model.NotificationInbox{
+		Notifications: notifications,
+		Unread:        unread,
+		PageSize:      page.Limit,
+		NextCursor:    next,
+	}, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications of a user
+func (d *Database) CountUnreadNotifications(userID int) (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationsRead marks unread notifications of a user as read, all of them if
+// ids is empty. Ids of other users' notifications are ignored. Returns how many were marked.
+func (d *Database) MarkNotificationsRead(userID int, ids []int64) (int, error) {
+	query := "UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL"
+	args := []interface{}{time.Now().Unix(), userID}
+	if len(ids) > 0 {
+		query += " AND id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := d.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// GetUndispatchedNotifications returns the oldest notifications not yet handled by the
+// delivery dispatcher
+func (d *Database) GetUndispatchedNotifications(limit int) ([]model.Notification, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, kind, title, body, created_at, read_at
+		FROM notifications
+		WHERE dispatched_at IS NULL
+		ORDER BY id
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]model.Notification, 0)
+	for rows.Next() {
+		var n model.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkNotificationsDispatched marks notifications as handled by the delivery dispatcher,
+// whether they were delivered or not
+func (d *Database) MarkNotificationsDispatched(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []interface{}{time.Now().Unix()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	_, err := d.db.Exec("UPDATE notifications SET dispatched_at = ? WHERE id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", args...)
+	return err
+}
+
+// SetTelegramChat binds the Telegram chat notifications of a user are sent to
+func (d *Database) SetTelegramChat(userID int, chatID int64) error {
+	_, err := d.db.Exec(`
+		INSERT INTO telegram_chats (user_id, chat_id, bound_at) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET chat_id = excluded.chat_id, bound_at = excluded.bound_at`,
+		userID, chatID, time.Now().Unix())
+	return err
+}
+
+// GetTelegramChat returns the Telegram chat bound to a user, sql.ErrNoRows without one
+func (d *Database) GetTelegramChat(userID int) (int64, error) {
+	var chatID int64
+	err := d.db.QueryRow("SELECT chat_id FROM telegram_chats WHERE user_id = ?", userID).Scan(&chatID)
+	return chatID, err
+}
+
+// DeleteTelegramChat unbinds the Telegram chat of a user
+func (d *Database) DeleteTelegramChat(userID int) error {
+	_, err := d.db.Exec("DELETE FROM telegram_chats WHERE user_id = ?", userID)
+	return err
+}
+
+// GetNotificationOptOuts returns the notification kinds a user opted out of, sorted
+func (d *Database) GetNotificationOptOuts(userID int) ([]string, error) {
+	rows, err := d.db.Query("SELECT kind FROM notification_opt_outs WHERE user_id = ? ORDER BY kind", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kinds := make([]string, 0)
+	for rows.Next() {
+		var kind string
+		if err := rows.Scan(&kind); err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, rows.Err()
+}
+
+// SetNotificationOptOuts replaces the notification kinds a user opted out of
+func (d *Database) SetNotificationOptOuts(userID int, kinds []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM notification_opt_outs WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO notification_opt_outs (user_id, kind) VALUES (?, ?)", userID, kind); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreatePartner stores a partner application waiting for admin approval
+func (d *Database) CreatePartner(name, contact, useCase string) (*model.Partner, error) {
+	result, err := d.db.Exec(`
+		INSERT INTO partners (name, contact, use_case, status, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		name, contact, useCase, model.PartnerStatusPending, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return d.GetPartner(id)
+}
+
+// GetPartner returns a partner by ID
+func (d *Database) GetPartner(id int64) (*model.Partner, error) {
+	return scanPartner(d.db.QueryRow(`
+		SELECT id, name, contact, use_case, status, tier, token_prefix, created_at, reviewed_at, last_used_at
+		FROM partners WHERE id = ?`, id))
+}
+
+// GetPartners lists the partners with the given status, newest first; an empty status
+// returns every partner
+func (d *Database) GetPartners(status string) ([]model.Partner, error) {
+	query := "SELECT id FROM partners"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	rows, err := d.db.Query(query+" ORDER BY id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	partners := make([]model.Partner, 0, len(ids))
+	for _, id := range ids {
+		p, err := d.GetPartner(id)
+		if err != nil {
+			return nil, err
+		}
+		partners = append(partners, *p)
+	}
+	return partners, nil
+}
+
+// GetPartnerByTokenHash returns an approved partner by the hash of its token and
+// updates its last usage time
+func (d *Database) GetPartnerByTokenHash(tokenHash string) (*model.Partner, error) {
+	p, err := scanPartner(d.db.QueryRow(`
+		SELECT id, name, contact, use_case, status, tier, token_prefix, created_at, reviewed_at, last_used_at
+		FROM partners WHERE token_hash = ? AND status = ?`, tokenHash, model.PartnerStatusApproved))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.db.Exec("UPDATE partners SET last_used_at = ? WHERE id = ?", time.Now().Unix(), p.ID); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ApprovePartner approves a pending partner, or updates an approved one, with a tier
+// and a new token replacing the previous one
+func (d *Database) ApprovePartner(id int64, tier, tokenPrefix, tokenHash string) error {
+	result, err := d.db.Exec(`
+		UPDATE partners SET status = ?, tier = ?, token_prefix = ?, token_hash = ?, reviewed_at = ?
+		WHERE id = ? AND status IN (?, ?)`,
+		model.PartnerStatusApproved, tier, tokenPrefix, tokenHash, time.Now().Unix(),
+		id, model.PartnerStatusPending, model.PartnerStatusApproved)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("partner %d can't be approved", id)
+	}
+	return nil
+}
+
+// RevokePartner rejects a pending partner or revokes the token of an approved one
+func (d *Database) RevokePartner(id int64) error {
+	result, err := d.db.Exec(`
+		UPDATE partners SET status = ?, token_hash = NULL, reviewed_at = ?
+		WHERE id = ? AND status IN (?, ?)`,
+		model.PartnerStatusRevoked, time.Now().Unix(),
+		id, model.PartnerStatusPending, model.PartnerStatusApproved)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("partner %d is already revoked", id)
+	}
+	return nil
+}
+
+func scanPartner(row *sql.Row) (*model.Partner, error) {
+	var p model.Partner
+	var reviewedAt, lastUsedAt sql.NullInt64
+	err := row.Scan(&p.ID, &p.Name, &p.Contact, &p.UseCase, &p.Status, &p.Tier, &p.TokenPrefix,
+		&p.CreatedAt, &reviewedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if reviewedAt.Valid {
+		p.ReviewedAt = &reviewedAt.Int64
+	}
+	if lastUsedAt.Valid {
+		p.LastUsedAt = &lastUsedAt.Int64
+	}
+	return &p, nil
+}
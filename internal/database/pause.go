@@ -0,0 +1,49 @@
+package database
+
+import (
+	"time"
+	"tonapp/internal/model"
+)
+
+// SetInvestmentPause stores incident switches for a scope.
+// A scope with both switches off is removed.
+func (d *Database) SetInvestmentPause(scope string, pauseInvestments, pauseAccrual bool, reason string) error {
+	if !pauseInvestments && !pauseAccrual {
+		_, err := d.db.Exec("DELETE FROM investment_pauses WHERE scope = ?", scope)
+		return err
+	}
+
+	_, err := d.db.Exec(`
+		INSERT INTO investment_pauses (scope, pause_investments, pause_accrual, reason, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(scope) DO UPDATE SET
+			pause_investments = excluded.pause_investments,
+			pause_accrual = excluded.pause_accrual,
+			reason = excluded.reason,
+			updated_at = excluded.updated_at`,
+		scope, pauseInvestments, pauseAccrual, reason, time.Now().Unix())
+	return err
+}
+
+// GetInvestmentPauses returns all active incident switches
+func (d *Database) GetInvestmentPauses() ([]model.InvestmentPause, error) {
+	rows, err := d.db.Query(`
+		SELECT scope, pause_investments, pause_accrual, reason, updated_at
+		FROM investment_pauses
+		ORDER BY scope`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pauses := make([]model.InvestmentPause, 0)
+	for rows.Next() {
+		var p model.InvestmentPause
+		if err := rows.Scan(&p.Scope, &p.PauseInvestments, &p.PauseAccrual, &p.Reason, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		pauses = append(pauses, p)
+	}
+
+	return pauses, rows.Err()
+}
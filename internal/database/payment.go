@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreatePayment stores a pending provider top-up
+func (d *Database) CreatePayment(userID int, provider string, amount float64) (*model.Payment, error) {
+	now := time.Now().Unix()
+	result, err := d.db.Exec(`
+		INSERT INTO payments (user_id, provider, amount, status, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, provider, amount, model.PaymentStatusPending, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Payment{
+		ID:        id,
+		UserID:    userID,
+		Provider:  provider,
+		Amount:    amount,
+		Status:    model.PaymentStatusPending,
+		CreatedAt: now,
+	}, nil
+}
+
+// SetPaymentQuote stores the amount the provider will charge for a payment
+func (d *Database) SetPaymentQuote(id int64, providerAmount int64, currency string) error {
+	_, err := d.db.Exec("UPDATE payments SET provider_amount = ?, currency = ? WHERE id = ?",
+		providerAmount, currency, id)
+	return err
+}
+
+// CompletePayment credits a provider-confirmed payment to the user balance.
+// Repeated webhooks for the same payment are no-ops; completed reports whether
+// this call credited the balance.
+func (d *Database) CompletePayment(id int64, provider string, externalID string, providerAmount int64, currency string) (completed bool, err error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var p model.Payment
+	err = tx.QueryRow(`
+		SELECT id, user_id, provider, amount, provider_amount, currency, status
+		FROM payments WHERE id = ?`, id).
+		Scan(&p.ID, &p.UserID, &p.Provider, &p.Amount, &p.ProviderAmount, &p.Currency, &p.Status)
+	if err == sql.ErrNoRows {
+		return false, fmt.Errorf("payment not found")
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if p.Provider != provider {
+		return false, fmt.Errorf("payment belongs to another provider")
+	}
+	if p.Status != model.PaymentStatusPending {
+		return false, nil
+	}
+	if currency != p.Currency || providerAmount < p.ProviderAmount {
+		return false, fmt.Errorf("paid %d %s, expected %d %s", providerAmount, currency, p.ProviderAmount, p.Currency)
+	}
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(`
+		UPDATE payments SET status = ?, external_id = ?, completed_at = ?
+		WHERE id = ? AND status = ?`,
+		model.PaymentStatusCompleted, externalID, now, p.ID, model.PaymentStatusPending)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindPayment,
+		Reference: fmt.Sprintf("payment:%d", p.ID),
+		From:      systemAccount(model.LedgerAccountPayments),
+		To:        userAccount(p.UserID),
+		Amount:    p.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = insertOperation(tx, &model.Operation{
+		UserID:      p.UserID,
+		Type:        model.OperationTypeDeposit,
+		Amount:      p.Amount,
+		Description: fmt.Sprintf("Deposit via %s", provider),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"payment_id":      p.ID,
+			"provider":        provider,
+			"external_id":     externalID,
+			"provider_amount": providerAmount,
+			"currency":        currency,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// paymentColumns are the columns scanned by scanPayment
+const paymentColumns = `id, user_id, provider, amount, provider_amount, currency, status, COALESCE(external_id, ''), error, created_at, completed_at`
+
+func scanPayment(row interface{ Scan(...interface{}) error }) (*model.Payment, error) {
+	var p model.Payment
+	var completedAt sql.NullInt64
+	err := row.Scan(&p.ID, &p.UserID, &p.Provider, &p.Amount, &p.ProviderAmount, &p.Currency, &p.Status,
+		&p.ExternalID, &p.Error, &p.CreatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		p.CompletedAt = &completedAt.Int64
+	}
+	return &p, nil
+}
+
+// GetPayment returns a payment by ID, sql.ErrNoRows if it doesn't exist
+func (d *Database) GetPayment(id int64) (*model.Payment, error) {
+	return scanPayment(d.db.QueryRow("SELECT "+paymentColumns+" FROM payments WHERE id = ?", id))
+}
+
+// EscalatePayment puts a pending payment the provider charged but that couldn't be
+// credited under review, with the charge and the reason. Returns false if the payment
+// doesn't exist, belongs to another provider or isn't pending.
+func (d *Database) EscalatePayment(id int64, provider string, externalID string, reason string) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE payments SET status = ?, external_id = ?, error = ?
+		WHERE id = ? AND provider = ? AND status = ?`,
+		model.PaymentStatusReview, externalID, reason, id, provider, model.PaymentStatusPending)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// GetEscalatedPayments returns the payments under review, oldest first
+func (d *Database) GetEscalatedPayments() ([]model.Payment, error) {
+	rows, err := d.db.Query("SELECT "+paymentColumns+" FROM payments WHERE status = ? ORDER BY id", model.PaymentStatusReview)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]model.Payment, 0)
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *p)
+	}
+	return payments, rows.Err()
+}
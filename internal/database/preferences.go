@@ -0,0 +1,35 @@
+package database
+
+import (
+	"database/sql"
+	"tonapp/internal/model"
+)
+
+// preferencesOrDefault builds user preferences from nullable columns
+func preferencesOrDefault(fiatCurrency, numberFormat, language sql.NullString) model.UserPreferences {
+	prefs := model.DefaultPreferences
+	if fiatCurrency.Valid && fiatCurrency.String != "" {
+		prefs.FiatCurrency = fiatCurrency.String
+	}
+	if numberFormat.Valid && numberFormat.String != "" {
+		prefs.NumberFormat = numberFormat.String
+	}
+	if language.Valid && language.String != "" {
+		prefs.Language = language.String
+	}
+	return prefs
+}
+
+// UpdateUserProfile updates profile fields and display preferences; nil fields are kept
+func (d *Database) UpdateUserProfile(userID int, req model.UpdateProfileRequest) error {
+	_, err := d.db.Exec(`
+		UPDATE users SET
+			name = COALESCE(?, name),
+			photo = COALESCE(?, photo),
+			fiat_currency = COALESCE(?, fiat_currency),
+			number_format = COALESCE(?, number_format),
+			language = COALESCE(?, language)
+		WHERE id = ?`,
+		req.Name, req.Photo, req.FiatCurrency, req.NumberFormat, req.Language, userID)
+	return err
+}
@@ -0,0 +1,371 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/tracing"
+)
+
+// QueryLogConfig enables the query logging driver wrapper
+type QueryLogConfig struct {
+	LogAll        bool          // log every query with its duration
+	SlowThreshold time.Duration // flag queries taking longer; 0 disables slow query detection
+	Trace         bool          // record spans of queries made under a traced context
+}
+
+// Enabled reports whether queries need to be wrapped at all
+func (c QueryLogConfig) Enabled() bool {
+	return c.LogAll || c.SlowThreshold > 0 || c.Trace
+}
+
+// queryLog times queries and aggregates them per call site
+type queryLog struct {
+	config QueryLogConfig
+	since  time.Time
+
+	mu    sync.Mutex
+	sites map[string]*model.QuerySiteStat
+}
+
+func newQueryLog(config QueryLogConfig) *queryLog {
+	return &queryLog{
+		config: config,
+		since:  time.Now(),
+		sites:  make(map[string]*model.QuerySiteStat),
+	}
+}
+
+// querySite returns file:line of the first caller outside database/sql and this wrapper
+func querySite() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "database/sql.") &&
+			!strings.Contains(frame.Function, "internal/database.(*logged") &&
+			!strings.Contains(frame.Function, "internal/database.(*queryLog)") {
+			return fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+func (l *queryLog) record(site, query string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	ms := float64(elapsed.Microseconds()) / 1000.0
+	slow := l.config.SlowThreshold > 0 && elapsed >= l.config.SlowThreshold
+	query = strings.Join(strings.Fields(query), " ")
+
+	if slow {
+		slog.Warn("Slow query", "duration_ms", ms, "site", site, "query", query)
+	} else if l.config.LogAll {
+		slog.Info("Query", "duration_ms", ms, "site", site, "query", query)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := site + "|" + query
+	stat, ok := l.sites[key]
+	if !ok {
+		stat = &model.QuerySiteStat{Site: site, Query: query}
+		l.sites[key] = stat
+	}
+	stat.Count++
+	stat.TotalMs += ms
+	if ms > stat.MaxMs {
+		stat.MaxMs = ms
+	}
+	if slow {
+		stat.Slow++
+	}
+	if err != nil && err != driver.ErrSkip {
+		stat.Errors++
+	}
+}
+
+// startSpan starts the span of a query, if tracing is on and ctx is part of a trace
+func (l *queryLog) startSpan(ctx context.Context, query string) *tracing.Span {
+	if !l.config.Trace {
+		return nil
+	}
+	query = strings.Join(strings.Fields(query), " ")
+	operation, _, _ := strings.Cut(query, " ")
+	_, span := tracing.StartChild(ctx, "sqlite "+strings.ToUpper(operation), tracing.KindClient)
+	span.SetAttr("db.system", "sqlite")
+	span.SetAttr("db.statement", query)
+	return span
+}
+
+func endSpan(span *tracing.Span, err error) {
+	if err != driver.ErrSkip {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func (l *queryLog) stats() *model.QueryStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := &model.QueryStats{
+		SlowThresholdMs: l.config.SlowThreshold.Milliseconds(),
+		Since:           l.since.Unix(),
+		Sites:           make([]model.QuerySiteStat, 0, len(l.sites)),
+	}
+	for _, stat := range l.sites {
+		s := *stat
+		s.AvgMs = s.TotalMs / float64(s.Count)
+		stats.Sites = append(stats.Sites, s)
+	}
+	// Most expensive sites first, these are the candidates for indexing
+	sort.Slice(stats.Sites, func(i, j int) bool { return stats.Sites[i].TotalMs > stats.Sites[j].TotalMs })
+	return stats
+}
+
+// contextConn is a driver connection supporting the context aware interfaces
+// database/sql prefers, which the wrapper needs to time queries
+type contextConn interface {
+	driver.Conn
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.Pinger
+	driver.ExecerContext
+	driver.QueryerContext
+}
+
+type contextStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+// loggedConnector opens driver connections wrapped with the query log
+type loggedConnector struct {
+	dsn    string
+	driver driver.Driver
+	log    *queryLog
+}
+
+func (c *loggedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	cc, ok := conn.(contextConn)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("query logging isn't supported by the %T driver", c.driver)
+	}
+	return &loggedConn{conn: cc, log: c.log}, nil
+}
+
+func (c *loggedConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type loggedConn struct {
+	conn contextConn
+	log  *queryLog
+	// txCtx is the context the running transaction was begun with. database/sql runs the
+	// statements of a transaction started with a context under context.Background().
+	txCtx context.Context
+}
+
+// queryContext returns the context of a statement, the one of its transaction if the
+// statement itself wasn't given one
+func (c *loggedConn) queryContext(ctx context.Context) context.Context {
+	if ctx == context.Background() && c.txCtx != nil {
+		return c.txCtx
+	}
+	return ctx
+}
+
+func (c *loggedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *loggedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	cs, ok := stmt.(contextStmt)
+	if !ok {
+		stmt.Close()
+		return nil, fmt.Errorf("query logging isn't supported by %T statements", stmt)
+	}
+	return &loggedStmt{stmt: cs, query: query, log: c.log, conn: c, ctx: c.queryContext(ctx)}, nil
+}
+
+func (c *loggedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *loggedConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *loggedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.conn.BeginTx(ctx, opts)
+	if err != nil || !c.log.config.Trace {
+		return tx, err
+	}
+	ctx, span := tracing.StartChild(ctx, "sqlite transaction", tracing.KindClient)
+	span.SetAttr("db.system", "sqlite")
+	c.txCtx = ctx
+	return &loggedTx{Tx: tx, conn: c, span: span}, nil
+}
+
+func (c *loggedConn) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
+
+func (c *loggedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	site, start := querySite(), time.Now()
+	span := c.log.startSpan(c.queryContext(ctx), query)
+	result, err := c.conn.ExecContext(ctx, query, args)
+	endSpan(span, err)
+	c.log.record(site, query, start, err)
+	return result, err
+}
+
+func (c *loggedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	site, start := querySite(), time.Now()
+	span := c.log.startSpan(c.queryContext(ctx), query)
+	rows, err := c.conn.QueryContext(ctx, query, args)
+	if err != nil {
+		endSpan(span, err)
+		c.log.record(site, query, start, err)
+		return nil, err
+	}
+	return &loggedRows{Rows: rows, site: site, query: query, start: start, log: c.log, span: span}, nil
+}
+
+// loggedTx ends the span of a transaction
+type loggedTx struct {
+	driver.Tx
+	conn *loggedConn
+	span *tracing.Span
+}
+
+func (t *loggedTx) Commit() error {
+	err := t.Tx.Commit()
+	t.end(err)
+	return err
+}
+
+func (t *loggedTx) Rollback() error {
+	err := t.Tx.Rollback()
+	t.span.SetAttr("db.rollback", true)
+	t.end(err)
+	return err
+}
+
+func (t *loggedTx) end(err error) {
+	t.conn.txCtx = nil
+	endSpan(t.span, err)
+}
+
+type loggedStmt struct {
+	stmt  contextStmt
+	query string
+	log   *queryLog
+	conn  *loggedConn
+	ctx   context.Context // context the statement was prepared with
+}
+
+// queryContext returns the context of an execution of the statement, falling back to
+// the transaction's and then the one it was prepared with
+func (s *loggedStmt) queryContext(ctx context.Context) context.Context {
+	if ctx = s.conn.queryContext(ctx); ctx == context.Background() {
+		return s.ctx
+	}
+	return ctx
+}
+
+func (s *loggedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *loggedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *loggedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.stmt.Exec(args)
+}
+
+func (s *loggedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.stmt.Query(args)
+}
+
+func (s *loggedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	site, start := querySite(), time.Now()
+	span := s.log.startSpan(s.queryContext(ctx), s.query)
+	result, err := s.stmt.ExecContext(ctx, args)
+	endSpan(span, err)
+	s.log.record(site, s.query, start, err)
+	return result, err
+}
+
+func (s *loggedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	site, start := querySite(), time.Now()
+	span := s.log.startSpan(s.queryContext(ctx), s.query)
+	rows, err := s.stmt.QueryContext(ctx, args)
+	if err != nil {
+		endSpan(span, err)
+		s.log.record(site, s.query, start, err)
+		return nil, err
+	}
+	return &loggedRows{Rows: rows, site: site, query: s.query, start: start, log: s.log, span: span}, nil
+}
+
+// loggedRows records the query once the rows are closed, since sqlite
+// executes the statement step by step while rows are read
+type loggedRows struct {
+	driver.Rows
+	site  string
+	query string
+	start time.Time
+	log   *queryLog
+	span  *tracing.Span
+	err   error
+}
+
+func (r *loggedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *loggedRows) Close() error {
+	err := r.Rows.Close()
+	endSpan(r.span, r.err)
+	r.log.record(r.site, r.query, r.start, r.err)
+	return err
+}
+
+// QueryStats returns per call site query statistics, nil if query logging is disabled
+func (d *Database) QueryStats() *model.QueryStats {
+	if d.queryLog == nil {
+		return nil
+	}
+	return d.queryLog.stats()
+}
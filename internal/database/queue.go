@@ -0,0 +1,388 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// EnqueueWithdrawal reserves the amount from the user balance and puts the withdrawal in the liquidity queue
+func (d *Database) EnqueueWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error) {
+	return d.enqueueWithdrawal(userID, amount, destination, caps, model.QueueStatusQueued)
+}
+
+// ProcessWithdrawal reserves the amount from the user balance and hands the withdrawal
+// to the withdrawal worker, which sends it right away
+func (d *Database) ProcessWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error) {
+	return d.enqueueWithdrawal(userID, amount, destination, caps, model.QueueStatusProcessing)
+}
+
+// BatchWithdrawal reserves the amount from the user balance and puts the withdrawal in
+// the queue until the next batch transfer
+func (d *Database) BatchWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error) {
+	return d.enqueueWithdrawal(userID, amount, destination, caps, model.QueueStatusBatched)
+}
+
+func (d *Database) enqueueWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps, status string) (*model.QueuedWithdrawal, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	result, err := tx.Exec(`
+		INSERT INTO withdrawal_queue (user_id, amount, status, created_at, destination)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, amount, status, now, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWithdrawalCaps(tx, userID, caps); err != nil {
+		return nil, err
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalQueued,
+		Reference: fmt.Sprintf("withdrawal_queue:%d", id),
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountWithdrawalQueue),
+		Amount:    amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return d.GetQueuedWithdrawal(id)
+}
+
+// GetQueuedWithdrawal returns a queue entry with its current position among queued entries
+func (d *Database) GetQueuedWithdrawal(id int64) (*model.QueuedWithdrawal, error) {
+	var w model.QueuedWithdrawal
+	var txHash, errMsg sql.NullString
+	var processedAt, lastAttemptAt sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT q.id, q.user_id, u.pub_key, q.amount, q.status, q.tx_hash, q.error, q.created_at, q.processed_at, q.treasury_wallet, q.destination,
+			q.attempts, q.last_attempt_at, q.next_attempt_at,
+			CASE WHEN q.status = 'queued'
+				THEN (SELECT COUNT(*) FROM withdrawal_queue WHERE status = 'queued' AND id <= q.id)
+				ELSE 0 END
+		FROM withdrawal_queue q
+		JOIN users u ON u.id = q.user_id
+		WHERE q.id = ?`, id).
+		Scan(&w.ID, &w.UserID, &w.PubKey, &w.Amount, &w.Status, &txHash, &errMsg, &w.CreatedAt, &processedAt, &w.TreasuryWallet, &w.Destination,
+			&w.Attempts, &lastAttemptAt, &w.NextAttemptAt, &w.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	w.TxHash = txHash.String
+	w.Error = errMsg.String
+	w.LastAttemptAt = lastAttemptAt.Int64
+	if processedAt.Valid {
+		w.ProcessedAt = &processedAt.Int64
+	}
+
+	return &w, nil
+}
+
+// GetUserQueuedWithdrawals returns the user's queue entries with positions, newest first
+func (d *Database) GetUserQueuedWithdrawals(userID int) ([]model.QueuedWithdrawal, error) {
+	rows, err := d.db.Query("SELECT id FROM withdrawal_queue WHERE user_id = ? ORDER BY id DESC LIMIT 50", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	entries := make([]model.QueuedWithdrawal, 0, len(ids))
+	for _, id := range ids {
+		w, err := d.GetQueuedWithdrawal(id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *w)
+	}
+
+	return entries, nil
+}
+
+// GetNextQueuedWithdrawals returns the oldest queued entries in processing order, without
+// those waiting to retry a failed transfer or of frozen accounts
+func (d *Database) GetNextQueuedWithdrawals(limit int) ([]model.QueuedWithdrawal, error) {
+	return d.getQueueEntries(model.QueueStatusQueued, limit)
+}
+
+// GetProcessingWithdrawals returns the oldest withdrawals waiting for the withdrawal
+// worker, without those waiting to retry a failed transfer or of frozen accounts
+func (d *Database) GetProcessingWithdrawals(limit int) ([]model.QueuedWithdrawal, error) {
+	return d.getQueueEntries(model.QueueStatusProcessing, limit)
+}
+
+// GetBatchedWithdrawals returns the oldest entries waiting for the next batch transfer,
+// without those waiting to retry a failed transfer or of frozen accounts
+func (d *Database) GetBatchedWithdrawals(limit int) ([]model.QueuedWithdrawal, error) {
+	return d.getQueueEntries(model.QueueStatusBatched, limit)
+}
+
+// getQueueEntries leaves out the entries of frozen accounts in the query, so however many
+// of them wait they don't fill the limit and hold up those of other users
+func (d *Database) getQueueEntries(status string, limit int) ([]model.QueuedWithdrawal, error) {
+	rows, err := d.db.Query(`
+		SELECT q.id, q.user_id, u.pub_key, q.amount, q.status, q.created_at, q.destination, q.attempts
+		FROM withdrawal_queue q
+		JOIN users u ON u.id = q.user_id
+		WHERE q.status = ? AND q.next_attempt_at <= ? AND u.frozen_at IS NULL
+		ORDER BY q.id ASC
+		LIMIT ?`, status, time.Now().Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []model.QueuedWithdrawal
+	for rows.Next() {
+		var w model.QueuedWithdrawal
+		if err := rows.Scan(&w.ID, &w.UserID, &w.PubKey, &w.Amount, &w.Status, &w.CreatedAt, &w.Destination, &w.Attempts); err != nil {
+			return nil, err
+		}
+		entries = append(entries, w)
+	}
+
+	return entries, rows.Err()
+}
+
+// CountQueuedWithdrawals returns the number of withdrawals waiting for liquidity
+func (d *Database) CountQueuedWithdrawals() (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM withdrawal_queue WHERE status = ?", model.QueueStatusQueued).Scan(&count)
+	return count, err
+}
+
+// CountBatchedWithdrawals returns the number of withdrawals waiting for the next batch transfer
+func (d *Database) CountBatchedWithdrawals() (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM withdrawal_queue WHERE status = ?", model.QueueStatusBatched).Scan(&count)
+	return count, err
+}
+
+// SetQueuedWithdrawalStatus moves an entry from one status to another, failing if it was changed concurrently
+func (d *Database) SetQueuedWithdrawalStatus(id int64, from, to string) error {
+	result, err := d.db.Exec("UPDATE withdrawal_queue SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, from)
+	}
+	return nil
+}
+
+// StartQueuedWithdrawalAttempt moves an entry from a status to sending from a wallet and
+// counts the attempt, failing if it was changed concurrently
+func (d *Database) StartQueuedWithdrawalAttempt(id int64, from string, wallet string) error {
+	result, err := d.db.Exec(`
+		UPDATE withdrawal_queue SET status = ?, attempts = attempts + 1, last_attempt_at = ?, treasury_wallet = ?
+		WHERE id = ? AND status = ?`,
+		model.QueueStatusSending, time.Now().Unix(), wallet, id, from)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, from)
+	}
+	return nil
+}
+
+// RetryQueuedWithdrawal moves an entry whose transfer failed from sending back to a
+// status, where it waits until nextAttemptAt
+func (d *Database) RetryQueuedWithdrawal(id int64, to, reason string, nextAttemptAt int64) error {
+	result, err := d.db.Exec(`
+		UPDATE withdrawal_queue SET status = ?, error = ?, next_attempt_at = ?
+		WHERE id = ? AND status = ?`,
+		to, reason, nextAttemptAt, id, model.QueueStatusSending)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, model.QueueStatusSending)
+	}
+	return nil
+}
+
+// RecordQueuedWithdrawalError records why the transfer of an entry being sent is
+// unconfirmed, keeping it sending
+func (d *Database) RecordQueuedWithdrawalError(id int64, reason string) error {
+	result, err := d.db.Exec("UPDATE withdrawal_queue SET error = ? WHERE id = ? AND status = ?",
+		reason, id, model.QueueStatusSending)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, model.QueueStatusSending)
+	}
+	return nil
+}
+
+// GetAttemptedWithdrawals returns the open entries being sent or waiting to retry a
+// failed transfer, oldest first
+func (d *Database) GetAttemptedWithdrawals() ([]model.QueuedWithdrawal, error) {
+	rows, err := d.db.Query(`
+		SELECT id FROM withdrawal_queue
+		WHERE status = ? OR (status IN (?, ?, ?) AND attempts > 0)
+		ORDER BY id ASC`,
+		model.QueueStatusSending, model.QueueStatusQueued, model.QueueStatusBatched, model.QueueStatusProcessing)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	entries := make([]model.QueuedWithdrawal, 0, len(ids))
+	for _, id := range ids {
+		w, err := d.GetQueuedWithdrawal(id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *w)
+	}
+	return entries, nil
+}
+
+// CompleteQueuedWithdrawal marks an entry as sent and records the withdrawal operation. A
+// closed account is anonymized with its last payout.
+func (d *Database) CompleteQueuedWithdrawal(w model.QueuedWithdrawal, txHash string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	_, err = tx.Exec("UPDATE withdrawal_queue SET status = ?, tx_hash = ?, error = NULL, processed_at = ?, treasury_wallet = ? WHERE id = ?",
+		model.QueueStatusSent, txHash, now, w.TreasuryWallet, w.ID)
+	if err != nil {
+		return err
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalSent,
+		Reference: txHash,
+		From:      systemAccount(model.LedgerAccountWithdrawalQueue),
+		To:        systemAccount(model.LedgerAccountExternal),
+		Amount:    w.Amount,
+		Wallet:    w.TreasuryWallet,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	extra := withdrawalExtra(txHash, w.Destination)
+	extra["queue_id"] = w.ID
+	extraJSON, err := json.Marshal(extra)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO operations (user_id, type, amount, description, created_at, extra)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		w.UserID, model.OperationTypeWithdrawal, w.Amount,
+		fmt.Sprintf("Withdrawal of %s TON", money.Format(w.Amount)), now, extraJSON)
+	if err != nil {
+		return err
+	}
+
+	// The closure payout of an account is its last withdrawal
+	if err := anonymizeClosedAccount(tx, w.UserID, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FailQueuedWithdrawal marks an entry as failed and returns the reserved funds to the user
+func (d *Database) FailQueuedWithdrawal(w model.QueuedWithdrawal, reason string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE withdrawal_queue SET status = ?, error = ?, processed_at = ?
+		WHERE id = ? AND status IN (?, ?, ?, ?)`,
+		model.QueueStatusFailed, reason, time.Now().Unix(), w.ID,
+		model.QueueStatusQueued, model.QueueStatusSending, model.QueueStatusBatched, model.QueueStatusProcessing)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("queued withdrawal %d can't be failed", w.ID)
+	}
+
+	err = postTransfer(tx, ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalFailed,
+		Reference: fmt.Sprintf("withdrawal_queue:%d", w.ID),
+		From:      systemAccount(model.LedgerAccountWithdrawalQueue),
+		To:        userAccount(w.UserID),
+		Amount:    w.Amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
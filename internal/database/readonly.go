@@ -0,0 +1,21 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckWritable writes to the database to find out whether it still can be written.
+// It returns an error when the file is read-only, the disk full or the database corrupt
+// or unreadable. Other failures, such as a database locked by a long write, don't mean
+// writes fail for good and return nil.
+func (d *Database) CheckWritable() error {
+	_, err := d.db.Exec(`
+		INSERT INTO write_probe (id, checked_at) VALUES (1, ?)
+		ON CONFLICT(id) DO UPDATE SET checked_at = excluded.checked_at`,
+		time.Now().UnixNano())
+	if err != nil && storageFailure(err) {
+		return fmt.Errorf("database writes fail: %w", err)
+	}
+	return nil
+}
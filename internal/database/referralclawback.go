@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// ClawBackReferralEarnings reverses the referral earnings paid on the profit of a referred
+// user since the given time that weren't clawed back before. Every earning gets a linked
+// negative entry debiting the referrer, limited to the referrer's balance; what's missing
+// is reported as unrecovered. Earnings of referrers that no longer exist are skipped.
+func (d *Database) ClawBackReferralEarnings(referredID int, since int64, reason string) (*model.ReferralClawback, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT e.id, e.referrer_id, e.referred_id, e.amount, e.level, e.created_at, e.period_end, e.correction_id, e.reversal_of, e.reason
+		FROM referral_earnings e
+		WHERE e.referred_id = ? AND e.created_at >= ? AND e.amount > 0 AND e.reversal_of IS NULL
+			AND NOT EXISTS (SELECT 1 FROM referral_earnings c WHERE c.reversal_of = e.id)
+		ORDER BY e.id`,
+		referredID, since)
+	if err != nil {
+		return nil, err
+	}
+	var earnings []model.ReferralEarning
+	for rows.Next() {
+		e, err := scanReferralEarning(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		earnings = append(earnings, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	result := &model.ReferralClawback{ReferredID: referredID, Reason: reason, Since: since, Entries: make([]model.ReferralEarning, 0)}
+	for _, e := range earnings {
+		var balance float64
+		err := tx.QueryRow("SELECT balance FROM users WHERE id = ?", e.ReferrerID).Scan(&balance)
+		if err == sql.ErrNoRows {
+			result.Unrecovered += e.Amount
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		recovered := money.FloorPayout(math.Max(0, math.Min(e.Amount, balance)))
+		entry := model.ReferralEarning{
+			ReferrerID: e.ReferrerID,
+			ReferredID: e.ReferredID,
+			Level:      e.Level,
+			CreatedAt:  now,
+			ReversalOf: &e.ID,
+			Reason:     reason,
+		}
+		if recovered > 0 {
+			entry.Amount = -recovered
+		}
+		res, err := tx.Exec(`
+			INSERT INTO referral_earnings (referrer_id, referred_id, amount, level, created_at, period_end, reversal_of, reason)
+			VALUES (?, ?, ?, ?, ?, 0, ?, ?)`,
+			entry.ReferrerID, entry.ReferredID, entry.Amount, entry.Level, now, e.ID, reason)
+		if err != nil {
+			return nil, err
+		}
+		if entry.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		err = postTransfer(tx, ledgerTransfer{
+			Kind:      model.LedgerKindReferralClawback,
+			Reference: fmt.Sprintf("referral_earning:%d", entry.ID),
+			From:      userAccount(e.ReferrerID),
+			To:        systemAccount(model.LedgerAccountReferrals),
+			Amount:    recovered,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result.Entries = append(result.Entries, entry)
+		result.Recovered += recovered
+		result.Unrecovered += e.Amount - recovered
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	result.Recovered = money.Round(result.Recovered)
+	result.Unrecovered = money.Round(result.Unrecovered)
+	return result, nil
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// scanReferralEarning scans the id, referrer_id, referred_id, amount, level, created_at,
+// period_end, correction_id, reversal_of and reason columns of a referral_earnings row
+func scanReferralEarning(rows *sql.Rows) (model.ReferralEarning, error) {
+	var e model.ReferralEarning
+	var correctionID, reversalOf sql.NullInt64
+	if err := rows.Scan(&e.ID, &e.ReferrerID, &e.ReferredID, &e.Amount, &e.Level, &e.CreatedAt, &e.PeriodEnd, &correctionID, &reversalOf, &e.Reason); err != nil {
+		return e, err
+	}
+	if correctionID.Valid {
+		e.CorrectionID = &correctionID.Int64
+	}
+	if reversalOf.Valid {
+		e.ReversalOf = &reversalOf.Int64
+	}
+	return e, nil
+}
+
+// GetReferralEarningsForPeriod returns the referral earnings paid on the profit accrued in
+// [from, to): earnings of accrual periods ending in the range, earnings recorded in the
+// range before periods were tracked, and compensations of recomputation runs within it.
+// Clawbacks aren't included, they reverse earnings on purpose.
+func (d *Database) GetReferralEarningsForPeriod(from, to int64) ([]model.ReferralEarning, error) {
+	rows, err := d.db.Query(`
+		SELECT e.id, e.referrer_id, e.referred_id, e.amount, e.level, e.created_at, e.period_end, e.correction_id, e.reversal_of, e.reason
+		FROM referral_earnings e
+		LEFT JOIN referral_recomputations r ON r.id = e.correction_id
+		WHERE (e.correction_id IS NULL AND e.reversal_of IS NULL AND e.period_end > 0 AND e.period_end >= ? AND e.period_end < ?)
+			OR (e.correction_id IS NULL AND e.reversal_of IS NULL AND e.period_end = 0 AND e.created_at >= ? AND e.created_at < ?)
+			OR (r.period_from >= ? AND r.period_to <= ?)
+		ORDER BY e.id`,
+		from, to, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var earnings []model.ReferralEarning
+	for rows.Next() {
+		e, err := scanReferralEarning(rows)
+		if err != nil {
+			return nil, err
+		}
+		earnings = append(earnings, e)
+	}
+	return earnings, rows.Err()
+}
+
+// GetReferralRecomputations returns the applied recomputation runs overlapping [from, to)
+func (d *Database) GetReferralRecomputations(from, to int64) ([]model.ReferralRecomputationRun, error) {
+	rows, err := d.db.Query(`
+		SELECT id, period_from, period_to, level1_percent, level2_percent, level3_percent, compensated, created_at
+		FROM referral_recomputations
+		WHERE period_from < ? AND period_to > ?
+		ORDER BY id`,
+		to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]model.ReferralRecomputationRun, 0)
+	for rows.Next() {
+		var r model.ReferralRecomputationRun
+		err := rows.Scan(&r.ID, &r.From, &r.To, &r.ReferralConfig.Level1Percent, &r.ReferralConfig.Level2Percent,
+			&r.ReferralConfig.Level3Percent, &r.Compensated, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// ApplyReferralCorrections records the recomputation run and pays the Compensated amount of
+// every diff to its referrer as a referral earning of the run. Diffs of referrers that no
+// longer exist are skipped with a note. The run ID and the paid total are set on report.
+// It fails if an earlier run partly overlaps the period.
+func (d *Database) ApplyReferralCorrections(report *model.ReferralRecomputation) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var conflictID int64
+	err = tx.QueryRow(`
+		SELECT id FROM referral_recomputations
+		WHERE period_from < ? AND period_to > ? AND NOT (period_from >= ? AND period_to <= ?)
+		LIMIT 1`,
+		report.To, report.From, report.From, report.To).Scan(&conflictID)
+	if err == nil {
+		return fmt.Errorf("period overlaps recomputation run %d", conflictID)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	now := time.Now().Unix()
+	cfg := report.ReferralConfig
+	result, err := tx.Exec(`
+		INSERT INTO referral_recomputations (period_from, period_to, level1_percent, level2_percent, level3_percent, compensated, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?)`,
+		report.From, report.To, cfg.Level1Percent, cfg.Level2Percent, cfg.Level3Percent, now)
+	if err != nil {
+		return err
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	compensated := 0.0
+	for i := range report.Diffs {
+		diff := &report.Diffs[i]
+		if diff.Compensated <= 0 {
+			continue
+		}
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE id = ?", diff.ReferrerID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			diff.Compensated = 0
+			diff.Note = "referrer no longer exists"
+			continue
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO referral_earnings (referrer_id, referred_id, amount, level, created_at, period_end, correction_id)
+			VALUES (?, ?, ?, ?, ?, 0, ?)`,
+			diff.ReferrerID, diff.ReferredID, diff.Compensated, diff.Level, now, runID)
+		if err != nil {
+			return err
+		}
+		earningID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		err = postTransfer(tx, ledgerTransfer{
+			Kind:      model.LedgerKindReferralEarning,
+			Reference: fmt.Sprintf("referral_earning:%d", earningID),
+			From:      systemAccount(model.LedgerAccountReferrals),
+			To:        userAccount(diff.ReferrerID),
+			Amount:    diff.Compensated,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		compensated += diff.Compensated
+	}
+	compensated = money.Round(compensated)
+
+	if _, err := tx.Exec("UPDATE referral_recomputations SET compensated = ? WHERE id = ?", compensated, runID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	report.ID = runID
+	report.Compensated = compensated
+	report.Applied = true
+	report.CreatedAt = now
+	return nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"tonapp/internal/model"
+)
+
+// GetInvestmentProfitStats returns all open investments with the gross profit
+// distributed to them so far, read from investment_profit operations
+func (d *Database) GetInvestmentProfitStats() ([]model.InvestmentProfitStat, error) {
+	rows, err := d.db.Query(`
+		SELECT
+			i.id, i.user_id, i.type, i.amount, i.created_at,
+			COALESCE(SUM(COALESCE(json_extract(o.extra, '$.gross_profit'), o.amount)), 0),
+			COUNT(o.id)
+		FROM investments i
+		LEFT JOIN operations o
+			ON o.type = 'investment_profit'
+			AND o.user_id = i.user_id
+			AND json_extract(o.extra, '$.investment_id') = i.id
+		GROUP BY i.id
+		ORDER BY i.created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make([]model.InvestmentProfitStat, 0)
+	for rows.Next() {
+		var s model.InvestmentProfitStat
+		if err := rows.Scan(&s.ID, &s.UserID, &s.Type, &s.Amount, &s.CreatedAt, &s.DistributedProfit, &s.Accruals); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, rows.Err()
+}
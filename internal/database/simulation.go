@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"tonapp/internal/model"
+)
+
+// GetProfitAccrualsSince returns investment_profit operations recorded since the given time
+func (d *Database) GetProfitAccrualsSince(since int64) ([]model.ProfitAccrual, error) {
+	rows, err := d.db.Query(`
+		SELECT user_id, amount, created_at,
+			COALESCE(json_extract(extra, '$.type'), ''),
+			COALESCE(json_extract(extra, '$.gross_profit'), amount),
+			COALESCE(json_extract(extra, '$.fee'), 0),
+			COALESCE(json_extract(extra, '$.weekly_percent'), 0)
+		FROM operations
+		WHERE type = ? AND created_at >= ?
+		ORDER BY created_at`,
+		model.OperationTypeInvestmentProfit, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accruals []model.ProfitAccrual
+	for rows.Next() {
+		var a model.ProfitAccrual
+		if err := rows.Scan(&a.UserID, &a.NetProfit, &a.CreatedAt, &a.Type, &a.GrossProfit, &a.Fee, &a.WeeklyPercent); err != nil {
+			return nil, err
+		}
+		accruals = append(accruals, a)
+	}
+	return accruals, rows.Err()
+}
+
+// GetReferralEarningsSince returns referral payouts recorded since the given time
+func (d *Database) GetReferralEarningsSince(since int64) ([]model.ReferralEarningEntry, error) {
+	rows, err := d.db.Query("SELECT level, amount, created_at FROM referral_earnings WHERE created_at >= ?", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var earnings []model.ReferralEarningEntry
+	for rows.Next() {
+		var e model.ReferralEarningEntry
+		if err := rows.Scan(&e.Level, &e.Amount, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		earnings = append(earnings, e)
+	}
+	return earnings, rows.Err()
+}
+
+// GetReferrerMap returns the referrer of every user that has one, with when the
+// referrer's account was closed
+func (d *Database) GetReferrerMap() (map[int]model.Referrer, error) {
+	rows, err := d.db.Query(`
+		SELECT u.id, u.ref_id, r.closed_at FROM users u
+		LEFT JOIN users r ON r.id = u.ref_id
+		WHERE u.ref_id IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrers := make(map[int]model.Referrer)
+	for rows.Next() {
+		var id int
+		var refID, closedAt sql.NullInt64
+		if err := rows.Scan(&id, &refID, &closedAt); err != nil {
+			return nil, err
+		}
+		if !refID.Valid {
+			continue
+		}
+		r := model.Referrer{ID: int(refID.Int64)}
+		if closedAt.Valid {
+			r.ClosedAt = &closedAt.Int64
+		}
+		referrers[id] = r
+	}
+	return referrers, rows.Err()
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"time"
+	"tonapp/internal/model"
+)
+
+// TakeBalanceSnapshots stores a balance snapshot of every user for the given date (YYYY-MM-DD).
+// Existing snapshots for that date are kept, so the call is safe to repeat.
+func (d *Database) TakeBalanceSnapshots(date string) (int64, error) {
+	result, err := d.db.Exec(`
+		INSERT OR IGNORE INTO balance_snapshots (user_id, snapshot_date, balance, invested, total_earnings, created_at)
+		SELECT
+			u.id,
+			?,
+			u.balance,
+			COALESCE((SELECT SUM(amount) FROM investments WHERE user_id = u.id), 0),
+			COALESCE((SELECT SUM(amount) FROM operations WHERE user_id = u.id AND type IN ('investment_profit', 'referral_earning')), 0),
+			?
+		FROM users u`,
+		date, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetBalanceSnapshots returns snapshots of a user between two dates (inclusive), oldest first
+func (d *Database) GetBalanceSnapshots(userID int, from, to string) ([]model.BalanceSnapshot, error) {
+	rows, err := d.db.Query(`
+		SELECT user_id, snapshot_date, balance, invested, total_earnings, created_at
+		FROM balance_snapshots
+		WHERE user_id = ? AND snapshot_date >= ? AND snapshot_date <= ?
+		ORDER BY snapshot_date ASC`,
+		userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := make([]model.BalanceSnapshot, 0)
+	for rows.Next() {
+		var s model.BalanceSnapshot
+		if err := rows.Scan(&s.UserID, &s.Date, &s.Balance, &s.Invested, &s.TotalEarnings, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"time"
+	"tonapp/internal/model"
+)
+
+// AcceptTerms records that a user acknowledged a terms version; accepting twice is a no-op
+func (d *Database) AcceptTerms(userID int, investType string, version string, ip string) error {
+	_, err := d.db.Exec(`
+		INSERT OR IGNORE INTO terms_acceptances (user_id, type, version, accepted_at, ip)
+		VALUES (?, ?, ?, ?, ?)`,
+		userID, investType, version, time.Now().Unix(), ip)
+	return err
+}
+
+// HasAcceptedTerms reports whether the user accepted any terms version of an investment type
+func (d *Database) HasAcceptedTerms(userID int, investType string) (bool, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM terms_acceptances WHERE user_id = ? AND type = ?", userID, investType).Scan(&count)
+	return count > 0, err
+}
+
+// GetTermsAcceptances lists the terms versions accepted by a user
+func (d *Database) GetTermsAcceptances(userID int) ([]model.TermsAcceptance, error) {
+	rows, err := d.db.Query(`
+		SELECT type, version, accepted_at FROM terms_acceptances
+		WHERE user_id = ? ORDER BY accepted_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	acceptances := make([]model.TermsAcceptance, 0)
+	for rows.Next() {
+		var a model.TermsAcceptance
+		if err := rows.Scan(&a.Type, &a.Version, &a.AcceptedAt); err != nil {
+			return nil, err
+		}
+		acceptances = append(acceptances, a)
+	}
+	return acceptances, rows.Err()
+}
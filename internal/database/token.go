@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tonapp/internal/model"
+)
+
+// CreateAPIToken stores a new token of a user by its hash
+func (d *Database) CreateAPIToken(userID int, name, scope, prefix, tokenHash string) (*model.APIToken, error) {
+	now := time.Now().Unix()
+	result, err := d.db.Exec(`
+		INSERT INTO api_tokens (user_id, name, scope, prefix, token_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, name, scope, prefix, tokenHash, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.APIToken{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Scope:     scope,
+		Prefix:    prefix,
+		CreatedAt: now,
+	}, nil
+}
+
+// GetAPITokenByHash returns an active token by its hash and updates its last usage time
+func (d *Database) GetAPITokenByHash(tokenHash string) (*model.APIToken, error) {
+	var token model.APIToken
+	var lastUsedAt sql.NullInt64
+	err := d.db.QueryRow(`
+		SELECT id, user_id, name, scope, prefix, created_at, last_used_at
+		FROM api_tokens
+		WHERE token_hash = ? AND revoked_at IS NULL`, tokenHash).
+		Scan(&token.ID, &token.UserID, &token.Name, &token.Scope, &token.Prefix, &token.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Int64
+	}
+
+	if _, err := d.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", time.Now().Unix(), token.ID); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// GetAPITokensByUser lists all tokens of a user including revoked ones
+func (d *Database) GetAPITokensByUser(userID int) ([]model.APIToken, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, name, scope, prefix, created_at, last_used_at, revoked_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]model.APIToken, 0)
+	for rows.Next() {
+		var token model.APIToken
+		var lastUsedAt, revokedAt sql.NullInt64
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Scope, &token.Prefix, &token.CreatedAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if lastUsedAt.Valid {
+			token.LastUsedAt = &lastUsedAt.Int64
+		}
+		if revokedAt.Valid {
+			token.RevokedAt = &revokedAt.Int64
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes a token belonging to the user
+func (d *Database) RevokeAPIToken(userID int, tokenID int64) error {
+	result, err := d.db.Exec(`
+		UPDATE api_tokens SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now().Unix(), tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("token not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// GetOpenInvestments returns all open investments including their accrual cursor
+func (d *Database) GetOpenInvestments() ([]model.Investment, error) {
+	rows, err := d.db.Query(`
+		SELECT id, user_id, type, amount, created_at, last_accrued_at
+		FROM investments
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var investments []model.Investment
+	for rows.Next() {
+		var inv model.Investment
+		if err := rows.Scan(&inv.ID, &inv.UserID, &inv.Type, &inv.Amount, &inv.CreatedAt, &inv.LastAccruedAt); err != nil {
+			return nil, err
+		}
+		investments = append(investments, inv)
+	}
+
+	return investments, rows.Err()
+}
+
+// GetDepositTotals returns the sum of deposits completed since the given time
+// and the sum of deposit requests still pending
+func (d *Database) GetDepositTotals(since time.Time) (completed float64, pending float64, err error) {
+	rows, err := d.db.Query("SELECT amount, status, created_at FROM deposit_requests WHERE status IN (?, ?, ?)",
+		StatusCompleted, StatusPending, StatusProcessing)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var amount float64
+		var status string
+		var createdAt int64
+		if err := rows.Scan(&amount, &status, &createdAt); err != nil {
+			return 0, 0, err
+		}
+		switch status {
+		case StatusCompleted:
+			if createdAt >= since.Unix() {
+				completed += amount
+			}
+		case StatusPending, StatusProcessing:
+			pending += amount
+		}
+	}
+
+	return completed, pending, rows.Err()
+}
+
+// GetQueuedWithdrawalsTotal returns the sum of withdrawals waiting for liquidity, the
+// next batch or the withdrawal worker
+func (d *Database) GetQueuedWithdrawalsTotal() (float64, error) {
+	var total float64
+	err := d.db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM withdrawal_queue WHERE status IN (?, ?, ?, ?)",
+		model.QueueStatusQueued, model.QueueStatusSending, model.QueueStatusBatched, model.QueueStatusProcessing).Scan(&total)
+	return total, err
+}
+
+// GetTreasuryHoldings returns, per treasury wallet other than the main wallet, what the
+// user deposited through it minus what was withdrawn from it to the user
+func (d *Database) GetTreasuryHoldings(userID int) (map[string]float64, error) {
+	rows, err := d.db.Query(`
+		SELECT wallet, SUM(amount) FROM (
+			SELECT t.wallet AS wallet, e.credit - e.debit AS amount
+			FROM ledger_entries e
+			JOIN ledger_transfers t ON t.id = e.transfer_id
+			WHERE e.account = ? AND e.user_id = ? AND t.wallet != ''
+			UNION ALL
+			SELECT treasury_wallet, -amount
+			FROM withdrawal_queue
+			WHERE user_id = ? AND status = ? AND treasury_wallet != ''
+		)
+		GROUP BY wallet`,
+		model.LedgerAccountUser, userID, userID, model.QueueStatusSent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holdings := make(map[string]float64)
+	for rows.Next() {
+		var wallet string
+		var amount float64
+		if err := rows.Scan(&wallet, &amount); err != nil {
+			return nil, err
+		}
+		holdings[wallet] = money.Round(amount)
+	}
+	return holdings, rows.Err()
+}
+
+// GetTreasuryWalletFlows returns the deposits received and withdrawals sent per treasury
+// wallet according to the ledger
+func (d *Database) GetTreasuryWalletFlows() ([]model.TreasuryWalletFlow, error) {
+	// The external account is debited when TON comes in and credited when it leaves
+	rows, err := d.db.Query(`
+		SELECT t.wallet, SUM(e.debit), SUM(e.credit)
+		FROM ledger_entries e
+		JOIN ledger_transfers t ON t.id = e.transfer_id
+		WHERE e.account = ?
+		GROUP BY t.wallet
+		ORDER BY t.wallet`, model.LedgerAccountExternal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flows := make([]model.TreasuryWalletFlow, 0)
+	for rows.Next() {
+		var f model.TreasuryWalletFlow
+		if err := rows.Scan(&f.Wallet, &f.Deposited, &f.Withdrawn); err != nil {
+			return nil, err
+		}
+		f.Deposited = money.Round(f.Deposited)
+		f.Withdrawn = money.Round(f.Withdrawn)
+		flows = append(flows, f)
+	}
+	return flows, rows.Err()
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"time"
+	"tonapp/internal/model"
+)
+
+// GetUserVerification returns the identity verification of a user, sql.ErrNoRows if
+// an admin never set it
+func (d *Database) GetUserVerification(userID int) (*model.UserVerification, error) {
+	v := &model.UserVerification{UserID: userID}
+	err := d.db.QueryRow("SELECT verified, note, updated_at FROM user_verifications WHERE user_id = ?", userID).
+		Scan(&v.Verified, &v.Note, &v.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// SetUserVerification marks a user verified or not, keeping the note for the record
+func (d *Database) SetUserVerification(userID int, verified bool, note string) (*model.UserVerification, error) {
+	v := &model.UserVerification{UserID: userID, Verified: verified, Note: note, UpdatedAt: time.Now().Unix()}
+	_, err := d.db.Exec(`
+		INSERT INTO user_verifications (user_id, verified, note, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			verified = excluded.verified,
+			note = excluded.note,
+			updated_at = excluded.updated_at`,
+		v.UserID, v.Verified, v.Note, v.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
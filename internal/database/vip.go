@@ -0,0 +1,73 @@
+package database
+
+import (
+	"time"
+	"tonapp/internal/model"
+)
+
+// GetInvestedTotals returns the TON in open investments of every user with any
+func (d *Database) GetInvestedTotals() (map[int]float64, error) {
+	rows, err := d.db.Query("SELECT user_id, SUM(amount) FROM investments GROUP BY user_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := make(map[int]float64)
+	for rows.Next() {
+		var userID int
+		var total float64
+		if err := rows.Scan(&userID, &total); err != nil {
+			return nil, err
+		}
+		totals[userID] = total
+	}
+	return totals, rows.Err()
+}
+
+// GetUserTiers returns the stored tiers of all ranked users
+func (d *Database) GetUserTiers() (map[int]model.UserTier, error) {
+	rows, err := d.db.Query("SELECT user_id, tier, invested, updated_at FROM user_tiers")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tiers := make(map[int]model.UserTier)
+	for rows.Next() {
+		var t model.UserTier
+		if err := rows.Scan(&t.UserID, &t.Tier, &t.Invested, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		tiers[t.UserID] = t
+	}
+	return tiers, rows.Err()
+}
+
+// GetUserTier returns the stored tier of a user, sql.ErrNoRows below the first tier
+func (d *Database) GetUserTier(userID int) (*model.UserTier, error) {
+	t := &model.UserTier{UserID: userID}
+	err := d.db.QueryRow("SELECT tier, invested, updated_at FROM user_tiers WHERE user_id = ?", userID).
+		Scan(&t.Tier, &t.Invested, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetUserTier stores the tier of a user, an empty tier removes it
+func (d *Database) SetUserTier(userID int, tier string, invested float64) error {
+	if tier == "" {
+		_, err := d.db.Exec("DELETE FROM user_tiers WHERE user_id = ?", userID)
+		return err
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO user_tiers (user_id, tier, invested, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			tier = excluded.tier,
+			invested = excluded.invested,
+			updated_at = excluded.updated_at`,
+		userID, tier, invested, time.Now().Unix())
+	return err
+}
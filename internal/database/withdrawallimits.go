@@ -0,0 +1,118 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// withdrawnSinceQuery sums the withdrawals of a user since a time that weren't refunded
+const withdrawnSinceQuery = `
+	SELECT
+		(SELECT COALESCE(SUM(amount), 0) FROM withdrawal_requests
+			WHERE user_id = ? AND created_at >= ? AND status NOT IN (?, ?, ?)) +
+		(SELECT COALESCE(SUM(amount), 0) FROM withdrawal_queue
+			WHERE user_id = ? AND created_at >= ? AND status != ?)`
+
+// GetUserWithdrawnSince sums the withdrawals a user requested since a time, whichever way
+// they are sent: direct, held for approval, queued or batched. Failed and rejected ones
+// were refunded and don't count, approved ones count with their queue entry.
+func (d *Database) GetUserWithdrawnSince(userID int, since int64) (float64, error) {
+	var total float64
+	err := d.db.QueryRow(withdrawnSinceQuery,
+		userID, since, model.WithdrawalStatusFailed, model.WithdrawalStatusRejected, model.WithdrawalStatusApproved,
+		userID, since, model.QueueStatusFailed).Scan(&total)
+	return total, err
+}
+
+// checkWithdrawalCaps checks the caps of a withdrawal after it was inserted in tx. The
+// insert takes the write lock first, so a concurrent withdrawal of the user is either
+// seen here or sees this one.
+func checkWithdrawalCaps(tx *sql.Tx, userID int, caps model.WithdrawalCaps) error {
+	if caps.DailyAmount > 0 {
+		var total float64
+		err := tx.QueryRow(withdrawnSinceQuery,
+			userID, caps.DayStart, model.WithdrawalStatusFailed, model.WithdrawalStatusRejected, model.WithdrawalStatusApproved,
+			userID, caps.DayStart, model.QueueStatusFailed).Scan(&total)
+		if err != nil {
+			return err
+		}
+		if money.Round(total) > caps.DailyAmount {
+			return model.ErrDailyWithdrawalLimitReached
+		}
+	}
+	if caps.CooldownSince > 0 {
+		var count int
+		err := tx.QueryRow(`
+			SELECT
+				(SELECT COUNT(*) FROM withdrawal_requests
+					WHERE user_id = ? AND created_at > ? AND status NOT IN (?, ?, ?)) +
+				(SELECT COUNT(*) FROM withdrawal_queue
+					WHERE user_id = ? AND created_at > ? AND status != ?)`,
+			userID, caps.CooldownSince, model.WithdrawalStatusFailed, model.WithdrawalStatusRejected, model.WithdrawalStatusApproved,
+			userID, caps.CooldownSince, model.QueueStatusFailed).Scan(&count)
+		if err != nil {
+			return err
+		}
+		// The new withdrawal is one of them
+		if count > 1 {
+			return model.ErrWithdrawalCooldownActive
+		}
+	}
+	return nil
+}
+
+// GetUserLastWithdrawalAt returns when a user last requested a withdrawal that wasn't
+// refunded, 0 without one
+func (d *Database) GetUserLastWithdrawalAt(userID int) (int64, error) {
+	var last int64
+	err := d.db.QueryRow(`
+		SELECT MAX(
+			(SELECT COALESCE(MAX(created_at), 0) FROM withdrawal_requests
+				WHERE user_id = ? AND status NOT IN (?, ?, ?)),
+			(SELECT COALESCE(MAX(created_at), 0) FROM withdrawal_queue
+				WHERE user_id = ? AND status != ?))`,
+		userID, model.WithdrawalStatusFailed, model.WithdrawalStatusRejected, model.WithdrawalStatusApproved,
+		userID, model.QueueStatusFailed).Scan(&last)
+	return last, err
+}
+
+// GetWithdrawalLimitOverride returns the withdrawal limits an admin set for a user,
+// sql.ErrNoRows if the user has the limits of the config
+func (d *Database) GetWithdrawalLimitOverride(userID int) (*model.WithdrawalLimitOverride, error) {
+	o := &model.WithdrawalLimitOverride{UserID: userID}
+	err := d.db.QueryRow(`
+		SELECT min_amount, max_amount, daily_amount, note, updated_at
+		FROM withdrawal_limit_overrides WHERE user_id = ?`, userID).
+		Scan(&o.MinAmount, &o.MaxAmount, &o.DailyAmount, &o.Note, &o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// SetWithdrawalLimitOverride replaces the withdrawal limits of a user
+func (d *Database) SetWithdrawalLimitOverride(o model.WithdrawalLimitOverride) (*model.WithdrawalLimitOverride, error) {
+	o.UpdatedAt = time.Now().Unix()
+	_, err := d.db.Exec(`
+		INSERT INTO withdrawal_limit_overrides (user_id, min_amount, max_amount, daily_amount, note, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			min_amount = excluded.min_amount,
+			max_amount = excluded.max_amount,
+			daily_amount = excluded.daily_amount,
+			note = excluded.note,
+			updated_at = excluded.updated_at`,
+		o.UserID, o.MinAmount, o.MaxAmount, o.DailyAmount, o.Note, o.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// DeleteWithdrawalLimitOverride returns a user to the withdrawal limits of the config
+func (d *Database) DeleteWithdrawalLimitOverride(userID int) error {
+	_, err := d.db.Exec("DELETE FROM withdrawal_limit_overrides WHERE user_id = ?", userID)
+	return err
+}
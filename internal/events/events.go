@@ -0,0 +1,111 @@
+// Package events fans out the events of a user to their open push connections.
+//
+// Publishers never block: a subscriber that doesn't keep up is dropped and its
+// channel closed, so the connection can tell the client to reconnect and reload.
+package events
+
+import "sync"
+
+// Types of the events published for users
+const (
+	TypeBalance    = "balance"
+	TypeOperation  = "operation"
+	TypeWithdrawal = "withdrawal"
+)
+
+// subscriberBuffer is how many events a subscriber may lag behind before it is dropped
+const subscriberBuffer = 64
+
+// Event is something that happened to a user
+type Event struct {
+	Type   string      `json:"type"`
+	UserID int         `json:"-"`
+	Data   interface{} `json:"data"`
+}
+
+// Bus delivers published events to the subscribers of their user
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[int]map[*Subscription]bool
+}
+
+// Subscription receives the events of one user on C until it is closed
+type Subscription struct {
+	C <-chan Event
+
+	bus    *Bus
+	userID int
+	ch     chan Event
+}
+
+// NewBus creates an event bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[int]map[*Subscription]bool)}
+}
+
+// Subscribe starts receiving the events of a user
+func (b *Bus) Subscribe(userID int) *Subscription {
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, bus: b, userID: userID, ch: ch}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*Subscription]bool)
+	}
+	b.subscribers[userID][sub] = true
+	return sub
+}
+
+// Close stops the subscription and closes C, it may be called more than once
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove unsubscribes s and closes its channel, under the lock
+func (b *Bus) remove(s *Subscription) {
+	subs := b.subscribers[s.userID]
+	if !subs[s] {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(b.subscribers, s.userID)
+	}
+	close(s.ch)
+}
+
+// Publish delivers an event to the subscribers of its user. Subscribers whose buffer
+// is full are dropped.
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers[e.UserID] {
+		select {
+		case sub.ch <- e:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// HasSubscribers reports whether a user has an open subscription, so publishers can
+// skip building events nobody receives
+func (b *Bus) HasSubscribers(userID int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[userID]) > 0
+}
+
+// Subscribers returns the number of open subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, subs := range b.subscribers {
+		n += len(subs)
+	}
+	return n
+}
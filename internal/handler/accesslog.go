@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultAccessLogRetentionDays is used when access_log.retention_days isn't set
+	defaultAccessLogRetentionDays = 90
+	// accessLogPruneInterval is how often StartAccessLogRetention removes expired entries
+	accessLogPruneInterval = time.Hour
+	// maxAccessLogUserAgent bounds the stored User-Agent header
+	maxAccessLogUserAgent = 256
+
+	// contextClaimedPubKey is the gin context key of the wallet a request signs in as,
+	// before it is authenticated
+	contextClaimedPubKey = "claimed_pub_key"
+)
+
+// AccessLog records the requests of a sensitive route in the access log once they are
+// handled. Placed before an auth middleware it records the rejected attempts too.
+func (h *Handler) AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.config().AccessLog.Enabled {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		userAgent := c.Request.UserAgent()
+		if len(userAgent) > maxAccessLogUserAgent {
+			userAgent = userAgent[:maxAccessLogUserAgent]
+		}
+		pubKey := accessLogPubKey(c)
+		entry := &model.AccessLogEntry{
+			CreatedAt:  start.Unix(),
+			RequestID:  c.GetString("RequestID"),
+			Method:     c.Request.Method,
+			Route:      c.FullPath(),
+			Path:       c.Request.URL.Path,
+			Status:     c.Writer.Status(),
+			DurationMs: time.Since(start).Milliseconds(),
+			UserID:     h.accessLogUser(c, pubKey),
+			PubKey:     strings.ToLower(pubKey),
+			Admin:      c.GetBool(contextAdmin),
+			AdminKey:   c.GetString(contextAdminKey),
+			ClientIP:   c.ClientIP(),
+			UserAgent:  userAgent,
+		}
+		if err := h.db.AddAccessLog(entry); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to write access log", "route", entry.Route, "status", entry.Status, "error", err)
+		}
+	}
+}
+
+// accessLogPubKey returns the wallet a request acted for: the pub_key parameter, the
+// session wallet or the one it tried to sign in as
+func accessLogPubKey(c *gin.Context) string {
+	if pubKey := c.Param("pub_key"); pubKey != "" {
+		return pubKey
+	}
+	if session := c.GetString(contextSessionPubKey); session != "" {
+		return session
+	}
+	return c.GetString(contextClaimedPubKey)
+}
+
+// accessLogUser returns the user of the :id parameter of admin routes or of the wallet,
+// nil when there is no such user
+func (h *Handler) accessLogUser(c *gin.Context, pubKey string) *int {
+	if id, err := strconv.Atoi(c.Param("id")); err == nil {
+		return &id
+	}
+	if pubKey == "" {
+		return nil
+	}
+	user, err := h.db.GetUserByPubKey(pubKey)
+	if err != nil {
+		return nil
+	}
+	return &user.ID
+}
+
+// accessLogRetention returns how long access log entries are kept
+func (h *Handler) accessLogRetention() time.Duration {
+	days := h.config().AccessLog.RetentionDays
+	if days <= 0 {
+		days = defaultAccessLogRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// StartAccessLogRetention periodically removes access log entries older than
+// access_log.retention_days
+func (h *Handler) StartAccessLogRetention(ctx context.Context) {
+	ticker := time.NewTicker(accessLogPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := h.db.DeleteAccessLogsBefore(time.Now().Add(-h.accessLogRetention()).Unix()); err != nil {
+			slog.Error("Failed to prune access log", "error", err)
+		} else if n > 0 {
+			slog.Info("Pruned access log", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetAccessLogs lists the access log of sensitive routes, newest first, filtered by
+// user_id (or the :id parameter), pub_key, route, method, status, ip, admin_key and a
+// from/to range of unix times (admin only)
+func (h *Handler) GetAccessLogs(c *gin.Context) {
+	filter := model.AccessLogFilter{
+		PubKey:   c.Query("pub_key"),
+		Route:    c.Query("route"),
+		Method:   c.Query("method"),
+		ClientIP: c.Query("ip"),
+		AdminKey: c.Query("admin_key"),
+	}
+
+	userID := c.Query("user_id")
+	if id := c.Param("id"); id != "" {
+		userID = id
+	}
+	// positive parses an optional positive number, writing the error response otherwise
+	positive := func(name, value string) (int64, bool) {
+		if value == "" {
+			return 0, true
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "invalid " + name,
+			})
+			return 0, false
+		}
+		return n, true
+	}
+	user, ok := positive("user_id", userID)
+	if !ok {
+		return
+	}
+	status, ok := positive("status", c.Query("status"))
+	if !ok {
+		return
+	}
+	if filter.From, ok = positive("from", c.Query("from")); !ok {
+		return
+	}
+	if filter.To, ok = positive("to", c.Query("to")); !ok {
+		return
+	}
+	filter.UserID, filter.Status = int(user), int(status)
+
+	params, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+
+	page, err := h.db.GetAccessLogs(filter, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get access log",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    page,
+	})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserByAccountNumber looks up a user by the account number they read out to support,
+// with or without the dash and leading zeros (admin only)
+func (h *Handler) GetUserByAccountNumber(c *gin.Context) {
+	number, err := model.ParseAccountNumber(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid account number, check the digits",
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByAccountNumber(number)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    user,
+	})
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPlatformFeePercent is the share of investment profit kept by the platform
+// unless accrual.platform_fee_percent sets another
+const defaultPlatformFeePercent = 20.0
+
+// maxAccrualCatchUp limits how many missed weeks are accrued per investment in one run
+const maxAccrualCatchUp = 52
+
+// platformFeePercent returns the share of investment profit kept by the platform
+func platformFeePercent(cfg model.AccrualConfig) float64 {
+	if cfg.PlatformFeePercent > 0 {
+		return cfg.PlatformFeePercent
+	}
+	return defaultPlatformFeePercent
+}
+
+// accrualPeriodStart returns where the next accrual period of an investment starts: its
+// last accrual, its creation, or accrual.start_at for investments made before it
+func (h *Handler) accrualPeriodStart(inv model.Investment) int64 {
+	start := inv.LastAccruedAt
+	if start == 0 {
+		start = inv.CreatedAt
+	}
+	if startAt := h.config().Accrual.StartAt; start < startAt {
+		start = startAt
+	}
+	return start
+}
+
+// StartProfitAccrual periodically credits weekly investment profit while accrual.enabled
+// is set
+func (h *Handler) StartProfitAccrual(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		// Checked every tick, so a config reload can enable it
+		if h.config().Accrual.Enabled {
+			if n, err := h.AccrueProfits(time.Now()); err != nil {
+				slog.Error("Failed to accrue profits", "error", err)
+			} else if n > 0 {
+				slog.Info("Accrued investment profit periods", "count", n)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AccrueProfits credits every full week elapsed since the last accrual of each investment,
+// or since accrual.start_at.
+// Weekly profit is amount * weekly_percent, minus the platform fee; the percent of
+// investments in a pricing experiment is the one of the user's variant, and VIP tiers
+// add their bonus to the percent and discount the fee. Referrers receive
+// their share of the net profit. Investments with paused accrual are skipped and
+// catch up once the pause is lifted. Each user gets one profit_accrued notification
+// per run. Returns the number of accrued periods.
+func (h *Handler) AccrueProfits(now time.Time) (int, error) {
+	investments, err := h.db.GetInvestmentsDueForAccrual(now.Unix() - secondsInWeek)
+	if err != nil {
+		return 0, err
+	}
+
+	cohorts := h.newExperimentCohorts()
+	accrued := 0
+	profits := make(map[int]float64)
+	defer func() {
+		for userID, profit := range profits {
+			h.notifyProfitAccrued(userID, profit)
+		}
+	}()
+	for _, inv := range investments {
+		pause, err := h.getInvestmentPause(inv.Type, true)
+		if err != nil {
+			return accrued, err
+		}
+		if pause != nil {
+			continue
+		}
+
+		investConfig, ok := h.config().InvestmentTypes[inv.Type]
+		if !ok {
+			slog.Warn("Skipping accrual of investment with unknown type", "investment_id", inv.ID, "type", inv.Type)
+			continue
+		}
+		investConfig, err = cohorts.terms(inv, investConfig)
+		if err != nil {
+			return accrued, err
+		}
+		feePercent, err := cohorts.feePercent(inv.UserID)
+		if err != nil {
+			return accrued, err
+		}
+
+		periods, profit := h.accrueWeeks(&inv, investConfig, feePercent, now.Unix())
+		accrued += periods
+		if profit > 0 {
+			profits[inv.UserID] += profit
+		}
+	}
+
+	return accrued, nil
+}
+
+// accrueWeeks credits the full weeks of an investment elapsed until the given time, up to
+// maxAccrualCatchUp, advancing its LastAccruedAt, keeping feePercent of the profit. It
+// returns their number and the net profit credited.
+func (h *Handler) accrueWeeks(inv *model.Investment, investConfig model.InvestmentTypeConfig, feePercent float64, until int64) (int, float64) {
+	periodStart := h.accrualPeriodStart(*inv)
+
+	accrued, profit := 0, 0.0
+	for i := 0; i < maxAccrualCatchUp && periodStart+secondsInWeek <= until; i++ {
+		periodEnd := periodStart + secondsInWeek
+		grossProfit := money.FloorPayout(inv.Amount * (investConfig.WeeklyPercent / 100.0))
+		net, err := h.accrueProfit(*inv, investConfig, feePercent, grossProfit, periodEnd)
+		if err != nil {
+			break
+		}
+		accrued++
+		profit += net
+
+		inv.LastAccruedAt = periodEnd
+		periodStart = periodEnd
+	}
+	return accrued, profit
+}
+
+// accrueProfit credits the profit of an accrual period minus the platform fee of
+// feePercent, pays the referrers their share and returns the net profit
+func (h *Handler) accrueProfit(inv model.Investment, investConfig model.InvestmentTypeConfig, feePercent, grossProfit float64, periodEnd int64) (float64, error) {
+	fee := money.RoundFee(grossProfit * (feePercent / 100.0))
+	if err := h.db.AccrueInvestmentProfit(inv, grossProfit, fee, investConfig.WeeklyPercent, periodEnd); err != nil {
+		slog.Error("Failed to accrue investment", "investment_id", inv.ID, "user_id", inv.UserID, "error", err)
+		return 0, err
+	}
+
+	if err := h.ProcessReferralEarnings(inv.UserID, grossProfit-fee, periodEnd); err != nil {
+		slog.Error("Failed to process referral earnings", "user_id", inv.UserID, "error", err)
+	}
+	return grossProfit - fee, nil
+}
+
+// RunProfitAccrual runs profit accrual immediately. On testnet as_of may lie in the
+// future to force accrual of investments that aren't due yet (used by cmd/smoketest).
+func (h *Handler) RunProfitAccrual(c *gin.Context) {
+	var req struct {
+		AsOf int64 `json:"as_of"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if !h.config().Accrual.Enabled {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "profit accrual is disabled",
+		})
+		return
+	}
+
+	now := time.Now()
+	if req.AsOf > now.Unix() {
+		if h.config().TON.Network != "testnet" {
+			c.JSON(http.StatusForbidden, model.Response{
+				Success: false,
+				Error:   "forced accrual is only available on testnet",
+			})
+			return
+		}
+		now = time.Unix(req.AsOf, 0)
+	}
+
+	accrued, err := h.AccrueProfits(now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to accrue profits",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"accrued_periods": accrued,
+			"as_of":           now.Unix(),
+		},
+	})
+}
@@ -0,0 +1,351 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bounds of address_book.withdrawal_delay_hours, the activation delay of new addresses
+const (
+	minAddressDelayHours = 24
+	maxAddressDelayHours = 48
+)
+
+// addressBookEntry fills the computed fields of a saved address
+func (h *Handler) addressBookEntry(e model.AddressBookEntry) model.AddressBookEntry {
+	delay := h.config().AddressBook.WithdrawalDelayHours
+	if delay <= 0 {
+		delay = minAddressDelayHours
+	}
+	e.WithdrawableAt = e.CreatedAt + int64(delay)*3600
+	return e
+}
+
+// GetAddressBook returns the saved addresses of the user, oldest first
+func (h *Handler) GetAddressBook(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.GetAddressBook(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get address book: %v", err),
+		})
+		return
+	}
+	for i := range entries {
+		entries[i] = h.addressBookEntry(entries[i])
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    gin.H{"entries": entries},
+	})
+}
+
+// CreateAddressBookEntry saves a labeled address. Withdrawals to it are allowed once
+// address_book.withdrawal_delay_hours passed, and the user is notified, so an address
+// added with a stolen session can be deleted before it is activated.
+func (h *Handler) CreateAddressBookEntry(c *gin.Context) {
+	var req model.CreateAddressBookEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "label (up to 64 characters) and address are required",
+		})
+		return
+	}
+	req.Label = strings.TrimSpace(req.Label)
+	req.Address = strings.TrimSpace(req.Address)
+
+	raw, err := ton.RawAddress(req.Address)
+	if err != nil || req.Label == "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid label or address",
+		})
+		return
+	}
+
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.GetAddressBook(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get address book: %v", err),
+		})
+		return
+	}
+
+	maxEntries := h.config().AddressBook.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 50
+	}
+	if len(entries) >= maxEntries {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("the address book holds at most %d addresses", maxEntries),
+		})
+		return
+	}
+	for _, e := range entries {
+		if saved, err := ton.RawAddress(e.Address); err == nil && saved == raw {
+			c.JSON(http.StatusConflict, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("address is already saved as %q", e.Label),
+			})
+			return
+		}
+	}
+
+	entry, err := h.db.CreateAddressBookEntry(user.ID, req.Label, req.Address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to save address: %v", err),
+		})
+		return
+	}
+
+	saved := h.addressBookEntry(*entry)
+	h.notifyUser(user.ID, "address_added", func(l locale) (string, string) {
+		return l.text("address_added.title"), l.text("address_added.body",
+			saved.Address, saved.Label, time.Unix(saved.WithdrawableAt, 0).UTC().Format(time.RFC3339))
+	})
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data:    saved,
+	})
+}
+
+// addressBookParam loads the user's saved address of the :id parameter, writing the
+// error response when it doesn't exist
+func (h *Handler) addressBookParam(c *gin.Context) (*model.AddressBookEntry, bool) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid address book entry id",
+		})
+		return nil, false
+	}
+
+	entry, err := h.db.GetAddressBookEntry(user.ID, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "address book entry not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get address book entry",
+		})
+		return nil, false
+	}
+	return entry, true
+}
+
+// UpdateAddressBookEntry renames a saved address. The address itself can't be changed,
+// that would skip the withdrawal delay.
+func (h *Handler) UpdateAddressBookEntry(c *gin.Context) {
+	var req model.UpdateAddressBookEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Label) == "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "label (up to 64 characters) is required",
+		})
+		return
+	}
+
+	entry, ok := h.addressBookParam(c)
+	if !ok {
+		return
+	}
+
+	label := strings.TrimSpace(req.Label)
+	if err := h.db.UpdateAddressBookLabel(entry.UserID, entry.ID, label); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to update address: %v", err),
+		})
+		return
+	}
+	entry.Label = label
+	entry.UpdatedAt = time.Now().Unix()
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    h.addressBookEntry(*entry),
+	})
+}
+
+// DeleteAddressBookEntry removes a saved address. Past withdrawals to it keep the
+// address, they just lose the label in history.
+func (h *Handler) DeleteAddressBookEntry(c *gin.Context) {
+	entry, ok := h.addressBookParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteAddressBookEntry(entry.UserID, entry.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to delete address: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Message: "address deleted",
+	})
+}
+
+// addressBookEntryByAddress returns the saved address of a user matching an address in
+// any of its forms, sql.ErrNoRows if it isn't saved
+func (h *Handler) addressBookEntryByAddress(userID int, address string) (*model.AddressBookEntry, error) {
+	raw, err := ton.RawAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := h.db.GetAddressBook(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if saved, err := ton.RawAddress(e.Address); err == nil && saved == raw {
+			return &e, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// withdrawalAddress loads the saved address a withdrawal is sent to, by entry ID or by
+// the address itself, writing the error response when it isn't saved or is still within
+// the withdrawal delay. Only saved addresses can be withdrawn to besides the user's wallet.
+func (h *Handler) withdrawalAddress(c *gin.Context, userID int, id int64, address string) (*model.AddressBookEntry, bool) {
+	if id != 0 && address != "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "send either address_book_id or destination",
+		})
+		return nil, false
+	}
+	if address != "" {
+		if _, err := ton.RawAddress(address); err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "invalid destination address",
+			})
+			return nil, false
+		}
+	}
+
+	var entry *model.AddressBookEntry
+	var err error
+	if address != "" {
+		entry, err = h.addressBookEntryByAddress(userID, address)
+	} else {
+		entry, err = h.db.GetAddressBookEntry(userID, id)
+	}
+	if err == sql.ErrNoRows && address != "" {
+		c.JSON(http.StatusForbidden, model.Response{
+			Success: false,
+			Error:   "destination is not in the address book",
+			Code:    model.ErrorAddressNotWhitelisted,
+		})
+		return nil, false
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "address book entry not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get address book entry",
+		})
+		return nil, false
+	}
+
+	e := h.addressBookEntry(*entry)
+	if time.Now().Unix() < e.WithdrawableAt {
+		c.JSON(http.StatusForbidden, model.Response{
+			Success: false,
+			Error: fmt.Sprintf("withdrawals to %q are allowed from %s",
+				e.Label, time.Unix(e.WithdrawableAt, 0).UTC().Format(time.RFC3339)),
+		})
+		return nil, false
+	}
+	return &e, true
+}
+
+// addressLabels maps the raw form of the user's saved addresses to their labels, so
+// operations can show who a withdrawal went to
+func (h *Handler) addressLabels(userID int) map[string]string {
+	entries, err := h.db.GetAddressBook(userID)
+	if err != nil {
+		slog.Error("Failed to get address book", "user_id", userID, "error", err)
+		return nil
+	}
+	labels := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if raw, err := ton.RawAddress(e.Address); err == nil {
+			labels[raw] = e.Label
+		}
+	}
+	return labels
+}
+
+// labelOperation adds extra.address_label to an operation sent to a saved address
+func labelOperation(op model.Operation, labels map[string]string) model.Operation {
+	extra, ok := op.Extra.(map[string]interface{})
+	if !ok || len(labels) == 0 {
+		return op
+	}
+	destination, _ := extra["destination"].(string)
+	if destination == "" {
+		return op
+	}
+	raw, err := ton.RawAddress(destination)
+	if err != nil || labels[raw] == "" {
+		return op
+	}
+
+	labeled := make(map[string]interface{}, len(extra)+1)
+	for k, v := range extra {
+		labeled[k] = v
+	}
+	labeled["address_label"] = labels[raw]
+	op.Extra = labeled
+	return op
+}
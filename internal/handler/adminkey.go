@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	adminKeyPrefix = "tadm_"
+	// configAdminKeyName is the name of the superadmin key of admin_api_key
+	configAdminKeyName = "config"
+	// maxAdminKeyName bounds the names of admin keys
+	maxAdminKeyName = 64
+
+	// contextAdmin is the gin context key set on requests authenticated with an admin key
+	contextAdmin = "admin"
+	// contextAdminKey is the gin context key of the name of the admin key
+	contextAdminKey = "admin_key"
+)
+
+// adminRouteRoles lists the roles besides superadmin allowed on an admin route, by
+// method and route pattern. Routes missing here can be read (GET) by every role and are
+// changed by superadmins only.
+var adminRouteRoles = map[string][]string{
+	// Writes nothing
+	"POST /api/v1/admin/simulations":                {model.AdminRoleReadOnly, model.AdminRoleSupport, model.AdminRoleFinance},
+	"POST /api/v1/admin/users/:id/withdrawal-check": {model.AdminRoleReadOnly, model.AdminRoleSupport, model.AdminRoleFinance},
+
+	// Accounts and investigations
+	"PUT /api/v1/admin/users/:id/referrer":                   {model.AdminRoleSupport},
+	"PUT /api/v1/admin/users/:id/verification":               {model.AdminRoleSupport},
+	"PUT /api/v1/admin/users/:id/freeze":                     {model.AdminRoleSupport, model.AdminRoleFinance},
+	"DELETE /api/v1/admin/users/:id/freeze":                  {model.AdminRoleSupport, model.AdminRoleFinance},
+	"PUT /api/v1/admin/chain/transactions/:id/investigation": {model.AdminRoleSupport, model.AdminRoleFinance},
+	"POST /api/v1/admin/partners/:id/approve":                {model.AdminRoleSupport},
+	"POST /api/v1/admin/partners/:id/revoke":                 {model.AdminRoleSupport},
+
+	// Balances and payouts
+	"PUT /api/v1/users/:id/balance":                        {model.AdminRoleFinance},
+	"POST /api/v1/admin/withdrawals/approvals/:id/approve": {model.AdminRoleFinance},
+	"POST /api/v1/admin/withdrawals/approvals/:id/reject":  {model.AdminRoleFinance},
+	"POST /api/v1/admin/deposits/reviews/:id/credit":       {model.AdminRoleFinance},
+	"POST /api/v1/admin/deposits/reviews/:id/reject":       {model.AdminRoleFinance},
+	"POST /api/v1/admin/users/:id/referral-clawback":       {model.AdminRoleFinance},
+	"POST /api/v1/admin/referrals/recompute":               {model.AdminRoleFinance},
+	"POST /api/v1/admin/accruals/run":                      {model.AdminRoleFinance},
+	"POST /api/v1/admin/deposit-addresses/sweep":           {model.AdminRoleFinance},
+	"PUT /api/v1/admin/users/:id/withdrawal-limits":        {model.AdminRoleFinance},
+	"DELETE /api/v1/admin/users/:id/withdrawal-limits":     {model.AdminRoleFinance},
+
+	// Key management, reading included
+	"GET /api/v1/admin/keys": nil,
+}
+
+// adminRoleAllows reports whether a role may call a route
+func adminRoleAllows(role, method, route string) bool {
+	if role == model.AdminRoleSuperadmin {
+		return true
+	}
+	roles, ok := adminRouteRoles[method+" "+route]
+	if !ok {
+		return method == http.MethodGet
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminAuth checks the admin key of the X-API-Key header and whether its role allows
+// the route
+func (h *Handler) AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := h.adminKey(c.GetHeader("X-API-Key"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "invalid API key",
+				Code:    model.ErrorAdminKeyInvalid,
+			})
+			return
+		}
+		c.Set(contextAdmin, true)
+		c.Set(contextAdminKey, key.Name)
+
+		if !adminRoleAllows(key.Role, c.Request.Method, c.FullPath()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.Response{
+				Success: false,
+				Error:   "the " + key.Role + " role doesn't allow this route",
+				Code:    model.ErrorAdminRoleForbidden,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminKey returns the admin key of an X-API-Key value: admin_api_key of the config,
+// which is a superadmin key, or an active stored key
+func (h *Handler) adminKey(apiKey string) (*model.AdminKey, bool) {
+	if apiKey == "" {
+		return nil, false
+	}
+	if configKey := h.config().AdminAPIKey; configKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(configKey)) == 1 {
+		return &model.AdminKey{Name: configAdminKeyName, Role: model.AdminRoleSuperadmin}, true
+	}
+	if !strings.HasPrefix(apiKey, adminKeyPrefix) {
+		return nil, false
+	}
+
+	key, err := h.db.GetAdminKeyByHash(hashAPIToken(apiKey))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to get admin key", "error", err)
+		}
+		return nil, false
+	}
+	return key, true
+}
+
+// GetAdminKeys lists the stored admin keys without their secrets (superadmin only)
+func (h *Handler) GetAdminKeys(c *gin.Context) {
+	keys, err := h.db.GetAdminKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get admin keys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    keys,
+	})
+}
+
+// CreateAdminKey issues a named admin key with a role (superadmin only)
+func (h *Handler) CreateAdminKey(c *gin.Context) {
+	var req model.CreateAdminKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAdminKeyName || req.Name == configAdminKeyName {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "name must be 1 to 64 characters and not \"" + configAdminKeyName + "\"",
+		})
+		return
+	}
+	validRole := false
+	for _, role := range model.AdminRoles {
+		validRole = validRole || role == req.Role
+	}
+	if !validRole {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "role must be one of " + strings.Join(model.AdminRoles, ", "),
+		})
+		return
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to generate key",
+		})
+		return
+	}
+	plain := adminKeyPrefix + secret
+
+	key, err := h.db.CreateAdminKey(req.Name, req.Role, plain[:len(adminKeyPrefix)+6], hashAPIToken(plain), c.GetString(contextAdminKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to store key",
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Admin key created", "admin_key_id", key.ID, "name", key.Name, "role", key.Role, "created_by", key.CreatedBy)
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data: model.CreateAdminKeyResponse{
+			AdminKey: *key,
+			Key:      plain,
+		},
+		Message: "store the key now, it won't be shown again",
+	})
+}
+
+// RevokeAdminKey revokes a stored admin key (superadmin only). The key of the config
+// can only be changed in the config.
+func (h *Handler) RevokeAdminKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid admin key ID",
+		})
+		return
+	}
+
+	if err := h.db.RevokeAdminKey(id); err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Admin key revoked", "admin_key_id", id, "revoked_by", c.GetString(contextAdminKey))
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Message: "admin key revoked",
+	})
+}
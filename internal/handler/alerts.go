@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/notify"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxWithdrawalOutcomes bounds the withdrawal attempts kept for the failure rate rules
+	maxWithdrawalOutcomes = 10000
+	// maxToncenterSamples bounds the toncenter error counts kept for the toncenter rules
+	maxToncenterSamples = 10000
+)
+
+// alertMonitor keeps the recent withdrawal outcomes, toncenter error counts and the
+// state of every alert rule. They are kept in memory only and start over on restart.
+type alertMonitor struct {
+	mu        sync.Mutex
+	outcomes  []withdrawalOutcome
+	toncenter []toncenterSample
+	alerts    map[string]*model.Alert
+}
+
+type withdrawalOutcome struct {
+	at     int64
+	failed bool
+}
+
+// toncenterSample is the total of failed toncenter calls and 429s at an evaluation
+type toncenterSample struct {
+	at     int64
+	errors uint64
+}
+
+func (m *alertMonitor) recordWithdrawal(at int64, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.outcomes) >= maxWithdrawalOutcomes {
+		m.outcomes = m.outcomes[len(m.outcomes)-maxWithdrawalOutcomes/2:]
+	}
+	m.outcomes = append(m.outcomes, withdrawalOutcome{at: at, failed: failed})
+}
+
+// withdrawalFailures counts the attempts and failures since the given time
+func (m *alertMonitor) withdrawalFailures(since int64) (attempts int, failures int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.outcomes {
+		if o.at < since {
+			continue
+		}
+		attempts++
+		if o.failed {
+			failures++
+		}
+	}
+	return attempts, failures
+}
+
+// toncenterErrors records the current total of toncenter errors and returns how many
+// happened since the given time, counted from the last sample taken before it
+func (m *alertMonitor) toncenterErrors(now, since int64, total uint64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.toncenter) >= maxToncenterSamples {
+		m.toncenter = m.toncenter[len(m.toncenter)-maxToncenterSamples/2:]
+	}
+	m.toncenter = append(m.toncenter, toncenterSample{at: now, errors: total})
+
+	baseline := m.toncenter[0].errors
+	for _, s := range m.toncenter {
+		if s.at > since {
+			break
+		}
+		baseline = s.errors
+	}
+	if total < baseline {
+		return 0
+	}
+	return total - baseline
+}
+
+// sendWithdrawal sends a payout from a treasury wallet and records the outcome for the
+// withdrawal failure rate alerts. A wallet short of funds isn't counted as a failure,
+// the hot wallet balance rule covers it. The payout goes to the destination address if
+// one is set, else to the user's own wallet.
+func (h *Handler) sendWithdrawal(ctx context.Context, wallet string, pubKey string, destination string, amount float64) (string, error) {
+	var txHash string
+	var err error
+	if destination != "" {
+		txHash, err = h.ton.WithdrawToAddress(ctx, wallet, destination, amount)
+	} else {
+		txHash, err = h.ton.WithdrawFromWallet(ctx, wallet, pubKey, amount)
+	}
+	if !errors.Is(err, ton.ErrInsufficientWalletBalance) {
+		h.alerts.recordWithdrawal(time.Now().Unix(), err != nil)
+		recipient := destination
+		if recipient == "" {
+			recipient = "the wallet of " + pubKey
+		}
+		h.alertWithdrawal(wallet, recipient, amount, txHash, err)
+	}
+	return txHash, err
+}
+
+// alertWithdrawal notifies operators of a failed withdrawal transfer with
+// alerts.notify_failed_transfers, and of a sent one of at least
+// alerts.large_withdrawal_amount
+func (h *Handler) alertWithdrawal(wallet, recipient string, amount float64, txHash string, err error) {
+	cfg := h.config().Alerts
+	if !cfg.Enabled || len(h.notifiers) == 0 {
+		return
+	}
+	if wallet == "" {
+		wallet = "main"
+	}
+	fields := map[string]interface{}{
+		"wallet": wallet,
+		"amount": amount,
+	}
+
+	var msg notify.Message
+	switch {
+	case err != nil && cfg.NotifyFailedTransfers:
+		fields["status"], fields["error"] = "transfer_failed", err.Error()
+		msg = notify.Message{
+			Title: fmt.Sprintf("Withdrawal transfer of %s TON failed", money.Format(amount)),
+			Body:  fmt.Sprintf("Sending %s TON from the %s wallet to %s failed: %v", money.Format(amount), wallet, recipient, err),
+		}
+	case err == nil && cfg.LargeWithdrawalAmount > 0 && amount >= cfg.LargeWithdrawalAmount:
+		fields["status"], fields["tx_hash"] = "large_withdrawal", txHash
+		msg = notify.Message{
+			Title: fmt.Sprintf("Large withdrawal of %s TON sent", money.Format(amount)),
+			Body:  fmt.Sprintf("%s TON were sent from the %s wallet to %s, above the %g TON alert amount. Transaction %s.", money.Format(amount), wallet, recipient, cfg.LargeWithdrawalAmount, txHash),
+		}
+	default:
+		return
+	}
+	msg.Fields = fields
+
+	go func() {
+		if err := h.notifiers.Send(context.Background(), msg); err != nil {
+			slog.Error("Failed to send withdrawal alert", "title", msg.Title, "error", err)
+		}
+	}()
+}
+
+// StartAlerts periodically evaluates the alert rules and notifies operators of changes
+func (h *Handler) StartAlerts(ctx context.Context) {
+	if !h.config().Alerts.Enabled || len(h.config().Alerts.Rules) == 0 {
+		return
+	}
+
+	interval := time.Duration(h.config().Alerts.CheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.EvaluateAlerts(ctx, time.Now())
+		}
+	}
+}
+
+// EvaluateAlerts checks every rule and sends a notification when an alert starts
+// firing, when it resolves, and every repeat_minutes while it keeps firing
+func (h *Handler) EvaluateAlerts(ctx context.Context, now time.Time) {
+	var messages []notify.Message
+
+	for _, rule := range h.config().Alerts.Rules {
+		value, firing, message, err := h.evaluateAlertRule(ctx, rule, now)
+
+		h.alerts.mu.Lock()
+		if h.alerts.alerts == nil {
+			h.alerts.alerts = make(map[string]*model.Alert)
+		}
+		alert, ok := h.alerts.alerts[rule.Name]
+		if !ok {
+			alert = &model.Alert{Rule: rule.Name, Type: rule.Type, Threshold: rule.Threshold}
+			h.alerts.alerts[rule.Name] = alert
+		}
+		alert.EvaluatedAt = now.Unix()
+		if err != nil {
+			alert.Error = err.Error()
+			h.alerts.mu.Unlock()
+			slog.ErrorContext(ctx, "Failed to evaluate alert rule", "rule", rule.Name, "error", err)
+			continue
+		}
+
+		wasFiring := alert.Firing
+		alert.Error = ""
+		alert.Value = value
+		alert.Message = message
+		alert.Firing = firing
+
+		status := ""
+		switch {
+		case firing && !wasFiring:
+			since := now.Unix()
+			alert.FiringSince = &since
+			status = "firing"
+		case firing && rule.RepeatMinutes > 0 && alert.NotifiedAt != nil &&
+			now.Unix()-*alert.NotifiedAt >= int64(rule.RepeatMinutes)*60:
+			status = "firing"
+		case !firing && wasFiring:
+			status = "resolved"
+		}
+		if status != "" {
+			notifiedAt := now.Unix()
+			alert.NotifiedAt = &notifiedAt
+			messages = append(messages, alertMessage(*alert, status))
+		}
+		if !firing {
+			alert.FiringSince = nil
+			alert.NotifiedAt = nil
+		}
+		h.alerts.mu.Unlock()
+	}
+
+	for _, msg := range messages {
+		slog.WarnContext(ctx, "Alert", "title", msg.Title)
+		if err := h.notifiers.Send(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "Failed to send alert", "title", msg.Title, "error", err)
+		}
+	}
+}
+
+// evaluateAlertRule returns the current value of the rule and whether it fires
+func (h *Handler) evaluateAlertRule(ctx context.Context, rule model.AlertRule, now time.Time) (value float64, firing bool, message string, err error) {
+	minCount := rule.MinCount
+	if minCount <= 0 {
+		minCount = 1
+	}
+
+	switch rule.Type {
+	case model.AlertRuleWithdrawalFailureRate:
+		window := rule.WindowMinutes
+		if window <= 0 {
+			window = 60
+		}
+		attempts, failures := h.alerts.withdrawalFailures(now.Add(-time.Duration(window) * time.Minute).Unix())
+		if attempts > 0 {
+			value = float64(failures) / float64(attempts) * 100
+		}
+		firing = attempts >= minCount && value > rule.Threshold
+		message = fmt.Sprintf("%d of %d withdrawals failed in the last %d minutes (%.1f%%, threshold %g%%)",
+			failures, attempts, window, value, rule.Threshold)
+
+	case model.AlertRulePendingDepositAge:
+		count, oldest, err := h.db.GetStalePendingDeposits(now.Unix() - int64(rule.Threshold*60))
+		if err != nil {
+			return 0, false, "", err
+		}
+		if count > 0 {
+			value = float64(now.Unix()-oldest) / 60
+		}
+		firing = count >= minCount
+		message = fmt.Sprintf("%d deposits pending for more than %g minutes, the oldest for %.0f minutes",
+			count, rule.Threshold, value)
+
+	case model.AlertRuleHotWalletBalance:
+		balance, err := h.ton.GetWalletBalance(ctx, h.ton.GetDepositAddress())
+		if err != nil {
+			return 0, false, "", fmt.Errorf("failed to get hot wallet balance: %v", err)
+		}
+		value = balance
+		firing = balance < rule.Threshold
+		message = fmt.Sprintf("hot wallet holds %s TON, threshold %g TON", money.Format(balance), rule.Threshold)
+
+	case model.AlertRuleToncenterErrors:
+		window := rule.WindowMinutes
+		if window <= 0 {
+			window = 60
+		}
+		stats := h.ton.BudgetStats()
+		errs := h.alerts.toncenterErrors(now.Unix(), now.Add(-time.Duration(window)*time.Minute).Unix(), stats.Failures+stats.Throttled)
+		value = float64(errs)
+		firing = errs >= uint64(minCount) && value > rule.Threshold
+		message = fmt.Sprintf("%d toncenter calls failed or were throttled in the last %d minutes, threshold %g, circuit %s",
+			errs, window, rule.Threshold, stats.Circuit)
+
+	default:
+		return 0, false, "", fmt.Errorf("unknown alert rule type %q", rule.Type)
+	}
+
+	return value, firing, message, nil
+}
+
+func alertMessage(alert model.Alert, status string) notify.Message {
+	fields := map[string]interface{}{
+		"status":    status,
+		"rule":      alert.Rule,
+		"type":      alert.Type,
+		"value":     alert.Value,
+		"threshold": alert.Threshold,
+	}
+	if alert.FiringSince != nil {
+		fields["firing_since"] = *alert.FiringSince
+	}
+
+	return notify.Message{
+		Title:  fmt.Sprintf("[%s] %s", strings.ToUpper(status), alert.Rule),
+		Body:   alert.Message,
+		Fields: fields,
+	}
+}
+
+// GetAlerts lists the alerts currently firing, or every rule with ?all=true (admin only)
+func (h *Handler) GetAlerts(c *gin.Context) {
+	all := c.Query("all") == "true"
+
+	h.alerts.mu.Lock()
+	alerts := make([]model.Alert, 0)
+	for _, rule := range h.config().Alerts.Rules {
+		alert, ok := h.alerts.alerts[rule.Name]
+		if !ok || (!all && !alert.Firing) {
+			continue
+		}
+		alerts = append(alerts, *alert)
+	}
+	h.alerts.mu.Unlock()
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    alerts,
+	})
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxOperationTags   = 10
+	maxOperationTagLen = 32
+)
+
+// normalizeTag lowercases a tag, allowing letters, digits, "-" and "_"
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > maxOperationTagLen {
+		return "", fmt.Errorf("tags must be 1 to %d characters", maxOperationTagLen)
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return "", fmt.Errorf("invalid tag %q, use letters, digits, - and _", tag)
+		}
+	}
+	return tag, nil
+}
+
+// normalizeTags normalizes and deduplicates tags, sorted
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxOperationTags {
+		return nil, fmt.Errorf("at most %d tags per operation", maxOperationTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// tagParam returns the normalized ?tag= filter of a history listing, writing the error
+// response when it is invalid
+func tagParam(c *gin.Context) (string, bool) {
+	tag := c.Query("tag")
+	if tag == "" {
+		return "", true
+	}
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return "", false
+	}
+	return tag, true
+}
+
+// operationDetails loads what the user added to their operations, address book labels
+// and annotations, and returns a func adding them to an operation with its amount
+// rounded to a nanoton
+func (h *Handler) operationDetails(userID int) func(model.Operation) model.Operation {
+	labels := h.addressLabels(userID)
+	annotations, err := h.db.GetOperationAnnotations(userID)
+	if err != nil {
+		slog.Error("Failed to get operation annotations", "user_id", userID, "error", err)
+	}
+	return func(op model.Operation) model.Operation {
+		op.Amount = money.Round(op.Amount)
+		op = labelOperation(op, labels)
+		if a, ok := annotations[op.ID]; ok {
+			op.Tags, op.Note = a.Tags, a.Note
+		}
+		return op
+	}
+}
+
+// addOperationDetails adds address book labels and annotations to a history page
+func (h *Handler) addOperationDetails(userID int, history *model.OperationHistory) {
+	details := h.operationDetails(userID)
+	for i := range history.Operations {
+		history.Operations[i] = details(history.Operations[i])
+	}
+}
+
+// SetOperationAnnotation replaces the tags and note of one of the user's operations.
+// Empty tags and note clear the annotation.
+func (h *Handler) SetOperationAnnotation(c *gin.Context) {
+	var req model.SetOperationAnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body, note is limited to 500 characters",
+		})
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+
+	user, operationID, ok := h.annotationParams(c)
+	if !ok {
+		return
+	}
+
+	if len(tags) == 0 && note == "" {
+		h.clearOperationAnnotation(c, user.ID, operationID)
+		return
+	}
+
+	annotation, err := h.db.SetOperationAnnotation(user.ID, operationID, tags, note)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "operation not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to save annotation: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    annotation,
+	})
+}
+
+// ClearOperationAnnotation removes the tags and note of one of the user's operations
+func (h *Handler) ClearOperationAnnotation(c *gin.Context) {
+	user, operationID, ok := h.annotationParams(c)
+	if !ok {
+		return
+	}
+	h.clearOperationAnnotation(c, user.ID, operationID)
+}
+
+func (h *Handler) clearOperationAnnotation(c *gin.Context, userID int, operationID int64) {
+	if err := h.db.ClearOperationAnnotation(userID, operationID); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to clear annotation: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Message: "annotation cleared",
+	})
+}
+
+// annotationParams resolves the user and the :operation_id parameter, writing the error
+// response when they are invalid
+func (h *Handler) annotationParams(c *gin.Context) (*model.User, int64, bool) {
+	operationID, err := strconv.ParseInt(c.Param("operation_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid operation id",
+		})
+		return nil, 0, false
+	}
+
+	user, ok := h.historyUser(c)
+	if !ok {
+		return nil, 0, false
+	}
+	return user, operationID, true
+}
@@ -0,0 +1,214 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requiresApproval reports whether a withdrawal is above the approval threshold
+func (h *Handler) requiresApproval(amount float64) bool {
+	threshold := h.config().WithdrawalApproval.Threshold
+	return threshold > 0 && amount > threshold
+}
+
+// holdWithdrawal reserves a withdrawal above the approval threshold and tells the
+// operators it is waiting for them
+func (h *Handler) holdWithdrawal(c *gin.Context, user *model.User, amount float64, destination string, caps model.WithdrawalCaps) (model.Response, bool) {
+	held, err := h.db.HoldWithdrawal(user.ID, amount, destination, caps)
+	if err != nil {
+		h.respondReserveError(c, user.ID, amount, err, "failed to create withdrawal request")
+		return model.Response{}, false
+	}
+	slog.InfoContext(c.Request.Context(), "Withdrawal request waits for approval", "withdrawal_id", held.ID, "user_id", held.UserID, "amount", money.Format(held.Amount))
+	h.publishHeldWithdrawal(*held, model.WithdrawalStatusPendingApproval, "")
+
+	if len(h.notifiers) > 0 {
+		msg := notify.Message{
+			Title: fmt.Sprintf("Withdrawal of %s TON waits for approval", money.Format(held.Amount)),
+			Body:  fmt.Sprintf("Withdrawal request %d of user %d is above the %g TON approval threshold.", held.ID, held.UserID, h.config().WithdrawalApproval.Threshold),
+			Fields: map[string]interface{}{
+				"status":                model.WithdrawalStatusPendingApproval,
+				"withdrawal_request_id": held.ID,
+				"user_id":               held.UserID,
+				"amount":                held.Amount,
+			},
+		}
+		go func() {
+			if err := h.notifiers.Send(context.Background(), msg); err != nil {
+				slog.Error("Failed to notify withdrawal request", "withdrawal_id", held.ID, "user_id", held.UserID, "error", err)
+			}
+		}()
+	}
+
+	return model.Response{
+		Success: true,
+		Data:    held,
+		Message: fmt.Sprintf("withdrawals above %g TON are sent after an admin approved them", h.config().WithdrawalApproval.Threshold),
+	}, true
+}
+
+// GetHeldWithdrawals lists the withdrawal requests of the approval queue, those waiting
+// for approval unless ?status= asks for another status or "all" (admin only)
+func (h *Handler) GetHeldWithdrawals(c *gin.Context) {
+	status := c.DefaultQuery("status", model.WithdrawalStatusPendingApproval)
+	switch status {
+	case "all":
+		status = ""
+	case model.WithdrawalStatusPendingApproval, model.WithdrawalStatusApproved, model.WithdrawalStatusSending,
+		model.WithdrawalStatusSent, model.WithdrawalStatusRejected, model.WithdrawalStatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "unknown status",
+		})
+		return
+	}
+
+	withdrawals, err := h.db.GetHeldWithdrawals(status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get withdrawal requests: %v", err),
+		})
+		return
+	}
+
+	total := 0.0
+	for _, w := range withdrawals {
+		total += w.Amount
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"threshold":   h.config().WithdrawalApproval.Threshold,
+			"total":       money.Round(total),
+			"withdrawals": withdrawals,
+		},
+	})
+}
+
+// heldWithdrawalParam loads the withdrawal request of the :id parameter, writing the
+// error response when it doesn't exist
+func (h *Handler) heldWithdrawalParam(c *gin.Context) (*model.HeldWithdrawal, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid withdrawal request id",
+		})
+		return nil, false
+	}
+
+	w, err := h.db.GetHeldWithdrawal(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "withdrawal request not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal request",
+		})
+		return nil, false
+	}
+	return w, true
+}
+
+// ApproveWithdrawal hands a withdrawal waiting for approval to the withdrawal worker,
+// which sends it like any other withdrawal: retried on failures and queued when the
+// wallets can't cover it (admin only)
+func (h *Handler) ApproveWithdrawal(c *gin.Context) {
+	w, ok := h.heldWithdrawalParam(c)
+	if !ok {
+		return
+	}
+	if f, err := h.db.GetUserFreeze(w.UserID); err == nil && f.Frozen {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "the user's account is frozen, unfreeze it or reject the withdrawal",
+			Code:    model.ErrorAccountFrozen,
+		})
+		return
+	}
+
+	queued, err := h.db.ApproveHeldWithdrawal(*w)
+	if err != nil {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Withdrawal request approved", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "queue_id", queued.ID)
+	h.publishHeldWithdrawal(*w, model.WithdrawalStatusApproved, "")
+	h.publishQueuedWithdrawal(*queued, model.QueueStatusProcessing, "")
+	h.withdrawalWorker.notify()
+
+	if approved, err := h.db.GetHeldWithdrawal(w.ID); err == nil {
+		w = approved
+	}
+	c.JSON(http.StatusAccepted, model.Response{
+		Success: true,
+		Data:    w,
+		Message: fmt.Sprintf("withdrawal is being processed, GET /api/v1/users/by-pubkey/%s/withdrawals/%d tells its status", w.PubKey, queued.ID),
+	})
+}
+
+// RejectWithdrawal rejects a withdrawal waiting for approval and returns the reserved
+// amount to the user balance (admin only)
+func (h *Handler) RejectWithdrawal(c *gin.Context) {
+	var req model.RejectWithdrawalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "reason is required",
+		})
+		return
+	}
+
+	w, ok := h.heldWithdrawalParam(c)
+	if !ok {
+		return
+	}
+	if w.Status != model.WithdrawalStatusPendingApproval {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("withdrawal request %d is %s", w.ID, w.Status),
+		})
+		return
+	}
+
+	if err := h.db.ReleaseHeldWithdrawal(*w, model.WithdrawalStatusRejected, req.Reason); err != nil {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	h.notifyUser(w.UserID, "withdrawal_rejected", func(l locale) (string, string) {
+		return l.text("withdrawal_rejected.title"), l.text("withdrawal_rejected.body", l.amount(w.Amount), req.Reason)
+	})
+	h.publishHeldWithdrawal(*w, model.WithdrawalStatusRejected, "")
+
+	if rejected, err := h.db.GetHeldWithdrawal(w.ID); err == nil {
+		w = rejected
+	}
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    w,
+	})
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangeReferrer corrects a wrong referral attribution (admin only).
+// Corrections are only allowed within referral_config.attribution_fix_days after registration.
+func (h *Handler) ChangeReferrer(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+
+	var req model.ChangeReferrerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	user, err := h.db.GetUser(userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user",
+		})
+		return
+	}
+
+	fixWindow := time.Duration(h.config().ReferralConfig.AttributionFixDays) * 24 * time.Hour
+	if time.Since(time.Unix(user.CreatedAt, 0)) > fixWindow {
+		c.JSON(http.StatusForbidden, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("attribution can only be changed within %d days after registration", h.config().ReferralConfig.AttributionFixDays),
+		})
+		return
+	}
+
+	if req.RefID != nil {
+		if referrer, err := h.db.GetUser(*req.RefID); err == nil && referrer.ClosedAt != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "the new referrer's account is closed",
+				Code:    model.ErrorAccountClosed,
+			})
+			return
+		}
+	}
+
+	if err := h.db.ChangeReferrer(user.ID, req.RefID, req.Reason, model.AttributionByAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"user_id":    user.ID,
+			"old_ref_id": user.RefID,
+			"new_ref_id": req.RefID,
+		},
+	})
+}
+
+// GetAttributionHistory returns the referrer attribution history of a user (admin only)
+func (h *Handler) GetAttributionHistory(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+
+	history, err := h.db.GetAttributionHistory(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get attribution history: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    history,
+	})
+}
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBatchInterval is used when withdrawal_batching.interval_minutes isn't set
+const defaultBatchInterval = 15 * time.Minute
+
+// maxBatchedWithdrawals bounds the withdrawals sent in one batch window
+const maxBatchedWithdrawals = 1000
+
+// shouldBatchWithdrawal decides whether a withdrawal waits for the next batch transfer
+func (h *Handler) shouldBatchWithdrawal(amount float64) bool {
+	batching := h.config().WithdrawalBatching
+	return batching.Enabled && amount <= batching.MaxAmount
+}
+
+func (h *Handler) batchInterval() time.Duration {
+	if minutes := h.config().WithdrawalBatching.IntervalMinutes; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return defaultBatchInterval
+}
+
+// nextBatchAt returns when the next batch is sent: at the next multiple of the interval
+// since midnight UTC, so users can be told the time before they withdraw. Intervals
+// that don't divide a day end their last window at midnight.
+func (h *Handler) nextBatchAt(now time.Time) time.Time {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	interval := h.batchInterval()
+	next := midnight.Add((now.Sub(midnight)/interval + 1) * interval)
+	if end := midnight.AddDate(0, 0, 1); next.After(end) {
+		return end
+	}
+	return next
+}
+
+// batchWithdrawal reserves the amount and puts the withdrawal in the next batch
+func (h *Handler) batchWithdrawal(c *gin.Context, user *model.User, amount float64, destination string, caps model.WithdrawalCaps) (model.Response, bool) {
+	batched, err := h.db.BatchWithdrawal(user.ID, amount, destination, caps)
+	if err != nil {
+		h.respondReserveError(c, user.ID, amount, err, "failed to queue withdrawal")
+		return model.Response{}, false
+	}
+
+	batched.ScheduledAt = h.nextBatchAt(time.Now()).Unix()
+	h.publishQueuedWithdrawal(*batched, model.QueueStatusBatched, "")
+	return model.Response{
+		Success: true,
+		Data:    batched,
+		Message: fmt.Sprintf("withdrawal of %s TON will be sent with the next batch at %s UTC",
+			money.Format(amount), time.Unix(batched.ScheduledAt, 0).UTC().Format("15:04")),
+	}, true
+}
+
+// GetWithdrawalBatching tells users which withdrawals are batched and when the next
+// batch is sent
+func (h *Handler) GetWithdrawalBatching(c *gin.Context) {
+	batching := h.config().WithdrawalBatching
+	info := model.WithdrawalBatchInfo{Enabled: batching.Enabled}
+	if batching.Enabled {
+		pending, err := h.db.CountBatchedWithdrawals()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to get withdrawal batching",
+			})
+			return
+		}
+		info.MaxAmount = batching.MaxAmount
+		info.IntervalMinutes = int(h.batchInterval() / time.Minute)
+		info.NextBatchAt = h.nextBatchAt(time.Now()).Unix()
+		info.Pending = pending
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    info,
+	})
+}
+
+// StartWithdrawalBatcher sends the batched withdrawals at the start of every batch window
+func (h *Handler) StartWithdrawalBatcher(ctx context.Context) {
+	if !h.config().WithdrawalBatching.Enabled {
+		return
+	}
+
+	for {
+		timer := time.NewTimer(time.Until(h.nextBatchAt(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			// A batch being sent isn't cut off by a shutdown
+			if n, err := h.ProcessWithdrawalBatches(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("Failed to send withdrawal batches", "error", err)
+			} else if n > 0 {
+				slog.Info("Sent batched withdrawals", "count", n)
+			}
+		}
+	}
+}
+
+// ProcessWithdrawalBatches sends the batched withdrawals as one multi-message transfer per
+// wallet they are sent from, split by what the wallet can send at once. Batches the wallet
+// can't cover wait for the next window. Returns the number of sent withdrawals.
+func (h *Handler) ProcessWithdrawalBatches(ctx context.Context) (int, error) {
+	entries, err := h.db.GetBatchedWithdrawals(maxBatchedWithdrawals)
+	if err != nil {
+		return 0, err
+	}
+
+	// Group by the wallet the withdrawals are sent from, in order. Withdrawals of frozen
+	// accounts aren't returned, they stay batched until they are unfrozen.
+	var wallets []string
+	groups := make(map[string][]model.QueuedWithdrawal)
+	for _, w := range entries {
+		w.TreasuryWallet = h.withdrawalWallet(w.UserID, w.Amount)
+		if _, ok := groups[w.TreasuryWallet]; !ok {
+			wallets = append(wallets, w.TreasuryWallet)
+		}
+		groups[w.TreasuryWallet] = append(groups[w.TreasuryWallet], w)
+	}
+
+	sent := 0
+	for _, wallet := range wallets {
+		size := h.ton.MaxBatchMessages(wallet)
+		if max := h.config().WithdrawalBatching.MaxMessages; max > 0 && max < size {
+			size = max
+		}
+		if size <= 0 {
+			return sent, fmt.Errorf("%s can't send batches", treasuryWalletLabel(wallet))
+		}
+
+		group := groups[wallet]
+		for len(group) > 0 {
+			n := min(size, len(group))
+			count, err := h.sendWithdrawalBatch(ctx, wallet, group[:n])
+			sent += count
+			if errors.Is(err, ton.ErrInsufficientWalletBalance) {
+				// Later batches of the wallet wait for the next window as well
+				slog.Warn("Withdrawal batch postponed", "wallet", wallet, "error", err)
+				break
+			}
+			if err != nil {
+				return sent, err
+			}
+			group = group[n:]
+		}
+	}
+
+	return sent, nil
+}
+
+// sendWithdrawalBatch sends batched withdrawals from a wallet in one transfer. Entries
+// without a valid destination are failed and refunded, those of a failed transfer are
+// retried in a later batch; if the wallet can't cover the batch above the hot wallet
+// reserve they stay batched and ton.ErrInsufficientWalletBalance is returned.
+func (h *Handler) sendWithdrawalBatch(ctx context.Context, wallet string, entries []model.QueuedWithdrawal) (int, error) {
+	total := 0.0
+	for _, w := range entries {
+		total += w.Amount
+	}
+	balance, err := h.ton.GetWalletBalance(ctx, h.ton.TreasuryAddress(wallet))
+	if err != nil {
+		return 0, err
+	}
+	if total > balance-h.config().Liquidity.MinHotWalletReserve {
+		return 0, fmt.Errorf("%w in %s for a batch of %s TON", ton.ErrInsufficientWalletBalance, treasuryWalletLabel(wallet), money.Format(total))
+	}
+
+	var batch []model.QueuedWithdrawal
+	var payouts []ton.Payout
+	for _, w := range entries {
+		destination := w.Destination
+		if destination == "" {
+			addr, err := h.ton.GenerateWalletAddressFromPubKey(w.PubKey)
+			if err != nil {
+				h.failBatchedWithdrawal(w, err.Error())
+				continue
+			}
+			destination = addr
+		}
+		if err := h.db.StartQueuedWithdrawalAttempt(w.ID, model.QueueStatusBatched, wallet); err != nil {
+			slog.Warn("Skipping batched withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+			continue
+		}
+		h.publishQueuedWithdrawal(w, model.QueueStatusSending, "")
+		batch = append(batch, w)
+		payouts = append(payouts, ton.Payout{Destination: destination, Amount: w.Amount})
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	txHash, err := h.ton.WithdrawBatch(ctx, wallet, payouts)
+	if errors.Is(err, ton.ErrInsufficientWalletBalance) {
+		for _, w := range batch {
+			if err := h.db.SetQueuedWithdrawalStatus(w.ID, model.QueueStatusSending, model.QueueStatusBatched); err != nil {
+				slog.Error("Failed to put withdrawal back in the batch", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+				continue
+			}
+			h.publishQueuedWithdrawal(w, model.QueueStatusBatched, "")
+		}
+		return 0, err
+	}
+	for range batch {
+		h.alerts.recordWithdrawal(time.Now().Unix(), err != nil)
+	}
+	if err != nil {
+		slog.Error("Failed to send withdrawal batch", "wallet", wallet, "count", len(batch), "error", err)
+		total := 0.0
+		for _, w := range batch {
+			total += w.Amount
+		}
+		h.alertWithdrawal(wallet, fmt.Sprintf("%d users in a batch", len(batch)), total, "", err)
+		for _, w := range batch {
+			h.retryWithdrawal(ctx, w, model.QueueStatusBatched, err)
+		}
+		return 0, nil
+	}
+
+	for _, w := range batch {
+		if err := h.db.CompleteQueuedWithdrawal(w, txHash); err != nil {
+			slog.Error("Failed to complete batched withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "tx_hash", txHash, "error", err)
+		}
+		h.notifyWithdrawalSent(w.UserID, w.Amount, txHash)
+		h.publishQueuedWithdrawal(w, model.QueueStatusSent, txHash)
+		h.alertWithdrawal(wallet, fmt.Sprintf("user %d in a batch", w.UserID), w.Amount, txHash, nil)
+	}
+	return len(batch), nil
+}
+
+// failBatchedWithdrawal fails a batched withdrawal and refunds the reserved amount
+func (h *Handler) failBatchedWithdrawal(w model.QueuedWithdrawal, reason string) {
+	slog.Error("Failed to send batched withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "reason", reason)
+	if err := h.db.FailQueuedWithdrawal(w, reason); err != nil {
+		slog.Error("Failed to refund batched withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+		return
+	}
+	h.notifyWithdrawalFailed(w.UserID, w.Amount)
+	h.publishQueuedWithdrawal(w, model.QueueStatusFailed, "")
+}
@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/telegram"
+)
+
+const (
+	// defaultBotPollTimeout is used when telegram.poll_timeout_seconds isn't set
+	defaultBotPollTimeout = 30 * time.Second
+	// botRetryDelay is the pause after a failed getUpdates
+	botRetryDelay = 5 * time.Second
+	// botRecentDeposits is how many deposit requests /deposits lists
+	botRecentDeposits = 5
+
+	defaultBotWelcomeText = "Welcome! Open the app to connect your TON wallet and start investing."
+	defaultBotButtonText  = "Open app"
+)
+
+// botPollTimeout returns how long a getUpdates long poll waits
+func (h *Handler) botPollTimeout() time.Duration {
+	if seconds := h.config().Telegram.PollTimeoutSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultBotPollTimeout
+}
+
+// StartTelegramBot long polls the bot for commands while telegram.bot_enabled is set.
+// With Telegram Stars payments the bot webhook points at the payments route, which
+// can't be combined with polling, so PaymentWebhook passes the commands on instead.
+func (h *Handler) StartTelegramBot(ctx context.Context) {
+	if h.bot == nil {
+		return
+	}
+	if h.config().Payments.TelegramStars.Enabled {
+		slog.Info("Telegram bot answers commands from the Telegram Stars webhook")
+		return
+	}
+
+	var offset int64
+	for {
+		updates, err := h.bot.GetUpdates(ctx, offset, h.botPollTimeout())
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("Failed to get Telegram bot updates", "error", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(botRetryDelay):
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			h.handleBotUpdate(ctx, update)
+		}
+	}
+}
+
+// handleBotUpdate binds the private chat a message was sent in for notifications and
+// answers it when it is a command
+func (h *Handler) handleBotUpdate(ctx context.Context, update telegram.Update) {
+	msg := update.Message
+	if h.bot == nil || msg == nil || msg.From == nil || msg.Chat.Type != "private" {
+		return
+	}
+	h.bindTelegramChat(int(msg.From.ID), msg.Chat.ID)
+	text, buttons := h.botReply(msg)
+	if text == "" {
+		return
+	}
+	if err := h.bot.SendMessage(ctx, msg.Chat.ID, text, buttons...); err != nil {
+		slog.ErrorContext(ctx, "Failed to answer Telegram bot command", "telegram_id", msg.From.ID, "error", err)
+	}
+}
+
+// botReply returns the answer to a command, an empty text for messages that aren't one
+func (h *Handler) botReply(msg *telegram.Message) (string, []telegram.Button) {
+	command, arg := parseBotCommand(msg.Text)
+	userID := int(msg.From.ID)
+	switch command {
+	case "":
+		return "", nil
+	case "/start":
+		return h.botStart(userID, arg)
+	case "/balance":
+		return h.botBalance(userID)
+	case "/deposits":
+		return h.botDeposits(userID)
+	default:
+		return h.userLocale(userID).text("bot.help"), nil
+	}
+}
+
+// parseBotCommand splits "/command@bot arg" into the command and its argument
+func parseBotCommand(text string) (command, arg string) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", ""
+	}
+	command, arg, _ = strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command), strings.TrimSpace(arg)
+}
+
+// parseReferralParam returns the referrer of a ref_<user id> start parameter
+func parseReferralParam(param string) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimPrefix(param, referralStartPrefix))
+	if !strings.HasPrefix(param, referralStartPrefix) || err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// botAppButtons returns the button opening the web app, none without telegram.web_app_url
+func (h *Handler) botAppButtons() []telegram.Button {
+	cfg := h.config().Telegram
+	if cfg.WebAppURL == "" {
+		return nil
+	}
+	text := cfg.ButtonText
+	if text == "" {
+		text = defaultBotButtonText
+	}
+	return []telegram.Button{{Text: text, WebApp: &telegram.WebApp{URL: cfg.WebAppURL}}}
+}
+
+// botStart greets the user with the web app button. A referral link (t.me/<bot>?start=
+// ref_<user id>) is remembered for CreateUser when the user has no account yet.
+func (h *Handler) botStart(userID int, param string) (string, []telegram.Button) {
+	if refID, ok := parseReferralParam(param); ok && refID != userID {
+		h.rememberBotReferral(userID, refID)
+	}
+	text := h.config().Telegram.WelcomeText
+	if text == "" {
+		text = defaultBotWelcomeText
+	}
+	return text, h.botAppButtons()
+}
+
+// rememberBotReferral stores the referrer of a Telegram user without an account when the
+// referrer exists
+func (h *Handler) rememberBotReferral(userID, refID int) {
+	if _, err := h.db.GetUser(userID); err != sql.ErrNoRows {
+		return
+	}
+	if _, err := h.db.GetUser(refID); err != nil {
+		return
+	}
+	if err := h.db.SetBotReferral(userID, refID); err != nil {
+		slog.Error("Failed to store bot referral", "telegram_id", userID, "ref_id", refID, "error", err)
+	}
+}
+
+// botReferral returns the referrer remembered by the bot for a new wallet registering
+// with the Telegram user ID, nil for known wallets and users who had no referral link
+func (h *Handler) botReferral(pubKey string, userID int) *int {
+	if _, err := h.db.GetUserByPubKey(pubKey); err != sql.ErrNoRows {
+		return nil
+	}
+	refID, err := h.db.GetBotReferral(userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("Failed to get bot referral", "telegram_id", userID, "error", err)
+		}
+		return nil
+	}
+	return &refID
+}
+
+// botBalance answers /balance
+func (h *Handler) botBalance(userID int) (string, []telegram.Button) {
+	l := locale(model.DefaultPreferences)
+	user, err := h.db.GetUser(userID)
+	if err == sql.ErrNoRows {
+		return l.text("bot.no_account"), h.botAppButtons()
+	}
+	if err != nil {
+		slog.Error("Failed to get user for bot", "user_id", userID, "error", err)
+		return l.text("bot.error"), nil
+	}
+	l = locale(user.Preferences)
+	text := l.text("bot.balance", l.amount(user.Balance), l.amount(user.CurrentInvestments), l.amount(user.TotalEarnings))
+	if status, err := h.vipStatus(user); err == nil && status != nil && status.Tier != "" {
+		text += "\n" + l.text("bot.vip_tier", status.Tier)
+	}
+	return text, h.botAppButtons()
+}
+
+// botDeposits answers /deposits with the latest deposit requests
+func (h *Handler) botDeposits(userID int) (string, []telegram.Button) {
+	l := locale(model.DefaultPreferences)
+	user, err := h.db.GetUser(userID)
+	if err == sql.ErrNoRows {
+		return l.text("bot.no_account"), h.botAppButtons()
+	}
+	if err == nil {
+		l = locale(user.Preferences)
+	}
+	deposits, err := h.db.GetDepositsOfUser(userID)
+	if err != nil {
+		slog.Error("Failed to get deposits for bot", "user_id", userID, "error", err)
+		return l.text("bot.error"), nil
+	}
+	if len(deposits) == 0 {
+		return l.text("bot.no_deposits"), h.botAppButtons()
+	}
+	sort.Slice(deposits, func(i, j int) bool { return deposits[i].ID > deposits[j].ID })
+	if len(deposits) > botRecentDeposits {
+		deposits = deposits[:botRecentDeposits]
+	}
+
+	lines := make([]string, 0, len(deposits)+1)
+	lines = append(lines, l.text("bot.deposits"))
+	for _, d := range deposits {
+		status := d.Status
+		if _, ok := userTexts["bot.deposit."+d.Status]; ok {
+			status = l.text("bot.deposit." + d.Status)
+		}
+		line := fmt.Sprintf("#%d %s - %s TON, %s", d.ID, time.Unix(d.CreatedAt, 0).UTC().Format("2006-01-02 15:04"), l.amount(d.Amount), status)
+		if d.Status == "pending" && d.DepositAddress == "" {
+			line += " (" + l.text("bot.deposit_comment", d.Memo) + ")"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), h.botAppButtons()
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxChainWebhookBody bounds the body read before the signature is checked
+const maxChainWebhookBody = 1 << 20
+
+// chainWebhooks queues the treasury wallets reported by webhook events for the
+// matching worker, each wallet once however many events arrive meanwhile
+type chainWebhooks struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	wake    chan struct{}
+	stats   map[string]*model.ChainWebhookStats
+	matched int
+}
+
+func (w *chainWebhooks) wakeChan() chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wake == nil {
+		w.wake = make(chan struct{}, 1)
+	}
+	return w.wake
+}
+
+func (w *chainWebhooks) queue(wallet string) {
+	wake := w.wakeChan()
+	w.mu.Lock()
+	if w.pending == nil {
+		w.pending = make(map[string]bool)
+	}
+	w.pending[wallet] = true
+	w.mu.Unlock()
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *chainWebhooks) take() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wallets := make([]string, 0, len(w.pending))
+	for wallet := range w.pending {
+		wallets = append(wallets, wallet)
+	}
+	w.pending = nil
+	return wallets
+}
+
+// count updates the stats of a provider under the lock
+func (w *chainWebhooks) count(provider string, update func(s *model.ChainWebhookStats)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stats == nil {
+		w.stats = make(map[string]*model.ChainWebhookStats)
+	}
+	s, ok := w.stats[provider]
+	if !ok {
+		s = &model.ChainWebhookStats{Provider: provider}
+		w.stats[provider] = s
+	}
+	update(s)
+}
+
+func (w *chainWebhooks) countMatched(n int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.matched += n
+}
+
+// snapshot returns the stats of the enabled providers
+func (w *chainWebhooks) snapshot(cfg model.ChainWebhooksConfig) model.ChainWebhookStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := make([]model.ChainWebhookStats, 0, 2)
+	for _, provider := range []string{ton.WebhookProviderTonAPI, ton.WebhookProviderToncenter} {
+		if _, ok := chainWebhookConfig(cfg, provider); !ok {
+			continue
+		}
+		s := model.ChainWebhookStats{Provider: provider}
+		if current, ok := w.stats[provider]; ok {
+			s = *current
+			if current.LastEventAt != nil {
+				v := *current.LastEventAt
+				s.LastEventAt = &v
+			}
+		}
+		stats = append(stats, s)
+	}
+	return model.ChainWebhookStatus{
+		Providers:       stats,
+		MatchedDeposits: w.matched,
+		QueuedWallets:   len(w.pending),
+	}
+}
+
+// chainWebhookConfig returns the config of an enabled provider
+func chainWebhookConfig(cfg model.ChainWebhooksConfig, provider string) (model.ChainWebhookConfig, bool) {
+	var hook model.ChainWebhookConfig
+	switch provider {
+	case ton.WebhookProviderTonAPI:
+		hook = cfg.TonAPI
+	case ton.WebhookProviderToncenter:
+		hook = cfg.Toncenter
+	}
+	return hook, hook.Enabled
+}
+
+// ChainWebhook receives account events of the treasury wallets from tonapi or toncenter v3
+// subscriptions. Events only tell which wallet to look at: the worker reads the
+// transactions from the chain and matches them like deposit confirmations do.
+func (h *Handler) ChainWebhook(c *gin.Context) {
+	provider := c.Param("provider")
+	hook, ok := chainWebhookConfig(h.config().ChainWebhooks, provider)
+	if !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "webhook provider not available",
+		})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxChainWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "failed to read body",
+		})
+		return
+	}
+	if !ton.VerifyWebhookSignature(body, c.GetHeader(ton.WebhookSignatureHeader), hook.Secret) {
+		h.chainWebhooks.count(provider, func(s *model.ChainWebhookStats) { s.Rejected++ })
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   "invalid webhook signature",
+		})
+		return
+	}
+
+	events, err := ton.ParseAccountEvents(provider, body)
+	if err != nil {
+		h.chainWebhooks.count(provider, func(s *model.ChainWebhookStats) { s.Rejected++ })
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("invalid webhook body: %v", err),
+		})
+		return
+	}
+
+	wallets := make(map[string]string) // raw address -> configured address
+	for _, wallet := range h.treasuryWallets() {
+		if raw, err := ton.RawAddress(wallet); err == nil {
+			wallets[raw] = wallet
+		}
+	}
+	queued := 0
+	for _, e := range events {
+		if wallet, ok := wallets[e.Account]; ok {
+			h.chainWebhooks.queue(wallet)
+			queued++
+		}
+	}
+
+	now := time.Now().Unix()
+	h.chainWebhooks.count(provider, func(s *model.ChainWebhookStats) {
+		s.Events += len(events)
+		s.LastEventAt = &now
+	})
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    gin.H{"events": len(events), "queued": queued},
+	})
+}
+
+// StartChainWebhooks processes the wallets queued by webhook events until ctx is done
+func (h *Handler) StartChainWebhooks(ctx context.Context) {
+	cfg := h.config().ChainWebhooks
+	if !cfg.TonAPI.Enabled && !cfg.Toncenter.Enabled {
+		return
+	}
+
+	wake := h.chainWebhooks.wakeChan()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		}
+
+		// Matching, which forwards fees, completes on shutdown
+		for _, wallet := range h.chainWebhooks.take() {
+			matched, err := h.matchWalletDeposits(context.WithoutCancel(ctx), wallet)
+			if err != nil {
+				slog.Error("Failed to match deposits", "wallet", wallet, "error", err)
+			} else if matched > 0 {
+				slog.Info("Webhook event matched deposits", "wallet", wallet, "count", matched)
+			}
+		}
+	}
+}
+
+// matchWalletDeposits indexes a wallet and completes its pending deposits whose transfer
+// arrived. Deposits still waiting for confirmations are checked again once old enough.
+func (h *Handler) matchWalletDeposits(ctx context.Context, wallet string) (int, error) {
+	if h.config().Indexer.Enabled {
+		if _, err := h.indexWallet(ctx, wallet); err != nil {
+			return 0, err
+		}
+	}
+
+	// Deposit checks only look 30 minutes back
+	deposits, err := h.db.GetPendingDeposits(time.Now().Add(-30 * time.Minute).Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	for i := range deposits {
+		deposit := &deposits[i]
+		if h.depositWalletAddress(deposit) != wallet {
+			continue
+		}
+
+		ok, err := h.matchDeposit(wallet, deposit)
+		if err == ton.ErrAwaitingConfirmations {
+			delay := time.Duration(h.requiredDepositAge(deposit.Amount)) * time.Second
+			time.AfterFunc(delay, func() { h.chainWebhooks.queue(wallet) })
+			continue
+		}
+		if err != nil {
+			// Left to the fallback, the user's confirmation or the next event
+			slog.ErrorContext(ctx, "Failed to check deposit request", "deposit_id", deposit.ID, "user_id", deposit.UserID, "error", err)
+			continue
+		}
+		if ok {
+			matched++
+		}
+	}
+
+	h.chainWebhooks.countMatched(matched)
+	return matched, nil
+}
+
+// matchDeposit completes a pending deposit if its transfer arrived, skipping deposits a
+// confirmation completed or is checking meanwhile
+func (h *Handler) matchDeposit(wallet string, deposit *model.DepositRequest) (bool, error) {
+	claimed, err := claimDeposit(h.db, deposit.ID)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	received, err := h.checkDeposit(wallet, deposit)
+	var partial *ton.PartialDepositError
+	if errors.As(err, &partial) {
+		// Left pending, the user's confirmation reports what's missing
+		releaseDeposit(h.db, deposit.ID)
+		slog.Info("Partial payment of a deposit request", "deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount), "received", money.Format(partial.Received))
+		return false, nil
+	}
+	if err != nil || received == 0 {
+		releaseDeposit(h.db, deposit.ID)
+		if err == ton.ErrAwaitingConfirmations {
+			h.depositWatcher.markDetected(deposit.ID)
+		}
+		return false, err
+	}
+	if err := h.db.CompleteDeposit(*deposit, received); err != nil {
+		return false, err
+	}
+	h.depositWatcher.changed(deposit.ID)
+	slog.Info("Completed deposit request from a webhook event", "deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount), "received", money.Format(received))
+	h.notifyDepositCredited(deposit.UserID, received)
+	return true, nil
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChallengePurposeAccountClosure is signed by the wallet to close the account
+const ChallengePurposeAccountClosure = "account_closure"
+
+// lockedInvestments returns investments still within their lock period
+func (h *Handler) lockedInvestments(investments []model.Investment, now time.Time) []model.LockedInvestment {
+	var locked []model.LockedInvestment
+	for _, inv := range investments {
+		investConfig, ok := h.config().InvestmentTypes[inv.Type]
+		if !ok || investConfig.LockPeriod <= 0 {
+			continue
+		}
+		unlocksAt := inv.CreatedAt + int64(investConfig.LockPeriod)*86400
+		if unlocksAt > now.Unix() {
+			locked = append(locked, model.LockedInvestment{
+				ID:        inv.ID,
+				Type:      inv.Type,
+				Amount:    inv.Amount,
+				UnlocksAt: unlocksAt,
+			})
+		}
+	}
+	return locked
+}
+
+// CloseAccount closes the account on the user's request: unlocked investments are
+// closed and the account is marked closed, so it can't deposit or invest anymore and
+// earns no referral rewards. Unless keep_balance is set, the whole balance is then
+// withdrawn to the user's wallet like with WithdrawFunds and the account is anonymized
+// once it was sent; otherwise the balance stays withdrawable.
+func (h *Handler) CloseAccount(c *gin.Context) {
+	var req model.CloseAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	pubKey := h.pubKeyParam(c)
+	if pubKey == "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "missing pub_key parameter",
+		})
+		return
+	}
+	if !h.authorizePubKey(c, pubKey) {
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(pubKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	// A closed account can still be paid out and anonymized
+	if user.ClosedAt != nil && req.KeepBalance {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "account is already closed",
+			Code:    model.ErrorAccountClosed,
+		})
+		return
+	}
+	if rejectFrozenAccount(c, user) {
+		return
+	}
+
+	if _, err := h.verifyChallenge(user, ChallengePurposeAccountClosure, req.Nonce, req.Signature); err != nil {
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !req.KeepBalance {
+		queued, err := h.db.GetUserQueuedWithdrawals(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to check queued withdrawals",
+			})
+			return
+		}
+		for _, w := range queued {
+			if w.Status == model.QueueStatusQueued || w.Status == model.QueueStatusSending ||
+				w.Status == model.QueueStatusBatched || w.Status == model.QueueStatusProcessing {
+				c.JSON(http.StatusConflict, model.Response{
+					Success: false,
+					Error:   "wait until your queued withdrawals are sent before closing the account",
+				})
+				return
+			}
+		}
+	}
+
+	investments, err := h.db.GetUserInvestments(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get investments",
+		})
+		return
+	}
+
+	if locked := h.lockedInvestments(investments, time.Now()); len(locked) > 0 {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "some investments are still locked",
+			Data:    gin.H{"locked_investments": locked},
+		})
+		return
+	}
+
+	// The payout is the balance with the amounts of the closed investments credited
+	payout := 0.0
+	if !req.KeepBalance {
+		balance := user.Balance
+		for _, inv := range investments {
+			balance += inv.Amount
+		}
+		payout = money.FloorPayout(balance)
+	}
+
+	// The payout is a withdrawal like any other: limits, cooldown, approval and batching
+	// apply to it. They are checked before any investment is closed, so a rejected payout
+	// leaves the account as it was.
+	var caps model.WithdrawalCaps
+	if payout > 0 {
+		var ok bool
+		if caps, ok = h.checkUserWithdrawal(c, user.ID, payout); !ok {
+			return
+		}
+	}
+
+	for _, inv := range investments {
+		if err := h.db.CloseInvestmentByPolicy(user.ID, int64(inv.ID), "account_closure"); err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to close investments",
+			})
+			return
+		}
+	}
+
+	// Reload the balance with the closed investments credited
+	user, err = h.db.GetUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user information",
+		})
+		return
+	}
+
+	// Closing first blocks deposits and investments while the payout is reserved; the
+	// account is anonymized once it was sent
+	closedAt, err := h.db.CloseAccount(user.ID, !req.KeepBalance)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to close account", "user_id", user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to close account",
+		})
+		return
+	}
+	if req.KeepBalance {
+		c.JSON(http.StatusOK, model.Response{
+			Success: true,
+			Data: gin.H{
+				"status":    "closed",
+				"closed_at": closedAt,
+				"balance":   user.Balance,
+			},
+			Message: "account closed, the remaining balance can still be withdrawn",
+		})
+		return
+	}
+	if payout <= 0 {
+		c.JSON(http.StatusOK, model.Response{
+			Success: true,
+			Data: gin.H{
+				"status":    "closed",
+				"closed_at": closedAt,
+				"payout":    payout,
+			},
+		})
+		return
+	}
+
+	resp, ok := h.submitWithdrawal(c, user, payout, "", caps)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusAccepted, model.Response{
+		Success: true,
+		Data: gin.H{
+			"status":     "closed",
+			"closed_at":  closedAt,
+			"payout":     payout,
+			"withdrawal": resp.Data,
+		},
+		Message: "account closed, it is anonymized once the payout was sent: " + resp.Message,
+	})
+}
+
+// rejectClosedAccount refuses requests adding funds to a closed account
+func rejectClosedAccount(c *gin.Context, user *model.User) bool {
+	if user.ClosedAt == nil {
+		return false
+	}
+	c.JSON(http.StatusForbidden, model.Response{
+		Success: false,
+		Error:   "account is closed, only withdrawals are allowed",
+		Code:    model.ErrorAccountClosed,
+	})
+	return true
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publicConfigCacheControl lets the Mini App and CDNs reuse the config briefly and
+// revalidate it with conditional requests afterwards
+const publicConfigCacheControl = "public, max-age=60, stale-while-revalidate=300"
+
+// ServeConfigPublic serves the public config with ETag/Last-Modified validators.
+// The ETag is derived from the response body, so admin changes (e.g. pauses)
+// invalidate cached copies immediately.
+func (h *Handler) ServeConfigPublic(c *gin.Context) {
+	public := h.GetConfigPublic()
+
+	body, err := json.Marshal(public)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to encode config",
+		})
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:8]))
+
+	lastModified := h.configLoadedAt()
+	for _, pause := range public.Pauses {
+		if updated := time.Unix(pause.UpdatedAt, 0); updated.After(lastModified) {
+			lastModified = updated
+		}
+	}
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	c.Header("Cache-Control", publicConfigCacheControl)
+	c.Header("Vary", "Accept-Encoding")
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since
+// when no entity tags were sent (RFC 9110)
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !lastModified.After(t)
+		}
+	}
+	return false
+}
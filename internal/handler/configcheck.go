@@ -0,0 +1,889 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"tonapp/internal/keystore"
+	"tonapp/internal/logging"
+	"tonapp/internal/middleware"
+	"tonapp/internal/model"
+
+	"github.com/xssnick/tonutils-go/address"
+)
+
+// sampleAdminAPIKey is the key shipped in the example config.json
+const sampleAdminAPIKey = "7d6c4d6d-7d6c-4d6d-7d6c-7d6c4d6d7d6c"
+
+// configIssue is a problem found in config.json. Fatal issues keep the server from starting.
+type configIssue struct {
+	Fatal   bool
+	Field   string
+	Message string
+}
+
+// configReport collects the issues of a config validation pass
+type configReport struct {
+	Issues []configIssue
+}
+
+func (r *configReport) errorf(field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, configIssue{Fatal: true, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *configReport) warnf(field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, configIssue{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Errors returns the number of fatal issues
+func (r *configReport) Errors() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Fatal {
+			n++
+		}
+	}
+	return n
+}
+
+// Log logs the diagnostics, errors first
+func (r *configReport) Log() {
+	errors := r.Errors()
+	slog.Info("Config check", "errors", errors, "warnings", len(r.Issues)-errors)
+	for _, fatal := range []bool{true, false} {
+		for _, issue := range r.Issues {
+			if issue.Fatal != fatal {
+				continue
+			}
+			level := slog.LevelWarn
+			if issue.Fatal {
+				level = slog.LevelError
+			}
+			slog.Log(context.Background(), level, "Config issue", "field", issue.Field, "issue", issue.Message)
+		}
+	}
+}
+
+// validateConfig checks config.json for values that would make the service misbehave
+func validateConfig(cfg model.Config) *configReport {
+	r := &configReport{}
+	validateInvestmentTypes(r, cfg)
+	validateExperiments(r, cfg)
+	validateAccrual(r, cfg.Accrual)
+	validateReferrals(r, cfg.ReferralConfig, platformFeePercent(cfg.Accrual))
+	validateAdminKey(r, cfg.AdminAPIKey)
+	validateAuth(r, cfg)
+	validateTON(r, cfg)
+	validateRateLimit(r, cfg.RateLimit)
+	validateDeposit(r, cfg.Deposit)
+	validateDepositAddresses(r, cfg.DepositAddresses)
+	validateWithdrawalApproval(r, cfg)
+	validateWithdrawalBatching(r, cfg)
+	validateAddressBook(r, cfg.AddressBook)
+	validateWithdrawalLimits(r, cfg.WithdrawalLimits)
+	validateWithdrawalRetry(r, cfg.WithdrawalRetry)
+	validateRiskDisclaimer(r, cfg.RiskDisclaimer)
+	validateRates(r, cfg.Rates)
+	validateLogging(r, cfg.Logging)
+	validateAccessLog(r, cfg.AccessLog)
+	validateIntegrity(r, cfg.Integrity)
+	validateReadOnly(r, cfg.ReadOnly)
+	validateIdempotency(r, cfg.Idempotency)
+	validateVIP(r, cfg)
+	validateChainWebhooks(r, cfg)
+	validateIntegrations(r, cfg)
+	return r
+}
+
+func validateInvestmentTypes(r *configReport, cfg model.Config) {
+	if len(cfg.InvestmentTypes) == 0 {
+		r.errorf("investment_types", "no investment types configured")
+		return
+	}
+
+	names := make([]string, 0, len(cfg.InvestmentTypes))
+	for name := range cfg.InvestmentTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t := cfg.InvestmentTypes[name]
+		field := "investment_types." + name
+		switch {
+		case t.WeeklyPercent <= 0:
+			r.errorf(field+".weekly_percent", "must be positive, got %g", t.WeeklyPercent)
+		case t.WeeklyPercent >= 100:
+			r.errorf(field+".weekly_percent", "%g%% per week pays out more than the investment every week", t.WeeklyPercent)
+		case t.WeeklyPercent > 20:
+			r.warnf(field+".weekly_percent", "%g%% per week is unusually high", t.WeeklyPercent)
+		}
+		if t.MinAmount < 0 {
+			r.errorf(field+".min_amount", "must not be negative, got %g", t.MinAmount)
+		} else if t.MinAmount == 0 {
+			r.warnf(field+".min_amount", "no minimum amount, dust investments are accepted")
+		}
+		if t.LockPeriod < 0 {
+			r.errorf(field+".lock_period_days", "must not be negative, got %d", t.LockPeriod)
+		}
+		if _, ok := cfg.TON.TreasuryWallets[t.TreasuryWallet]; t.TreasuryWallet != "" && !ok {
+			r.errorf(field+".treasury_wallet", "no wallet %q in ton.treasury_wallets", t.TreasuryWallet)
+		}
+		if terms, ok := cfg.Terms[name]; ok && terms.Version == "" {
+			r.errorf("terms."+name+".version", "terms without a version can't be accepted")
+		}
+	}
+	for name := range cfg.Terms {
+		if _, ok := cfg.InvestmentTypes[name]; !ok {
+			r.warnf("terms."+name, "no investment type %q", name)
+		}
+	}
+}
+
+func validateExperiments(r *configReport, cfg model.Config) {
+	names := make(map[string]bool, len(cfg.Experiments))
+	types := make(map[string]string, len(cfg.Experiments))
+	for i, exp := range cfg.Experiments {
+		field := fmt.Sprintf("experiments[%d]", i)
+		if exp.Name == "" {
+			r.errorf(field+".name", "required")
+		} else if names[exp.Name] {
+			r.errorf(field+".name", "duplicate experiment name %q", exp.Name)
+		}
+		names[exp.Name] = true
+
+		if _, ok := cfg.InvestmentTypes[exp.InvestmentType]; !ok {
+			r.errorf(field+".investment_type", "no investment type %q", exp.InvestmentType)
+		} else if other, ok := types[exp.InvestmentType]; ok {
+			r.errorf(field+".investment_type", "%s already has experiment %q, users would get ambiguous terms", exp.InvestmentType, other)
+		} else {
+			types[exp.InvestmentType] = exp.Name
+		}
+
+		if len(exp.Variants) < 2 {
+			r.errorf(field+".variants", "at least two variants are needed to compare them")
+		}
+		variants := make(map[string]bool, len(exp.Variants))
+		for j, v := range exp.Variants {
+			vfield := fmt.Sprintf("%s.variants[%d]", field, j)
+			if v.Name == "" {
+				r.errorf(vfield+".name", "required")
+			} else if variants[v.Name] {
+				r.errorf(vfield+".name", "duplicate variant name %q", v.Name)
+			}
+			variants[v.Name] = true
+			if v.Weight <= 0 {
+				r.errorf(vfield+".weight", "must be positive, got %d", v.Weight)
+			}
+			switch {
+			case v.WeeklyPercent < 0:
+				r.errorf(vfield+".weekly_percent", "must not be negative, got %g", v.WeeklyPercent)
+			case v.WeeklyPercent >= 100:
+				r.errorf(vfield+".weekly_percent", "%g%% per week pays out more than the investment every week", v.WeeklyPercent)
+			case v.WeeklyPercent > 20:
+				r.warnf(vfield+".weekly_percent", "%g%% per week is unusually high", v.WeeklyPercent)
+			}
+		}
+	}
+}
+
+func validateAccrual(r *configReport, cfg model.AccrualConfig) {
+	if cfg.Enabled && cfg.StartAt <= 0 {
+		r.errorf("accrual.start_at", "required when accrual is enabled, set it to the unix time accrual starts from")
+	}
+	if cfg.StartAt > 0 && cfg.StartAt < time.Now().AddDate(0, 0, -7).Unix() {
+		r.warnf("accrual.start_at", "lies more than a week in the past, the weeks since are credited on the first run")
+	}
+	if cfg.PlatformFeePercent < 0 || cfg.PlatformFeePercent >= 100 {
+		r.errorf("accrual.platform_fee_percent", "must be between 0 and 100, got %g", cfg.PlatformFeePercent)
+	}
+}
+
+func validateReferrals(r *configReport, cfg model.ReferralConfig, feePercent float64) {
+	levels := []float64{cfg.Level1Percent, cfg.Level2Percent, cfg.Level3Percent}
+	sum := 0.0
+	for i, percent := range levels {
+		if percent < 0 {
+			r.errorf(fmt.Sprintf("referral_config.level%d_percent", i+1), "must not be negative, got %g", percent)
+		}
+		sum += percent
+	}
+	for i := 1; i < len(levels); i++ {
+		if levels[i] > levels[i-1] {
+			r.warnf(fmt.Sprintf("referral_config.level%d_percent", i+1),
+				"%g%% is more than level %d (%g%%), deeper referrers usually earn less", levels[i], i, levels[i-1])
+		}
+	}
+
+	// Referral earnings are paid on top of the referred user's profit
+	switch {
+	case sum >= 100:
+		r.errorf("referral_config", "levels sum to %g%%, referrers would earn more than the profit they are paid on", sum)
+	case sum > feePercent:
+		r.warnf("referral_config", "levels sum to %g%%, more than the %g%% platform fee", sum, feePercent)
+	}
+	if cfg.AttributionFixDays < 0 {
+		r.errorf("referral_config.attribution_fix_days", "must not be negative, got %d", cfg.AttributionFixDays)
+	}
+	if cfg.Caps.Daily < 0 {
+		r.errorf("referral_config.caps.daily", "must not be negative, got %g", cfg.Caps.Daily)
+	}
+	if cfg.Caps.Total < 0 {
+		r.errorf("referral_config.caps.total", "must not be negative, got %g", cfg.Caps.Total)
+	}
+	if cfg.Caps.Daily > 0 && cfg.Caps.Total > 0 && cfg.Caps.Daily > cfg.Caps.Total {
+		r.warnf("referral_config.caps.daily", "%g TON is more than the total cap of %g TON", cfg.Caps.Daily, cfg.Caps.Total)
+	}
+}
+
+func validateAdminKey(r *configReport, key string) {
+	switch {
+	case key == "":
+		r.warnf("admin_api_key", "missing, only stored admin keys are accepted and none can be created without one (set it or ADMIN_API_KEY)")
+	case key == sampleAdminAPIKey:
+		r.warnf("admin_api_key", "still the example key, generate a new one")
+	case len(key) < 16:
+		r.warnf("admin_api_key", "only %d characters, use at least 16", len(key))
+	}
+}
+
+func validateAuth(r *configReport, cfg model.Config) {
+	switch {
+	case cfg.Auth.JWTSecret == "":
+		r.errorf("auth.jwt_secret", "missing, wallet sessions can't be signed")
+	case len(cfg.Auth.JWTSecret) < 32:
+		r.warnf("auth.jwt_secret", "only %d characters, use at least 32", len(cfg.Auth.JWTSecret))
+	}
+	if len(cfg.Auth.AllowedDomains) == 0 && cfg.Telegram.WebAppURL == "" {
+		r.errorf("auth.allowed_domains", "empty and telegram.web_app_url isn't set, no ton_proof domain would be accepted")
+	}
+}
+
+func validateTON(r *configReport, cfg model.Config) {
+	ton := cfg.TON
+	if ton.Network != "mainnet" && ton.Network != "testnet" {
+		r.errorf("ton.network", "must be mainnet or testnet, got %q", ton.Network)
+	}
+
+	if ton.Mnemonic == "" {
+		r.errorf("ton.mnemonic", "missing, the treasury wallet can't be derived (set it or TON_MNEMONIC)")
+	} else {
+		validateMnemonic(r, "ton.mnemonic", ton.Mnemonic)
+	}
+
+	switch ton.WalletVersion {
+	case "":
+		r.warnf("ton.wallet_version", "not set, using V4R2")
+	case "V3R1", "V3R2", "V4R1", "V4R2", "HighloadV2R2":
+	default:
+		r.errorf("ton.wallet_version", "unknown version %q", ton.WalletVersion)
+	}
+
+	if ton.FeeWalletAddress == "" {
+		r.errorf("ton.fee_wallet_address", "missing, platform fees of deposits can't be transferred")
+	} else {
+		validateAddress(r, "ton.fee_wallet_address", ton.FeeWalletAddress, ton.Network)
+	}
+	for i, wallet := range cfg.Indexer.ExtraWallets {
+		validateAddress(r, fmt.Sprintf("indexer.extra_wallets[%d]", i), wallet, ton.Network)
+	}
+	symbols := make([]string, 0, len(ton.Jettons))
+	for symbol := range ton.Jettons {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		j := ton.Jettons[symbol]
+		field := "ton.jettons." + symbol
+		if j.Master == "" {
+			r.errorf(field+".master", "missing, the jetton balance can't be fetched")
+		} else {
+			validateAddress(r, field+".master", j.Master, ton.Network)
+		}
+		if j.Decimals < 0 || j.Decimals > 18 {
+			r.errorf(field+".decimals", "must be between 0 and 18, got %d", j.Decimals)
+		}
+	}
+
+	if ton.APIKey == "" {
+		r.warnf("ton.api_key", "missing, toncenter is limited to 1 request per second")
+	}
+	if ton.Toncenter.RequestsPerSecond < 0 {
+		r.errorf("ton.toncenter.requests_per_second", "must not be negative, got %g", ton.Toncenter.RequestsPerSecond)
+	}
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"max_retries", ton.Toncenter.MaxRetries},
+		{"retry_backoff_ms", ton.Toncenter.RetryBackoffMs},
+		{"request_timeout_ms", ton.Toncenter.RequestTimeoutMs},
+		{"breaker_failures", ton.Toncenter.BreakerFailures},
+		{"breaker_cooldown_seconds", ton.Toncenter.BreakerCooldownSeconds},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			r.errorf("ton.toncenter."+l.field, "must not be negative, got %d", l.value)
+		}
+	}
+
+	routed := make(map[string]bool)
+	for _, t := range cfg.InvestmentTypes {
+		routed[t.TreasuryWallet] = true
+	}
+	names := make([]string, 0, len(ton.TreasuryWallets))
+	for name := range ton.TreasuryWallets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w := ton.TreasuryWallets[name]
+		field := "ton.treasury_wallets." + name
+		if name == "" || name == model.TreasuryWalletMain {
+			r.errorf(field, "%q is reserved for the main wallet", name)
+		}
+		validateMnemonic(r, field+".mnemonic", w.Mnemonic)
+		if w.Mnemonic == ton.Mnemonic {
+			r.errorf(field+".mnemonic", "same as ton.mnemonic, deposits wouldn't be segregated")
+		}
+		switch w.WalletVersion {
+		case "", "V3R1", "V3R2", "V4R1", "V4R2", "HighloadV2R2":
+		default:
+			r.errorf(field+".wallet_version", "unknown version %q", w.WalletVersion)
+		}
+		if !routed[name] {
+			r.warnf(field, "no investment type routes deposits to this wallet")
+		}
+	}
+}
+
+// validateAddress checks a wallet address is valid and meant for the configured network
+func validateAddress(r *configReport, field, addr, network string) {
+	parsed, err := address.ParseAddr(addr)
+	if err != nil {
+		r.errorf(field, "invalid address %q: %v", addr, err)
+		return
+	}
+	if parsed.IsTestnetOnly() && network == "mainnet" {
+		r.warnf(field, "testnet-only address on mainnet")
+	}
+}
+
+func validateRateLimit(r *configReport, cfg model.RateLimitConfig) {
+	if cfg.RequestsPerSecond <= 0 {
+		r.errorf("rate_limit.requests_per_second", "must be positive, got %d", cfg.RequestsPerSecond)
+	}
+	if cfg.BurstSize <= 0 {
+		r.errorf("rate_limit.burst_size", "must be positive, got %d", cfg.BurstSize)
+	} else if cfg.BurstSize < cfg.RequestsPerSecond {
+		r.warnf("rate_limit.burst_size", "%d is below requests_per_second (%d)", cfg.BurstSize, cfg.RequestsPerSecond)
+	}
+
+	for name, tier := range cfg.Tiers {
+		field := "rate_limit.tiers." + name
+		if tier.RequestsPerSecond <= 0 || tier.BurstSize <= 0 {
+			r.errorf(field, "requests_per_second and burst_size must be positive")
+		} else if tier.RequestsPerSecond < cfg.RequestsPerSecond || tier.BurstSize < cfg.BurstSize {
+			r.warnf(field, "bucket is smaller than the anonymous one")
+		}
+	}
+	if cfg.TokenTier != "" {
+		if _, ok := cfg.Tiers[cfg.TokenTier]; !ok {
+			r.errorf("rate_limit.token_tier", "tier %q is not configured in rate_limit.tiers", cfg.TokenTier)
+		}
+	}
+
+	switch cfg.Store.Backend {
+	case "", middleware.BackendMemory:
+	case middleware.BackendRedis:
+		if cfg.Store.Redis.Address == "" {
+			r.errorf("rate_limit.store.redis.address", "missing, the shared buckets can't be reached")
+		} else if _, _, err := net.SplitHostPort(cfg.Store.Redis.Address); err != nil {
+			r.errorf("rate_limit.store.redis.address", "expected host:port, got %q", cfg.Store.Redis.Address)
+		}
+		if cfg.Store.Redis.TimeoutMs < 0 {
+			r.errorf("rate_limit.store.redis.timeout_ms", "must not be negative, got %d", cfg.Store.Redis.TimeoutMs)
+		}
+	default:
+		r.errorf("rate_limit.store.backend", "unknown backend %q, expected memory or redis", cfg.Store.Backend)
+	}
+
+	names := make(map[string]bool)
+	for n, route := range cfg.Routes {
+		field := fmt.Sprintf("rate_limit.routes[%d]", n)
+		switch {
+		case route.Name == "":
+			r.errorf(field+".name", "missing, it keys the buckets")
+		case names[route.Name]:
+			r.errorf(field+".name", "%q is used by another route group", route.Name)
+		}
+		names[route.Name] = true
+		if route.RequestsPerSecond <= 0 || route.BurstSize <= 0 {
+			r.errorf(field, "requests_per_second and burst_size must be positive")
+		}
+		if len(route.Routes) == 0 {
+			r.warnf(field+".routes", "empty, the group limits nothing")
+		}
+		for k, pattern := range route.Routes {
+			path := pattern
+			if _, p, ok := strings.Cut(pattern, " "); ok {
+				path = strings.TrimSpace(p)
+			}
+			if !strings.HasPrefix(path, "/") {
+				r.errorf(fmt.Sprintf("%s.routes[%d]", field, k), "expected a route like \"POST /api/v1/users/withdraw\", got %q", pattern)
+			}
+		}
+	}
+
+	cleanup := cfg.Cleanup
+	if cleanup.IntervalSeconds < 0 {
+		r.errorf("rate_limit.cleanup.interval_seconds", "must not be negative, got %d", cleanup.IntervalSeconds)
+	}
+	if cleanup.MaxEntries < 0 {
+		r.errorf("rate_limit.cleanup.max_entries", "must not be negative, got %d", cleanup.MaxEntries)
+	}
+	if cleanup.IdleTTLSeconds < 0 {
+		r.errorf("rate_limit.cleanup.idle_ttl_seconds", "must not be negative, got %d", cleanup.IdleTTLSeconds)
+	} else if cleanup.IdleTTLSeconds > 0 && cfg.RequestsPerSecond > 0 && cleanup.IdleTTLSeconds < cfg.BurstSize/cfg.RequestsPerSecond {
+		r.warnf("rate_limit.cleanup.idle_ttl_seconds", "%ds is shorter than an empty bucket takes to refill (%ds), dropped clients start with a full burst early",
+			cleanup.IdleTTLSeconds, cfg.BurstSize/cfg.RequestsPerSecond)
+	}
+
+	bypass := cfg.Bypass
+	if len(bypass.AllowedOrigins) == 0 {
+		return
+	}
+	if bypass.Secret == "" {
+		r.errorf("rate_limit.bypass.secret", "missing while allowed_origins is set, tokens can't be signed")
+	} else if len(bypass.Secret) < 32 {
+		r.warnf("rate_limit.bypass.secret", "only %d characters, use at least 32", len(bypass.Secret))
+	}
+	if bypass.IssuePerHour < 0 || bypass.IssueBurstSize < 0 {
+		r.errorf("rate_limit.bypass", "issue_per_hour and issue_burst_size must not be negative")
+	}
+	if bypass.RequestsPerSecond < cfg.RequestsPerSecond || bypass.BurstSize < cfg.BurstSize {
+		r.warnf("rate_limit.bypass", "bucket is smaller than the anonymous one")
+	}
+	for i, origin := range bypass.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" {
+			r.errorf(fmt.Sprintf("rate_limit.bypass.allowed_origins[%d]", i), "%q is not an origin like https://example.com", origin)
+		}
+	}
+}
+
+func validateDeposit(r *configReport, cfg model.DepositConfig) {
+	for i, tier := range cfg.ConfirmationTiers {
+		if tier.MinAmount < 0 || tier.MinAgeSeconds < 0 {
+			r.errorf(fmt.Sprintf("deposit.confirmation_tiers[%d]", i), "min_amount and min_age_seconds must not be negative")
+		}
+	}
+	for i := 1; i < len(cfg.AmountBuckets); i++ {
+		if cfg.AmountBuckets[i] <= cfg.AmountBuckets[i-1] {
+			r.errorf("deposit.amount_buckets", "must be in ascending order")
+			break
+		}
+	}
+	if cfg.ArchiveLookup.MaxPages < 0 {
+		r.errorf("deposit.archive_lookup.max_pages", "must not be negative, got %d", cfg.ArchiveLookup.MaxPages)
+	}
+	switch window := int(depositCheckWindow.Minutes()); {
+	case cfg.ExpireAfterMinutes < 0:
+		r.errorf("deposit.expire_after_minutes", "must not be negative, got %d", cfg.ExpireAfterMinutes)
+	case cfg.ExpireAfterMinutes > 0 && cfg.ExpireAfterMinutes < window:
+		r.warnf("deposit.expire_after_minutes", "%d expires requests within the %d minutes a transfer is looked up, paid ones may expire", cfg.ExpireAfterMinutes, window)
+	}
+	switch tolerance := cfg.Matching.Tolerance; {
+	case tolerance < 0:
+		r.errorf("deposit.matching.tolerance", "must not be negative, got %g", tolerance)
+	case tolerance > 0 && cfg.Limits.MinAmount > 0 && tolerance >= cfg.Limits.MinAmount:
+		r.warnf("deposit.matching.tolerance", "%g reaches the minimum deposit of %g TON, transfers of almost nothing are credited for the smallest requests", tolerance, cfg.Limits.MinAmount)
+	}
+
+	limits := cfg.Limits
+	checkLimit := func(field string, min, max float64) {
+		switch {
+		case min < 0 || max < 0:
+			r.errorf(field, "min_amount and max_amount must not be negative")
+		case max > 0 && min > max:
+			r.errorf(field, "min_amount %g is above max_amount %g, no deposit fits", min, max)
+		}
+	}
+	checkLimit("deposit.limits", limits.MinAmount, limits.MaxAmount)
+	for name, tier := range limits.Tiers {
+		field := "deposit.limits.tiers." + name
+		if name != model.DepositLimitVerified {
+			r.warnf(field, "unknown tier, expected %s", model.DepositLimitVerified)
+		}
+		min, max := limits.MinAmount, limits.MaxAmount
+		if tier.MinAmount != 0 {
+			min = tier.MinAmount
+		}
+		if tier.MaxAmount != 0 {
+			max = tier.MaxAmount
+		}
+		checkLimit(field, min, max)
+	}
+}
+
+func validateDepositAddresses(r *configReport, da model.DepositAddressesConfig) {
+	if da.SweepIntervalSeconds < 0 || da.SweepWindowHours < 0 || da.MinSweepAmount < 0 {
+		r.errorf("deposit_addresses", "sweep_interval_seconds, sweep_window_hours and min_sweep_amount must not be negative")
+	}
+	if !da.Enabled {
+		return
+	}
+	if da.MinSweepAmount > 0 && da.MinSweepAmount < 0.01 {
+		r.warnf("deposit_addresses.min_sweep_amount", "%g TON barely covers the sweep fees", da.MinSweepAmount)
+	}
+}
+
+func validateWithdrawalApproval(r *configReport, cfg model.Config) {
+	threshold := cfg.WithdrawalApproval.Threshold
+	if threshold < 0 {
+		r.errorf("withdrawal_approval.threshold", "must not be negative, got %g", threshold)
+	}
+	if threshold > 0 && !cfg.Alerts.Enabled {
+		r.warnf("withdrawal_approval.threshold", "alerts are disabled, operators aren't notified of withdrawals waiting for approval")
+	}
+}
+
+func validateWithdrawalBatching(r *configReport, cfg model.Config) {
+	b := cfg.WithdrawalBatching
+	if b.IntervalMinutes < 0 || b.IntervalMinutes > 24*60 {
+		r.errorf("withdrawal_batching.interval_minutes", "must be between 0 and 1440, got %d", b.IntervalMinutes)
+	}
+	if b.MaxAmount < 0 {
+		r.errorf("withdrawal_batching.max_amount", "must not be negative, got %g", b.MaxAmount)
+	}
+	if b.MaxMessages < 0 {
+		r.errorf("withdrawal_batching.max_messages", "must not be negative, got %d", b.MaxMessages)
+	}
+	if !b.Enabled {
+		return
+	}
+	if b.MaxAmount == 0 {
+		r.warnf("withdrawal_batching.max_amount", "0, no withdrawal is batched")
+	}
+	if b.MaxMessages > 4 && cfg.TON.WalletVersion != "HighloadV2R2" {
+		r.warnf("withdrawal_batching.max_messages", "only HighloadV2R2 wallets send more than 4 messages at once, batches from other wallets are capped to 4")
+	}
+	if b.MaxMessages > 254 {
+		r.warnf("withdrawal_batching.max_messages", "highload wallets send at most 254 messages at once, batches are capped to 254")
+	}
+}
+
+func validateAddressBook(r *configReport, cfg model.AddressBookConfig) {
+	if cfg.MaxEntries < 0 {
+		r.errorf("address_book.max_entries", "must not be negative, got %d", cfg.MaxEntries)
+	}
+	if cfg.WithdrawalDelayHours != 0 && (cfg.WithdrawalDelayHours < minAddressDelayHours || cfg.WithdrawalDelayHours > maxAddressDelayHours) {
+		r.errorf("address_book.withdrawal_delay_hours", "must be between %d and %d, got %d", minAddressDelayHours, maxAddressDelayHours, cfg.WithdrawalDelayHours)
+	}
+}
+
+func validateWithdrawalLimits(r *configReport, cfg model.WithdrawalLimitsConfig) {
+	switch {
+	case cfg.MinAmount < 0 || cfg.MaxAmount < 0 || cfg.DailyAmount < 0:
+		r.errorf("withdrawal_limits", "min_amount, max_amount and daily_amount must not be negative")
+	case cfg.CooldownHours < 0:
+		r.errorf("withdrawal_limits.cooldown_hours", "must not be negative, got %d", cfg.CooldownHours)
+	case cfg.MaxAmount > 0 && cfg.MinAmount > cfg.MaxAmount:
+		r.errorf("withdrawal_limits", "min_amount %g is above max_amount %g, no withdrawal fits", cfg.MinAmount, cfg.MaxAmount)
+	case cfg.DailyAmount > 0 && cfg.MinAmount > cfg.DailyAmount:
+		r.errorf("withdrawal_limits", "min_amount %g is above daily_amount %g, no withdrawal fits", cfg.MinAmount, cfg.DailyAmount)
+	}
+}
+
+func validateWithdrawalRetry(r *configReport, cfg model.WithdrawalRetryConfig) {
+	if cfg.MaxAttempts < 0 || cfg.BackoffSeconds < 0 || cfg.MaxBackoffSeconds < 0 || cfg.StuckAfterMinutes < 0 {
+		r.errorf("withdrawal_retry", "max_attempts, backoff_seconds, max_backoff_seconds and stuck_after_minutes must not be negative")
+		return
+	}
+	if cfg.BackoffSeconds > 0 && cfg.MaxBackoffSeconds > 0 && cfg.BackoffSeconds > cfg.MaxBackoffSeconds {
+		r.warnf("withdrawal_retry.backoff_seconds", "%d is above max_backoff_seconds %d, every retry waits %ds", cfg.BackoffSeconds, cfg.MaxBackoffSeconds, cfg.MaxBackoffSeconds)
+	}
+}
+
+func validateRiskDisclaimer(r *configReport, cfg model.RiskDisclaimerConfig) {
+	if cfg.WeeklyPercentThreshold < 0 {
+		r.errorf("risk_disclaimer.weekly_percent_threshold", "must not be negative, got %g", cfg.WeeklyPercentThreshold)
+	}
+	if cfg.TokenTTLMinutes < 0 {
+		r.errorf("risk_disclaimer.token_ttl_minutes", "must not be negative, got %d", cfg.TokenTTLMinutes)
+	}
+	if cfg.WeeklyPercentThreshold > 0 && cfg.Text == "" {
+		r.warnf("risk_disclaimer.text", "no disclaimer text, users acknowledge an empty disclaimer")
+	}
+	if cfg.WeeklyPercentThreshold > 0 && cfg.Version == "" {
+		r.warnf("risk_disclaimer.version", "acknowledgments are stored without a disclaimer version")
+	}
+}
+
+func validateRates(r *configReport, cfg model.RatesConfig) {
+	for i, name := range cfg.Providers {
+		field := fmt.Sprintf("rates.providers[%d]", i)
+		switch name {
+		case "coingecko", "tonapi":
+		case "coinmarketcap":
+			if cfg.CoinMarketCapAPIKey == "" {
+				r.warnf(field, "coinmarketcap is skipped without rates.coinmarketcap_api_key")
+			}
+		default:
+			r.errorf(field, "unknown rate provider %q, expected coingecko, coinmarketcap or tonapi", name)
+		}
+	}
+
+	limits := []struct {
+		field string
+		value int
+	}{
+		{"rates.ttl_seconds", cfg.TTLSeconds},
+		{"rates.refresh_interval_seconds", cfg.RefreshIntervalSeconds},
+		{"rates.max_stale_seconds", cfg.MaxStaleSeconds},
+		{"rates.request_timeout_ms", cfg.RequestTimeoutMs},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			r.errorf(l.field, "must not be negative, got %d", l.value)
+		}
+	}
+
+	ttl, refresh := cfg.TTLSeconds, cfg.RefreshIntervalSeconds
+	if ttl == 0 {
+		ttl = 300
+	}
+	if refresh == 0 {
+		refresh = 240
+	}
+	if refresh > ttl {
+		r.warnf("rates.refresh_interval_seconds", "prices expire after %ds but are refreshed every %ds, some requests wait for a price API", ttl, refresh)
+	}
+	if cfg.MaxStaleSeconds > 0 && cfg.MaxStaleSeconds < ttl {
+		r.warnf("rates.max_stale_seconds", "shorter than the TTL, stale prices are never served")
+	}
+}
+
+func validateLogging(r *configReport, cfg model.LoggingConfig) {
+	if _, err := logging.ParseLevel(cfg.Level); err != nil {
+		r.errorf("logging.level", "%v, expected debug, info, warn or error", err)
+	}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text", "json":
+	default:
+		r.errorf("logging.format", "unknown format %q, expected text or json", cfg.Format)
+	}
+}
+
+// validateMnemonic checks a plain mnemonic has 24 words and an encrypted one can be read
+func validateMnemonic(r *configReport, field string, mnemonic string) {
+	if !keystore.IsEncrypted(mnemonic) {
+		if words := len(strings.Fields(mnemonic)); words != 24 {
+			r.errorf(field, "has %d words, expected 24", words)
+		}
+		return
+	}
+	if err := keystore.Validate(mnemonic); err != nil {
+		r.errorf(field, "%v", err)
+	}
+}
+
+func validateAccessLog(r *configReport, cfg model.AccessLogConfig) {
+	if cfg.RetentionDays < 0 {
+		r.errorf("access_log.retention_days", "must not be negative, got %d", cfg.RetentionDays)
+	} else if cfg.Enabled && cfg.RetentionDays > 0 && cfg.RetentionDays < 7 {
+		r.warnf("access_log.retention_days", "only %d days, entries may be gone before an incident is investigated", cfg.RetentionDays)
+	}
+}
+
+func validateIntegrity(r *configReport, cfg model.IntegrityConfig) {
+	if cfg.SampleSize < 0 {
+		r.errorf("integrity.sample_size", "must not be negative, got %d", cfg.SampleSize)
+	}
+	for i, name := range cfg.AutoRepair {
+		field := fmt.Sprintf("integrity.auto_repair[%d]", i)
+		advice, ok := integrityAdvice[name]
+		switch {
+		case !ok:
+			r.errorf(field, "unknown check %q", name)
+		case !advice.repairable:
+			r.errorf(field, "%s has no automatic repair, repairable checks: %s", name, strings.Join(repairableIntegrityChecks(), ", "))
+		}
+	}
+	if len(cfg.AutoRepair) > 0 && !cfg.CheckOnStartup {
+		r.warnf("integrity.auto_repair", "ignored, integrity.check_on_startup is off")
+	}
+}
+
+func validateReadOnly(r *configReport, cfg model.ReadOnlyConfig) {
+	if cfg.ProbeIntervalSeconds < 0 {
+		r.errorf("read_only.probe_interval_seconds", "must not be negative, got %d", cfg.ProbeIntervalSeconds)
+	}
+}
+
+func validateIdempotency(r *configReport, cfg model.IdempotencyConfig) {
+	if cfg.TTLHours < 0 {
+		r.errorf("idempotency.ttl_hours", "must not be negative, got %d", cfg.TTLHours)
+	}
+}
+
+func validateVIP(r *configReport, cfg model.Config) {
+	vip := cfg.VIP
+	if vip.RecalculateIntervalSeconds < 0 {
+		r.errorf("vip.recalculate_interval_seconds", "must not be negative, got %d", vip.RecalculateIntervalSeconds)
+	}
+	if vip.Enabled && len(vip.Tiers) == 0 {
+		r.warnf("vip.tiers", "vip is enabled without tiers, nobody is ranked")
+	}
+
+	referralPercent := cfg.ReferralConfig.Level1Percent + cfg.ReferralConfig.Level2Percent + cfg.ReferralConfig.Level3Percent
+	names := make(map[string]bool, len(vip.Tiers))
+	for i, tier := range vip.Tiers {
+		field := fmt.Sprintf("vip.tiers[%d]", i)
+		if tier.Name == "" {
+			r.errorf(field+".name", "required")
+		} else if names[tier.Name] {
+			r.errorf(field+".name", "duplicate tier name %q", tier.Name)
+		}
+		names[tier.Name] = true
+
+		if tier.MinInvested < 0 {
+			r.errorf(field+".min_invested", "must not be negative, got %g", tier.MinInvested)
+		} else if i > 0 && tier.MinInvested <= vip.Tiers[i-1].MinInvested {
+			r.errorf(field+".min_invested", "%g TON is not above the %g TON of %s, tiers must be ascending", tier.MinInvested, vip.Tiers[i-1].MinInvested, vip.Tiers[i-1].Name)
+		}
+		if tier.FeeDiscountPercent < 0 || tier.FeeDiscountPercent > 100 {
+			r.errorf(field+".fee_discount_percent", "must be between 0 and 100, got %g", tier.FeeDiscountPercent)
+		} else if fee := vipFeePercent(platformFeePercent(cfg.Accrual), &tier); fee < referralPercent {
+			r.warnf(field+".fee_discount_percent", "lowers the platform fee to %g%%, less than the %g%% paid to referrers", fee, referralPercent)
+		}
+		if tier.WeeklyPercentBonus < 0 {
+			r.errorf(field+".weekly_percent_bonus", "must not be negative, got %g", tier.WeeklyPercentBonus)
+		} else if tier.WeeklyPercentBonus > 5 {
+			r.warnf(field+".weekly_percent_bonus", "%g%% more per week is unusually high", tier.WeeklyPercentBonus)
+		}
+	}
+}
+
+func validateChainWebhooks(r *configReport, cfg model.Config) {
+	hooks := []struct {
+		field string
+		hook  model.ChainWebhookConfig
+	}{
+		{"chain_webhooks.tonapi", cfg.ChainWebhooks.TonAPI},
+		{"chain_webhooks.toncenter", cfg.ChainWebhooks.Toncenter},
+	}
+	for _, h := range hooks {
+		field, hook := h.field, h.hook
+		if !hook.Enabled {
+			continue
+		}
+		if hook.Secret == "" {
+			r.errorf(field+".secret", "missing, webhook signatures can't be verified")
+		} else if len(hook.Secret) < 32 {
+			r.warnf(field+".secret", "only %d characters, use at least 32", len(hook.Secret))
+		}
+		if !cfg.Indexer.Enabled {
+			r.warnf(field, "indexer is disabled, every event queries the chain once per pending deposit")
+		}
+	}
+}
+
+func validateIntegrations(r *configReport, cfg model.Config) {
+	if cfg.Telegram.WebAppURL != "" {
+		if u, err := url.Parse(cfg.Telegram.WebAppURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			r.warnf("telegram.web_app_url", "%q is not an https URL, Telegram won't open it", cfg.Telegram.WebAppURL)
+		}
+	}
+
+	if cfg.Telegram.BotEnabled {
+		if cfg.Telegram.BotToken == "" {
+			r.errorf("telegram.bot_token", "required by telegram.bot_enabled")
+		}
+		if cfg.Telegram.WebAppURL == "" {
+			r.warnf("telegram.web_app_url", "missing, the bot has no button to open the app")
+		}
+		if cfg.Telegram.PollTimeoutSeconds < 0 || cfg.Telegram.PollTimeoutSeconds > 50 {
+			r.errorf("telegram.poll_timeout_seconds", "must be between 0 and 50, got %d", cfg.Telegram.PollTimeoutSeconds)
+		}
+	}
+	if stars := cfg.Payments.TelegramStars; stars.Enabled {
+		if cfg.Telegram.BotToken == "" {
+			r.errorf("telegram.bot_token", "required by payments.telegram_stars")
+		}
+		if stars.WebhookSecret == "" {
+			r.errorf("payments.telegram_stars.webhook_secret", "missing, anyone could fake payment webhooks")
+		}
+		if stars.TONPerStar <= 0 {
+			r.errorf("payments.telegram_stars.ton_per_star", "must be positive, got %g", stars.TONPerStar)
+		}
+	}
+
+	if cfg.Dormancy.Enabled {
+		for i, rule := range cfg.Dormancy.Rules {
+			field := fmt.Sprintf("dormancy.rules[%d]", i)
+			if rule.Action != model.DormancyActionNotify && rule.Action != model.DormancyActionCloseFlexibleInvestments {
+				r.errorf(field+".action", "unknown action %q", rule.Action)
+			}
+			if rule.GraceDays < 0 || rule.GraceDays >= rule.InactiveDays {
+				r.errorf(field+".grace_days", "must be between 0 and inactive_days (%d)", rule.InactiveDays)
+			}
+		}
+	}
+	if alerts := cfg.Alerts; alerts.Enabled {
+		if alerts.TelegramChatID == "" && alerts.WebhookURL == "" {
+			r.warnf("alerts", "no telegram_chat_id or webhook_url, alerts are only listed by the admin API")
+		}
+		if alerts.TelegramChatID != "" && cfg.Telegram.BotToken == "" {
+			r.errorf("telegram.bot_token", "required by alerts.telegram_chat_id")
+		}
+		if alerts.WebhookURL != "" {
+			if u, err := url.Parse(alerts.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				r.errorf("alerts.webhook_url", "%q is not an http(s) URL", alerts.WebhookURL)
+			}
+			if alerts.WebhookSecret == "" {
+				r.warnf("alerts.webhook_secret", "missing, the receiver can't verify alerts come from this server")
+			}
+		}
+
+		if alerts.LargeWithdrawalAmount < 0 {
+			r.errorf("alerts.large_withdrawal_amount", "can't be negative, got %g", alerts.LargeWithdrawalAmount)
+		}
+
+		names := make(map[string]bool, len(alerts.Rules))
+		for i, rule := range alerts.Rules {
+			field := fmt.Sprintf("alerts.rules[%d]", i)
+			if rule.Name == "" {
+				r.errorf(field+".name", "required")
+			} else if names[rule.Name] {
+				r.errorf(field+".name", "duplicate rule name %q", rule.Name)
+			}
+			names[rule.Name] = true
+
+			switch rule.Type {
+			case model.AlertRuleWithdrawalFailureRate:
+				if rule.Threshold < 0 || rule.Threshold >= 100 {
+					r.errorf(field+".threshold", "must be a percentage between 0 and 100, got %g", rule.Threshold)
+				}
+			case model.AlertRulePendingDepositAge, model.AlertRuleHotWalletBalance:
+				if rule.Threshold <= 0 {
+					r.errorf(field+".threshold", "must be positive, got %g", rule.Threshold)
+				}
+			case model.AlertRuleToncenterErrors:
+				if rule.Threshold < 0 {
+					r.errorf(field+".threshold", "can't be negative, got %g", rule.Threshold)
+				}
+			default:
+				r.errorf(field+".type", "unknown type %q", rule.Type)
+			}
+			if rule.WindowMinutes < 0 || rule.MinCount < 0 || rule.RepeatMinutes < 0 {
+				r.errorf(field, "window_minutes, min_count and repeat_minutes can't be negative")
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"time"
+
+	"tonapp/internal/logging"
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidConfig is returned by ReloadConfigFile for a file with fatal issues
+var errInvalidConfig = errors.New("config has errors, kept the running config")
+
+// loadedConfig is a config with the time it was loaded. It is never modified once
+// stored, a reload stores a new one.
+type loadedConfig struct {
+	model.Config
+	at time.Time
+}
+
+// config returns the config in use. Callers that look at it more than once while the
+// config may be reloaded, like loops over a slice, should keep the pointer.
+func (h *Handler) config() *model.Config {
+	return &h.loaded.Load().Config
+}
+
+// configLoadedAt is the Last-Modified baseline of the public config
+func (h *Handler) configLoadedAt() time.Time {
+	return h.loaded.Load().at
+}
+
+// readConfig reads and parses a config file without checking it, with the secrets set
+// in the environment applied. It returns the environment variables used.
+func readConfig(configPath string) (model.Config, []string, error) {
+	var config model.Config
+	configFile, err := os.ReadFile(configPath)
+	if err != nil {
+		return config, nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := json.Unmarshal(configFile, &config); err != nil {
+		return config, nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	secrets, err := applySecrets(&config)
+	if err != nil {
+		return config, nil, err
+	}
+	return config, secrets, nil
+}
+
+// OnConfigReload registers a function called with every config ReloadConfigFile
+// applies, for components built from the config outside the handler such as the
+// rate limiter
+func (h *Handler) OnConfigReload(fn func(model.Config)) {
+	h.configReloaded = append(h.configReloaded, fn)
+}
+
+// keepRestartOnly copies the settings the clients created at startup were built from
+// from the running config into the new one, returning the sections that changed
+func keepRestartOnly(running model.Config, next *model.Config) []string {
+	var changed []string
+	check := func(section string, running, next interface{}) {
+		if !reflect.DeepEqual(running, next) {
+			changed = append(changed, section)
+		}
+	}
+
+	check("ton", running.TON, next.TON)
+	next.TON = running.TON
+	check("telegram.bot_token", running.Telegram.BotToken, next.Telegram.BotToken)
+	next.Telegram.BotToken = running.Telegram.BotToken
+	check("payments", running.Payments, next.Payments)
+	next.Payments = running.Payments
+	check("alerts.telegram_chat_id", running.Alerts.TelegramChatID, next.Alerts.TelegramChatID)
+	next.Alerts.TelegramChatID = running.Alerts.TelegramChatID
+	check("alerts.webhook_url", running.Alerts.WebhookURL, next.Alerts.WebhookURL)
+	next.Alerts.WebhookURL = running.Alerts.WebhookURL
+	check("alerts.webhook_secret", running.Alerts.WebhookSecret, next.Alerts.WebhookSecret)
+	next.Alerts.WebhookSecret = running.Alerts.WebhookSecret
+	check("middleware", running.Middleware, next.Middleware)
+	next.Middleware = running.Middleware
+	check("rates", running.Rates, next.Rates)
+	next.Rates = running.Rates
+	check("rate_limit.store", running.RateLimit.Store, next.RateLimit.Store)
+	next.RateLimit.Store = running.RateLimit.Store
+	return changed
+}
+
+// ReloadConfigFile reads config.json again and, if the config check finds no errors,
+// swaps it in for the running config. The TON client, payment providers, notifiers,
+// rate sources, rate limit store and middleware pipeline are built at startup and keep their settings
+// until a restart, see keepRestartOnly.
+func (h *Handler) ReloadConfigFile() (*model.ConfigReload, error) {
+	h.reloading.Lock()
+	defer h.reloading.Unlock()
+
+	config, _, err := readConfig(h.configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	report := validateConfig(config)
+	result := &model.ConfigReload{LoadedAt: h.configLoadedAt().Unix()}
+	for _, issue := range report.Issues {
+		result.Issues = append(result.Issues, model.ConfigIssue{Fatal: issue.Fatal, Field: issue.Field, Message: issue.Message})
+	}
+	if len(report.Issues) > 0 {
+		report.Log()
+	}
+	if n := report.Errors(); n > 0 {
+		slog.Error("Config reload rejected", "path", h.configPath, "errors", n)
+		return result, errInvalidConfig
+	}
+
+	result.RestartRequired = keepRestartOnly(*h.config(), &config)
+	loaded := &loadedConfig{Config: config, at: time.Now()}
+	h.loaded.Store(loaded)
+	logging.Setup(config.Logging)
+	for _, fn := range h.configReloaded {
+		fn(config)
+	}
+
+	result.Applied = true
+	result.LoadedAt = loaded.at.Unix()
+	slog.Info("Config reloaded", "path", h.configPath, "warnings", len(report.Issues), "restart_required", result.RestartRequired)
+	return result, nil
+}
+
+// ReloadConfig reloads config.json without a restart, see ReloadConfigFile (admin only)
+func (h *Handler) ReloadConfig(c *gin.Context) {
+	result, err := h.ReloadConfigFile()
+	if errors.Is(err, errInvalidConfig) {
+		c.JSON(http.StatusUnprocessableEntity, model.Response{
+			Success: false,
+			Error:   err.Error(),
+			Data:    result,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to reload config: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// personalDepositAddress returns the user's personal deposit address, assigning a
+// subwallet on first use
+func (h *Handler) personalDepositAddress(userID int) (string, error) {
+	a, err := h.db.UseDepositAddress(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to assign deposit address: %v", err)
+	}
+	return h.ton.DepositWalletAddress(a.SubwalletID)
+}
+
+// depositWalletAddress returns the address a deposit request is paid to
+func (h *Handler) depositWalletAddress(deposit *model.DepositRequest) string {
+	if deposit.DepositAddress != "" {
+		return deposit.DepositAddress
+	}
+	return h.ton.TreasuryAddress(deposit.TreasuryWallet)
+}
+
+// pendingAddressDeposit returns the user's pending deposit request paid to the personal
+// address that a transfer of the amount would be credited for, nil if none. A second
+// request would match the same transfer, so it is reused instead.
+func (h *Handler) pendingAddressDeposit(userID int, address string, amount float64) (*model.DepositRequest, error) {
+	deposits, err := h.db.GetDepositsOfUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deposits {
+		d := &deposits[i]
+		if d.Status != "pending" || d.DepositAddress != address {
+			continue
+		}
+		if credited, _ := h.depositMatch(d).Credits(amount); credited {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// StartDepositSweeper periodically moves the funds received on personal deposit
+// addresses to the main wallet
+func (h *Handler) StartDepositSweeper(ctx context.Context) {
+	if !h.config().DepositAddresses.Enabled {
+		return
+	}
+
+	interval := time.Duration(h.config().DepositAddresses.SweepIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			window := h.config().DepositAddresses.SweepWindowHours
+			if window <= 0 {
+				window = 24
+			}
+			// A sweep in progress completes on shutdown
+			result, err := h.SweepDepositAddresses(context.WithoutCancel(ctx), time.Now().Add(-time.Duration(window)*time.Hour).Unix())
+			if err != nil {
+				slog.Error("Failed to sweep deposit addresses", "error", err)
+			} else if result.Swept > 0 {
+				slog.Info("Swept deposit addresses", "count", result.Swept, "amount", money.Format(result.Amount))
+			}
+		}
+	}
+}
+
+// SweepDepositAddresses sweeps the deposit addresses used since their last sweep and
+// since usedSince. Addresses whose balance is below min_sweep_amount are checked again
+// on the next run.
+func (h *Handler) SweepDepositAddresses(ctx context.Context, usedSince int64) (model.DepositSweepResult, error) {
+	h.depositSweeping.Lock()
+	defer h.depositSweeping.Unlock()
+
+	var result model.DepositSweepResult
+	addresses, err := h.db.GetDepositAddressesToSweep(usedSince)
+	if err != nil {
+		return result, err
+	}
+
+	minAmount := h.config().DepositAddresses.MinSweepAmount
+	if minAmount <= 0 {
+		minAmount = 0.05
+	}
+	for _, a := range addresses {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Checked++
+
+		amount, txHash, err := h.ton.SweepDepositWallet(ctx, a.SubwalletID, minAmount)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to sweep deposit address", "user_id", a.UserID, "error", err)
+			result.Failed++
+			continue
+		}
+		if amount == 0 {
+			continue
+		}
+		if err := h.db.RecordDepositSweep(a.UserID, amount); err != nil {
+			slog.ErrorContext(ctx, "Failed to record deposit address sweep", "user_id", a.UserID, "amount", money.Format(amount), "tx_hash", txHash, "error", err)
+		}
+		slog.InfoContext(ctx, "Swept deposit address", "user_id", a.UserID, "amount", money.Format(amount), "tx_hash", txHash)
+		result.Swept++
+		result.Amount = money.Round(result.Amount + amount)
+	}
+	return result, nil
+}
+
+// RunDepositSweep sweeps every deposit address used since its last sweep now (admin only)
+func (h *Handler) RunDepositSweep(c *gin.Context) {
+	result, err := h.SweepDepositAddresses(c.Request.Context(), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to sweep deposit addresses: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// depositEventsHeartbeat is how often an idle stream sends a comment, so proxies
+	// keep it open and the status is read again
+	depositEventsHeartbeat = 15 * time.Second
+	// depositEventsRetry is the reconnection delay advertised to clients
+	depositEventsRetry = 3 * time.Second
+	// maxDepositEventsDuration closes streams after a while, clients reconnect if the
+	// deposit is still pending
+	maxDepositEventsDuration = 30 * time.Minute
+	// depositWatchInterval is how often the deposit watcher checks followed deposits
+	depositWatchInterval = 10 * time.Second
+)
+
+// depositWatcher wakes the event streams of deposit requests when their status changes
+// and remembers which followed deposits were detected on chain
+type depositWatcher struct {
+	mu       sync.Mutex
+	streams  map[int]map[chan struct{}]bool
+	detected map[int]bool
+}
+
+// subscribe returns a channel woken on changes of a deposit and the func ending the
+// subscription
+func (w *depositWatcher) subscribe(depositID int) (chan struct{}, func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.streams == nil {
+		w.streams = make(map[int]map[chan struct{}]bool)
+		w.detected = make(map[int]bool)
+	}
+	if w.streams[depositID] == nil {
+		w.streams[depositID] = make(map[chan struct{}]bool)
+	}
+	wake := make(chan struct{}, 1)
+	w.streams[depositID][wake] = true
+
+	return wake, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.streams[depositID], wake)
+		if len(w.streams[depositID]) == 0 {
+			delete(w.streams, depositID)
+			delete(w.detected, depositID)
+		}
+	}
+}
+
+// changed wakes the streams of a deposit
+func (w *depositWatcher) changed(depositID int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for wake := range w.streams[depositID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// markDetected records that the transfer of a followed deposit arrived and is waiting
+// for confirmations
+func (w *depositWatcher) markDetected(depositID int) {
+	w.mu.Lock()
+	if w.streams[depositID] == nil || w.detected[depositID] {
+		w.mu.Unlock()
+		return
+	}
+	w.detected[depositID] = true
+	w.mu.Unlock()
+	w.changed(depositID)
+}
+
+func (w *depositWatcher) isDetected(depositID int) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.detected[depositID]
+}
+
+// followed returns the deposits with an open stream
+func (w *depositWatcher) followed() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := make([]int, 0, len(w.streams))
+	for id := range w.streams {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// StartDepositWatcher checks the pending deposits followed by event streams for their
+// transfer, so clients don't have to poll the confirm route
+func (h *Handler) StartDepositWatcher(ctx context.Context) {
+	ticker := time.NewTicker(depositWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Matching, which forwards fees, completes on shutdown
+		for _, id := range h.depositWatcher.followed() {
+			h.watchDeposit(context.WithoutCancel(ctx), id)
+		}
+	}
+}
+
+// watchDeposit matches a followed deposit like webhook events do. Deposits older than
+// the regular check window are left to the confirm route and its archive lookup.
+func (h *Handler) watchDeposit(ctx context.Context, id int) {
+	deposit, err := h.db.GetDepositRequest(id)
+	if err != nil || deposit.Status != "pending" || deposit.CreatedAt < time.Now().Add(-depositCheckWindow).Unix() {
+		return
+	}
+	wallet := h.depositWalletAddress(deposit)
+	if wallet == "" {
+		return
+	}
+	if _, err := h.matchDeposit(wallet, deposit); err != nil && err != ton.ErrAwaitingConfirmations {
+		slog.ErrorContext(ctx, "Failed to check followed deposit request", "deposit_id", id, "user_id", deposit.UserID, "error", err)
+	}
+}
+
+// depositEventStatus returns the streamed status of a deposit request
+func (h *Handler) depositEventStatus(deposit *model.DepositRequest) string {
+	switch deposit.Status {
+	case "pending", "processing":
+		if h.depositWatcher.isDetected(deposit.ID) {
+			return "detected"
+		}
+		return "pending"
+	}
+	return deposit.Status
+}
+
+// StreamDepositEvents streams the status of a deposit request as server-sent events,
+// the current one first and then every change, until it is completed, failed, expired
+// or cancelled. Event IDs are the status, so a client reconnecting with Last-Event-ID
+// only gets newer ones, and one that already got the final status is told to stop with 204.
+func (h *Handler) StreamDepositEvents(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid deposit id",
+		})
+		return
+	}
+	deposit, err := h.db.GetDepositRequest(id)
+	if err != nil || deposit.UserID != user.ID {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "deposit request not found",
+			Code:    model.ErrorDepositNotFound,
+		})
+		return
+	}
+
+	wake, unsubscribe := h.depositWatcher.subscribe(deposit.ID)
+	defer unsubscribe()
+
+	lastStatus := c.GetHeader("Last-Event-ID")
+	if final := h.depositEventStatus(deposit); finalDepositStatus(final) && final == lastStatus {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", depositEventsRetry.Milliseconds())
+
+	// Streams outlive the server write timeout, each write gets its own deadline
+	rc := http.NewResponseController(c.Writer)
+	heartbeat := time.NewTicker(depositEventsHeartbeat)
+	defer heartbeat.Stop()
+	closeAt := time.After(maxDepositEventsDuration)
+
+	for {
+		rc.SetWriteDeadline(time.Now().Add(2 * depositEventsHeartbeat))
+		if status := h.depositEventStatus(deposit); status != lastStatus {
+			data, _ := json.Marshal(model.DepositEvent{ID: deposit.ID, Status: status, Amount: deposit.Amount})
+			fmt.Fprintf(c.Writer, "id: %s\nevent: status\ndata: %s\n\n", status, data)
+			lastStatus = status
+		}
+		c.Writer.Flush()
+		if finalDepositStatus(lastStatus) {
+			return
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-closeAt:
+			return
+		case <-heartbeat.C:
+			rc.SetWriteDeadline(time.Now().Add(2 * depositEventsHeartbeat))
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-wake:
+		}
+
+		if deposit, err = h.db.GetDepositRequest(deposit.ID); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to get streamed deposit request", "deposit_id", id, "error", err)
+			return
+		}
+	}
+}
+
+// finalDepositStatus reports whether a deposit status doesn't change anymore
+func finalDepositStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "expired" || status == "cancelled"
+}
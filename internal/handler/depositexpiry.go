@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDepositExpireAfterMinutes = 24 * 60
+
+	// depositExpiryInterval is how often unpaid deposit requests are expired
+	depositExpiryInterval = 5 * time.Minute
+)
+
+// StartDepositExpiry periodically expires the deposit requests left unpaid for
+// deposit.expire_after_minutes
+func (h *Handler) StartDepositExpiry(ctx context.Context) {
+	ticker := time.NewTicker(depositExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := h.ExpireDeposits(time.Now()); err != nil {
+				slog.Error("Failed to expire deposit requests", "error", err)
+			} else if n > 0 {
+				slog.Info("Expired deposit requests", "count", n)
+			}
+		}
+	}
+}
+
+// ExpireDeposits marks the pending deposit requests created more than
+// deposit.expire_after_minutes before now as expired. Returns how many expired.
+func (h *Handler) ExpireDeposits(now time.Time) (int, error) {
+	after := h.config().Deposit.ExpireAfterMinutes
+	if after <= 0 {
+		after = defaultDepositExpireAfterMinutes
+	}
+
+	ids, err := h.db.ExpireDeposits(now.Add(-time.Duration(after) * time.Minute).Unix())
+	for _, id := range ids {
+		h.depositWatcher.changed(id)
+	}
+	return len(ids), err
+}
+
+// CancelDeposit cancels a deposit request of the user that wasn't paid yet. A transfer
+// sent for it afterwards isn't credited automatically.
+func (h *Handler) CancelDeposit(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid deposit id",
+		})
+		return
+	}
+	deposit, err := h.db.GetDepositRequest(id)
+	if err != nil || deposit.UserID != user.ID {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "deposit request not found",
+			Code:    model.ErrorDepositNotFound,
+		})
+		return
+	}
+
+	cancelled, err := h.db.CancelDeposit(deposit.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to cancel deposit",
+		})
+		return
+	}
+	if !cancelled {
+		// Claimed by a confirmation, or already finished
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "deposit request is not pending",
+		})
+		return
+	}
+	h.depositWatcher.changed(deposit.ID)
+	slog.InfoContext(c.Request.Context(), "Deposit request cancelled", "deposit_id", deposit.ID, "user_id", user.ID, "amount", money.Format(deposit.Amount))
+
+	deposit.Status = "cancelled"
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    deposit,
+	})
+}
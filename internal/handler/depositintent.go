@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+const (
+	defaultAbandonAfterMinutes  = 60
+	defaultReminderAfterMinutes = 30
+
+	// maxReminderAge keeps reminders from going out for old requests, e.g. when
+	// reminders are enabled for the first time
+	maxReminderAge = 7 * 24 * time.Hour
+)
+
+var defaultDepositAmountBuckets = []float64{10, 100, 1000}
+
+// StartDepositReminders periodically reminds users of deposit requests they haven't funded
+func (h *Handler) StartDepositReminders(ctx context.Context) {
+	if !h.config().Deposit.Reminder.Enabled {
+		return
+	}
+
+	interval := time.Duration(h.config().Deposit.Reminder.CheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := h.SendDepositReminders(time.Now()); err != nil {
+				slog.Error("Failed to send deposit reminders", "error", err)
+			} else if n > 0 {
+				slog.Info("Sent deposit reminders", "count", n)
+			}
+		}
+	}
+}
+
+// SendDepositReminders notifies the owners of pending deposit requests older than
+// deposit.reminder.after_minutes, once per request. Returns the number of reminders sent.
+func (h *Handler) SendDepositReminders(now time.Time) (int, error) {
+	after := h.config().Deposit.Reminder.AfterMinutes
+	if after <= 0 {
+		after = defaultReminderAfterMinutes
+	}
+
+	due, err := h.db.GetDepositsToRemind(now.Add(-maxReminderAge).Unix(), now.Add(-time.Duration(after)*time.Minute).Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, deposit := range due {
+		l := h.userLocale(deposit.UserID)
+		reminded, err := h.db.MarkDepositReminded(deposit.ID, &model.Notification{
+			UserID: deposit.UserID,
+			Kind:   "deposit_reminder",
+			Title:  l.text("deposit_reminder.title"),
+			Body:   l.text("deposit_reminder.body", l.amount(deposit.Amount), deposit.Memo),
+		})
+		if err != nil {
+			return sent, err
+		}
+		if reminded {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// depositIntentStats reports funded and abandoned deposit requests created since
+// the given time, per amount bucket
+func (h *Handler) depositIntentStats(since, now time.Time) (*model.DepositIntentStats, error) {
+	intents, err := h.db.GetDepositIntentsSince(since.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	abandonAfter := h.config().Deposit.AbandonAfterMinutes
+	if abandonAfter <= 0 {
+		abandonAfter = defaultAbandonAfterMinutes
+	}
+	bounds := h.config().Deposit.AmountBuckets
+	if len(bounds) == 0 {
+		bounds = defaultDepositAmountBuckets
+	}
+
+	stats := &model.DepositIntentStats{
+		Since:               since.Unix(),
+		AbandonAfterMinutes: abandonAfter,
+		Buckets:             make([]model.DepositIntentBucket, len(bounds)+1),
+	}
+	for i := range stats.Buckets {
+		if i > 0 {
+			stats.Buckets[i].MinAmount = bounds[i-1]
+		}
+		if i < len(bounds) {
+			max := bounds[i]
+			stats.Buckets[i].MaxAmount = &max
+		}
+	}
+
+	// Time to fund is only known for requests funded since it was recorded
+	type fundTiming struct {
+		minutes float64
+		count   int
+	}
+	timings := make(map[*model.DepositIntentBucket]*fundTiming)
+	tally := func(b *model.DepositIntentBucket, in model.DepositIntent, abandonedBefore int64) {
+		b.Created++
+		if in.RemindedAt != nil {
+			b.Reminded++
+		}
+		switch {
+		case in.Status == "completed":
+			b.Funded++
+			if in.FundedAt == nil {
+				return
+			}
+			t := timings[b]
+			if t == nil {
+				t = &fundTiming{}
+				timings[b] = t
+			}
+			t.minutes += float64(*in.FundedAt-in.CreatedAt) / 60
+			t.count++
+			if in.RemindedAt != nil && *in.FundedAt >= *in.RemindedAt {
+				b.FundedAfterReminder++
+			}
+		case in.Status == "expired" || in.Status == "cancelled" || in.CreatedAt <= abandonedBefore:
+			b.Abandoned++
+		default:
+			b.Pending++
+		}
+	}
+
+	abandonedBefore := now.Add(-time.Duration(abandonAfter) * time.Minute).Unix()
+	for _, in := range intents {
+		i := 0
+		for i < len(bounds) && in.Amount >= bounds[i] {
+			i++
+		}
+		tally(&stats.Buckets[i], in, abandonedBefore)
+		tally(&stats.Total, in, abandonedBefore)
+	}
+
+	finish := func(b *model.DepositIntentBucket) {
+		if settled := b.Funded + b.Abandoned; settled > 0 {
+			b.AbandonmentRate = float64(b.Abandoned) / float64(settled)
+		}
+		if t := timings[b]; t != nil {
+			b.AvgMinutesToFund = t.minutes / float64(t.count)
+		}
+	}
+	for i := range stats.Buckets {
+		finish(&stats.Buckets[i])
+	}
+	finish(&stats.Total)
+
+	return stats, nil
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// depositTiers lists the deposit.limits.tiers a user belongs to
+func (h *Handler) depositTiers(userID int) ([]string, error) {
+	v, err := h.db.GetUserVerification(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	var tiers []string
+	if v != nil && v.Verified {
+		tiers = append(tiers, model.DepositLimitVerified)
+	}
+	return tiers, nil
+}
+
+// raisesMaximum reports whether the maximum a is above b, 0 meaning no maximum
+func raisesMaximum(a, b float64) bool {
+	if b == 0 {
+		return false
+	}
+	return a == 0 || a > b
+}
+
+// depositLimits returns the bounds of a user's deposits: those of the tier with the
+// largest maximum among the user's tiers, else the defaults of deposit.limits
+func (h *Handler) depositLimits(userID int) (model.UserDepositLimits, error) {
+	cfg := h.config().Deposit.Limits
+	limits := model.UserDepositLimits{MinAmount: cfg.MinAmount, MaxAmount: cfg.MaxAmount}
+
+	tiers, err := h.depositTiers(userID)
+	if err != nil {
+		return limits, err
+	}
+	for _, name := range tiers {
+		tier, ok := cfg.Tiers[name]
+		if !ok {
+			continue
+		}
+		candidate := model.UserDepositLimits{Tier: name, MinAmount: cfg.MinAmount, MaxAmount: cfg.MaxAmount}
+		if tier.MinAmount > 0 {
+			candidate.MinAmount = tier.MinAmount
+		}
+		if tier.MaxAmount > 0 {
+			candidate.MaxAmount = tier.MaxAmount
+		}
+		if limits.Tier == "" || raisesMaximum(candidate.MaxAmount, limits.MaxAmount) {
+			limits = candidate
+		}
+	}
+	return limits, nil
+}
+
+// checkDepositAmount returns why an amount is out of a user's deposit limits, or nil
+func (h *Handler) checkDepositAmount(limits model.UserDepositLimits, amount float64) error {
+	if amount < limits.MinAmount {
+		return fmt.Errorf("deposits must be at least %s TON", money.Format(limits.MinAmount))
+	}
+	if limits.MaxAmount == 0 || amount <= limits.MaxAmount {
+		return nil
+	}
+	err := fmt.Errorf("deposits can be at most %s TON", money.Format(limits.MaxAmount))
+	if verified, ok := h.config().Deposit.Limits.Tiers[model.DepositLimitVerified]; ok && limits.Tier == "" &&
+		raisesMaximum(verified.MaxAmount, limits.MaxAmount) {
+		if verified.MaxAmount == 0 {
+			err = fmt.Errorf("%w, verified accounts have no maximum", err)
+		} else {
+			err = fmt.Errorf("%w, verified accounts up to %s TON", err, money.Format(verified.MaxAmount))
+		}
+	}
+	return err
+}
+
+// checkUserDeposit responds with 400 when an amount is out of the user's deposit
+// limits and returns false then
+func (h *Handler) checkUserDeposit(c *gin.Context, userID int, amount float64) bool {
+	limits, err := h.depositLimits(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposit limits",
+		})
+		return false
+	}
+	if err := h.checkDepositAmount(limits, amount); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    model.ErrorDepositLimit,
+		})
+		return false
+	}
+	return true
+}
+
+// GetUserVerification returns whether a user's identity was verified, with the deposit
+// limits that apply to them (admin only)
+func (h *Handler) GetUserVerification(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+
+	v, err := h.db.GetUserVerification(userID)
+	if err == sql.ErrNoRows {
+		v, err = &model.UserVerification{UserID: userID}, nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get verification",
+		})
+		return
+	}
+	h.respondVerification(c, v)
+}
+
+// SetUserVerification marks a user's identity verified after a KYC check, raising their
+// deposit limits to those of the verified tier, or revokes it (admin only)
+func (h *Handler) SetUserVerification(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+	var req model.SetUserVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	v, err := h.db.SetUserVerification(userID, *req.Verified, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to set verification",
+		})
+		return
+	}
+	h.respondVerification(c, v)
+}
+
+// verificationUser returns the user of the :id parameter, responding with 400 or 404
+// when there is none
+func (h *Handler) verificationUser(c *gin.Context) (int, bool) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return 0, false
+	}
+	if _, err := h.db.GetUser(userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return 0, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user",
+		})
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *Handler) respondVerification(c *gin.Context, v *model.UserVerification) {
+	limits, err := h.depositLimits(v.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposit limits",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"verification":   v,
+			"deposit_limits": limits,
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"tonapp/internal/model"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// depositQRCacheControl keeps the image in the user's client only, a payment link
+// never changes but names their memo
+const depositQRCacheControl = "private, max-age=86400"
+
+// GetDepositQR returns a QR code of the payment link of the user's pending deposit
+// request as PNG or SVG, so a wallet scanning it fills in the amount and memo
+func (h *Handler) GetDepositQR(c *gin.Context) {
+	format, size, ok := qrImageOptions(c)
+	if !ok {
+		return
+	}
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid deposit id",
+		})
+		return
+	}
+	deposit, err := h.db.GetDepositRequest(id)
+	if err != nil || deposit.UserID != user.ID {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "deposit request not found",
+			Code:    model.ErrorDepositNotFound,
+		})
+		return
+	}
+	// Paying a request that is confirmed, finished or can't be credited anymore would
+	// send TON no deposit matches
+	if deposit.Status != "pending" {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "deposit request is not pending",
+		})
+		return
+	}
+
+	address := deposit.DepositAddress
+	if address == "" {
+		address = h.ton.TreasuryAddress(deposit.TreasuryWallet)
+	}
+	if address == "" {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposit wallet address",
+		})
+		return
+	}
+	h.serveQR(c, ton.TransferLink(address, deposit.Amount, deposit.Memo), format, size, depositQRCacheControl)
+}
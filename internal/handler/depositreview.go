@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultArchiveLookupPages is used when deposit.archive_lookup.max_pages isn't set
+const defaultArchiveLookupPages = 20
+
+// needsArchiveLookup reports whether a deposit not found by the regular check may have
+// been sent before the transactions it searches
+func (h *Handler) needsArchiveLookup(deposit *model.DepositRequest) bool {
+	return h.config().Deposit.ArchiveLookup.Enabled &&
+		deposit.CreatedAt < time.Now().Add(-depositCheckWindow).Unix()
+}
+
+// checkArchivedDeposit looks for the transfer of a deposit in the archived wallet history
+// since the request was created, see TonClient.FindArchivedDeposit
+func (h *Handler) checkArchivedDeposit(ctx context.Context, walletAddress string, deposit *model.DepositRequest) (float64, error) {
+	maxPages := h.config().Deposit.ArchiveLookup.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultArchiveLookupPages
+	}
+	memo := deposit.Memo
+	if deposit.DepositAddress != "" {
+		memo = ""
+	}
+	return h.ton.FindArchivedDeposit(ctx, walletAddress, h.depositMatch(deposit), memo, deposit.CreatedAt, maxPages)
+}
+
+// escalateDeposit puts a claimed deposit the archive lookup couldn't reach under review
+// and tells the operators an admin has to find its transfer
+func (h *Handler) escalateDeposit(c *gin.Context, deposit *model.DepositRequest, reason error) {
+	db := h.store(c)
+	if err := db.EscalateDeposit(deposit.ID); err != nil {
+		releaseDeposit(db, deposit.ID)
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to confirm deposit",
+		})
+		return
+	}
+	h.depositWatcher.changed(deposit.ID)
+	slog.WarnContext(c.Request.Context(), "Deposit escalated to an admin review",
+		"deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount), "reason", reason)
+
+	if len(h.notifiers) > 0 {
+		msg := notify.Message{
+			Title: fmt.Sprintf("Deposit of %s TON needs a review", money.Format(deposit.Amount)),
+			Body: fmt.Sprintf("Deposit request %d of user %d was confirmed %s after it was created, its transfer wasn't found in the searched history: %v.",
+				deposit.ID, deposit.UserID, time.Since(time.Unix(deposit.CreatedAt, 0)).Round(time.Minute), reason),
+			Fields: map[string]interface{}{
+				"status":     "review",
+				"deposit_id": deposit.ID,
+				"user_id":    deposit.UserID,
+				"amount":     deposit.Amount,
+				"memo":       deposit.Memo,
+			},
+		}
+		go func() {
+			if err := h.notifiers.Send(context.Background(), msg); err != nil {
+				slog.Error("Failed to notify deposit review", "deposit_id", deposit.ID, "user_id", deposit.UserID, "error", err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusAccepted, model.Response{
+		Success: true,
+		Data: gin.H{
+			"status": "review",
+		},
+		Message: "the transfer is older than the history checked automatically, an admin will look it up and credit the deposit",
+	})
+}
+
+// GetEscalatedDeposits lists the deposit requests waiting for an admin to find their
+// transfer, oldest first (admin only)
+func (h *Handler) GetEscalatedDeposits(c *gin.Context) {
+	deposits, err := h.db.GetEscalatedDeposits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposit reviews",
+		})
+		return
+	}
+
+	total := 0.0
+	for _, d := range deposits {
+		total += d.Amount
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"total":    money.Round(total),
+			"deposits": deposits,
+		},
+	})
+}
+
+// escalatedDepositParam loads the deposit request of the :id parameter, writing the
+// error response when it doesn't exist
+func (h *Handler) escalatedDepositParam(c *gin.Context) (*model.DepositRequest, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid deposit request id",
+		})
+		return nil, false
+	}
+
+	deposit, err := h.db.GetDepositRequest(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "deposit request not found",
+			Code:    model.ErrorDepositNotFound,
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposit request",
+		})
+		return nil, false
+	}
+	return deposit, true
+}
+
+// CreditEscalatedDeposit credits a deposit under review once an admin found its transfer,
+// forwarding the platform share like an automatic confirmation (admin only)
+func (h *Handler) CreditEscalatedDeposit(c *gin.Context) {
+	deposit, ok := h.escalatedDepositParam(c)
+	if !ok {
+		return
+	}
+
+	claimed, err := h.db.ReviewEscalatedDeposit(deposit.ID, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to credit deposit",
+		})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "deposit request is not under review",
+		})
+		return
+	}
+
+	if err := h.ton.TransferFundsWithSplit(c.Request.Context(), deposit.Amount, h.config().TON.FeeWalletAddress); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to forward the platform share of a reviewed deposit", "deposit_id", deposit.ID, "user_id", deposit.UserID, "error", err)
+		if err := h.db.EscalateDeposit(deposit.ID); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to put deposit back under review", "deposit_id", deposit.ID, "error", err)
+		}
+		c.JSON(http.StatusBadGateway, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to forward the platform share, the deposit is still under review: %v", err),
+		})
+		return
+	}
+
+	if err := h.db.CompleteDeposit(*deposit, deposit.Amount); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to complete reviewed deposit", "deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount), "error", err)
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to complete deposit",
+		})
+		return
+	}
+	h.depositWatcher.changed(deposit.ID)
+	slog.InfoContext(c.Request.Context(), "Credited reviewed deposit", "deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount))
+	h.notifyDepositCredited(deposit.UserID, deposit.Amount)
+
+	if credited, err := h.db.GetDepositRequest(deposit.ID); err == nil {
+		deposit = credited
+	}
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    deposit,
+	})
+}
+
+// RejectEscalatedDeposit fails a deposit under review whose transfer an admin couldn't
+// find (admin only)
+func (h *Handler) RejectEscalatedDeposit(c *gin.Context) {
+	deposit, ok := h.escalatedDepositParam(c)
+	if !ok {
+		return
+	}
+
+	rejected, err := h.db.ReviewEscalatedDeposit(deposit.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to reject deposit",
+		})
+		return
+	}
+	if !rejected {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "deposit request is not under review",
+		})
+		return
+	}
+	h.depositWatcher.changed(deposit.ID)
+	slog.InfoContext(c.Request.Context(), "Rejected reviewed deposit", "deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount))
+	h.notifyUser(deposit.UserID, "deposit_rejected", func(l locale) (string, string) {
+		return l.text("deposit_rejected.title"), l.text("deposit_rejected.body", l.amount(deposit.Amount))
+	})
+
+	deposit.Status = "failed"
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    deposit,
+	})
+}
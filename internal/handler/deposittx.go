@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+)
+
+// depositTxError is why a transaction submitted for a deposit request doesn't credit it
+type depositTxError struct {
+	status int
+	reason string
+}
+
+func (e *depositTxError) Error() string {
+	return e.reason
+}
+
+// checkDepositTransaction credits a deposit request with the transaction the user
+// submitted, fetched by its hash instead of searching the latest wallet transactions.
+// It must be an incoming transfer to the deposit's wallet with its memo, or sent to the
+// personal address after the request was created, and is matched and confirmed like any
+// other transfer. Returns the amount received.
+func (h *Handler) checkDepositTransaction(ctx context.Context, walletAddress string, deposit *model.DepositRequest, txHash string) (float64, error) {
+	tx, err := h.ton.GetTransaction(ctx, txHash)
+	if err == ton.ErrTransactionNotFound {
+		return 0, &depositTxError{http.StatusNotFound, "transaction not found, it can take a few seconds after sending until it is"}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	wallet, err := ton.RawAddress(walletAddress)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case tx.Wallet != wallet:
+		return 0, &depositTxError{http.StatusBadRequest, "transaction isn't a transfer to the deposit address"}
+	case tx.InAmount <= 0 || tx.Bounced:
+		return 0, &depositTxError{http.StatusBadRequest, "transaction isn't an incoming transfer"}
+	case deposit.DepositAddress == "" && tx.InComment != deposit.Memo:
+		return 0, &depositTxError{http.StatusBadRequest, "transaction comment doesn't match the deposit memo"}
+	case deposit.DepositAddress != "" && tx.Utime < deposit.CreatedAt:
+		return 0, &depositTxError{http.StatusBadRequest, "transaction was sent before the deposit request"}
+	}
+
+	match := h.depositMatch(deposit)
+	credited, partial := match.Credits(tx.InAmount)
+	if partial {
+		return 0, &ton.PartialDepositError{Expected: deposit.Amount, Received: tx.InAmount}
+	}
+	if !credited {
+		return 0, &depositTxError{http.StatusBadRequest, fmt.Sprintf("transaction amount %s TON doesn't match the deposit amount %s TON",
+			money.Format(tx.InAmount), money.Format(deposit.Amount))}
+	}
+	if tx.Utime > time.Now().Unix()-int64(match.MinAgeSeconds(tx.InAmount)) {
+		return 0, ton.ErrAwaitingConfirmations
+	}
+
+	// Before forwarding the platform share, so a transaction can't credit two requests
+	claimed, err := match.ClaimTransaction(txHash)
+	if err != nil {
+		return 0, err
+	}
+	if !claimed {
+		return 0, &depositTxError{http.StatusConflict, "transaction was already used for another deposit"}
+	}
+
+	if err := h.ton.TransferFundsWithSplit(ctx, tx.InAmount, h.config().TON.FeeWalletAddress); err != nil {
+		return 0, err
+	}
+	return tx.InAmount, nil
+}
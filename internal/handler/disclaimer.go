@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultRiskTokenTTL = 15 * time.Minute
+
+// riskDisclaimerRequired reports whether investing on the given terms needs a risk acknowledgment
+func (h *Handler) riskDisclaimerRequired(terms model.InvestmentTypeConfig) bool {
+	threshold := h.config().RiskDisclaimer.WeeklyPercentThreshold
+	return threshold > 0 && terms.WeeklyPercent > threshold
+}
+
+// riskDisclaimerInfo describes the risk disclaimer of a product on the terms offered to the user
+func (h *Handler) riskDisclaimerInfo(investType string, terms model.InvestmentTypeConfig) gin.H {
+	cfg := h.config().RiskDisclaimer
+	return gin.H{
+		"type":           investType,
+		"weekly_percent": terms.WeeklyPercent,
+		"threshold":      cfg.WeeklyPercentThreshold,
+		"required":       h.riskDisclaimerRequired(terms),
+		"version":        cfg.Version,
+		"text":           cfg.Text,
+	}
+}
+
+// ensureRiskAcknowledged checks that an investment into a product above the risk threshold
+// carries the token of a fresh acknowledgment of its disclaimer, and uses the token up.
+// Writes a 428 response with the disclaimer and returns false when the token is missing or invalid.
+func (h *Handler) ensureRiskAcknowledged(c *gin.Context, user *model.User, investType string, terms model.InvestmentTypeConfig, token string) bool {
+	if !h.riskDisclaimerRequired(terms) {
+		return true
+	}
+
+	reason := "risk disclaimer of this product must be acknowledged first"
+	if token != "" {
+		a, err := h.db.UseRiskAcknowledgment(token, user.ID, investType)
+		switch {
+		case err != nil:
+			reason = err.Error()
+		case a.WeeklyPercent < terms.WeeklyPercent || a.Version != h.config().RiskDisclaimer.Version:
+			reason = "terms changed since the risk disclaimer was acknowledged"
+		default:
+			return true
+		}
+	}
+
+	c.JSON(http.StatusPreconditionRequired, model.Response{
+		Success: false,
+		Error:   reason,
+		Code:    model.ErrorRiskNotAcknowledged,
+		Data:    h.riskDisclaimerInfo(investType, terms),
+	})
+	return false
+}
+
+// riskDisclaimerParams loads the user and the terms of the :type product offered to them,
+// writing the error response when either doesn't exist
+func (h *Handler) riskDisclaimerParams(c *gin.Context) (*model.User, model.InvestmentTypeConfig, bool) {
+	investType := c.Param("type")
+	if _, ok := h.config().InvestmentTypes[investType]; !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "investment type not found",
+		})
+		return nil, model.InvestmentTypeConfig{}, false
+	}
+
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return nil, model.InvestmentTypeConfig{}, false
+	}
+
+	terms, err := h.investmentTerms(user.ID, investType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return nil, model.InvestmentTypeConfig{}, false
+	}
+	return user, terms, true
+}
+
+// GetRiskDisclaimer returns the risk disclaimer of a product and whether the user has to
+// acknowledge it before investing
+func (h *Handler) GetRiskDisclaimer(c *gin.Context) {
+	_, terms, ok := h.riskDisclaimerParams(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    h.riskDisclaimerInfo(c.Param("type"), terms),
+	})
+}
+
+// AcknowledgeRisk records the user's acknowledgment of the risk disclaimer of a product
+// and returns the single-use token required to invest into it
+func (h *Handler) AcknowledgeRisk(c *gin.Context) {
+	var req model.AcknowledgeRiskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "acknowledged must be true",
+		})
+		return
+	}
+
+	user, terms, ok := h.riskDisclaimerParams(c)
+	if !ok {
+		return
+	}
+	investType := c.Param("type")
+	if !h.riskDisclaimerRequired(terms) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "this product doesn't require a risk acknowledgment",
+		})
+		return
+	}
+
+	token, err := randomHex(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to create risk token",
+		})
+		return
+	}
+
+	ttl := defaultRiskTokenTTL
+	if minutes := h.config().RiskDisclaimer.TokenTTLMinutes; minutes > 0 {
+		ttl = time.Duration(minutes) * time.Minute
+	}
+	now := time.Now()
+	a := &model.RiskAcknowledgment{
+		UserID:         user.ID,
+		Type:           investType,
+		WeeklyPercent:  terms.WeeklyPercent,
+		Version:        h.config().RiskDisclaimer.Version,
+		IP:             c.ClientIP(),
+		AcknowledgedAt: now.Unix(),
+		ExpiresAt:      now.Add(ttl).Unix(),
+	}
+	if err := h.db.CreateRiskAcknowledgment(a, token); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to record risk acknowledgment",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data: gin.H{
+			"risk_token":     token,
+			"type":           a.Type,
+			"weekly_percent": a.WeeklyPercent,
+			"version":        a.Version,
+			"expires_at":     a.ExpiresAt,
+		},
+		Message: "send risk_token with the investment, it can be used once",
+	})
+}
+
+// GetRiskAcknowledgments lists the risk disclaimers the user acknowledged
+func (h *Handler) GetRiskAcknowledgments(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	acknowledgments, err := h.db.GetRiskAcknowledgments(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get risk acknowledgments",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    acknowledgments,
+	})
+}
+
+// GetUserRiskAcknowledgments lists the risk acknowledgments of a user for compliance reviews (admin only)
+func (h *Handler) GetUserRiskAcknowledgments(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+
+	acknowledgments, err := h.db.GetRiskAcknowledgments(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get risk acknowledgments: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    acknowledgments,
+	})
+}
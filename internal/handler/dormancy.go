@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// StartDormancyPolicy periodically applies the configured inactivity rules
+func (h *Handler) StartDormancyPolicy(ctx context.Context) {
+	if !h.config().Dormancy.Enabled || len(h.config().Dormancy.Rules) == 0 {
+		return
+	}
+
+	interval := time.Duration(h.config().Dormancy.CheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, rule := range h.config().Dormancy.Rules {
+				notified, executed, err := h.ApplyDormancyRule(rule, time.Now())
+				if err != nil {
+					slog.Error("Failed to apply dormancy rule", "rule", rule.Name, "error", err)
+					continue
+				}
+				if notified > 0 || executed > 0 {
+					slog.Info("Applied dormancy rule", "rule", rule.Name, "notified", notified, "applied", executed)
+				}
+			}
+		}
+	}
+}
+
+// ApplyDormancyRule notifies users approaching the inactivity threshold, applies the
+// rule action to users who stayed inactive through the grace period, and resets the
+// rule for users who came back
+func (h *Handler) ApplyDormancyRule(rule model.DormancyRule, now time.Time) (notified int, executed int, err error) {
+	if rule.Name == "" || rule.InactiveDays <= 0 {
+		return 0, 0, fmt.Errorf("rule needs a name and inactive_days")
+	}
+
+	day := int64(24 * time.Hour / time.Second)
+	noticeBefore := now.Unix() - int64(rule.InactiveDays-rule.GraceDays)*day
+
+	inactive, err := h.db.GetInactiveUsers(noticeBefore)
+	if err != nil {
+		return 0, 0, err
+	}
+	lastActive := make(map[int]int64, len(inactive))
+	for _, u := range inactive {
+		lastActive[u.UserID] = u.LastActiveAt
+	}
+
+	// Users who were notified but are no longer inactive start over
+	notices, err := h.db.GetDormancyNoticesByRule(rule.Name)
+	if err != nil {
+		return 0, 0, err
+	}
+	noticeOf := make(map[int]model.DormancyNotice, len(notices))
+	for _, n := range notices {
+		if _, ok := lastActive[n.UserID]; !ok {
+			if err := h.db.ClearDormancyNotice(n.UserID, rule.Name); err != nil {
+				return notified, executed, err
+			}
+			continue
+		}
+		noticeOf[n.UserID] = n
+	}
+
+	for _, u := range inactive {
+		notice, ok := noticeOf[u.UserID]
+		if !ok {
+			if err := h.db.RecordDormancyNotice(u.UserID, rule, dormancyNotification(h.userLocale(u.UserID), rule)); err != nil {
+				return notified, executed, err
+			}
+			notified++
+			continue
+		}
+
+		if notice.ExecutedAt != nil {
+			continue
+		}
+
+		// The action only runs after the full grace period even if the user was
+		// already past the threshold when first notified
+		graceOver := notice.NotifiedAt+int64(rule.GraceDays)*day <= now.Unix()
+		dormant := u.LastActiveAt <= now.Unix()-int64(rule.InactiveDays)*day
+		if !graceOver || !dormant {
+			continue
+		}
+
+		if err := h.executeDormancyAction(u.UserID, rule); err != nil {
+			return notified, executed, err
+		}
+		executed++
+	}
+
+	return notified, executed, nil
+}
+
+func dormancyNotification(l locale, rule model.DormancyRule) *model.Notification {
+	body := l.text("dormancy.body", rule.GraceDays)
+	if rule.Action == model.DormancyActionCloseFlexibleInvestments {
+		body = l.text("dormancy.body_close_flexible", rule.GraceDays)
+	}
+
+	return &model.Notification{
+		Kind:  "dormancy",
+		Title: l.text("dormancy.title"),
+		Body:  body,
+	}
+}
+
+// executeDormancyAction runs the rule action for a user and logs it
+func (h *Handler) executeDormancyAction(userID int, rule model.DormancyRule) error {
+	switch rule.Action {
+	case model.DormancyActionNotify:
+		return h.db.MarkDormancyExecuted(userID, rule, 0, nil)
+
+	case model.DormancyActionCloseFlexibleInvestments:
+		investments, err := h.db.GetUserInvestments(userID)
+		if err != nil {
+			return err
+		}
+
+		var closedIDs []int64
+		total := 0.0
+		for _, inv := range investments {
+			investConfig, ok := h.config().InvestmentTypes[inv.Type]
+			if !ok || investConfig.LockPeriod > 0 {
+				continue
+			}
+			if err := h.db.CloseInvestmentByPolicy(userID, int64(inv.ID), "dormancy:"+rule.Name); err != nil {
+				return err
+			}
+			closedIDs = append(closedIDs, int64(inv.ID))
+			total += inv.Amount
+		}
+
+		return h.db.MarkDormancyExecuted(userID, rule, total, map[string]interface{}{
+			"closed_investments": closedIDs,
+		})
+	}
+
+	return fmt.Errorf("unknown dormancy action %q", rule.Action)
+}
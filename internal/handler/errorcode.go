@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorCatalogCacheControl lets clients keep the catalog, it only changes with releases
+const errorCatalogCacheControl = "public, max-age=3600"
+
+// errorCodeWriter holds back error responses so ErrorCodes can add their code
+type errorCodeWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	buffered bool
+}
+
+func (w *errorCodeWriter) Write(data []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest {
+		return w.ResponseWriter.Write(data)
+	}
+	w.buffered = true
+	return w.body.Write(data)
+}
+
+func (w *errorCodeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Unwrap lets http.ResponseController reach the connection
+func (w *errorCodeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// ErrorCodes sets the code of error responses without one to the generic code of their
+// status, so every error a client gets has a code of the catalog. Handlers set a more
+// specific code on model.Response where there is one.
+func (h *Handler) ErrorCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &errorCodeWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		defer func() { c.Writer = writer.ResponseWriter }()
+
+		c.Next()
+
+		if writer.buffered {
+			writer.ResponseWriter.Write(withErrorCode(writer.body.Bytes(), writer.Status()))
+		}
+	}
+}
+
+// withErrorCode adds "code" to a model.Response body that has none, other bodies are
+// returned as they are
+func withErrorCode(body []byte, status int) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil || fields["success"] == nil || fields["code"] != nil {
+		return body
+	}
+	code, _ := json.Marshal(model.ErrorCodeForStatus(status))
+	end := bytes.LastIndexByte(body, '}')
+	out := make([]byte, 0, len(body)+len(code)+8)
+	out = append(out, body[:end]...)
+	out = append(out, `,"code":`...)
+	out = append(out, code...)
+	return append(out, body[end:]...)
+}
+
+// GetErrorCatalog lists every error code with its status and default messages, so
+// clients can map the code of an error response to their own text
+func (h *Handler) GetErrorCatalog(c *gin.Context) {
+	languages := make([]string, 0, len(model.SupportedLanguages))
+	for lang := range model.SupportedLanguages {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+
+	c.Header("Cache-Control", errorCatalogCacheControl)
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"languages": languages,
+			"errors":    model.ErrorCatalog,
+		},
+	})
+}
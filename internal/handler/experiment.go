@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// experimentFor returns the experiment configured for an investment type, nil if none
+func (h *Handler) experimentFor(investType string) *model.ExperimentConfig {
+	experiments := h.config().Experiments
+	for i := range experiments {
+		if experiments[i].InvestmentType == investType {
+			return &experiments[i]
+		}
+	}
+	return nil
+}
+
+// experimentVariant returns the variant of an experiment by name, nil if it was removed
+func experimentVariant(exp *model.ExperimentConfig, name string) *model.ExperimentVariant {
+	for i := range exp.Variants {
+		if exp.Variants[i].Name == name {
+			return &exp.Variants[i]
+		}
+	}
+	return nil
+}
+
+// assignVariant picks the variant of a user by hashing the experiment name and user ID,
+// so the same user always lands in the same variant while the weights don't change
+func assignVariant(exp *model.ExperimentConfig, userID int) model.ExperimentVariant {
+	total := 0
+	for _, v := range exp.Variants {
+		total += v.Weight
+	}
+	sum := sha256.Sum256([]byte(exp.Name + ":" + strconv.Itoa(userID)))
+	n := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, v := range exp.Variants {
+		if n < v.Weight {
+			return v
+		}
+		n -= v.Weight
+	}
+	return exp.Variants[len(exp.Variants)-1]
+}
+
+// variantTerms applies the terms of a variant to the investment type config
+func variantTerms(base model.InvestmentTypeConfig, v *model.ExperimentVariant) model.InvestmentTypeConfig {
+	if v != nil && v.WeeklyPercent > 0 {
+		base.WeeklyPercent = v.WeeklyPercent
+	}
+	return base
+}
+
+// investmentTerms returns the terms of an investment type shown to a user: those of the
+// user's experiment variant plus the weekly percent bonus of their VIP tier
+func (h *Handler) investmentTerms(userID int, investType string) (model.InvestmentTypeConfig, error) {
+	terms, err := h.experimentTerms(userID, investType)
+	if err != nil {
+		return terms, err
+	}
+	tier, err := h.userVIPTier(userID)
+	if err != nil {
+		return terms, fmt.Errorf("failed to get VIP tier: %v", err)
+	}
+	return vipTerms(terms, tier), nil
+}
+
+// experimentTerms returns the terms of an investment type in the user's experiment
+// variant. While the experiment of the type is enabled the user is assigned a variant,
+// and the exposure is logged; once disabled, assigned users keep their variant and
+// nobody new is assigned.
+func (h *Handler) experimentTerms(userID int, investType string) (model.InvestmentTypeConfig, error) {
+	base := h.config().InvestmentTypes[investType]
+	exp := h.experimentFor(investType)
+	if exp == nil {
+		return base, nil
+	}
+
+	var exposure *model.ExperimentExposure
+	var err error
+	if exp.Enabled {
+		exposure, err = h.db.RecordExperimentExposure(exp.Name, userID, assignVariant(exp, userID).Name)
+	} else {
+		exposure, err = h.db.GetExperimentExposure(exp.Name, userID)
+	}
+	if err != nil {
+		return base, fmt.Errorf("failed to get experiment variant: %v", err)
+	}
+	if exposure == nil {
+		return base, nil
+	}
+	return variantTerms(base, experimentVariant(exp, exposure.Variant)), nil
+}
+
+// experimentCohorts resolves the weekly percent and platform fee of investments during
+// one accrual or forecast run, loading the assigned variants of each experiment and the
+// VIP tiers once
+type experimentCohorts struct {
+	h         *Handler
+	exposures map[string]map[int]model.ExperimentExposure
+	tiers     map[int]model.UserTier
+}
+
+func (h *Handler) newExperimentCohorts() *experimentCohorts {
+	return &experimentCohorts{h: h, exposures: make(map[string]map[int]model.ExperimentExposure)}
+}
+
+// terms returns the terms an investment earns: those of the user's variant if the
+// investment was made after the user was first shown the variant, else the base terms,
+// plus the weekly percent bonus of the user's current VIP tier
+func (ec *experimentCohorts) terms(inv model.Investment, base model.InvestmentTypeConfig) (model.InvestmentTypeConfig, error) {
+	terms, err := ec.variantTerms(inv, base)
+	if err != nil {
+		return base, err
+	}
+	tier, err := ec.vip(inv.UserID)
+	if err != nil {
+		return terms, err
+	}
+	return vipTerms(terms, tier), nil
+}
+
+// feePercent returns the platform fee on the profit of a user's investments
+func (ec *experimentCohorts) feePercent(userID int) (float64, error) {
+	tier, err := ec.vip(userID)
+	return vipFeePercent(platformFeePercent(ec.h.config().Accrual), tier), err
+}
+
+// vip returns the VIP tier of a user, nil without one or while the program is off
+func (ec *experimentCohorts) vip(userID int) (*model.VIPTier, error) {
+	if !ec.h.config().VIP.Enabled {
+		return nil, nil
+	}
+	if ec.tiers == nil {
+		tiers, err := ec.h.db.GetUserTiers()
+		if err != nil {
+			return nil, err
+		}
+		ec.tiers = tiers
+	}
+	t, ok := ec.tiers[userID]
+	if !ok {
+		return nil, nil
+	}
+	return ec.h.vipTier(t.Tier), nil
+}
+
+func (ec *experimentCohorts) variantTerms(inv model.Investment, base model.InvestmentTypeConfig) (model.InvestmentTypeConfig, error) {
+	exp := ec.h.experimentFor(inv.Type)
+	if exp == nil {
+		return base, nil
+	}
+	exposures, ok := ec.exposures[exp.Name]
+	if !ok {
+		var err error
+		exposures, err = ec.h.db.GetExperimentExposures(exp.Name)
+		if err != nil {
+			return base, err
+		}
+		ec.exposures[exp.Name] = exposures
+	}
+	exposure, ok := exposures[inv.UserID]
+	if !ok || inv.CreatedAt < exposure.FirstExposedAt {
+		return base, nil
+	}
+	return variantTerms(base, experimentVariant(exp, exposure.Variant)), nil
+}
+
+// GetProducts returns the investment types with the terms offered to the user, which
+// differ from the public config for users in a pricing experiment
+func (h *Handler) GetProducts(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	products := make(map[string]model.InvestmentTypeConfig, len(h.config().InvestmentTypes))
+	for investType := range h.config().InvestmentTypes {
+		terms, err := h.investmentTerms(user.ID, investType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		products[investType] = terms
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    gin.H{"investment_types": products},
+	})
+}
+
+// GetExperimentReport compares deposit and investment conversion of the variants of a
+// pricing experiment, counting what users did after their first exposure (admin only)
+func (h *Handler) GetExperimentReport(c *gin.Context) {
+	name := c.Param("name")
+	var exp *model.ExperimentConfig
+	experiments := h.config().Experiments
+	for i := range experiments {
+		if experiments[i].Name == name {
+			exp = &experiments[i]
+		}
+	}
+	if exp == nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "experiment not found",
+		})
+		return
+	}
+
+	stats, err := h.db.GetExperimentStats(exp.Name, exp.InvestmentType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get experiment stats: %v", err),
+		})
+		return
+	}
+
+	base := h.config().InvestmentTypes[exp.InvestmentType]
+	report := model.ExperimentReport{
+		Experiment:        exp.Name,
+		InvestmentType:    exp.InvestmentType,
+		Enabled:           exp.Enabled,
+		BaseWeeklyPercent: base.WeeklyPercent,
+		Variants:          make([]model.ExperimentVariantStats, 0, len(exp.Variants)),
+		GeneratedAt:       time.Now().Unix(),
+	}
+
+	byVariant := make(map[string]model.ExperimentVariantStats, len(stats))
+	for _, s := range stats {
+		byVariant[s.Variant] = s
+	}
+	// Configured variants first, in config order, then removed ones that still have users
+	for _, v := range exp.Variants {
+		s := byVariant[v.Name]
+		s.Variant = v.Name
+		s.WeeklyPercent = variantTerms(base, &v).WeeklyPercent
+		s.Configured = true
+		report.Variants = append(report.Variants, s)
+		delete(byVariant, v.Name)
+	}
+	removed := make([]model.ExperimentVariantStats, 0, len(byVariant))
+	for _, s := range byVariant {
+		s.WeeklyPercent = base.WeeklyPercent
+		removed = append(removed, s)
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Variant < removed[j].Variant })
+	report.Variants = append(report.Variants, removed...)
+
+	for i := range report.Variants {
+		s := &report.Variants[i]
+		report.Users += s.Users
+		if s.Users > 0 {
+			s.DepositConversion = float64(s.Depositors) / float64(s.Users) * 100
+			s.InvestmentConversion = float64(s.Investors) / float64(s.Users) * 100
+		}
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChainTransactions lets admins browse indexed treasury transactions linked to
+// deposits and withdrawals
+func (h *Handler) GetChainTransactions(c *gin.Context) {
+	filter := model.ExplorerFilter{
+		Wallet:        c.Query("wallet"),
+		Direction:     c.Query("direction"),
+		UnmatchedOnly: c.Query("unmatched") == "true",
+		Investigation: c.Query("investigation"),
+	}
+
+	if filter.Direction != "" && filter.Direction != "in" && filter.Direction != "out" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "direction must be in or out",
+		})
+		return
+	}
+
+	params, ok := pageParams(c, 50, 200)
+	if !ok {
+		return
+	}
+
+	page, err := h.db.GetExplorerTransactions(filter, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get transactions",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// SetChainInvestigation marks an indexed transaction for investigation or resolves it
+func (h *Handler) SetChainInvestigation(c *gin.Context) {
+	txID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid transaction id",
+		})
+		return
+	}
+
+	var req model.SetInvestigationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	if req.Status != model.InvestigationStatusOpen && req.Status != model.InvestigationStatusResolved {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "status must be open or resolved",
+		})
+		return
+	}
+
+	err = h.db.SetChainInvestigation(txID, req.Status, req.Note)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "transaction not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to update investigation",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: model.ChainInvestigation{
+			Status: req.Status,
+			Note:   req.Note,
+		},
+	})
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operationCSVHeader are the columns of the CSV export. Extra fields without a column
+// of their own are listed in details as key=value pairs.
+var operationCSVHeader = []string{"id", "date", "type", "description", "amount", "tx_hash", "destination", "address_label", "investment_id", "tags", "note", "details"}
+
+// ExportUserOperations streams the full operation history of a user, with the filters
+// of the operation history. Use ?format=csv to download it as CSV.
+func (h *Handler) ExportUserOperations(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	filter, ok := operationFilterParams(c)
+	if !ok {
+		return
+	}
+
+	details := h.operationDetails(user.ID)
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		stream := newJSONArrayStream(c)
+		err = h.db.ForEachUserOperation(user.ID, filter, func(op model.Operation) error {
+			return stream.Write(details(op))
+		})
+		stream.Close(err)
+	case "csv":
+		h.exportOperationsCSV(c, user.ID, user.Preferences, filter, details)
+	default:
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "format must be json or csv",
+		})
+	}
+}
+
+// exportOperationsCSV streams operations as CSV rows, dates in UTC. Amounts use the
+// decimal separator of the user's number format; with a decimal comma the columns are
+// separated by semicolons, as spreadsheets of those locales expect. Once streaming
+// started the status can't change, so a failure ends the file with an error row.
+func (h *Handler) exportOperationsCSV(c *gin.Context, userID int, prefs model.UserPreferences, filter model.OperationFilter, details func(model.Operation) model.Operation) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=operations_%d_%s.csv", userID, time.Now().UTC().Format("20060102")))
+	c.Status(http.StatusOK)
+
+	decimal := prefs.DecimalSeparator()
+	w := csv.NewWriter(c.Writer)
+	if decimal == "," {
+		w.Comma = ';'
+	}
+	w.Write(operationCSVHeader)
+	count := 0
+	err := h.db.ForEachUserOperation(userID, filter, func(op model.Operation) error {
+		if err := w.Write(operationCSVRow(details(op), decimal)); err != nil {
+			return err
+		}
+		count++
+		if count%streamFlushEvery == 0 {
+			w.Flush()
+			c.Writer.Flush()
+		}
+		return w.Error()
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to export operations", "user_id", userID, "error", err)
+		w.Write([]string{"error", err.Error()})
+	}
+	w.Flush()
+}
+
+// operationCSVRow returns the columns of operationCSVHeader for an operation, the amount
+// with the given decimal separator
+func operationCSVRow(op model.Operation, decimal string) []string {
+	// Copy the extra fields, columns remove the ones they show from details
+	decoded, _ := op.Extra.(map[string]interface{})
+	extra := make(map[string]interface{}, len(decoded))
+	for k, v := range decoded {
+		extra[k] = v
+	}
+	field := func(key string) string {
+		value := extra[key]
+		delete(extra, key)
+		return csvValue(value)
+	}
+
+	row := []string{
+		strconv.FormatInt(op.ID, 10),
+		time.Unix(op.CreatedAt, 0).UTC().Format(time.RFC3339),
+		string(op.Type),
+		csvText(op.Description),
+		strings.Replace(money.FormatFixed(op.Amount), ".", decimal, 1),
+		field("tx_hash"),
+		field("destination"),
+		csvText(field("address_label")),
+		field("investment_id"),
+		csvText(strings.Join(op.Tags, " ")),
+		csvText(op.Note),
+	}
+
+	keys := make([]string, 0, len(extra))
+	for k := range extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + csvValue(extra[k])
+	}
+	return append(row, csvText(strings.Join(pairs, "; ")))
+}
+
+// csvValue formats a decoded extra field, numbers without exponent and nested values
+// as JSON
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// csvText keeps spreadsheets from evaluating text the user controls as a formula
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
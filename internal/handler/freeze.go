@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserFreeze returns whether a user is frozen and why (admin only)
+func (h *Handler) GetUserFreeze(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+
+	f, err := h.db.GetUserFreeze(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get freeze",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    f,
+	})
+}
+
+// FreezeUser freezes an account during an investigation: the user can still read their
+// data, but deposits, investments and withdrawals are refused and their queued
+// withdrawals wait (admin only)
+func (h *Handler) FreezeUser(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+	var req model.FreezeUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "a reason is required",
+		})
+		return
+	}
+	h.setUserFrozen(c, userID, true, req.Reason)
+}
+
+// UnfreezeUser lifts the freeze of an account (admin only)
+func (h *Handler) UnfreezeUser(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+	h.setUserFrozen(c, userID, false, "")
+}
+
+func (h *Handler) setUserFrozen(c *gin.Context, userID int, frozen bool, reason string) {
+	f, err := h.db.SetUserFrozen(userID, frozen, reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to set freeze",
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Account freeze changed", "user_id", userID, "frozen", frozen, "reason", reason)
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    f,
+	})
+}
+
+// rejectFrozenAccount refuses requests moving the funds of a frozen account
+func rejectFrozenAccount(c *gin.Context, user *model.User) bool {
+	if user.FrozenAt == nil {
+		return false
+	}
+	c.JSON(http.StatusForbidden, model.Response{
+		Success: false,
+		Error:   "account is frozen, please contact support",
+		Code:    model.ErrorAccountFrozen,
+	})
+	return true
+}
@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// giftCodePrefix is added to claim codes so they can be passed as a Telegram start parameter
+const giftCodePrefix = "gift_"
+
+// giftClaimLink builds a link opening the web app with the claim code
+func (h *Handler) giftClaimLink(code string) string {
+	return h.startAppLink(code)
+}
+
+// startAppLink builds a link opening the web app with a Telegram start parameter
+func (h *Handler) startAppLink(param string) string {
+	if h.config().Telegram.WebAppURL == "" {
+		return ""
+	}
+	sep := "?"
+	if strings.Contains(h.config().Telegram.WebAppURL, "?") {
+		sep = "&"
+	}
+	return h.config().Telegram.WebAppURL + sep + "startapp=" + param
+}
+
+// CreateGift pays for an investment gift from the sender balance and returns a one-time claim code
+func (h *Handler) CreateGift(c *gin.Context) {
+	pubKey := c.Param("pub_key")
+
+	var req model.CreateGiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	investConfig, ok := h.config().InvestmentTypes[req.Type]
+	if !ok {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid investment type",
+		})
+		return
+	}
+	if retired(investConfig, time.Now()) {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("%s has been retired and no longer accepts investments", req.Type),
+			Code:    model.ErrorInvestmentRetired,
+		})
+		return
+	}
+	if req.Amount < investConfig.MinAmount {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("minimum amount for %s is %s TON", req.Type, money.Format(investConfig.MinAmount)),
+		})
+		return
+	}
+
+	expiryDays := req.ExpiresInDays
+	if expiryDays <= 0 {
+		expiryDays = h.config().Gifts.ExpiryDays
+	}
+	if expiryDays <= 0 {
+		expiryDays = 7
+	}
+	if h.config().Gifts.MaxExpiryDays > 0 && expiryDays > h.config().Gifts.MaxExpiryDays {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("gift expiry can't exceed %d days", h.config().Gifts.MaxExpiryDays),
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(pubKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if rejectClosedAccount(c, user) || rejectFrozenAccount(c, user) {
+		return
+	}
+
+	secret, err := randomHex(12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to generate gift code",
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(expiryDays) * 24 * time.Hour).Unix()
+	gift, err := h.db.CreateGift(user.ID, giftCodePrefix+secret, req.Type, req.Amount, expiresAt)
+	if err != nil {
+		if err.Error() == "insufficient balance" {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("insufficient balance: you have %s TON but need %s TON", money.Format(user.Balance), money.Format(req.Amount)),
+				Code:    model.ErrorInsufficientBalance,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to create gift",
+		})
+		return
+	}
+	gift.ClaimLink = h.giftClaimLink(gift.Code)
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data:    gift,
+	})
+}
+
+// GetGifts lists gifts sent by the user
+func (h *Handler) GetGifts(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	gifts, err := h.db.GetGiftsBySender(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get gifts",
+		})
+		return
+	}
+	for i := range gifts {
+		if gifts[i].Status == model.GiftStatusActive {
+			gifts[i].ClaimLink = h.giftClaimLink(gifts[i].Code)
+		}
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    gifts,
+	})
+}
+
+// GetGift shows a gift by its claim code so the recipient can see what they are about to claim
+func (h *Handler) GetGift(c *gin.Context) {
+	gift, err := h.db.GetGiftByCode(c.Param("code"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "gift not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get gift",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"amount":     gift.Amount,
+			"type":       gift.Type,
+			"status":     gift.Status,
+			"expires_at": gift.ExpiresAt,
+		},
+	})
+}
+
+// ClaimGift opens the gifted investment for the claiming user
+func (h *Handler) ClaimGift(c *gin.Context) {
+	pubKey := c.Param("pub_key")
+
+	var req model.ClaimGiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(pubKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if rejectClosedAccount(c, user) {
+		return
+	}
+
+	gift, err := h.db.GetGiftByCode(req.Code)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "gift not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get gift",
+		})
+		return
+	}
+
+	investConfig, ok := h.config().InvestmentTypes[gift.Type]
+	if !ok || retired(investConfig, time.Now()) {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "gifted investment type is no longer available",
+			Code:    model.ErrorInvestmentRetired,
+		})
+		return
+	}
+
+	pause, err := h.getInvestmentPause(gift.Type, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to check investment availability",
+		})
+		return
+	}
+	if pause != nil {
+		c.JSON(http.StatusServiceUnavailable, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("new %s investments are temporarily paused: %s", gift.Type, pause.Reason),
+			Code:    model.ErrorInvestmentPaused,
+		})
+		return
+	}
+
+	if !h.ensureTermsAccepted(c, user, gift.Type, req.AcceptTermsVersion) {
+		return
+	}
+
+	investConfig, err = h.investmentTerms(user.ID, gift.Type)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !h.ensureRiskAcknowledged(c, user, gift.Type, investConfig, req.RiskToken) {
+		return
+	}
+
+	claimed, err := h.db.ClaimGift(req.Code, user.ID, investConfig)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	h.notifyUser(claimed.SenderID, "gift_claimed", func(l locale) (string, string) {
+		return l.text("gift_claimed.title"), l.text("gift_claimed.body", l.amount(claimed.Amount))
+	})
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"message":        "gift claimed successfully",
+			"amount":         claimed.Amount,
+			"type":           claimed.Type,
+			"weekly_percent": investConfig.WeeklyPercent,
+		},
+	})
+}
+
+// StartGiftExpiry periodically refunds unclaimed expired gifts to their senders
+func (h *Handler) StartGiftExpiry(ctx context.Context) {
+	interval := time.Duration(h.config().Gifts.CheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := h.db.RefundExpiredGifts(time.Now().Unix()); err != nil {
+				slog.Error("Failed to refund expired gifts", "error", err)
+			} else if n > 0 {
+				slog.Info("Refunded expired gifts", "count", n)
+			}
+		}
+	}
+}
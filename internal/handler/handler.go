@@ -1,16 +1,25 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"tonapp/internal/database"
+	"tonapp/internal/events"
+	"tonapp/internal/logging"
 	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/notify"
+	"tonapp/internal/payment"
+	"tonapp/internal/rates"
+	"tonapp/internal/telegram"
 	"tonapp/internal/ton"
 
 	"github.com/gin-gonic/gin"
@@ -18,46 +27,182 @@ import (
 
 // Handler manages HTTP request handling and business logic
 type Handler struct {
-	db     *database.Database
-	config model.Config
-	ton    *ton.Client
+	db       Store
+	ton      TonClient
+	payments payment.Providers
+	// wallets is the locked ton client of encrypted mnemonics, nil without them
+	wallets *lockedWallets
+	// notifiers receive operator alerts
+	notifiers notify.Notifiers
+	// bot answers the Telegram bot commands, nil unless telegram.bot_enabled is set
+	bot *telegram.Bot
+	// rates caches TON prices for fiat conversions
+	rates *rates.Service
+
+	// loaded is the config in use, ReloadConfigFile swaps it as a whole
+	loaded atomic.Pointer[loadedConfig]
+	// configPath is the file the config was loaded from
+	configPath string
+	// configReloaded are called with the config applied by ReloadConfigFile
+	configReloaded []func(model.Config)
+	// reloading serializes config reloads
+	reloading sync.Mutex
+
+	qrCodes   qrCache
+	alerts    alertMonitor
+	readiness readiness
+	readOnly  readOnlyMode
+
+	// referralRecompute serializes referral recomputation runs
+	referralRecompute sync.Mutex
+
+	// rateLimitTokens caches the rate limit tiers of API tokens
+	rateLimitTokens rateLimitTokens
+
+	// indexing serializes indexer runs
+	indexing      sync.Mutex
+	chainWebhooks chainWebhooks
+
+	// depositWatcher wakes the deposit event streams
+	depositWatcher depositWatcher
+	// withdrawalWorker wakes the worker sending withdrawals
+	withdrawalWorker withdrawalWorker
+	// events fans out balance, operation and withdrawal events to WebSocket connections
+	events *events.Bus
+
+	// depositSweeping serializes sweeps of the personal deposit addresses
+	depositSweeping sync.Mutex
+
+	// requestStore binds the store to a request context, see SetRequestStore
+	requestStore func(ctx context.Context) Store
+
+	// sandboxWallets are the demo accounts created by SeedSandbox
+	sandboxWallets []model.SandboxWallet
 }
 
 // NewHandler creates a new Handler instance with the given database and config
-func NewHandler(db *database.Database, configPath string) (*Handler, error) {
-	configFile, err := os.ReadFile(configPath)
+func NewHandler(db Store, configPath string) (*Handler, error) {
+	config, err := loadConfig(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %v", err)
+		return nil, err
 	}
 
-	var config model.Config
-	if err := json.Unmarshal(configFile, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	// Encrypted mnemonics wait in memory for UnlockWallets, the wallets are locked until then
+	if encryptedMnemonics(config.TON) {
+		slog.Warn("Wallet mnemonics are encrypted, the wallets stay locked until an admin unlocks them with POST /api/v1/admin/wallet/unlock")
+		wallets := &lockedWallets{}
+		h := newHandler(db, wallets, config)
+		h.configPath = configPath
+		h.wallets = wallets
+		return h, nil
 	}
 
-	isTestnet := config.TON.Network == "testnet"
-	tonClient := ton.NewClient(config.TON.APIKey, isTestnet, config.TON.Mnemonic, config.TON.WalletVersion, config.TON.FeeWalletAddress)
+	tonClient, err := newTonClient(config.TON)
+	if err != nil {
+		return nil, err
+	}
 
-	return &Handler{
-		db:     db,
-		config: config,
-		ton:    tonClient,
-	}, nil
+	h := newHandler(db, tonClient, config)
+	h.configPath = configPath
+	return h, nil
 }
 
-// AdminAuth middleware checks if the request has a valid admin API key
-func (h *Handler) AdminAuth() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		apiKey := c.GetHeader("X-API-Key")
-		if apiKey != h.config.AdminAPIKey {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
-				Success: false,
-				Error:   "invalid API key",
-			})
-			return
+// newTonClient creates the blockchain client of the main and treasury wallets
+func newTonClient(cfg model.TONConfig) (*ton.Client, error) {
+	tonClient := ton.NewClient(cfg.APIKey, cfg.Network == "testnet", cfg.Mnemonic, cfg.WalletVersion, cfg.FeeWalletAddress)
+	tonClient.ConfigureBudget(cfg.Toncenter)
+	for name, w := range cfg.TreasuryWallets {
+		version := w.WalletVersion
+		if version == "" {
+			version = cfg.WalletVersion
+		}
+		if err := tonClient.AddTreasuryWallet(name, w.Mnemonic, version); err != nil {
+			return nil, err
 		}
-		c.Next()
 	}
+	return tonClient, nil
+}
+
+// NewHandlerWithTonClient creates a Handler on another blockchain client than the one
+// of the config, such as a tonmock.Client in tests
+func NewHandlerWithTonClient(db Store, tonClient TonClient, configPath string) (*Handler, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	h := newHandler(db, tonClient, config)
+	h.configPath = configPath
+	return h, nil
+}
+
+// loadConfig reads and validates the config file, sets up logging and logs the issues found
+func loadConfig(configPath string) (model.Config, error) {
+	config, secrets, err := readConfig(configPath)
+	if err != nil {
+		return config, err
+	}
+	logging.Setup(config.Logging)
+	if len(secrets) > 0 {
+		slog.Info("Config secrets read from the environment", "variables", secrets)
+	}
+
+	report := validateConfig(config)
+	if len(report.Issues) > 0 {
+		report.Log()
+	}
+	if n := report.Errors(); n > 0 {
+		return config, fmt.Errorf("config has %d errors", n)
+	}
+	return config, nil
+}
+
+// SetRequestStore makes the withdrawal and deposit handlers run their queries on the
+// store bind returns for the request context, so they show up in the request's trace
+func (h *Handler) SetRequestStore(bind func(ctx context.Context) Store) {
+	h.requestStore = bind
+}
+
+// store returns the store for the queries of a request
+func (h *Handler) store(c *gin.Context) Store {
+	if h.requestStore == nil {
+		return h.db
+	}
+	return h.requestStore(c.Request.Context())
+}
+
+func newHandler(db Store, tonClient TonClient, config model.Config) *Handler {
+	payments := payment.Providers{}
+	if stars := config.Payments.TelegramStars; stars.Enabled {
+		payments.Register(payment.NewTelegramStars(config.Telegram.BotToken, stars.WebhookSecret, stars.TONPerStar))
+	}
+
+	var notifiers notify.Notifiers
+	if config.Alerts.TelegramChatID != "" {
+		notifiers = append(notifiers, notify.NewTelegram(config.Telegram.BotToken, config.Alerts.TelegramChatID))
+	}
+	if config.Alerts.WebhookURL != "" {
+		notifiers = append(notifiers, notify.NewWebhook(config.Alerts.WebhookURL, config.Alerts.WebhookSecret))
+	}
+
+	var bot *telegram.Bot
+	if config.Telegram.BotEnabled && config.Telegram.BotToken != "" {
+		bot = telegram.NewBot(config.Telegram.BotToken)
+	}
+
+	rateService := rates.NewService(config.Rates)
+	db.SetRateService(rateService)
+
+	h := &Handler{
+		db:        db,
+		ton:       tonClient,
+		payments:  payments,
+		notifiers: notifiers,
+		bot:       bot,
+		rates:     rateService,
+		events:    events.NewBus(),
+	}
+	h.loaded.Store(&loadedConfig{Config: config, at: time.Now()})
+	return h
 }
 
 // CreateUser handles user creation requests
@@ -78,7 +223,39 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.db.CreateUser(req.PubKey, req.RefID, req.ID, req.Name, req.Photo)
+	// Users who opened the bot with a referral link are registered as referrals, also
+	// when the web app doesn't pass the ref_id on
+	if req.RefID == nil && req.ID != nil {
+		req.RefID = h.botReferral(req.PubKey, *req.ID)
+	}
+
+	// A wallet whose account was closed can register again, but without a referrer,
+	// so closing and re-registering can't be used to farm referral rewards
+	if req.RefID != nil {
+		closed, err := h.db.IsWalletClosed(req.PubKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to create user",
+			})
+			return
+		}
+		if closed {
+			slog.InfoContext(c.Request.Context(), "CreateUser ignoring ref_id for previously closed wallet", "ref_id", *req.RefID, "client_ip", c.ClientIP())
+			req.RefID = nil
+		}
+	}
+
+	// Closed accounts are out of referral chains, they can't refer new users either
+	if req.RefID != nil {
+		referrer, err := h.db.GetUser(*req.RefID)
+		if err == nil && referrer.ClosedAt != nil {
+			slog.InfoContext(c.Request.Context(), "CreateUser ignoring ref_id of closed account", "ref_id", *req.RefID, "client_ip", c.ClientIP())
+			req.RefID = nil
+		}
+	}
+
+	user, created, err := h.db.CreateUser(req.PubKey, req.RefID, req.ID, req.Name, req.Photo)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
@@ -87,15 +264,50 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	if created {
+		c.JSON(http.StatusCreated, model.Response{
+			Success: true,
+			Data:    user,
+		})
+		return
+	}
+
+	// The referrer of an existing user can't be changed through registration
+	if req.RefID != nil && (user.RefID == nil || *user.RefID != *req.RefID) {
+		slog.WarnContext(c.Request.Context(), "CreateUser ref_id mismatch for existing user",
+			"user_id", user.ID, "client_ip", c.ClientIP(), "stored", formatOptionalInt(user.RefID), "submitted", *req.RefID)
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "user already exists with a different referrer",
+		})
+		return
+	}
+
+	if req.ID != nil && *req.ID != user.ID {
+		slog.WarnContext(c.Request.Context(), "CreateUser id mismatch for existing user", "user_id", user.ID, "client_ip", c.ClientIP(), "submitted", *req.ID)
+	}
+	if req.Name != nil && (user.Name == nil || *user.Name != *req.Name) {
+		slog.WarnContext(c.Request.Context(), "CreateUser name mismatch for existing user", "user_id", user.ID, "client_ip", c.ClientIP())
+	}
+
 	c.JSON(http.StatusOK, model.Response{
 		Success: true,
 		Data:    user,
+		Message: "user already exists",
 	})
 }
 
+// formatOptionalInt formats a nullable integer for logs
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return "none"
+	}
+	return strconv.Itoa(*v)
+}
+
 // GetUser handles user retrieval requests
 func (h *Handler) GetUser(c *gin.Context) {
-	pubKey := c.Param("pub_key")
+	pubKey := h.pubKeyParam(c)
 	if pubKey == "" {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
@@ -109,6 +321,7 @@ func (h *Handler) GetUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
 		})
 		return
 	}
@@ -119,6 +332,28 @@ func (h *Handler) GetUser(c *gin.Context) {
 		})
 		return
 	}
+
+	// Opening the app counts as activity for the dormancy policy
+	if err := h.db.TouchUserActivity(user.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record activity", "user_id", user.ID, "error", err)
+	}
+
+	if limits, err := h.depositLimits(user.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get deposit limits", "user_id", user.ID, "error", err)
+	} else {
+		user.DepositLimits = &limits
+	}
+	if limits, err := h.withdrawalLimits(user.ID, time.Now()); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get withdrawal limits", "user_id", user.ID, "error", err)
+	} else {
+		user.WithdrawalLimits = &limits
+	}
+	if status, err := h.vipStatus(user); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get VIP tier", "user_id", user.ID, "error", err)
+	} else {
+		user.VIPTier = status
+	}
+
 	c.JSON(http.StatusOK, model.Response{
 		Success: true,
 		Data:    user,
@@ -162,8 +397,10 @@ func (h *Handler) CreateInvestment(c *gin.Context) {
 	}
 
 	var req struct {
-		Type   string  `json:"type" binding:"required"`
-		Amount float64 `json:"amount" binding:"required"`
+		Type               string  `json:"type" binding:"required"`
+		Amount             float64 `json:"amount" binding:"required"`
+		AcceptTermsVersion string  `json:"accept_terms_version"`
+		RiskToken          string  `json:"risk_token"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -174,7 +411,7 @@ func (h *Handler) CreateInvestment(c *gin.Context) {
 		return
 	}
 
-	investConfig, ok := h.config.InvestmentTypes[req.Type]
+	investConfig, ok := h.config().InvestmentTypes[req.Type]
 	if !ok {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
@@ -182,6 +419,14 @@ func (h *Handler) CreateInvestment(c *gin.Context) {
 		})
 		return
 	}
+	if retired(investConfig, time.Now()) {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("%s has been retired and no longer accepts investments", req.Type),
+			Code:    model.ErrorInvestmentRetired,
+		})
+		return
+	}
 
 	if req.Amount <= 0 {
 		c.JSON(http.StatusBadRequest, model.Response{
@@ -191,6 +436,23 @@ func (h *Handler) CreateInvestment(c *gin.Context) {
 		return
 	}
 
+	pause, err := h.getInvestmentPause(req.Type, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to check investment availability",
+		})
+		return
+	}
+	if pause != nil {
+		c.JSON(http.StatusServiceUnavailable, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("new %s investments are temporarily paused: %s", req.Type, pause.Reason),
+			Code:    model.ErrorInvestmentPaused,
+		})
+		return
+	}
+
 	user, err := h.db.GetUserByPubKey(pubKey)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
@@ -199,12 +461,33 @@ func (h *Handler) CreateInvestment(c *gin.Context) {
 		})
 		return
 	}
+	if rejectClosedAccount(c, user) || rejectFrozenAccount(c, user) {
+		return
+	}
+
+	if !h.ensureTermsAccepted(c, user, req.Type, req.AcceptTermsVersion) {
+		return
+	}
+
+	investConfig, err = h.investmentTerms(user.ID, req.Type)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if !h.ensureRiskAcknowledged(c, user, req.Type, investConfig, req.RiskToken) {
+		return
+	}
 
 	if err := h.db.CreateInvestment(user.ID, req.Type, req.Amount, investConfig); err != nil {
 		if err.Error() == "insufficient balance" {
 			c.JSON(http.StatusBadRequest, model.Response{
 				Success: false,
-				Error:   fmt.Sprintf("insufficient balance: you have %.9f TON but need %.9f TON", user.Balance, req.Amount),
+				Error:   fmt.Sprintf("insufficient balance: you have %s TON but need %s TON", money.Format(user.Balance), money.Format(req.Amount)),
+				Code:    model.ErrorInsufficientBalance,
 			})
 			return
 		}
@@ -253,6 +536,7 @@ func (h *Handler) DeleteInvestment(c *gin.Context) {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
 		})
 		return
 	}
@@ -275,7 +559,7 @@ func (h *Handler) DeleteInvestment(c *gin.Context) {
 
 // GetReferralStats handles requests for referral statistics
 func (h *Handler) GetReferralStats(c *gin.Context) {
-	pubKey := c.Param("pub_key")
+	pubKey := h.pubKeyParam(c)
 	if pubKey == "" {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
@@ -299,42 +583,34 @@ func (h *Handler) GetReferralStats(c *gin.Context) {
 	})
 }
 
-// ProcessReferralEarnings processes referral earnings for an investment profit
-func (h *Handler) ProcessReferralEarnings(userID int, profitAmount float64) error {
+// ProcessReferralEarnings processes referral earnings for the investment profit of the
+// accrual period ending at periodEnd
+func (h *Handler) ProcessReferralEarnings(userID int, profitAmount float64, periodEnd int64) error {
 	// Get user's referrer chain (up to 3 levels)
-	var referrerChain []int
-	currentUserID := userID
-
-	for i := 0; i < 3; i++ {
-		var refID sql.NullInt64
-		err := h.db.DB().QueryRow("SELECT ref_id FROM users WHERE id = ?", currentUserID).Scan(&refID)
-		if err != nil {
-			return err
-		}
-		if !refID.Valid {
-			break
-		}
-		referrerChain = append(referrerChain, int(refID.Int64))
-		currentUserID = int(refID.Int64)
+	referrerChain, err := h.db.GetReferrerChain(userID, 3)
+	if err != nil {
+		return err
 	}
 
-	// Calculate and add earnings for each level
-	for level, referrerID := range referrerChain {
+	// Calculate and add earnings for each level. Closed accounts keep their level
+	// but earn nothing, the referrers above them aren't moved up.
+	for level, referrer := range referrerChain {
 		level++ // Convert to 1-based level number
-		var percent float64
-		switch level {
-		case 1:
-			percent = h.config.ReferralConfig.Level1Percent
-		case 2:
-			percent = h.config.ReferralConfig.Level2Percent
-		case 3:
-			percent = h.config.ReferralConfig.Level3Percent
+		if referrer.ClosedAt != nil {
+			continue
 		}
+		referrerID := referrer.ID
+		percent := referralPercent(h.config().ReferralConfig, level)
 
-		earnings := profitAmount * (percent / 100.0)
-		if err := h.db.AddReferralEarning(referrerID, userID, earnings, level); err != nil {
+		earnings := money.FloorPayout(profitAmount * (percent / 100.0))
+		paid, err := h.db.AddReferralEarning(referrerID, userID, earnings, level, periodEnd, h.config().ReferralConfig.Caps)
+		if err != nil {
 			return err
 		}
+		if paid < earnings {
+			slog.Info("Referral earning capped", "referrer_id", referrerID, "referred_id", userID, "level", level,
+				"amount", money.Format(earnings), "paid", money.Format(paid))
+		}
 	}
 
 	return nil
@@ -374,16 +650,26 @@ func (h *Handler) UpdateUserBalance(c *gin.Context) {
 
 // GetConfigPublic returns the current configuration without admin API key and Ton config
 func (h *Handler) GetConfigPublic() model.ConfigPublic {
-	config := h.config
+	config := h.config()
+
+	pauses, err := h.db.GetInvestmentPauses()
+	if err != nil {
+		slog.Error("Failed to get investment pauses", "error", err)
+	}
+
 	return model.ConfigPublic{
-		InvestmentTypes: config.InvestmentTypes,
-		ReferralConfig:  config.ReferralConfig,
+		InvestmentTypes:  config.InvestmentTypes,
+		ReferralConfig:   config.ReferralConfig,
+		Pauses:           pauses,
+		TermsVersions:    h.termsVersions(),
+		DepositLimits:    config.Deposit.Limits,
+		WithdrawalLimits: config.WithdrawalLimits,
 	}
 }
 
 // GetConfig returns the current configuration
 func (h *Handler) GetConfig() model.Config {
-	return h.config
+	return *h.config()
 }
 
 // CreateDeposit handles deposit creation requests
@@ -396,17 +682,36 @@ func (h *Handler) CreateDeposit(c *gin.Context) {
 		})
 		return
 	}
+	if !h.authorizePubKey(c, req.PubKey) {
+		return
+	}
 
 	user, err := h.db.GetUserByPubKey(req.PubKey)
 	if err != nil {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if rejectClosedAccount(c, user) || rejectFrozenAccount(c, user) {
+		return
+	}
+	if !h.checkUserDeposit(c, user.ID, req.Amount) {
+		return
+	}
+
+	treasuryWallet, err := h.depositWallet(req.InvestmentType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	walletAddress := h.ton.GetDepositAddress()
+	walletAddress := h.ton.TreasuryAddress(treasuryWallet)
 	if walletAddress == "" {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
@@ -415,9 +720,27 @@ func (h *Handler) CreateDeposit(c *gin.Context) {
 		return
 	}
 
-	memo := fmt.Sprintf("TON%d%d", user.ID, time.Now().Unix())
+	// Deposits to the main wallet go to the user's personal address without a memo
+	memo, depositAddress := fmt.Sprintf("TON%d%d", user.ID, time.Now().Unix()), ""
+	if h.config().DepositAddresses.Enabled && treasuryWallet == "" {
+		depositAddress, err = h.personalDepositAddress(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		memo, walletAddress = "", depositAddress
+	}
 
-	deposit, err := h.db.CreateDepositRequest(user.ID, req.Amount, memo)
+	var deposit *model.DepositRequest
+	if depositAddress != "" {
+		deposit, err = h.pendingAddressDeposit(user.ID, depositAddress, req.Amount)
+	}
+	if err == nil && deposit == nil {
+		deposit, err = h.db.CreateDepositRequest(user.ID, req.Amount, memo, treasuryWallet, depositAddress)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
@@ -434,6 +757,7 @@ func (h *Handler) CreateDeposit(c *gin.Context) {
 			Status:        deposit.Status,
 			Memo:          deposit.Memo,
 			WalletAddress: walletAddress,
+			PaymentLink:   ton.TransferLink(walletAddress, deposit.Amount, deposit.Memo),
 		},
 	})
 }
@@ -448,21 +772,39 @@ func (h *Handler) ConfirmDeposit(c *gin.Context) {
 		})
 		return
 	}
+	if !h.authorizePubKey(c, req.PubKey) {
+		return
+	}
+	var txHash string
+	if req.TxHash != "" {
+		hash, err := ton.ParseTransactionHash(req.TxHash)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "tx_hash must be a transaction hash in hex or base64",
+			})
+			return
+		}
+		txHash = hash
+	}
 
-	user, err := h.db.GetUserByPubKey(req.PubKey)
+	db := h.store(c)
+	user, err := db.GetUserByPubKey(req.PubKey)
 	if err != nil {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
 		})
 		return
 	}
 
-	deposit, err := h.db.GetDepositRequest(req.ID)
+	deposit, err := db.GetDepositRequest(req.ID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "deposit request not found",
+			Code:    model.ErrorDepositNotFound,
 		})
 		return
 	}
@@ -475,7 +817,18 @@ func (h *Handler) ConfirmDeposit(c *gin.Context) {
 		return
 	}
 
-	if deposit.Status != "pending" {
+	if deposit.Status == "review" {
+		c.JSON(http.StatusAccepted, model.Response{
+			Success: true,
+			Data: gin.H{
+				"status": "review",
+			},
+			Message: "an admin is looking up the transfer of the deposit",
+		})
+		return
+	}
+
+	if deposit.Status != "pending" && deposit.Status != "processing" {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
 			Error:   "deposit request is not pending",
@@ -483,7 +836,7 @@ func (h *Handler) ConfirmDeposit(c *gin.Context) {
 		return
 	}
 
-	walletAddress := h.ton.GetDepositAddress()
+	walletAddress := h.depositWalletAddress(deposit)
 	if walletAddress == "" {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
@@ -492,52 +845,149 @@ func (h *Handler) ConfirmDeposit(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("Checking deposit for wallet %s, amount %.9f TON, memo %s\n",
-		walletAddress, deposit.Amount, deposit.Memo)
-
-	received, err := h.ton.CheckDeposit(walletAddress, deposit.Amount, deposit.Memo, 30)
+	claimed, err := claimDeposit(db, deposit.ID)
 	if err != nil {
-		fmt.Printf("Failed to check transaction: %v\n", err)
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
-			Error:   "failed to check transaction",
+			Error:   "failed to confirm deposit",
+		})
+		return
+	}
+	if !claimed {
+		if current, err := db.GetDepositRequest(deposit.ID); err == nil && current.Status == "completed" {
+			// Matched by a webhook event meanwhile
+			c.JSON(http.StatusOK, model.Response{
+				Success: true,
+				Data: gin.H{
+					"status": "completed",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "deposit is already being confirmed",
 		})
 		return
 	}
 
-	if !received {
+	slog.InfoContext(c.Request.Context(), "Checking deposit",
+		"deposit_id", deposit.ID, "user_id", deposit.UserID, "wallet", walletAddress, "amount", money.Format(deposit.Amount), "memo", deposit.Memo, "tx_hash", txHash)
+
+	var received float64
+	if txHash != "" {
+		received, err = h.checkDepositTransaction(c.Request.Context(), walletAddress, deposit, txHash)
+	} else {
+		received, err = h.checkDeposit(walletAddress, deposit)
+		if err == nil && received == 0 && h.needsArchiveLookup(deposit) {
+			received, err = h.checkArchivedDeposit(c.Request.Context(), walletAddress, deposit)
+		}
+	}
+	if errors.Is(err, ton.ErrArchiveLookupCapped) {
+		h.escalateDeposit(c, deposit, err)
+		return
+	}
+	if err != nil || received == 0 {
+		releaseDeposit(db, deposit.ID)
+	}
+	var txErr *depositTxError
+	if errors.As(err, &txErr) {
+		c.JSON(txErr.status, model.Response{
+			Success: false,
+			Error:   txErr.Error(),
+		})
+		return
+	}
+	var partial *ton.PartialDepositError
+	if errors.As(err, &partial) {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
-			Error:   "payment not received",
+			Error:   fmt.Sprintf("partial payment: %v, %s TON missing", partial, money.Format(partial.Missing())),
+			Code:    model.ErrorDepositPartial,
+			Data: gin.H{
+				"status":          "partial",
+				"amount":          deposit.Amount,
+				"received_amount": partial.Received,
+				"missing_amount":  partial.Missing(),
+			},
 		})
 		return
 	}
-
-	if err := h.db.UpdateDepositStatus(deposit.ID, "completed"); err != nil {
+	if err == ton.ErrAwaitingConfirmations {
+		h.depositWatcher.markDetected(deposit.ID)
+		c.JSON(http.StatusAccepted, model.Response{
+			Success: true,
+			Data: gin.H{
+				"status": "awaiting_confirmations",
+			},
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to check transaction", "deposit_id", deposit.ID, "user_id", deposit.UserID, "error", err)
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
-			Error:   "failed to update deposit status",
+			Error:   "failed to check transaction",
+		})
+		return
+	}
+
+	if received == 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "payment not received",
 		})
 		return
 	}
 
-	if err := h.db.UpdateUserBalance(user.ID, user.Balance+deposit.Amount); err != nil {
+	if err := db.CompleteDeposit(*deposit, received); err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
-			Error:   "failed to update user balance",
+			Error:   "failed to complete deposit",
 		})
 		return
 	}
+	h.depositWatcher.changed(deposit.ID)
+	if money.ToNano(received) != money.ToNano(deposit.Amount) {
+		slog.InfoContext(c.Request.Context(), "Deposit credited with the amount received",
+			"deposit_id", deposit.ID, "user_id", deposit.UserID, "amount", money.Format(deposit.Amount), "received", money.Format(received))
+	}
+	h.notifyDepositCredited(deposit.UserID, received)
 
 	c.JSON(http.StatusOK, model.Response{
 		Success: true,
 		Data: gin.H{
-			"status": "completed",
+			"status":          "completed",
+			"amount":          deposit.Amount,
+			"received_amount": received,
 		},
 	})
 }
 
-// WithdrawFunds handles withdrawal requests
+// depositClaimTimeout is how long a deposit stays claimed by a confirmation before
+// another one may take it over, well above a deposit check with its retries
+const depositClaimTimeout = 5 * time.Minute
+
+// claimDeposit claims a deposit request for a confirmation in db, see Store.ClaimDeposit
+func claimDeposit(db Store, id int) (bool, error) {
+	return db.ClaimDeposit(id, time.Now().Add(-depositClaimTimeout).Unix())
+}
+
+// releaseDeposit puts a deposit request claimed in db back to pending
+func releaseDeposit(db Store, id int) {
+	if err := db.ReleaseDeposit(id); err != nil {
+		slog.Error("Failed to release deposit request", "deposit_id", id, "error", err)
+	}
+}
+
+// requiredDepositAge returns the confirmation depth in seconds for a deposit amount,
+// taken from the highest configured tier the amount reaches
+func (h *Handler) requiredDepositAge(amount float64) int {
+	return model.DepositConfirmationAge(h.config().Deposit.ConfirmationTiers, amount)
+}
+
+// WithdrawFunds handles withdrawal requests. Withdrawals that aren't held for approval
+// or batched are sent by the withdrawal worker, the response returns their ID at once.
 func (h *Handler) WithdrawFunds(c *gin.Context) {
 	var req model.WithdrawalRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -547,17 +997,28 @@ func (h *Handler) WithdrawFunds(c *gin.Context) {
 		})
 		return
 	}
+	if !h.authorizePubKey(c, req.PubKey) {
+		return
+	}
 
-	user, err := h.db.GetUserByPubKey(req.PubKey)
+	db := h.store(c)
+	user, err := db.GetUserByPubKey(req.PubKey)
 	if err != nil {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
 		})
 		return
 	}
+	if rejectFrozenAccount(c, user) {
+		return
+	}
+	if !h.confirmWithdrawal(c, user, req) {
+		return
+	}
 
-	deposits, err := h.db.GetDepositsOfUser(user.ID)
+	deposits, err := db.GetDepositsOfUser(user.ID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
@@ -566,11 +1027,13 @@ func (h *Handler) WithdrawFunds(c *gin.Context) {
 		return
 	}
 
+	// Deposits that failed, expired or were cancelled credited nothing and don't hold up
+	// a withdrawal, only those still waiting for their transfer or a review do
 	MathDeposits := 0.0
 	for _, deposit := range deposits {
 		if deposit.Status == "completed" {
 			MathDeposits += deposit.Amount
-		} else {
+		} else if !finalDepositStatus(deposit.Status) {
 			c.JSON(http.StatusBadRequest, model.Response{
 				Success: false,
 				Error:   "user has uncompleted deposits",
@@ -579,7 +1042,7 @@ func (h *Handler) WithdrawFunds(c *gin.Context) {
 		}
 	}
 
-	withdrawals, err := h.db.GetWithdrawalRequestsByUser(user.ID)
+	withdrawals, err := db.GetWithdrawalRequestsByUser(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
@@ -602,13 +1065,15 @@ func (h *Handler) WithdrawFunds(c *gin.Context) {
 	}
 
 	availableBalance := MathDeposits
-	availableBalance -= MathDeposits * 0.2 // Apply 20% fee
-	availableBalance -= Mathwithdrawal     // Subtract previous withdrawals
+	availableBalance -= money.RoundFee(MathDeposits * 0.2) // Apply 20% fee
+	availableBalance -= Mathwithdrawal                     // Subtract previous withdrawals
+	availableBalance = money.Round(availableBalance)
 
 	if availableBalance < req.Amount {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
-			Error:   fmt.Sprintf("insufficient balance: have %.2f TON, requested %.2f TON", availableBalance, req.Amount),
+			Error:   fmt.Sprintf("insufficient balance: have %s TON, requested %s TON", money.Format(availableBalance), money.Format(req.Amount)),
+			Code:    model.ErrorInsufficientBalance,
 		})
 		return
 	}
@@ -616,89 +1081,64 @@ func (h *Handler) WithdrawFunds(c *gin.Context) {
 	if user.Balance < req.Amount {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
-			Error:   fmt.Sprintf("insufficient balance: have %.2f TON, requested %.2f TON", user.Balance, req.Amount),
+			Error:   fmt.Sprintf("insufficient balance: have %s TON, requested %s TON", money.Format(user.Balance), money.Format(req.Amount)),
+			Code:    model.ErrorInsufficientBalance,
 		})
 		return
 	}
-
-	_, err = h.db.CreateWithdrawalRequest(user.ID, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.Response{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create withdrawal request in database"),
-		})
+	caps, ok := h.checkUserWithdrawal(c, user.ID, req.Amount)
+	if !ok {
 		return
 	}
-	_, err = h.db.ConfirmWithdrawalRequest(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.Response{
-			Success: false,
-			Error:   fmt.Sprintf("failed to confirm withdrawal"),
-		})
-		return
+
+	// Withdrawals to a saved address instead of the user's own wallet
+	destination := ""
+	if req.AddressBookID != 0 || req.Destination != "" {
+		entry, ok := h.withdrawalAddress(c, user.ID, req.AddressBookID, req.Destination)
+		if !ok {
+			return
+		}
+		destination = entry.Address
 	}
 
-	// Withdraw funds and get transaction hash
-	txHash, err := h.ton.WithdrawUserFunds(c.Request.Context(), req.PubKey, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.Response{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to withdraw funds: %v", err),
-		})
-		fmt.Printf("Failed to withdraw funds: %v\n", err)
+	resp, ok := h.submitWithdrawal(c, user, req.Amount, destination, caps)
+	if !ok {
 		return
 	}
+	c.JSON(http.StatusAccepted, resp)
+}
 
-	// Store transaction hash
-	err = h.db.UpdateWithdrawalTxHash(user.ID, txHash)
-	if err != nil {
-		fmt.Printf("Failed to store transaction hash: %v\n", err)
-		// Don't return error to user since the withdrawal was successful
+// submitWithdrawal reserves a withdrawal that passed checkUserWithdrawal the way its
+// amount calls for: held for approval, batched, or sent by the withdrawal worker. It
+// returns the response accepting it, or writes the error response.
+func (h *Handler) submitWithdrawal(c *gin.Context, user *model.User, amount float64, destination string, caps model.WithdrawalCaps) (model.Response, bool) {
+	if h.requiresApproval(amount) {
+		return h.holdWithdrawal(c, user, amount, destination, caps)
 	}
-
-	newBalance := user.Balance - req.Amount
-	err = h.db.UpdateUserBalance(user.ID, newBalance)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.Response{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to update balance: %v", err),
-		})
-		return
+	if h.shouldBatchWithdrawal(amount) {
+		return h.batchWithdrawal(c, user, amount, destination, caps)
 	}
 
-	userAddress, err := h.ton.GenerateWalletAddressFromPubKey(req.PubKey)
+	// The withdrawal worker sends it, or puts it in the liquidity queue
+	withdrawal, err := h.store(c).ProcessWithdrawal(user.ID, amount, destination, caps)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.Response{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to generate wallet address: %v", err),
-		})
-		return
-	}
-
-	// Add operation record
-	op := &model.Operation{
-		UserID:      user.ID,
-		Type:        "withdrawal",
-		Amount:      req.Amount,
-		Description: fmt.Sprintf("Withdrawal of %.2f TON", req.Amount),
-		Extra:       fmt.Sprintf(`{"tx_hash":"%s"}`, txHash),
-	}
-	if err := h.db.AddOperation(op); err != nil {
-		fmt.Printf("Failed to add operation record: %v\n", err)
-		// Don't return error to user since the withdrawal was successful
+		h.respondReserveError(c, user.ID, amount, err, "failed to create withdrawal")
+		return model.Response{}, false
 	}
+	h.publishQueuedWithdrawal(*withdrawal, model.QueueStatusProcessing, "")
+	h.withdrawalWorker.notify()
 
-	c.JSON(http.StatusOK, model.WithdrawalResponse{
+	return model.Response{
 		Success: true,
-		Amount:  req.Amount,
-		Address: userAddress,
-		TxHash:  txHash,
-	})
+		Data:    withdrawal,
+		Message: fmt.Sprintf("withdrawal is being processed, GET /api/v1/users/by-pubkey/%s/withdrawals/%d tells its status", user.PubKey, withdrawal.ID),
+	}, true
 }
 
-// GetUserOperations handles requests for user operation history
+// GetUserOperations handles requests for user operation history, filtered by the
+// query parameters of operationFilterParams
 func (h *Handler) GetUserOperations(c *gin.Context) {
-	pubKey := c.Param("pub_key")
+	pubKey := h.pubKeyParam(c)
 	if pubKey == "" {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Success: false,
@@ -713,28 +1153,23 @@ func (h *Handler) GetUserOperations(c *gin.Context) {
 		c.JSON(http.StatusNotFound, model.Response{
 			Success: false,
 			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
 		})
 		return
 	}
 
-	// Get page and page_size from query parameters
-	page := 1
-	pageSize := 10
-
-	if pageStr := c.Query("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
+	// Get cursor and page_size from query parameters
+	page, ok := pageParams(c, 10, 100)
+	if !ok {
+		return
 	}
-
-	if pageSizeStr := c.Query("page_size"); pageSizeStr != "" {
-		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-			pageSize = ps
-		}
+	filter, ok := operationFilterParams(c)
+	if !ok {
+		return
 	}
 
 	// Get operations
-	history, err := h.db.GetUserOperations(user.ID, page, pageSize)
+	history, err := h.db.GetUserOperations(user.ID, filter, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Success: false,
@@ -742,6 +1177,7 @@ func (h *Handler) GetUserOperations(c *gin.Context) {
 		})
 		return
 	}
+	h.addOperationDetails(user.ID, history)
 
 	c.JSON(http.StatusOK, model.Response{
 		Success: true,
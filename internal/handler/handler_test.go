@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"tonapp/internal/memstore"
+	"tonapp/internal/model"
+	"tonapp/internal/tonmock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// depositAge is the confirmation depth of deposits in the tests
+const depositAge = 60
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestHandler returns a handler on an empty memstore and a fake TON client holding
+// 1000 TON in the main wallet
+func newTestHandler(t *testing.T) (*Handler, *memstore.Store, *tonmock.Client) {
+	t.Helper()
+	store := memstore.New()
+	fake := tonmock.New(tonmock.Options{WalletBalance: 1000})
+	config := model.Config{
+		Deposit: model.DepositConfig{
+			ConfirmationTiers: []model.DepositConfirmationTier{{MinAmount: 0, MinAgeSeconds: depositAge}},
+		},
+	}
+	return newHandler(store, fake, config), store, fake
+}
+
+// newTestUser registers a user with a fresh wallet key
+func newTestUser(t *testing.T, store *memstore.Store) (*model.User, ed25519.PrivateKey) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, _, err := store.CreateUser(hex.EncodeToString(pub), nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, key
+}
+
+// fundUser credits a completed deposit of amount to the user
+func fundUser(t *testing.T, store *memstore.Store, userID int, amount float64) {
+	t.Helper()
+	deposit, err := store.CreateDepositRequest(userID, amount, fmt.Sprintf("fund%d", userID), "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ClaimDeposit(deposit.ID, time.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CompleteDeposit(*deposit, amount); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve calls a handler with a JSON body in a session of the wallet and decodes its response
+func serve(t *testing.T, handle gin.HandlerFunc, pubKey string, body interface{}) (int, model.Response) {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(contextSessionPubKey, pubKey)
+	handle(c)
+
+	var resp model.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response isn't JSON: %v: %s", err, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func balanceOf(t *testing.T, store *memstore.Store, userID int) float64 {
+	t.Helper()
+	user, err := store.GetUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Balance
+}
+
+func TestConfirmDeposit(t *testing.T) {
+	tests := []struct {
+		name string
+		// transfer is sent to the deposit wallet agedSeconds ago, with the memo unless
+		// otherwise set
+		transfer    float64
+		agedSeconds int64
+		memo        string
+		wantCode    int
+		wantStatus  string
+		wantBalance float64
+		wantDeposit string
+	}{
+		{name: "credited", transfer: 10, agedSeconds: 2 * depositAge, wantCode: http.StatusOK, wantStatus: "completed", wantBalance: 10, wantDeposit: "completed"},
+		{name: "not sent", wantCode: http.StatusBadRequest, wantDeposit: "pending"},
+		{name: "other memo", transfer: 10, agedSeconds: 2 * depositAge, memo: "other", wantCode: http.StatusBadRequest, wantDeposit: "pending"},
+		{name: "awaiting confirmations", transfer: 10, wantCode: http.StatusAccepted, wantStatus: "awaiting_confirmations", wantDeposit: "pending"},
+		{name: "partial", transfer: 4, agedSeconds: 2 * depositAge, wantCode: http.StatusBadRequest, wantStatus: "partial", wantDeposit: "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, fake := newTestHandler(t)
+			user, _ := newTestUser(t, store)
+			deposit, err := store.CreateDepositRequest(user.ID, 10, "memo1", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.transfer > 0 {
+				memo := tt.memo
+				if memo == "" {
+					memo = deposit.Memo
+				}
+				fake.Deposit(fake.GetDepositAddress(), tt.transfer, memo, tt.agedSeconds)
+			}
+
+			code, resp := serve(t, h.ConfirmDeposit, user.PubKey, model.ConfirmDepositRequest{PubKey: user.PubKey, ID: deposit.ID})
+			if code != tt.wantCode {
+				t.Fatalf("code = %d, want %d: %+v", code, tt.wantCode, resp)
+			}
+			if tt.wantStatus != "" {
+				data, _ := resp.Data.(map[string]interface{})
+				if data["status"] != tt.wantStatus {
+					t.Errorf("status = %v, want %s", data["status"], tt.wantStatus)
+				}
+			}
+			if got := balanceOf(t, store, user.ID); got != tt.wantBalance {
+				t.Errorf("balance = %v, want %v", got, tt.wantBalance)
+			}
+			stored, err := store.GetDepositRequest(deposit.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != tt.wantDeposit {
+				t.Errorf("deposit status = %s, want %s", stored.Status, tt.wantDeposit)
+			}
+		})
+	}
+}
+
+func TestConfirmDepositCreditsOnce(t *testing.T) {
+	h, store, fake := newTestHandler(t)
+	user, _ := newTestUser(t, store)
+	deposit, err := store.CreateDepositRequest(user.ID, 10, "memo1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Deposit(fake.GetDepositAddress(), 10, deposit.Memo, 2*depositAge)
+
+	req := model.ConfirmDepositRequest{PubKey: user.PubKey, ID: deposit.ID}
+	if code, resp := serve(t, h.ConfirmDeposit, user.PubKey, req); code != http.StatusOK {
+		t.Fatalf("first confirmation: code = %d: %+v", code, resp)
+	}
+	if code, resp := serve(t, h.ConfirmDeposit, user.PubKey, req); code != http.StatusBadRequest {
+		t.Fatalf("second confirmation: code = %d, want %d: %+v", code, http.StatusBadRequest, resp)
+	}
+	if got := balanceOf(t, store, user.ID); got != 10 {
+		t.Errorf("balance = %v, want 10", got)
+	}
+}
+
+func TestConfirmDepositOfAnotherUser(t *testing.T) {
+	h, store, fake := newTestHandler(t)
+	owner, _ := newTestUser(t, store)
+	other, _ := newTestUser(t, store)
+	deposit, err := store.CreateDepositRequest(owner.ID, 10, "memo1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Deposit(fake.GetDepositAddress(), 10, deposit.Memo, 2*depositAge)
+
+	code, resp := serve(t, h.ConfirmDeposit, other.PubKey, model.ConfirmDepositRequest{PubKey: other.PubKey, ID: deposit.ID})
+	if code != http.StatusForbidden {
+		t.Fatalf("code = %d, want %d: %+v", code, http.StatusForbidden, resp)
+	}
+	code, resp = serve(t, h.ConfirmDeposit, other.PubKey, model.ConfirmDepositRequest{PubKey: owner.PubKey, ID: deposit.ID})
+	if code != http.StatusForbidden || resp.Code != model.ErrorSessionWalletMismatch {
+		t.Fatalf("code = %d, want %d with %s: %+v", code, http.StatusForbidden, model.ErrorSessionWalletMismatch, resp)
+	}
+	if got := balanceOf(t, store, owner.ID); got != 0 {
+		t.Errorf("balance = %v, want 0", got)
+	}
+}
+
+// withdrawalRequest returns a withdrawal request signed by the wallet key
+func withdrawalRequest(t *testing.T, h *Handler, user *model.User, key ed25519.PrivateKey, amount float64) model.WithdrawalRequest {
+	t.Helper()
+	ch, err := h.issueChallenge(user.ID, ChallengePurposeWithdrawal, withdrawalChallengeDetails(amount, 0, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.WithdrawalRequest{
+		PubKey:    user.PubKey,
+		Amount:    amount,
+		Nonce:     ch.Nonce,
+		Signature: hex.EncodeToString(ed25519.Sign(key, []byte(ch.Message))),
+	}
+}
+
+func TestWithdrawFunds(t *testing.T) {
+	h, store, fake := newTestHandler(t)
+	user, key := newTestUser(t, store)
+	fundUser(t, store, user.ID, 100)
+
+	code, resp := serve(t, h.WithdrawFunds, user.PubKey, withdrawalRequest(t, h, user, key, 30))
+	if code != http.StatusAccepted {
+		t.Fatalf("code = %d, want %d: %+v", code, http.StatusAccepted, resp)
+	}
+	if got := balanceOf(t, store, user.ID); got != 70 {
+		t.Errorf("balance after the request = %v, want 70", got)
+	}
+	if n := len(fake.Transfers()); n != 0 {
+		t.Fatalf("%d transfers sent before the worker ran", n)
+	}
+
+	// The withdrawal worker sends it
+	sent, err := h.ProcessWithdrawals(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("ProcessWithdrawals = %d, %v, want 1 sent", sent, err)
+	}
+	transfers := fake.Transfers()
+	if len(transfers) != 1 {
+		t.Fatalf("%d transfers sent, want 1", len(transfers))
+	}
+	wallet, _ := fake.GenerateWalletAddressFromPubKey(user.PubKey)
+	if transfers[0].To != wallet || transfers[0].Amount != 30 {
+		t.Errorf("sent %v TON to %s, want 30 TON to %s", transfers[0].Amount, transfers[0].To, wallet)
+	}
+
+	queued, err := store.GetUserQueuedWithdrawals(user.ID)
+	if err != nil || len(queued) != 1 {
+		t.Fatalf("queued withdrawals = %v, %v", queued, err)
+	}
+	if queued[0].Status != model.QueueStatusSent || queued[0].TxHash != transfers[0].Hash {
+		t.Errorf("withdrawal is %s with %q, want %s with %q", queued[0].Status, queued[0].TxHash, model.QueueStatusSent, transfers[0].Hash)
+	}
+	if got := balanceOf(t, store, user.ID); got != 70 {
+		t.Errorf("balance after sending = %v, want 70", got)
+	}
+}
+
+func TestWithdrawFundsRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   float64
+		signed   float64 // amount of the signed challenge, amount if 0
+		setup    func(h *Handler)
+		wantCode int
+		wantErr  model.ErrorCode
+	}{
+		{name: "insufficient balance", amount: 150, wantCode: http.StatusBadRequest, wantErr: model.ErrorInsufficientBalance},
+		{name: "signed for another amount", amount: 30, signed: 10, wantCode: http.StatusUnauthorized, wantErr: model.ErrorWithdrawalUnconfirmed},
+		{name: "above the maximum", amount: 30, setup: func(h *Handler) { h.config().WithdrawalLimits.MaxAmount = 20 }, wantCode: http.StatusBadRequest, wantErr: model.ErrorWithdrawalLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, store, fake := newTestHandler(t)
+			if tt.setup != nil {
+				tt.setup(h)
+			}
+			user, key := newTestUser(t, store)
+			fundUser(t, store, user.ID, 100)
+
+			signed := tt.signed
+			if signed == 0 {
+				signed = tt.amount
+			}
+			req := withdrawalRequest(t, h, user, key, signed)
+			req.Amount = tt.amount
+
+			code, resp := serve(t, h.WithdrawFunds, user.PubKey, req)
+			if code != tt.wantCode || resp.Code != tt.wantErr {
+				t.Fatalf("code = %d with %s, want %d with %s: %+v", code, resp.Code, tt.wantCode, tt.wantErr, resp)
+			}
+			if got := balanceOf(t, store, user.ID); got != 100 {
+				t.Errorf("balance = %v, want 100", got)
+			}
+			if _, err := h.ProcessWithdrawals(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(fake.Transfers()); n != 0 {
+				t.Errorf("%d transfers sent, want none", n)
+			}
+		})
+	}
+}
+
+func TestWithdrawFundsDailyLimit(t *testing.T) {
+	h, store, _ := newTestHandler(t)
+	h.config().WithdrawalLimits.DailyAmount = 50
+	user, key := newTestUser(t, store)
+	fundUser(t, store, user.ID, 100)
+
+	if code, resp := serve(t, h.WithdrawFunds, user.PubKey, withdrawalRequest(t, h, user, key, 30)); code != http.StatusAccepted {
+		t.Fatalf("first withdrawal: code = %d: %+v", code, resp)
+	}
+	code, resp := serve(t, h.WithdrawFunds, user.PubKey, withdrawalRequest(t, h, user, key, 30))
+	if code != http.StatusBadRequest || resp.Code != model.ErrorWithdrawalLimit {
+		t.Fatalf("second withdrawal: code = %d with %s, want %d with %s: %+v", code, resp.Code, http.StatusBadRequest, model.ErrorWithdrawalLimit, resp)
+	}
+	if got := balanceOf(t, store, user.ID); got != 70 {
+		t.Errorf("balance = %v, want 70", got)
+	}
+}
+
+func TestWithdrawFundsAfterRejectedReview(t *testing.T) {
+	h, store, _ := newTestHandler(t)
+	user, key := newTestUser(t, store)
+	fundUser(t, store, user.ID, 100)
+
+	deposit, err := store.CreateDepositRequest(user.ID, 50, "review1", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ClaimDeposit(deposit.ID, time.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.EscalateDeposit(deposit.ID); err != nil {
+		t.Fatal(err)
+	}
+	reject := func(c *gin.Context) {
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(deposit.ID)}}
+		h.RejectEscalatedDeposit(c)
+	}
+	if code, resp := serve(t, reject, "", nil); code != http.StatusOK {
+		t.Fatalf("rejecting the review: code = %d: %+v", code, resp)
+	}
+
+	code, resp := serve(t, h.WithdrawFunds, user.PubKey, withdrawalRequest(t, h, user, key, 30))
+	if code != http.StatusAccepted {
+		t.Fatalf("code = %d, want %d: %+v", code, http.StatusAccepted, resp)
+	}
+	if got := balanceOf(t, store, user.ID); got != 70 {
+		t.Errorf("balance = %v, want 70", got)
+	}
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// historyUser resolves the user of a history listing, responding with an error if needed
+func (h *Handler) historyUser(c *gin.Context) (*model.User, bool) {
+	pubKey := h.pubKeyParam(c)
+	if pubKey == "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "missing pub_key parameter",
+		})
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByPubKey(pubKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// operationTypePattern matches operation type names such as investment_created
+var operationTypePattern = regexp.MustCompile(`^[a-z][a-z_]{0,63}$`)
+
+// operationFilterParams reads the type, tag, from/to (unix times, to excluded) and
+// min_amount/max_amount filters of an operation listing, responding with 400 if one is
+// invalid
+func operationFilterParams(c *gin.Context) (model.OperationFilter, bool) {
+	var filter model.OperationFilter
+	invalid := func(message string) (model.OperationFilter, bool) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   message,
+		})
+		return model.OperationFilter{}, false
+	}
+
+	if opType := strings.ToLower(c.Query("type")); opType != "" {
+		if !operationTypePattern.MatchString(opType) {
+			return invalid("invalid type")
+		}
+		filter.Type = model.OperationType(opType)
+	}
+	tag, ok := tagParam(c)
+	if !ok {
+		return model.OperationFilter{}, false
+	}
+	filter.Tag = tag
+
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := c.Query(p.name); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				return invalid("invalid " + p.name + ", expected a unix timestamp")
+			}
+			*p.dst = n
+		}
+	}
+	if filter.From > 0 && filter.To > 0 && filter.From >= filter.To {
+		return invalid("from must be before to")
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *float64
+	}{{"min_amount", &filter.MinAmount}, {"max_amount", &filter.MaxAmount}} {
+		if value := c.Query(p.name); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount < 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+				return invalid("invalid " + p.name)
+			}
+			*p.dst = amount
+		}
+	}
+	if filter.MinAmount > 0 && filter.MaxAmount > 0 && filter.MinAmount > filter.MaxAmount {
+		return invalid("min_amount must not exceed max_amount")
+	}
+	return filter, true
+}
+
+// GetDepositHistory returns the user's deposit requests, newest first
+func (h *Handler) GetDepositHistory(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	page, ok := pageParams(c, 20, 100)
+	if !ok {
+		return
+	}
+
+	history, err := h.db.GetDepositHistory(user.ID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposits",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    history,
+	})
+}
+
+// GetWithdrawalHistory returns the user's completed withdrawals, newest first, with
+// the filters of the operation history except type
+func (h *Handler) GetWithdrawalHistory(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	page, ok := pageParams(c, 20, 100)
+	if !ok {
+		return
+	}
+	filter, ok := operationFilterParams(c)
+	if !ok {
+		return
+	}
+	filter.Type = model.OperationTypeWithdrawal
+
+	history, err := h.db.GetUserOperations(user.ID, filter, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawals",
+		})
+		return
+	}
+	h.addOperationDetails(user.ID, history)
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    history,
+	})
+}
+
+// GetReferralEarningHistory returns the referral earnings credited to the user, newest first
+func (h *Handler) GetReferralEarningHistory(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	page, ok := pageParams(c, 20, 100)
+	if !ok {
+		return
+	}
+
+	history, err := h.db.GetReferralEarningHistory(user.ID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get referral earnings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    history,
+	})
+}
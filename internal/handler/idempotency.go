@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"tonapp/internal/middleware"
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultIdempotencyTTL is used when idempotency.ttl_hours isn't set
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyPruneInterval is how often StartIdempotencyCleanup removes expired keys
+	idempotencyPruneInterval = time.Hour
+	// maxIdempotencyKey bounds the length of a key
+	maxIdempotencyKey = 255
+)
+
+// idempotencyWriter keeps a copy of the response to store it for the key
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyTTL returns how long a key replays its response
+func (h *Handler) idempotencyTTL() time.Duration {
+	if hours := h.config().Idempotency.TTLHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultIdempotencyTTL
+}
+
+// validIdempotencyKey reports whether a key is 1 to 255 visible ASCII characters
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '!' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Idempotency replays the stored response when a request is repeated with the same
+// Idempotency-Key header within idempotency.ttl_hours, so a client retrying after a lost
+// response doesn't deposit, withdraw or invest twice. Keys are per wallet session.
+// Every response is stored, failures too: a withdrawal failing after its transfer was
+// sent must not run again, so retrying a failed request needs a new key.
+// Requests without the header run as usual.
+func (h *Handler) Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(middleware.IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "Idempotency-Key must be 1 to 255 visible ASCII characters",
+				Code:    model.ErrorIdempotencyKeyInvalid,
+			})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "failed to read request body",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := strings.ToLower(c.GetString(contextSessionPubKey))
+		if scope == "" {
+			scope = "ip:" + c.ClientIP()
+		}
+		hash := sha256.New()
+		io.WriteString(hash, c.Request.Method+" "+c.Request.URL.Path+"\n")
+		hash.Write(body)
+		now := time.Now()
+		record := &model.IdempotencyRecord{
+			Scope:       scope,
+			Key:         key,
+			Route:       c.FullPath(),
+			RequestHash: hex.EncodeToString(hash.Sum(nil)),
+			CreatedAt:   now.Unix(),
+		}
+
+		existing, err := h.db.ClaimIdempotencyKey(record, now.Add(-h.idempotencyTTL()).Unix())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to check Idempotency-Key",
+			})
+			return
+		}
+		if existing != nil {
+			replayIdempotent(c, record, existing)
+			return
+		}
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		completed := false
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			if completed {
+				return
+			}
+			// The request panicked before a response, a retry may run it again
+			if err := h.db.ReleaseIdempotencyKey(scope, key); err != nil {
+				slog.Error("Failed to release Idempotency-Key", "route", record.Route, "error", err)
+			}
+		}()
+
+		c.Next()
+
+		completed = true
+		status := writer.Status()
+		if err := h.db.CompleteIdempotencyKey(scope, key, status, writer.Header().Get("Content-Type"), writer.body.Bytes()); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to store Idempotency-Key response", "route", record.Route, "status", status, "error", err)
+		}
+	}
+}
+
+// replayIdempotent answers a request repeating a claimed key: with the stored response,
+// 409 while the first request still runs, or 422 when the key was used for another
+// request
+func replayIdempotent(c *gin.Context, record, existing *model.IdempotencyRecord) {
+	switch {
+	case existing.RequestHash != record.RequestHash:
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, model.Response{
+			Success: false,
+			Error:   "Idempotency-Key was already used for another request",
+			Code:    model.ErrorIdempotencyKeyReused,
+		})
+	case existing.Status == 0:
+		c.AbortWithStatusJSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "a request with this Idempotency-Key is still in progress",
+			Code:    model.ErrorIdempotencyInProgress,
+		})
+	default:
+		c.Header(middleware.IdempotentReplayedHeader, "true")
+		c.Data(existing.Status, existing.ContentType, existing.Body)
+		c.Abort()
+	}
+}
+
+// StartIdempotencyCleanup periodically removes the Idempotency-Keys older than
+// idempotency.ttl_hours
+func (h *Handler) StartIdempotencyCleanup(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := h.db.DeleteIdempotencyKeysBefore(time.Now().Add(-h.idempotencyTTL()).Unix()); err != nil {
+			slog.Error("Failed to prune Idempotency-Keys", "error", err)
+		} else if n > 0 {
+			slog.Info("Pruned Idempotency-Keys", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// treasuryWallets lists the wallets the indexer follows
+func (h *Handler) treasuryWallets() []string {
+	seen := make(map[string]bool)
+	var wallets []string
+	add := func(addr string) {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			wallets = append(wallets, addr)
+		}
+	}
+
+	add(h.ton.GetDepositAddress())
+	for _, name := range h.ton.TreasuryWalletNames() {
+		add(h.ton.TreasuryAddress(name))
+	}
+	add(h.config().TON.FeeWalletAddress)
+	for _, addr := range h.config().Indexer.ExtraWallets {
+		add(addr)
+	}
+	return wallets
+}
+
+// StartChainIndexer continuously ingests treasury wallet transactions into the local table
+func (h *Handler) StartChainIndexer(ctx context.Context) {
+	if !h.config().Indexer.Enabled {
+		return
+	}
+
+	interval := time.Duration(h.config().Indexer.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := h.IndexTreasuryWallets(ctx); err != nil {
+			slog.Error("Failed to index treasury wallets", "error", err)
+		} else if n > 0 {
+			slog.Info("Indexed treasury transactions", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// IndexTreasuryWallets ingests new transactions of every treasury wallet since its cursor.
+// Returns the number of ingested transactions.
+func (h *Handler) IndexTreasuryWallets(ctx context.Context) (int, error) {
+	total := 0
+	for _, wallet := range h.treasuryWallets() {
+		n, err := h.indexWallet(ctx, wallet)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// indexWallet ingests the new transactions of one wallet since its cursor. Runs of the
+// ticker and of webhook events are serialized so they don't ingest the same range twice.
+func (h *Handler) indexWallet(ctx context.Context, wallet string) (int, error) {
+	h.indexing.Lock()
+	defer h.indexing.Unlock()
+
+	cursor, err := h.db.GetIndexerCursor(wallet)
+	if err != nil {
+		return 0, err
+	}
+
+	// Only the first run is bounded; afterwards everything past the cursor is ingested
+	// so the table has no gaps
+	limit := 0
+	if cursor.LastLT == 0 {
+		limit = h.config().Indexer.BackfillLimit
+		if limit <= 0 {
+			limit = 500
+		}
+	}
+
+	txs, err := h.ton.FetchTransactionsSince(ctx, wallet, cursor.LastLT, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", wallet, err)
+	}
+
+	if err := h.db.SaveChainTransactions(wallet, txs); err != nil {
+		return 0, err
+	}
+	return len(txs), nil
+}
+
+// depositCheckWindow is how far back the regular deposit checks look for the transfer
+// of a memo deposit, see the archive lookup for older ones
+const depositCheckWindow = 30 * time.Minute
+
+// depositMatch returns the transfers credited for a deposit request under deposit.matching.
+// A credited transaction is recorded as the request's tx_hash, so it can't credit another
+// request through any of the lookups.
+func (h *Handler) depositMatch(deposit *model.DepositRequest) ton.DepositMatch {
+	cfg := h.config().Deposit
+	return ton.DepositMatch{
+		Amount:                deposit.Amount,
+		DepositMatchingConfig: cfg.Matching,
+		ConfirmationTiers:     cfg.ConfirmationTiers,
+		Claim: func(txHash string) (bool, error) {
+			return h.db.SetDepositTxHash(deposit.ID, txHash)
+		},
+	}
+}
+
+// checkDeposit matches a deposit request against the indexed transactions when the
+// indexer is running, and falls back to querying the chain directly otherwise. Returns
+// the amount received, 0 while no transfer is credited for the request.
+func (h *Handler) checkDeposit(walletAddress string, deposit *model.DepositRequest) (float64, error) {
+	match := h.depositMatch(deposit)
+	if deposit.DepositAddress != "" {
+		// Personal addresses aren't indexed; any transfer for the deposit since the
+		// request was created is the deposit
+		return h.ton.CheckAddressDeposit(walletAddress, match, deposit.CreatedAt)
+	}
+	if !h.config().Indexer.Enabled {
+		return h.ton.CheckDeposit(walletAddress, match, deposit.Memo, int(depositCheckWindow/time.Minute))
+	}
+
+	since := time.Now().Add(-depositCheckWindow).Unix()
+	txs, err := h.db.FindIndexedDeposits(walletAddress, deposit.Memo, since)
+	if err != nil {
+		return 0, err
+	}
+	var found *model.ChainTransaction
+	awaiting := false
+	partial := 0.0
+	for i := range txs {
+		credited, short := match.Credits(txs[i].InAmount)
+		if short && partial == 0 {
+			partial = txs[i].InAmount
+		}
+		if !credited {
+			continue
+		}
+		if txs[i].Utime > time.Now().Unix()-int64(match.MinAgeSeconds(txs[i].InAmount)) {
+			awaiting = true
+			continue
+		}
+		claimed, err := match.ClaimTransaction(txs[i].Hash)
+		if err != nil {
+			return 0, err
+		}
+		if claimed {
+			found = &txs[i]
+			break
+		}
+	}
+	if found == nil {
+		if awaiting {
+			return 0, ton.ErrAwaitingConfirmations
+		}
+		if partial > 0 {
+			return 0, &ton.PartialDepositError{Expected: deposit.Amount, Received: partial}
+		}
+		return 0, nil
+	}
+
+	// Same as the direct check: forward the platform share before crediting
+	if err := h.ton.TransferFundsWithSplit(context.Background(), found.InAmount, h.config().TON.FeeWalletAddress); err != nil {
+		return 0, err
+	}
+	return found.InAmount, nil
+}
+
+// GetIndexerStatus returns the indexer cursor of every treasury wallet
+func (h *Handler) GetIndexerStatus(c *gin.Context) {
+	cursors, err := h.db.GetIndexerCursors()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get indexer status",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"enabled":  h.config().Indexer.Enabled,
+			"wallets":  cursors,
+			"webhooks": h.chainWebhooks.snapshot(h.config().ChainWebhooks),
+		},
+	})
+}
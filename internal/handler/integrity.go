@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultIntegritySampleSize is used when integrity.sample_size isn't set
+const defaultIntegritySampleSize = 10
+
+// integrityAdvice says how to fix what each integrity check finds, repairable checks
+// are fixed by Store.RepairIntegrity
+var integrityAdvice = map[string]struct {
+	repairable bool
+	advice     string
+}{
+	model.IntegrityOrphanedOperations: {true,
+		"deletes the operations, tags and notes of deleted users, their ledger entries stay"},
+	model.IntegrityOrphanedEarnings: {true,
+		"deletes the referral earnings of deleted referrers, their ledger entries stay"},
+	model.IntegrityNegativeBalances: {false,
+		"find the cause in GET /admin/users/:id/ledger, then correct the balance with PUT /users/:id/balance"},
+	model.IntegrityPendingWithdrawalsWithTxHash: {true,
+		"marks the withdrawals completed, their transfer was sent"},
+	model.IntegrityUnsettledWithdrawalsWithTxHash: {false,
+		"look the transfer up in the explorer; the balance movement of the send wasn't recorded, so don't mark them sent without posting it"},
+	model.IntegrityDuplicatePubKeys: {false,
+		"the wallet signs in as one of the users only, move the balance of the others with PUT /users/:id/balance and delete them"},
+}
+
+// repairableIntegrityChecks lists the checks with an automatic repair, sorted
+func repairableIntegrityChecks() []string {
+	var names []string
+	for name, advice := range integrityAdvice {
+		if advice.repairable {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// integrityReport runs the integrity checks and adds the repair advice
+func (h *Handler) integrityReport() (*model.IntegrityReport, error) {
+	sampleSize := h.config().Integrity.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = defaultIntegritySampleSize
+	}
+	checks, err := h.db.CheckIntegrity(sampleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.IntegrityReport{CheckedAt: time.Now().Unix(), Healthy: true, Checks: checks}
+	for i := range report.Checks {
+		check := &report.Checks[i]
+		advice := integrityAdvice[check.Name]
+		check.Repairable = advice.repairable
+		if check.Count > 0 {
+			check.Advice = advice.advice
+			report.Healthy = false
+		}
+	}
+	return report, nil
+}
+
+// StartIntegrityCheck checks the database once at startup when integrity.check_on_startup
+// is set, logging what it found, and runs the repairs of integrity.auto_repair
+func (h *Handler) StartIntegrityCheck(ctx context.Context) {
+	cfg := h.config().Integrity
+	if !cfg.CheckOnStartup {
+		return
+	}
+
+	report, err := h.integrityReport()
+	if err != nil {
+		slog.Error("Failed to check database integrity", "error", err)
+		return
+	}
+	if report.Healthy {
+		slog.Info("Database integrity check passed")
+		return
+	}
+
+	autoRepair := make(map[string]bool)
+	for _, name := range cfg.AutoRepair {
+		autoRepair[name] = integrityAdvice[name].repairable
+	}
+	for _, check := range report.Checks {
+		if check.Count == 0 {
+			continue
+		}
+		if !autoRepair[check.Name] {
+			slog.Warn("Database integrity check failed", "check", check.Name, "count", check.Count,
+				"repairable", check.Repairable, "advice", check.Advice)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		n, err := h.db.RepairIntegrity(check.Name)
+		if err != nil {
+			slog.Error("Failed to repair database integrity", "check", check.Name, "count", check.Count, "error", err)
+			continue
+		}
+		slog.Info("Repaired database integrity", "check", check.Name, "count", n)
+	}
+}
+
+// GetIntegrityReport checks the database for orphaned records, negative balances, sent
+// withdrawals still pending and wallets with several users (admin only)
+func (h *Handler) GetIntegrityReport(c *gin.Context) {
+	report, err := h.integrityReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to check integrity: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// RepairIntegrity runs the automatic repairs of the requested checks and returns what
+// they fixed with a new report (admin only)
+func (h *Handler) RepairIntegrity(c *gin.Context) {
+	var req model.IntegrityRepairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	for _, name := range req.Checks {
+		if !integrityAdvice[name].repairable {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error: fmt.Sprintf("%s has no automatic repair, repairable checks: %s",
+					name, strings.Join(repairableIntegrityChecks(), ", ")),
+			})
+			return
+		}
+	}
+
+	repairs := make([]model.IntegrityRepair, 0, len(req.Checks))
+	for _, name := range req.Checks {
+		n, err := h.db.RepairIntegrity(name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("failed to repair %s: %v", name, err),
+			})
+			return
+		}
+		slog.InfoContext(c.Request.Context(), "Repaired database integrity", "check", name, "count", n)
+		repairs = append(repairs, model.IntegrityRepair{Check: name, Repaired: n})
+	}
+
+	report, err := h.integrityReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to check integrity: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"repairs": repairs,
+			"report":  report,
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserLedger returns the ledger entries of a user account, newest first (admin only)
+func (h *Handler) GetUserLedger(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+	page, ok := pageParams(c, 50, 500)
+	if !ok {
+		return
+	}
+
+	history, err := h.db.GetUserLedger(userID, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get ledger: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    history,
+	})
+}
+
+// ReconcileLedger checks every user balance against the ledger (admin only)
+func (h *Handler) ReconcileLedger(c *gin.Context) {
+	report, err := h.db.ReconcileLedger()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to reconcile ledger: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// GetBalanceAsOf returns the balance and open investments of a user at the unix time
+// given by ?at=, reconstructed from the ledger, for settling disputes (admin only)
+func (h *Handler) GetBalanceAsOf(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+	at, err := strconv.ParseInt(c.Query("at"), 10, 64)
+	if err != nil || at <= 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "at must be a unix timestamp",
+		})
+		return
+	}
+	if at > time.Now().Unix() {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "at must not be in the future",
+		})
+		return
+	}
+
+	balance, err := h.db.GetBalanceAsOf(userID, at)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to reconstruct balance: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    balance,
+	})
+}
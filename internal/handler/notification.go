@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMarkedNotifications bounds the ids of one mark-as-read request
+const maxMarkedNotifications = 500
+
+// notifyUser stores a notification in the user's inbox, DispatchNotifications delivers
+// it to Telegram. Title and body are written by text in the user's language and number
+// format. Failing to store it doesn't fail the operation it is about.
+func (h *Handler) notifyUser(userID int, kind string, text func(l locale) (title, body string)) {
+	title, body := text(h.userLocale(userID))
+	n := &model.Notification{UserID: userID, Kind: kind, Title: title, Body: body}
+	if err := h.db.AddNotification(n); err != nil {
+		slog.Error("Failed to store notification", "user_id", userID, "kind", kind, "error", err)
+	}
+}
+
+// notifyDepositCredited tells the user a deposit arrived and was added to the balance
+func (h *Handler) notifyDepositCredited(userID int, amount float64) {
+	h.notifyUser(userID, "deposit_credited", func(l locale) (string, string) {
+		return l.text("deposit_credited.title"), l.text("deposit_credited.body", l.amount(amount))
+	})
+}
+
+// notifyWithdrawalSent tells the user a withdrawal left the wallet
+func (h *Handler) notifyWithdrawalSent(userID int, amount float64, txHash string) {
+	h.notifyUser(userID, "withdrawal_sent", func(l locale) (string, string) {
+		return l.text("withdrawal_sent.title"), l.text("withdrawal_sent.body", l.amount(amount), txHash)
+	})
+}
+
+// notifyWithdrawalFailed tells the user a withdrawal failed and the amount is back on the balance
+func (h *Handler) notifyWithdrawalFailed(userID int, amount float64) {
+	h.notifyUser(userID, "withdrawal_failed", func(l locale) (string, string) {
+		return l.text("withdrawal_failed.title"), l.text("withdrawal_failed.body", l.amount(amount))
+	})
+}
+
+// notifyProfitAccrued tells the user the net profit credited by an accrual run
+func (h *Handler) notifyProfitAccrued(userID int, profit float64) {
+	h.notifyUser(userID, "profit_accrued", func(l locale) (string, string) {
+		return l.text("profit_accrued.title"), l.text("profit_accrued.body", l.amount(profit))
+	})
+}
+
+// GetNotifications returns the user's notification inbox, newest first, with the number
+// of unread notifications. ?unread=true lists only the unread ones.
+func (h *Handler) GetNotifications(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+	page, ok := pageParams(c, 20, 100)
+	if !ok {
+		return
+	}
+
+	inbox, err := h.db.GetNotifications(user.ID, c.Query("unread") == "true", page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    inbox,
+	})
+}
+
+// MarkNotificationsRead marks the listed notifications of the user as read, or all of
+// them with "all": true, and returns the remaining unread count
+func (h *Handler) MarkNotificationsRead(c *gin.Context) {
+	var req model.MarkNotificationsReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request",
+		})
+		return
+	}
+	if req.All == (len(req.IDs) > 0) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "either ids or all is required",
+		})
+		return
+	}
+	if len(req.IDs) > maxMarkedNotifications {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "too many ids, use all to mark every notification as read",
+		})
+		return
+	}
+
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+
+	marked, err := h.db.MarkNotificationsRead(user.ID, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to mark notifications as read",
+		})
+		return
+	}
+	unread, err := h.db.CountUnreadNotifications(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to count unread notifications",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: model.MarkNotificationsReadResponse{
+			Marked: marked,
+			Unread: unread,
+		},
+	})
+}
+
+// notificationPreferences returns the Telegram delivery preferences of a user
+func (h *Handler) notificationPreferences(userID int) (*model.NotificationPreferences, error) {
+	optedOut, err := h.db.GetNotificationOptOuts(userID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = h.db.GetTelegramChat(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &model.NotificationPreferences{
+		TelegramBound: err == nil,
+		Kinds:         model.NotificationKinds,
+		OptedOut:      optedOut,
+	}, nil
+}
+
+// GetNotificationPreferences returns whether the user's notifications are sent to
+// Telegram and the kinds they opted out of
+func (h *Handler) GetNotificationPreferences(c *gin.Context) {
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+
+	prefs, err := h.notificationPreferences(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get notification preferences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    prefs,
+	})
+}
+
+// UpdateNotificationPreferences replaces the kinds of notifications the user doesn't
+// want sent to Telegram, an empty list sends all of them
+func (h *Handler) UpdateNotificationPreferences(c *gin.Context) {
+	var req model.UpdateNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request",
+		})
+		return
+	}
+	known := make(map[string]bool, len(model.NotificationKinds))
+	for _, kind := range model.NotificationKinds {
+		known[kind] = true
+	}
+	for _, kind := range req.OptedOut {
+		if !known[kind] {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("unknown notification kind %q", kind),
+			})
+			return
+		}
+	}
+
+	user, ok := h.historyUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.SetNotificationOptOuts(user.ID, req.OptedOut); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to update notification preferences",
+		})
+		return
+	}
+	prefs, err := h.notificationPreferences(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get notification preferences",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    prefs,
+	})
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"tonapp/internal/telegram"
+)
+
+const (
+	// notificationDispatchInterval is how often new notifications are sent to Telegram
+	notificationDispatchInterval = 5 * time.Second
+	// notificationDispatchBatch bounds the messages of one run, well below the rate
+	// Telegram allows a bot
+	notificationDispatchBatch = 100
+	// maxNotificationDeliveryAge skips notifications that waited longer, e.g. while the
+	// bot was disabled, they are only kept in the inbox
+	maxNotificationDeliveryAge = time.Hour
+)
+
+// StartNotificationDispatcher sends new notifications to the Telegram chats of their
+// users while telegram.bot_enabled is set
+func (h *Handler) StartNotificationDispatcher(ctx context.Context) {
+	if h.bot == nil {
+		return
+	}
+	ticker := time.NewTicker(notificationDispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := h.DispatchNotifications(ctx, time.Now()); err != nil {
+			slog.Error("Failed to dispatch notifications", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchNotifications sends the notifications not dispatched yet to the Telegram chat
+// bound to their user, oldest first. Users without a chat, kinds the user opted out of
+// and notifications older than maxNotificationDeliveryAge are skipped, and the chat of
+// users who blocked the bot is unbound. A failed message stops the run and is retried by
+// the next one. Returns the number of messages sent.
+func (h *Handler) DispatchNotifications(ctx context.Context, now time.Time) (int, error) {
+	notifications, err := h.db.GetUndispatchedNotifications(notificationDispatchBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	chats := make(map[int]int64) // 0 for users without a chat
+	optOuts := make(map[int]map[string]bool)
+	dispatched := make([]int64, 0, len(notifications))
+	sent := 0
+	var sendErr error
+	for _, n := range notifications {
+		if now.Sub(time.Unix(n.CreatedAt, 0)) > maxNotificationDeliveryAge {
+			dispatched = append(dispatched, n.ID)
+			continue
+		}
+
+		chatID, ok := chats[n.UserID]
+		if !ok {
+			chatID, sendErr = h.db.GetTelegramChat(n.UserID)
+			if sendErr == sql.ErrNoRows {
+				chatID, sendErr = 0, nil
+			}
+			if sendErr != nil {
+				break
+			}
+			chats[n.UserID] = chatID
+		}
+		if chatID == 0 {
+			dispatched = append(dispatched, n.ID)
+			continue
+		}
+
+		if optOuts[n.UserID] == nil {
+			kinds, err := h.db.GetNotificationOptOuts(n.UserID)
+			if err != nil {
+				sendErr = err
+				break
+			}
+			optOuts[n.UserID] = make(map[string]bool, len(kinds))
+			for _, kind := range kinds {
+				optOuts[n.UserID][kind] = true
+			}
+		}
+		if optOuts[n.UserID][n.Kind] {
+			dispatched = append(dispatched, n.ID)
+			continue
+		}
+
+		err := h.bot.SendMessage(ctx, chatID, n.Title+"\n\n"+n.Body, h.botAppButtons()...)
+		if telegram.IsBlocked(err) {
+			slog.Info("Unbinding Telegram chat of a user who blocked the bot", "user_id", n.UserID)
+			if err := h.db.DeleteTelegramChat(n.UserID); err != nil {
+				slog.Error("Failed to unbind Telegram chat", "user_id", n.UserID, "error", err)
+			}
+			chats[n.UserID] = 0
+		} else if err != nil {
+			sendErr = err
+			break
+		} else {
+			sent++
+		}
+		dispatched = append(dispatched, n.ID)
+	}
+
+	if err := h.db.MarkNotificationsDispatched(dispatched); err != nil {
+		return sent, err
+	}
+	return sent, sendErr
+}
+
+// bindTelegramChat binds the chat a Telegram user messaged the bot from to the account
+// with their user ID, so its notifications are delivered there. Users usually /start the
+// bot before registering, the binding then applies once they do.
+func (h *Handler) bindTelegramChat(userID int, chatID int64) {
+	if bound, err := h.db.GetTelegramChat(userID); err == nil && bound == chatID {
+		return
+	}
+	if err := h.db.SetTelegramChat(userID, chatID); err != nil {
+		slog.Error("Failed to bind Telegram chat", "user_id", userID, "error", err)
+	}
+}
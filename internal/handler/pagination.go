@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageParams reads the cursor and page_size query parameters. It responds
+// with 400 and returns false if the cursor wasn't issued by this API.
+func pageParams(c *gin.Context, defaultLimit, maxLimit int) (pagination.Params, bool) {
+	params, err := pagination.Parse(c.Query("cursor"), c.Query("page_size"), defaultLimit, maxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid cursor",
+		})
+		return params, false
+	}
+	return params, true
+}
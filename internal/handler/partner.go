@@ -0,0 +1,281 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	partnerTokenPrefix = "tpp_"
+
+	// rateLimitTokenTTL is how long the rate limiter trusts a token lookup, revoking a
+	// token through the API takes effect immediately
+	rateLimitTokenTTL        = 30 * time.Second
+	maxCachedRateLimitTokens = 10000
+)
+
+// rateLimitToken is a cached lookup of an API token for the rate limiter
+type rateLimitToken struct {
+	key       string
+	tier      string
+	ok        bool
+	expiresAt time.Time
+}
+
+// rateLimitTokens caches token lookups by hash, so the rate limiter doesn't query the
+// store on every request
+type rateLimitTokens struct {
+	mu     sync.Mutex
+	tokens map[string]rateLimitToken
+}
+
+func (t *rateLimitTokens) get(hash string, now time.Time) (rateLimitToken, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	token, ok := t.tokens[hash]
+	if !ok || now.After(token.expiresAt) {
+		return rateLimitToken{}, false
+	}
+	return token, true
+}
+
+func (t *rateLimitTokens) put(hash string, token rateLimitToken) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tokens == nil || len(t.tokens) >= maxCachedRateLimitTokens {
+		t.tokens = make(map[string]rateLimitToken)
+	}
+	t.tokens[hash] = token
+}
+
+func (t *rateLimitTokens) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = nil
+}
+
+// RateLimitTokenTier resolves the rate limit bucket of an API token: partner tokens
+// use the tier they were approved with, personal tokens rate_limit.token_tier
+func (h *Handler) RateLimitTokenTier(token string) (string, string, bool) {
+	isPartner := strings.HasPrefix(token, partnerTokenPrefix)
+	if !isPartner && (!strings.HasPrefix(token, apiTokenPrefix) || h.config().RateLimit.TokenTier == "") {
+		return "", "", false
+	}
+
+	now := time.Now()
+	hash := hashAPIToken(token)
+	if cached, ok := h.rateLimitTokens.get(hash, now); ok {
+		return cached.key, cached.tier, cached.ok
+	}
+
+	resolved := rateLimitToken{expiresAt: now.Add(rateLimitTokenTTL)}
+	if isPartner {
+		if p, err := h.db.GetPartnerByTokenHash(hash); err == nil {
+			resolved.key, resolved.tier, resolved.ok = fmt.Sprintf("partner:%d", p.ID), p.Tier, true
+		} else if err != sql.ErrNoRows {
+			return "", "", false // don't cache store errors
+		}
+	} else {
+		if t, err := h.db.GetAPITokenByHash(hash); err == nil {
+			resolved.key, resolved.tier, resolved.ok = fmt.Sprintf("api_token:%d", t.ID), h.config().RateLimit.TokenTier, true
+		} else if err != sql.ErrNoRows {
+			return "", "", false
+		}
+	}
+	h.rateLimitTokens.put(hash, resolved)
+
+	return resolved.key, resolved.tier, resolved.ok
+}
+
+// ApplyForPartnerToken records the application of a bot or integration for a partner
+// token, which an admin approves with a rate limit tier
+func (h *Handler) ApplyForPartnerToken(c *gin.Context) {
+	var req model.PartnerApplicationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "name and contact are required",
+		})
+		return
+	}
+
+	p, err := h.db.CreatePartner(req.Name, req.Contact, req.UseCase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to store application",
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Partner applied for an API token", "partner_id", p.ID, "name", p.Name)
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data:    gin.H{"id": p.ID, "status": p.Status},
+		Message: "the token is sent to the contact once the application is approved",
+	})
+}
+
+// GetPartners lists partner applications and tokens, all of them unless ?status= asks
+// for one status, with the configured tiers (admin only)
+func (h *Handler) GetPartners(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", model.PartnerStatusPending, model.PartnerStatusApproved, model.PartnerStatusRevoked:
+	default:
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "unknown status",
+		})
+		return
+	}
+
+	partners, err := h.db.GetPartners(status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get partners: %v", err),
+		})
+		return
+	}
+
+	tiers := make([]string, 0, len(h.config().RateLimit.Tiers))
+	for name := range h.config().RateLimit.Tiers {
+		tiers = append(tiers, name)
+	}
+	sort.Strings(tiers)
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"partners": partners,
+			"tiers":    tiers,
+		},
+	})
+}
+
+// partnerParam loads the partner of the :id parameter, writing the error response when
+// it doesn't exist
+func (h *Handler) partnerParam(c *gin.Context) (*model.Partner, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid partner id",
+		})
+		return nil, false
+	}
+
+	p, err := h.db.GetPartner(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "partner not found",
+		})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get partner",
+		})
+		return nil, false
+	}
+	return p, true
+}
+
+// ApprovePartner approves a partner with a rate limit tier and issues its token. Approving
+// an approved partner again moves it to the tier and replaces its token (admin only).
+func (h *Handler) ApprovePartner(c *gin.Context) {
+	var req model.ApprovePartnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "tier is required",
+		})
+		return
+	}
+	if _, ok := h.config().RateLimit.Tiers[req.Tier]; !ok {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("tier %q is not configured in rate_limit.tiers", req.Tier),
+		})
+		return
+	}
+
+	p, ok := h.partnerParam(c)
+	if !ok {
+		return
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to generate token",
+		})
+		return
+	}
+	token := partnerTokenPrefix + secret
+
+	if err := h.db.ApprovePartner(p.ID, req.Tier, token[:len(partnerTokenPrefix)+6], hashAPIToken(token)); err != nil {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	// The replaced token must stop using the tier right away
+	h.rateLimitTokens.reset()
+
+	if approved, err := h.db.GetPartner(p.ID); err == nil {
+		p = approved
+	}
+	slog.InfoContext(c.Request.Context(), "Partner approved", "partner_id", p.ID, "name", p.Name, "tier", p.Tier)
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: model.ApprovePartnerResponse{
+			Partner: *p,
+			Token:   token,
+		},
+		Message: "send the token to the partner now, it won't be shown again",
+	})
+}
+
+// RevokePartner rejects a pending application or revokes a partner token, the partner's
+// requests are limited by IP again (admin only)
+func (h *Handler) RevokePartner(c *gin.Context) {
+	p, ok := h.partnerParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.RevokePartner(p.ID); err != nil {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	h.rateLimitTokens.reset()
+
+	if revoked, err := h.db.GetPartner(p.ID); err == nil {
+		p = revoked
+	}
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    p,
+	})
+}
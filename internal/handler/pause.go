@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getInvestmentPause returns the active switch blocking the given action for a product.
+// The global scope takes precedence over the product scope.
+func (h *Handler) getInvestmentPause(investType string, accrual bool) (*model.InvestmentPause, error) {
+	pauses, err := h.db.GetInvestmentPauses()
+	if err != nil {
+		return nil, err
+	}
+
+	var productPause *model.InvestmentPause
+	for i := range pauses {
+		p := &pauses[i]
+		paused := p.PauseInvestments
+		if accrual {
+			paused = p.PauseAccrual
+		}
+		if !paused {
+			continue
+		}
+		if p.Scope == model.PauseScopeGlobal {
+			return p, nil
+		}
+		if p.Scope == investType {
+			productPause = p
+		}
+	}
+
+	return productPause, nil
+}
+
+// GetInvestmentPauses lists active incident switches (admin only)
+func (h *Handler) GetInvestmentPauses(c *gin.Context) {
+	pauses, err := h.db.GetInvestmentPauses()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get pauses: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    pauses,
+	})
+}
+
+// SetInvestmentPause toggles "pause new investments" and "pause accrual" switches
+// for a product or globally (scope "global") (admin only)
+func (h *Handler) SetInvestmentPause(c *gin.Context) {
+	scope := c.Param("scope")
+	if _, ok := h.config().InvestmentTypes[scope]; !ok && scope != model.PauseScopeGlobal {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "scope must be \"global\" or an investment type",
+		})
+		return
+	}
+
+	var req model.SetInvestmentPauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if (req.PauseInvestments || req.PauseAccrual) && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "reason is required when pausing",
+		})
+		return
+	}
+
+	if err := h.db.SetInvestmentPause(scope, req.PauseInvestments, req.PauseAccrual, req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to update pause: %v", err),
+		})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Investment pause updated",
+		"scope", scope, "investments", req.PauseInvestments, "accrual", req.PauseAccrual, "reason", req.Reason)
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: model.InvestmentPause{
+			Scope:            scope,
+			PauseInvestments: req.PauseInvestments,
+			PauseAccrual:     req.PauseAccrual,
+			Reason:           req.Reason,
+		},
+	})
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/notify"
+	"tonapp/internal/payment"
+	"tonapp/internal/telegram"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreatePayment starts a balance top-up through an alternative payment rail
+func (h *Handler) CreatePayment(c *gin.Context) {
+	provider, ok := h.payments[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "payment provider not available",
+		})
+		return
+	}
+
+	var req model.CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if rejectClosedAccount(c, user) || rejectFrozenAccount(c, user) {
+		return
+	}
+	if !h.checkUserDeposit(c, user.ID, req.Amount) {
+		return
+	}
+
+	p, err := h.db.CreatePayment(user.ID, provider.Name(), req.Amount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to create payment",
+		})
+		return
+	}
+
+	checkout, err := provider.CreateInvoice(c.Request.Context(), payment.Invoice{
+		PaymentID:   p.ID,
+		UserID:      user.ID,
+		Amount:      req.Amount,
+		Description: fmt.Sprintf("Top up %s TON", money.Format(req.Amount)),
+	})
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to create invoice", "provider", provider.Name(), "amount", money.Format(req.Amount), "error", err)
+		c.JSON(http.StatusBadGateway, model.Response{
+			Success: false,
+			Error:   "failed to create invoice",
+		})
+		return
+	}
+
+	if err := h.db.SetPaymentQuote(p.ID, checkout.ProviderAmount, checkout.Currency); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to save payment",
+		})
+		return
+	}
+
+	p.ProviderAmount = checkout.ProviderAmount
+	p.Currency = checkout.Currency
+	p.CheckoutURL = checkout.URL
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data:    p,
+	})
+}
+
+// PaymentWebhook credits balances after a provider confirms a payment
+func (h *Handler) PaymentWebhook(c *gin.Context) {
+	provider, ok := h.payments[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "payment provider not available",
+		})
+		return
+	}
+
+	// The Stars webhook is the bot webhook, it also carries the bot commands
+	var update []byte
+	if provider.Name() == payment.ProviderTelegramStars && h.bot != nil {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "failed to read request body",
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		update = body
+	}
+
+	event, err := provider.HandleWebhook(c.Request.Context(), c.Request)
+	if err == payment.ErrInvalidWebhook {
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to handle payment webhook", "provider", provider.Name(), "error", err)
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to handle webhook",
+		})
+		return
+	}
+
+	if event == nil && update != nil {
+		var u telegram.Update
+		if err := json.Unmarshal(update, &u); err == nil {
+			h.handleBotUpdate(c.Request.Context(), u)
+		}
+	}
+
+	if event != nil && event.PreCheckout != nil {
+		ok, reason := h.checkPaymentCheckout(c.Request.Context(), provider.Name(), event)
+		if err := event.PreCheckout(c.Request.Context(), ok, reason); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to answer payment pre-checkout", "provider", provider.Name(), "payment_id", event.PaymentID, "error", err)
+		}
+	} else if event != nil {
+		credited, err := h.db.CompletePayment(event.PaymentID, provider.Name(), event.ExternalID, event.ProviderAmount, event.Currency)
+		if err != nil {
+			// The provider already charged the user, so this needs manual review
+			h.escalatePayment(c.Request.Context(), provider.Name(), event, err)
+		} else if credited {
+			slog.InfoContext(c.Request.Context(), "Credited payment", "provider", provider.Name(), "payment_id", event.PaymentID)
+		}
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+	})
+}
+
+// checkPaymentCheckout decides whether the provider may charge a payment: it has to be
+// pending and quoted at the amount about to be charged, for a user who can still top up.
+// A declined checkout returns the reason shown to the user.
+func (h *Handler) checkPaymentCheckout(ctx context.Context, provider string, event *payment.Event) (bool, string) {
+	p, err := h.db.GetPayment(event.PaymentID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.ErrorContext(ctx, "Failed to get payment for pre-checkout", "provider", provider, "payment_id", event.PaymentID, "error", err)
+			return false, "The payment can't be checked right now, please try again later."
+		}
+		return false, "This invoice is not valid."
+	}
+	declined := ""
+	switch {
+	case p.Provider != provider:
+		declined = "This invoice is not valid."
+	case p.Status != model.PaymentStatusPending:
+		declined = "This invoice was already paid or is no longer valid."
+	case p.Currency != event.Currency || p.ProviderAmount != event.ProviderAmount:
+		declined = "The price of this invoice changed, please create a new one."
+	}
+	if declined == "" {
+		user, err := h.db.GetUser(p.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get user for payment pre-checkout", "provider", provider, "payment_id", p.ID, "user_id", p.UserID, "error", err)
+			return false, "The payment can't be checked right now, please try again later."
+		}
+		if user.ClosedAt != nil || user.FrozenAt != nil {
+			declined = "This account can't be topped up."
+		}
+	}
+	if declined != "" {
+		slog.InfoContext(ctx, "Declined payment pre-checkout", "provider", provider, "payment_id", p.ID, "user_id", p.UserID, "status", p.Status, "reason", declined)
+		return false, declined
+	}
+	return true, ""
+}
+
+// escalatePayment puts a payment the provider charged but that couldn't be credited
+// under review and tells the operators an admin has to credit or refund it
+func (h *Handler) escalatePayment(ctx context.Context, provider string, event *payment.Event, reason error) {
+	slog.ErrorContext(ctx, "Failed to complete payment", "provider", provider, "payment_id", event.PaymentID, "external_id", event.ExternalID, "error", reason)
+	escalated, err := h.db.EscalatePayment(event.PaymentID, provider, event.ExternalID, reason.Error())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to put payment under review", "provider", provider, "payment_id", event.PaymentID, "external_id", event.ExternalID, "error", err)
+	}
+	if !escalated || len(h.notifiers) == 0 {
+		return
+	}
+
+	msg := notify.Message{
+		Title: fmt.Sprintf("Payment %d needs a review", event.PaymentID),
+		Body: fmt.Sprintf("%s charged %d %s (charge %s) for payment %d, which couldn't be credited: %v.",
+			provider, event.ProviderAmount, event.Currency, event.ExternalID, event.PaymentID, reason),
+		Fields: map[string]interface{}{
+			"status":      model.PaymentStatusReview,
+			"provider":    provider,
+			"payment_id":  event.PaymentID,
+			"external_id": event.ExternalID,
+		},
+	}
+	go func() {
+		if err := h.notifiers.Send(context.Background(), msg); err != nil {
+			slog.Error("Failed to notify payment review", "payment_id", event.PaymentID, "error", err)
+		}
+	}()
+}
+
+// GetEscalatedPayments lists the payments charged by their provider that couldn't be
+// credited, oldest first (admin only)
+func (h *Handler) GetEscalatedPayments(c *gin.Context) {
+	payments, err := h.db.GetEscalatedPayments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get payment reviews",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"payments": payments,
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateProfile updates the user's name, photo and display preferences
+// (fiat currency, number format, language)
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	var req model.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if req.FiatCurrency != nil {
+		currency := strings.ToLower(*req.FiatCurrency)
+		if !model.SupportedFiatCurrencies[currency] {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "unsupported fiat currency",
+			})
+			return
+		}
+		req.FiatCurrency = &currency
+	}
+
+	if req.NumberFormat != nil && !model.SupportedNumberFormats[*req.NumberFormat] {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "unsupported number format",
+		})
+		return
+	}
+
+	if req.Language != nil && !model.SupportedLanguages[*req.Language] {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "unsupported language",
+		})
+		return
+	}
+
+	if err := h.db.UpdateUserProfile(user.ID, req); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to update profile",
+		})
+		return
+	}
+
+	updated, err := h.db.GetUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    updated,
+	})
+}
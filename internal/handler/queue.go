@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldQueueWithdrawal decides whether a withdrawal has to wait in the liquidity queue:
+// either earlier withdrawals are still waiting, or the wallet it is sent from can't
+// cover the amount
+func (h *Handler) shouldQueueWithdrawal(ctx context.Context, wallet string, amount float64) bool {
+	if !h.config().Liquidity.QueueEnabled {
+		return false
+	}
+
+	queued, err := h.db.CountQueuedWithdrawals()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count queued withdrawals", "error", err)
+		return false
+	}
+	if queued > 0 {
+		return true
+	}
+
+	balance, err := h.ton.GetWalletBalance(ctx, h.ton.TreasuryAddress(wallet))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get wallet balance", "wallet", wallet, "error", err)
+		return false
+	}
+
+	return balance-h.config().Liquidity.MinHotWalletReserve < amount
+}
+
+// StartLiquidityQueue processes queued withdrawals as hot wallet funds arrive
+func (h *Handler) StartLiquidityQueue(ctx context.Context) {
+	if !h.config().Liquidity.QueueEnabled {
+		return
+	}
+
+	interval := time.Duration(h.config().Liquidity.CheckIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Withdrawals already being sent finish on shutdown
+			if n, err := h.ProcessLiquidityQueue(context.WithoutCancel(ctx)); err != nil {
+				slog.Error("Failed to process withdrawal queue", "error", err)
+			} else if n > 0 {
+				slog.Info("Sent queued withdrawals", "count", n)
+			}
+		}
+	}
+}
+
+// ProcessLiquidityQueue sends queued withdrawals strictly in order while the hot wallet
+// balance covers them, skipping those waiting to retry a failed transfer and those of
+// frozen accounts, which wait without holding up the others. Returns the number of sent
+// withdrawals.
+func (h *Handler) ProcessLiquidityQueue(ctx context.Context) (int, error) {
+	entries, err := h.db.GetNextQueuedWithdrawals(20)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	// Balances of the wallets entries are sent from, fetched as needed
+	available := make(map[string]float64)
+
+	sent := 0
+	for _, w := range entries {
+		w.TreasuryWallet = h.withdrawalWallet(w.UserID, w.Amount)
+		if _, ok := available[w.TreasuryWallet]; !ok {
+			balance, err := h.ton.GetWalletBalance(ctx, h.ton.TreasuryAddress(w.TreasuryWallet))
+			if err != nil {
+				return sent, err
+			}
+			available[w.TreasuryWallet] = balance - h.config().Liquidity.MinHotWalletReserve
+		}
+		if w.Amount > available[w.TreasuryWallet] {
+			// Keep the order: later entries wait until this one is covered
+			break
+		}
+
+		if err := h.db.StartQueuedWithdrawalAttempt(w.ID, model.QueueStatusQueued, w.TreasuryWallet); err != nil {
+			return sent, err
+		}
+		h.publishQueuedWithdrawal(w, model.QueueStatusSending, "")
+
+		txHash, err := h.sendWithdrawal(ctx, w.TreasuryWallet, w.PubKey, w.Destination, w.Amount)
+		if err != nil {
+			if errors.Is(err, ton.ErrInsufficientWalletBalance) {
+				if err := h.db.SetQueuedWithdrawalStatus(w.ID, model.QueueStatusSending, model.QueueStatusQueued); err != nil {
+					return sent, err
+				}
+				h.publishQueuedWithdrawal(w, model.QueueStatusQueued, "")
+				break
+			}
+
+			// The entry keeps its place but doesn't hold up the others while it waits
+			h.retryWithdrawal(ctx, w, model.QueueStatusQueued, err)
+			continue
+		}
+
+		if err := h.db.CompleteQueuedWithdrawal(w, txHash); err != nil {
+			slog.ErrorContext(ctx, "Failed to complete queued withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "tx_hash", txHash, "error", err)
+		}
+		h.notifyWithdrawalSent(w.UserID, w.Amount, txHash)
+		h.publishQueuedWithdrawal(w, model.QueueStatusSent, txHash)
+
+		available[w.TreasuryWallet] -= w.Amount
+		sent++
+	}
+
+	return sent, nil
+}
+
+// GetWithdrawalQueue returns the user's queued withdrawals with their position in the queue,
+// and those held for admin approval
+func (h *Handler) GetWithdrawalQueue(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	entries, err := h.db.GetUserQueuedWithdrawals(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal queue",
+		})
+		return
+	}
+
+	total, err := h.db.CountQueuedWithdrawals()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal queue",
+		})
+		return
+	}
+
+	held, err := h.db.GetUserHeldWithdrawals(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal queue",
+		})
+		return
+	}
+	for i := range held {
+		held[i].PubKey = ""
+	}
+	if h.config().WithdrawalBatching.Enabled {
+		next := h.nextBatchAt(time.Now()).Unix()
+		for i := range entries {
+			if entries[i].Status == model.QueueStatusBatched {
+				entries[i].ScheduledAt = next
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"queue_length": total,
+			"withdrawals":  entries,
+			"approvals":    held,
+		},
+	})
+}
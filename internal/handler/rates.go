@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// supportedFiatCurrencies returns the supported fiat currencies in a stable order
+func supportedFiatCurrencies() []string {
+	currencies := make([]string, 0, len(model.SupportedFiatCurrencies))
+	for currency := range model.SupportedFiatCurrencies {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// StartRateRefresher keeps the TON price in every supported fiat currency cached,
+// refreshing it before it expires so conversions never wait for a price API
+func (h *Handler) StartRateRefresher(ctx context.Context) {
+	h.rates.Run(ctx, supportedFiatCurrencies())
+}
+
+// GetRates returns the TON price in the fiat currencies of ?currencies=usd,eur, all
+// supported ones by default. Prices come from the cache, stale ones are flagged.
+func (h *Handler) GetRates(c *gin.Context) {
+	currencies := supportedFiatCurrencies()
+	if param := c.Query("currencies"); param != "" {
+		currencies = nil
+		for _, currency := range strings.Split(strings.ToLower(param), ",") {
+			currency = strings.TrimSpace(currency)
+			if !model.SupportedFiatCurrencies[currency] {
+				c.JSON(http.StatusBadRequest, model.Response{
+					Success: false,
+					Error:   "unsupported currency: " + currency,
+				})
+				return
+			}
+			currencies = append(currencies, currency)
+		}
+	}
+
+	rates, errs := h.rates.Rates(c.Request.Context(), currencies)
+	result := model.TONRates{
+		Base:       "ton",
+		Rates:      rates,
+		TTLSeconds: int(h.rates.TTL().Seconds()),
+	}
+	if len(errs) > 0 {
+		result.Errors = make(map[string]string, len(errs))
+		for currency, err := range errs {
+			result.Errors[currency] = err.Error()
+		}
+	}
+
+	if len(rates) == 0 {
+		c.JSON(http.StatusServiceUnavailable, model.Response{
+			Success: false,
+			Error:   "TON rates unavailable",
+			Data:    result,
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    result,
+	})
+}
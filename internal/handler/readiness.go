@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readiness is the state of the start-up warm-up reported by /readyz
+type readiness struct {
+	mu        sync.Mutex
+	ready     bool
+	startedAt int64
+	readyAt   *int64
+	checks    []model.ReadinessCheck
+}
+
+// warmUpStep loads something the first requests would otherwise wait for
+type warmUpStep struct {
+	name     string
+	required bool
+	run      func(ctx context.Context) error
+}
+
+// warmUpSteps lists the warm-up steps in the order they run
+func (h *Handler) warmUpSteps() []warmUpStep {
+	return []warmUpStep{
+		{name: "config", required: true, run: h.warmUpConfig},
+		{name: "wallets", required: true, run: h.warmUpWallets},
+		{name: "deposit_address", required: true, run: h.warmUpDepositAddress},
+		{name: "liteserver", required: true, run: h.ton.CheckConnectivity},
+		{name: "fiat_rates", run: h.warmUpFiatRates},
+		{name: "treasury_balances", run: h.warmUpTreasuryBalances},
+	}
+}
+
+// StartWarmUp runs the warm-up steps until every required one passed, then reports the
+// service ready. Failed steps are retried every retry_interval_seconds; optional steps
+// get the same retries until the service is ready and fill their caches lazily afterwards.
+func (h *Handler) StartWarmUp(ctx context.Context) {
+	steps := h.warmUpSteps()
+
+	h.readiness.mu.Lock()
+	h.readiness.startedAt = time.Now().Unix()
+	h.readiness.checks = make([]model.ReadinessCheck, len(steps))
+	for i, step := range steps {
+		h.readiness.checks[i] = model.ReadinessCheck{Name: step.name, Required: step.required}
+	}
+	h.readiness.mu.Unlock()
+
+	retryInterval := time.Duration(h.config().Readiness.RetryIntervalSeconds) * time.Second
+	if retryInterval <= 0 {
+		retryInterval = 5 * time.Second
+	}
+	stepTimeout := time.Duration(h.config().Readiness.StepTimeoutSeconds) * time.Second
+	if stepTimeout <= 0 {
+		stepTimeout = 30 * time.Second
+	}
+
+	started := time.Now()
+	for {
+		ready := true
+		for i, step := range steps {
+			h.readiness.mu.Lock()
+			done := h.readiness.checks[i].OK
+			h.readiness.mu.Unlock()
+			if done {
+				continue
+			}
+
+			stepCtx, cancel := context.WithTimeout(ctx, stepTimeout)
+			begin := time.Now()
+			err := step.run(stepCtx)
+			cancel()
+
+			h.readiness.mu.Lock()
+			check := &h.readiness.checks[i]
+			check.Attempts++
+			check.DurationMs = time.Since(begin).Milliseconds()
+			check.CheckedAt = time.Now().Unix()
+			check.OK = err == nil
+			check.Error = ""
+			if err != nil {
+				check.Error = err.Error()
+			}
+			h.readiness.mu.Unlock()
+
+			if err != nil {
+				slog.Warn("Warm-up step failed", "step", step.name, "required", step.required, "error", err)
+				if step.required {
+					ready = false
+				}
+			}
+		}
+
+		if ready {
+			readyAt := time.Now().Unix()
+			h.readiness.mu.Lock()
+			h.readiness.ready = true
+			h.readiness.readyAt = &readyAt
+			h.readiness.mu.Unlock()
+			slog.Info("Warm-up finished, ready to serve", "duration", time.Since(started).Round(time.Millisecond))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+// warmUpConfig builds the public config, opening the database on the way
+func (h *Handler) warmUpConfig(ctx context.Context) error {
+	if _, err := h.db.GetInvestmentPauses(); err != nil {
+		return fmt.Errorf("failed to get investment pauses: %v", err)
+	}
+	h.GetConfigPublic()
+	return nil
+}
+
+// warmUpDepositAddress derives the main and treasury wallet addresses from their keys
+func (h *Handler) warmUpDepositAddress(ctx context.Context) error {
+	if h.ton.GetDepositAddress() == "" {
+		return fmt.Errorf("failed to derive the deposit address, check ton.mnemonic")
+	}
+	for _, name := range h.ton.TreasuryWalletNames() {
+		if h.ton.TreasuryAddress(name) == "" {
+			return fmt.Errorf("failed to derive the address of treasury wallet %s", name)
+		}
+	}
+	return nil
+}
+
+// warmUpFiatRates caches the TON price in every supported fiat currency
+func (h *Handler) warmUpFiatRates(ctx context.Context) error {
+	return h.rates.Refresh(ctx, supportedFiatCurrencies())
+}
+
+// warmUpTreasuryBalances caches the balance of the main and treasury wallets
+func (h *Handler) warmUpTreasuryBalances(ctx context.Context) error {
+	wallets := append([]string{""}, h.ton.TreasuryWalletNames()...)
+	for _, wallet := range wallets {
+		if _, err := h.ton.GetWalletBalance(ctx, h.ton.TreasuryAddress(wallet)); err != nil {
+			return fmt.Errorf("failed to get balance of %s wallet: %v", treasuryWalletLabel(wallet), err)
+		}
+	}
+	return nil
+}
+
+// Readyz reports whether the warm-up finished, 503 until then so load balancers hold
+// traffic back while caches and the liteserver connection are being set up
+func (h *Handler) Readyz(c *gin.Context) {
+	h.readiness.mu.Lock()
+	status := model.ReadinessStatus{
+		Status:    model.ReadinessStatusWarmingUp,
+		StartedAt: h.readiness.startedAt,
+		ReadyAt:   h.readiness.readyAt,
+		Checks:    append(make([]model.ReadinessCheck, 0, len(h.readiness.checks)), h.readiness.checks...),
+		ReadOnly:  h.readOnly.get().Enabled,
+	}
+	ready := h.readiness.ready
+	h.readiness.mu.Unlock()
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, status)
+		return
+	}
+	status.Status = model.ReadinessStatusReady
+	c.JSON(http.StatusOK, status)
+}
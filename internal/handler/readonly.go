@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultReadOnlyProbeInterval is used when read_only.probe_interval_seconds isn't set
+	defaultReadOnlyProbeInterval = 30 * time.Second
+
+	// readOnlyRoute switches the mode and stays writable while it is on
+	readOnlyRoute = "/api/v1/admin/read-only"
+)
+
+// readOnlyMode is the state of the read-only mode. probing is set while a test write
+// runs, so failing requests don't pile up probes.
+type readOnlyMode struct {
+	mu      sync.Mutex
+	status  model.ReadOnlyStatus
+	probing bool
+}
+
+func (m *readOnlyMode) get() model.ReadOnlyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// mutation reports whether a request method changes data
+func mutation(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// ReadOnly rejects mutations with 503 while the database can't be written, reads keep
+// working. A mutation failing with a server error probes the database, so the mode
+// starts with the first failed write rather than at the next periodic probe.
+func (h *Handler) ReadOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !mutation(c.Request.Method) || c.FullPath() == readOnlyRoute {
+			c.Next()
+			return
+		}
+
+		if status := h.readOnly.get(); status.Enabled {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("the service is read-only, balances and history can still be viewed: %s", status.Reason),
+				Code:    model.ErrorReadOnly,
+			})
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			go h.probeWritable(context.Background())
+		}
+	}
+}
+
+// probeWritable tests a write to the database, switching to read-only mode when it
+// fails and back when it succeeds again, unless an admin switched the mode on
+func (h *Handler) probeWritable(ctx context.Context) {
+	h.readOnly.mu.Lock()
+	if h.readOnly.probing {
+		h.readOnly.mu.Unlock()
+		return
+	}
+	h.readOnly.probing = true
+	h.readOnly.mu.Unlock()
+
+	err := h.db.CheckWritable()
+
+	h.readOnly.mu.Lock()
+	defer h.readOnly.mu.Unlock()
+	h.readOnly.probing = false
+	status := &h.readOnly.status
+	status.LastProbeAt = time.Now().Unix()
+	status.LastProbeError = ""
+	if err != nil {
+		status.LastProbeError = err.Error()
+	}
+
+	switch {
+	case err != nil && !status.Enabled:
+		h.enterReadOnly(ctx, err.Error(), false)
+	case err == nil && status.Enabled && !status.Manual:
+		h.leaveReadOnly(ctx, "database writes work again")
+	}
+}
+
+// enterReadOnly switches the mode on and alerts the operators, h.readOnly.mu must be held
+func (h *Handler) enterReadOnly(ctx context.Context, reason string, manual bool) {
+	since := time.Now().Unix()
+	status := &h.readOnly.status
+	status.Enabled, status.Manual, status.Reason, status.Since = true, manual, reason, &since
+
+	slog.ErrorContext(ctx, "Switched to read-only mode, mutations are rejected", "reason", reason, "manual", manual)
+	h.notifyReadOnly(notify.Message{
+		Title: "API switched to read-only mode",
+		Body:  fmt.Sprintf("Deposits, withdrawals, investments and every other change are rejected with 503 until the mode ends: %s.", reason),
+		Fields: map[string]interface{}{
+			"status": "read_only",
+			"reason": reason,
+			"manual": manual,
+		},
+	})
+}
+
+// leaveReadOnly switches the mode off and tells the operators, h.readOnly.mu must be held
+func (h *Handler) leaveReadOnly(ctx context.Context, reason string) {
+	status := &h.readOnly.status
+	var duration time.Duration
+	if status.Since != nil {
+		duration = time.Since(time.Unix(*status.Since, 0)).Round(time.Second)
+	}
+	*status = model.ReadOnlyStatus{LastProbeAt: status.LastProbeAt, LastProbeError: status.LastProbeError}
+
+	slog.InfoContext(ctx, "Left read-only mode", "reason", reason, "duration", duration)
+	h.notifyReadOnly(notify.Message{
+		Title: "API writable again",
+		Body:  fmt.Sprintf("Read-only mode ended after %s: %s.", duration, reason),
+		Fields: map[string]interface{}{
+			"status": "writable",
+			"reason": reason,
+		},
+	})
+}
+
+func (h *Handler) notifyReadOnly(msg notify.Message) {
+	if len(h.notifiers) == 0 {
+		return
+	}
+	go func() {
+		if err := h.notifiers.Send(context.Background(), msg); err != nil {
+			slog.Error("Failed to notify read-only mode", "title", msg.Title, "error", err)
+		}
+	}()
+}
+
+// StartReadOnlyProbe tests a database write every read_only.probe_interval_seconds, see
+// probeWritable
+func (h *Handler) StartReadOnlyProbe(ctx context.Context) {
+	interval := time.Duration(h.config().ReadOnly.ProbeIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultReadOnlyProbeInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.probeWritable(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetReadOnly returns the state of the read-only mode (admin only)
+func (h *Handler) GetReadOnly(c *gin.Context) {
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    h.readOnly.get(),
+	})
+}
+
+// SetReadOnly switches the read-only mode on, e.g. for maintenance, or off once the
+// database was fixed. Switching it off tests a write first (admin only).
+func (h *Handler) SetReadOnly(c *gin.Context) {
+	var req model.SetReadOnlyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	var err error
+	if !*req.Enabled {
+		err = h.db.CheckWritable()
+	}
+
+	h.readOnly.mu.Lock()
+	status := &h.readOnly.status
+	switch {
+	case *req.Enabled:
+		reason := req.Reason
+		if reason == "" {
+			reason = "switched on by an admin"
+		}
+		if status.Enabled {
+			status.Manual, status.Reason = true, reason
+		} else {
+			h.enterReadOnly(c.Request.Context(), reason, true)
+		}
+	case err != nil:
+		h.readOnly.mu.Unlock()
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("the database still can't be written: %v", err),
+		})
+		return
+	case status.Enabled:
+		reason := req.Reason
+		if reason == "" {
+			reason = "switched off by an admin"
+		}
+		h.leaveReadOnly(c.Request.Context(), reason)
+	}
+	current := *status
+	h.readOnly.mu.Unlock()
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    current,
+	})
+}
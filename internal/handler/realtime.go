@@ -0,0 +1,246 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"tonapp/internal/events"
+	"tonapp/internal/jwt"
+	"tonapp/internal/model"
+	"tonapp/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// eventFeedInterval is how often new operations are pushed to connected users
+	eventFeedInterval = time.Second
+	// eventFeedBatch bounds the operations read per run, the rest follow on the next one
+	eventFeedBatch = 500
+
+	// wsAuthTimeout is how long a connection without an Authorization header has to send
+	// its auth message
+	wsAuthTimeout = 10 * time.Second
+	// wsPingInterval is how often idle connections are pinged
+	wsPingInterval = 30 * time.Second
+	// wsReadTimeout closes connections that didn't answer two pings
+	wsReadTimeout = 2*wsPingInterval + 15*time.Second
+	// wsWriteTimeout bounds every write, so a client that stopped reading is dropped
+	wsWriteTimeout = 10 * time.Second
+)
+
+// StartEventFeed pushes the operations recorded by any part of the app, and the balance
+// they changed, to the users with an open WebSocket. Operations are tailed from the
+// store, so none is missed whether a handler, a job or an admin route recorded it.
+func (h *Handler) StartEventFeed(ctx context.Context) {
+	ticker := time.NewTicker(eventFeedInterval)
+	defer ticker.Stop()
+
+	lastID := int64(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		next, err := h.publishOperations(lastID)
+		if err != nil {
+			slog.Error("Failed to publish new operations", "error", err)
+			continue
+		}
+		lastID = next
+	}
+}
+
+// publishOperations publishes the operations after afterID and returns the last one
+// read. Without subscribers the feed skips to the latest operation, so connecting doesn't
+// replay what happened before.
+func (h *Handler) publishOperations(afterID int64) (int64, error) {
+	if afterID < 0 || h.events.Subscribers() == 0 {
+		return h.db.GetLastOperationID()
+	}
+
+	operations, err := h.db.GetOperationsAfter(afterID, eventFeedBatch)
+	if err != nil {
+		return afterID, err
+	}
+	changed := make(map[int]bool)
+	for _, op := range operations {
+		afterID = op.ID
+		if !h.events.HasSubscribers(op.UserID) {
+			continue
+		}
+		h.events.Publish(events.Event{Type: events.TypeOperation, UserID: op.UserID, Data: op})
+		changed[op.UserID] = true
+	}
+	for userID := range changed {
+		h.publishBalance(userID)
+	}
+	return afterID, nil
+}
+
+// publishBalance publishes the current balance of a user
+func (h *Handler) publishBalance(userID int) {
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		slog.Error("Failed to get user for balance event", "user_id", userID, "error", err)
+		return
+	}
+	h.events.Publish(events.Event{Type: events.TypeBalance, UserID: userID, Data: balanceEvent(user)})
+}
+
+func balanceEvent(user *model.User) model.BalanceEvent {
+	return model.BalanceEvent{
+		Balance:            user.Balance,
+		CurrentInvestments: user.CurrentInvestments,
+		TotalEarnings:      user.TotalEarnings,
+	}
+}
+
+// publishWithdrawal publishes a status transition of a withdrawal of a user
+func (h *Handler) publishWithdrawal(userID int, e model.WithdrawalEvent) {
+	h.events.Publish(events.Event{Type: events.TypeWithdrawal, UserID: userID, Data: e})
+}
+
+// publishQueuedWithdrawal publishes a transition of a withdrawal of the liquidity queue
+// or of a batch
+func (h *Handler) publishQueuedWithdrawal(w model.QueuedWithdrawal, status, txHash string) {
+	h.publishWithdrawal(w.UserID, model.WithdrawalEvent{ID: w.ID, Source: "queue", Status: status, Amount: w.Amount, TxHash: txHash})
+}
+
+// publishHeldWithdrawal publishes a transition of a withdrawal held for approval
+func (h *Handler) publishHeldWithdrawal(w model.HeldWithdrawal, status, txHash string) {
+	h.publishWithdrawal(w.UserID, model.WithdrawalEvent{ID: w.ID, Source: "approval", Status: status, Amount: w.Amount, TxHash: txHash})
+}
+
+// ServeWebSocket upgrades to a WebSocket pushing the events of the session's user: the
+// current balance first, then balance changes, new operations and withdrawal status
+// transitions. Browsers can't set headers on WebSockets, so the session token is taken
+// from "Authorization: Bearer <token>" or else from a first {"type":"auth","token":...}
+// message. A connection that falls too far behind is closed with 1013 and should
+// reconnect and reload what it shows.
+func (h *Handler) ServeWebSocket(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	conn, err := websocket.Upgrade(c.Writer, c.Request)
+	if errors.Is(err, websocket.ErrNotWebSocket) {
+		c.Header("Upgrade", "websocket")
+		c.JSON(http.StatusUpgradeRequired, model.Response{
+			Success: false,
+			Error:   "websocket handshake required",
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to upgrade to websocket", "error", err)
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	conn.SetReadTimeout(wsAuthTimeout)
+	if token == "" {
+		var auth model.WebSocketAuth
+		message, err := conn.ReadMessage()
+		if err != nil {
+			conn.Close(websocket.ClosePolicyViolation, "auth message expected")
+			return
+		}
+		if json.Unmarshal(message, &auth) != nil || auth.Type != "auth" {
+			closeWebSocket(conn, model.ErrorSessionMissing, "missing session token")
+			return
+		}
+		token = auth.Token
+	}
+
+	claims, err := jwt.Parse(token, []byte(h.config().Auth.JWTSecret), time.Now())
+	if err == jwt.ErrExpired {
+		closeWebSocket(conn, model.ErrorSessionExpired, "session expired")
+		return
+	}
+	if err != nil || claims.Issuer != sessionIssuer {
+		closeWebSocket(conn, model.ErrorSessionInvalid, "invalid session token")
+		return
+	}
+	user, err := h.db.GetUserByPubKey(claims.Subject)
+	if err != nil {
+		closeWebSocket(conn, model.ErrorUserNotFound, "user not found")
+		return
+	}
+
+	// Subscribe before reading the balance, so no change falls in between
+	sub := h.events.Subscribe(user.ID)
+	defer sub.Close()
+	if user, err = h.db.GetUser(user.ID); err != nil {
+		conn.Close(websocket.CloseTryAgainLater, "failed to get user")
+		return
+	}
+	if !writeWebSocketEvent(conn, events.Event{Type: events.TypeBalance, Data: balanceEvent(user)}) {
+		return
+	}
+
+	// Clients only send pongs and the close frame, reading also answers their pings
+	conn.SetReadTimeout(wsReadTimeout)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				conn.Close(websocket.CloseTryAgainLater, "too many events, reconnect")
+				return
+			}
+			if !writeWebSocketEvent(conn, e) {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.Ping(); err != nil {
+				conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// writeWebSocketEvent sends an event and closes the connection if that fails
+func writeWebSocketEvent(conn *websocket.Conn, e events.Event) bool {
+	data, err := json.Marshal(e)
+	if err == nil {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		err = conn.WriteText(data)
+	}
+	if err != nil {
+		conn.Close(websocket.CloseGoingAway, "")
+		return false
+	}
+	return true
+}
+
+// closeWebSocket sends an error message like the JSON responses of the API and closes
+// the connection as a policy violation
+func closeWebSocket(conn *websocket.Conn, code model.ErrorCode, message string) {
+	data, _ := json.Marshal(events.Event{
+		Type: "error",
+		Data: model.Response{Success: false, Error: message, Code: code},
+	})
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	conn.WriteText(data)
+	conn.Close(websocket.ClosePolicyViolation, string(code))
+}
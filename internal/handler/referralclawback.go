@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClawBackReferralEarnings reverses the referral earnings paid on a user's profit, e.g.
+// after their deposit was reversed or flagged as fraud. With deposit_id only earnings
+// recorded since that deposit was created are reversed (admin only).
+func (h *Handler) ClawBackReferralEarnings(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+	var req model.ReferralClawbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if _, err := h.db.GetUser(userID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user",
+		})
+		return
+	}
+
+	var since int64
+	if req.DepositID != 0 {
+		deposit, err := h.db.GetDepositRequest(req.DepositID)
+		if err == sql.ErrNoRows || (err == nil && deposit.UserID != userID) {
+			c.JSON(http.StatusNotFound, model.Response{
+				Success: false,
+				Error:   "deposit request not found",
+				Code:    model.ErrorDepositNotFound,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to get deposit request",
+			})
+			return
+		}
+		since = deposit.CreatedAt
+	}
+
+	clawback, err := h.db.ClawBackReferralEarnings(userID, since, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to claw back referral earnings: %v", err),
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Clawed back referral earnings", "referred_id", userID, "reason", req.Reason,
+		"entries", len(clawback.Entries), "recovered", money.Format(clawback.Recovered), "unrecovered", money.Format(clawback.Unrecovered))
+
+	recovered := make(map[int]float64)
+	for _, e := range clawback.Entries {
+		recovered[e.ReferrerID] -= e.Amount
+	}
+	for referrerID, amount := range recovered {
+		if amount <= 0 {
+			continue
+		}
+		h.notifyUser(referrerID, "referral_clawback", func(l locale) (string, string) {
+			return l.text("referral_clawback.title"), l.text("referral_clawback.body", l.amount(money.Round(amount)))
+		})
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    clawback,
+	})
+}
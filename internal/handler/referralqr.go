@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"tonapp/internal/model"
+	"tonapp/internal/qrcode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// referralStartPrefix marks a Telegram start parameter as a referral: ref_<user id>
+const referralStartPrefix = "ref_"
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+
+	// maxCachedQRCodes bounds the rendered images kept in memory
+	maxCachedQRCodes = 1000
+)
+
+// referralQRCacheControl lets clients keep the image, it only changes with the web app URL
+const referralQRCacheControl = "public, max-age=86400"
+
+// qrCache keeps rendered QR images by link, format and size
+type qrCache struct {
+	mu     sync.Mutex
+	images map[string][]byte
+}
+
+func (q *qrCache) get(key string) ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	img, ok := q.images[key]
+	return img, ok
+}
+
+func (q *qrCache) put(key string, img []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.images == nil || len(q.images) >= maxCachedQRCodes {
+		q.images = make(map[string][]byte)
+	}
+	q.images[key] = img
+}
+
+// referralLink builds the Telegram deep link inviting users as referrals of userID
+func (h *Handler) referralLink(userID int) string {
+	return h.startAppLink(referralStartPrefix + strconv.Itoa(userID))
+}
+
+// GetReferralQR returns a QR code of the user's referral deep link as PNG or SVG
+func (h *Handler) GetReferralQR(c *gin.Context) {
+	format, size, ok := qrImageOptions(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	link := h.referralLink(user.ID)
+	if link == "" {
+		c.JSON(http.StatusServiceUnavailable, model.Response{
+			Success: false,
+			Error:   "referral links are not configured",
+		})
+		return
+	}
+	h.serveQR(c, link, format, size, referralQRCacheControl)
+}
+
+// qrImageOptions reads the format and size query parameters of a QR image, responding
+// with 400 if they are invalid
+func qrImageOptions(c *gin.Context) (format string, size int, ok bool) {
+	format = c.DefaultQuery("format", "png")
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "format must be png or svg",
+		})
+		return "", 0, false
+	}
+
+	size = defaultQRSize
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		s, err := strconv.Atoi(sizeStr)
+		if err != nil || s < minQRSize || s > maxQRSize {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("size must be between %d and %d", minQRSize, maxQRSize),
+			})
+			return "", 0, false
+		}
+		size = s
+	}
+	return format, size, true
+}
+
+// serveQR responds with a QR code of link, rendered once per link, format and size
+func (h *Handler) serveQR(c *gin.Context, link, format string, size int, cacheControl string) {
+	key := fmt.Sprintf("%s|%d|%s", format, size, link)
+	sum := sha256.Sum256([]byte(key))
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:8]))
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", cacheControl)
+	if notModified(c.Request, etag, h.configLoadedAt()) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	img, ok := h.qrCodes.get(key)
+	if !ok {
+		code, err := qrcode.Encode(link)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to encode link",
+			})
+			return
+		}
+		if format == "svg" {
+			img = code.SVG(size)
+		} else if img, err = code.PNG(size); err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to render QR code",
+			})
+			return
+		}
+		h.qrCodes.put(key, img)
+	}
+
+	contentType := "image/png"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+	}
+	c.Data(http.StatusOK, contentType, img)
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecomputeReferralEarnings recalculates the referral earnings of the profit accrued in a
+// period from the profit operations and reports the difference to what was paid. With
+// apply, underpaid earnings are paid as compensations; overpaid ones are only reported
+// (admin only).
+func (h *Handler) RecomputeReferralEarnings(c *gin.Context) {
+	var req model.ReferralRecomputeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	if req.From >= req.To || req.To > time.Now().Unix() {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "from must be before to, and to not in the future",
+		})
+		return
+	}
+	referral := h.config().ReferralConfig
+	if req.ReferralConfig != nil {
+		var report configReport
+		validateReferrals(&report, *req.ReferralConfig, platformFeePercent(h.config().Accrual))
+		for _, issue := range report.Issues {
+			if issue.Fatal {
+				c.JSON(http.StatusBadRequest, model.Response{
+					Success: false,
+					Error:   fmt.Sprintf("%s: %s", issue.Field, issue.Message),
+				})
+				return
+			}
+		}
+		referral = *req.ReferralConfig
+	}
+
+	// Runs are serialized, so two of them can't compensate the same period twice
+	h.referralRecompute.Lock()
+	defer h.referralRecompute.Unlock()
+
+	report, err := h.recomputeReferralEarnings(req.From, req.To, referral)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to recompute referral earnings: %v", err),
+		})
+		return
+	}
+
+	if req.Apply && report.Underpaid > 0 {
+		if len(report.ConflictingRuns) > 0 {
+			c.JSON(http.StatusConflict, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("period overlaps recomputation run %d", report.ConflictingRuns[0].ID),
+				Data:    report,
+			})
+			return
+		}
+		for i := range report.Diffs {
+			if report.Diffs[i].Difference > 0 {
+				report.Diffs[i].Compensated = report.Diffs[i].Difference
+			}
+		}
+		if err := h.db.ApplyReferralCorrections(report); err != nil {
+			status := http.StatusInternalServerError
+			if strings.Contains(err.Error(), "overlaps recomputation run") {
+				status = http.StatusConflict
+			}
+			c.JSON(status, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("failed to apply corrections: %v", err),
+			})
+			return
+		}
+		slog.InfoContext(c.Request.Context(), "Referral recomputation paid compensations",
+			"run_id", report.ID, "amount", money.Format(report.Compensated), "from", report.From, "to", report.To)
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// recomputeReferralEarnings builds the diff report of the period [from, to). Expected
+// earnings follow the current referrer chains, like ProcessReferralEarnings, and stop
+// at the closure of a referrer's account.
+func (h *Handler) recomputeReferralEarnings(from, to int64, referral model.ReferralConfig) (*model.ReferralRecomputation, error) {
+	runs, err := h.db.GetReferralRecomputations(from, to)
+	if err != nil {
+		return nil, err
+	}
+	accruals, err := h.db.GetProfitAccrualsSince(from)
+	if err != nil {
+		return nil, err
+	}
+	earnings, err := h.db.GetReferralEarningsForPeriod(from, to)
+	if err != nil {
+		return nil, err
+	}
+	referrers, err := h.db.GetReferrerMap()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ReferralRecomputation{
+		From:            from,
+		To:              to,
+		ReferralConfig:  referral,
+		IncludedRuns:    make([]int64, 0),
+		ConflictingRuns: make([]model.ReferralRecomputationRun, 0),
+		Diffs:           make([]model.ReferralEarningDiff, 0),
+		CreatedAt:       time.Now().Unix(),
+	}
+	for _, r := range runs {
+		if r.From >= from && r.To <= to {
+			report.IncludedRuns = append(report.IncludedRuns, r.ID)
+		} else {
+			report.ConflictingRuns = append(report.ConflictingRuns, r)
+		}
+	}
+
+	type pair struct {
+		referrerID, referredID, level int
+	}
+	diffs := make(map[pair]*model.ReferralEarningDiff)
+	diffOf := func(p pair) *model.ReferralEarningDiff {
+		d, ok := diffs[p]
+		if !ok {
+			d = &model.ReferralEarningDiff{ReferrerID: p.referrerID, ReferredID: p.referredID, Level: p.level}
+			diffs[p] = d
+		}
+		return d
+	}
+
+	for _, a := range accruals {
+		if a.CreatedAt >= to {
+			continue
+		}
+		report.Accruals++
+		userID := a.UserID
+		for level := 1; level <= 3; level++ {
+			referrer, ok := referrers[userID]
+			if !ok {
+				break
+			}
+			userID = referrer.ID
+			// Referrers stopped earning when their account was closed
+			if referrer.ClosedAt != nil && a.CreatedAt >= *referrer.ClosedAt {
+				continue
+			}
+			d := diffOf(pair{referrer.ID, a.UserID, level})
+			d.Accruals++
+			d.Expected += a.NetProfit * (referralPercent(referral, level) / 100.0)
+		}
+	}
+	for _, e := range earnings {
+		diffOf(pair{e.ReferrerID, e.ReferredID, e.Level}).Actual += e.Amount
+	}
+
+	for _, d := range diffs {
+		report.Expected += d.Expected
+		report.Actual += d.Actual
+		d.Expected = money.Round(d.Expected)
+		d.Actual = money.Round(d.Actual)
+		d.Difference = money.Round(d.Expected - d.Actual)
+		switch {
+		case d.Difference > 0:
+			report.Underpaid += d.Difference
+		case d.Difference < 0:
+			report.Overpaid -= d.Difference
+		default:
+			continue
+		}
+		report.Diffs = append(report.Diffs, *d)
+	}
+	report.Expected = money.Round(report.Expected)
+	report.Actual = money.Round(report.Actual)
+	report.Underpaid = money.Round(report.Underpaid)
+	report.Overpaid = money.Round(report.Overpaid)
+
+	sort.Slice(report.Diffs, func(i, j int) bool {
+		a, b := report.Diffs[i], report.Diffs[j]
+		if a.ReferrerID != b.ReferrerID {
+			return a.ReferrerID < b.ReferrerID
+		}
+		if a.ReferredID != b.ReferredID {
+			return a.ReferredID < b.ReferredID
+		}
+		return a.Level < b.Level
+	})
+
+	return report, nil
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+const secondsInWeek = 7 * 24 * 60 * 60
+
+// GetProfitFairnessReport compares the configured weekly percent of every product
+// with the profit actually distributed, per product and weekly cohort.
+// Use ?format=csv to download the report as CSV.
+func (h *Handler) GetProfitFairnessReport(c *gin.Context) {
+	report, err := h.buildProfitFairnessReport(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to build report: %v", err),
+		})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		writeProfitFairnessCSV(c, report)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+func (h *Handler) buildProfitFairnessReport(now time.Time) (*model.ProfitFairnessReport, error) {
+	stats, err := h.db.GetInvestmentProfitStats()
+	if err != nil {
+		return nil, err
+	}
+
+	rowsByKey := make(map[string]*model.ProfitFairnessRow)
+	for _, s := range stats {
+		year, week := time.Unix(s.CreatedAt, 0).UTC().ISOWeek()
+		cohort := fmt.Sprintf("%d-W%02d", year, week)
+		key := s.Type + "|" + cohort
+
+		row, ok := rowsByKey[key]
+		if !ok {
+			row = &model.ProfitFairnessRow{
+				Type:          s.Type,
+				Cohort:        cohort,
+				WeeklyPercent: h.config().InvestmentTypes[s.Type].WeeklyPercent,
+			}
+			rowsByKey[key] = row
+		}
+
+		weeksElapsed := int((now.Unix() - s.CreatedAt) / secondsInWeek)
+		row.Investments++
+		row.Principal += s.Amount
+		row.ExpectedProfit += s.Amount * (row.WeeklyPercent / 100.0) * float64(weeksElapsed)
+		row.DistributedProfit += s.DistributedProfit
+		if weeksElapsed > s.Accruals {
+			row.MissedAccrualsWeeks += weeksElapsed - s.Accruals
+		}
+	}
+
+	report := &model.ProfitFairnessReport{
+		GeneratedAt: now.Unix(),
+		Rows:        make([]model.ProfitFairnessRow, 0, len(rowsByKey)),
+		Totals:      model.ProfitFairnessRow{Type: "all", Cohort: "all"},
+	}
+
+	for _, row := range rowsByKey {
+		fillDrift(row)
+		report.Rows = append(report.Rows, *row)
+
+		report.Totals.Investments += row.Investments
+		report.Totals.Principal += row.Principal
+		report.Totals.ExpectedProfit += row.ExpectedProfit
+		report.Totals.DistributedProfit += row.DistributedProfit
+		report.Totals.MissedAccrualsWeeks += row.MissedAccrualsWeeks
+	}
+	fillDrift(&report.Totals)
+
+	sort.Slice(report.Rows, func(i, j int) bool {
+		if report.Rows[i].Type != report.Rows[j].Type {
+			return report.Rows[i].Type < report.Rows[j].Type
+		}
+		return report.Rows[i].Cohort < report.Rows[j].Cohort
+	})
+
+	return report, nil
+}
+
+// fillDrift calculates drift of distributed profit against the expected one
+func fillDrift(row *model.ProfitFairnessRow) {
+	row.Drift = row.DistributedProfit - row.ExpectedProfit
+	if row.ExpectedProfit != 0 {
+		row.DriftPercent = math.Round(row.Drift/row.ExpectedProfit*10000) / 100
+	}
+}
+
+func writeProfitFairnessCSV(c *gin.Context, report *model.ProfitFairnessReport) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=profit_fairness_%d.csv", report.GeneratedAt))
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"type", "cohort", "investments", "principal", "weekly_percent", "expected_profit", "distributed_profit", "drift", "drift_percent", "missed_accrual_weeks"})
+
+	rows := append(report.Rows, report.Totals)
+	for _, row := range rows {
+		w.Write([]string{
+			row.Type,
+			row.Cohort,
+			strconv.Itoa(row.Investments),
+			money.FormatFixed(row.Principal),
+			strconv.FormatFloat(row.WeeklyPercent, 'f', -1, 64),
+			money.FormatFixed(row.ExpectedProfit),
+			money.FormatFixed(row.DistributedProfit),
+			money.FormatFixed(row.Drift),
+			strconv.FormatFloat(row.DriftPercent, 'f', 2, 64),
+			strconv.Itoa(row.MissedAccrualsWeeks),
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// liabilityAccounts are the ledger accounts holding TON the platform owes besides user
+// balances: invested principal, unclaimed gifts and reserved withdrawals
+var liabilityAccounts = map[string]bool{
+	model.LedgerAccountInvestments:        true,
+	model.LedgerAccountGifts:              true,
+	model.LedgerAccountWithdrawalQueue:    true,
+	model.LedgerAccountWithdrawalApproval: true,
+}
+
+// treasuryReserves sums the on-chain balances of the treasury wallets per currency and
+// compares them with the liabilities in that currency. User balances are kept in TON
+// only, so jettons have no liabilities yet.
+func (h *Handler) treasuryReserves(ctx context.Context) ([]model.CurrencyReserves, error) {
+	reports, err := h.treasuryWalletReports(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ledger, err := h.db.ReconcileLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	tonReserves := model.CurrencyReserves{Currency: "TON", Liabilities: ledger.Users, Complete: true}
+	for _, a := range ledger.Accounts {
+		if liabilityAccounts[a.Account] {
+			tonReserves.Liabilities += a.Balance
+		}
+	}
+
+	jettons := make(map[string]*model.CurrencyReserves)
+	var symbols []string
+	for _, r := range reports {
+		if r.Address == "" {
+			continue // removed from the config, its balance is unknown
+		}
+		if r.OnChainBalance != nil {
+			tonReserves.Reserves += *r.OnChainBalance
+		} else {
+			tonReserves.Complete = false
+		}
+
+		for _, j := range r.Jettons {
+			cr, ok := jettons[j.Symbol]
+			if !ok {
+				cr = &model.CurrencyReserves{Currency: j.Symbol, Complete: true}
+				jettons[j.Symbol] = cr
+				symbols = append(symbols, j.Symbol)
+			}
+			if j.Balance != nil {
+				cr.Reserves += *j.Balance
+			} else {
+				cr.Complete = false
+			}
+		}
+	}
+
+	currencies := []model.CurrencyReserves{tonReserves}
+	for _, symbol := range symbols {
+		currencies = append(currencies, *jettons[symbol])
+	}
+	for i := range currencies {
+		cr := &currencies[i]
+		cr.Reserves = money.Round(cr.Reserves)
+		cr.Liabilities = money.Round(cr.Liabilities)
+		cr.Surplus = money.Round(cr.Reserves - cr.Liabilities)
+		if cr.Liabilities > 0 {
+			coverage := cr.Reserves / cr.Liabilities
+			cr.Coverage = &coverage
+		}
+	}
+	return currencies, nil
+}
+
+// GetTreasuryReserves compares the TON and jettons held by the treasury wallets with what
+// the platform owes in each currency (admin only)
+func (h *Handler) GetTreasuryReserves(c *gin.Context) {
+	currencies, err := h.treasuryReserves(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get treasury reserves: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: model.TreasuryReserves{
+			GeneratedAt: time.Now().Unix(),
+			Currencies:  currencies,
+		},
+	})
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sandboxFirstUserID is the user ID of the first demo account, the others follow
+const sandboxFirstUserID = 1000000001
+
+// sandboxPersonas are the demo accounts of the sandbox. Each deposits about scale TON
+// over the given number of deposits, invests most of it and withdraws some when
+// withdraws is set. referrer is the index of the persona that invited it, -1 for none.
+var sandboxPersonas = []struct {
+	name      string
+	display   string
+	referrer  int
+	scale     float64
+	deposits  int
+	withdraws bool
+}{
+	{"alice", "Alice", -1, 15000, 3, false},
+	{"bob", "Bob", 0, 1500, 2, true},
+	{"carol", "Carol", 0, 300, 2, true},
+	{"dave", "Dave", 1, 50, 1, false},
+	{"erin", "Erin", -1, 0, 0, false},
+}
+
+// SeedSandbox fills the store with the demo accounts of the sandbox (cmd/api -sandbox):
+// users with referrers, completed deposits, investments, withdrawals and an address
+// book entry. The same seed gives the same wallets, IDs and amounts on every start,
+// only the timestamps follow the clock. Call it once on an empty store before serving.
+func (h *Handler) SeedSandbox(seed int64) error {
+	rng := rand.New(rand.NewSource(seed))
+	investTypes := make([]string, 0, len(h.config().InvestmentTypes))
+	for name := range h.config().InvestmentTypes {
+		investTypes = append(investTypes, name)
+	}
+	sort.Strings(investTypes)
+
+	wallets := make([]model.SandboxWallet, 0, len(sandboxPersonas))
+	for i, p := range sandboxPersonas {
+		pubKey := sandboxPubKey(seed, p.name)
+		address, err := h.ton.GenerateWalletAddressFromPubKey(pubKey)
+		if err != nil {
+			return fmt.Errorf("failed to derive the address of %s: %v", p.name, err)
+		}
+		var refID *int
+		if p.referrer >= 0 {
+			refID = &wallets[p.referrer].UserID
+		}
+		id, display := sandboxFirstUserID+i, p.display
+		user, _, err := h.db.CreateUser(pubKey, refID, &id, &display, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", p.name, err)
+		}
+		wallets = append(wallets, model.SandboxWallet{Name: p.name, UserID: user.ID, PubKey: pubKey, Address: address})
+
+		balance := 0.0
+		for d := 0; d < p.deposits; d++ {
+			amount := math.Round(p.scale / float64(p.deposits) * (0.75 + rng.Float64()/2))
+			if err := h.seedSandboxDeposit(user.ID, amount, fmt.Sprintf("SANDBOX%d-%d", user.ID, d)); err != nil {
+				return fmt.Errorf("failed to seed the deposits of %s: %v", p.name, err)
+			}
+			balance += amount
+		}
+
+		// Most of the balance goes into up to two products the amounts qualify for
+		invested := make(map[string]bool)
+		for n := 0; n < 2 && balance > 0; n++ {
+			amount := math.Floor(balance * (0.35 + rng.Float64()*0.15))
+			var eligible []string
+			for _, name := range investTypes {
+				if !invested[name] && h.config().InvestmentTypes[name].MinAmount <= amount {
+					eligible = append(eligible, name)
+				}
+			}
+			if len(eligible) == 0 || amount <= 0 {
+				break
+			}
+			investType := eligible[rng.Intn(len(eligible))]
+			terms, err := h.investmentTerms(user.ID, investType)
+			if err != nil {
+				return err
+			}
+			if err := h.db.CreateInvestment(user.ID, investType, amount, terms); err != nil {
+				return fmt.Errorf("failed to seed an investment of %s: %v", p.name, err)
+			}
+			invested[investType] = true
+			balance -= amount
+		}
+
+		if p.withdraws && balance > 0 {
+			amount := math.Floor(balance * 0.2)
+			txHash := make([]byte, 32)
+			rng.Read(txHash)
+			if err := h.db.RecordWithdrawal(user.ID, amount, hex.EncodeToString(txHash), "", ""); err != nil {
+				return fmt.Errorf("failed to seed a withdrawal of %s: %v", p.name, err)
+			}
+		}
+	}
+
+	cold, err := h.ton.GenerateWalletAddressFromPubKey(sandboxPubKey(seed, "cold"))
+	if err != nil {
+		return err
+	}
+	if _, err := h.db.CreateAddressBookEntry(wallets[0].UserID, "Cold wallet", cold); err != nil {
+		return fmt.Errorf("failed to seed the address book: %v", err)
+	}
+	if h.config().VIP.Enabled {
+		if _, err := h.RecalculateVIPTiers(); err != nil {
+			return fmt.Errorf("failed to rank the sandbox users: %v", err)
+		}
+	}
+
+	h.sandboxWallets = wallets
+	return nil
+}
+
+// sandboxPubKey derives the public key of a demo wallet from the seed
+func sandboxPubKey(seed int64, name string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("tonapp-sandbox:%d:%s", seed, name)))
+	return hex.EncodeToString(sum[:])
+}
+
+// seedSandboxDeposit records a funded deposit request, as if the transfer arrived
+func (h *Handler) seedSandboxDeposit(userID int, amount float64, memo string) error {
+	deposit, err := h.db.CreateDepositRequest(userID, amount, memo, "", "")
+	if err != nil {
+		return err
+	}
+	if _, err := claimDeposit(h.db, deposit.ID); err != nil {
+		return err
+	}
+	return h.db.CompleteDeposit(*deposit, deposit.Amount)
+}
+
+// GetSandboxWallets lists the demo accounts of the sandbox with a fresh session each
+func (h *Handler) GetSandboxWallets(c *gin.Context) {
+	wallets := make([]model.SandboxWallet, 0, len(h.sandboxWallets))
+	for _, w := range h.sandboxWallets {
+		session, err := h.issueSession(w.PubKey, w.Address)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to issue session",
+			})
+			return
+		}
+		w.Session = session
+		wallets = append(wallets, w)
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    gin.H{"wallets": wallets},
+	})
+}
+
+// CreateSandboxSession issues a session for any public key without a ton_proof, so
+// sign-up can be tried with new wallets in the sandbox
+func (h *Handler) CreateSandboxSession(c *gin.Context) {
+	var req model.SandboxSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	if key, err := hex.DecodeString(req.PubKey); err != nil || len(key) != 32 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "pub_key must be 64 hex characters",
+		})
+		return
+	}
+
+	address, err := h.ton.GenerateWalletAddressFromPubKey(req.PubKey)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid pub_key",
+		})
+		return
+	}
+	session, err := h.issueSession(req.PubKey, address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to issue session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    session,
+	})
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"tonapp/internal/config"
+	"tonapp/internal/model"
+)
+
+// applySecrets replaces the secrets of config.json with the ones set in the environment,
+// see config.Secret, and returns the variables used. Only the values of variables that
+// are set replace the file, so config.json keeps working for local development.
+func applySecrets(cfg *model.Config) ([]string, error) {
+	var used []string
+	override := func(key string, field *string) error {
+		value, ok, err := config.Secret(key)
+		if err != nil || !ok {
+			return err
+		}
+		*field = value
+		used = append(used, key)
+		return nil
+	}
+
+	if err := override("TON_MNEMONIC", &cfg.TON.Mnemonic); err != nil {
+		return nil, err
+	}
+	if err := override("TONCENTER_API_KEY", &cfg.TON.APIKey); err != nil {
+		return nil, err
+	}
+	if err := override("ADMIN_API_KEY", &cfg.AdminAPIKey); err != nil {
+		return nil, err
+	}
+	if err := override("RATE_LIMIT_REDIS_PASSWORD", &cfg.RateLimit.Store.Redis.Password); err != nil {
+		return nil, err
+	}
+	if err := override("ALERTS_WEBHOOK_SECRET", &cfg.Alerts.WebhookSecret); err != nil {
+		return nil, err
+	}
+	for name, w := range cfg.TON.TreasuryWallets {
+		if err := override("TON_TREASURY_"+config.SecretName(name)+"_MNEMONIC", &w.Mnemonic); err != nil {
+			return nil, err
+		}
+		cfg.TON.TreasuryWallets[name] = w
+	}
+	return used, nil
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSimulationWeeks = 4
+	maxSimulationWeeks     = 52
+)
+
+// referralPercent returns the referral percent paid to a referrer level
+func referralPercent(cfg model.ReferralConfig, level int) float64 {
+	switch level {
+	case 1:
+		return cfg.Level1Percent
+	case 2:
+		return cfg.Level2Percent
+	case 3:
+		return cfg.Level3Percent
+	}
+	return 0
+}
+
+// referrerDepth returns how many referrer levels (up to 3) a user has
+func referrerDepth(referrers map[int]model.Referrer, userID int) int {
+	depth := 0
+	for depth < 3 {
+		referrer, ok := referrers[userID]
+		if !ok {
+			break
+		}
+		depth++
+		userID = referrer.ID
+	}
+	return depth
+}
+
+// SimulateConfigChange replays the accruals of the last N weeks with different APYs,
+// referral percents or platform fee and reports what payouts would have been
+func (h *Handler) SimulateConfigChange(c *gin.Context) {
+	var req model.SimulationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if req.Weeks <= 0 {
+		req.Weeks = defaultSimulationWeeks
+	}
+	if req.Weeks > maxSimulationWeeks {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "weeks can't exceed 52",
+		})
+		return
+	}
+	for investType := range req.WeeklyPercents {
+		if _, ok := h.config().InvestmentTypes[investType]; !ok {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "unknown investment type " + investType,
+			})
+			return
+		}
+	}
+
+	report, err := h.simulate(req, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to run simulation",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+func (h *Handler) simulate(req model.SimulationRequest, now time.Time) (*model.SimulationReport, error) {
+	to := now.Unix()
+	from := to - int64(req.Weeks)*secondsInWeek
+
+	accruals, err := h.db.GetProfitAccrualsSince(from)
+	if err != nil {
+		return nil, err
+	}
+	earnings, err := h.db.GetReferralEarningsSince(from)
+	if err != nil {
+		return nil, err
+	}
+	referrers, err := h.db.GetReferrerMap()
+	if err != nil {
+		return nil, err
+	}
+
+	referral := h.config().ReferralConfig
+	if req.ReferralConfig != nil {
+		referral = *req.ReferralConfig
+	}
+	feePercent := platformFeePercent(h.config().Accrual)
+	if req.PlatformFeePercent != nil {
+		feePercent = *req.PlatformFeePercent
+	}
+
+	report := &model.SimulationReport{
+		From:         from,
+		To:           to,
+		Weeks:        req.Weeks,
+		WeeklyTotals: make([]model.SimulationWeek, req.Weeks),
+	}
+	for i := range report.WeeklyTotals {
+		report.WeeklyTotals[i].WeekStart = from + int64(i)*secondsInWeek
+	}
+	week := func(ts int64) *model.SimulationWeek {
+		i := int((ts - from) / secondsInWeek)
+		if i < 0 {
+			i = 0
+		}
+		if i >= req.Weeks {
+			i = req.Weeks - 1
+		}
+		return &report.WeeklyTotals[i]
+	}
+
+	rows := make(map[string]*model.SimulationTypeRow)
+	simulatedReferral := make([]float64, 4)
+	for _, a := range accruals {
+		row, ok := rows[a.Type]
+		if !ok {
+			row = &model.SimulationTypeRow{
+				Type:                   a.Type,
+				SimulatedWeeklyPercent: h.config().InvestmentTypes[a.Type].WeeklyPercent,
+			}
+			if pct, ok := req.WeeklyPercents[a.Type]; ok {
+				row.SimulatedWeeklyPercent = pct
+			}
+			rows[a.Type] = row
+		}
+
+		// Scale the recorded gross profit to the simulated APY; the principal
+		// is implied by the percent that was applied at the time
+		simulatedGross := a.GrossProfit
+		if a.WeeklyPercent > 0 {
+			simulatedGross = a.GrossProfit * row.SimulatedWeeklyPercent / a.WeeklyPercent
+		}
+		simulatedGross = money.FloorPayout(simulatedGross)
+		simulatedFee := money.RoundFee(simulatedGross * feePercent / 100.0)
+		simulatedNet := money.Round(simulatedGross - simulatedFee)
+
+		row.Accruals++
+		row.ActualWeeklyPercent = a.WeeklyPercent
+		row.ActualGross += a.GrossProfit
+		row.ActualFee += a.Fee
+		row.ActualNet += a.NetProfit
+		row.SimulatedGross += simulatedGross
+		row.SimulatedFee += simulatedFee
+		row.SimulatedNet += simulatedNet
+
+		w := week(a.CreatedAt)
+		w.ActualPayouts += a.NetProfit
+		w.SimulatedPayout += simulatedNet
+
+		for level := 1; level <= referrerDepth(referrers, a.UserID); level++ {
+			amount := simulatedNet * referralPercent(referral, level) / 100.0
+			simulatedReferral[level] += amount
+			w.SimulatedPayout += amount
+		}
+	}
+
+	actualReferral := make([]float64, 4)
+	for _, e := range earnings {
+		if e.Level >= 1 && e.Level <= 3 {
+			actualReferral[e.Level] += e.Amount
+		}
+		week(e.CreatedAt).ActualPayouts += e.Amount
+	}
+
+	for _, row := range rows {
+		report.Types = append(report.Types, *row)
+		report.ActualPayouts += row.ActualNet
+		report.SimulatedPayouts += row.SimulatedNet
+		report.ActualFeeRevenue += row.ActualFee
+		report.SimulatedFeeRevenue += row.SimulatedFee
+	}
+	sort.Slice(report.Types, func(i, j int) bool { return report.Types[i].Type < report.Types[j].Type })
+
+	for level := 1; level <= 3; level++ {
+		report.Referrals = append(report.Referrals, model.SimulationReferralRow{
+			Level:            level,
+			ActualPercent:    referralPercent(h.config().ReferralConfig, level),
+			SimulatedPercent: referralPercent(referral, level),
+			Actual:           actualReferral[level],
+			Simulated:        simulatedReferral[level],
+		})
+		report.ActualPayouts += actualReferral[level]
+		report.SimulatedPayouts += simulatedReferral[level]
+	}
+	report.PayoutDelta = report.SimulatedPayouts - report.ActualPayouts
+
+	return report, nil
+}
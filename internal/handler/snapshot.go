@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const snapshotDateLayout = "2006-01-02"
+
+// snapshotGracePeriod is how long after midnight UTC a restart still takes the snapshot
+// of the day that ended. Later the balances no longer reflect the end of that day, so
+// the day is left without a snapshot.
+const snapshotGracePeriod = time.Hour
+
+// StartBalanceSnapshots takes a snapshot of all user balances at the end of every UTC
+// day, stored under the date of the day that ended. Snapshots are stored once per date,
+// so a restart within snapshotGracePeriod after midnight doesn't duplicate them.
+func (h *Handler) StartBalanceSnapshots(ctx context.Context) {
+	now := time.Now().UTC()
+	midnight := now.Truncate(24 * time.Hour)
+	if now.Sub(midnight) < snapshotGracePeriod {
+		h.takeBalanceSnapshots(midnight)
+	}
+
+	for {
+		next := midnight.Add(24 * time.Hour)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		midnight = next
+		h.takeBalanceSnapshots(midnight)
+	}
+}
+
+// takeBalanceSnapshots stores the snapshots of the day ending at midnight
+func (h *Handler) takeBalanceSnapshots(midnight time.Time) {
+	date := midnight.AddDate(0, 0, -1).Format(snapshotDateLayout)
+	if n, err := h.db.TakeBalanceSnapshots(date); err != nil {
+		slog.Error("Failed to take balance snapshots", "date", date, "error", err)
+	} else if n > 0 {
+		slog.Info("Stored balance snapshots", "date", date, "count", n)
+	}
+}
+
+// GetBalanceHistory returns daily balance snapshots of a user for charts.
+// Query parameters from/to are dates in YYYY-MM-DD format, defaulting to the last 30 days.
+func (h *Handler) GetBalanceHistory(c *gin.Context) {
+	pubKey := h.pubKeyParam(c)
+	if pubKey == "" {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "missing pub_key parameter",
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(pubKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	now := time.Now().UTC()
+	from := now.AddDate(0, 0, -30).Format(snapshotDateLayout)
+	to := now.Format(snapshotDateLayout)
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		if _, err := time.Parse(snapshotDateLayout, fromStr); err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "invalid from date, expected YYYY-MM-DD",
+			})
+			return
+		}
+		from = fromStr
+	}
+
+	if toStr := c.Query("to"); toStr != "" {
+		if _, err := time.Parse(snapshotDateLayout, toStr); err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "invalid to date, expected YYYY-MM-DD",
+			})
+			return
+		}
+		to = toStr
+	}
+
+	snapshots, err := h.db.GetBalanceSnapshots(user.ID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get balance history: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"from":      from,
+			"to":        to,
+			"snapshots": snapshots,
+		},
+	})
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAdminStats returns operational statistics for admins, with ?reserves=true also the
+// treasury reserves per currency.
+// Deposit analytics cover the last `days` days (default 30).
+func (h *Handler) GetAdminStats(c *gin.Context) {
+	days := 30
+	if daysStr := c.Query("days"); daysStr != "" {
+		d, err := strconv.Atoi(daysStr)
+		if err != nil || d < 1 || d > 365 {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "days must be between 1 and 365",
+			})
+			return
+		}
+		days = d
+	}
+
+	now := time.Now()
+	deposits, err := h.depositIntentStats(now.AddDate(0, 0, -days), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get deposit stats",
+		})
+		return
+	}
+
+	stats := model.AdminStats{
+		Database: h.db.QueryStats(),
+		Deposits: deposits,
+	}
+	// Reserves query every treasury wallet on-chain, so they are only included on request
+	if c.Query("reserves") == "true" {
+		stats.Reserves, err = h.treasuryReserves(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("failed to get treasury reserves: %v", err),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    stats,
+	})
+}
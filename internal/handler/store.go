@@ -0,0 +1,253 @@
+package handler
+
+import (
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+	"tonapp/internal/rates"
+)
+
+// Store is the persistence used by Handler.
+// *database.Database keeps it in SQLite, *memstore.Store in memory for tests and local development.
+// The package doesn't import internal/database, so handler tests build without cgo or a
+// SQLite driver; shared constants and errors live in model.
+type Store interface {
+	Close() error
+	QueryStats() *model.QueryStats
+	CheckWritable() error
+
+	// Users
+	CreateUser(pubKey string, refID *int, customID *int, name *string, photo *string) (user *model.User, created bool, err error)
+	GetUser(id int) (*model.User, error)
+	GetUserByPubKey(pubKey string) (*model.User, error)
+	GetUserByAccountNumber(number int64) (*model.User, error)
+	GetReferrerChain(userID int, levels int) ([]model.Referrer, error)
+	DeleteUser(id int) error
+	UpdateUserBalance(userID int, newBalance float64) error
+	UpdateUserProfile(userID int, req model.UpdateProfileRequest) error
+	TouchUserActivity(userID int) error
+	IsWalletClosed(pubKey string) (bool, error)
+	CloseAccount(userID int, payOut bool) (int64, error)
+
+	// Investments
+	CreateInvestment(userID int, investType string, amount float64, config model.InvestmentTypeConfig) error
+	DeleteInvestment(userID int, investmentID int64) error
+	CloseInvestmentByPolicy(userID int, investmentID int64, closedBy string) error
+	GetUserInvestments(userID int) ([]model.Investment, error)
+	GetOpenInvestments() ([]model.Investment, error)
+	GetInvestmentsDueForAccrual(before int64) ([]model.Investment, error)
+	AccrueInvestmentProfit(inv model.Investment, grossProfit, fee float64, weeklyPercent float64, periodEnd int64) error
+	GetInvestmentProfitStats() ([]model.InvestmentProfitStat, error)
+	GetProfitAccrualsSince(since int64) ([]model.ProfitAccrual, error)
+	SetInvestmentPause(scope string, pauseInvestments, pauseAccrual bool, reason string) error
+	GetInvestmentPauses() ([]model.InvestmentPause, error)
+	AcceptTerms(userID int, investType string, version string, ip string) error
+	HasAcceptedTerms(userID int, investType string) (bool, error)
+	GetTermsAcceptances(userID int) ([]model.TermsAcceptance, error)
+	CreateRiskAcknowledgment(a *model.RiskAcknowledgment, token string) error
+	UseRiskAcknowledgment(token string, userID int, investType string) (*model.RiskAcknowledgment, error)
+	GetRiskAcknowledgments(userID int) ([]model.RiskAcknowledgment, error)
+
+	// Experiments
+	RecordExperimentExposure(experiment string, userID int, variant string) (*model.ExperimentExposure, error)
+	GetExperimentExposure(experiment string, userID int) (*model.ExperimentExposure, error)
+	GetExperimentExposures(experiment string) (map[int]model.ExperimentExposure, error)
+	GetExperimentStats(experiment string, investType string) ([]model.ExperimentVariantStats, error)
+
+	// Referrals
+	GetReferralStats(pubKey string) (*model.ReferralStats, error)
+	AddReferralEarning(referrerID int, referredID int, amount float64, level int, periodEnd int64, caps model.ReferralCaps) (float64, error)
+	ClawBackReferralEarnings(referredID int, since int64, reason string) (*model.ReferralClawback, error)
+	GetReferralEarningHistory(referrerID int, page pagination.Params) (*model.ReferralEarningHistory, error)
+	GetReferralEarningsSince(since int64) ([]model.ReferralEarningEntry, error)
+	GetReferrerMap() (map[int]model.Referrer, error)
+	GetReferralEarningsForPeriod(from, to int64) ([]model.ReferralEarning, error)
+	GetReferralRecomputations(from, to int64) ([]model.ReferralRecomputationRun, error)
+	ApplyReferralCorrections(report *model.ReferralRecomputation) error
+	ChangeReferrer(userID int, newRefID *int, reason string, changedBy string) error
+	GetAttributionHistory(userID int) ([]model.AttributionChange, error)
+	SetRateService(service *rates.Service)
+
+	// Operations
+	GetUserOperations(userID int, filter model.OperationFilter, page pagination.Params) (*model.OperationHistory, error)
+	ForEachUserOperation(userID int, filter model.OperationFilter, fn func(op model.Operation) error) error
+	SetOperationAnnotation(userID int, operationID int64, tags []string, note string) (*model.OperationAnnotation, error)
+	ClearOperationAnnotation(userID int, operationID int64) error
+	GetOperationAnnotations(userID int) (map[int64]model.OperationAnnotation, error)
+	TakeBalanceSnapshots(date string) (int64, error)
+	GetBalanceSnapshots(userID int, from, to string) ([]model.BalanceSnapshot, error)
+
+	// Deposits
+	CreateDepositRequest(userID int, amount float64, memo string, treasuryWallet string, depositAddress string) (*model.DepositRequest, error)
+	GetDepositRequest(id int) (*model.DepositRequest, error)
+	GetDepositsOfUser(userID int) ([]model.DepositRequest, error)
+	GetPendingDeposits(since int64) ([]model.DepositRequest, error)
+	UseDepositAddress(userID int) (*model.DepositAddress, error)
+	GetDepositAddressesToSweep(usedSince int64) ([]model.DepositAddress, error)
+	RecordDepositSweep(userID int, amount float64) error
+	GetDepositHistory(userID int, page pagination.Params) (*model.DepositHistory, error)
+	ClaimDeposit(id int, staleBefore int64) (bool, error)
+	ReleaseDeposit(id int) error
+	SetDepositTxHash(id int, txHash string) (bool, error)
+	ExpireDeposits(createdBefore int64) ([]int, error)
+	CancelDeposit(id int) (bool, error)
+	CompleteDeposit(deposit model.DepositRequest, received float64) error
+	EscalateDeposit(id int) error
+	GetEscalatedDeposits() ([]model.DepositRequest, error)
+	ReviewEscalatedDeposit(id int, credit bool) (bool, error)
+	GetDepositTotals(since time.Time) (completed float64, pending float64, err error)
+	GetDepositIntentsSince(since int64) ([]model.DepositIntent, error)
+	GetDepositsToRemind(from, to int64) ([]model.DepositIntent, error)
+	MarkDepositReminded(depositID int, n *model.Notification) (bool, error)
+	GetStalePendingDeposits(before int64) (count int, oldest int64, err error)
+	CreatePayment(userID int, provider string, amount float64) (*model.Payment, error)
+	SetPaymentQuote(id int64, providerAmount int64, currency string) error
+	CompletePayment(id int64, provider string, externalID string, providerAmount int64, currency string) (completed bool, err error)
+	GetPayment(id int64) (*model.Payment, error)
+	EscalatePayment(id int64, provider string, externalID string, reason string) (bool, error)
+	GetEscalatedPayments() ([]model.Payment, error)
+
+	// Withdrawals
+	GetWithdrawalRequestsByUser(userID int) ([]model.WithdrawalStorage, error)
+	RecordWithdrawal(userID int, amount float64, txHash string, treasuryWallet string, destination string) error
+	EnqueueWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error)
+	ProcessWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error)
+	BatchWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error)
+	GetQueuedWithdrawal(id int64) (*model.QueuedWithdrawal, error)
+	GetUserQueuedWithdrawals(userID int) ([]model.QueuedWithdrawal, error)
+	GetNextQueuedWithdrawals(limit int) ([]model.QueuedWithdrawal, error)
+	CountQueuedWithdrawals() (int, error)
+	GetBatchedWithdrawals(limit int) ([]model.QueuedWithdrawal, error)
+	GetProcessingWithdrawals(limit int) ([]model.QueuedWithdrawal, error)
+	CountBatchedWithdrawals() (int, error)
+	GetQueuedWithdrawalsTotal() (float64, error)
+	SetQueuedWithdrawalStatus(id int64, from, to string) error
+	StartQueuedWithdrawalAttempt(id int64, from string, wallet string) error
+	RecordQueuedWithdrawalError(id int64, reason string) error
+	RetryQueuedWithdrawal(id int64, to, reason string, nextAttemptAt int64) error
+	GetAttemptedWithdrawals() ([]model.QueuedWithdrawal, error)
+	CompleteQueuedWithdrawal(w model.QueuedWithdrawal, txHash string) error
+	FailQueuedWithdrawal(w model.QueuedWithdrawal, reason string) error
+	HoldWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.HeldWithdrawal, error)
+	GetHeldWithdrawal(id int64) (*model.HeldWithdrawal, error)
+	GetHeldWithdrawals(status string) ([]model.HeldWithdrawal, error)
+	GetUserHeldWithdrawals(userID int) ([]model.HeldWithdrawal, error)
+	ApproveHeldWithdrawal(w model.HeldWithdrawal) (*model.QueuedWithdrawal, error)
+	ReleaseHeldWithdrawal(w model.HeldWithdrawal, status string, reason string) error
+
+	// Address book
+	CreateAddressBookEntry(userID int, label, address string) (*model.AddressBookEntry, error)
+	GetAddressBook(userID int) ([]model.AddressBookEntry, error)
+	GetAddressBookEntry(userID int, id int64) (*model.AddressBookEntry, error)
+	UpdateAddressBookLabel(userID int, id int64, label string) error
+	DeleteAddressBookEntry(userID int, id int64) error
+
+	// Ledger
+	GetUserLedger(userID int, page pagination.Params) (*model.LedgerHistory, error)
+	GetBalanceAsOf(userID int, at int64) (*model.BalanceAsOf, error)
+	ReconcileLedger() (*model.LedgerReconciliation, error)
+	GetTreasuryHoldings(userID int) (map[string]float64, error)
+	GetTreasuryWalletFlows() ([]model.TreasuryWalletFlow, error)
+
+	// Gifts
+	CreateGift(senderID int, code string, investType string, amount float64, expiresAt int64) (*model.Gift, error)
+	GetGiftByCode(code string) (*model.Gift, error)
+	GetGiftsBySender(senderID int) ([]model.Gift, error)
+	ClaimGift(code string, recipientID int, config model.InvestmentTypeConfig) (*model.Gift, error)
+	RefundExpiredGifts(now int64) (int, error)
+
+	// Auth
+	CreateSignatureChallenge(ch *model.SignatureChallenge) error
+	ConsumeSignatureChallenge(nonce string, userID int, purpose string) (*model.SignatureChallenge, error)
+	CreateTonProofPayload(p *model.TonProofPayload) error
+	ConsumeTonProofPayload(payload string) error
+	CreateAPIToken(userID int, name, scope, prefix, tokenHash string) (*model.APIToken, error)
+	GetAPITokenByHash(tokenHash string) (*model.APIToken, error)
+	GetAPITokensByUser(userID int) ([]model.APIToken, error)
+	RevokeAPIToken(userID int, tokenID int64) error
+	CreateAdminKey(name, role, prefix, keyHash, createdBy string) (*model.AdminKey, error)
+	GetAdminKeyByHash(keyHash string) (*model.AdminKey, error)
+	GetAdminKeys() ([]model.AdminKey, error)
+	RevokeAdminKey(id int64) error
+	CreatePartner(name, contact, useCase string) (*model.Partner, error)
+	GetPartner(id int64) (*model.Partner, error)
+	GetPartners(status string) ([]model.Partner, error)
+	GetPartnerByTokenHash(tokenHash string) (*model.Partner, error)
+	ApprovePartner(id int64, tier, tokenPrefix, tokenHash string) error
+	RevokePartner(id int64) error
+
+	// Dormancy
+	GetInactiveUsers(before int64) ([]model.DormantUser, error)
+	RecordDormancyNotice(userID int, rule model.DormancyRule, notification *model.Notification) error
+	MarkDormancyExecuted(userID int, rule model.DormancyRule, amount float64, details map[string]interface{}) error
+	ClearDormancyNotice(userID int, rule string) error
+	GetDormancyNoticesByRule(rule string) ([]model.DormancyNotice, error)
+
+	// Notifications
+	AddNotification(n *model.Notification) error
+	GetNotifications(userID int, unreadOnly bool, page pagination.Params) (*model.NotificationInbox, error)
+	CountUnreadNotifications(userID int) (int, error)
+	MarkNotificationsRead(userID int, ids []int64) (int, error)
+
+	// Chain indexer
+	GetIndexerCursor(wallet string) (*model.IndexerCursor, error)
+	GetIndexerCursors() ([]model.IndexerCursor, error)
+	SaveChainTransactions(wallet string, txs []model.ChainTransaction) error
+	FindIndexedDeposits(wallet string, memo string, since int64) ([]model.ChainTransaction, error)
+	GetExplorerTransactions(filter model.ExplorerFilter, page pagination.Params) (*model.ExplorerPage, error)
+	SetChainInvestigation(txID int64, status string, note string) error
+
+	// Access log
+	AddAccessLog(entry *model.AccessLogEntry) error
+	GetAccessLogs(filter model.AccessLogFilter, page pagination.Params) (*model.AccessLogPage, error)
+	DeleteAccessLogsBefore(before int64) (int, error)
+
+	// Integrity
+	CheckIntegrity(sampleSize int) ([]model.IntegrityCheck, error)
+	RepairIntegrity(check string) (int, error)
+
+	// Identity verification
+	GetUserVerification(userID int) (*model.UserVerification, error)
+	SetUserVerification(userID int, verified bool, note string) (*model.UserVerification, error)
+
+	// Account freezes
+	GetUserFreeze(userID int) (*model.UserFreeze, error)
+	SetUserFrozen(userID int, frozen bool, reason string) (*model.UserFreeze, error)
+
+	// Withdrawal limits
+	GetUserWithdrawnSince(userID int, since int64) (float64, error)
+	GetUserLastWithdrawalAt(userID int) (int64, error)
+	GetWithdrawalLimitOverride(userID int) (*model.WithdrawalLimitOverride, error)
+	SetWithdrawalLimitOverride(o model.WithdrawalLimitOverride) (*model.WithdrawalLimitOverride, error)
+	DeleteWithdrawalLimitOverride(userID int) error
+
+	// Idempotency keys
+	ClaimIdempotencyKey(record *model.IdempotencyRecord, expiredBefore int64) (*model.IdempotencyRecord, error)
+	CompleteIdempotencyKey(scope, key string, status int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(scope, key string) error
+	DeleteIdempotencyKeysBefore(before int64) (int, error)
+
+	// VIP tiers
+	GetInvestedTotals() (map[int]float64, error)
+	GetUserTiers() (map[int]model.UserTier, error)
+	GetUserTier(userID int) (*model.UserTier, error)
+	SetUserTier(userID int, tier string, invested float64) error
+
+	// Telegram bot
+	SetBotReferral(telegramID, refID int) error
+	GetBotReferral(telegramID int) (int, error)
+
+	// Notification delivery
+	GetUndispatchedNotifications(limit int) ([]model.Notification, error)
+	MarkNotificationsDispatched(ids []int64) error
+	SetTelegramChat(userID int, chatID int64) error
+	GetTelegramChat(userID int) (int64, error)
+	DeleteTelegramChat(userID int) error
+	GetNotificationOptOuts(userID int) ([]string, error)
+	SetNotificationOptOuts(userID int, kinds []string) error
+
+	// Event feed
+	GetLastOperationID() (int64, error)
+	GetOperationsAfter(afterID int64, limit int) ([]model.Operation, error)
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamFlushEvery controls how many items are written between flushes
+const streamFlushEvery = 200
+
+// jsonArrayStream writes a model.Response whose data is a JSON array item by item,
+// so large lists never have to be held in memory
+type jsonArrayStream struct {
+	c     *gin.Context
+	enc   *json.Encoder
+	count int
+}
+
+func newJSONArrayStream(c *gin.Context) *jsonArrayStream {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString(`{"success":true,"data":[`)
+	return &jsonArrayStream{c: c, enc: json.NewEncoder(c.Writer)}
+}
+
+// Write appends one item to the array
+func (s *jsonArrayStream) Write(item interface{}) error {
+	if s.count > 0 {
+		if _, err := s.c.Writer.WriteString(","); err != nil {
+			return err
+		}
+	}
+	if err := s.enc.Encode(item); err != nil {
+		return err
+	}
+	s.count++
+	if s.count%streamFlushEvery == 0 {
+		s.c.Writer.Flush()
+	}
+	return nil
+}
+
+// Close terminates the response. Once streaming started the status can't change,
+// so a failure is reported in the error field after the partial data.
+func (s *jsonArrayStream) Close(err error) {
+	if err != nil {
+		msg, _ := json.Marshal(err.Error())
+		s.c.Writer.WriteString(`],"error":` + string(msg) + `}`)
+		return
+	}
+	s.c.Writer.WriteString(`]}`)
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// sunsetCheckInterval is how often StartSunsetRefunds looks for retired products
+const sunsetCheckInterval = time.Hour
+
+// retired reports whether a product's sunset_at has passed
+func retired(investConfig model.InvestmentTypeConfig, now time.Time) bool {
+	return investConfig.SunsetAt > 0 && now.Unix() >= investConfig.SunsetAt
+}
+
+// StartSunsetRefunds periodically refunds the open investments of retired products
+func (h *Handler) StartSunsetRefunds(ctx context.Context) {
+	ticker := time.NewTicker(sunsetCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := h.RefundRetiredInvestments(time.Now()); err != nil {
+			slog.Error("Failed to refund retired investments", "error", err)
+		} else if n > 0 {
+			slog.Info("Refunded investments of retired products", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sunsetRefund sums what a user got back from the investments of one retired product
+type sunsetRefund struct {
+	userID    int
+	product   string
+	principal float64
+	profit    float64
+}
+
+// RefundRetiredInvestments closes the open investments of products whose sunset_at has
+// passed, lock periods notwithstanding. Profit is accrued up to the sunset, the started
+// week pro rata, then the principal is returned to the balance. Users are notified once
+// per product. Returns the number of closed investments.
+func (h *Handler) RefundRetiredInvestments(now time.Time) (int, error) {
+	investments, err := h.db.GetOpenInvestments()
+	if err != nil {
+		return 0, err
+	}
+
+	cohorts := h.newExperimentCohorts()
+	refunds := make(map[string]*sunsetRefund)
+	var order []string
+	closed := 0
+	for _, inv := range investments {
+		investConfig, ok := h.config().InvestmentTypes[inv.Type]
+		if !ok || !retired(investConfig, now) {
+			continue
+		}
+		investConfig, err = cohorts.terms(inv, investConfig)
+		if err != nil {
+			return closed, err
+		}
+		feePercent, err := cohorts.feePercent(inv.UserID)
+		if err != nil {
+			return closed, err
+		}
+
+		// An investment whose profit couldn't be accrued stays open until the next run
+		profit, err := h.accrueUntilSunset(&inv, investConfig, feePercent)
+		if err != nil {
+			slog.Error("Failed to accrue investment of retired product", "investment_id", inv.ID, "user_id", inv.UserID, "type", inv.Type, "error", err)
+			continue
+		}
+		if err := h.db.CloseInvestmentByPolicy(inv.UserID, int64(inv.ID), "sunset:"+inv.Type); err != nil {
+			slog.Error("Failed to close investment of retired product", "investment_id", inv.ID, "user_id", inv.UserID, "type", inv.Type, "error", err)
+			continue
+		}
+		closed++
+		slog.Info("Closed investment of retired product", "investment_id", inv.ID, "user_id", inv.UserID, "type", inv.Type,
+			"amount", money.Format(inv.Amount), "profit", money.Format(profit))
+
+		key := fmt.Sprintf("%d|%s", inv.UserID, inv.Type)
+		refund, ok := refunds[key]
+		if !ok {
+			refund = &sunsetRefund{userID: inv.UserID, product: inv.Type}
+			refunds[key] = refund
+			order = append(order, key)
+		}
+		refund.principal += inv.Amount
+		refund.profit += profit
+	}
+
+	for _, key := range order {
+		r := refunds[key]
+		sunset := time.Unix(h.config().InvestmentTypes[r.product].SunsetAt, 0).UTC().Format("2006-01-02")
+		h.notifyUser(r.userID, "investment_sunset", func(l locale) (string, string) {
+			return l.text("investment_sunset.title", r.product), l.text("investment_sunset.body",
+				r.product, sunset, l.amount(money.Round(r.principal)), l.amount(money.Round(r.profit)))
+		})
+	}
+	return closed, nil
+}
+
+// accrueUntilSunset credits the profit of an investment of a retired product up to its
+// sunset: the full weeks left, then the started week in proportion to its elapsed time.
+// Nothing is accrued while accrual is paused or disabled. Returns the net profit credited.
+func (h *Handler) accrueUntilSunset(inv *model.Investment, investConfig model.InvestmentTypeConfig, feePercent float64) (float64, error) {
+	if !h.config().Accrual.Enabled {
+		return 0, nil
+	}
+	pause, err := h.getInvestmentPause(inv.Type, true)
+	if err != nil || pause != nil {
+		return 0, err
+	}
+
+	profit := 0.0
+	for {
+		periods, net := h.accrueWeeks(inv, investConfig, feePercent, investConfig.SunsetAt)
+		profit += net
+		if periods < maxAccrualCatchUp {
+			break
+		}
+	}
+
+	periodStart := h.accrualPeriodStart(*inv)
+	elapsed := investConfig.SunsetAt - periodStart
+	if elapsed >= secondsInWeek {
+		return profit, fmt.Errorf("profit is only accrued until %d", periodStart)
+	}
+	if elapsed <= 0 {
+		return profit, nil
+	}
+	grossProfit := money.FloorPayout(inv.Amount * (investConfig.WeeklyPercent / 100.0) * float64(elapsed) / secondsInWeek)
+	if grossProfit <= 0 {
+		return profit, nil
+	}
+	net, err := h.accrueProfit(*inv, investConfig, feePercent, grossProfit, investConfig.SunsetAt)
+	if err != nil {
+		return profit, err
+	}
+	inv.LastAccruedAt = investConfig.SunsetAt
+	return profit + net, nil
+}
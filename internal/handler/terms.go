@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// termsFormat derives the document format from its file extension
+func termsFormat(doc model.TermsDocument) string {
+	if doc.Path == "" {
+		return "link"
+	}
+	switch strings.ToLower(filepath.Ext(doc.Path)) {
+	case ".pdf":
+		return "pdf"
+	default:
+		return "markdown"
+	}
+}
+
+// termsInfo describes where the client can read a terms document
+func termsInfo(investType string, doc model.TermsDocument) gin.H {
+	url := doc.URL
+	if doc.Path != "" {
+		url = "/api/v1/terms/" + investType + "/document"
+	}
+	return gin.H{
+		"type":    investType,
+		"version": doc.Version,
+		"format":  termsFormat(doc),
+		"url":     url,
+	}
+}
+
+// termsVersions returns the current terms version of each investment type
+func (h *Handler) termsVersions() map[string]string {
+	if len(h.config().Terms) == 0 {
+		return nil
+	}
+	versions := make(map[string]string, len(h.config().Terms))
+	for investType, doc := range h.config().Terms {
+		versions[investType] = doc.Version
+	}
+	return versions
+}
+
+// ensureTermsAccepted checks that the user acknowledged the terms before their first
+// investment into a product. Sending the current version in acceptVersion accepts
+// it on the spot. Writes a 428 response and returns false when acceptance is missing.
+func (h *Handler) ensureTermsAccepted(c *gin.Context, user *model.User, investType string, acceptVersion string) bool {
+	doc, ok := h.config().Terms[investType]
+	if !ok || doc.Version == "" {
+		return true
+	}
+
+	accepted, err := h.db.HasAcceptedTerms(user.ID, investType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to check terms acceptance",
+		})
+		return false
+	}
+	if accepted {
+		return true
+	}
+
+	if acceptVersion == doc.Version {
+		if err := h.db.AcceptTerms(user.ID, investType, doc.Version, c.ClientIP()); err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to record terms acceptance",
+			})
+			return false
+		}
+		return true
+	}
+
+	c.JSON(http.StatusPreconditionRequired, model.Response{
+		Success: false,
+		Error:   "terms of this investment type must be accepted first",
+		Code:    model.ErrorTermsNotAccepted,
+		Data:    termsInfo(investType, doc),
+	})
+	return false
+}
+
+// GetTerms returns the current terms of an investment type; markdown documents are inlined
+func (h *Handler) GetTerms(c *gin.Context) {
+	investType := c.Param("type")
+	doc, ok := h.config().Terms[investType]
+	if !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "no terms for this investment type",
+		})
+		return
+	}
+
+	info := termsInfo(investType, doc)
+	if termsFormat(doc) == "markdown" {
+		content, err := os.ReadFile(doc.Path)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Success: false,
+				Error:   "failed to read terms document",
+			})
+			return
+		}
+		info["content"] = string(content)
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    info,
+	})
+}
+
+// GetTermsDocument serves the terms document file of an investment type
+func (h *Handler) GetTermsDocument(c *gin.Context) {
+	doc, ok := h.config().Terms[c.Param("type")]
+	if !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "no terms for this investment type",
+		})
+		return
+	}
+
+	if doc.Path == "" {
+		c.Redirect(http.StatusFound, doc.URL)
+		return
+	}
+
+	if termsFormat(doc) == "markdown" {
+		c.Header("Content-Type", "text/markdown; charset=utf-8")
+	}
+	c.File(doc.Path)
+}
+
+// AcceptTerms records the user's acknowledgment of the current terms of an investment type
+func (h *Handler) AcceptTerms(c *gin.Context) {
+	investType := c.Param("type")
+	doc, ok := h.config().Terms[investType]
+	if !ok {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "no terms for this investment type",
+		})
+		return
+	}
+
+	var req model.AcceptTermsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	if req.Version != doc.Version {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "terms version is outdated",
+			Code:    model.ErrorTermsOutdated,
+			Data:    termsInfo(investType, doc),
+		})
+		return
+	}
+
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	if err := h.db.AcceptTerms(user.ID, investType, doc.Version, c.ClientIP()); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to record terms acceptance",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: model.TermsAcceptance{
+			Type:    investType,
+			Version: doc.Version,
+		},
+	})
+}
+
+// GetTermsAcceptances lists the terms versions the user accepted
+func (h *Handler) GetTermsAcceptances(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	acceptances, err := h.db.GetTermsAcceptances(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get terms acceptances",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    acceptances,
+	})
+}
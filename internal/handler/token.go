@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiTokenPrefix  = "tapp_"
+	APITokenScopeRO = "read"
+
+	// contextTokenUser is the gin context key of the user authenticated by an API token
+	contextTokenUser = "token_user"
+)
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// pubKeyParam returns the pub_key of the user authenticated by an API token,
+// falling back to the pub_key route parameter
+func (h *Handler) pubKeyParam(c *gin.Context) string {
+	if user, ok := c.Get(contextTokenUser); ok {
+		return user.(*model.User).PubKey
+	}
+	return c.Param("pub_key")
+}
+
+// APITokenAuth authenticates personal API tokens passed as "Authorization: Bearer <token>".
+// Tokens are read-only, so only GET requests are allowed.
+func (h *Handler) APITokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || !strings.HasPrefix(token, apiTokenPrefix) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "missing API token",
+				Code:    model.ErrorAPITokenMissing,
+			})
+			return
+		}
+
+		apiToken, err := h.db.GetAPITokenByHash(hashAPIToken(token))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "invalid API token",
+				Code:    model.ErrorAPITokenInvalid,
+			})
+			return
+		}
+
+		if apiToken.Scope == APITokenScopeRO && c.Request.Method != http.MethodGet {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.Response{
+				Success: false,
+				Error:   "token scope does not allow write access",
+				Code:    model.ErrorAPITokenReadOnly,
+			})
+			return
+		}
+
+		user, err := h.db.GetUser(apiToken.UserID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "token owner not found",
+				Code:    model.ErrorAPITokenInvalid,
+			})
+			return
+		}
+
+		c.Set(contextTokenUser, user)
+		c.Next()
+	}
+}
+
+// CreateAPIToken issues a personal read-only API token after verifying
+// the wallet signature of an "api_token" challenge
+func (h *Handler) CreateAPIToken(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	var req model.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if _, err := h.verifyChallenge(user, ChallengePurposeAPIToken, req.Nonce, req.Signature); err != nil {
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   "wallet proof failed: " + err.Error(),
+			Code:    model.ErrorTonProofFailed,
+		})
+		return
+	}
+
+	secret, err := randomHex(24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to generate token",
+		})
+		return
+	}
+	token := apiTokenPrefix + secret
+
+	apiToken, err := h.db.CreateAPIToken(user.ID, req.Name, APITokenScopeRO, token[:len(apiTokenPrefix)+6], hashAPIToken(token))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to store token",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, model.Response{
+		Success: true,
+		Data: model.CreateAPITokenResponse{
+			APIToken: *apiToken,
+			Token:    token,
+		},
+		Message: "store the token now, it won't be shown again",
+	})
+}
+
+// GetAPITokens lists the user's API tokens without their secrets
+func (h *Handler) GetAPITokens(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	tokens, err := h.db.GetAPITokensByUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get tokens",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    tokens,
+	})
+}
+
+// RevokeAPIToken revokes one of the user's API tokens
+func (h *Handler) RevokeAPIToken(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(c.Param("token_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid token id",
+		})
+		return
+	}
+
+	if err := h.db.RevokeAPIToken(user.ID, tokenID); err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	h.rateLimitTokens.reset()
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    gin.H{"id": tokenID},
+	})
+}
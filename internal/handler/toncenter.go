@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"net/http"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetToncenterBudget returns toncenter request pacing metrics
+func (h *Handler) GetToncenterBudget(c *gin.Context) {
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    h.ton.BudgetStats(),
+	})
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+
+	"tonapp/internal/model"
+	"tonapp/internal/ton"
+)
+
+// TonClient is the blockchain access used by Handler.
+// *ton.Client talks to toncenter and the liteservers, *tonmock.Client is a fake for
+// handler tests and local development without sending TON.
+type TonClient interface {
+	// Wallets
+	GetDepositAddress() string
+	TreasuryWalletNames() []string
+	TreasuryAddress(name string) string
+	DepositWalletAddress(subwalletID uint32) (string, error)
+	GenerateWalletAddressFromPubKey(pubKey string) (string, error)
+	GetWalletBalance(ctx context.Context, addr string) (float64, error)
+	JettonBalance(ctx context.Context, master string, owner string, decimals int) (float64, error)
+
+	// Deposits
+	CheckDeposit(walletAddress string, match ton.DepositMatch, memo string, withinLastMinutes int) (float64, error)
+	CheckAddressDeposit(walletAddress string, match ton.DepositMatch, since int64) (float64, error)
+	FindArchivedDeposit(ctx context.Context, walletAddress string, match ton.DepositMatch, memo string, since int64, maxPages int) (float64, error)
+	GetTransaction(ctx context.Context, hash string) (*model.ChainTransaction, error)
+	SweepDepositWallet(ctx context.Context, subwalletID uint32, minAmount float64) (float64, string, error)
+	TransferFundsWithSplit(ctx context.Context, amount float64, feeAddress string) error
+	FetchTransactionsSince(ctx context.Context, walletAddress string, afterLT uint64, limit int) ([]model.ChainTransaction, error)
+
+	// Withdrawals
+	WithdrawFromWallet(ctx context.Context, name string, pubKey string, amount float64) (string, error)
+	WithdrawToAddress(ctx context.Context, name string, destination string, amount float64) (string, error)
+	WithdrawBatch(ctx context.Context, name string, payouts []ton.Payout) (string, error)
+	MaxBatchMessages(name string) int
+	SentMessages(ctx context.Context, name string, since int64) ([]ton.SentMessage, error)
+
+	// Health
+	CheckConnectivity(ctx context.Context) error
+	BudgetStats() model.ToncenterBudgetStats
+}
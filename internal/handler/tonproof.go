@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tonapp/internal/jwt"
+	"tonapp/internal/model"
+	"tonapp/internal/tonproof"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionIssuer = "tonapp"
+
+	defaultSessionTTL = time.Hour
+	defaultProofTTL   = 15 * time.Minute
+
+	// contextSessionPubKey is the gin context key of the wallet authenticated by a session
+	contextSessionPubKey = "session_pub_key"
+)
+
+// TON Connect network ids
+var tonConnectNetworks = map[string]string{
+	"-239": "mainnet",
+	"-3":   "testnet",
+}
+
+func (h *Handler) sessionTTL() time.Duration {
+	if h.config().Auth.SessionTTLMinutes > 0 {
+		return time.Duration(h.config().Auth.SessionTTLMinutes) * time.Minute
+	}
+	return defaultSessionTTL
+}
+
+func (h *Handler) proofTTL() time.Duration {
+	if h.config().Auth.ProofTTLSeconds > 0 {
+		return time.Duration(h.config().Auth.ProofTTLSeconds) * time.Second
+	}
+	return defaultProofTTL
+}
+
+// proofDomains returns the app domains accepted in proofs
+func (h *Handler) proofDomains() []string {
+	if len(h.config().Auth.AllowedDomains) > 0 {
+		return h.config().Auth.AllowedDomains
+	}
+	if u, err := url.Parse(h.config().Telegram.WebAppURL); err == nil && u.Host != "" {
+		return []string{u.Host}
+	}
+	return nil
+}
+
+// CreateTonProofPayload issues the payload the wallet signs in its ton_proof
+func (h *Handler) CreateTonProofPayload(c *gin.Context) {
+	payload, err := randomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to generate payload",
+		})
+		return
+	}
+
+	p := &model.TonProofPayload{
+		Payload:   payload,
+		ExpiresAt: time.Now().Add(h.proofTTL()).Unix(),
+	}
+	if err := h.db.CreateTonProofPayload(p); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to store payload",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    p,
+	})
+}
+
+// VerifyTonProof checks a TON Connect ton_proof and issues a session for the wallet
+func (h *Handler) VerifyTonProof(c *gin.Context) {
+	var req model.TonProofRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	c.Set(contextClaimedPubKey, req.PublicKey)
+
+	if err := h.checkTonProof(&req, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   "ton_proof verification failed: " + err.Error(),
+			Code:    model.ErrorTonProofFailed,
+		})
+		return
+	}
+
+	// Payloads are consumed last so a malformed proof doesn't burn the payload
+	if err := h.db.ConsumeTonProofPayload(req.Proof.Payload); err != nil {
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   "ton_proof verification failed: " + err.Error(),
+			Code:    model.ErrorTonProofFailed,
+		})
+		return
+	}
+
+	session, err := h.issueSession(req.PublicKey, req.Address)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to issue session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    session,
+	})
+}
+
+// issueSession signs a session for a wallet valid for auth.session_ttl_minutes
+func (h *Handler) issueSession(pubKey, address string) (*model.AuthSession, error) {
+	now := time.Now()
+	pubKey = strings.ToLower(pubKey)
+	claims := jwt.Claims{
+		Issuer:    sessionIssuer,
+		Subject:   pubKey,
+		Address:   address,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(h.sessionTTL()).Unix(),
+	}
+	token, err := jwt.Sign(claims, []byte(h.config().Auth.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+	return &model.AuthSession{
+		Token:     token,
+		PubKey:    pubKey,
+		Address:   address,
+		ExpiresAt: claims.ExpiresAt,
+	}, nil
+}
+
+// checkTonProof verifies the proof was signed by the key of the wallet at req.Address
+// for this app, recently, over one of our payloads
+func (h *Handler) checkTonProof(req *model.TonProofRequest, now time.Time) error {
+	proof := req.Proof
+
+	if req.Network != "" && tonConnectNetworks[req.Network] != h.config().TON.Network {
+		return fmt.Errorf("wallet is on another network")
+	}
+
+	allowed := false
+	for _, domain := range h.proofDomains() {
+		if strings.EqualFold(proof.Domain.Value, domain) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("domain %q is not allowed", proof.Domain.Value)
+	}
+	if int(proof.Domain.LengthBytes) != len(proof.Domain.Value) {
+		return fmt.Errorf("domain length mismatch")
+	}
+
+	signedAt := time.Unix(proof.Timestamp, 0)
+	if now.Sub(signedAt) > h.proofTTL() || signedAt.After(now.Add(time.Minute)) {
+		return fmt.Errorf("proof expired")
+	}
+
+	pubKey, err := hex.DecodeString(req.PublicKey)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("public_key is not a hex encoded ed25519 public key")
+	}
+
+	workchain, hash, err := tonproof.ParseAddress(req.Address)
+	if err != nil {
+		return err
+	}
+	if err := tonproof.CheckStateInit(proof.StateInit, hash, pubKey); err != nil {
+		return err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(proof.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature format")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), tonproof.Message(workchain, hash, proof.Domain.Value, proof.Timestamp, proof.Payload), signature) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// WalletAuth requires a session issued by VerifyTonProof as "Authorization: Bearer <token>".
+// On routes with a pub_key parameter the session must belong to that wallet.
+func (h *Handler) WalletAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "missing session token",
+				Code:    model.ErrorSessionMissing,
+			})
+			return
+		}
+
+		claims, err := jwt.Parse(token, []byte(h.config().Auth.JWTSecret), time.Now())
+		if err == jwt.ErrExpired {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "session expired",
+				Code:    model.ErrorSessionExpired,
+			})
+			return
+		}
+		if err != nil || claims.Issuer != sessionIssuer {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Success: false,
+				Error:   "invalid session token",
+				Code:    model.ErrorSessionInvalid,
+			})
+			return
+		}
+
+		if pubKey := c.Param("pub_key"); pubKey != "" && !strings.EqualFold(pubKey, claims.Subject) {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.Response{
+				Success: false,
+				Error:   "session belongs to another wallet",
+				Code:    model.ErrorSessionWalletMismatch,
+			})
+			return
+		}
+
+		c.Set(contextSessionPubKey, claims.Subject)
+		c.Next()
+	}
+}
+
+// RateLimitSessionWallet returns the wallet of a valid session token, so rate limits with
+// per_pub_key count the wallet's requests from every IP in one bucket
+func (h *Handler) RateLimitSessionWallet(token string) (string, bool) {
+	claims, err := jwt.Parse(token, []byte(h.config().Auth.JWTSecret), time.Now())
+	if err != nil || claims.Issuer != sessionIssuer {
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+// authorizePubKey checks the session belongs to a pub_key taken from the request body
+// and responds with 403 otherwise
+func (h *Handler) authorizePubKey(c *gin.Context, pubKey string) bool {
+	if session, ok := c.Get(contextSessionPubKey); ok && strings.EqualFold(session.(string), pubKey) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, model.Response{
+		Success: false,
+		Error:   "session belongs to another wallet",
+		Code:    model.ErrorSessionWalletMismatch,
+	})
+	return false
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inflowLookbackDays is the window used to estimate the average daily deposit inflow
+const inflowLookbackDays = 30
+
+// GetTreasuryForecast projects upcoming obligations (accruals due, unlocking investments,
+// queued withdrawals) against expected inflows for 7 and 30 days (admin only).
+// Use ?days=N for a single custom horizon.
+func (h *Handler) GetTreasuryForecast(c *gin.Context) {
+	horizons := []int{7, 30}
+	if daysStr := c.Query("days"); daysStr != "" {
+		days, err := strconv.Atoi(daysStr)
+		if err != nil || days <= 0 || days > 365 {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "days must be between 1 and 365",
+			})
+			return
+		}
+		horizons = []int{days}
+	}
+
+	report, err := h.buildTreasuryForecast(c, time.Now(), horizons)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to build forecast: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+func (h *Handler) buildTreasuryForecast(c *gin.Context, now time.Time, horizons []int) (*model.TreasuryForecastReport, error) {
+	investments, err := h.db.GetOpenInvestments()
+	if err != nil {
+		return nil, err
+	}
+
+	completed, pending, err := h.db.GetDepositTotals(now.AddDate(0, 0, -inflowLookbackDays))
+	if err != nil {
+		return nil, err
+	}
+
+	queued, err := h.db.GetQueuedWithdrawalsTotal()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.TreasuryForecastReport{
+		GeneratedAt:        now.Unix(),
+		AverageDailyInflow: completed / inflowLookbackDays,
+	}
+
+	hotBalance, err := h.ton.GetWalletBalance(c.Request.Context(), h.ton.GetDepositAddress())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to get hot wallet balance for forecast", "error", err)
+	} else {
+		report.HotWalletBalanceKnown = true
+	}
+
+	referralPercent := h.config().ReferralConfig.Level1Percent + h.config().ReferralConfig.Level2Percent + h.config().ReferralConfig.Level3Percent
+
+	cohorts := h.newExperimentCohorts()
+	for _, days := range horizons {
+		horizonEnd := now.Add(time.Duration(days) * 24 * time.Hour).Unix()
+		f := model.TreasuryForecast{
+			HorizonDays:       days,
+			QueuedWithdrawals: queued,
+			ExpectedInflows:   report.AverageDailyInflow * float64(days),
+			PendingDeposits:   pending,
+			HotWalletBalance:  hotBalance,
+		}
+
+		for _, inv := range investments {
+			investConfig, ok := h.config().InvestmentTypes[inv.Type]
+			if !ok {
+				continue
+			}
+			if investConfig, err = cohorts.terms(inv, investConfig); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to get experiment terms for forecast", "investment_id", inv.ID, "error", err)
+			}
+			feePercent, err := cohorts.feePercent(inv.UserID)
+			if err != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to get VIP tier for forecast", "investment_id", inv.ID, "error", err)
+			}
+
+			// Weekly accruals completing within the horizon
+			weeks := (horizonEnd - h.accrualPeriodStart(inv)) / secondsInWeek
+			if weeks > 0 && h.config().Accrual.Enabled {
+				netProfit := inv.Amount * (investConfig.WeeklyPercent / 100.0) * (1 - feePercent/100.0)
+				f.AccrualsDue += netProfit * float64(weeks)
+				f.ReferralPayouts += netProfit * float64(weeks) * (referralPercent / 100.0)
+			}
+
+			// Principal becoming withdrawable within the horizon
+			unlockAt := inv.CreatedAt + int64(investConfig.LockPeriod)*24*60*60
+			if unlockAt <= horizonEnd {
+				f.UnlockingPrincipal += inv.Amount
+				f.UnlockingCount++
+			}
+		}
+
+		f.TotalObligations = f.AccrualsDue + f.ReferralPayouts + f.UnlockingPrincipal + f.QueuedWithdrawals
+		f.ProjectedBalance = f.HotWalletBalance + f.ExpectedInflows - f.TotalObligations
+		if f.ProjectedBalance < 0 {
+			f.FundingGap = -f.ProjectedBalance
+		}
+
+		report.Forecasts = append(report.Forecasts, f)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// depositWallet returns the treasury wallet deposits for an investment type are routed to,
+// empty for the main wallet. Deposits without an investment type go to the main wallet.
+func (h *Handler) depositWallet(investmentType string) (string, error) {
+	if investmentType == "" {
+		return "", nil
+	}
+	investConfig, ok := h.config().InvestmentTypes[investmentType]
+	if !ok {
+		return "", fmt.Errorf("unknown investment type %q", investmentType)
+	}
+	return investConfig.TreasuryWallet, nil
+}
+
+// withdrawalWallet picks the wallet a withdrawal is sent from: the treasury wallet the
+// user's routed deposits are held in, if what is left of them there covers the whole
+// amount, otherwise the main wallet
+func (h *Handler) withdrawalWallet(userID int, amount float64) string {
+	holdings, err := h.db.GetTreasuryHoldings(userID)
+	if err != nil {
+		slog.Error("Failed to get treasury holdings", "user_id", userID, "error", err)
+		return ""
+	}
+
+	best, bestHolding := "", 0.0
+	for wallet, holding := range holdings {
+		if h.ton.TreasuryAddress(wallet) == "" || holding < amount {
+			continue
+		}
+		if best == "" || holding > bestHolding || (holding == bestHolding && wallet < best) {
+			best, bestHolding = wallet, holding
+		}
+	}
+	return best
+}
+
+// treasuryWalletLabel names a treasury wallet in logs and reports
+func treasuryWalletLabel(wallet string) string {
+	if wallet == "" {
+		return model.TreasuryWalletMain
+	}
+	return wallet
+}
+
+// GetTreasuryWallets compares what the ledger recorded entering and leaving each treasury
+// wallet with its on-chain balance (admin only)
+func (h *Handler) GetTreasuryWallets(c *gin.Context) {
+	reports, err := h.treasuryWalletReports(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to get treasury wallet flows: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    reports,
+	})
+}
+
+// treasuryWalletReports reconciles the ledger flows of every treasury wallet with its
+// on-chain TON balance and lists its jetton balances
+func (h *Handler) treasuryWalletReports(ctx context.Context) ([]model.TreasuryWalletReconciliation, error) {
+	flows, err := h.db.GetTreasuryWalletFlows()
+	if err != nil {
+		return nil, err
+	}
+	flowOf := make(map[string]model.TreasuryWalletFlow, len(flows))
+	for _, f := range flows {
+		flowOf[f.Wallet] = f
+	}
+
+	productsOf := make(map[string][]string)
+	for name, investConfig := range h.config().InvestmentTypes {
+		productsOf[investConfig.TreasuryWallet] = append(productsOf[investConfig.TreasuryWallet], name)
+	}
+
+	// The main wallet first, then the configured wallets, then wallets that were removed
+	// from the config but still have ledger flows
+	wallets := append([]string{""}, h.ton.TreasuryWalletNames()...)
+	listed := make(map[string]bool, len(wallets))
+	for _, w := range wallets {
+		listed[w] = true
+	}
+	for _, f := range flows {
+		if !listed[f.Wallet] {
+			wallets = append(wallets, f.Wallet)
+		}
+	}
+
+	reports := make([]model.TreasuryWalletReconciliation, 0, len(wallets))
+	for _, wallet := range wallets {
+		flow := flowOf[wallet]
+		products := productsOf[wallet]
+		if products == nil {
+			products = make([]string, 0)
+		}
+		sort.Strings(products)
+
+		r := model.TreasuryWalletReconciliation{
+			Wallet:          treasuryWalletLabel(wallet),
+			Address:         h.ton.TreasuryAddress(wallet),
+			InvestmentTypes: products,
+			Deposited:       flow.Deposited,
+			Withdrawn:       flow.Withdrawn,
+			Net:             money.Round(flow.Deposited - flow.Withdrawn),
+		}
+
+		if r.Address == "" {
+			r.Error = "wallet is not configured"
+		} else if balance, err := h.ton.GetWalletBalance(ctx, r.Address); err != nil {
+			r.Error = fmt.Sprintf("failed to get balance: %v", err)
+		} else {
+			difference := money.Round(balance - r.Net)
+			r.OnChainBalance = &balance
+			r.Difference = &difference
+		}
+		if r.Address != "" {
+			r.Jettons = h.walletJettons(ctx, r.Address)
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+// walletJettons fetches the balances of the configured jettons held by a wallet, by symbol
+func (h *Handler) walletJettons(ctx context.Context, address string) []model.JettonBalance {
+	if len(h.config().TON.Jettons) == 0 {
+		return nil
+	}
+	symbols := make([]string, 0, len(h.config().TON.Jettons))
+	for symbol := range h.config().TON.Jettons {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+
+	balances := make([]model.JettonBalance, 0, len(symbols))
+	for _, symbol := range symbols {
+		cfg := h.config().TON.Jettons[symbol]
+		decimals := cfg.Decimals
+		if decimals == 0 {
+			decimals = 9
+		}
+		b := model.JettonBalance{Symbol: symbol}
+		if balance, err := h.ton.JettonBalance(ctx, cfg.Master, address, decimals); err != nil {
+			b.Error = err.Error()
+		} else {
+			b.Balance = &balance
+		}
+		balances = append(balances, b)
+	}
+	return balances
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"fmt"
+
+	"tonapp/internal/model"
+)
+
+// userTexts are the notification and bot texts by key and language of
+// model.SupportedLanguages. Keys without a text in the user's language fall back to
+// English.
+var userTexts = map[string]map[string]string{
+	"deposit_credited.title": {
+		"en": "Deposit received",
+		"ru": "Депозит зачислен",
+	},
+	"deposit_credited.body": {
+		"en": "Your deposit of %s TON arrived and was added to your balance.",
+		"ru": "Ваш депозит %s TON получен и зачислен на баланс.",
+	},
+	"deposit_reminder.title": {
+		"en": "Deposit not received yet",
+		"ru": "Депозит ещё не получен",
+	},
+	"deposit_reminder.body": {
+		"en": "Your deposit of %s TON is still waiting. Send it with the comment %s to complete it.",
+		"ru": "Ваш депозит %s TON ещё ожидает перевода. Отправьте его с комментарием %s, чтобы завершить.",
+	},
+	"deposit_rejected.title": {
+		"en": "Deposit not found",
+		"ru": "Депозит не найден",
+	},
+	"deposit_rejected.body": {
+		"en": "We couldn't find the transfer of your deposit of %s TON. Contact support with the transaction if you sent it.",
+		"ru": "Мы не нашли перевод вашего депозита %s TON. Если вы его отправили, обратитесь в поддержку и укажите транзакцию.",
+	},
+	"withdrawal_sent.title": {
+		"en": "Withdrawal sent",
+		"ru": "Вывод отправлен",
+	},
+	"withdrawal_sent.body": {
+		"en": "Your withdrawal of %s TON was sent in transaction %s.",
+		"ru": "Ваш вывод %s TON отправлен транзакцией %s.",
+	},
+	"withdrawal_failed.title": {
+		"en": "Withdrawal failed",
+		"ru": "Вывод не выполнен",
+	},
+	"withdrawal_failed.body": {
+		"en": "Your withdrawal of %s TON couldn't be sent. The amount was returned to your balance.",
+		"ru": "Не удалось отправить ваш вывод %s TON. Сумма возвращена на баланс.",
+	},
+	"withdrawal_rejected.title": {
+		"en": "Withdrawal rejected",
+		"ru": "Вывод отклонён",
+	},
+	"withdrawal_rejected.body": {
+		"en": "Your withdrawal of %s TON was rejected: %s. The amount was returned to your balance.",
+		"ru": "Ваш вывод %s TON отклонён: %s. Сумма возвращена на баланс.",
+	},
+	"address_added.title": {
+		"en": "Withdrawal address added",
+		"ru": "Добавлен адрес для вывода",
+	},
+	"address_added.body": {
+		"en": "%s was added to your address book as %q. Withdrawals to it are allowed from %s. If you didn't add it, delete it and contact support.",
+		"ru": "Адрес %s добавлен в вашу адресную книгу как %q. Выводы на него разрешены с %s. Если вы его не добавляли, удалите его и обратитесь в поддержку.",
+	},
+	"profit_accrued.title": {
+		"en": "Profit accrued",
+		"ru": "Начислена прибыль",
+	},
+	"profit_accrued.body": {
+		"en": "%s TON of investment profit were added to your balance.",
+		"ru": "На ваш баланс зачислено %s TON прибыли от инвестиций.",
+	},
+	"investment_sunset.title": {
+		"en": "%s investments closed",
+		"ru": "Инвестиции %s закрыты",
+	},
+	"investment_sunset.body": {
+		"en": "The %s product was retired on %s, so your investments in it were closed. %s TON of principal and %s TON of profit were added to your balance.",
+		"ru": "Продукт %s закрыт %s, поэтому ваши инвестиции в него закрыты. На баланс зачислено %s TON основной суммы и %s TON прибыли.",
+	},
+	"vip_tier.title": {
+		"en": "Welcome to the %[2]s tier",
+		"ru": "Добро пожаловать на уровень %[2]s",
+	},
+	"vip_tier.body": {
+		"en": "With %s TON invested you reached the %s tier: %g%% off the platform fee on profit and %g%% more weekly percent on every investment.",
+		"ru": "Инвестировав %s TON, вы достигли уровня %s: скидка %g%% на комиссию платформы с прибыли и на %g%% больше недельного процента по каждой инвестиции.",
+	},
+	"gift_claimed.title": {
+		"en": "Gift claimed",
+		"ru": "Подарок получен",
+	},
+	"gift_claimed.body": {
+		"en": "Your gift of %s TON was claimed.",
+		"ru": "Ваш подарок %s TON получен.",
+	},
+	"referral_clawback.title": {
+		"en": "Referral earnings reversed",
+		"ru": "Реферальные начисления отменены",
+	},
+	"referral_clawback.body": {
+		"en": "%s TON of referral earnings were reversed because the activity they were paid on was reversed.",
+		"ru": "%s TON реферальных начислений отменены, так как операции, за которые они были начислены, отменены.",
+	},
+	"dormancy.title": {
+		"en": "Account inactivity",
+		"ru": "Неактивность аккаунта",
+	},
+	"dormancy.body": {
+		"en": "Your account has been inactive for a while. Open the app within %d days to keep it active.",
+		"ru": "Ваш аккаунт давно не используется. Откройте приложение в течение %d дн., чтобы сохранить его активным.",
+	},
+	"dormancy.body_close_flexible": {
+		"en": "Your account has been inactive for a while. Open the app within %d days, otherwise your flexible investments will be closed and returned to your balance.",
+		"ru": "Ваш аккаунт давно не используется. Откройте приложение в течение %d дн., иначе ваши гибкие инвестиции будут закрыты, а средства возвращены на баланс.",
+	},
+
+	"bot.error": {
+		"en": "Something went wrong, please try again later.",
+		"ru": "Что-то пошло не так, попробуйте позже.",
+	},
+	"bot.no_account": {
+		"en": "You don't have an account yet. Open the app and connect your wallet to sign up.",
+		"ru": "У вас ещё нет аккаунта. Откройте приложение и подключите кошелёк, чтобы зарегистрироваться.",
+	},
+	"bot.help": {
+		"en": "/start - open the app\n/balance - your balance and investments\n/deposits - status of your latest deposits",
+		"ru": "/start - открыть приложение\n/balance - баланс и инвестиции\n/deposits - статус последних депозитов",
+	},
+	"bot.balance": {
+		"en": "Balance: %s TON\nInvested: %s TON\nEarned: %s TON",
+		"ru": "Баланс: %s TON\nИнвестировано: %s TON\nЗаработано: %s TON",
+	},
+	"bot.vip_tier": {
+		"en": "VIP tier: %s",
+		"ru": "VIP-уровень: %s",
+	},
+	"bot.no_deposits": {
+		"en": "You haven't made any deposits yet.",
+		"ru": "У вас ещё нет депозитов.",
+	},
+	"bot.deposits": {
+		"en": "Your latest deposits:",
+		"ru": "Ваши последние депозиты:",
+	},
+	"bot.deposit_comment": {
+		"en": "comment %s",
+		"ru": "комментарий %s",
+	},
+	"bot.deposit.pending": {
+		"en": "waiting for the transfer",
+		"ru": "ожидает перевода",
+	},
+	"bot.deposit.processing": {
+		"en": "confirming",
+		"ru": "подтверждается",
+	},
+	"bot.deposit.review": {
+		"en": "under review",
+		"ru": "на проверке",
+	},
+	"bot.deposit.completed": {
+		"en": "credited",
+		"ru": "зачислен",
+	},
+	"bot.deposit.failed": {
+		"en": "failed",
+		"ru": "не выполнен",
+	},
+	"bot.deposit.expired": {
+		"en": "expired",
+		"ru": "истёк",
+	},
+	"bot.deposit.cancelled": {
+		"en": "cancelled",
+		"ru": "отменён",
+	},
+}
+
+// locale formats the texts and amounts shown to a user with their language and number
+// format preferences
+type locale model.UserPreferences
+
+// text returns the text of a userTexts key in the user's language, formatted with args.
+// Unknown keys return the key itself.
+func (l locale) text(key string, args ...interface{}) string {
+	texts, ok := userTexts[key]
+	if !ok {
+		return key
+	}
+	format, ok := texts[l.Language]
+	if !ok {
+		format = texts["en"]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// amount formats an amount in the user's number format
+func (l locale) amount(v float64) string {
+	return model.UserPreferences(l).FormatAmount(v)
+}
+
+// userLocale returns the locale of a user, the default preferences when the user can't
+// be loaded
+func (h *Handler) userLocale(userID int) locale {
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		return locale(model.DefaultPreferences)
+	}
+	return locale(user.Preferences)
+}
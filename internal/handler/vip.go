@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// defaultVIPRecalculateInterval is used when vip.recalculate_interval_seconds isn't set
+const defaultVIPRecalculateInterval = time.Hour
+
+// vipTier returns the config of a tier, nil when it isn't configured or the program is off
+func (h *Handler) vipTier(name string) *model.VIPTier {
+	cfg := h.config().VIP
+	if !cfg.Enabled || name == "" {
+		return nil
+	}
+	for i := range cfg.Tiers {
+		if cfg.Tiers[i].Name == name {
+			return &cfg.Tiers[i]
+		}
+	}
+	return nil
+}
+
+// vipTierFor returns the highest tier whose min_invested an amount reaches, or nil
+func (h *Handler) vipTierFor(invested float64) *model.VIPTier {
+	var best *model.VIPTier
+	tiers := h.config().VIP.Tiers
+	for i := range tiers {
+		if invested >= tiers[i].MinInvested && (best == nil || tiers[i].MinInvested > best.MinInvested) {
+			best = &tiers[i]
+		}
+	}
+	return best
+}
+
+// nextVIPTier returns the lowest tier above an amount invested, or nil at the top
+func (h *Handler) nextVIPTier(invested float64) *model.VIPTier {
+	var next *model.VIPTier
+	tiers := h.config().VIP.Tiers
+	for i := range tiers {
+		if tiers[i].MinInvested > invested && (next == nil || tiers[i].MinInvested < next.MinInvested) {
+			next = &tiers[i]
+		}
+	}
+	return next
+}
+
+// vipTerms adds the weekly percent bonus of a tier to the terms of an investment
+func vipTerms(terms model.InvestmentTypeConfig, tier *model.VIPTier) model.InvestmentTypeConfig {
+	if tier != nil {
+		terms.WeeklyPercent += tier.WeeklyPercentBonus
+	}
+	return terms
+}
+
+// vipFeePercent returns the platform fee on profit after the discount of a tier
+func vipFeePercent(feePercent float64, tier *model.VIPTier) float64 {
+	if tier == nil {
+		return feePercent
+	}
+	return feePercent * (1 - tier.FeeDiscountPercent/100.0)
+}
+
+// userVIPTier returns the stored tier of a user, nil without one
+func (h *Handler) userVIPTier(userID int) (*model.VIPTier, error) {
+	if !h.config().VIP.Enabled {
+		return nil, nil
+	}
+	t, err := h.db.GetUserTier(userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.vipTier(t.Tier), nil
+}
+
+// vipStatus returns a user's tier with what it grants and the next one, nil while the
+// program is off
+func (h *Handler) vipStatus(user *model.User) (*model.UserVIPTier, error) {
+	if !h.config().VIP.Enabled {
+		return nil, nil
+	}
+	status := &model.UserVIPTier{Invested: user.CurrentInvestments}
+	t, err := h.db.GetUserTier(user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	threshold := -1.0
+	if t != nil {
+		if tier := h.vipTier(t.Tier); tier != nil {
+			status.Tier, status.UpdatedAt = tier.Name, t.UpdatedAt
+			status.FeeDiscountPercent, status.WeeklyPercentBonus = tier.FeeDiscountPercent, tier.WeeklyPercentBonus
+			threshold = tier.MinInvested
+		}
+	}
+	if next := h.nextVIPTier(threshold); next != nil {
+		status.NextTier, status.NextTierInvested = next.Name, next.MinInvested
+	}
+	return status, nil
+}
+
+// RecalculateVIPTiers ranks every user by the TON in their open investments and stores
+// the tiers that changed. Users reaching a higher tier are notified. Returns the number
+// of users whose tier changed.
+func (h *Handler) RecalculateVIPTiers() (int, error) {
+	totals, err := h.db.GetInvestedTotals()
+	if err != nil {
+		return 0, err
+	}
+	current, err := h.db.GetUserTiers()
+	if err != nil {
+		return 0, err
+	}
+	for userID := range current {
+		if _, ok := totals[userID]; !ok {
+			totals[userID] = 0
+		}
+	}
+
+	changed := 0
+	for userID, invested := range totals {
+		tier := h.vipTierFor(invested)
+		name := ""
+		if tier != nil {
+			name = tier.Name
+		}
+		stored, ok := current[userID]
+		if ok && stored.Tier == name && money.Round(stored.Invested) == money.Round(invested) || !ok && name == "" {
+			continue
+		}
+		if err := h.db.SetUserTier(userID, name, invested); err != nil {
+			return changed, err
+		}
+		if stored.Tier == name {
+			continue
+		}
+		changed++
+
+		previous := h.vipTier(stored.Tier)
+		if tier != nil && (previous == nil || tier.MinInvested > previous.MinInvested) {
+			h.notifyUser(userID, "vip_tier", func(l locale) (string, string) {
+				args := []interface{}{l.amount(invested), tier.Name, tier.FeeDiscountPercent, tier.WeeklyPercentBonus}
+				return l.text("vip_tier.title", args...), l.text("vip_tier.body", args...)
+			})
+		}
+	}
+	return changed, nil
+}
+
+// StartVIPTiers recalculates the tiers every vip.recalculate_interval_seconds while
+// vip.enabled is set
+func (h *Handler) StartVIPTiers(ctx context.Context) {
+	cfg := h.config().VIP
+	if !cfg.Enabled {
+		return
+	}
+	interval := time.Duration(cfg.RecalculateIntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultVIPRecalculateInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := h.RecalculateVIPTiers(); err != nil {
+			slog.Error("Failed to recalculate VIP tiers", "error", err)
+		} else if n > 0 {
+			slog.Info("Recalculated VIP tiers", "changed", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
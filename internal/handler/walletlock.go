@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"tonapp/internal/keystore"
+	"tonapp/internal/model"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errWalletsLocked is returned by the wallets of encrypted mnemonics until they are unlocked
+var errWalletsLocked = errors.New("wallets are locked, unlock them with POST /api/v1/admin/wallet/unlock")
+
+// encryptedMnemonics reports whether the main or a treasury wallet mnemonic is encrypted
+func encryptedMnemonics(cfg model.TONConfig) bool {
+	if keystore.IsEncrypted(cfg.Mnemonic) {
+		return true
+	}
+	for _, w := range cfg.TreasuryWallets {
+		if keystore.IsEncrypted(w.Mnemonic) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockedWallets is the TonClient of a service started with encrypted mnemonics. Every
+// call fails with errWalletsLocked, or returns nothing, until UnlockWallets decrypts the
+// mnemonics and hands over the real client.
+type lockedWallets struct {
+	mu         sync.RWMutex
+	client     TonClient
+	unlockedAt int64
+}
+
+func (l *lockedWallets) get() (TonClient, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.client == nil {
+		return nil, errWalletsLocked
+	}
+	return l.client, nil
+}
+
+// unlocked returns when the wallets were unlocked, 0 while they are locked
+func (l *lockedWallets) unlocked() int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.unlockedAt
+}
+
+func (l *lockedWallets) GetDepositAddress() string {
+	c, err := l.get()
+	if err != nil {
+		return ""
+	}
+	return c.GetDepositAddress()
+}
+
+func (l *lockedWallets) TreasuryWalletNames() []string {
+	c, err := l.get()
+	if err != nil {
+		return nil
+	}
+	return c.TreasuryWalletNames()
+}
+
+func (l *lockedWallets) TreasuryAddress(name string) string {
+	c, err := l.get()
+	if err != nil {
+		return ""
+	}
+	return c.TreasuryAddress(name)
+}
+
+func (l *lockedWallets) DepositWalletAddress(subwalletID uint32) (string, error) {
+	c, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return c.DepositWalletAddress(subwalletID)
+}
+
+func (l *lockedWallets) GenerateWalletAddressFromPubKey(pubKey string) (string, error) {
+	c, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return c.GenerateWalletAddressFromPubKey(pubKey)
+}
+
+func (l *lockedWallets) GetWalletBalance(ctx context.Context, addr string) (float64, error) {
+	c, err := l.get()
+	if err != nil {
+		return 0, err
+	}
+	return c.GetWalletBalance(ctx, addr)
+}
+
+func (l *lockedWallets) JettonBalance(ctx context.Context, master string, owner string, decimals int) (float64, error) {
+	c, err := l.get()
+	if err != nil {
+		return 0, err
+	}
+	return c.JettonBalance(ctx, master, owner, decimals)
+}
+
+func (l *lockedWallets) CheckDeposit(walletAddress string, match ton.DepositMatch, memo string, withinLastMinutes int) (float64, error) {
+	c, err := l.get()
+	if err != nil {
+		return 0, err
+	}
+	return c.CheckDeposit(walletAddress, match, memo, withinLastMinutes)
+}
+
+func (l *lockedWallets) CheckAddressDeposit(walletAddress string, match ton.DepositMatch, since int64) (float64, error) {
+	c, err := l.get()
+	if err != nil {
+		return 0, err
+	}
+	return c.CheckAddressDeposit(walletAddress, match, since)
+}
+
+func (l *lockedWallets) FindArchivedDeposit(ctx context.Context, walletAddress string, match ton.DepositMatch, memo string, since int64, maxPages int) (float64, error) {
+	c, err := l.get()
+	if err != nil {
+		return 0, err
+	}
+	return c.FindArchivedDeposit(ctx, walletAddress, match, memo, since, maxPages)
+}
+
+func (l *lockedWallets) GetTransaction(ctx context.Context, hash string) (*model.ChainTransaction, error) {
+	c, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return c.GetTransaction(ctx, hash)
+}
+
+func (l *lockedWallets) SweepDepositWallet(ctx context.Context, subwalletID uint32, minAmount float64) (float64, string, error) {
+	c, err := l.get()
+	if err != nil {
+		return 0, "", err
+	}
+	return c.SweepDepositWallet(ctx, subwalletID, minAmount)
+}
+
+func (l *lockedWallets) TransferFundsWithSplit(ctx context.Context, amount float64, feeAddress string) error {
+	c, err := l.get()
+	if err != nil {
+		return err
+	}
+	return c.TransferFundsWithSplit(ctx, amount, feeAddress)
+}
+
+func (l *lockedWallets) FetchTransactionsSince(ctx context.Context, walletAddress string, afterLT uint64, limit int) ([]model.ChainTransaction, error) {
+	c, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return c.FetchTransactionsSince(ctx, walletAddress, afterLT, limit)
+}
+
+func (l *lockedWallets) WithdrawFromWallet(ctx context.Context, name string, pubKey string, amount float64) (string, error) {
+	c, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return c.WithdrawFromWallet(ctx, name, pubKey, amount)
+}
+
+func (l *lockedWallets) WithdrawToAddress(ctx context.Context, name string, destination string, amount float64) (string, error) {
+	c, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return c.WithdrawToAddress(ctx, name, destination, amount)
+}
+
+func (l *lockedWallets) WithdrawBatch(ctx context.Context, name string, payouts []ton.Payout) (string, error) {
+	c, err := l.get()
+	if err != nil {
+		return "", err
+	}
+	return c.WithdrawBatch(ctx, name, payouts)
+}
+
+func (l *lockedWallets) SentMessages(ctx context.Context, name string, since int64) ([]ton.SentMessage, error) {
+	c, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return c.SentMessages(ctx, name, since)
+}
+
+func (l *lockedWallets) MaxBatchMessages(name string) int {
+	c, err := l.get()
+	if err != nil {
+		return 0
+	}
+	return c.MaxBatchMessages(name)
+}
+
+func (l *lockedWallets) CheckConnectivity(ctx context.Context) error {
+	c, err := l.get()
+	if err != nil {
+		return err
+	}
+	return c.CheckConnectivity(ctx)
+}
+
+func (l *lockedWallets) BudgetStats() model.ToncenterBudgetStats {
+	c, err := l.get()
+	if err != nil {
+		return model.ToncenterBudgetStats{}
+	}
+	return c.BudgetStats()
+}
+
+var _ TonClient = (*lockedWallets)(nil)
+
+// unlockWallets decrypts the encrypted mnemonics of the config with a passphrase and
+// opens the wallets. The decrypted mnemonics only live in the ton client, the config
+// keeps the encrypted ones.
+func (h *Handler) unlockWallets(passphrase string) error {
+	h.wallets.mu.Lock()
+	defer h.wallets.mu.Unlock()
+	if h.wallets.client != nil {
+		return nil
+	}
+
+	cfg := h.config().TON
+	decrypt := func(field string, mnemonic string) (string, error) {
+		if !keystore.IsEncrypted(mnemonic) {
+			return mnemonic, nil
+		}
+		plain, err := keystore.Decrypt(mnemonic, passphrase)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		return plain, nil
+	}
+
+	var err error
+	if cfg.Mnemonic, err = decrypt("ton.mnemonic", cfg.Mnemonic); err != nil {
+		return err
+	}
+	treasury := make(map[string]model.TreasuryWalletConfig, len(cfg.TreasuryWallets))
+	for name, w := range cfg.TreasuryWallets {
+		if w.Mnemonic, err = decrypt("ton.treasury_wallets."+name+".mnemonic", w.Mnemonic); err != nil {
+			return err
+		}
+		treasury[name] = w
+	}
+	cfg.TreasuryWallets = treasury
+
+	client, err := newTonClient(cfg)
+	if err != nil {
+		return err
+	}
+	h.wallets.client = client
+	h.wallets.unlockedAt = time.Now().Unix()
+	return nil
+}
+
+// warmUpWallets fails while the wallets of encrypted mnemonics are locked
+func (h *Handler) warmUpWallets(ctx context.Context) error {
+	if h.wallets == nil {
+		return nil
+	}
+	_, err := h.wallets.get()
+	return err
+}
+
+// UnlockWallets decrypts the encrypted wallet mnemonics with the passphrase of the
+// request, after a start with ton.mnemonic or a treasury mnemonic encrypted (admin only)
+func (h *Handler) UnlockWallets(c *gin.Context) {
+	if h.wallets == nil {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "wallet mnemonics aren't encrypted",
+		})
+		return
+	}
+	var req model.UnlockWalletsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if _, err := h.wallets.get(); err == nil {
+		c.JSON(http.StatusConflict, model.Response{
+			Success: false,
+			Error:   "wallets are already unlocked",
+		})
+		return
+	}
+
+	err := h.unlockWallets(req.Passphrase)
+	if errors.Is(err, keystore.ErrWrongPassphrase) {
+		slog.WarnContext(c.Request.Context(), "Wallet unlock failed", "client_ip", c.ClientIP(), "error", err)
+		c.JSON(http.StatusForbidden, model.Response{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to unlock wallets", "error", err)
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to unlock wallets: %v", err),
+		})
+		return
+	}
+
+	names := h.ton.TreasuryWalletNames()
+	sort.Strings(names)
+	slog.InfoContext(c.Request.Context(), "Wallets unlocked", "client_ip", c.ClientIP(), "treasury_wallets", names)
+	status := model.WalletUnlock{
+		Unlocked:        true,
+		UnlockedAt:      h.wallets.unlocked(),
+		DepositAddress:  h.ton.GetDepositAddress(),
+		TreasuryWallets: names,
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    status,
+	})
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Purposes a signature challenge can be issued for
+	ChallengePurposeAPIToken   = "api_token"
+	ChallengePurposeWithdrawal = "withdrawal"
+
+	challengeTTL = 5 * time.Minute
+)
+
+var challengePurposes = map[string]bool{
+	ChallengePurposeAPIToken:       true,
+	ChallengePurposeAccountClosure: true,
+	ChallengePurposeWithdrawal:     true,
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// issueChallenge creates a single-use message the user has to sign with their wallet key
+func (h *Handler) issueChallenge(userID int, purpose string, details string) (*model.SignatureChallenge, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(challengeTTL).Unix()
+	ch := &model.SignatureChallenge{
+		Nonce:     nonce,
+		UserID:    userID,
+		Purpose:   purpose,
+		Message:   challengeMessage(purpose, details, nonce, expiresAt),
+		ExpiresAt: expiresAt,
+	}
+	if err := h.db.CreateSignatureChallenge(ch); err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// challengeMessage returns the message signed for a challenge, details being what the
+// challenge confirms, if anything
+func challengeMessage(purpose, details, nonce string, expiresAt int64) string {
+	if details != "" {
+		return fmt.Sprintf("tonapp:%s:%s:%s:%d", purpose, details, nonce, expiresAt)
+	}
+	return fmt.Sprintf("tonapp:%s:%s:%d", purpose, nonce, expiresAt)
+}
+
+// withdrawalChallengeDetails are the details of a withdrawal challenge: the amount and
+// the saved address it is sent to, if not the user's wallet. Destinations are signed in
+// raw form, so any form of the address matches.
+func withdrawalChallengeDetails(amount float64, addressBookID int64, destination string) string {
+	details := money.FormatFixed(amount)
+	if addressBookID != 0 {
+		details += fmt.Sprintf(":address_book:%d", addressBookID)
+	}
+	if destination != "" {
+		if raw, err := ton.RawAddress(destination); err == nil {
+			destination = raw
+		}
+		details += ":destination:" + destination
+	}
+	return details
+}
+
+// verifyChallenge consumes a challenge and checks its signature against the user's pub_key
+func (h *Handler) verifyChallenge(user *model.User, purpose, nonce, signatureHex string) (*model.SignatureChallenge, error) {
+	ch, err := h.db.ConsumeSignatureChallenge(nonce, user.ID, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyWalletSignature(user.PubKey, []byte(ch.Message), signatureHex); err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// confirmWithdrawal checks the wallet signature of a withdrawal challenge issued for the
+// amount and destination of the request, so a session token alone can't withdraw, and
+// responds itself if it doesn't match
+func (h *Handler) confirmWithdrawal(c *gin.Context, user *model.User, req model.WithdrawalRequest) bool {
+	ch, err := h.verifyChallenge(user, ChallengePurposeWithdrawal, req.Nonce, req.Signature)
+	if err == nil && ch.Message != challengeMessage(ch.Purpose, withdrawalChallengeDetails(req.Amount, req.AddressBookID, req.Destination), ch.Nonce, ch.ExpiresAt) {
+		err = fmt.Errorf("challenge was issued for a different amount or destination")
+	}
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Withdrawal not confirmed by the wallet", "user_id", user.ID, "amount", req.Amount, "error", err)
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    model.ErrorWithdrawalUnconfirmed,
+		})
+		return false
+	}
+	return true
+}
+
+// verifyWalletSignature checks an ed25519 signature made with the key of a hex encoded public key
+func verifyWalletSignature(pubKeyHex string, message []byte, signatureHex string) error {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("pub_key is not a hex encoded ed25519 public key")
+	}
+
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature format")
+	}
+
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), message, signature) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// CreateChallenge issues a message to be signed by the user's wallet key
+func (h *Handler) CreateChallenge(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(c.Param("pub_key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+
+	var req model.ChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	if !challengePurposes[req.Purpose] {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "unknown challenge purpose",
+		})
+		return
+	}
+
+	details := ""
+	if req.Purpose == ChallengePurposeWithdrawal {
+		if req.Amount <= 0 || req.AddressBookID < 0 {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "withdrawal challenges need the amount of the withdrawal",
+			})
+			return
+		}
+		if _, err := ton.RawAddress(req.Destination); req.Destination != "" && err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "invalid destination address",
+			})
+			return
+		}
+		details = withdrawalChallengeDetails(req.Amount, req.AddressBookID, req.Destination)
+	}
+
+	ch, err := h.issueChallenge(user.ID, req.Purpose, details)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to create challenge",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    ch,
+	})
+}
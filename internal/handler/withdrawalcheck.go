@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckWithdrawal runs the validation of POST /users/withdraw for a user and amount
+// without sending or reserving anything, and returns the outcome of every check, e.g.
+// to answer why a user can't withdraw (admin only)
+func (h *Handler) CheckWithdrawal(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid user ID",
+		})
+		return
+	}
+	var req model.WithdrawalCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+
+	user, err := h.db.GetUser(userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get user",
+		})
+		return
+	}
+
+	result, err := h.checkWithdrawal(c.Request.Context(), user, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   fmt.Sprintf("failed to check withdrawal: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// checkWithdrawal evaluates the checks of WithdrawFunds in its order. Unlike the
+// withdrawal it doesn't stop at the first failure, so every reason is reported.
+// Keep it in line with WithdrawFunds.
+func (h *Handler) checkWithdrawal(ctx context.Context, user *model.User, req model.WithdrawalCheckRequest) (*model.WithdrawalCheckResult, error) {
+	result := &model.WithdrawalCheckResult{UserID: user.ID, Amount: req.Amount}
+	check := func(name string, passed bool, detail string) {
+		result.Checks = append(result.Checks, model.WithdrawalCheck{Name: name, Passed: passed, Detail: detail})
+	}
+
+	frozen := "account isn't frozen"
+	if user.FrozenAt != nil {
+		frozen = "account was frozen by an admin at " + time.Unix(*user.FrozenAt, 0).UTC().Format(time.RFC3339)
+	}
+	check("not_frozen", user.FrozenAt == nil, frozen)
+
+	deposits, err := h.db.GetDepositsOfUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	depositTotal, uncompleted := 0.0, 0
+	for _, d := range deposits {
+		if d.Status == "completed" {
+			depositTotal += d.Amount
+		} else {
+			uncompleted++
+		}
+	}
+	check("deposits_completed", uncompleted == 0, fmt.Sprintf("%d uncompleted deposit requests", uncompleted))
+
+	withdrawals, err := h.db.GetWithdrawalRequestsByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	withdrawalTotal, uncompleted := 0.0, 0
+	for _, w := range withdrawals {
+		if w.Status == "completed" {
+			withdrawalTotal += w.Amount
+		} else {
+			uncompleted++
+		}
+	}
+	check("withdrawals_completed", uncompleted == 0, fmt.Sprintf("%d uncompleted withdrawal requests", uncompleted))
+
+	available := money.Round(depositTotal - money.RoundFee(depositTotal*0.2) - withdrawalTotal)
+	check("available_balance", available >= req.Amount, fmt.Sprintf("%s TON of %s TON deposited after the 20%% fee and %s TON withdrawn",
+		money.Format(available), money.Format(depositTotal), money.Format(withdrawalTotal)))
+	check("balance", user.Balance >= req.Amount, fmt.Sprintf("balance is %s TON", money.Format(user.Balance)))
+
+	now := time.Now()
+	limits, err := h.withdrawalLimits(user.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWithdrawalAmount(limits, req.Amount); err != nil {
+		check("limits", false, err.Error())
+	} else {
+		check("limits", true, "within the withdrawal limits")
+	}
+	if err := checkWithdrawalCooldown(limits, now); err != nil {
+		check("cooldown", false, err.Error())
+	} else {
+		check("cooldown", true, "no withdrawal cooldown running")
+	}
+
+	if req.AddressBookID != 0 || req.Destination != "" {
+		_, invalidDestination := ton.RawAddress(req.Destination)
+		var entry *model.AddressBookEntry
+		var err error
+		switch {
+		case req.AddressBookID != 0 && req.Destination != "":
+			check("address_book", false, "either address_book_id or destination is sent")
+		case req.Destination != "" && invalidDestination != nil:
+			check("address_book", false, "invalid destination address")
+		case req.Destination != "":
+			entry, err = h.addressBookEntryByAddress(user.ID, req.Destination)
+		default:
+			entry, err = h.db.GetAddressBookEntry(user.ID, req.AddressBookID)
+		}
+		switch {
+		case err == sql.ErrNoRows && req.Destination != "":
+			check("address_book", false, "destination is not in the address book")
+		case err == sql.ErrNoRows:
+			check("address_book", false, "address book entry not found")
+		case err != nil:
+			return nil, err
+		case entry != nil:
+			e := h.addressBookEntry(*entry)
+			withdrawable := time.Now().Unix() >= e.WithdrawableAt
+			check("address_book", withdrawable, fmt.Sprintf("%q is withdrawable from %s",
+				e.Label, time.Unix(e.WithdrawableAt, 0).UTC().Format(time.RFC3339)))
+		}
+	}
+
+	// A wallet short of funds only queues the withdrawal, unless the queue is off. Held
+	// and batched withdrawals are checked against the wallet when they are sent.
+	wallet := h.withdrawalWallet(user.ID, req.Amount)
+	result.Wallet = treasuryWalletLabel(wallet)
+	later := ""
+	if h.requiresApproval(req.Amount) {
+		later = ", checked again when an admin approves the withdrawal"
+	} else if h.shouldBatchWithdrawal(req.Amount) {
+		later = ", checked again when the batch is sent"
+	}
+	balance, err := h.ton.GetWalletBalance(ctx, h.ton.TreasuryAddress(wallet))
+	if err != nil {
+		check("treasury_liquidity", false, fmt.Sprintf("failed to get the %s wallet balance: %v", result.Wallet, err))
+	} else {
+		covered := balance-h.config().Liquidity.MinHotWalletReserve >= req.Amount
+		detail := fmt.Sprintf("%s wallet holds %s TON, %s TON of it reserved", result.Wallet,
+			money.Format(balance), money.Format(h.config().Liquidity.MinHotWalletReserve))
+		if !covered && later == "" && h.config().Liquidity.QueueEnabled {
+			detail += ", the withdrawal would wait in the liquidity queue"
+		}
+		check("treasury_liquidity", covered || later != "" || h.config().Liquidity.QueueEnabled, detail+later)
+	}
+
+	result.Allowed = true
+	for _, c := range result.Checks {
+		result.Allowed = result.Allowed && c.Passed
+	}
+	switch {
+	case !result.Allowed:
+		result.Outcome = "rejected"
+	case h.requiresApproval(req.Amount):
+		result.Outcome = model.WithdrawalStatusPendingApproval
+	case h.shouldBatchWithdrawal(req.Amount):
+		result.Outcome = model.QueueStatusBatched
+	case h.shouldQueueWithdrawal(ctx, wallet, req.Amount):
+		result.Outcome = model.QueueStatusQueued
+	default:
+		result.Outcome = "sent"
+	}
+	return result, nil
+}
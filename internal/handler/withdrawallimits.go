@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withdrawalLimits returns the bounds of a user's withdrawals, those of withdrawal_limits
+// with the fields an admin overrode, what the user withdrew since midnight UTC and when
+// the cooldown of the last withdrawal ends
+func (h *Handler) withdrawalLimits(userID int, now time.Time) (model.UserWithdrawalLimits, error) {
+	cfg := h.config().WithdrawalLimits
+	limits := model.UserWithdrawalLimits{MinAmount: cfg.MinAmount, MaxAmount: cfg.MaxAmount, DailyAmount: cfg.DailyAmount, CooldownHours: cfg.CooldownHours}
+
+	override, err := h.db.GetWithdrawalLimitOverride(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return limits, err
+	}
+	if override != nil {
+		limits.Overridden = true
+		if override.MinAmount != nil {
+			limits.MinAmount = *override.MinAmount
+		}
+		if override.MaxAmount != nil {
+			limits.MaxAmount = *override.MaxAmount
+		}
+		if override.DailyAmount != nil {
+			limits.DailyAmount = *override.DailyAmount
+		}
+	}
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	limits.ResetsAt = day.Add(24 * time.Hour).Unix()
+	withdrawn, err := h.db.GetUserWithdrawnSince(userID, day.Unix())
+	if err != nil {
+		return limits, err
+	}
+	limits.WithdrawnToday = money.Round(withdrawn)
+	if limits.DailyAmount > 0 {
+		remaining := money.Round(limits.DailyAmount - limits.WithdrawnToday)
+		if remaining < 0 {
+			remaining = 0
+		}
+		limits.RemainingToday = &remaining
+	}
+
+	if limits.CooldownHours > 0 {
+		last, err := h.db.GetUserLastWithdrawalAt(userID)
+		if err != nil {
+			return limits, err
+		}
+		if next := last + int64(limits.CooldownHours)*3600; last > 0 && next > now.Unix() {
+			limits.NextWithdrawalAt = next
+		}
+	}
+	return limits, nil
+}
+
+// checkWithdrawalAmount returns why an amount is out of a user's withdrawal limits, or nil
+func checkWithdrawalAmount(limits model.UserWithdrawalLimits, amount float64) error {
+	if amount < limits.MinAmount {
+		return fmt.Errorf("withdrawals must be at least %s TON", money.Format(limits.MinAmount))
+	}
+	if limits.MaxAmount > 0 && amount > limits.MaxAmount {
+		return fmt.Errorf("withdrawals can be at most %s TON", money.Format(limits.MaxAmount))
+	}
+	if limits.RemainingToday != nil && amount > *limits.RemainingToday {
+		return fmt.Errorf("daily withdrawal limit is %s TON, %s TON left today, resets at %s",
+			money.Format(limits.DailyAmount), money.Format(*limits.RemainingToday),
+			time.Unix(limits.ResetsAt, 0).UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkWithdrawalCooldown returns how long a user still waits for the cooldown of the
+// last withdrawal, or nil
+func checkWithdrawalCooldown(limits model.UserWithdrawalLimits, now time.Time) error {
+	if limits.NextWithdrawalAt == 0 {
+		return nil
+	}
+	wait := time.Unix(limits.NextWithdrawalAt, 0).Sub(now).Round(time.Minute)
+	if wait < time.Minute {
+		wait = time.Minute
+	}
+	return fmt.Errorf("one withdrawal per %dh, the next one is possible in %s, at %s", limits.CooldownHours,
+		wait, time.Unix(limits.NextWithdrawalAt, 0).UTC().Format(time.RFC3339))
+}
+
+// withdrawalCaps returns the daily limit and cooldown of limits for the store to check
+// again when it reserves the withdrawal
+func withdrawalCaps(limits model.UserWithdrawalLimits, now time.Time) model.WithdrawalCaps {
+	caps := model.WithdrawalCaps{DailyAmount: limits.DailyAmount, DayStart: limits.ResetsAt - 24*3600}
+	if limits.CooldownHours > 0 {
+		caps.CooldownSince = now.Unix() - int64(limits.CooldownHours)*3600
+	}
+	return caps
+}
+
+// checkUserWithdrawal responds with 429 during the user's withdrawal cooldown and with
+// 400 when an amount is out of the user's withdrawal limits, and returns false then.
+// Otherwise it returns the caps to reserve the withdrawal with.
+func (h *Handler) checkUserWithdrawal(c *gin.Context, userID int, amount float64) (model.WithdrawalCaps, bool) {
+	now := time.Now()
+	limits, err := h.withdrawalLimits(userID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal limits",
+		})
+		return model.WithdrawalCaps{}, false
+	}
+	if err := checkWithdrawalCooldown(limits, now); err != nil {
+		c.Header("Retry-After", strconv.FormatInt(limits.NextWithdrawalAt-now.Unix(), 10))
+		c.JSON(http.StatusTooManyRequests, model.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    model.ErrorWithdrawalCooldown,
+		})
+		return model.WithdrawalCaps{}, false
+	}
+	if err := checkWithdrawalAmount(limits, amount); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   err.Error(),
+			Code:    model.ErrorWithdrawalLimit,
+		})
+		return model.WithdrawalCaps{}, false
+	}
+	return withdrawalCaps(limits, now), true
+}
+
+// respondReserveError responds to a withdrawal the store couldn't reserve. A withdrawal
+// rejected by its caps lost the race against a concurrent one of the user, which
+// checkUserWithdrawal now sees.
+func (h *Handler) respondReserveError(c *gin.Context, userID int, amount float64, err error, message string) {
+	if errors.Is(err, model.ErrDailyWithdrawalLimitReached) || errors.Is(err, model.ErrWithdrawalCooldownActive) {
+		if _, ok := h.checkUserWithdrawal(c, userID, amount); ok {
+			c.JSON(http.StatusConflict, model.Response{
+				Success: false,
+				Error:   fmt.Sprintf("%s: %v, try again", message, err),
+			})
+		}
+		return
+	}
+	c.JSON(http.StatusInternalServerError, model.Response{
+		Success: false,
+		Error:   fmt.Sprintf("%s: %v", message, err),
+	})
+}
+
+// GetUserWithdrawalLimits returns the withdrawal limits of a user and the override an
+// admin set, if any (admin only)
+func (h *Handler) GetUserWithdrawalLimits(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+	h.respondWithdrawalLimits(c, userID)
+}
+
+// SetUserWithdrawalLimits overrides the withdrawal limits of a user, e.g. to raise them
+// for a known large holder. Omitted fields keep the limit of the config, 0 lifts it
+// (admin only).
+func (h *Handler) SetUserWithdrawalLimits(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+	var req model.SetWithdrawalLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid request body",
+		})
+		return
+	}
+	for _, v := range []*float64{req.MinAmount, req.MaxAmount, req.DailyAmount} {
+		if v != nil && *v < 0 {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Success: false,
+				Error:   "limits must not be negative",
+			})
+			return
+		}
+	}
+
+	o, err := h.db.SetWithdrawalLimitOverride(model.WithdrawalLimitOverride{
+		UserID:      userID,
+		MinAmount:   req.MinAmount,
+		MaxAmount:   req.MaxAmount,
+		DailyAmount: req.DailyAmount,
+		Note:        req.Note,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to set withdrawal limits",
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Withdrawal limits overridden", "user_id", userID, "note", o.Note, "admin_key", c.GetString(contextAdminKey))
+	h.respondWithdrawalLimits(c, userID)
+}
+
+// DeleteUserWithdrawalLimits returns a user to the withdrawal limits of the config (admin only)
+func (h *Handler) DeleteUserWithdrawalLimits(c *gin.Context) {
+	userID, ok := h.verificationUser(c)
+	if !ok {
+		return
+	}
+	if err := h.db.DeleteWithdrawalLimitOverride(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to delete withdrawal limits",
+		})
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "Withdrawal limits override removed", "user_id", userID, "admin_key", c.GetString(contextAdminKey))
+	h.respondWithdrawalLimits(c, userID)
+}
+
+func (h *Handler) respondWithdrawalLimits(c *gin.Context, userID int) {
+	override, err := h.db.GetWithdrawalLimitOverride(userID)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	var limits model.UserWithdrawalLimits
+	if err == nil {
+		limits, err = h.withdrawalLimits(userID, time.Now())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal limits",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data: gin.H{
+			"override":          override,
+			"withdrawal_limits": limits,
+		},
+	})
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of withdrawal_retry
+const (
+	defaultWithdrawalMaxAttempts  = 5
+	defaultWithdrawalBackoff      = 30 * time.Second
+	defaultWithdrawalMaxBackoff   = time.Hour
+	defaultWithdrawalStuckMinutes = 10
+)
+
+const (
+	// withdrawalReconcileAfter is how long an entry is sending before its transfer is
+	// looked up on chain. Wallet messages expire after 3 minutes, so a transfer that isn't
+	// found by then was never sent.
+	withdrawalReconcileAfter = 5 * time.Minute
+	// withdrawalClockSkew is how much earlier than the attempt a found transfer may be dated
+	withdrawalClockSkew = time.Minute
+)
+
+// withdrawalRetryDelay returns how long a withdrawal waits after its nth failed attempt:
+// backoff_seconds, doubled per attempt up to max_backoff_seconds
+func withdrawalRetryDelay(cfg model.WithdrawalRetryConfig, attempt int) time.Duration {
+	delay := time.Duration(cfg.BackoffSeconds) * time.Second
+	if delay <= 0 {
+		delay = defaultWithdrawalBackoff
+	}
+	limit := time.Duration(cfg.MaxBackoffSeconds) * time.Second
+	if limit <= 0 {
+		limit = defaultWithdrawalMaxBackoff
+	}
+	for i := 1; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// retryWithdrawal handles a failed transfer of a queue entry being sent. Until
+// withdrawal_retry.max_attempts the entry goes back to status and waits for the backoff,
+// after that it fails and the reserved amount is refunded. A transfer that may have been
+// broadcast isn't retried: the entry stays sending until ReconcileWithdrawals found out.
+func (h *Handler) retryWithdrawal(ctx context.Context, w model.QueuedWithdrawal, status string, sendErr error) {
+	if errors.Is(sendErr, ton.ErrTransferUnconfirmed) {
+		slog.WarnContext(ctx, "Withdrawal transfer unconfirmed, looking it up on chain later", "withdrawal_id", w.ID, "user_id", w.UserID,
+			"amount", money.Format(w.Amount), "wallet", treasuryWalletLabel(w.TreasuryWallet), "error", sendErr)
+		if err := h.db.RecordQueuedWithdrawalError(w.ID, sendErr.Error()); err != nil {
+			slog.ErrorContext(ctx, "Failed to record unconfirmed withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+		}
+		return
+	}
+
+	cfg := h.config().WithdrawalRetry
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultWithdrawalMaxAttempts
+	}
+
+	// w was read before StartQueuedWithdrawalAttempt counted the attempt that failed
+	attempt := w.Attempts + 1
+	if attempt < maxAttempts {
+		next := time.Now().Add(withdrawalRetryDelay(cfg, attempt))
+		if err := h.db.RetryQueuedWithdrawal(w.ID, status, sendErr.Error(), next.Unix()); err != nil {
+			slog.ErrorContext(ctx, "Failed to schedule withdrawal retry", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+			return
+		}
+		slog.WarnContext(ctx, "Withdrawal transfer failed, retrying", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount),
+			"attempt", attempt, "next_attempt_at", next.UTC().Format(time.RFC3339), "error", sendErr)
+		h.publishQueuedWithdrawal(w, status, "")
+		return
+	}
+
+	slog.ErrorContext(ctx, "Failed to send withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "attempts", attempt, "error", sendErr)
+	if err := h.db.FailQueuedWithdrawal(w, sendErr.Error()); err != nil {
+		slog.ErrorContext(ctx, "Failed to refund withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+		return
+	}
+	h.notifyWithdrawalFailed(w.UserID, w.Amount)
+	h.publishQueuedWithdrawal(w, model.QueueStatusFailed, "")
+}
+
+// ReconcileWithdrawals looks up the transfers of entries sending for longer than
+// withdrawalReconcileAfter in the transactions of their wallet. An entry whose transfer
+// is found is completed with its hash, the others weren't sent and are retried. Entries
+// stay sending while the transactions of their wallet can't be read. Returns the number
+// of entries resolved.
+func (h *Handler) ReconcileWithdrawals(ctx context.Context) (int, error) {
+	entries, err := h.db.GetAttemptedWithdrawals()
+	if err != nil {
+		return 0, err
+	}
+
+	before := time.Now().Add(-withdrawalReconcileAfter).Unix()
+	var wallets []string
+	stale := make(map[string][]model.QueuedWithdrawal)
+	for _, w := range entries {
+		if w.Status != model.QueueStatusSending || w.LastAttemptAt >= before {
+			continue
+		}
+		if _, ok := stale[w.TreasuryWallet]; !ok {
+			wallets = append(wallets, w.TreasuryWallet)
+		}
+		stale[w.TreasuryWallet] = append(stale[w.TreasuryWallet], w)
+	}
+
+	resolved := 0
+	for _, wallet := range wallets {
+		group := stale[wallet]
+		since := group[0].LastAttemptAt
+		for _, w := range group {
+			since = min(since, w.LastAttemptAt)
+		}
+		messages, err := h.ton.SentMessages(ctx, wallet, since-int64(withdrawalClockSkew/time.Second))
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to look up withdrawal transfers", "wallet", treasuryWalletLabel(wallet), "count", len(group), "error", err)
+			continue
+		}
+
+		matched := make(map[int]bool)
+		for _, w := range group {
+			n, err := h.findWithdrawalTransfer(w, messages, matched)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to reconcile withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "error", err)
+				continue
+			}
+			resolved++
+			if n < 0 {
+				// Counted by StartQueuedWithdrawalAttempt already, retryWithdrawal counts it again
+				w.Attempts--
+				h.retryWithdrawal(ctx, w, model.QueueStatusProcessing,
+					fmt.Errorf("transfer not found in the transactions of %s", treasuryWalletLabel(wallet)))
+				continue
+			}
+
+			matched[n] = true
+			txHash := messages[n].TxHash
+			slog.InfoContext(ctx, "Unconfirmed withdrawal found on chain", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "tx_hash", txHash)
+			if err := h.db.CompleteQueuedWithdrawal(w, txHash); err != nil {
+				slog.ErrorContext(ctx, "Failed to complete withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "tx_hash", txHash, "error", err)
+				continue
+			}
+			h.notifyWithdrawalSent(w.UserID, w.Amount, txHash)
+			h.publishQueuedWithdrawal(w, model.QueueStatusSent, txHash)
+		}
+	}
+	return resolved, nil
+}
+
+// findWithdrawalTransfer returns the index of the message not matched yet that sent a
+// queue entry, -1 if none did
+func (h *Handler) findWithdrawalTransfer(w model.QueuedWithdrawal, messages []ton.SentMessage, matched map[int]bool) (int, error) {
+	destination := w.Destination
+	if destination == "" {
+		addr, err := h.ton.GenerateWalletAddressFromPubKey(w.PubKey)
+		if err != nil {
+			return 0, err
+		}
+		destination = addr
+	}
+	raw, err := ton.RawAddress(destination)
+	if err != nil {
+		return 0, err
+	}
+
+	attemptedAt := w.LastAttemptAt - int64(withdrawalClockSkew/time.Second)
+	for n, m := range messages {
+		if matched[n] || m.Utime < attemptedAt || money.ToNano(m.Amount) != money.ToNano(w.Amount) {
+			continue
+		}
+		if to, err := ton.RawAddress(m.Destination); err == nil && to == raw {
+			return n, nil
+		}
+	}
+	return -1, nil
+}
+
+// GetWithdrawalTransfers lists the open withdrawals waiting to retry a failed transfer
+// and those sending for longer than withdrawal_retry.stuck_after_minutes, which a
+// restart or a hung wallet call left behind (admin only)
+func (h *Handler) GetWithdrawalTransfers(c *gin.Context) {
+	entries, err := h.db.GetAttemptedWithdrawals()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal transfers",
+		})
+		return
+	}
+
+	stuckMinutes := h.config().WithdrawalRetry.StuckAfterMinutes
+	if stuckMinutes <= 0 {
+		stuckMinutes = defaultWithdrawalStuckMinutes
+	}
+	stuckBefore := time.Now().Add(-time.Duration(stuckMinutes) * time.Minute).Unix()
+
+	transfers := model.WithdrawalTransfers{
+		Retrying: make([]model.QueuedWithdrawal, 0),
+		Stuck:    make([]model.QueuedWithdrawal, 0),
+	}
+	for _, w := range entries {
+		switch {
+		case w.Status != model.QueueStatusSending:
+			transfers.Retrying = append(transfers.Retrying, w)
+		case w.LastAttemptAt < stuckBefore:
+			transfers.Stuck = append(transfers.Stuck, w)
+		}
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    transfers,
+	})
+}
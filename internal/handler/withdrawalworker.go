@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// withdrawalWorkerInterval is how often the worker looks for processing withdrawals
+	// it wasn't woken for, such as those whose retry backoff ended, and reconciles those
+	// sending for longer than withdrawalReconcileAfter
+	withdrawalWorkerInterval = 10 * time.Second
+	// withdrawalWorkerBatch bounds the withdrawals sent per run, the rest follow right after
+	withdrawalWorkerBatch = 20
+)
+
+// withdrawalWorker wakes the withdrawal worker when a withdrawal is requested
+type withdrawalWorker struct {
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+func (w *withdrawalWorker) wakeChan() chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wake == nil {
+		w.wake = make(chan struct{}, 1)
+	}
+	return w.wake
+}
+
+func (w *withdrawalWorker) notify() {
+	select {
+	case w.wakeChan() <- struct{}{}:
+	default:
+	}
+}
+
+// StartWithdrawalWorker sends the withdrawals POST /users/withdraw accepted, so the
+// request doesn't wait for the wallet and the chain. Its first run right at startup sends
+// the withdrawals that were still processing on shutdown and reconciles those a restart
+// left sending: it can't tell whether their transfer left the wallet before.
+func (h *Handler) StartWithdrawalWorker(ctx context.Context) {
+	ticker := time.NewTicker(withdrawalWorkerInterval)
+	defer ticker.Stop()
+	wake := h.withdrawalWorker.wakeChan()
+	h.withdrawalWorker.notify()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+
+		if _, err := h.ReconcileWithdrawals(context.WithoutCancel(ctx)); err != nil {
+			slog.Error("Failed to reconcile withdrawals", "error", err)
+		}
+
+		// Withdrawals already being sent finish on shutdown, the others wait for the restart
+		n, err := h.ProcessWithdrawals(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.Error("Failed to process withdrawals", "error", err)
+			continue
+		}
+		if n == withdrawalWorkerBatch {
+			h.withdrawalWorker.notify()
+		}
+	}
+}
+
+// ProcessWithdrawals sends the oldest processing withdrawals; those of frozen accounts
+// wait until they are unfrozen. Those the wallet can't cover, or that would pass earlier
+// ones of the liquidity queue, move to that queue when it is enabled; other failed
+// transfers are retried with a backoff. Returns the number of withdrawals handled.
+func (h *Handler) ProcessWithdrawals(ctx context.Context) (int, error) {
+	entries, err := h.db.GetProcessingWithdrawals(withdrawalWorkerBatch)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	handled := 0
+	for _, w := range entries {
+		handled++
+
+		w.TreasuryWallet = h.withdrawalWallet(w.UserID, w.Amount)
+		if h.shouldQueueWithdrawal(ctx, w.TreasuryWallet, w.Amount) {
+			if err := h.db.SetQueuedWithdrawalStatus(w.ID, model.QueueStatusProcessing, model.QueueStatusQueued); err != nil {
+				return handled, err
+			}
+			h.publishQueuedWithdrawal(w, model.QueueStatusQueued, "")
+			continue
+		}
+
+		if err := h.db.StartQueuedWithdrawalAttempt(w.ID, model.QueueStatusProcessing, w.TreasuryWallet); err != nil {
+			return handled, err
+		}
+		h.publishQueuedWithdrawal(w, model.QueueStatusSending, "")
+
+		txHash, err := h.sendWithdrawal(ctx, w.TreasuryWallet, w.PubKey, w.Destination, w.Amount)
+		if errors.Is(err, ton.ErrInsufficientWalletBalance) && h.config().Liquidity.QueueEnabled {
+			if err := h.db.SetQueuedWithdrawalStatus(w.ID, model.QueueStatusSending, model.QueueStatusQueued); err != nil {
+				return handled, err
+			}
+			h.publishQueuedWithdrawal(w, model.QueueStatusQueued, "")
+			continue
+		}
+		if err != nil {
+			h.retryWithdrawal(ctx, w, model.QueueStatusProcessing, err)
+			continue
+		}
+
+		if err := h.db.CompleteQueuedWithdrawal(w, txHash); err != nil {
+			slog.ErrorContext(ctx, "Failed to complete withdrawal", "withdrawal_id", w.ID, "user_id", w.UserID, "amount", money.Format(w.Amount), "tx_hash", txHash, "error", err)
+		}
+		h.notifyWithdrawalSent(w.UserID, w.Amount, txHash)
+		h.publishQueuedWithdrawal(w, model.QueueStatusSent, txHash)
+	}
+	return handled, nil
+}
+
+// GetUserWithdrawal returns the status of a withdrawal of the user, and its tx_hash once
+// sent. The ID is the one POST /users/withdraw returned; withdrawals held for approval
+// are looked up with ?source=approval.
+func (h *Handler) GetUserWithdrawal(c *gin.Context) {
+	user, err := h.db.GetUserByPubKey(h.pubKeyParam(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "user not found",
+			Code:    model.ErrorUserNotFound,
+		})
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "invalid withdrawal ID",
+		})
+		return
+	}
+
+	var withdrawal interface{}
+	switch c.DefaultQuery("source", "queue") {
+	case "queue":
+		var w *model.QueuedWithdrawal
+		if w, err = h.db.GetQueuedWithdrawal(id); err == nil && w.UserID == user.ID {
+			if w.Status == model.QueueStatusBatched && h.config().WithdrawalBatching.Enabled {
+				w.ScheduledAt = h.nextBatchAt(time.Now()).Unix()
+			}
+			withdrawal = w
+		}
+	case "approval":
+		var w *model.HeldWithdrawal
+		if w, err = h.db.GetHeldWithdrawal(id); err == nil && w.UserID == user.ID {
+			w.PubKey = ""
+			withdrawal = w
+		}
+	default:
+		c.JSON(http.StatusBadRequest, model.Response{
+			Success: false,
+			Error:   "source must be queue or approval",
+		})
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Success: false,
+			Error:   "failed to get withdrawal",
+		})
+		return
+	}
+	if withdrawal == nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Success: false,
+			Error:   "withdrawal not found",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Success: true,
+		Data:    withdrawal,
+	})
+}
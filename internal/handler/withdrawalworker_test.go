@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"tonapp/internal/model"
+)
+
+func TestProcessWithdrawalsSkipsFrozenAccounts(t *testing.T) {
+	h, store, fake := newTestHandler(t)
+
+	// More withdrawals of frozen accounts than one run picks up, ahead of the others
+	for i := 0; i < withdrawalWorkerBatch+5; i++ {
+		user, _ := newTestUser(t, store)
+		fundUser(t, store, user.ID, 10)
+		if _, err := store.ProcessWithdrawal(user.ID, 5, "", model.WithdrawalCaps{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.SetUserFrozen(user.ID, true, "investigation"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, _ := newTestUser(t, store)
+	fundUser(t, store, user.ID, 10)
+	w, err := store.ProcessWithdrawal(user.ID, 5, "", model.WithdrawalCaps{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent, err := h.ProcessWithdrawals(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("ProcessWithdrawals = %d, %v, want 1 sent", sent, err)
+	}
+	transfers := fake.Transfers()
+	wallet, _ := fake.GenerateWalletAddressFromPubKey(user.PubKey)
+	if len(transfers) != 1 || transfers[0].To != wallet {
+		t.Fatalf("transfers = %+v, want one to %s", transfers, wallet)
+	}
+	queued, err := store.GetQueuedWithdrawal(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued.Status != model.QueueStatusSent {
+		t.Errorf("withdrawal is %s, want %s", queued.Status, model.QueueStatusSent)
+	}
+}
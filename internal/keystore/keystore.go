@@ -0,0 +1,119 @@
+// Package keystore encrypts wallet mnemonics at rest.
+//
+// An encrypted mnemonic is Prefix followed by the base64 of a random salt, an AES-GCM
+// nonce and the sealed mnemonic. The AES-256 key is derived from a passphrase with
+// scrypt, so a leaked config file or disk backup is useless without the passphrase.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Prefix marks an encrypted mnemonic and the version of its format
+const Prefix = "encrypted:v1:"
+
+// MinPassphraseLength is the shortest passphrase Encrypt accepts
+const MinPassphraseLength = 12
+
+const (
+	saltSize  = 16
+	nonceSize = 12 // standard AES-GCM nonce
+	tagSize   = 16
+
+	// scrypt cost, about 32 MiB and a tenth of a second per key
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// ErrWrongPassphrase is returned by Decrypt when the passphrase doesn't open the mnemonic
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// IsEncrypted reports whether a configured mnemonic was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt seals a mnemonic with a passphrase
+func Encrypt(mnemonic string, passphrase string) (string, error) {
+	if len(passphrase) < MinPassphraseLength {
+		return "", fmt.Errorf("passphrase must have at least %d characters", MinPassphraseLength)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = aead.Seal(sealed, nonce, []byte(strings.Join(strings.Fields(mnemonic), " ")), []byte(Prefix))
+	return Prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Validate checks that an encrypted mnemonic is well-formed, without the passphrase
+func Validate(value string) error {
+	_, err := decode(value)
+	return err
+}
+
+// Decrypt opens a mnemonic sealed by Encrypt
+func Decrypt(value string, passphrase string) (string, error) {
+	sealed, err := decode(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(passphrase, sealed[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	nonce, ciphertext := sealed[saltSize:saltSize+nonceSize], sealed[saltSize+nonceSize:]
+	mnemonic, err := aead.Open(nil, nonce, ciphertext, []byte(Prefix))
+	if err != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(mnemonic), nil
+}
+
+// decode returns the salt, nonce and ciphertext of an encrypted mnemonic
+func decode(value string) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return nil, fmt.Errorf("not an encrypted mnemonic")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, Prefix))
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted mnemonic: %v", err)
+	}
+	if len(sealed) < saltSize+nonceSize+tagSize {
+		return nil, fmt.Errorf("malformed encrypted mnemonic: too short")
+	}
+	return sealed, nil
+}
+
+// newAEAD derives the AES-GCM cipher of a passphrase and salt
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,144 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// Activation holds the sockets passed by systemd that haven't been claimed yet
+type Activation struct {
+	names     []string
+	listeners []net.Listener
+}
+
+// Activated collects the sockets passed by systemd socket activation. The
+// LISTEN_* variables are cleared so child processes don't inherit them. Without
+// activation the result is empty.
+func Activated() (*Activation, error) {
+	a := &Activation{}
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return a, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return a, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("activated socket %d (%s): %w", fd, name, err)
+		}
+		a.names = append(a.names, name)
+		a.listeners = append(a.listeners, ln)
+	}
+	return a, nil
+}
+
+// Take removes and returns the activated sockets with the given name, or all
+// remaining sockets when name is empty
+func (a *Activation) Take(name string) []net.Listener {
+	var taken []net.Listener
+	names := a.names[:0]
+	listeners := a.listeners[:0]
+	for i, ln := range a.listeners {
+		if name == "" || a.names[i] == name {
+			taken = append(taken, ln)
+			continue
+		}
+		names = append(names, a.names[i])
+		listeners = append(listeners, ln)
+	}
+	a.names, a.listeners = names, listeners
+	return taken
+}
+
+// Remaining returns the names of sockets nobody has taken
+func (a *Activation) Remaining() []string {
+	return append([]string(nil), a.names...)
+}
+
+// Close closes the sockets nobody has taken
+func (a *Activation) Close() {
+	for _, ln := range a.listeners {
+		ln.Close()
+	}
+	a.names, a.listeners = nil, nil
+}
+
+// Open listens on addr, which is one of:
+//   - host:port or :port for TCP
+//   - unix:/path/to.sock for a unix socket; a stale socket file is replaced
+//   - systemd for all remaining activated sockets, or systemd:name for the
+//     sockets with FileDescriptorName=name
+func Open(addr string, a *Activation) ([]net.Listener, error) {
+	switch {
+	case addr == "systemd" || strings.HasPrefix(addr, "systemd:"):
+		lns := a.Take(strings.TrimPrefix(strings.TrimPrefix(addr, "systemd"), ":"))
+		if len(lns) == 0 {
+			return nil, fmt.Errorf("%s: no matching sockets passed by systemd", addr)
+		}
+		return lns, nil
+
+	case strings.HasPrefix(addr, "unix:"):
+		path := strings.TrimPrefix(addr, "unix:")
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+
+	default:
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	}
+}
+
+// IsLocal reports whether ln only accepts connections from this machine,
+// i.e. it is a unix socket or bound to a loopback address
+func IsLocal(ln net.Listener) bool {
+	switch addr := ln.Addr().(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		return addr.IP.IsLoopback()
+	default:
+		return false
+	}
+}
+
+// Describe formats the address of ln for logs
+func Describe(ln net.Listener) string {
+	return ln.Addr().Network() + ":" + ln.Addr().String()
+}
@@ -0,0 +1,89 @@
+// Package logging sets up the structured logger of the API.
+//
+// Everything logs through log/slog. The handler installed by Setup adds the ID of the
+// request a context belongs to, so calls like slog.InfoContext(c.Request.Context(), ...)
+// can be correlated with the request that caused them.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"tonapp/internal/model"
+	"tonapp/internal/tracing"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it belongs to
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of a context, empty outside of requests
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ParseLevel parses a configured log level, info for an empty one
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+}
+
+// New returns a logger writing to w in the configured format and level. Invalid
+// settings fall back to text and info, the config check reports them.
+func New(cfg model.LoggingConfig, w io.Writer) *slog.Logger {
+	level, _ := ParseLevel(cfg.Level)
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler
+	if strings.EqualFold(cfg.Format, "json") {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// Setup makes the configured logger the default of slog and the log package
+func Setup(cfg model.LoggingConfig) {
+	slog.SetDefault(New(cfg, os.Stdout))
+}
+
+// contextHandler adds the request and trace IDs of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		r.AddAttrs(slog.String("trace_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,89 @@
+package memstore
+
+import (
+	"strings"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// AddAccessLog records a request to a sensitive route
+func (s *Store) AddAccessLog(entry *model.AccessLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = s.nextID("access_logs")
+	s.accessLogs = append(s.accessLogs, *entry)
+	return nil
+}
+
+// GetAccessLogs returns access log entries matching the filter, newest first
+func (s *Store) GetAccessLogs(filter model.AccessLogFilter, page pagination.Params) (*model.AccessLogPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []model.AccessLogEntry
+	for _, e := range s.accessLogs {
+		if filter.UserID != 0 && (e.UserID == nil || *e.UserID != filter.UserID) {
+			continue
+		}
+		if filter.PubKey != "" && e.PubKey != strings.ToLower(filter.PubKey) {
+			continue
+		}
+		if filter.Route != "" && e.Route != filter.Route {
+			continue
+		}
+		if filter.Method != "" && e.Method != strings.ToUpper(filter.Method) {
+			continue
+		}
+		if filter.Status != 0 && e.Status != filter.Status {
+			continue
+		}
+		if filter.ClientIP != "" && e.ClientIP != filter.ClientIP {
+			continue
+		}
+		if filter.AdminKey != "" && e.AdminKey != filter.AdminKey {
+			continue
+		}
+		if filter.From != 0 && e.CreatedAt < filter.From || filter.To != 0 && e.CreatedAt >= filter.To {
+			continue
+		}
+		matching = append(matching, e)
+	}
+	sortNewestFirst(matching, func(e model.AccessLogEntry) (int64, int64) { return e.CreatedAt, e.ID })
+
+	entries := make([]model.AccessLogEntry, 0)
+	for _, e := range matching {
+		if afterCursor(page, e.CreatedAt, e.ID) {
+			entries = append(entries, e)
+		}
+	}
+
+	entries, next := pagination.Trim(limit(entries, page), page, func(e model.AccessLogEntry) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	return &model.AccessLogPage{
+		Entries:    entries,
+		Total:      len(matching),
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// DeleteAccessLogsBefore removes the access log entries created before a unix time and
+// returns how many were removed
+func (s *Store) DeleteAccessLogsBefore(before int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.accessLogs[:0]
+	for _, e := range s.accessLogs {
+		if e.CreatedAt >= before {
+			kept = append(kept, e)
+		}
+	}
+	removed := len(s.accessLogs) - len(kept)
+	s.accessLogs = kept
+	return removed, nil
+}
@@ -0,0 +1,92 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// CreateAddressBookEntry saves a labeled address of a user
+func (s *Store) CreateAddressBookEntry(userID int, label, address string) (*model.AddressBookEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	e := &model.AddressBookEntry{
+		ID:        s.nextID("address_book"),
+		UserID:    userID,
+		Label:     label,
+		Address:   address,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.addressBook = append(s.addressBook, e)
+
+	entry := *e
+	return &entry, nil
+}
+
+// GetAddressBook returns the saved addresses of a user, oldest first
+func (s *Store) GetAddressBook(userID int) ([]model.AddressBookEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]model.AddressBookEntry, 0)
+	for _, e := range s.addressBook {
+		if e.UserID == userID {
+			entries = append(entries, *e)
+		}
+	}
+	return entries, nil
+}
+
+func (s *Store) addressBookEntry(userID int, id int64) int {
+	for i, e := range s.addressBook {
+		if e.ID == id && e.UserID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetAddressBookEntry returns a saved address of a user
+func (s *Store) GetAddressBookEntry(userID int, id int64) (*model.AddressBookEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.addressBookEntry(userID, id)
+	if i < 0 {
+		return nil, sql.ErrNoRows
+	}
+	entry := *s.addressBook[i]
+	return &entry, nil
+}
+
+// UpdateAddressBookLabel renames a saved address of a user
+func (s *Store) UpdateAddressBookLabel(userID int, id int64, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.addressBookEntry(userID, id)
+	if i < 0 {
+		return fmt.Errorf("address book entry not found")
+	}
+	s.addressBook[i].Label = label
+	s.addressBook[i].UpdatedAt = time.Now().Unix()
+	return nil
+}
+
+// DeleteAddressBookEntry removes a saved address of a user
+func (s *Store) DeleteAddressBookEntry(userID int, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.addressBookEntry(userID, id)
+	if i < 0 {
+		return fmt.Errorf("address book entry not found")
+	}
+	s.addressBook = append(s.addressBook[:i], s.addressBook[i+1:]...)
+	return nil
+}
@@ -0,0 +1,90 @@
+package memstore
+
+import (
+	"database/sql"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// SetOperationAnnotation replaces the tags and note of a user's operation, returning
+// sql.ErrNoRows if the operation isn't the user's
+func (s *Store) SetOperationAnnotation(userID int, operationID int64, tags []string, note string) (*model.OperationAnnotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for _, op := range s.operations {
+		if op.ID == operationID {
+			found = op.UserID == userID
+			break
+		}
+	}
+	if !found {
+		return nil, sql.ErrNoRows
+	}
+
+	a := &model.OperationAnnotation{
+		OperationID: operationID,
+		UserID:      userID,
+		Tags:        append([]string{}, tags...),
+		Note:        note,
+		UpdatedAt:   time.Now().Unix(),
+	}
+	s.annotations[operationID] = a
+
+	annotation := operationAnnotation(a)
+	return &annotation, nil
+}
+
+// ClearOperationAnnotation removes the tags and note of a user's operation
+func (s *Store) ClearOperationAnnotation(userID int, operationID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.annotations[operationID]; ok && a.UserID == userID {
+		delete(s.annotations, operationID)
+	}
+	return nil
+}
+
+// GetOperationAnnotations returns the annotations of a user's operations by operation ID
+func (s *Store) GetOperationAnnotations(userID int) (map[int64]model.OperationAnnotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	annotations := make(map[int64]model.OperationAnnotation)
+	for id, a := range s.annotations {
+		if a.UserID == userID {
+			annotations[id] = operationAnnotation(a)
+		}
+	}
+	return annotations, nil
+}
+
+// taggedOperations keeps the operations tagged with tag, all of them for an empty tag
+func (s *Store) taggedOperations(ops []*operation, tag string) []*operation {
+	if tag == "" {
+		return ops
+	}
+	var tagged []*operation
+	for _, op := range ops {
+		a, ok := s.annotations[op.ID]
+		if !ok {
+			continue
+		}
+		for _, t := range a.Tags {
+			if t == tag {
+				tagged = append(tagged, op)
+				break
+			}
+		}
+	}
+	return tagged
+}
+
+func operationAnnotation(a *model.OperationAnnotation) model.OperationAnnotation {
+	annotation := *a
+	annotation.Tags = append([]string{}, a.Tags...)
+	return annotation
+}
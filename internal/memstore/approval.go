@@ -0,0 +1,214 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// isHeld reports whether a withdrawal request went through the approval queue
+func (w *withdrawalRequest) isHeld() bool {
+	switch w.Status {
+	case model.WithdrawalStatusPendingApproval, model.WithdrawalStatusApproved, model.WithdrawalStatusSending,
+		model.WithdrawalStatusSent, model.WithdrawalStatusRejected, model.WithdrawalStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (s *Store) withdrawalRequest(id int64) *withdrawalRequest {
+	for _, w := range s.withdrawalRequests {
+		if w.ID == id && w.isHeld() {
+			return w
+		}
+	}
+	return nil
+}
+
+// heldWithdrawal returns a request of the approval queue with the owner's key
+func (s *Store) heldWithdrawal(w *withdrawalRequest) (*model.HeldWithdrawal, error) {
+	u, ok := s.users[w.UserID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	held := &model.HeldWithdrawal{
+		ID:             w.ID,
+		UserID:         w.UserID,
+		PubKey:         u.PubKey,
+		Amount:         w.Amount,
+		Status:         w.Status,
+		TxHash:         w.TxHash,
+		Reason:         w.Reason,
+		CreatedAt:      w.CreatedAt,
+		TreasuryWallet: w.TreasuryWallet,
+		Destination:    w.Destination,
+		QueueID:        w.QueueID,
+	}
+	if w.ReviewedAt != nil {
+		v := *w.ReviewedAt
+		held.ReviewedAt = &v
+	}
+	return held, nil
+}
+
+// HoldWithdrawal reserves the amount from the user balance and records a withdrawal
+// request waiting for admin approval
+func (s *Store) HoldWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.HeldWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWithdrawalCaps(userID, amount, caps); err != nil {
+		return nil, err
+	}
+
+	w := &withdrawalRequest{
+		ID:          s.nextID("withdrawal_requests"),
+		UserID:      userID,
+		Amount:      amount,
+		Status:      model.WithdrawalStatusPendingApproval,
+		CreatedAt:   time.Now().Unix(),
+		Destination: destination,
+	}
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalHeld,
+		Reference: fmt.Sprintf("withdrawal_request:%d", w.ID),
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountWithdrawalApproval),
+		Amount:    amount,
+		CreatedAt: w.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.withdrawalRequests = append(s.withdrawalRequests, w)
+
+	return s.heldWithdrawal(w)
+}
+
+// GetHeldWithdrawal returns a withdrawal request of the approval queue
+func (s *Store) GetHeldWithdrawal(id int64) (*model.HeldWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.withdrawalRequest(id)
+	if w == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.heldWithdrawal(w)
+}
+
+// GetHeldWithdrawals returns the withdrawal requests of the approval queue with the given
+// status, oldest first; an empty status returns every status
+func (s *Store) GetHeldWithdrawals(status string) ([]model.HeldWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	withdrawals := make([]model.HeldWithdrawal, 0)
+	for _, w := range s.withdrawalRequests {
+		if !w.isHeld() || (status != "" && w.Status != status) {
+			continue
+		}
+		held, err := s.heldWithdrawal(w)
+		if err != nil {
+			continue // user deleted
+		}
+		withdrawals = append(withdrawals, *held)
+	}
+	return withdrawals, nil
+}
+
+// GetUserHeldWithdrawals returns the user's withdrawal requests of the approval queue, newest first
+func (s *Store) GetUserHeldWithdrawals(userID int) ([]model.HeldWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	withdrawals := make([]model.HeldWithdrawal, 0)
+	for i := len(s.withdrawalRequests) - 1; i >= 0 && len(withdrawals) < 50; i-- {
+		w := s.withdrawalRequests[i]
+		if w.UserID != userID || !w.isHeld() {
+			continue
+		}
+		held, err := s.heldWithdrawal(w)
+		if err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, *held)
+	}
+	return withdrawals, nil
+}
+
+// ApproveHeldWithdrawal moves a request waiting for approval to the withdrawal worker: its
+// reserved amount moves to a processing queue entry, dated like the request so withdrawal
+// limits count it the same, and the request becomes approved
+func (s *Store) ApproveHeldWithdrawal(w model.HeldWithdrawal) (*model.QueuedWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.withdrawalRequest(w.ID)
+	if stored == nil || stored.Status != model.WithdrawalStatusPendingApproval {
+		return nil, fmt.Errorf("withdrawal request %d is not %s", w.ID, model.WithdrawalStatusPendingApproval)
+	}
+
+	now := time.Now().Unix()
+	queued := &model.QueuedWithdrawal{
+		ID:          s.nextID("withdrawal_queue"),
+		UserID:      stored.UserID,
+		Amount:      stored.Amount,
+		Status:      model.QueueStatusProcessing,
+		CreatedAt:   stored.CreatedAt,
+		Destination: stored.Destination,
+	}
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalApproved,
+		Reference: fmt.Sprintf("withdrawal_request:%d", w.ID),
+		From:      systemAccount(model.LedgerAccountWithdrawalApproval),
+		To:        systemAccount(model.LedgerAccountWithdrawalQueue),
+		Amount:    stored.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.queue = append(s.queue, queued)
+	stored.Status = model.WithdrawalStatusApproved
+	stored.ReviewedAt = &now
+	stored.QueueID = queued.ID
+
+	return s.queuedWithdrawal(queued)
+}
+
+// ReleaseHeldWithdrawal rejects a request waiting for approval, or fails one being sent
+// (status failed), and returns the reserved funds to the user
+func (s *Store) ReleaseHeldWithdrawal(w model.HeldWithdrawal, status string, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, kind := model.WithdrawalStatusPendingApproval, model.LedgerKindWithdrawalRejected
+	if status == model.WithdrawalStatusFailed {
+		from, kind = model.WithdrawalStatusSending, model.LedgerKindWithdrawalFailed
+	}
+	stored := s.withdrawalRequest(w.ID)
+	if stored == nil || stored.Status != from {
+		return fmt.Errorf("withdrawal request %d can't be %s", w.ID, status)
+	}
+
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      kind,
+		Reference: fmt.Sprintf("withdrawal_request:%d", w.ID),
+		From:      systemAccount(model.LedgerAccountWithdrawalApproval),
+		To:        userAccount(w.UserID),
+		Amount:    w.Amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	stored.Status = status
+	stored.Reason = reason
+	stored.ReviewedAt = &now
+	return nil
+}
@@ -0,0 +1,398 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// challenge is a row of the signature_challenges table
+type challenge struct {
+	model.SignatureChallenge
+	Used bool
+}
+
+// tonProofPayload is a row of the ton_proof_payloads table
+type tonProofPayload struct {
+	ExpiresAt int64
+	Used      bool
+}
+
+// apiToken is a row of the api_tokens table
+type apiToken struct {
+	model.APIToken
+	Hash string
+}
+
+func (t *apiToken) toModel() model.APIToken {
+	token := t.APIToken
+	if t.LastUsedAt != nil {
+		v := *t.LastUsedAt
+		token.LastUsedAt = &v
+	}
+	if t.RevokedAt != nil {
+		v := *t.RevokedAt
+		token.RevokedAt = &v
+	}
+	return token
+}
+
+// CreateSignatureChallenge stores a challenge to be signed by the user's wallet
+func (s *Store) CreateSignatureChallenge(ch *model.SignatureChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[ch.Nonce]; ok {
+		return fmt.Errorf("UNIQUE constraint failed: signature_challenges.nonce")
+	}
+	s.challenges[ch.Nonce] = &challenge{SignatureChallenge: *ch}
+	return nil
+}
+
+// ConsumeSignatureChallenge atomically marks an unexpired challenge as used and returns it.
+// Each challenge can be consumed only once.
+func (s *Store) ConsumeSignatureChallenge(nonce string, userID int, purpose string) (*model.SignatureChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch, ok := s.challenges[nonce]
+	if !ok || ch.UserID != userID || ch.Purpose != purpose || ch.Used {
+		return nil, fmt.Errorf("challenge not found or already used")
+	}
+	if time.Now().Unix() > ch.ExpiresAt {
+		return nil, fmt.Errorf("challenge expired")
+	}
+
+	ch.Used = true
+	consumed := ch.SignatureChallenge
+	return &consumed, nil
+}
+
+// CreateTonProofPayload stores a payload handed out for TON Connect sign-in
+func (s *Store) CreateTonProofPayload(p *model.TonProofPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tonProofPayloads[p.Payload]; ok {
+		return fmt.Errorf("UNIQUE constraint failed: ton_proof_payloads.payload")
+	}
+	s.tonProofPayloads[p.Payload] = &tonProofPayload{ExpiresAt: p.ExpiresAt}
+	return nil
+}
+
+// ConsumeTonProofPayload marks an unexpired payload as used. Each payload can be consumed only once.
+func (s *Store) ConsumeTonProofPayload(payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.tonProofPayloads[payload]
+	if !ok || p.Used || p.ExpiresAt < time.Now().Unix() {
+		return fmt.Errorf("payload not found, expired or already used")
+	}
+	p.Used = true
+	return nil
+}
+
+// CreateAPIToken stores a new token of a user by its hash
+func (s *Store) CreateAPIToken(userID int, name, scope, prefix, tokenHash string) (*model.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.apiTokens {
+		if t.Hash == tokenHash {
+			return nil, fmt.Errorf("UNIQUE constraint failed: api_tokens.token_hash")
+		}
+	}
+
+	t := &apiToken{
+		APIToken: model.APIToken{
+			ID:        s.nextID("api_tokens"),
+			UserID:    userID,
+			Name:      name,
+			Scope:     scope,
+			Prefix:    prefix,
+			CreatedAt: time.Now().Unix(),
+		},
+		Hash: tokenHash,
+	}
+	s.apiTokens = append(s.apiTokens, t)
+
+	token := t.toModel()
+	return &token, nil
+}
+
+// GetAPITokenByHash returns an active token by its hash and updates its last usage time
+func (s *Store) GetAPITokenByHash(tokenHash string) (*model.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.apiTokens {
+		if t.Hash != tokenHash || t.RevokedAt != nil {
+			continue
+		}
+		token := t.toModel()
+		now := time.Now().Unix()
+		t.LastUsedAt = &now
+		return &token, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetAPITokensByUser lists all tokens of a user including revoked ones
+func (s *Store) GetAPITokensByUser(userID int) ([]model.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]model.APIToken, 0)
+	for _, t := range s.apiTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, t.toModel())
+		}
+	}
+	sort.SliceStable(tokens, func(i, j int) bool { return tokens[i].CreatedAt > tokens[j].CreatedAt })
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes a token belonging to the user
+func (s *Store) RevokeAPIToken(userID int, tokenID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.apiTokens {
+		if t.ID == tokenID && t.UserID == userID && t.RevokedAt == nil {
+			now := time.Now().Unix()
+			t.RevokedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("token not found")
+}
+
+// adminKey is a row of the admin_keys table
+type adminKey struct {
+	model.AdminKey
+	Hash string
+}
+
+func (k *adminKey) toModel() model.AdminKey {
+	key := k.AdminKey
+	if k.LastUsedAt != nil {
+		v := *k.LastUsedAt
+		key.LastUsedAt = &v
+	}
+	if k.RevokedAt != nil {
+		v := *k.RevokedAt
+		key.RevokedAt = &v
+	}
+	return key
+}
+
+// CreateAdminKey stores a new admin key by its hash
+func (s *Store) CreateAdminKey(name, role, prefix, keyHash, createdBy string) (*model.AdminKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.adminKeys {
+		if k.Hash == keyHash {
+			return nil, fmt.Errorf("UNIQUE constraint failed: admin_keys.key_hash")
+		}
+	}
+
+	k := &adminKey{
+		AdminKey: model.AdminKey{
+			ID:        s.nextID("admin_keys"),
+			Name:      name,
+			Role:      role,
+			Prefix:    prefix,
+			CreatedBy: createdBy,
+			CreatedAt: time.Now().Unix(),
+		},
+		Hash: keyHash,
+	}
+	s.adminKeys = append(s.adminKeys, k)
+
+	key := k.toModel()
+	return &key, nil
+}
+
+// GetAdminKeyByHash returns an active admin key by its hash and updates its last usage time
+func (s *Store) GetAdminKeyByHash(keyHash string) (*model.AdminKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.adminKeys {
+		if k.Hash != keyHash || k.RevokedAt != nil {
+			continue
+		}
+		key := k.toModel()
+		now := time.Now().Unix()
+		k.LastUsedAt = &now
+		return &key, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetAdminKeys lists all admin keys including revoked ones
+func (s *Store) GetAdminKeys() ([]model.AdminKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]model.AdminKey, 0, len(s.adminKeys))
+	for i := len(s.adminKeys) - 1; i >= 0; i-- {
+		keys = append(keys, s.adminKeys[i].toModel())
+	}
+	return keys, nil
+}
+
+// RevokeAdminKey revokes an admin key, it stops working right away
+func (s *Store) RevokeAdminKey(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.adminKeys {
+		if k.ID == id && k.RevokedAt == nil {
+			now := time.Now().Unix()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+	return fmt.Errorf("admin key not found")
+}
+
+// partner is a row of the partners table
+type partner struct {
+	model.Partner
+	Hash string
+}
+
+func (p *partner) toModel() model.Partner {
+	out := p.Partner
+	if p.ReviewedAt != nil {
+		v := *p.ReviewedAt
+		out.ReviewedAt = &v
+	}
+	if p.LastUsedAt != nil {
+		v := *p.LastUsedAt
+		out.LastUsedAt = &v
+	}
+	return out
+}
+
+func (s *Store) findPartner(id int64) *partner {
+	for _, p := range s.partners {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// CreatePartner stores a partner application waiting for admin approval
+func (s *Store) CreatePartner(name, contact, useCase string) (*model.Partner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &partner{Partner: model.Partner{
+		ID:        s.nextID("partners"),
+		Name:      name,
+		Contact:   contact,
+		UseCase:   useCase,
+		Status:    model.PartnerStatusPending,
+		CreatedAt: time.Now().Unix(),
+	}}
+	s.partners = append(s.partners, p)
+
+	out := p.toModel()
+	return &out, nil
+}
+
+// GetPartner returns a partner by ID
+func (s *Store) GetPartner(id int64) (*model.Partner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.findPartner(id)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	out := p.toModel()
+	return &out, nil
+}
+
+// GetPartners lists the partners with the given status, newest first; an empty status
+// returns every partner
+func (s *Store) GetPartners(status string) ([]model.Partner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	partners := make([]model.Partner, 0)
+	for i := len(s.partners) - 1; i >= 0; i-- {
+		if status == "" || s.partners[i].Status == status {
+			partners = append(partners, s.partners[i].toModel())
+		}
+	}
+	return partners, nil
+}
+
+// GetPartnerByTokenHash returns an approved partner by the hash of its token and
+// updates its last usage time
+func (s *Store) GetPartnerByTokenHash(tokenHash string) (*model.Partner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.partners {
+		if p.Hash != tokenHash || p.Status != model.PartnerStatusApproved {
+			continue
+		}
+		out := p.toModel()
+		now := time.Now().Unix()
+		p.LastUsedAt = &now
+		return &out, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// ApprovePartner approves a pending partner, or updates an approved one, with a tier
+// and a new token replacing the previous one
+func (s *Store) ApprovePartner(id int64, tier, tokenPrefix, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.findPartner(id)
+	if p == nil || p.Status == model.PartnerStatusRevoked {
+		return fmt.Errorf("partner %d can't be approved", id)
+	}
+	for _, other := range s.partners {
+		if other != p && other.Hash == tokenHash {
+			return fmt.Errorf("UNIQUE constraint failed: partners.token_hash")
+		}
+	}
+
+	now := time.Now().Unix()
+	p.Status = model.PartnerStatusApproved
+	p.Tier = tier
+	p.TokenPrefix = tokenPrefix
+	p.Hash = tokenHash
+	p.ReviewedAt = &now
+	return nil
+}
+
+// RevokePartner rejects a pending partner or revokes the token of an approved one
+func (s *Store) RevokePartner(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.findPartner(id)
+	if p == nil || p.Status == model.PartnerStatusRevoked {
+		return fmt.Errorf("partner %d is already revoked", id)
+	}
+
+	now := time.Now().Unix()
+	p.Status = model.PartnerStatusRevoked
+	p.Hash = ""
+	p.ReviewedAt = &now
+	return nil
+}
@@ -0,0 +1,28 @@
+package memstore
+
+import "database/sql"
+
+// SetBotReferral remembers the referrer of a Telegram user who opened the bot with a
+// referral link, until they register. The first referral link opened is kept.
+func (s *Store) SetBotReferral(telegramID, refID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.botReferrals[telegramID]; !ok {
+		s.botReferrals[telegramID] = refID
+	}
+	return nil
+}
+
+// GetBotReferral returns the referrer remembered for a Telegram user, sql.ErrNoRows
+// without one
+func (s *Store) GetBotReferral(telegramID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refID, ok := s.botReferrals[telegramID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return refID, nil
+}
@@ -0,0 +1,186 @@
+package memstore
+
+import (
+	"bytes"
+	"database/sql"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// GetIndexerCursor returns the last ingested transaction of a wallet, or a zero cursor
+func (s *Store) GetIndexerCursor(wallet string) (*model.IndexerCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor, ok := s.indexerCursors[wallet]
+	if !ok {
+		cursor = model.IndexerCursor{Wallet: wallet}
+	}
+	return &cursor, nil
+}
+
+// GetIndexerCursors returns the cursors of all indexed wallets
+func (s *Store) GetIndexerCursors() ([]model.IndexerCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursors := make([]model.IndexerCursor, 0, len(s.indexerCursors))
+	for _, c := range s.indexerCursors {
+		cursors = append(cursors, c)
+	}
+	sort.Slice(cursors, func(i, j int) bool { return cursors[i].Wallet < cursors[j].Wallet })
+	return cursors, nil
+}
+
+// SaveChainTransactions stores ingested transactions (oldest first) and moves
+// the wallet cursor to the last one
+func (s *Store) SaveChainTransactions(wallet string, txs []model.ChainTransaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[uint64]bool)
+	for _, t := range s.chainTransactions {
+		if t.Wallet == wallet {
+			seen[t.LT] = true
+		}
+	}
+	for _, t := range txs {
+		if seen[t.LT] {
+			continue
+		}
+		seen[t.LT] = true
+		t.ID = s.nextID("chain_transactions")
+		t.Wallet = wallet
+		s.chainTransactions = append(s.chainTransactions, &t)
+	}
+
+	last := txs[len(txs)-1]
+	s.indexerCursors[wallet] = model.IndexerCursor{
+		Wallet:    wallet,
+		LastLT:    last.LT,
+		LastHash:  last.Hash,
+		UpdatedAt: time.Now().Unix(),
+	}
+	return nil
+}
+
+// FindIndexedDeposits returns the non-bounced incoming transfers with the given comment
+// received after since, oldest first
+func (s *Store) FindIndexedDeposits(wallet string, memo string, since int64) ([]model.ChainTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var txs []model.ChainTransaction
+	for _, t := range s.chainTransactions {
+		if t.Wallet != wallet || t.InComment != memo || t.Bounced || t.Utime < since || t.InAmount <= 0 {
+			continue
+		}
+		txs = append(txs, *t)
+	}
+	sort.Slice(txs, func(i, j int) bool { return txs[i].LT < txs[j].LT })
+	return txs, nil
+}
+
+// explorerTransaction links an indexed transaction to the deposit request with its memo
+// and to the withdrawal operation with its hash
+func (s *Store) explorerTransaction(c *model.ChainTransaction) model.ExplorerTransaction {
+	t := model.ExplorerTransaction{ChainTransaction: *c}
+
+	if c.InComment != "" {
+		for _, d := range s.deposits {
+			if d.Memo == c.InComment {
+				id, userID := d.ID, d.UserID
+				t.DepositID, t.DepositUserID = &id, &userID
+				break
+			}
+		}
+	}
+	if c.OutAmount > 0 {
+		for _, op := range s.operations {
+			if op.Type == model.OperationTypeWithdrawal && bytes.Contains(op.extraJSON, []byte(c.Hash)) {
+				id, userID := op.ID, op.UserID
+				t.WithdrawalOperationID, t.WithdrawalUserID = &id, &userID
+				break
+			}
+		}
+	}
+	if inv, ok := s.investigations[c.ID]; ok {
+		t.Investigation = &inv
+	}
+	t.Unmatched = t.InAmount > 0 && !t.Bounced && t.DepositID == nil
+	return t
+}
+
+// GetExplorerTransactions returns indexed treasury transactions, newest first
+func (s *Store) GetExplorerTransactions(filter model.ExplorerFilter, page pagination.Params) (*model.ExplorerPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []model.ExplorerTransaction
+	for _, c := range s.chainTransactions {
+		t := s.explorerTransaction(c)
+		if filter.Wallet != "" && t.Wallet != filter.Wallet {
+			continue
+		}
+		if filter.Direction == "in" && t.InAmount <= 0 || filter.Direction == "out" && t.OutAmount <= 0 {
+			continue
+		}
+		if filter.UnmatchedOnly && !t.Unmatched {
+			continue
+		}
+		if filter.Investigation != "" && (t.Investigation == nil || t.Investigation.Status != filter.Investigation) {
+			continue
+		}
+		matching = append(matching, t)
+	}
+	sortNewestFirst(matching, func(t model.ExplorerTransaction) (int64, int64) { return t.Utime, t.ID })
+
+	txs := make([]model.ExplorerTransaction, 0)
+	for _, t := range matching {
+		if afterCursor(page, t.Utime, t.ID) {
+			txs = append(txs, t)
+		}
+	}
+
+	txs, next := pagination.Trim(limit(txs, page), page, func(t model.ExplorerTransaction) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: t.Utime, ID: t.ID}
+	})
+
+	return &model.ExplorerPage{
+		Transactions: txs,
+		Total:        len(matching),
+		PageSize:     page.Limit,
+		NextCursor:   next,
+	}, nil
+}
+
+// SetChainInvestigation marks an indexed transaction for investigation or resolves it
+func (s *Store) SetChainInvestigation(txID int64, status string, note string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exists := false
+	for _, t := range s.chainTransactions {
+		if t.ID == txID {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	s.investigations[txID] = model.ChainInvestigation{
+		Status:    status,
+		Note:      note,
+		UpdatedAt: time.Now().Unix(),
+	}
+	return nil
+}
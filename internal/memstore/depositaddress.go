@@ -0,0 +1,76 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// UseDepositAddress returns the personal deposit address of a user, assigning the next
+// subwallet ID on first use, and records the use so the sweeper checks the address
+func (s *Store) UseDepositAddress(userID int) (*model.DepositAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	a, ok := s.depositAddresses[userID]
+	if !ok {
+		subwalletID := uint32(model.DepositSubwalletBase)
+		for _, other := range s.depositAddresses {
+			if other.SubwalletID > subwalletID {
+				subwalletID = other.SubwalletID
+			}
+		}
+		a = &model.DepositAddress{UserID: userID, SubwalletID: subwalletID + 1, CreatedAt: now}
+		s.depositAddresses[userID] = a
+	}
+	a.UsedAt = now
+
+	address := depositAddress(a)
+	return &address, nil
+}
+
+// GetDepositAddressesToSweep returns the deposit addresses used since their last sweep,
+// and since the given time
+func (s *Store) GetDepositAddressesToSweep(usedSince int64) ([]model.DepositAddress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addresses := make([]model.DepositAddress, 0)
+	for _, a := range s.depositAddresses {
+		if a.UsedAt >= usedSince && (a.SweptAt == nil || *a.SweptAt < a.UsedAt) {
+			addresses = append(addresses, depositAddress(a))
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if addresses[i].UsedAt != addresses[j].UsedAt {
+			return addresses[i].UsedAt < addresses[j].UsedAt
+		}
+		return addresses[i].UserID < addresses[j].UserID
+	})
+	return addresses, nil
+}
+
+// RecordDepositSweep records that the balance of a deposit address was swept to the
+// main wallet
+func (s *Store) RecordDepositSweep(userID int, amount float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.depositAddresses[userID]; ok {
+		now := time.Now().Unix()
+		a.SweptAt = &now
+		a.Swept += amount
+	}
+	return nil
+}
+
+func depositAddress(a *model.DepositAddress) model.DepositAddress {
+	address := *a
+	if a.SweptAt != nil {
+		sweptAt := *a.SweptAt
+		address.SweptAt = &sweptAt
+	}
+	return address
+}
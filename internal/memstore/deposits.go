@@ -0,0 +1,556 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/pagination"
+)
+
+func depositRequest(d *model.DepositIntent) model.DepositRequest {
+	req := model.DepositRequest{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		Amount:    d.Amount,
+		Status:    d.Status,
+		Memo:      d.Memo,
+		CreatedAt: d.CreatedAt,
+
+		TreasuryWallet: d.TreasuryWallet,
+		DepositAddress: d.DepositAddress,
+		TxHash:         d.TxHash,
+	}
+	if d.RequestedAmount != nil {
+		v := *d.RequestedAmount
+		req.RequestedAmount = &v
+	}
+	return req
+}
+
+func depositIntent(d *model.DepositIntent) model.DepositIntent {
+	in := *d
+	if d.FundedAt != nil {
+		v := *d.FundedAt
+		in.FundedAt = &v
+	}
+	if d.RemindedAt != nil {
+		v := *d.RemindedAt
+		in.RemindedAt = &v
+	}
+	if d.RequestedAmount != nil {
+		v := *d.RequestedAmount
+		in.RequestedAmount = &v
+	}
+	return in
+}
+
+func (s *Store) deposit(id int) *model.DepositIntent {
+	for _, d := range s.deposits {
+		if d.ID == id {
+			return d
+		}
+	}
+	return nil
+}
+
+// CreateDepositRequest creates a new deposit request paid to the given treasury wallet,
+// empty for the main wallet, or to the user's personal deposit address
+func (s *Store) CreateDepositRequest(userID int, amount float64, memo string, treasuryWallet string, depositAddress string) (*model.DepositRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := &model.DepositIntent{
+		ID:        int(s.nextID("deposit_requests")),
+		UserID:    userID,
+		Amount:    amount,
+		Memo:      memo,
+		Status:    statusPending,
+		CreatedAt: time.Now().Unix(),
+
+		TreasuryWallet: treasuryWallet,
+		DepositAddress: depositAddress,
+	}
+	s.deposits = append(s.deposits, d)
+
+	req := depositRequest(d)
+	return &req, nil
+}
+
+// GetDepositRequest gets a deposit request by ID
+func (s *Store) GetDepositRequest(id int) (*model.DepositRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(id)
+	if d == nil {
+		return nil, sql.ErrNoRows
+	}
+	req := depositRequest(d)
+	return &req, nil
+}
+
+// GetDepositsOfUser returns all deposit requests of a user
+func (s *Store) GetDepositsOfUser(userID int) ([]model.DepositRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []model.DepositRequest
+	for _, d := range s.deposits {
+		if d.UserID == userID {
+			reqs = append(reqs, depositRequest(d))
+		}
+	}
+	return reqs, nil
+}
+
+// GetPendingDeposits returns the pending deposit requests created after since, oldest first
+func (s *Store) GetPendingDeposits(since int64) ([]model.DepositRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs []model.DepositRequest
+	for _, d := range s.deposits {
+		if d.Status == statusPending && d.CreatedAt >= since {
+			reqs = append(reqs, depositRequest(d))
+		}
+	}
+	return reqs, nil
+}
+
+// GetDepositHistory returns a page of a user's deposit requests, newest first
+func (s *Store) GetDepositHistory(userID int, page pagination.Params) (*model.DepositHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ids grow with creation time, so the id alone orders the requests
+	deposits := make([]model.DepositRequest, 0)
+	for i := len(s.deposits) - 1; i >= 0; i-- {
+		d := s.deposits[i]
+		if d.UserID == userID && (page.After == nil || int64(d.ID) < page.After.ID) {
+			deposits = append(deposits, depositRequest(d))
+		}
+	}
+
+	deposits, next := pagination.Trim(limit(deposits, page), page, func(req model.DepositRequest) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: req.CreatedAt, ID: int64(req.ID)}
+	})
+
+	return &model.DepositHistory{
+		Deposits:   deposits,
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// UpdateDepositStatus updates the status of a deposit request.
+// Completing a request records when it was funded.
+func (s *Store) UpdateDepositStatus(id int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.deposit(id); d != nil {
+		d.Status = status
+		if status == statusCompleted {
+			now := time.Now().Unix()
+			d.FundedAt = &now
+		}
+	}
+	return nil
+}
+
+// ClaimDeposit moves a pending deposit request to processing, so only one confirmation
+// checks the chain and forwards the platform share. Claims taken before staleBefore are
+// taken over. Returns false if the request is not pending or claimed.
+func (s *Store) ClaimDeposit(id int, staleBefore int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(id)
+	if d == nil {
+		return false, nil
+	}
+	if d.Status != statusPending && (d.Status != statusProcessing || s.depositClaims[id] >= staleBefore) {
+		return false, nil
+	}
+	d.Status = statusProcessing
+	s.depositClaims[id] = time.Now().Unix()
+	return true, nil
+}
+
+// ReleaseDeposit moves a claimed deposit request back to pending
+func (s *Store) ReleaseDeposit(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d := s.deposit(id); d != nil && d.Status == statusProcessing {
+		d.Status = statusPending
+		d.TxHash = ""
+		delete(s.depositClaims, id)
+	}
+	return nil
+}
+
+// SetDepositTxHash records the transaction a claimed deposit request is credited with.
+// Returns false if the transaction was already used for another request.
+func (s *Store) SetDepositTxHash(id int, txHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(id)
+	if d == nil || d.Status != statusProcessing {
+		return false, nil
+	}
+	for _, other := range s.deposits {
+		if other.ID != id && other.TxHash == txHash {
+			return false, nil
+		}
+	}
+	d.TxHash = txHash
+	return true, nil
+}
+
+// ExpireDeposits marks the deposit requests still pending since before createdBefore as
+// expired and returns their IDs
+func (s *Store) ExpireDeposits(createdBefore int64) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []int
+	for _, d := range s.deposits {
+		if d.Status == statusPending && d.CreatedAt < createdBefore {
+			d.Status = statusExpired
+			expired = append(expired, d.ID)
+		}
+	}
+	return expired, nil
+}
+
+// CancelDeposit marks a pending deposit request as cancelled. Returns false if it isn't
+// pending anymore.
+func (s *Store) CancelDeposit(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(id)
+	if d == nil || d.Status != statusPending {
+		return false, nil
+	}
+	d.Status = statusCancelled
+	return true, nil
+}
+
+// EscalateDeposit moves a claimed deposit request to review
+func (s *Store) EscalateDeposit(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(id)
+	if d == nil || d.Status != statusProcessing {
+		return fmt.Errorf("deposit request %d is not processing", id)
+	}
+	d.Status = statusReview
+	delete(s.depositClaims, id)
+	return nil
+}
+
+// GetEscalatedDeposits returns the deposit requests waiting for an admin review, oldest first
+func (s *Store) GetEscalatedDeposits() ([]model.DepositRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reqs := []model.DepositRequest{}
+	for _, d := range s.deposits {
+		if d.Status == statusReview {
+			reqs = append(reqs, depositRequest(d))
+		}
+	}
+	return reqs, nil
+}
+
+// ReviewEscalatedDeposit claims a credited deposit request under review for
+// CompleteDeposit or fails a rejected one. Returns false if it isn't under review.
+func (s *Store) ReviewEscalatedDeposit(id int, credit bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(id)
+	if d == nil || d.Status != statusReview {
+		return false, nil
+	}
+	if credit {
+		d.Status = statusProcessing
+		s.depositClaims[id] = time.Now().Unix()
+	} else {
+		d.Status = statusFailed
+	}
+	return true, nil
+}
+
+// CompleteDeposit marks a deposit request claimed with ClaimDeposit as completed and
+// credits its amount to the user
+// CompleteDeposit credits a claimed deposit request with the amount received for it.
+// A request credited with another amount than requested keeps the requested one in
+// RequestedAmount.
+func (s *Store) CompleteDeposit(deposit model.DepositRequest, received float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(deposit.ID)
+	if d == nil || d.Status != statusProcessing {
+		return fmt.Errorf("deposit request %d is not processing", deposit.ID)
+	}
+
+	now := time.Now().Unix()
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindDeposit,
+		Reference: fmt.Sprintf("deposit_request:%d", deposit.ID),
+		From:      systemAccount(model.LedgerAccountExternal),
+		To:        userAccount(deposit.UserID),
+		Amount:    received,
+		Wallet:    deposit.TreasuryWallet,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	if money.ToNano(received) != money.ToNano(d.Amount) {
+		requested := d.Amount
+		d.RequestedAmount = &requested
+	}
+	d.Amount = received
+	d.Status = statusCompleted
+	d.FundedAt = &now
+	delete(s.depositClaims, deposit.ID)
+	return nil
+}
+
+// GetDepositTotals returns the sum of deposits completed since the given time
+// and the sum of deposit requests still pending
+func (s *Store) GetDepositTotals(since time.Time) (completed float64, pending float64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deposits {
+		switch d.Status {
+		case statusCompleted:
+			if d.CreatedAt >= since.Unix() {
+				completed += d.Amount
+			}
+		case statusPending, statusProcessing:
+			pending += d.Amount
+		}
+	}
+	return completed, pending, nil
+}
+
+// GetDepositIntentsSince returns deposit requests created at or after since
+func (s *Store) GetDepositIntentsSince(since int64) ([]model.DepositIntent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intents := make([]model.DepositIntent, 0)
+	for _, d := range s.deposits {
+		if d.CreatedAt >= since {
+			intents = append(intents, depositIntent(d))
+		}
+	}
+	return intents, nil
+}
+
+// GetDepositsToRemind returns pending deposit requests created between from and to
+// whose owner hasn't been reminded yet
+func (s *Store) GetDepositsToRemind(from, to int64) ([]model.DepositIntent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intents := make([]model.DepositIntent, 0)
+	for _, d := range s.deposits {
+		if d.Status == statusPending && d.RemindedAt == nil && d.CreatedAt >= from && d.CreatedAt <= to {
+			intents = append(intents, depositIntent(d))
+		}
+	}
+	return intents, nil
+}
+
+// GetStalePendingDeposits returns how many deposit requests created before the given
+// time are still pending and when the oldest of them was created
+func (s *Store) GetStalePendingDeposits(before int64) (count int, oldest int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range s.deposits {
+		if d.Status != statusPending || d.CreatedAt >= before {
+			continue
+		}
+		if count == 0 || d.CreatedAt < oldest {
+			oldest = d.CreatedAt
+		}
+		count++
+	}
+	return count, oldest, nil
+}
+
+// MarkDepositReminded stores the reminder notification and marks the request as
+// reminded. It returns false if the request was funded or reminded in the meantime.
+func (s *Store) MarkDepositReminded(depositID int, n *model.Notification) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := s.deposit(depositID)
+	if d == nil || d.Status != statusPending || d.RemindedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now().Unix()
+	d.RemindedAt = &now
+	s.addNotification(n, now)
+	return true, nil
+}
+
+func (s *Store) payment(id int64) *model.Payment {
+	for _, p := range s.payments {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// CreatePayment stores a pending provider top-up
+func (s *Store) CreatePayment(userID int, provider string, amount float64) (*model.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := &model.Payment{
+		ID:        s.nextID("payments"),
+		UserID:    userID,
+		Provider:  provider,
+		Amount:    amount,
+		Status:    model.PaymentStatusPending,
+		CreatedAt: time.Now().Unix(),
+	}
+	s.payments = append(s.payments, p)
+
+	created := *p
+	return &created, nil
+}
+
+// SetPaymentQuote stores the amount the provider will charge for a payment
+func (s *Store) SetPaymentQuote(id int64, providerAmount int64, currency string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p := s.payment(id); p != nil {
+		p.ProviderAmount = providerAmount
+		p.Currency = currency
+	}
+	return nil
+}
+
+// GetPayment returns a payment by ID, sql.ErrNoRows if it doesn't exist
+func (s *Store) GetPayment(id int64) (*model.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.payment(id)
+	if p == nil {
+		return nil, sql.ErrNoRows
+	}
+	found := *p
+	return &found, nil
+}
+
+// EscalatePayment puts a pending payment the provider charged but that couldn't be
+// credited under review, with the charge and the reason
+func (s *Store) EscalatePayment(id int64, provider string, externalID string, reason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.payment(id)
+	if p == nil || p.Provider != provider || p.Status != model.PaymentStatusPending {
+		return false, nil
+	}
+	p.Status = model.PaymentStatusReview
+	p.ExternalID = externalID
+	p.Error = reason
+	return true, nil
+}
+
+// GetEscalatedPayments returns the payments under review, oldest first
+func (s *Store) GetEscalatedPayments() ([]model.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payments := make([]model.Payment, 0)
+	for _, p := range s.payments {
+		if p.Status == model.PaymentStatusReview {
+			payments = append(payments, *p)
+		}
+	}
+	return payments, nil
+}
+
+// CompletePayment credits a provider-confirmed payment to the user balance.
+// Repeated webhooks for the same payment are no-ops; completed reports whether
+// this call credited the balance.
+func (s *Store) CompletePayment(id int64, provider string, externalID string, providerAmount int64, currency string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.payment(id)
+	if p == nil {
+		return false, fmt.Errorf("payment not found")
+	}
+	if p.Provider != provider {
+		return false, fmt.Errorf("payment belongs to another provider")
+	}
+	if p.Status != model.PaymentStatusPending {
+		return false, nil
+	}
+	if currency != p.Currency || providerAmount < p.ProviderAmount {
+		return false, fmt.Errorf("paid %d %s, expected %d %s", providerAmount, currency, p.ProviderAmount, p.Currency)
+	}
+	for _, other := range s.payments {
+		if other.Provider == provider && other.ExternalID == externalID && other.Status == model.PaymentStatusCompleted {
+			return false, fmt.Errorf("UNIQUE constraint failed: payments.provider, payments.external_id")
+		}
+	}
+
+	now := time.Now().Unix()
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindPayment,
+		Reference: fmt.Sprintf("payment:%d", p.ID),
+		From:      systemAccount(model.LedgerAccountPayments),
+		To:        userAccount(p.UserID),
+		Amount:    p.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return false, err
+	}
+	p.Status = model.PaymentStatusCompleted
+	p.ExternalID = externalID
+	p.CompletedAt = &now
+
+	err = s.insertOperation(&model.Operation{
+		UserID:      p.UserID,
+		Type:        model.OperationTypeDeposit,
+		Amount:      p.Amount,
+		Description: fmt.Sprintf("Deposit via %s", provider),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"payment_id":      p.ID,
+			"provider":        provider,
+			"external_id":     externalID,
+			"provider_amount": providerAmount,
+			"currency":        currency,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
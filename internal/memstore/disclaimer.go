@@ -0,0 +1,71 @@
+package memstore
+
+import (
+	"fmt"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// riskAcknowledgment is a row of the risk_acknowledgments table
+type riskAcknowledgment struct {
+	model.RiskAcknowledgment
+	Token string
+}
+
+// CreateRiskAcknowledgment stores a risk acknowledgment with the token handed to the user
+func (s *Store) CreateRiskAcknowledgment(a *model.RiskAcknowledgment, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.acknowledgments {
+		if r.Token == token {
+			return fmt.Errorf("UNIQUE constraint failed: risk_acknowledgments.token")
+		}
+	}
+	a.ID = s.nextID("risk_acknowledgments")
+	s.acknowledgments = append(s.acknowledgments, &riskAcknowledgment{RiskAcknowledgment: *a, Token: token})
+	return nil
+}
+
+// UseRiskAcknowledgment atomically marks the unexpired acknowledgment of a token as used
+// and returns it. Each token can be used for one investment only.
+func (s *Store) UseRiskAcknowledgment(token string, userID int, investType string) (*model.RiskAcknowledgment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.acknowledgments {
+		if r.Token != token || r.UserID != userID || r.Type != investType || r.UsedAt != nil {
+			continue
+		}
+		now := time.Now().Unix()
+		if now > r.ExpiresAt {
+			return nil, fmt.Errorf("risk token expired")
+		}
+		r.UsedAt = &now
+		used := r.RiskAcknowledgment
+		return &used, nil
+	}
+	return nil, fmt.Errorf("risk token not found or already used")
+}
+
+// GetRiskAcknowledgments lists the risk acknowledgments of a user, newest first
+func (s *Store) GetRiskAcknowledgments(userID int) ([]model.RiskAcknowledgment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acknowledgments := make([]model.RiskAcknowledgment, 0)
+	for i := len(s.acknowledgments) - 1; i >= 0; i-- {
+		r := s.acknowledgments[i]
+		if r.UserID != userID {
+			continue
+		}
+		a := r.RiskAcknowledgment
+		if r.UsedAt != nil {
+			v := *r.UsedAt
+			a.UsedAt = &v
+		}
+		acknowledgments = append(acknowledgments, a)
+	}
+	return acknowledgments, nil
+}
@@ -0,0 +1,150 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// systemOperationTypes are recorded without user interaction and don't count as activity.
+// Investments closed by a policy are excluded through their closed_by marker.
+var systemOperationTypes = map[model.OperationType]bool{
+	model.OperationTypeInvestmentProfit: true,
+	model.OperationTypeGiftRefunded:     true,
+	model.OperationTypeDormancyNotice:   true,
+	model.OperationTypeDormancyAction:   true,
+}
+
+type dormancyKey struct {
+	UserID int
+	Rule   string
+}
+
+// GetInactiveUsers returns users whose last activity (app use or a user-initiated
+// operation) is before the given time
+func (s *Store) GetInactiveUsers(before int64) ([]model.DormantUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lastActive := make(map[int]int64, len(s.users))
+	for _, u := range s.users {
+		last := u.CreatedAt
+		if u.LastActiveAt != nil && *u.LastActiveAt > last {
+			last = *u.LastActiveAt
+		}
+		lastActive[u.ID] = last
+	}
+	for _, op := range s.operations {
+		last, ok := lastActive[op.UserID]
+		if !ok || op.CreatedAt <= last || systemOperationTypes[op.Type] {
+			continue
+		}
+		if _, closedByPolicy := op.extra()["closed_by"]; closedByPolicy {
+			continue
+		}
+		lastActive[op.UserID] = op.CreatedAt
+	}
+
+	var users []model.DormantUser
+	for id, last := range lastActive {
+		if last < before {
+			users = append(users, model.DormantUser{UserID: id, LastActiveAt: last})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+// RecordDormancyNotice stores the pre-notification of a rule and logs it as an operation
+func (s *Store) RecordDormancyNotice(userID int, rule model.DormancyRule, notification *model.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	s.dormancyNotices[dormancyKey{userID, rule.Name}] = &model.DormancyNotice{
+		UserID:     userID,
+		Rule:       rule.Name,
+		NotifiedAt: now,
+	}
+
+	s.addNotification(&model.Notification{
+		UserID: userID,
+		Kind:   notification.Kind,
+		Title:  notification.Title,
+		Body:   notification.Body,
+	}, now)
+
+	return s.insertOperation(&model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeDormancyNotice,
+		Amount:      0,
+		Description: notification.Body,
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"rule":          rule.Name,
+			"action":        rule.Action,
+			"inactive_days": rule.InactiveDays,
+			"grace_days":    rule.GraceDays,
+		},
+	})
+}
+
+// MarkDormancyExecuted records that a rule's action ran and logs it as an operation
+func (s *Store) MarkDormancyExecuted(userID int, rule model.DormancyRule, amount float64, details map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	if n, ok := s.dormancyNotices[dormancyKey{userID, rule.Name}]; ok {
+		executedAt := now
+		n.ExecutedAt = &executedAt
+	}
+
+	extra := map[string]interface{}{
+		"rule":   rule.Name,
+		"action": rule.Action,
+	}
+	for k, v := range details {
+		extra[k] = v
+	}
+
+	return s.insertOperation(&model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeDormancyAction,
+		Amount:      amount,
+		Description: "Inactivity policy applied: " + rule.Name,
+		CreatedAt:   now,
+		Extra:       extra,
+	})
+}
+
+// ClearDormancyNotice resets a rule once the user became active again
+func (s *Store) ClearDormancyNotice(userID int, rule string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.dormancyNotices, dormancyKey{userID, rule})
+	return nil
+}
+
+// GetDormancyNoticesByRule returns all notices of a rule
+func (s *Store) GetDormancyNoticesByRule(rule string) ([]model.DormancyNotice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notices []model.DormancyNotice
+	for key, n := range s.dormancyNotices {
+		if key.Rule != rule {
+			continue
+		}
+		notice := *n
+		if n.ExecutedAt != nil {
+			v := *n.ExecutedAt
+			notice.ExecutedAt = &v
+		}
+		notices = append(notices, notice)
+	}
+	sort.Slice(notices, func(i, j int) bool { return notices[i].UserID < notices[j].UserID })
+	return notices, nil
+}
@@ -0,0 +1,139 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// exposureKey identifies a row of the experiment_exposures table
+type exposureKey struct {
+	experiment string
+	userID     int
+}
+
+// RecordExperimentExposure logs that a user was shown an experiment. The first exposure
+// assigns the given variant; later ones keep the stored variant, which is returned.
+func (s *Store) RecordExperimentExposure(experiment string, userID int, variant string) (*model.ExperimentExposure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	key := exposureKey{experiment, userID}
+	e, ok := s.exposures[key]
+	if !ok {
+		e = &model.ExperimentExposure{
+			Experiment:     experiment,
+			UserID:         userID,
+			Variant:        variant,
+			FirstExposedAt: now,
+		}
+		s.exposures[key] = e
+	}
+	e.LastExposedAt = now
+	e.Exposures++
+
+	exposure := *e
+	return &exposure, nil
+}
+
+// GetExperimentExposure returns the variant assigned to a user, nil if the user was
+// never exposed to the experiment
+func (s *Store) GetExperimentExposure(experiment string, userID int) (*model.ExperimentExposure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exposures[exposureKey{experiment, userID}]
+	if !ok {
+		return nil, nil
+	}
+	exposure := *e
+	return &exposure, nil
+}
+
+// GetExperimentExposures returns the variants assigned in an experiment by user ID
+func (s *Store) GetExperimentExposures(experiment string) (map[int]model.ExperimentExposure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exposures := make(map[int]model.ExperimentExposure)
+	for key, e := range s.exposures {
+		if key.experiment == experiment {
+			exposures[key.userID] = *e
+		}
+	}
+	return exposures, nil
+}
+
+// GetExperimentStats counts per variant the exposed users, and the users who deposited
+// or invested into investType after their first exposure, with the amounts. Deposits
+// include top-ups of alternative payment rails. Conversions are left to the caller.
+func (s *Store) GetExperimentStats(experiment string, investType string) ([]model.ExperimentVariantStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byVariant := make(map[string]*model.ExperimentVariantStats)
+	exposures := make(map[int]*model.ExperimentExposure)
+	for key, e := range s.exposures {
+		if key.experiment != experiment {
+			continue
+		}
+		st, ok := byVariant[e.Variant]
+		if !ok {
+			st = &model.ExperimentVariantStats{Variant: e.Variant}
+			byVariant[e.Variant] = st
+		}
+		st.Users++
+		st.Exposures += e.Exposures
+		exposures[key.userID] = e
+	}
+
+	depositors := make(map[int]bool)
+	for _, entry := range s.ledger {
+		if entry.Account != model.LedgerAccountUser || entry.Credit <= 0 ||
+			(entry.Kind != model.LedgerKindDeposit && entry.Kind != model.LedgerKindPayment) {
+			continue
+		}
+		e, ok := exposures[*entry.UserID]
+		if !ok || entry.CreatedAt < e.FirstExposedAt {
+			continue
+		}
+		st := byVariant[e.Variant]
+		if !depositors[e.UserID] {
+			depositors[e.UserID] = true
+			st.Depositors++
+		}
+		st.Deposited += entry.Credit
+	}
+
+	investors := make(map[int]bool)
+	invested := func(userID int, typ string, amount float64, createdAt int64) {
+		e, ok := exposures[userID]
+		if !ok || typ != investType || createdAt < e.FirstExposedAt {
+			return
+		}
+		st := byVariant[e.Variant]
+		if !investors[userID] {
+			investors[userID] = true
+			st.Investors++
+		}
+		st.Invested += amount
+	}
+	for _, inv := range s.investments {
+		invested(inv.UserID, inv.Type, inv.Amount, inv.CreatedAt)
+	}
+	for _, inv := range s.closedInvestments {
+		invested(inv.UserID, inv.Type, inv.Amount, inv.CreatedAt)
+	}
+
+	stats := make([]model.ExperimentVariantStats, 0, len(byVariant))
+	for _, st := range byVariant {
+		st.Deposited = money.Round(st.Deposited)
+		st.Invested = money.Round(st.Invested)
+		stats = append(stats, *st)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Variant < stats[j].Variant })
+	return stats, nil
+}
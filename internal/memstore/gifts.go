@@ -0,0 +1,221 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+func copyGift(g *model.Gift) *model.Gift {
+	gift := *g
+	gift.RecipientID = copyInt(g.RecipientID)
+	if g.ClaimedAt != nil {
+		v := *g.ClaimedAt
+		gift.ClaimedAt = &v
+	}
+	return &gift
+}
+
+func (s *Store) giftByCode(code string) *model.Gift {
+	for _, g := range s.gifts {
+		if g.Code == code {
+			return g
+		}
+	}
+	return nil
+}
+
+// CreateGift takes the gift amount from the sender balance and stores the gift with its claim code
+func (s *Store) CreateGift(senderID int, code string, investType string, amount float64, expiresAt int64) (*model.Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[senderID]
+	if !ok || u.Balance < amount {
+		return nil, fmt.Errorf("insufficient balance")
+	}
+	if s.giftByCode(code) != nil {
+		return nil, fmt.Errorf("UNIQUE constraint failed: gifts.code")
+	}
+
+	now := time.Now().Unix()
+	gift := &model.Gift{
+		ID:        s.nextID("gifts"),
+		Code:      code,
+		SenderID:  senderID,
+		Amount:    amount,
+		Type:      investType,
+		Status:    model.GiftStatusActive,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindGiftSent,
+		Reference: fmt.Sprintf("gift:%d", gift.ID),
+		From:      userAccount(senderID),
+		To:        systemAccount(model.LedgerAccountGifts),
+		Amount:    amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.gifts = append(s.gifts, gift)
+
+	err = s.insertOperation(&model.Operation{
+		UserID:      senderID,
+		Type:        model.OperationTypeGiftSent,
+		Amount:      amount,
+		Description: fmt.Sprintf("Sent %s investment gift", investType),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"gift_id": gift.ID,
+			"type":    investType,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copyGift(gift), nil
+}
+
+// GetGiftByCode returns a gift by its claim code
+func (s *Store) GetGiftByCode(code string) (*model.Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.giftByCode(code)
+	if g == nil {
+		return nil, sql.ErrNoRows
+	}
+	return copyGift(g), nil
+}
+
+// GetGiftsBySender lists gifts sent by a user, newest first
+func (s *Store) GetGiftsBySender(senderID int) ([]model.Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gifts := make([]model.Gift, 0)
+	for _, g := range s.gifts {
+		if g.SenderID == senderID {
+			gifts = append(gifts, *copyGift(g))
+		}
+	}
+	sort.SliceStable(gifts, func(i, j int) bool { return gifts[i].CreatedAt > gifts[j].CreatedAt })
+	return gifts, nil
+}
+
+// ClaimGift marks an active gift as claimed and opens the gifted investment for the recipient
+func (s *Store) ClaimGift(code string, recipientID int, config model.InvestmentTypeConfig) (*model.Gift, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gift := s.giftByCode(code)
+	if gift == nil {
+		return nil, fmt.Errorf("gift not found")
+	}
+
+	now := time.Now().Unix()
+	if gift.Status != model.GiftStatusActive {
+		return nil, fmt.Errorf("gift is already %s", gift.Status)
+	}
+	if now > gift.ExpiresAt {
+		return nil, fmt.Errorf("gift has expired")
+	}
+	if gift.SenderID == recipientID {
+		return nil, fmt.Errorf("you can't claim your own gift")
+	}
+
+	gift.Status = model.GiftStatusClaimed
+	gift.RecipientID = &recipientID
+	gift.ClaimedAt = &now
+
+	investmentID := s.nextID("investments")
+	s.investments = append(s.investments, &model.Investment{
+		ID:        int(investmentID),
+		UserID:    recipientID,
+		Type:      gift.Type,
+		Amount:    gift.Amount,
+		CreatedAt: now,
+	})
+
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindGiftClaimed,
+		Reference: fmt.Sprintf("gift:%d", gift.ID),
+		From:      systemAccount(model.LedgerAccountGifts),
+		To:        systemAccount(model.LedgerAccountInvestments),
+		Amount:    gift.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.insertOperation(&model.Operation{
+		UserID:      recipientID,
+		Type:        model.OperationTypeGiftClaimed,
+		Amount:      gift.Amount,
+		Description: fmt.Sprintf("Claimed %s investment gift", gift.Type),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"gift_id":        gift.ID,
+			"sender_id":      gift.SenderID,
+			"investment_id":  investmentID,
+			"type":           gift.Type,
+			"weekly_percent": config.WeeklyPercent,
+			"lock_period":    config.LockPeriod,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return copyGift(gift), nil
+}
+
+// RefundExpiredGifts returns the amount of unclaimed expired gifts to their senders.
+// Returns the number of refunded gifts.
+func (s *Store) RefundExpiredGifts(now int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refunded := 0
+	for _, gift := range s.gifts {
+		if gift.Status != model.GiftStatusActive || gift.ExpiresAt >= now {
+			continue
+		}
+		err := s.postTransfer(ledgerTransfer{
+			Kind:      model.LedgerKindGiftRefunded,
+			Reference: fmt.Sprintf("gift:%d", gift.ID),
+			From:      systemAccount(model.LedgerAccountGifts),
+			To:        userAccount(gift.SenderID),
+			Amount:    gift.Amount,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return refunded, err
+		}
+		gift.Status = model.GiftStatusRefunded
+
+		err = s.insertOperation(&model.Operation{
+			UserID:      gift.SenderID,
+			Type:        model.OperationTypeGiftRefunded,
+			Amount:      gift.Amount,
+			Description: fmt.Sprintf("Refund of unclaimed %s investment gift", gift.Type),
+			CreatedAt:   now,
+			Extra: map[string]interface{}{
+				"gift_id": gift.ID,
+			},
+		})
+		if err != nil {
+			return refunded, err
+		}
+		refunded++
+	}
+	return refunded, nil
+}
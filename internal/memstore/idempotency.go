@@ -0,0 +1,62 @@
+package memstore
+
+import "tonapp/internal/model"
+
+// idempotencyKey identifies an Idempotency-Key of a client
+type idempotencyKey struct {
+	scope string
+	key   string
+}
+
+// ClaimIdempotencyKey stores a record for a new key and returns nil, or returns the
+// record of a key already claimed. A record created before expiredBefore no longer
+// counts and is replaced.
+func (s *Store) ClaimIdempotencyKey(record *model.IdempotencyRecord, expiredBefore int64) (*model.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{record.Scope, record.Key}
+	if existing, ok := s.idempotencyKeys[k]; ok && existing.CreatedAt >= expiredBefore {
+		copied := *existing
+		return &copied, nil
+	}
+	stored := *record
+	stored.Status, stored.ContentType, stored.Body = 0, "", nil
+	s.idempotencyKeys[k] = &stored
+	return nil, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that claimed a key
+func (s *Store) CompleteIdempotencyKey(scope, key string, status int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.idempotencyKeys[idempotencyKey{scope, key}]; ok {
+		r.Status, r.ContentType, r.Body = status, contentType, append([]byte(nil), body...)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a key whose request ended without a response
+func (s *Store) ReleaseIdempotencyKey(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotencyKeys, idempotencyKey{scope, key})
+	return nil
+}
+
+// DeleteIdempotencyKeysBefore removes the keys created before a unix time
+func (s *Store) DeleteIdempotencyKeysBefore(before int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for k, r := range s.idempotencyKeys {
+		if r.CreatedAt < before {
+			delete(s.idempotencyKeys, k)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,167 @@
+package memstore
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tonapp/internal/model"
+)
+
+// integrityFinding adds a record to a check, keeping at most sampleSize samples
+func integrityFinding(check *model.IntegrityCheck, sampleSize int, sample model.IntegritySample) {
+	check.Count++
+	if len(check.Samples) < sampleSize {
+		check.Samples = append(check.Samples, sample)
+	}
+}
+
+// pendingWithTxHash reports whether a withdrawal was sent but is still pending
+func pendingWithTxHash(w *model.WithdrawalStorage) bool {
+	return (w.Status == statusPending || w.Status == statusProcessing) && w.TxHash != ""
+}
+
+// CheckIntegrity runs the integrity checks, listing up to sampleSize records of each
+func (s *Store) CheckIntegrity(sampleSize int) ([]model.IntegrityCheck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newCheck := func(name string, tables ...string) model.IntegrityCheck {
+		return model.IntegrityCheck{Name: name, Tables: tables, Samples: make([]model.IntegritySample, 0)}
+	}
+
+	operations := newCheck(model.IntegrityOrphanedOperations, "operations", "operation_annotations", "operation_tags")
+	for _, op := range s.operations {
+		if _, ok := s.users[op.UserID]; !ok {
+			integrityFinding(&operations, sampleSize, model.IntegritySample{
+				ID: op.ID, UserID: op.UserID, Amount: op.Amount, Detail: string(op.Type),
+			})
+		}
+	}
+
+	earnings := newCheck(model.IntegrityOrphanedEarnings, "referral_earnings")
+	for _, e := range s.referralEarnings {
+		if _, ok := s.users[e.ReferrerID]; !ok {
+			integrityFinding(&earnings, sampleSize, model.IntegritySample{
+				ID: e.ID, UserID: e.ReferrerID, Amount: e.Amount,
+				Detail: fmt.Sprintf("level %d earning on user %d", e.Level, e.ReferredID),
+			})
+		}
+	}
+
+	var negative []*user
+	for _, u := range s.users {
+		if u.Balance < -ledgerTolerance {
+			negative = append(negative, u)
+		}
+	}
+	sort.Slice(negative, func(i, j int) bool { return negative[i].Balance < negative[j].Balance })
+	balances := newCheck(model.IntegrityNegativeBalances, "users")
+	for _, u := range negative {
+		integrityFinding(&balances, sampleSize, model.IntegritySample{
+			ID: int64(u.ID), UserID: u.ID, Amount: u.Balance, Detail: u.PubKey,
+		})
+	}
+
+	pending := newCheck(model.IntegrityPendingWithdrawalsWithTxHash, "withdrawals")
+	for _, w := range s.withdrawals {
+		if pendingWithTxHash(w) {
+			integrityFinding(&pending, sampleSize, model.IntegritySample{
+				ID: int64(w.ID), UserID: w.UserID, Amount: w.Amount,
+				Detail: fmt.Sprintf("%s, tx %s", w.Status, w.TxHash),
+			})
+		}
+	}
+
+	unsettled := newCheck(model.IntegrityUnsettledWithdrawalsWithTxHash, "withdrawal_requests", "withdrawal_queue")
+	for _, w := range s.withdrawalRequests {
+		open := w.Status == statusPending || w.Status == model.WithdrawalStatusPendingApproval || w.Status == model.WithdrawalStatusSending
+		if open && w.TxHash != "" {
+			integrityFinding(&unsettled, sampleSize, model.IntegritySample{
+				ID: w.ID, UserID: w.UserID, Amount: w.Amount,
+				Detail: fmt.Sprintf("withdrawal_requests %s, tx %s", w.Status, w.TxHash),
+			})
+		}
+	}
+	for _, w := range s.queue {
+		if queueOpen(w.Status) && w.TxHash != "" {
+			integrityFinding(&unsettled, sampleSize, model.IntegritySample{
+				ID: w.ID, UserID: w.UserID, Amount: w.Amount,
+				Detail: fmt.Sprintf("withdrawal_queue %s, tx %s", w.Status, w.TxHash),
+			})
+		}
+	}
+
+	byPubKey := make(map[string][]int)
+	for id, u := range s.users {
+		key := strings.ToLower(u.PubKey)
+		byPubKey[key] = append(byPubKey[key], id)
+	}
+	var duplicates []string
+	for key, ids := range byPubKey {
+		if len(ids) > 1 {
+			sort.Ints(ids)
+			duplicates = append(duplicates, key)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool { return byPubKey[duplicates[i]][0] < byPubKey[duplicates[j]][0] })
+	pubKeys := newCheck(model.IntegrityDuplicatePubKeys, "users")
+	for _, key := range duplicates {
+		ids := make([]string, len(byPubKey[key]))
+		for i, id := range byPubKey[key] {
+			ids[i] = strconv.Itoa(id)
+		}
+		integrityFinding(&pubKeys, sampleSize, model.IntegritySample{
+			UserID: byPubKey[key][0], Detail: fmt.Sprintf("%s: users %s", key, strings.Join(ids, ", ")),
+		})
+	}
+
+	return []model.IntegrityCheck{operations, earnings, balances, pending, unsettled, pubKeys}, nil
+}
+
+// RepairIntegrity fixes what an integrity check with an automatic repair found and
+// returns the number of records repaired
+func (s *Store) RepairIntegrity(check string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repaired := 0
+	switch check {
+	case model.IntegrityOrphanedOperations:
+		for id, a := range s.annotations {
+			if _, ok := s.users[a.UserID]; !ok {
+				delete(s.annotations, id)
+			}
+		}
+		operations := s.operations[:0]
+		for _, op := range s.operations {
+			if _, ok := s.users[op.UserID]; ok {
+				operations = append(operations, op)
+			} else {
+				repaired++
+			}
+		}
+		s.operations = operations
+	case model.IntegrityOrphanedEarnings:
+		earnings := s.referralEarnings[:0]
+		for _, e := range s.referralEarnings {
+			if _, ok := s.users[e.ReferrerID]; ok {
+				earnings = append(earnings, e)
+			} else {
+				repaired++
+			}
+		}
+		s.referralEarnings = earnings
+	case model.IntegrityPendingWithdrawalsWithTxHash:
+		for _, w := range s.withdrawals {
+			if pendingWithTxHash(w) {
+				w.Status = statusCompleted
+				repaired++
+			}
+		}
+	default:
+		return 0, fmt.Errorf("%s has no automatic repair", check)
+	}
+	return repaired, nil
+}
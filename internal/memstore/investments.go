@@ -0,0 +1,388 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// userInvestments returns the open investments of a user. Like the database it
+// leaves out the accrual cursor.
+// closedInvestment is a row of the closed_investments table
+type closedInvestment struct {
+	UserID int
+	model.HistoricalInvestment
+}
+
+func (s *Store) userInvestments(userID int) []model.Investment {
+	var investments []model.Investment
+	for _, inv := range s.investments {
+		if inv.UserID == userID {
+			i := *inv
+			i.LastAccruedAt = 0
+			investments = append(investments, i)
+		}
+	}
+	return investments
+}
+
+// CreateInvestment moves the amount from the user balance into a new investment
+func (s *Store) CreateInvestment(userID int, investType string, amount float64, config model.InvestmentTypeConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if u.Balance < amount {
+		return fmt.Errorf("insufficient balance")
+	}
+
+	now := time.Now().Unix()
+	investmentID := s.nextID("investments")
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindInvestmentCreated,
+		Reference: fmt.Sprintf("investment:%d", investmentID),
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountInvestments),
+		Amount:    amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	s.investments = append(s.investments, &model.Investment{
+		ID:        int(investmentID),
+		UserID:    userID,
+		Type:      investType,
+		Amount:    amount,
+		CreatedAt: now,
+	})
+
+	return s.insertOperation(&model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeInvestmentCreated,
+		Amount:      amount,
+		Description: fmt.Sprintf("Created %s investment", investType),
+		CreatedAt:   now,
+		Extra: map[string]interface{}{
+			"type":           investType,
+			"weekly_percent": config.WeeklyPercent,
+			"lock_period":    config.LockPeriod,
+		},
+	})
+}
+
+// DeleteInvestment closes an investment of the user and returns its amount to the balance
+func (s *Store) DeleteInvestment(userID int, investmentID int64) error {
+	return s.closeInvestment(userID, investmentID, "")
+}
+
+// CloseInvestmentByPolicy closes an investment on behalf of the platform.
+// The closing operation records closedBy so it isn't mistaken for user activity.
+func (s *Store) CloseInvestmentByPolicy(userID int, investmentID int64, closedBy string) error {
+	return s.closeInvestment(userID, investmentID, closedBy)
+}
+
+func (s *Store) closeInvestment(userID int, investmentID int64, closedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i, inv := range s.investments {
+		if int64(inv.ID) == investmentID && inv.UserID == userID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("investment not found")
+	}
+	investment := *s.investments[index]
+
+	now := time.Now().Unix()
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindInvestmentClosed,
+		Reference: fmt.Sprintf("investment:%d", investmentID),
+		From:      systemAccount(model.LedgerAccountInvestments),
+		To:        userAccount(userID),
+		Amount:    investment.Amount,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	s.investments = append(s.investments[:index], s.investments[index+1:]...)
+	s.closedInvestments = append(s.closedInvestments, closedInvestment{
+		UserID: userID,
+		HistoricalInvestment: model.HistoricalInvestment{
+			ID:        investmentID,
+			Type:      investment.Type,
+			Amount:    investment.Amount,
+			CreatedAt: investment.CreatedAt,
+			ClosedAt:  &now,
+			ClosedBy:  closedBy,
+		},
+	})
+
+	extra := map[string]interface{}{
+		"type":               investment.Type,
+		"investment_id":      investmentID,
+		"investment_created": investment.CreatedAt,
+		"duration_days":      (now - investment.CreatedAt) / 86400,
+	}
+	if closedBy != "" {
+		extra["closed_by"] = closedBy
+	}
+
+	return s.insertOperation(&model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeInvestmentClosed,
+		Amount:      investment.Amount,
+		Description: fmt.Sprintf("Closed %s investment", investment.Type),
+		CreatedAt:   now,
+		Extra:       extra,
+	})
+}
+
+// GetUserInvestments returns the open investments of a user
+func (s *Store) GetUserInvestments(userID int) ([]model.Investment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.userInvestments(userID), nil
+}
+
+// GetOpenInvestments returns all open investments including their accrual cursor
+func (s *Store) GetOpenInvestments() ([]model.Investment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var investments []model.Investment
+	for _, inv := range s.investments {
+		investments = append(investments, *inv)
+	}
+	return investments, nil
+}
+
+// GetInvestmentsDueForAccrual returns investments whose last accrual
+// (or creation, if never accrued) happened at or before the given time
+func (s *Store) GetInvestmentsDueForAccrual(before int64) ([]model.Investment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var investments []model.Investment
+	for _, inv := range s.investments {
+		last := inv.CreatedAt
+		if inv.LastAccruedAt > 0 {
+			last = inv.LastAccruedAt
+		}
+		if last <= before {
+			investments = append(investments, *inv)
+		}
+	}
+	return investments, nil
+}
+
+// AccrueInvestmentProfit credits net profit of one accrual period to the user,
+// moves the investment accrual cursor to periodEnd and records the operation
+func (s *Store) AccrueInvestmentProfit(inv model.Investment, grossProfit, fee float64, weeklyPercent float64, periodEnd int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored *model.Investment
+	for _, i := range s.investments {
+		if i.ID == inv.ID && i.LastAccruedAt == inv.LastAccruedAt {
+			stored = i
+			break
+		}
+	}
+	if stored == nil {
+		return fmt.Errorf("investment %d was already accrued", inv.ID)
+	}
+
+	netProfit := money.Round(grossProfit - fee)
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindInvestmentProfit,
+		Reference: fmt.Sprintf("investment:%d", inv.ID),
+		From:      systemAccount(model.LedgerAccountProfit),
+		To:        userAccount(inv.UserID),
+		Amount:    netProfit,
+		CreatedAt: periodEnd,
+	})
+	if err != nil {
+		return err
+	}
+	stored.LastAccruedAt = periodEnd
+
+	return s.insertOperation(&model.Operation{
+		UserID:      inv.UserID,
+		Type:        model.OperationTypeInvestmentProfit,
+		Amount:      netProfit,
+		Description: fmt.Sprintf("Profit from %s investment", inv.Type),
+		CreatedAt:   periodEnd,
+		Extra: map[string]interface{}{
+			"investment_id":  inv.ID,
+			"type":           inv.Type,
+			"weekly_percent": weeklyPercent,
+			"gross_profit":   grossProfit,
+			"fee":            fee,
+			"period_end":     periodEnd,
+		},
+	})
+}
+
+// GetInvestmentProfitStats returns all open investments with the gross profit
+// distributed to them so far, read from investment_profit operations
+func (s *Store) GetInvestmentProfitStats() ([]model.InvestmentProfitStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]model.InvestmentProfitStat, 0, len(s.investments))
+	for _, inv := range s.investments {
+		stat := model.InvestmentProfitStat{Investment: *inv}
+		stat.LastAccruedAt = 0
+		for _, op := range s.operations {
+			if op.Type != model.OperationTypeInvestmentProfit || op.UserID != inv.UserID {
+				continue
+			}
+			extra := op.extra()
+			if id, ok := extra["investment_id"].(float64); !ok || int(id) != inv.ID {
+				continue
+			}
+			if gross, ok := extra["gross_profit"].(float64); ok {
+				stat.DistributedProfit += gross
+			} else {
+				stat.DistributedProfit += op.Amount
+			}
+			stat.Accruals++
+		}
+		stats = append(stats, stat)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].CreatedAt < stats[j].CreatedAt })
+	return stats, nil
+}
+
+// GetProfitAccrualsSince returns investment_profit operations recorded since the given time
+func (s *Store) GetProfitAccrualsSince(since int64) ([]model.ProfitAccrual, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var accruals []model.ProfitAccrual
+	for _, op := range s.operations {
+		if op.Type != model.OperationTypeInvestmentProfit || op.CreatedAt < since {
+			continue
+		}
+		extra := op.extra()
+		a := model.ProfitAccrual{
+			UserID:      op.UserID,
+			NetProfit:   op.Amount,
+			GrossProfit: op.Amount,
+			CreatedAt:   op.CreatedAt,
+		}
+		a.Type, _ = extra["type"].(string)
+		if gross, ok := extra["gross_profit"].(float64); ok {
+			a.GrossProfit = gross
+		}
+		a.Fee, _ = extra["fee"].(float64)
+		a.WeeklyPercent, _ = extra["weekly_percent"].(float64)
+		accruals = append(accruals, a)
+	}
+	sort.SliceStable(accruals, func(i, j int) bool { return accruals[i].CreatedAt < accruals[j].CreatedAt })
+	return accruals, nil
+}
+
+// SetInvestmentPause stores incident switches for a scope.
+// A scope with both switches off is removed.
+func (s *Store) SetInvestmentPause(scope string, pauseInvestments, pauseAccrual bool, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !pauseInvestments && !pauseAccrual {
+		delete(s.pauses, scope)
+		return nil
+	}
+	s.pauses[scope] = model.InvestmentPause{
+		Scope:            scope,
+		PauseInvestments: pauseInvestments,
+		PauseAccrual:     pauseAccrual,
+		Reason:           reason,
+		UpdatedAt:        time.Now().Unix(),
+	}
+	return nil
+}
+
+// GetInvestmentPauses returns all active incident switches
+func (s *Store) GetInvestmentPauses() ([]model.InvestmentPause, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pauses := make([]model.InvestmentPause, 0, len(s.pauses))
+	for _, p := range s.pauses {
+		pauses = append(pauses, p)
+	}
+	sort.Slice(pauses, func(i, j int) bool { return pauses[i].Scope < pauses[j].Scope })
+	return pauses, nil
+}
+
+// termsAcceptance is a row of the terms_acceptances table
+type termsAcceptance struct {
+	UserID int
+	IP     string
+	model.TermsAcceptance
+}
+
+// AcceptTerms records that a user acknowledged a terms version; accepting twice is a no-op
+func (s *Store) AcceptTerms(userID int, investType string, version string, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.terms {
+		if a.UserID == userID && a.Type == investType && a.Version == version {
+			return nil
+		}
+	}
+	s.terms = append(s.terms, termsAcceptance{
+		UserID: userID,
+		IP:     ip,
+		TermsAcceptance: model.TermsAcceptance{
+			Type:       investType,
+			Version:    version,
+			AcceptedAt: time.Now().Unix(),
+		},
+	})
+	return nil
+}
+
+// HasAcceptedTerms reports whether the user accepted any terms version of an investment type
+func (s *Store) HasAcceptedTerms(userID int, investType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.terms {
+		if a.UserID == userID && a.Type == investType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GetTermsAcceptances lists the terms versions accepted by a user
+func (s *Store) GetTermsAcceptances(userID int) ([]model.TermsAcceptance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acceptances := make([]model.TermsAcceptance, 0)
+	for _, a := range s.terms {
+		if a.UserID == userID {
+			acceptances = append(acceptances, a.TermsAcceptance)
+		}
+	}
+	sort.SliceStable(acceptances, func(i, j int) bool { return acceptances[i].AcceptedAt > acceptances[j].AcceptedAt })
+	return acceptances, nil
+}
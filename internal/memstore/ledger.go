@@ -0,0 +1,345 @@
+package memstore
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/pagination"
+)
+
+// ledgerTolerance is the largest difference put down to floating point rounding, as in the database
+const ledgerTolerance = 1e-9
+
+// ledgerAccount is an account of the ledger. User accounts carry the user ID.
+type ledgerAccount struct {
+	name   string
+	userID int
+}
+
+func userAccount(userID int) ledgerAccount {
+	return ledgerAccount{name: model.LedgerAccountUser, userID: userID}
+}
+
+func systemAccount(name string) ledgerAccount {
+	return ledgerAccount{name: name}
+}
+
+func (a ledgerAccount) isUser() bool {
+	return a.name == model.LedgerAccountUser
+}
+
+// ledgerTransfer moves Amount from one account to another.
+// A negative amount moves it the other way.
+type ledgerTransfer struct {
+	Kind      string
+	Reference string
+	From      ledgerAccount
+	To        ledgerAccount
+	Amount    float64
+	Wallet    string // treasury wallet of external transfers, empty for the main wallet
+	CreatedAt int64  // now if not set
+}
+
+// postTransfer applies a transfer to the user balances involved and records it in the ledger.
+// Debiting a user fails with "insufficient balance" when the balance doesn't cover the amount.
+func (s *Store) postTransfer(t ledgerTransfer) error {
+	if t.Amount < 0 {
+		t.From, t.To, t.Amount = t.To, t.From, -t.Amount
+	}
+	if t.Amount == 0 {
+		return nil
+	}
+
+	var from, to *user
+	if t.From.isUser() {
+		from = s.users[t.From.userID]
+		if from == nil || from.Balance < t.Amount {
+			return fmt.Errorf("insufficient balance")
+		}
+	}
+	if t.To.isUser() {
+		to = s.users[t.To.userID]
+		if to == nil {
+			return fmt.Errorf("user %d not found", t.To.userID)
+		}
+	}
+	if from != nil {
+		from.Balance -= t.Amount
+	}
+	if to != nil {
+		to.Balance += t.Amount
+	}
+
+	if t.CreatedAt == 0 {
+		t.CreatedAt = time.Now().Unix()
+	}
+	transferID := s.nextID("ledger_transfers")
+	for _, side := range []struct {
+		account       ledgerAccount
+		debit, credit float64
+	}{
+		{t.From, t.Amount, 0},
+		{t.To, 0, t.Amount},
+	} {
+		entry := model.LedgerEntry{
+			ID:         s.nextID("ledger_entries"),
+			TransferID: transferID,
+			Account:    side.account.name,
+			Debit:      side.debit,
+			Credit:     side.credit,
+			Kind:       t.Kind,
+			Reference:  t.Reference,
+			Wallet:     t.Wallet,
+			CreatedAt:  t.CreatedAt,
+		}
+		if side.account.isUser() {
+			entry.UserID = copyInt(&side.account.userID)
+		}
+		s.ledger = append(s.ledger, entry)
+	}
+	return nil
+}
+
+// GetUserLedger returns a page of the ledger entries of a user account, newest first,
+// with the account balance according to the ledger
+func (s *Store) GetUserLedger(userID int, page pagination.Params) (*model.LedgerHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := &model.LedgerHistory{
+		Entries:  make([]model.LedgerEntry, 0),
+		PageSize: page.Limit,
+	}
+	for i := len(s.ledger) - 1; i >= 0; i-- {
+		e := s.ledger[i]
+		if e.Account != model.LedgerAccountUser || *e.UserID != userID {
+			continue
+		}
+		history.Balance += e.Credit - e.Debit
+		if page.After == nil || e.ID < page.After.ID {
+			e.UserID = copyInt(e.UserID)
+			history.Entries = append(history.Entries, e)
+		}
+	}
+
+	history.Balance = money.Round(history.Balance)
+	history.Entries, history.NextCursor = pagination.Trim(limit(history.Entries, page), page, func(e model.LedgerEntry) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+	return history, nil
+}
+
+// GetBalanceAsOf reconstructs the balance and open investments of a user at a past time.
+// The ledger of the store covers its whole life, so the balance always comes from it.
+func (s *Store) GetBalanceAsOf(userID int, at int64) (*model.BalanceAsOf, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &model.BalanceAsOf{
+		UserID:      userID,
+		At:          at,
+		Source:      model.BalanceSourceLedger,
+		Investments: make([]model.HistoricalInvestment, 0),
+	}
+	for _, e := range s.ledger {
+		if e.Account != model.LedgerAccountUser || *e.UserID != userID || e.CreatedAt > at {
+			continue
+		}
+		result.Balance += e.Credit - e.Debit
+		result.LedgerEntries++
+	}
+	result.Balance = money.Round(result.Balance)
+
+	for _, snapshot := range s.snapshots {
+		if snapshot.UserID == userID && snapshot.CreatedAt <= at &&
+			(result.Snapshot == nil || snapshot.CreatedAt > result.Snapshot.CreatedAt) {
+			snapshot := snapshot
+			result.Snapshot = &snapshot
+		}
+	}
+
+	for _, inv := range s.investments {
+		if inv.UserID == userID && inv.CreatedAt <= at {
+			result.Investments = append(result.Investments, model.HistoricalInvestment{
+				ID:        int64(inv.ID),
+				Type:      inv.Type,
+				Amount:    inv.Amount,
+				CreatedAt: inv.CreatedAt,
+			})
+		}
+	}
+	for _, inv := range s.closedInvestments {
+		if inv.UserID == userID && inv.CreatedAt <= at && *inv.ClosedAt > at {
+			h := inv.HistoricalInvestment
+			closedAt := *h.ClosedAt
+			h.ClosedAt = &closedAt
+			result.Investments = append(result.Investments, h)
+		}
+	}
+	sort.Slice(result.Investments, func(i, j int) bool {
+		a, b := result.Investments[i], result.Investments[j]
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt < b.CreatedAt
+		}
+		return a.ID < b.ID
+	})
+	for _, inv := range result.Investments {
+		result.Invested += inv.Amount
+	}
+	result.Invested = money.Round(result.Invested)
+
+	return result, nil
+}
+
+// ReconcileLedger verifies that every user balance equals the sum of its ledger account
+// and that the investment, gift and withdrawal queue accounts hold what they should
+func (s *Store) ReconcileLedger() (*model.LedgerReconciliation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &model.LedgerReconciliation{
+		CheckedAt:  time.Now().Unix(),
+		Accounts:   make([]model.LedgerAccountBalance, 0),
+		Mismatches: make([]model.LedgerMismatch, 0),
+	}
+
+	accounts := make(map[string]*model.LedgerAccountBalance)
+	userBalances := make(map[int]float64)
+	for _, e := range s.ledger {
+		report.Total += e.Credit - e.Debit
+		if e.Account == model.LedgerAccountUser {
+			report.Users += e.Credit - e.Debit
+			userBalances[*e.UserID] += e.Credit - e.Debit
+			continue
+		}
+		a, ok := accounts[e.Account]
+		if !ok {
+			a = &model.LedgerAccountBalance{Account: e.Account}
+			accounts[e.Account] = a
+		}
+		a.Balance += e.Credit - e.Debit
+		a.Entries++
+	}
+
+	held := map[string]float64{
+		model.LedgerAccountInvestments:        0,
+		model.LedgerAccountGifts:              0,
+		model.LedgerAccountWithdrawalQueue:    0,
+		model.LedgerAccountWithdrawalApproval: 0,
+	}
+	for _, inv := range s.investments {
+		held[model.LedgerAccountInvestments] += inv.Amount
+	}
+	for _, g := range s.gifts {
+		if g.Status == model.GiftStatusActive {
+			held[model.LedgerAccountGifts] += g.Amount
+		}
+	}
+	for _, w := range s.queue {
+		if queueOpen(w.Status) {
+			held[model.LedgerAccountWithdrawalQueue] += w.Amount
+		}
+	}
+	for _, w := range s.withdrawalRequests {
+		if w.Status == model.WithdrawalStatusPendingApproval || w.Status == model.WithdrawalStatusSending {
+			held[model.LedgerAccountWithdrawalApproval] += w.Amount
+		}
+	}
+
+	balanced := math.Abs(report.Total) <= ledgerTolerance
+	report.Total = money.Round(report.Total)
+	report.Users = money.Round(report.Users)
+	for _, a := range accounts {
+		a.Balance = money.Round(a.Balance)
+		if expected, ok := held[a.Account]; ok {
+			a.Expected = &expected
+			if math.Abs(a.Balance-expected) > ledgerTolerance {
+				balanced = false
+			}
+		}
+		report.Accounts = append(report.Accounts, *a)
+	}
+	sort.Slice(report.Accounts, func(i, j int) bool { return report.Accounts[i].Account < report.Accounts[j].Account })
+
+	for id, u := range s.users {
+		if math.Abs(u.Balance-userBalances[id]) > ledgerTolerance {
+			report.Mismatches = append(report.Mismatches, model.LedgerMismatch{
+				UserID:        id,
+				Balance:       u.Balance,
+				LedgerBalance: money.Round(userBalances[id]),
+				Difference:    money.Round(u.Balance - userBalances[id]),
+			})
+		}
+	}
+	for id, balance := range userBalances {
+		if _, ok := s.users[id]; !ok && math.Abs(balance) > ledgerTolerance {
+			report.Mismatches = append(report.Mismatches, model.LedgerMismatch{
+				UserID:        id,
+				LedgerBalance: money.Round(balance),
+				Difference:    money.Round(-balance),
+			})
+		}
+	}
+	sort.Slice(report.Mismatches, func(i, j int) bool { return report.Mismatches[i].UserID < report.Mismatches[j].UserID })
+
+	report.Balanced = balanced && len(report.Mismatches) == 0
+	return report, nil
+}
+
+// GetTreasuryHoldings returns, per treasury wallet other than the main wallet, what the
+// user deposited through it minus what was withdrawn from it to the user
+func (s *Store) GetTreasuryHoldings(userID int) (map[string]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	holdings := make(map[string]float64)
+	for _, e := range s.ledger {
+		if e.Account == model.LedgerAccountUser && *e.UserID == userID && e.Wallet != "" {
+			holdings[e.Wallet] += e.Credit - e.Debit
+		}
+	}
+	for _, w := range s.queue {
+		if w.UserID == userID && w.Status == model.QueueStatusSent && w.TreasuryWallet != "" {
+			holdings[w.TreasuryWallet] -= w.Amount
+		}
+	}
+	for wallet, amount := range holdings {
+		holdings[wallet] = money.Round(amount)
+	}
+	return holdings, nil
+}
+
+// GetTreasuryWalletFlows returns the deposits received and withdrawals sent per treasury
+// wallet according to the ledger
+func (s *Store) GetTreasuryWalletFlows() ([]model.TreasuryWalletFlow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byWallet := make(map[string]*model.TreasuryWalletFlow)
+	for _, e := range s.ledger {
+		if e.Account != model.LedgerAccountExternal {
+			continue
+		}
+		f, ok := byWallet[e.Wallet]
+		if !ok {
+			f = &model.TreasuryWalletFlow{Wallet: e.Wallet}
+			byWallet[e.Wallet] = f
+		}
+		// The external account is debited when TON comes in and credited when it leaves
+		f.Deposited += e.Debit
+		f.Withdrawn += e.Credit
+	}
+
+	flows := make([]model.TreasuryWalletFlow, 0, len(byWallet))
+	for _, f := range byWallet {
+		f.Deposited = money.Round(f.Deposited)
+		f.Withdrawn = money.Round(f.Withdrawn)
+		flows = append(flows, *f)
+	}
+	sort.Slice(flows, func(i, j int) bool { return flows[i].Wallet < flows[j].Wallet })
+	return flows, nil
+}
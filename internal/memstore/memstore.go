@@ -0,0 +1,223 @@
+// Package memstore is an in-memory implementation of the handler store.
+//
+// It mirrors the behaviour of the SQLite database, including its error
+// messages, for handler tests and local frontend development without SQLite
+// or cgo. Nothing is persisted: all data is lost when the process exits.
+package memstore
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+const (
+	// Transaction statuses, same as in the database package
+	statusPending    = "pending"
+	statusProcessing = "processing"
+	statusReview     = "review"
+	statusCompleted  = "completed"
+	statusFailed     = "failed"
+	statusExpired    = "expired"
+	statusCancelled  = "cancelled"
+
+	// operationTypeReferralEarning counts towards total earnings in the database queries,
+	// although referral earnings aren't recorded as operations yet
+	operationTypeReferralEarning model.OperationType = "referral_earning"
+)
+
+// Store keeps all records in memory behind a single mutex.
+// Every method runs atomically, like a database transaction.
+type Store struct {
+	mu  sync.Mutex
+	ids map[string]int64 // last id per table
+
+	users              map[int]*user
+	investments        []*model.Investment
+	closedInvestments  []closedInvestment
+	operations         []*operation
+	annotations        map[int64]*model.OperationAnnotation
+	referralEarnings   []model.ReferralEarning
+	recomputations     []model.ReferralRecomputationRun
+	attributionHistory []model.AttributionChange
+	deposits           []*model.DepositIntent
+	depositClaims      map[int]int64 // deposit id -> when a confirmation claimed it
+	depositAddresses   map[int]*model.DepositAddress
+	withdrawalRequests []*withdrawalRequest
+	withdrawals        []*model.WithdrawalStorage
+	queue              []*model.QueuedWithdrawal
+	notifications      []model.Notification
+	dispatched         map[int64]int64 // notification id -> when the dispatcher handled it
+	telegramChats      map[int]int64
+	optOuts            map[int][]string
+	payments           []*model.Payment
+	gifts              []*model.Gift
+	pauses             map[string]model.InvestmentPause
+	terms              []termsAcceptance
+	acknowledgments    []*riskAcknowledgment
+	snapshots          []model.BalanceSnapshot
+	ledger             []model.LedgerEntry
+	closedWallets      map[string]int64
+	challenges         map[string]*challenge
+	tonProofPayloads   map[string]*tonProofPayload
+	apiTokens          []*apiToken
+	adminKeys          []*adminKey
+	partners           []*partner
+	addressBook        []*model.AddressBookEntry
+	dormancyNotices    map[dormancyKey]*model.DormancyNotice
+	chainTransactions  []*model.ChainTransaction
+	investigations     map[int64]model.ChainInvestigation
+	indexerCursors     map[string]model.IndexerCursor
+	exposures          map[exposureKey]*model.ExperimentExposure
+	accessLogs         []model.AccessLogEntry
+	verifications      map[int]model.UserVerification
+	withdrawalLimits   map[int]model.WithdrawalLimitOverride
+	idempotencyKeys    map[idempotencyKey]*model.IdempotencyRecord
+	userTiers          map[int]model.UserTier
+	botReferrals       map[int]int
+}
+
+// New returns an empty store
+func New() *Store {
+	return &Store{
+		ids:              make(map[string]int64),
+		users:            make(map[int]*user),
+		pauses:           make(map[string]model.InvestmentPause),
+		closedWallets:    make(map[string]int64),
+		challenges:       make(map[string]*challenge),
+		tonProofPayloads: make(map[string]*tonProofPayload),
+		dormancyNotices:  make(map[dormancyKey]*model.DormancyNotice),
+		investigations:   make(map[int64]model.ChainInvestigation),
+		indexerCursors:   make(map[string]model.IndexerCursor),
+		exposures:        make(map[exposureKey]*model.ExperimentExposure),
+		depositClaims:    make(map[int]int64),
+		depositAddresses: make(map[int]*model.DepositAddress),
+		annotations:      make(map[int64]*model.OperationAnnotation),
+		verifications:    make(map[int]model.UserVerification),
+		withdrawalLimits: make(map[int]model.WithdrawalLimitOverride),
+		idempotencyKeys:  make(map[idempotencyKey]*model.IdempotencyRecord),
+		userTiers:        make(map[int]model.UserTier),
+		botReferrals:     make(map[int]int),
+		dispatched:       make(map[int64]int64),
+		telegramChats:    make(map[int]int64),
+		optOuts:          make(map[int][]string),
+	}
+}
+
+// Close releases nothing, it only satisfies the store interface
+func (s *Store) Close() error {
+	return nil
+}
+
+// QueryStats returns nil, there are no queries to log
+func (s *Store) QueryStats() *model.QueryStats {
+	return nil
+}
+
+// CheckWritable returns nil, memory can always be written
+func (s *Store) CheckWritable() error {
+	return nil
+}
+
+// nextID returns the next autoincrement id of a table
+func (s *Store) nextID(table string) int64 {
+	s.ids[table]++
+	return s.ids[table]
+}
+
+// operation keeps extra as JSON, so callers get back the same values
+// (numbers as float64) as from the operations table
+type operation struct {
+	model.Operation
+	extraJSON []byte
+}
+
+func (o *operation) extra() map[string]interface{} {
+	var extra map[string]interface{}
+	if len(o.extraJSON) > 0 {
+		json.Unmarshal(o.extraJSON, &extra)
+	}
+	return extra
+}
+
+// toModel returns the operation with a freshly decoded extra
+func (o *operation) toModel() model.Operation {
+	op := o.Operation
+	op.Extra = nil
+	if len(o.extraJSON) > 0 {
+		var extra interface{}
+		json.Unmarshal(o.extraJSON, &extra)
+		op.Extra = extra
+	}
+	return op
+}
+
+// insertOperation records an operation, at op.CreatedAt or now if it isn't set
+func (s *Store) insertOperation(op *model.Operation) error {
+	var extraJSON []byte
+	if op.Extra != nil {
+		var err error
+		extraJSON, err = json.Marshal(op.Extra)
+		if err != nil {
+			return err
+		}
+	}
+
+	stored := &operation{Operation: *op, extraJSON: extraJSON}
+	stored.ID = s.nextID("operations")
+	stored.Extra = nil
+	if stored.CreatedAt == 0 {
+		stored.CreatedAt = time.Now().Unix()
+	}
+	s.operations = append(s.operations, stored)
+	return nil
+}
+
+// sumOperations adds up the amounts of a user's operations of the given types
+func (s *Store) sumOperations(userID int, types ...model.OperationType) float64 {
+	var sum float64
+	for _, op := range s.operations {
+		if op.UserID != userID {
+			continue
+		}
+		for _, t := range types {
+			if op.Type == t {
+				sum += op.Amount
+				break
+			}
+		}
+	}
+	return sum
+}
+
+// afterCursor reports whether an item ordered by (createdAt DESC, id DESC) belongs after the page cursor
+func afterCursor(page pagination.Params, createdAt, id int64) bool {
+	if page.After == nil {
+		return true
+	}
+	return createdAt < page.After.CreatedAt || (createdAt == page.After.CreatedAt && id < page.After.ID)
+}
+
+// sortNewestFirst orders items by created_at DESC, id DESC
+func sortNewestFirst[T any](items []T, key func(T) (int64, int64)) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ci, ii := key(items[i])
+		cj, ij := key(items[j])
+		if ci != cj {
+			return ci > cj
+		}
+		return ii > ij
+	})
+}
+
+// limit cuts items down to the number of rows a paginated query fetches
+func limit[T any](items []T, page pagination.Params) []T {
+	if len(items) > page.FetchLimit() {
+		return items[:page.FetchLimit()]
+	}
+	return items
+}
@@ -0,0 +1,179 @@
+package memstore
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// AddNotification stores a notification for a user
+func (s *Store) AddNotification(n *model.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n.CreatedAt == 0 {
+		n.CreatedAt = time.Now().Unix()
+	}
+	s.addNotification(n, n.CreatedAt)
+	n.ID = s.notifications[len(s.notifications)-1].ID
+	return nil
+}
+
+// GetNotifications returns a page of the notifications of a user, newest first,
+// optionally only the unread ones
+func (s *Store) GetNotifications(userID int, unreadOnly bool, page pagination.Params) (*model.NotificationInbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Ids grow with creation time, so the id alone orders the notifications
+	notifications := make([]model.Notification, 0)
+	for i := len(s.notifications) - 1; i >= 0; i-- {
+		n := s.notifications[i]
+		if n.UserID != userID || (unreadOnly && n.ReadAt != nil) {
+			continue
+		}
+		if page.After == nil || n.ID < page.After.ID {
+			notifications = append(notifications, n)
+		}
+	}
+
+	notifications, next := pagination.Trim(limit(notifications, page), page, func(n model.Notification) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: n.CreatedAt, ID: n.ID}
+	})
+
+	return &model.NotificationInbox{
+		Notifications: notifications,
+		Unread:        s.countUnreadNotifications(userID),
+		PageSize:      page.Limit,
+		NextCursor:    next,
+	}, nil
+}
+
+// CountUnreadNotifications returns the number of unread notifications of a user
+func (s *Store) CountUnreadNotifications(userID int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.countUnreadNotifications(userID), nil
+}
+
+func (s *Store) countUnreadNotifications(userID int) int {
+	count := 0
+	for _, n := range s.notifications {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// MarkNotificationsRead marks unread notifications of a user as read, all of them if
+// ids is empty. Ids of other users' notifications are ignored. Returns how many were marked.
+func (s *Store) MarkNotificationsRead(userID int, ids []int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selected := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	now := time.Now().Unix()
+	marked := 0
+	for i := range s.notifications {
+		n := &s.notifications[i]
+		if n.UserID != userID || n.ReadAt != nil || (len(ids) > 0 && !selected[n.ID]) {
+			continue
+		}
+		readAt := now
+		n.ReadAt = &readAt
+		marked++
+	}
+	return marked, nil
+}
+
+// GetUndispatchedNotifications returns the oldest notifications not yet handled by the
+// delivery dispatcher
+func (s *Store) GetUndispatchedNotifications(limit int) ([]model.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notifications := make([]model.Notification, 0)
+	for _, n := range s.notifications {
+		if len(notifications) == limit {
+			break
+		}
+		if _, ok := s.dispatched[n.ID]; !ok {
+			notifications = append(notifications, n)
+		}
+	}
+	return notifications, nil
+}
+
+// MarkNotificationsDispatched marks notifications as handled by the delivery dispatcher,
+// whether they were delivered or not
+func (s *Store) MarkNotificationsDispatched(ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, id := range ids {
+		s.dispatched[id] = now
+	}
+	return nil
+}
+
+// SetTelegramChat binds the Telegram chat notifications of a user are sent to
+func (s *Store) SetTelegramChat(userID int, chatID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.telegramChats[userID] = chatID
+	return nil
+}
+
+// GetTelegramChat returns the Telegram chat bound to a user, sql.ErrNoRows without one
+func (s *Store) GetTelegramChat(userID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chatID, ok := s.telegramChats[userID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return chatID, nil
+}
+
+// DeleteTelegramChat unbinds the Telegram chat of a user
+func (s *Store) DeleteTelegramChat(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.telegramChats, userID)
+	return nil
+}
+
+// GetNotificationOptOuts returns the notification kinds a user opted out of, sorted
+func (s *Store) GetNotificationOptOuts(userID int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.optOuts[userID]...), nil
+}
+
+// SetNotificationOptOuts replaces the notification kinds a user opted out of
+func (s *Store) SetNotificationOptOuts(userID int, kinds []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set := make(map[string]bool, len(kinds))
+	sorted := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		if !set[kind] {
+			set[kind] = true
+			sorted = append(sorted, kind)
+		}
+	}
+	sort.Strings(sorted)
+	s.optOuts[userID] = sorted
+	return nil
+}
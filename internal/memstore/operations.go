@@ -0,0 +1,181 @@
+package memstore
+
+import (
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/pagination"
+)
+
+// AddOperation adds a new operation, recorded at the current time
+func (s *Store) AddOperation(op *model.Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *op
+	stored.CreatedAt = time.Now().Unix()
+	return s.insertOperation(&stored)
+}
+
+// userOperations returns a user's operations newest first, optionally of one type only
+func (s *Store) userOperations(userID int, opType model.OperationType) []*operation {
+	var ops []*operation
+	for _, op := range s.operations {
+		if op.UserID == userID && (opType == "" || op.Type == opType) {
+			ops = append(ops, op)
+		}
+	}
+	sortNewestFirst(ops, func(op *operation) (int64, int64) { return op.CreatedAt, op.ID })
+	return ops
+}
+
+// filteredOperations returns the operations of a user passing filter, newest first
+func (s *Store) filteredOperations(userID int, filter model.OperationFilter) []*operation {
+	var ops []*operation
+	for _, op := range s.taggedOperations(s.userOperations(userID, filter.Type), filter.Tag) {
+		if (filter.From > 0 && op.CreatedAt < filter.From) || (filter.To > 0 && op.CreatedAt >= filter.To) ||
+			(filter.MinAmount > 0 && op.Amount < filter.MinAmount) || (filter.MaxAmount > 0 && op.Amount > filter.MaxAmount) {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// GetUserOperations retrieves the operations of a user passing filter, newest first,
+// one page at a time
+func (s *Store) GetUserOperations(userID int, filter model.OperationFilter, page pagination.Params) (*model.OperationHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all := s.filteredOperations(userID, filter)
+	operations := make([]model.Operation, 0)
+	for _, op := range all {
+		if afterCursor(page, op.CreatedAt, op.ID) {
+			operations = append(operations, op.toModel())
+		}
+	}
+
+	operations, next := pagination.Trim(limit(operations, page), page, func(op model.Operation) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: op.CreatedAt, ID: op.ID}
+	})
+
+	return &model.OperationHistory{
+		Operations: operations,
+		Total:      len(all),
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// ForEachUserOperation calls fn for every operation of a user passing filter, newest
+// first. fn runs unlocked on a copy of the history, so a slow reader doesn't block the store.
+func (s *Store) ForEachUserOperation(userID int, filter model.OperationFilter, fn func(op model.Operation) error) error {
+	s.mu.Lock()
+	ops := s.filteredOperations(userID, filter)
+	s.mu.Unlock()
+
+	for _, op := range ops {
+		if err := fn(op.toModel()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLastOperationID returns the ID of the latest operation, 0 without any
+func (s *Store) GetLastOperationID() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id int64
+	for _, op := range s.operations {
+		if op.ID > id {
+			id = op.ID
+		}
+	}
+	return id, nil
+}
+
+// GetOperationsAfter returns up to limit operations of every user recorded after the
+// operation with afterID, oldest first
+func (s *Store) GetOperationsAfter(afterID int64, limit int) ([]model.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	operations := make([]model.Operation, 0)
+	for _, op := range s.operations {
+		if op.ID > afterID {
+			operations = append(operations, op.toModel())
+		}
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].ID < operations[j].ID })
+	if len(operations) > limit {
+		operations = operations[:limit]
+	}
+	return operations, nil
+}
+
+// TakeBalanceSnapshots stores a balance snapshot of every user for the given date (YYYY-MM-DD).
+// Existing snapshots for that date are kept, so the call is safe to repeat.
+func (s *Store) TakeBalanceSnapshots(date string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taken := make(map[int]bool)
+	for _, snapshot := range s.snapshots {
+		if snapshot.Date == date {
+			taken[snapshot.UserID] = true
+		}
+	}
+
+	var inserted int64
+	now := time.Now().Unix()
+	for _, u := range s.users {
+		if taken[u.ID] {
+			continue
+		}
+		var invested float64
+		for _, inv := range s.userInvestments(u.ID) {
+			invested += inv.Amount
+		}
+		s.snapshots = append(s.snapshots, model.BalanceSnapshot{
+			UserID:        u.ID,
+			Date:          date,
+			Balance:       u.Balance,
+			Invested:      invested,
+			TotalEarnings: s.sumOperations(u.ID, model.OperationTypeInvestmentProfit, operationTypeReferralEarning),
+			CreatedAt:     now,
+		})
+		inserted++
+	}
+	return inserted, nil
+}
+
+// GetBalanceSnapshots returns snapshots of a user between two dates (inclusive), oldest first
+func (s *Store) GetBalanceSnapshots(userID int, from, to string) ([]model.BalanceSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots := make([]model.BalanceSnapshot, 0)
+	for _, snapshot := range s.snapshots {
+		if snapshot.UserID == userID && snapshot.Date >= from && snapshot.Date <= to {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Date < snapshots[j].Date })
+	return snapshots, nil
+}
+
+// addNotification stores a notification for a user
+func (s *Store) addNotification(n *model.Notification, now int64) {
+	s.notifications = append(s.notifications, model.Notification{
+		ID:        s.nextID("notifications"),
+		UserID:    n.UserID,
+		Kind:      n.Kind,
+		Title:     n.Title,
+		Body:      n.Body,
+		CreatedAt: now,
+	})
+}
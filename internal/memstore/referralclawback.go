@@ -0,0 +1,75 @@
+package memstore
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// ClawBackReferralEarnings reverses the referral earnings paid on the profit of a referred
+// user since the given time that weren't clawed back before, debiting each referrer up to
+// their balance
+func (s *Store) ClawBackReferralEarnings(referredID int, since int64, reason string) (*model.ReferralClawback, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reversed := make(map[int64]bool)
+	for _, e := range s.referralEarnings {
+		if e.ReversalOf != nil {
+			reversed[*e.ReversalOf] = true
+		}
+	}
+
+	now := time.Now().Unix()
+	result := &model.ReferralClawback{ReferredID: referredID, Reason: reason, Since: since, Entries: make([]model.ReferralEarning, 0)}
+	var entries []model.ReferralEarning
+	for _, e := range s.referralEarnings {
+		if e.ReferredID != referredID || e.CreatedAt < since || e.Amount <= 0 || e.ReversalOf != nil || reversed[e.ID] {
+			continue
+		}
+		referrer := s.users[e.ReferrerID]
+		if referrer == nil {
+			result.Unrecovered += e.Amount
+			continue
+		}
+
+		recovered := money.FloorPayout(math.Max(0, math.Min(e.Amount, referrer.Balance)))
+		id := e.ID
+		entry := model.ReferralEarning{
+			ID:         s.nextID("referral_earnings"),
+			ReferrerID: e.ReferrerID,
+			ReferredID: e.ReferredID,
+			Level:      e.Level,
+			CreatedAt:  now,
+			ReversalOf: &id,
+			Reason:     reason,
+		}
+		if recovered > 0 {
+			entry.Amount = -recovered
+		}
+		err := s.postTransfer(ledgerTransfer{
+			Kind:      model.LedgerKindReferralClawback,
+			Reference: fmt.Sprintf("referral_earning:%d", entry.ID),
+			From:      userAccount(e.ReferrerID),
+			To:        systemAccount(model.LedgerAccountReferrals),
+			Amount:    recovered,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+		result.Recovered += recovered
+		result.Unrecovered += e.Amount - recovered
+	}
+	s.referralEarnings = append(s.referralEarnings, entries...)
+
+	result.Entries = append(result.Entries, entries...)
+	result.Recovered = money.Round(result.Recovered)
+	result.Unrecovered = money.Round(result.Unrecovered)
+	return result, nil
+}
@@ -0,0 +1,127 @@
+package memstore
+
+import (
+	"fmt"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// GetReferralEarningsForPeriod returns the referral earnings paid on the profit accrued in
+// [from, to): earnings of accrual periods ending in the range, earnings recorded in the
+// range before periods were tracked, and compensations of recomputation runs within it.
+// Clawbacks aren't included.
+func (s *Store) GetReferralEarningsForPeriod(from, to int64) ([]model.ReferralEarning, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make(map[int64]model.ReferralRecomputationRun, len(s.recomputations))
+	for _, r := range s.recomputations {
+		runs[r.ID] = r
+	}
+
+	var earnings []model.ReferralEarning
+	for _, e := range s.referralEarnings {
+		var in bool
+		switch {
+		case e.ReversalOf != nil:
+		case e.CorrectionID != nil:
+			r := runs[*e.CorrectionID]
+			in = r.From >= from && r.To <= to
+		case e.PeriodEnd > 0:
+			in = e.PeriodEnd >= from && e.PeriodEnd < to
+		default:
+			in = e.CreatedAt >= from && e.CreatedAt < to
+		}
+		if in {
+			earnings = append(earnings, e)
+		}
+	}
+	return earnings, nil
+}
+
+// GetReferralRecomputations returns the applied recomputation runs overlapping [from, to)
+func (s *Store) GetReferralRecomputations(from, to int64) ([]model.ReferralRecomputationRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]model.ReferralRecomputationRun, 0)
+	for _, r := range s.recomputations {
+		if r.From < to && r.To > from {
+			runs = append(runs, r)
+		}
+	}
+	return runs, nil
+}
+
+// ApplyReferralCorrections records the recomputation run and pays the Compensated amount of
+// every diff to its referrer as a referral earning of the run. Diffs of referrers that no
+// longer exist are skipped with a note. The run ID and the paid total are set on report.
+// It fails if an earlier run partly overlaps the period.
+func (s *Store) ApplyReferralCorrections(report *model.ReferralRecomputation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.recomputations {
+		if r.From < report.To && r.To > report.From && !(r.From >= report.From && r.To <= report.To) {
+			return fmt.Errorf("period overlaps recomputation run %d", r.ID)
+		}
+	}
+
+	now := time.Now().Unix()
+	run := model.ReferralRecomputationRun{
+		ID:        s.nextID("referral_recomputations"),
+		From:      report.From,
+		To:        report.To,
+		CreatedAt: now,
+	}
+	run.ReferralConfig.Level1Percent = report.ReferralConfig.Level1Percent
+	run.ReferralConfig.Level2Percent = report.ReferralConfig.Level2Percent
+	run.ReferralConfig.Level3Percent = report.ReferralConfig.Level3Percent
+
+	compensated := 0.0
+	for i := range report.Diffs {
+		diff := &report.Diffs[i]
+		if diff.Compensated <= 0 {
+			continue
+		}
+		if s.users[diff.ReferrerID] == nil {
+			diff.Compensated = 0
+			diff.Note = "referrer no longer exists"
+			continue
+		}
+
+		runID := run.ID
+		earning := model.ReferralEarning{
+			ID:           s.nextID("referral_earnings"),
+			ReferrerID:   diff.ReferrerID,
+			ReferredID:   diff.ReferredID,
+			Amount:       diff.Compensated,
+			Level:        diff.Level,
+			CreatedAt:    now,
+			CorrectionID: &runID,
+		}
+		err := s.postTransfer(ledgerTransfer{
+			Kind:      model.LedgerKindReferralEarning,
+			Reference: fmt.Sprintf("referral_earning:%d", earning.ID),
+			From:      systemAccount(model.LedgerAccountReferrals),
+			To:        userAccount(diff.ReferrerID),
+			Amount:    diff.Compensated,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		s.referralEarnings = append(s.referralEarnings, earning)
+		compensated += diff.Compensated
+	}
+	run.Compensated = money.Round(compensated)
+	s.recomputations = append(s.recomputations, run)
+
+	report.ID = run.ID
+	report.Compensated = run.Compensated
+	report.Applied = true
+	report.CreatedAt = now
+	return nil
+}
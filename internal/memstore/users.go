@@ -0,0 +1,805 @@
+package memstore
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/pagination"
+	"tonapp/internal/rates"
+)
+
+// maxReferrerChainDepth bounds the walk up the referrer chain when checking for cycles
+const maxReferrerChainDepth = 1000
+
+// tonPrices replace the rate service of the database package, so the store works offline.
+// They are rough and fixed, good enough to render referral stats.
+var tonPrices = map[string]float64{
+	"usd": 5.5, "eur": 5.1, "gbp": 4.3, "rub": 500, "uah": 225,
+	"kzt": 2700, "try": 180, "inr": 460, "cny": 40, "aed": 20,
+}
+
+// user is a row of the users table
+type user struct {
+	ID           int
+	PubKey       string
+	Balance      float64
+	RefID        *int
+	Name         *string
+	Photo        *string
+	CreatedAt    int64
+	FiatCurrency *string
+	NumberFormat *string
+	Language     *string
+	LastActiveAt *int64
+	ClosedAt     *int64
+	FrozenAt     *int64
+	FrozenReason string
+	AccountNo    int64
+
+	// Set by CloseAccount until the account is anonymized
+	AnonymizeRequestedAt *int64
+}
+
+func (u *user) preferences() model.UserPreferences {
+	prefs := model.DefaultPreferences
+	if u.FiatCurrency != nil && *u.FiatCurrency != "" {
+		prefs.FiatCurrency = *u.FiatCurrency
+	}
+	if u.NumberFormat != nil && *u.NumberFormat != "" {
+		prefs.NumberFormat = *u.NumberFormat
+	}
+	if u.Language != nil && *u.Language != "" {
+		prefs.Language = *u.Language
+	}
+	return prefs
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func copyInt64(i *int64) *int64 {
+	if i == nil {
+		return nil
+	}
+	v := *i
+	return &v
+}
+
+func copyFloat64(f *float64) *float64 {
+	if f == nil {
+		return nil
+	}
+	v := *f
+	return &v
+}
+
+func (s *Store) userByPubKey(pubKey string) *user {
+	for _, u := range s.users {
+		if u.PubKey == pubKey {
+			return u
+		}
+	}
+	return nil
+}
+
+// CreateUser creates a new user, or returns the existing user of the public key with created set to false
+func (s *Store) CreateUser(pubKey string, refID *int, customID *int, name *string, photo *string) (*model.User, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing := s.userByPubKey(pubKey); existing != nil {
+		return s.loadUser(existing), false, nil
+	}
+
+	var id int
+	if customID != nil {
+		id = *customID
+	} else {
+		id = rand.Intn(1000000000000-1000000000) + 1000000000
+	}
+	if _, ok := s.users[id]; ok {
+		return nil, false, fmt.Errorf("UNIQUE constraint failed: users.id")
+	}
+
+	now := time.Now().Unix()
+	u := &user{
+		ID:        id,
+		PubKey:    pubKey,
+		RefID:     copyInt(refID),
+		Name:      copyString(name),
+		Photo:     copyString(photo),
+		CreatedAt: now,
+		AccountNo: s.nextID("account_numbers"),
+	}
+	s.users[id] = u
+
+	if refID != nil {
+		s.attributionHistory = append(s.attributionHistory, model.AttributionChange{
+			ID:        s.nextID("attribution_history"),
+			UserID:    id,
+			NewRefID:  copyInt(refID),
+			Reason:    "registration",
+			ChangedBy: model.AttributionByRegistration,
+			CreatedAt: now,
+		})
+	}
+
+	return s.loadUser(u), true, nil
+}
+
+// loadUser returns the user with investments, earnings and the amount available for withdrawal
+func (s *Store) loadUser(u *user) *model.User {
+	result := &model.User{
+		ID:            u.ID,
+		PubKey:        u.PubKey,
+		AccountNumber: model.FormatAccountNumber(u.AccountNo),
+		Name:          copyString(u.Name),
+		Photo:         copyString(u.Photo),
+		Balance:       u.Balance,
+		RefID:         copyInt(u.RefID),
+		CreatedAt:     u.CreatedAt,
+		Preferences:   u.preferences(),
+		Investments:   s.userInvestments(u.ID),
+		ClosedAt:      copyInt64(u.ClosedAt),
+		FrozenAt:      copyInt64(u.FrozenAt),
+	}
+	for _, inv := range result.Investments {
+		result.CurrentInvestments += inv.Amount
+	}
+	result.TotalEarnings = s.sumOperations(u.ID, model.OperationTypeInvestmentProfit, operationTypeReferralEarning)
+	result.AvailableForWithdrawal = s.availableForWithdrawal(u)
+	return result
+}
+
+// availableForWithdrawal is 80% of deposits minus already withdrawn, capped at the balance
+func (s *Store) availableForWithdrawal(u *user) float64 {
+	deposits := s.sumOperations(u.ID, model.OperationTypeDeposit)
+	withdrawals := s.sumOperations(u.ID, model.OperationTypeWithdrawal)
+
+	available := deposits*0.8 - withdrawals
+	if available <= 0 {
+		return 0
+	}
+	if available > u.Balance {
+		available = u.Balance
+	}
+	return available
+}
+
+// GetUserByPubKey retrieves a user by their public key
+func (s *Store) GetUserByPubKey(pubKey string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByPubKey(pubKey)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.loadUser(u), nil
+}
+
+// GetUserByAccountNumber returns the user with the given account number
+func (s *Store) GetUserByAccountNumber(number int64) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.AccountNo == number {
+			return s.loadUser(u), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// GetUser retrieves a user by their ID
+func (s *Store) GetUser(id int) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return s.loadUser(u), nil
+}
+
+// GetReferrerChain returns the user's referrer and theirs, up to levels referrers, with
+// when their accounts were closed
+func (s *Store) GetReferrerChain(userID int, levels int) ([]model.Referrer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var chain []model.Referrer
+	u := s.users[userID]
+	for len(chain) < levels && u != nil && u.RefID != nil {
+		r := model.Referrer{ID: *u.RefID}
+		u = s.users[r.ID]
+		if u != nil {
+			r.ClosedAt = copyInt64(u.ClosedAt)
+		}
+		chain = append(chain, r)
+	}
+	return chain, nil
+}
+
+// DeleteUser removes a user and their investments
+func (s *Store) DeleteUser(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Write off the balance and open investments in the ledger
+	reference := fmt.Sprintf("user:%d", id)
+	if u, ok := s.users[id]; ok {
+		err := s.postTransfer(ledgerTransfer{
+			Kind:      model.LedgerKindUserDeleted,
+			Reference: reference,
+			From:      userAccount(id),
+			To:        systemAccount(model.LedgerAccountAdjustments),
+			Amount:    u.Balance,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var invested float64
+	now := time.Now().Unix()
+	investments := s.investments[:0]
+	for _, inv := range s.investments {
+		if inv.UserID != id {
+			investments = append(investments, inv)
+			continue
+		}
+		invested += inv.Amount
+		s.closedInvestments = append(s.closedInvestments, closedInvestment{
+			UserID: id,
+			HistoricalInvestment: model.HistoricalInvestment{
+				ID:        int64(inv.ID),
+				Type:      inv.Type,
+				Amount:    inv.Amount,
+				CreatedAt: inv.CreatedAt,
+				ClosedAt:  &now,
+				ClosedBy:  model.LedgerKindUserDeleted,
+			},
+		})
+	}
+	s.investments = investments
+	delete(s.users, id)
+
+	return s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindUserDeleted,
+		Reference: reference,
+		From:      systemAccount(model.LedgerAccountInvestments),
+		To:        systemAccount(model.LedgerAccountAdjustments),
+		Amount:    invested,
+	})
+}
+
+// UpdateUserBalance sets the balance of a user by their ID.
+// The difference to the current balance is posted to the ledger as an admin adjustment.
+func (s *Store) UpdateUserBalance(userID int, newBalance float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return s.postTransfer(ledgerTransfer{
+		Kind:   model.LedgerKindAdjustment,
+		From:   systemAccount(model.LedgerAccountAdjustments),
+		To:     userAccount(userID),
+		Amount: newBalance - u.Balance,
+	})
+}
+
+// UpdateUserProfile updates profile fields and display preferences; nil fields are kept
+func (s *Store) UpdateUserProfile(userID int, req model.UpdateProfileRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	if req.Name != nil {
+		u.Name = copyString(req.Name)
+	}
+	if req.Photo != nil {
+		u.Photo = copyString(req.Photo)
+	}
+	if req.FiatCurrency != nil {
+		u.FiatCurrency = copyString(req.FiatCurrency)
+	}
+	if req.NumberFormat != nil {
+		u.NumberFormat = copyString(req.NumberFormat)
+	}
+	if req.Language != nil {
+		u.Language = copyString(req.Language)
+	}
+	return nil
+}
+
+// TouchUserActivity records that the user used the app
+func (s *Store) TouchUserActivity(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userID]; ok {
+		now := time.Now().Unix()
+		u.LastActiveAt = &now
+	}
+	return nil
+}
+
+// walletHash identifies a closed wallet without keeping its public key
+func walletHash(pubKey string) string {
+	sum := sha256.Sum256([]byte(pubKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsWalletClosed reports whether an account registered with this wallet was closed before
+func (s *Store) IsWalletClosed(pubKey string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.closedWallets[walletHash(pubKey)]
+	return ok, nil
+}
+
+// CloseAccount marks an account closed. With payOut its balance is paid out to the
+// user's wallet: an account closed before may be paid out too, and it is anonymized by
+// anonymizeClosedAccount once the payout left. Otherwise the balance is kept for the user
+// to withdraw. The account must have no open investments left.
+func (s *Store) CloseAccount(userID int, payOut bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.userInvestments(userID)) > 0 {
+		return 0, fmt.Errorf("account still has open investments")
+	}
+	u, ok := s.users[userID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+
+	if u.ClosedAt != nil && !payOut {
+		return 0, fmt.Errorf("account is already closed")
+	}
+
+	now := time.Now().Unix()
+	if u.ClosedAt == nil {
+		description := "Account closed by user, the balance is kept for withdrawal"
+		if payOut {
+			description = "Account closed by user, the balance is paid out"
+		}
+		err := s.insertOperation(&model.Operation{
+			UserID:      userID,
+			Type:        model.OperationTypeAccountClosed,
+			Amount:      0,
+			Description: description,
+			CreatedAt:   now,
+		})
+		if err != nil {
+			return 0, err
+		}
+		closedAt := now
+		u.ClosedAt = &closedAt
+	}
+	closedAt := *u.ClosedAt
+
+	if payOut {
+		u.AnonymizeRequestedAt = &now
+		s.anonymizeClosedAccount(userID, now)
+	}
+
+	return closedAt, nil
+}
+
+// anonymizeClosedAccount anonymizes an account closed with CloseAccount once nothing is
+// left to pay out: no balance of a nanoton or more and no open withdrawal. The wallet is
+// remembered so it can't sign up for bonuses again.
+func (s *Store) anonymizeClosedAccount(userID int, now int64) {
+	u, ok := s.users[userID]
+	if !ok || u.AnonymizeRequestedAt == nil || money.FloorPayout(u.Balance) > 0 {
+		return
+	}
+	for _, w := range s.queue {
+		if w.UserID == userID && queueOpen(w.Status) {
+			return
+		}
+	}
+	for _, w := range s.withdrawalRequests {
+		if w.UserID == userID && (w.Status == model.WithdrawalStatusPendingApproval || w.Status == model.WithdrawalStatusSending) {
+			return
+		}
+	}
+
+	s.closedWallets[walletHash(u.PubKey)] = now
+
+	// The placeholder keeps pub_key unique and frees the wallet for a new registration
+	u.PubKey = fmt.Sprintf("closed_%d", userID)
+	u.Name, u.Photo = nil, nil
+	u.FiatCurrency, u.NumberFormat, u.Language = nil, nil, nil
+	u.AnonymizeRequestedAt = nil
+
+	for _, token := range s.apiTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			revokedAt := now
+			token.RevokedAt = &revokedAt
+		}
+	}
+}
+
+// SetRateService does nothing, the store uses the fixed tonPrices
+func (s *Store) SetRateService(service *rates.Service) {}
+
+// GetReferralStats returns the referrals of a user up to the third level with the earnings from them
+func (s *Store) GetReferralStats(pubKey string) (*model.ReferralStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByPubKey(pubKey)
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	var totalEarnings float64
+	for _, e := range s.referralEarnings {
+		if e.ReferrerID == u.ID {
+			totalEarnings += e.Amount
+		}
+	}
+
+	dollarRate := tonPrices["usd"]
+	now := time.Now().Unix()
+
+	// Walk down the referral tree one level at a time, like the level joins of the database
+	allReferrals := make(map[int]*model.ReferralDetail)
+	var order []int
+	parents := []int{u.ID}
+	for level := 1; level <= 3; level++ {
+		var children []int
+		for _, parent := range parents {
+			for _, ref := range s.directReferrals(parent) {
+				children = append(children, ref.ID)
+
+				var earnings float64
+				var byLevel [4]float64
+				for _, e := range s.referralEarnings {
+					if e.ReferrerID == u.ID && e.ReferredID == ref.ID {
+						earnings += e.Amount
+						if e.Level >= 1 && e.Level <= 3 {
+							byLevel[e.Level] += e.Amount
+						}
+					}
+				}
+
+				if detail, exists := allReferrals[ref.ID]; exists {
+					switch level {
+					case 2:
+						detail.Level2Earnings, detail.Level2EarningsUSD = earnings, earnings*dollarRate
+					case 3:
+						detail.Level3Earnings, detail.Level3EarningsUSD = earnings, earnings*dollarRate
+					}
+					continue
+				}
+
+				var invested float64
+				for _, inv := range s.userInvestments(ref.ID) {
+					invested += inv.Amount
+				}
+				detail := &model.ReferralDetail{
+					UserID:              ref.ID,
+					Name:                copyString(ref.Name),
+					Photo:               copyString(ref.Photo),
+					Level:               level,
+					TotalInvested:       invested,
+					TotalInvestedUSD:    invested * dollarRate,
+					EarningsFromUser:    earnings,
+					EarningsFromUserUSD: earnings * dollarRate,
+					Level1Earnings:      byLevel[1],
+					Level1EarningsUSD:   byLevel[1] * dollarRate,
+					Level2Earnings:      byLevel[2],
+					Level2EarningsUSD:   byLevel[2] * dollarRate,
+					Level3Earnings:      byLevel[3],
+					Level3EarningsUSD:   byLevel[3] * dollarRate,
+				}
+				// Only direct referrals report their registration
+				if level == 1 {
+					detail.CreatedAt = ref.CreatedAt
+					detail.ActiveDays = int((now - ref.CreatedAt) / (24 * 60 * 60))
+				}
+				allReferrals[ref.ID] = detail
+				order = append(order, ref.ID)
+			}
+		}
+		parents = children
+	}
+
+	var referralsByLevel []model.ReferralDetail
+	for _, id := range order {
+		referralsByLevel = append(referralsByLevel, *allReferrals[id])
+	}
+
+	fiatCurrency := u.preferences().FiatCurrency
+	fiatRate := tonPrices[fiatCurrency]
+
+	return &model.ReferralStats{
+		TotalReferrals:    len(allReferrals),
+		TotalEarnings:     totalEarnings,
+		TotalEarningsUSD:  totalEarnings * dollarRate,
+		FiatCurrency:      fiatCurrency,
+		FiatRate:          fiatRate,
+		TotalEarningsFiat: totalEarnings * fiatRate,
+		ReferralsByLevel:  referralsByLevel,
+	}, nil
+}
+
+// directReferrals returns the users referred by userID ordered by id
+func (s *Store) directReferrals(userID int) []*user {
+	var refs []*user
+	for _, u := range s.users {
+		if u.RefID != nil && *u.RefID == userID {
+			refs = append(refs, u)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].ID < refs[j].ID })
+	return refs
+}
+
+// AddReferralEarning records a referral earning on the accrual period ending at periodEnd
+// and credits it to the referrer. The amount is reduced to what the caps leave, the
+// credited amount is returned and nothing is recorded when it is 0.
+func (s *Store) AddReferralEarning(referrerID int, referredID int, amount float64, level int, periodEnd int64, caps model.ReferralCaps) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	dayStart := time.Unix(now, 0).UTC().Truncate(24 * time.Hour).Unix()
+	var earnedToday, earned float64
+	for _, e := range s.referralEarnings {
+		if e.ReferrerID != referrerID {
+			continue
+		}
+		earned += e.Amount
+		if e.CreatedAt >= dayStart {
+			earnedToday += e.Amount
+		}
+	}
+	if remaining, ok := caps.Remaining(earnedToday, earned); ok && remaining < amount {
+		amount = money.FloorPayout(remaining)
+	}
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	earning := model.ReferralEarning{
+		ID:         s.nextID("referral_earnings"),
+		ReferrerID: referrerID,
+		ReferredID: referredID,
+		Amount:     amount,
+		Level:      level,
+		CreatedAt:  now,
+		PeriodEnd:  periodEnd,
+	}
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindReferralEarning,
+		Reference: fmt.Sprintf("referral_earning:%d", earning.ID),
+		From:      systemAccount(model.LedgerAccountReferrals),
+		To:        userAccount(referrerID),
+		Amount:    amount,
+		CreatedAt: earning.CreatedAt,
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.referralEarnings = append(s.referralEarnings, earning)
+	return amount, nil
+}
+
+// GetReferralEarningHistory returns a page of the referral earnings of a referrer, newest first
+func (s *Store) GetReferralEarningHistory(referrerID int, page pagination.Params) (*model.ReferralEarningHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	earnings := make([]model.ReferralEarning, 0)
+	for _, e := range s.referralEarnings {
+		if e.ReferrerID == referrerID && afterCursor(page, e.CreatedAt, e.ID) {
+			earnings = append(earnings, e)
+		}
+	}
+	sortNewestFirst(earnings, func(e model.ReferralEarning) (int64, int64) { return e.CreatedAt, e.ID })
+
+	earnings, next := pagination.Trim(limit(earnings, page), page, func(e model.ReferralEarning) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: e.CreatedAt, ID: e.ID}
+	})
+
+	return &model.ReferralEarningHistory{
+		Earnings:   earnings,
+		PageSize:   page.Limit,
+		NextCursor: next,
+	}, nil
+}
+
+// GetReferralEarningsSince returns referral payouts recorded since the given time
+func (s *Store) GetReferralEarningsSince(since int64) ([]model.ReferralEarningEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var earnings []model.ReferralEarningEntry
+	for _, e := range s.referralEarnings {
+		if e.CreatedAt >= since {
+			earnings = append(earnings, model.ReferralEarningEntry{Level: e.Level, Amount: e.Amount, CreatedAt: e.CreatedAt})
+		}
+	}
+	return earnings, nil
+}
+
+// GetReferrerMap returns the referrer of every user that has one, with when the
+// referrer's account was closed
+func (s *Store) GetReferrerMap() (map[int]model.Referrer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	referrers := make(map[int]model.Referrer)
+	for _, u := range s.users {
+		if u.RefID == nil {
+			continue
+		}
+		r := model.Referrer{ID: *u.RefID}
+		if ref, ok := s.users[r.ID]; ok {
+			r.ClosedAt = copyInt64(ref.ClosedAt)
+		}
+		referrers[u.ID] = r
+	}
+	return referrers, nil
+}
+
+// ChangeReferrer replaces the referrer of a user and records the change in attribution history.
+// A nil newRefID removes the attribution.
+func (s *Store) ChangeReferrer(userID int, newRefID *int, reason string, changedBy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return fmt.Errorf("user not found")
+	}
+
+	if newRefID != nil {
+		if *newRefID == userID {
+			return fmt.Errorf("user can't refer themselves")
+		}
+
+		// Walk up from the new referrer to make sure the user isn't part of its chain
+		current := *newRefID
+		for i := 0; i < maxReferrerChainDepth; i++ {
+			ref, ok := s.users[current]
+			if !ok {
+				if i == 0 {
+					return fmt.Errorf("referrer not found")
+				}
+				break
+			}
+			if ref.RefID == nil {
+				break
+			}
+			if *ref.RefID == userID {
+				return fmt.Errorf("referrer change would create a referral cycle")
+			}
+			current = *ref.RefID
+		}
+	}
+
+	oldRefID := u.RefID
+	u.RefID = copyInt(newRefID)
+
+	s.attributionHistory = append(s.attributionHistory, model.AttributionChange{
+		ID:        s.nextID("attribution_history"),
+		UserID:    userID,
+		OldRefID:  oldRefID,
+		NewRefID:  copyInt(newRefID),
+		Reason:    reason,
+		ChangedBy: changedBy,
+		CreatedAt: time.Now().Unix(),
+	})
+	return nil
+}
+
+// GetAttributionHistory returns all referrer changes of a user, oldest first
+func (s *Store) GetAttributionHistory(userID int) ([]model.AttributionChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := make([]model.AttributionChange, 0)
+	for _, change := range s.attributionHistory {
+		if change.UserID == userID {
+			change.OldRefID = copyInt(change.OldRefID)
+			change.NewRefID = copyInt(change.NewRefID)
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+// GetUserVerification returns the identity verification of a user, sql.ErrNoRows if
+// an admin never set it
+func (s *Store) GetUserVerification(userID int) (*model.UserVerification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.verifications[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &v, nil
+}
+
+// SetUserVerification marks a user verified or not, keeping the note for the record
+func (s *Store) SetUserVerification(userID int, verified bool, note string) (*model.UserVerification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := model.UserVerification{UserID: userID, Verified: verified, Note: note, UpdatedAt: time.Now().Unix()}
+	s.verifications[userID] = v
+	return &v, nil
+}
+
+// GetUserFreeze returns whether a user is frozen, sql.ErrNoRows for unknown users
+func (s *Store) GetUserFreeze(userID int) (*model.UserFreeze, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return u.freeze(), nil
+}
+
+func (u *user) freeze() *model.UserFreeze {
+	return &model.UserFreeze{UserID: u.ID, Frozen: u.FrozenAt != nil, Reason: u.FrozenReason, FrozenAt: copyInt64(u.FrozenAt)}
+}
+
+// SetUserFrozen freezes or unfreezes a user. Freezing a frozen user only updates the
+// reason, unfreezing clears it.
+func (s *Store) SetUserFrozen(userID int, frozen bool, reason string) (*model.UserFreeze, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !frozen {
+		u.FrozenAt, u.FrozenReason = nil, ""
+		return u.freeze(), nil
+	}
+	if u.FrozenAt == nil {
+		now := time.Now().Unix()
+		u.FrozenAt = &now
+	}
+	u.FrozenReason = reason
+	return u.freeze(), nil
+}
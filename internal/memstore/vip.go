@@ -0,0 +1,57 @@
+package memstore
+
+import (
+	"database/sql"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// GetInvestedTotals returns the TON in open investments of every user with any
+func (s *Store) GetInvestedTotals() (map[int]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := make(map[int]float64)
+	for _, inv := range s.investments {
+		totals[inv.UserID] += inv.Amount
+	}
+	return totals, nil
+}
+
+// GetUserTiers returns the stored tiers of all ranked users
+func (s *Store) GetUserTiers() (map[int]model.UserTier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tiers := make(map[int]model.UserTier, len(s.userTiers))
+	for id, t := range s.userTiers {
+		tiers[id] = t
+	}
+	return tiers, nil
+}
+
+// GetUserTier returns the stored tier of a user, sql.ErrNoRows below the first tier
+func (s *Store) GetUserTier(userID int) (*model.UserTier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.userTiers[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &t, nil
+}
+
+// SetUserTier stores the tier of a user, an empty tier removes it
+func (s *Store) SetUserTier(userID int, tier string, invested float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tier == "" {
+		delete(s.userTiers, userID)
+		return nil
+	}
+	s.userTiers[userID] = model.UserTier{UserID: userID, Tier: tier, Invested: invested, UpdatedAt: time.Now().Unix()}
+	return nil
+}
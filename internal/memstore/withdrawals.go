@@ -0,0 +1,554 @@
+package memstore
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// withdrawalRequest is a row of the withdrawal_requests table
+type withdrawalRequest struct {
+	ID        int64
+	UserID    int
+	Amount    float64
+	Status    string
+	CreatedAt int64
+
+	// Set on requests held for approval
+	TxHash         string
+	Reason         string
+	ReviewedAt     *int64
+	TreasuryWallet string
+	Destination    string
+	QueueID        int64
+}
+
+// GetWithdrawalRequestsByUser returns the user's withdrawals, newest first
+func (s *Store) GetWithdrawalRequestsByUser(userID int) ([]model.WithdrawalStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var withdrawals []model.WithdrawalStorage
+	for _, w := range s.withdrawals {
+		if w.UserID == userID {
+			withdrawals = append(withdrawals, *w)
+		}
+	}
+	sort.SliceStable(withdrawals, func(i, j int) bool { return withdrawals[i].CreatedAt.After(withdrawals[j].CreatedAt) })
+	return withdrawals, nil
+}
+
+// queueOpen reports whether a queue entry still holds reserved funds
+func queueOpen(status string) bool {
+	return status == model.QueueStatusQueued || status == model.QueueStatusSending ||
+		status == model.QueueStatusBatched || status == model.QueueStatusProcessing
+}
+
+func (s *Store) queued(id int64) *model.QueuedWithdrawal {
+	for _, w := range s.queue {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// queuedWithdrawal returns a queue entry with the owner's key and its current position among queued entries
+func (s *Store) queuedWithdrawal(w *model.QueuedWithdrawal) (*model.QueuedWithdrawal, error) {
+	u, ok := s.users[w.UserID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	entry := *w
+	entry.PubKey = u.PubKey
+	entry.Position = 0
+	if w.ProcessedAt != nil {
+		v := *w.ProcessedAt
+		entry.ProcessedAt = &v
+	}
+	if w.Status == model.QueueStatusQueued {
+		for _, other := range s.queue {
+			if other.Status == model.QueueStatusQueued && other.ID <= w.ID {
+				entry.Position++
+			}
+		}
+	}
+	return &entry, nil
+}
+
+// GetQueuedWithdrawal returns a queue entry with its current position among queued entries
+func (s *Store) GetQueuedWithdrawal(id int64) (*model.QueuedWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.queued(id)
+	if w == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.queuedWithdrawal(w)
+}
+
+// EnqueueWithdrawal reserves the amount from the user balance and puts the withdrawal in the liquidity queue
+func (s *Store) EnqueueWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error) {
+	return s.enqueueWithdrawal(userID, amount, destination, caps, model.QueueStatusQueued)
+}
+
+// ProcessWithdrawal reserves the amount from the user balance and hands the withdrawal
+// to the withdrawal worker, which sends it right away
+func (s *Store) ProcessWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error) {
+	return s.enqueueWithdrawal(userID, amount, destination, caps, model.QueueStatusProcessing)
+}
+
+// BatchWithdrawal reserves the amount from the user balance and puts the withdrawal in
+// the queue until the next batch transfer
+func (s *Store) BatchWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps) (*model.QueuedWithdrawal, error) {
+	return s.enqueueWithdrawal(userID, amount, destination, caps, model.QueueStatusBatched)
+}
+
+func (s *Store) enqueueWithdrawal(userID int, amount float64, destination string, caps model.WithdrawalCaps, status string) (*model.QueuedWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkWithdrawalCaps(userID, amount, caps); err != nil {
+		return nil, err
+	}
+
+	w := &model.QueuedWithdrawal{
+		ID:          s.nextID("withdrawal_queue"),
+		UserID:      userID,
+		Amount:      amount,
+		Status:      status,
+		CreatedAt:   time.Now().Unix(),
+		Destination: destination,
+	}
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalQueued,
+		Reference: fmt.Sprintf("withdrawal_queue:%d", w.ID),
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountWithdrawalQueue),
+		Amount:    amount,
+		CreatedAt: w.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.queue = append(s.queue, w)
+
+	return s.queuedWithdrawal(w)
+}
+
+// GetUserQueuedWithdrawals returns the user's queue entries with positions, newest first
+func (s *Store) GetUserQueuedWithdrawals(userID int) ([]model.QueuedWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]model.QueuedWithdrawal, 0)
+	for i := len(s.queue) - 1; i >= 0 && len(entries) < 50; i-- {
+		if s.queue[i].UserID != userID {
+			continue
+		}
+		w, err := s.queuedWithdrawal(s.queue[i])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *w)
+	}
+	return entries, nil
+}
+
+// GetNextQueuedWithdrawals returns the oldest queued entries in processing order, without
+// those waiting to retry a failed transfer or of frozen accounts
+func (s *Store) GetNextQueuedWithdrawals(limit int) ([]model.QueuedWithdrawal, error) {
+	return s.queueEntries(model.QueueStatusQueued, limit), nil
+}
+
+// GetProcessingWithdrawals returns the oldest withdrawals waiting for the withdrawal
+// worker, without those waiting to retry a failed transfer or of frozen accounts
+func (s *Store) GetProcessingWithdrawals(limit int) ([]model.QueuedWithdrawal, error) {
+	return s.queueEntries(model.QueueStatusProcessing, limit), nil
+}
+
+// GetBatchedWithdrawals returns the oldest entries waiting for the next batch transfer,
+// without those waiting to retry a failed transfer or of frozen accounts
+func (s *Store) GetBatchedWithdrawals(limit int) ([]model.QueuedWithdrawal, error) {
+	return s.queueEntries(model.QueueStatusBatched, limit), nil
+}
+
+func (s *Store) queueEntries(status string, limit int) []model.QueuedWithdrawal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	var entries []model.QueuedWithdrawal
+	for _, w := range s.queue {
+		if len(entries) >= limit {
+			break
+		}
+		u, ok := s.users[w.UserID]
+		if !ok || u.FrozenAt != nil || w.Status != status || w.NextAttemptAt > now {
+			continue
+		}
+		entries = append(entries, model.QueuedWithdrawal{
+			ID:          w.ID,
+			UserID:      w.UserID,
+			PubKey:      u.PubKey,
+			Amount:      w.Amount,
+			Status:      w.Status,
+			CreatedAt:   w.CreatedAt,
+			Destination: w.Destination,
+			Attempts:    w.Attempts,
+		})
+	}
+	return entries
+}
+
+// CountQueuedWithdrawals returns the number of withdrawals waiting for liquidity
+func (s *Store) CountQueuedWithdrawals() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, w := range s.queue {
+		if w.Status == model.QueueStatusQueued {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CountBatchedWithdrawals returns the number of withdrawals waiting for the next batch transfer
+func (s *Store) CountBatchedWithdrawals() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, w := range s.queue {
+		if w.Status == model.QueueStatusBatched {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// GetQueuedWithdrawalsTotal returns the sum of withdrawals waiting for liquidity or the next batch
+func (s *Store) GetQueuedWithdrawalsTotal() (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var total float64
+	for _, w := range s.queue {
+		if queueOpen(w.Status) {
+			total += w.Amount
+		}
+	}
+	return total, nil
+}
+
+// SetQueuedWithdrawalStatus moves an entry from one status to another, failing if it was changed concurrently
+func (s *Store) SetQueuedWithdrawalStatus(id int64, from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.queued(id)
+	if w == nil || w.Status != from {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, from)
+	}
+	w.Status = to
+	return nil
+}
+
+// StartQueuedWithdrawalAttempt moves an entry from a status to sending and counts the
+// attempt, failing if it was changed concurrently
+func (s *Store) StartQueuedWithdrawalAttempt(id int64, from string, wallet string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.queued(id)
+	if w == nil || w.Status != from {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, from)
+	}
+	w.Status = model.QueueStatusSending
+	w.Attempts++
+	w.LastAttemptAt = time.Now().Unix()
+	w.TreasuryWallet = wallet
+	return nil
+}
+
+// RecordQueuedWithdrawalError records why the transfer of an entry being sent is
+// unconfirmed, keeping it sending
+func (s *Store) RecordQueuedWithdrawalError(id int64, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.queued(id)
+	if w == nil || w.Status != model.QueueStatusSending {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, model.QueueStatusSending)
+	}
+	w.Error = reason
+	return nil
+}
+
+// RetryQueuedWithdrawal moves an entry whose transfer failed from sending back to a
+// status, where it waits until nextAttemptAt
+func (s *Store) RetryQueuedWithdrawal(id int64, to, reason string, nextAttemptAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := s.queued(id)
+	if w == nil || w.Status != model.QueueStatusSending {
+		return fmt.Errorf("queued withdrawal %d is not %s", id, model.QueueStatusSending)
+	}
+	w.Status = to
+	w.Error = reason
+	w.NextAttemptAt = nextAttemptAt
+	return nil
+}
+
+// GetAttemptedWithdrawals returns the open entries being sent or waiting to retry a
+// failed transfer, oldest first
+func (s *Store) GetAttemptedWithdrawals() ([]model.QueuedWithdrawal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]model.QueuedWithdrawal, 0)
+	for _, w := range s.queue {
+		if w.Status != model.QueueStatusSending && !(queueOpen(w.Status) && w.Attempts > 0) {
+			continue
+		}
+		entry, err := s.queuedWithdrawal(w)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// CompleteQueuedWithdrawal marks an entry as sent and records the withdrawal operation. A
+// closed account is anonymized with its last payout.
+func (s *Store) CompleteQueuedWithdrawal(w model.QueuedWithdrawal, txHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	if stored := s.queued(w.ID); stored != nil {
+		stored.Status = model.QueueStatusSent
+		stored.TxHash = txHash
+		stored.Error = ""
+		stored.ProcessedAt = &now
+		stored.TreasuryWallet = w.TreasuryWallet
+	}
+
+	extra := withdrawalExtra(txHash, w.Destination)
+	extra["queue_id"] = w.ID
+
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalSent,
+		Reference: txHash,
+		From:      systemAccount(model.LedgerAccountWithdrawalQueue),
+		To:        systemAccount(model.LedgerAccountExternal),
+		Amount:    w.Amount,
+		Wallet:    w.TreasuryWallet,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.insertOperation(&model.Operation{
+		UserID:      w.UserID,
+		Type:        model.OperationTypeWithdrawal,
+		Amount:      w.Amount,
+		Description: fmt.Sprintf("Withdrawal of %s TON", money.Format(w.Amount)),
+		CreatedAt:   now,
+		Extra:       extra,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The closure payout of an account is its last withdrawal
+	s.anonymizeClosedAccount(w.UserID, now)
+	return nil
+}
+
+// FailQueuedWithdrawal marks an entry as failed and returns the reserved funds to the user
+func (s *Store) FailQueuedWithdrawal(w model.QueuedWithdrawal, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := s.queued(w.ID)
+	if stored == nil || !queueOpen(stored.Status) {
+		return fmt.Errorf("queued withdrawal %d can't be failed", w.ID)
+	}
+
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawalFailed,
+		Reference: fmt.Sprintf("withdrawal_queue:%d", w.ID),
+		From:      systemAccount(model.LedgerAccountWithdrawalQueue),
+		To:        userAccount(w.UserID),
+		Amount:    w.Amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	stored.Status = model.QueueStatusFailed
+	stored.Error = reason
+	stored.ProcessedAt = &now
+	return nil
+}
+
+// RecordWithdrawal debits a withdrawal sent from a treasury wallet and records the operation
+func (s *Store) RecordWithdrawal(userID int, amount float64, txHash string, treasuryWallet string, destination string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	err := s.postTransfer(ledgerTransfer{
+		Kind:      model.LedgerKindWithdrawal,
+		Reference: txHash,
+		From:      userAccount(userID),
+		To:        systemAccount(model.LedgerAccountExternal),
+		Amount:    amount,
+		Wallet:    treasuryWallet,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.insertOperation(&model.Operation{
+		UserID:      userID,
+		Type:        model.OperationTypeWithdrawal,
+		Amount:      amount,
+		Description: fmt.Sprintf("Withdrawal of %s TON", money.Format(amount)),
+		CreatedAt:   now,
+		Extra:       withdrawalExtra(txHash, destination),
+	})
+}
+
+// withdrawalExtra is the extra of a withdrawal operation, the destination is only set
+// for withdrawals to an address book address
+func withdrawalExtra(txHash string, destination string) map[string]interface{} {
+	extra := map[string]interface{}{
+		"tx_hash": txHash,
+	}
+	if destination != "" {
+		extra["destination"] = destination
+	}
+	return extra
+}
+
+// GetUserWithdrawnSince sums the withdrawals a user requested since a time, whichever way
+// they are sent. Failed and rejected ones were refunded and don't count, approved ones
+// count with their queue entry.
+func (s *Store) GetUserWithdrawnSince(userID int, since int64) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.withdrawnSince(userID, since), nil
+}
+
+// countsAsWithdrawal reports whether a request counts towards the withdrawal limits:
+// refunded ones don't, approved ones count with their queue entry
+func (w *withdrawalRequest) countsAsWithdrawal() bool {
+	return w.Status != model.WithdrawalStatusFailed && w.Status != model.WithdrawalStatusRejected &&
+		w.Status != model.WithdrawalStatusApproved
+}
+
+func (s *Store) withdrawnSince(userID int, since int64) float64 {
+	var total float64
+	for _, w := range s.withdrawalRequests {
+		if w.UserID == userID && w.CreatedAt >= since && w.countsAsWithdrawal() {
+			total += w.Amount
+		}
+	}
+	for _, w := range s.queue {
+		if w.UserID == userID && w.CreatedAt >= since && w.Status != model.QueueStatusFailed {
+			total += w.Amount
+		}
+	}
+	return total
+}
+
+// GetUserLastWithdrawalAt returns when a user last requested a withdrawal that wasn't
+// refunded, 0 without one
+func (s *Store) GetUserLastWithdrawalAt(userID int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastWithdrawalAt(userID), nil
+}
+
+func (s *Store) lastWithdrawalAt(userID int) int64 {
+	var last int64
+	for _, w := range s.withdrawalRequests {
+		if w.UserID == userID && w.CreatedAt > last && w.countsAsWithdrawal() {
+			last = w.CreatedAt
+		}
+	}
+	for _, w := range s.queue {
+		if w.UserID == userID && w.CreatedAt > last && w.Status != model.QueueStatusFailed {
+			last = w.CreatedAt
+		}
+	}
+	return last
+}
+
+// checkWithdrawalCaps checks the caps of a new withdrawal of amount, under the mutex that
+// also guards its reservation
+func (s *Store) checkWithdrawalCaps(userID int, amount float64, caps model.WithdrawalCaps) error {
+	if caps.DailyAmount > 0 && money.Round(s.withdrawnSince(userID, caps.DayStart)+amount) > caps.DailyAmount {
+		return model.ErrDailyWithdrawalLimitReached
+	}
+	if caps.CooldownSince > 0 && s.lastWithdrawalAt(userID) > caps.CooldownSince {
+		return model.ErrWithdrawalCooldownActive
+	}
+	return nil
+}
+
+func copyWithdrawalLimitOverride(o model.WithdrawalLimitOverride) *model.WithdrawalLimitOverride {
+	o.MinAmount = copyFloat64(o.MinAmount)
+	o.MaxAmount = copyFloat64(o.MaxAmount)
+	o.DailyAmount = copyFloat64(o.DailyAmount)
+	return &o
+}
+
+// GetWithdrawalLimitOverride returns the withdrawal limits an admin set for a user,
+// sql.ErrNoRows if the user has the limits of the config
+func (s *Store) GetWithdrawalLimitOverride(userID int) (*model.WithdrawalLimitOverride, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.withdrawalLimits[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyWithdrawalLimitOverride(o), nil
+}
+
+// SetWithdrawalLimitOverride replaces the withdrawal limits of a user
+func (s *Store) SetWithdrawalLimitOverride(o model.WithdrawalLimitOverride) (*model.WithdrawalLimitOverride, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o.UpdatedAt = time.Now().Unix()
+	s.withdrawalLimits[o.UserID] = *copyWithdrawalLimitOverride(o)
+	return copyWithdrawalLimitOverride(o), nil
+}
+
+// DeleteWithdrawalLimitOverride returns a user to the withdrawal limits of the config
+func (s *Store) DeleteWithdrawalLimitOverride(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.withdrawalLimits, userID)
+	return nil
+}
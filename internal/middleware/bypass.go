@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BypassTokenHeader carries a signed rate limit bypass token
+const BypassTokenHeader = "X-RateLimit-Bypass"
+
+// Default issuance limits of bypass tokens per IP, enough for a frontend refreshing its
+// token every minute
+const (
+	defaultBypassIssuePerHour   = 90
+	defaultBypassIssueBurstSize = 5
+)
+
+// signBypassToken signs origin, client IP and expiry with the configured secret
+func (i *IPRateLimiter) signBypassToken(origin, ip string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, []byte(i.currentConfig().Bypass.Secret))
+	mac.Write([]byte(fmt.Sprintf("%s|%s|%d", origin, ip, expiresAt)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// issueBypassToken creates a token in "<expires_at>.<signature>" form
+func (i *IPRateLimiter) issueBypassToken(origin, ip string, now time.Time) (string, int64) {
+	ttl := i.currentConfig().Bypass.TTLSeconds
+	if ttl <= 0 {
+		ttl = 60
+	}
+	expiresAt := now.Add(time.Duration(ttl) * time.Second).Unix()
+	return fmt.Sprintf("%d.%s", expiresAt, i.signBypassToken(origin, ip, expiresAt)), expiresAt
+}
+
+// validBypassToken checks the token signature, expiry and origin and IP binding
+func (i *IPRateLimiter) validBypassToken(token, origin, ip string, now time.Time) bool {
+	if i.currentConfig().Bypass.Secret == "" || token == "" || !i.isAllowedOrigin(origin) {
+		return false
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return false
+	}
+
+	expected := i.signBypassToken(origin, ip, expiresAt)
+	return hmac.Equal([]byte(expected), []byte(parts[1]))
+}
+
+func (i *IPRateLimiter) isAllowedOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, allowed := range i.currentConfig().Bypass.AllowedOrigins {
+		if allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// getBypassIssueLimiter returns the bucket limiting the bypass tokens issued to an IP
+func (i *IPRateLimiter) getBypassIssueLimiter(ip string) *TokenBucket {
+	bypass := i.currentConfig().Bypass
+	perHour, burst := bypass.IssuePerHour, bypass.IssueBurstSize
+	if perHour <= 0 {
+		perHour = defaultBypassIssuePerHour
+	}
+	if burst <= 0 {
+		burst = defaultBypassIssueBurstSize
+	}
+	return i.bucketWithRate("bypass-issue:"+ip, float64(perHour)/3600, burst)
+}
+
+// IssueBypassToken returns a short-lived bypass token to requests coming from
+// one of the allowed frontend origins. The Origin header can be set by any client, so
+// a token only works from the IP it was issued to and every IP gets a limited number
+// of tokens per hour.
+func (i *IPRateLimiter) IssueBypassToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if i.currentConfig().Bypass.Secret == "" || !i.isAllowedOrigin(origin) {
+			c.JSON(403, gin.H{
+				"success": false,
+				"error":   "origin is not allowed to request bypass tokens",
+			})
+			return
+		}
+		ip := c.ClientIP()
+		if !i.consume(c.Request.Context(), i.getBypassIssueLimiter(ip)) {
+			c.JSON(429, gin.H{
+				"success": false,
+				"error":   "too many bypass token requests",
+				"code":    model.ErrorRateLimited,
+			})
+			return
+		}
+
+		token, expiresAt := i.issueBypassToken(origin, ip, time.Now())
+		c.JSON(200, gin.H{
+			"success": true,
+			"data": gin.H{
+				"token":      token,
+				"header":     BypassTokenHeader,
+				"expires_at": expiresAt,
+			},
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	},
+}
+
+// gzipWriter compresses the response body lazily on the first write, so empty
+// responses (304, 204) are passed through untouched
+type gzipWriter struct {
+	gin.ResponseWriter
+	gz       *gzip.Writer
+	disabled bool
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if code == http.StatusNotModified || code == http.StatusNoContent || w.Header().Get("Content-Encoding") != "" {
+		w.disabled = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) start() {
+	header := w.Header()
+	if w.disabled || w.gz != nil {
+		return
+	}
+	if header.Get("Content-Encoding") != "" {
+		w.disabled = true
+		return
+	}
+
+	header.Set("Content-Encoding", "gzip")
+	if !strings.Contains(header.Get("Vary"), "Accept-Encoding") {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	header.Del("Content-Length")
+
+	w.gz = gzipWriterPool.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+}
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.start()
+	if w.gz == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gz.Write(data)
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes compressed data to the client, which keeps streamed responses flowing
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to extend the write
+// deadline of a stream
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipWriter) close() {
+	if w.gz == nil {
+		return
+	}
+	w.gz.Close()
+	gzipWriterPool.Put(w.gz)
+	w.gz = nil
+}
+
+// Gzip compresses responses for clients that accept gzip
+func Gzip() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+			c.Next()
+			return
+		}
+
+		w := &gzipWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		defer w.close()
+
+		c.Next()
+	}
+}
@@ -1,8 +1,13 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
 	"time"
 
+	"tonapp/internal/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,12 +15,13 @@ import (
 func Cors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+BypassTokenHeader+", If-None-Match, If-Modified-Since, "+RequestIDHeader+", "+IdempotencyKeyHeader)
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, "+RequestIDHeader+", "+IdempotentReplayedHeader)
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 
+		// if preflight request, immediately return 200
 		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+			c.AbortWithStatus(200)
 			return
 		}
 
@@ -23,15 +29,55 @@ func Cors() gin.HandlerFunc {
 	}
 }
 
-// RequestID middleware adds a request ID to the context
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// Clients retrying a deposit, withdrawal or investment send the same IdempotencyKeyHeader,
+// responses replayed for it carry IdempotentReplayedHeader
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// RequestID middleware gives every request an ID, taken from a well-formed X-Request-ID
+// header of a proxy or generated. The ID is echoed in the response and added to the logs
+// of everything handling the request.
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// You might want to generate a unique ID here
-		c.Set("RequestID", time.Now().UnixNano())
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Set("RequestID", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
 		c.Next()
 	}
 }
 
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts short IDs of letters, digits, '-', '_' and '.' so they are safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // Logger middleware logs request details
 func Logger() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"fmt"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultPipeline is used when the config doesn't define a pipeline
+var DefaultPipeline = []model.MiddlewareStep{
+	{Name: "recovery"},
+	{Name: "request_id"},
+	{Name: "tracing"},
+	{Name: "logger"},
+	{Name: "cors"},
+	{Name: "rate_limit"},
+	{Name: "compression"},
+}
+
+// Pipeline composes the global middleware chain from registered middlewares
+type Pipeline struct {
+	available map[string]gin.HandlerFunc
+}
+
+// NewPipeline creates a pipeline with the built-in middlewares registered
+func NewPipeline() *Pipeline {
+	p := &Pipeline{available: make(map[string]gin.HandlerFunc)}
+	p.Register("recovery", gin.Recovery())
+	p.Register("logger", gin.Logger())
+	p.Register("request_id", RequestID())
+	p.Register("tracing", Tracing())
+	p.Register("cors", Cors())
+	p.Register("compression", Gzip())
+	return p
+}
+
+// Register makes a middleware available to the pipeline under name
+func (p *Pipeline) Register(name string, handler gin.HandlerFunc) {
+	p.available[name] = handler
+}
+
+// Build returns the enabled middlewares of steps in order. Unknown and
+// repeated names are rejected so a typo in the config can't silently drop a middleware.
+func (p *Pipeline) Build(steps []model.MiddlewareStep) ([]gin.HandlerFunc, error) {
+	if len(steps) == 0 {
+		steps = DefaultPipeline
+	}
+
+	seen := make(map[string]bool, len(steps))
+	handlers := make([]gin.HandlerFunc, 0, len(steps))
+	for _, step := range steps {
+		handler, ok := p.available[step.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q", step.Name)
+		}
+		if seen[step.Name] {
+			return nil, fmt.Errorf("middleware %q is listed twice", step.Name)
+		}
+		seen[step.Name] = true
+
+		if step.IsEnabled() {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers, nil
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"strings"
 	"sync"
 	"time"
 	"tonapp/internal/model"
@@ -12,21 +14,56 @@ type IPRateLimiter struct {
 	ips    map[string]*TokenBucket
 	mu     sync.RWMutex
 	config model.RateLimitConfig
+	// resolveToken looks up the tier of API tokens, nil limits all traffic by IP
+	resolveToken TokenResolver
+	// resolveWallet looks up the wallet of sessions for rate_limit.routes with per_pub_key
+	resolveWallet WalletResolver
+	// shared keeps the buckets in Redis, nil keeps them in ips only. The buckets in ips
+	// take over while Redis is unreachable.
+	shared *sharedBuckets
+	// overflow wakes the janitor when ips grows past rate_limit.cleanup.max_entries
+	overflow chan struct{}
 }
 
 type TokenBucket struct {
+	key           string // of the bucket in the shared store
 	tokens        float64
 	lastRefill    time.Time
 	rate          float64
 	capacity      float64
 	mu            sync.Mutex
+	// lastSeen is when a request last used the bucket, guarded by the mu of the limiter
+	lastSeen time.Time
 }
 
 func NewIPRateLimiter(config model.RateLimitConfig) *IPRateLimiter {
-	return &IPRateLimiter{
-		ips:    make(map[string]*TokenBucket),
-		config: config,
+	i := &IPRateLimiter{
+		ips:      make(map[string]*TokenBucket),
+		config:   config,
+		overflow: make(chan struct{}, 1),
 	}
+	if config.Store.Backend == BackendRedis {
+		i.shared = newSharedBuckets(config.Store)
+	}
+	return i
+}
+
+// SetConfig applies reloaded rate limits. The buckets are dropped, so every client
+// starts again with a full bucket of the new size. Buckets in Redis are kept and only
+// capped to the new size; the store itself is only chosen at startup.
+func (i *IPRateLimiter) SetConfig(config model.RateLimitConfig) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.config = config
+	i.ips = make(map[string]*TokenBucket)
+}
+
+// currentConfig returns the rate limits in use
+func (i *IPRateLimiter) currentConfig() model.RateLimitConfig {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.config
 }
 
 func (tb *TokenBucket) tryConsume(now time.Time) bool {
@@ -50,36 +87,96 @@ func (tb *TokenBucket) tryConsume(now time.Time) bool {
 	return true
 }
 
-func (i *IPRateLimiter) getRateLimiter(ip string) *TokenBucket {
+// consume takes a token of a bucket, from Redis when the buckets are shared
+func (i *IPRateLimiter) consume(ctx context.Context, tb *TokenBucket) bool {
+	if i.shared != nil {
+		allowed, err := i.shared.take(ctx, tb.key, tb.rate, tb.capacity)
+		if err == nil {
+			return allowed
+		}
+		i.shared.warn(err)
+	}
+	return tb.tryConsume(time.Now())
+}
+
+// bucket returns the bucket of a key, creating a full one of the given size
+func (i *IPRateLimiter) bucket(key string, requestsPerSecond, burstSize int) *TokenBucket {
+	return i.bucketWithRate(key, float64(requestsPerSecond), burstSize)
+}
+
+// bucketWithRate is bucket for rates below one request per second
+func (i *IPRateLimiter) bucketWithRate(key string, requestsPerSecond float64, burstSize int) *TokenBucket {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	limiter, exists := i.ips[ip]
+	now := time.Now()
+	limiter, exists := i.ips[key]
 	if !exists {
 		limiter = &TokenBucket{
-			tokens:     float64(i.config.BurstSize),
-			lastRefill: time.Now(),
-			rate:       float64(i.config.RequestsPerSecond),
-			capacity:   float64(i.config.BurstSize),
+			key:        key,
+			tokens:     float64(burstSize),
+			lastRefill: now,
+			rate:       requestsPerSecond,
+			capacity:   float64(burstSize),
+		}
+		i.ips[key] = limiter
+		if len(i.ips) > cleanupMaxEntries(i.config.Cleanup) {
+			select {
+			case i.overflow <- struct{}{}:
+			default:
+			}
 		}
-		i.ips[ip] = limiter
 	}
+	limiter.lastSeen = now
 
 	return limiter
 }
 
+func (i *IPRateLimiter) getRateLimiter(ip string) *TokenBucket {
+	return i.bucket(ip, i.currentConfig().RequestsPerSecond, i.currentConfig().BurstSize)
+}
+
+// getBypassRateLimiter returns the larger bucket used by holders of a valid bypass token
+func (i *IPRateLimiter) getBypassRateLimiter(ip string) *TokenBucket {
+	bypass := i.currentConfig().Bypass
+	return i.bucket("bypass:"+ip, bypass.RequestsPerSecond, bypass.BurstSize)
+}
+
 func (i *IPRateLimiter) RateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
-		limiter := i.getRateLimiter(ip)
-		if !limiter.tryConsume(time.Now()) {
+		limiter, tier := i.getRateLimiter(ip), "anonymous"
+		if tokenLimiter, tokenTier := i.tokenRateLimiter(c); tokenLimiter != nil {
+			limiter, tier = tokenLimiter, tokenTier
+		} else if i.validBypassToken(c.GetHeader(BypassTokenHeader), c.GetHeader("Origin"), ip, time.Now()) {
+			limiter, tier = i.getBypassRateLimiter(ip), "bypass"
+		}
+		c.Header(TierHeader, tier)
+		if !i.consume(c.Request.Context(), limiter) {
 			c.JSON(429, gin.H{
 				"success": false,
 				"error":   "too many requests",
+				"code":    model.ErrorRateLimited,
 			})
 			c.Abort()
 			return
 		}
+
+		routeLimiters, policies := i.routeRateLimiters(c)
+		if len(policies) > 0 {
+			c.Header(PolicyHeader, strings.Join(policies, ","))
+		}
+		for n, routeLimiter := range routeLimiters {
+			if !i.consume(c.Request.Context(), routeLimiter) {
+				c.JSON(429, gin.H{
+					"success": false,
+					"error":   "too many requests to " + policies[n] + " routes",
+					"code":    model.ErrorRateLimited,
+				})
+				c.Abort()
+				return
+			}
+		}
 		c.Next()
 	}
 }
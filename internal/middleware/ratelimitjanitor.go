@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// Defaults of rate_limit.cleanup
+const (
+	defaultCleanupInterval   = time.Minute
+	defaultCleanupIdleTTL    = 10 * time.Minute
+	defaultCleanupMaxEntries = 100000
+)
+
+// StartJanitor drops the buckets of clients gone quiet every rate_limit.cleanup.interval_seconds,
+// and earlier once there are more than rate_limit.cleanup.max_entries, so scanning traffic
+// from many IPs doesn't grow the buckets forever
+func (i *IPRateLimiter) StartJanitor(ctx context.Context) {
+	interval := time.Duration(i.currentConfig().Cleanup.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-i.overflow:
+		}
+
+		idle, evicted := i.sweep(time.Now())
+		if idle > 0 || evicted > 0 {
+			slog.InfoContext(ctx, "Dropped rate limit buckets", "idle", idle, "evicted", evicted)
+		}
+	}
+}
+
+func cleanupMaxEntries(cfg model.RateLimitCleanupConfig) int {
+	if cfg.MaxEntries <= 0 {
+		return defaultCleanupMaxEntries
+	}
+	return cfg.MaxEntries
+}
+
+// sweep drops the buckets idle for longer than the TTL, then the least recently used ones
+// over the maximum. A bucket idle until it refilled is full, so dropping it changes
+// nothing for its client; evicted buckets start full again on the next request.
+func (i *IPRateLimiter) sweep(now time.Time) (idle, evicted int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ttl := time.Duration(i.config.Cleanup.IdleTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultCleanupIdleTTL
+	}
+	for key, tb := range i.ips {
+		if now.Sub(tb.lastSeen) > ttl {
+			delete(i.ips, key)
+			idle++
+		}
+	}
+
+	max := cleanupMaxEntries(i.config.Cleanup)
+	if len(i.ips) <= max {
+		return idle, 0
+	}
+	buckets := make([]*TokenBucket, 0, len(i.ips))
+	for _, tb := range i.ips {
+		buckets = append(buckets, tb)
+	}
+	sort.Slice(buckets, func(a, b int) bool { return buckets[a].lastSeen.Before(buckets[b].lastSeen) })
+	for _, tb := range buckets[:len(buckets)-max] {
+		delete(i.ips, tb.key)
+		evicted++
+	}
+	return idle, evicted
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/redis"
+)
+
+// Rate limit backends of rate_limit.store.backend
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// defaultKeyPrefix is used when rate_limit.store.key_prefix isn't set
+const defaultKeyPrefix = "tonapp:ratelimit:"
+
+// sharedWarningInterval is how often unreachable Redis is logged while requests fall back
+// to the buckets of the instance
+const sharedWarningInterval = time.Minute
+
+// takeScript refills and takes a token from the bucket in KEYS[1], a hash of its tokens
+// and last refill time, with the refill rate and capacity of ARGV. Redis' clock is used
+// so instances with skewed clocks refill alike. Idle buckets expire once they'd be full.
+const takeScript = `
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(capacity / rate) + 1)
+return allowed
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// sharedBuckets keeps the token buckets in Redis, so replicas behind a load balancer
+// enforce the limits together instead of each on its own
+type sharedBuckets struct {
+	client *redis.Client
+	prefix string
+	// warnedAt is the unix time unreachable Redis was last logged
+	warnedAt atomic.Int64
+}
+
+func newSharedBuckets(cfg model.RateLimitStoreConfig) *sharedBuckets {
+	prefix := cfg.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &sharedBuckets{client: redis.New(cfg.Redis), prefix: prefix}
+}
+
+// take consumes a token of a bucket, reporting false when it is empty
+func (s *sharedBuckets) take(ctx context.Context, key string, rate, capacity float64) (bool, error) {
+	args := []string{s.prefix + key,
+		strconv.FormatFloat(rate, 'f', -1, 64), strconv.FormatFloat(capacity, 'f', -1, 64)}
+
+	reply, err := s.client.Do(ctx, append([]string{"EVALSHA", takeScriptSHA, "1"}, args...)...)
+	var replyErr redis.Error
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		reply, err = s.client.Do(ctx, append([]string{"EVAL", takeScript, "1"}, args...)...)
+	}
+	if err != nil {
+		return false, err
+	}
+	allowed, ok := reply.(int64)
+	if !ok {
+		return false, fmt.Errorf("unexpected rate limit script reply %v", reply)
+	}
+	return allowed == 1, nil
+}
+
+// warn logs a failed Redis call, at most every sharedWarningInterval
+func (s *sharedBuckets) warn(err error) {
+	now := time.Now().Unix()
+	last := s.warnedAt.Load()
+	if now-last < int64(sharedWarningInterval/time.Second) || !s.warnedAt.CompareAndSwap(last, now) {
+		return
+	}
+	slog.Warn("Rate limit store unreachable, limiting per instance", "error", err)
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyHeader names the rate_limit.routes buckets a request was also counted in
+const PolicyHeader = "X-RateLimit-Policy"
+
+// WalletResolver returns the pub_key of a wallet session token, ok is false for
+// invalid or expired sessions
+type WalletResolver func(token string) (pubKey string, ok bool)
+
+// SetWalletResolver enables the per wallet buckets of rate_limit.routes with per_pub_key
+func (i *IPRateLimiter) SetWalletResolver(resolve WalletResolver) {
+	i.resolveWallet = resolve
+}
+
+// routeMatches reports whether a rate_limit.routes pattern, with or without a method,
+// matches the method and gin route of a request
+func routeMatches(pattern, method, fullPath string) bool {
+	if m, path, ok := strings.Cut(pattern, " "); ok {
+		return strings.EqualFold(m, method) && strings.TrimSpace(path) == fullPath
+	}
+	return pattern == fullPath
+}
+
+// routeRateLimiters returns the buckets of the rate_limit.routes matching the request
+// with their names. Routes with per_pub_key count sessions by wallet, requests without
+// a valid session stay counted by IP. Only sessions are trusted here: the pub_key in
+// the path isn't checked before WalletAuth, and using it would let anyone drain the
+// bucket of another wallet.
+func (i *IPRateLimiter) routeRateLimiters(c *gin.Context) ([]*TokenBucket, []string) {
+	fullPath := c.FullPath()
+	if fullPath == "" {
+		return nil, nil
+	}
+
+	var (
+		buckets []*TokenBucket
+		names   []string
+		wallet  string
+		checked bool
+	)
+	for _, route := range i.currentConfig().Routes {
+		matched := false
+		for _, pattern := range route.Routes {
+			if routeMatches(pattern, c.Request.Method, fullPath) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		key := c.ClientIP()
+		if route.PerPubKey {
+			if !checked {
+				wallet, checked = i.sessionWallet(c), true
+			}
+			if wallet != "" {
+				key = "wallet:" + wallet
+			}
+		}
+		buckets = append(buckets, i.getRouteRateLimiter(key, route))
+		names = append(names, route.Name)
+	}
+	return buckets, names
+}
+
+// sessionWallet returns the lower case pub_key of the request's wallet session, or ""
+func (i *IPRateLimiter) sessionWallet(c *gin.Context) string {
+	if i.resolveWallet == nil {
+		return ""
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		return ""
+	}
+	pubKey, ok := i.resolveWallet(token)
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(pubKey)
+}
+
+// getRouteRateLimiter returns the bucket of a client, an IP or wallet, in a route group
+func (i *IPRateLimiter) getRouteRateLimiter(key string, route model.RateLimitRoute) *TokenBucket {
+	return i.bucket("route:"+route.Name+":"+key, route.RequestsPerSecond, route.BurstSize)
+}
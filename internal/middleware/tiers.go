@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"strings"
+
+	"tonapp/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TierHeader tells clients which rate limit bucket their request was counted in
+const TierHeader = "X-RateLimit-Tier"
+
+// TokenResolver returns the bucket key and tier name of an API token, ok is false
+// for unknown or revoked tokens
+type TokenResolver func(token string) (key string, tier string, ok bool)
+
+// SetTokenResolver enables the rate_limit.tiers buckets for requests carrying an
+// API token as "Authorization: Bearer <token>"
+func (i *IPRateLimiter) SetTokenResolver(resolve TokenResolver) {
+	i.resolveToken = resolve
+}
+
+// tokenRateLimiter returns the bucket of the request's API token with its tier name.
+// It returns nil when the request has no valid token or its tier isn't configured,
+// so the request is limited by IP.
+func (i *IPRateLimiter) tokenRateLimiter(c *gin.Context) (*TokenBucket, string) {
+	if i.resolveToken == nil {
+		return nil, ""
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		return nil, ""
+	}
+
+	key, tierName, ok := i.resolveToken(token)
+	if !ok {
+		return nil, ""
+	}
+	tier, ok := i.currentConfig().Tiers[tierName]
+	if !ok {
+		return nil, ""
+	}
+
+	return i.getTokenRateLimiter(key, tierName, tier), tierName
+}
+
+// getTokenRateLimiter returns the bucket of an API token, shared by every IP using the
+// token. The tier is part of the key, so moving a token to another tier starts a new bucket.
+func (i *IPRateLimiter) getTokenRateLimiter(key, tierName string, tier model.RateLimitTier) *TokenBucket {
+	return i.bucket("token:"+tierName+":"+key, tier.RequestsPerSecond, tier.BurstSize)
+}
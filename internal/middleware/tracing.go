@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"tonapp/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tracing middleware records a server span per request, continuing the trace of a
+// traceparent header. Queries and TON calls made under the request context become
+// its children.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx := tracing.WithTraceparent(c.Request.Context(), c.GetHeader("traceparent"))
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route, tracing.KindServer)
+		// Unsampled requests keep the decision in the context so their calls aren't traced either
+		c.Request = c.Request.WithContext(ctx)
+		if span == nil {
+			c.Next()
+			return
+		}
+		defer span.End()
+
+		span.SetAttr("http.request.method", c.Request.Method)
+		span.SetAttr("http.route", route)
+		span.SetAttr("client.address", c.ClientIP())
+		if id := c.GetString("RequestID"); id != "" {
+			span.SetAttr("request.id", id)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttr("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.Fail(http.StatusText(status))
+		}
+		if len(c.Errors) > 0 {
+			span.SetAttr("error.message", c.Errors.String())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+// AccessLogConfig controls the access log of sensitive routes: sign in, API tokens,
+// withdrawals, account closure and the admin balance and user management
+type AccessLogConfig struct {
+	Enabled       bool `json:"enabled"`
+	RetentionDays int  `json:"retention_days"` // default: 90
+}
+
+// AccessLogEntry records one request to a sensitive route
+type AccessLogEntry struct {
+	ID         int64  `json:"id"`
+	CreatedAt  int64  `json:"created_at"` // when the request arrived
+	RequestID  string `json:"request_id,omitempty"`
+	Method     string `json:"method"`
+	Route      string `json:"route"` // route pattern, e.g. /api/v1/users/:id/balance
+	Path       string `json:"path"`
+	Status     int    `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	UserID     *int   `json:"user_id,omitempty"`   // user the request acted on, if it exists
+	PubKey     string `json:"pub_key,omitempty"`   // wallet of the session, or the one claimed when signing in
+	Admin      bool   `json:"admin"`               // authenticated with an admin key
+	AdminKey   string `json:"admin_key,omitempty"` // name of the admin key
+	ClientIP   string `json:"client_ip"`
+	UserAgent  string `json:"user_agent,omitempty"`
+}
+
+// AccessLogFilter selects access log entries, zero values match everything
+type AccessLogFilter struct {
+	UserID   int
+	PubKey   string
+	Route    string
+	Method   string
+	Status   int
+	ClientIP string
+	AdminKey string
+	From     int64 // created_at >= From
+	To       int64 // created_at < To
+}
+
+type AccessLogPage struct {
+	Entries    []AccessLogEntry `json:"entries"`
+	Total      int              `json:"total"`
+	PageSize   int              `json:"page_size"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAccountNumber is returned for account numbers that are malformed or fail their check digit
+var ErrInvalidAccountNumber = errors.New("invalid account number")
+
+// FormatAccountNumber formats the sequential account number of a user for people: the
+// number padded to 6 digits and a Luhn check digit, e.g. 42 is "000042-2". The check
+// digit catches a mistyped digit and most swapped ones when the number is read out.
+func FormatAccountNumber(n int64) string {
+	digits := fmt.Sprintf("%06d", n)
+	return digits + "-" + strconv.Itoa(luhnCheckDigit(digits))
+}
+
+// ParseAccountNumber parses a formatted account number, with or without the dash,
+// spaces and leading zeros, and verifies its check digit
+func ParseAccountNumber(s string) (int64, error) {
+	s = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return 0, ErrInvalidAccountNumber
+	}
+	digits, check := s[:len(s)-1], s[len(s)-1:]
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, ErrInvalidAccountNumber
+	}
+	if strconv.Itoa(luhnCheckDigit(digits)) != check {
+		return 0, ErrInvalidAccountNumber
+	}
+	return n, nil
+}
+
+// luhnCheckDigit returns the digit that makes the digits pass the Luhn check
+func luhnCheckDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,32 @@
+package model
+
+// AddressBookConfig limits the saved addresses of users
+type AddressBookConfig struct {
+	MaxEntries int `json:"max_entries"` // default: 50
+	// WithdrawalDelayHours is how long a new address waits before withdrawals to it are
+	// allowed, so a stolen session can't add an address and empty the balance right away.
+	// 24 to 48, default: 24
+	WithdrawalDelayHours int `json:"withdrawal_delay_hours"`
+}
+
+// AddressBookEntry is a labeled address a user saved, e.g. another wallet of theirs or
+// a friend's
+type AddressBookEntry struct {
+	ID        int64  `json:"id"`
+	UserID    int    `json:"-"`
+	Label     string `json:"label"`
+	Address   string `json:"address"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+	// WithdrawableAt is when withdrawals to the address are allowed
+	WithdrawableAt int64 `json:"withdrawable_at"`
+}
+
+type CreateAddressBookEntryRequest struct {
+	Label   string `json:"label" binding:"required,max=64"`
+	Address string `json:"address" binding:"required"`
+}
+
+type UpdateAddressBookEntryRequest struct {
+	Label string `json:"label" binding:"required,max=64"`
+}
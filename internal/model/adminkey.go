@@ -0,0 +1,36 @@
+package model
+
+// Roles of admin keys. Every role can read, superadmins can do everything.
+const (
+	AdminRoleReadOnly   = "read_only"
+	AdminRoleSupport    = "support"
+	AdminRoleFinance    = "finance"
+	AdminRoleSuperadmin = "superadmin"
+)
+
+// AdminRoles lists the roles of admin keys
+var AdminRoles = []string{AdminRoleReadOnly, AdminRoleSupport, AdminRoleFinance, AdminRoleSuperadmin}
+
+// AdminKey is a named admin API key. The key of admin_api_key in the config is the
+// superadmin key named "config" and isn't stored.
+type AdminKey struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	Prefix     string `json:"prefix"`
+	CreatedBy  string `json:"created_by"` // name of the key that created it
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt *int64 `json:"last_used_at"`
+	RevokedAt  *int64 `json:"revoked_at,omitempty"`
+}
+
+type CreateAdminKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+	Role string `json:"role" binding:"required"`
+}
+
+// CreateAdminKeyResponse contains the plain key, which is only shown once
+type CreateAdminKeyResponse struct {
+	AdminKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,54 @@
+package model
+
+const (
+	// Alert rule types
+	AlertRuleWithdrawalFailureRate = "withdrawal_failure_rate" // threshold in percent of send attempts
+	AlertRulePendingDepositAge     = "pending_deposit_age"     // threshold in minutes
+	AlertRuleHotWalletBalance      = "hot_wallet_balance"      // threshold in TON
+	AlertRuleToncenterErrors       = "toncenter_errors"        // threshold in failed calls and 429s
+)
+
+// AlertsConfig holds the operator alert rules evaluated by the alerting job
+type AlertsConfig struct {
+	Enabled              bool        `json:"enabled"`
+	CheckIntervalSeconds int         `json:"check_interval_seconds"`
+	Rules                []AlertRule `json:"rules"`
+	// TelegramChatID receives alerts from telegram.bot_token
+	TelegramChatID string `json:"telegram_chat_id"`
+	// WebhookURL receives alerts as JSON POST requests
+	WebhookURL string `json:"webhook_url"`
+	// WebhookSecret signs the webhook requests, see notify.VerifySignature
+	WebhookSecret string `json:"webhook_secret"`
+	// LargeWithdrawalAmount notifies every withdrawal sent of at least this many TON,
+	// 0 disables it
+	LargeWithdrawalAmount float64 `json:"large_withdrawal_amount"`
+	// NotifyFailedTransfers notifies every withdrawal transfer that failed
+	NotifyFailedTransfers bool `json:"notify_failed_transfers"`
+}
+
+// AlertRule fires when the value of its type crosses Threshold
+type AlertRule struct {
+	Name      string  `json:"name"`
+	Type      string  `json:"type"`
+	Threshold float64 `json:"threshold"`
+	// WindowMinutes is the period withdrawal attempts are counted over (default: 60)
+	WindowMinutes int `json:"window_minutes,omitempty"`
+	// MinCount is the number of attempts or pending deposits needed to fire (default: 1)
+	MinCount int `json:"min_count,omitempty"`
+	// RepeatMinutes resends the notification while the alert keeps firing, 0 notifies once
+	RepeatMinutes int `json:"repeat_minutes,omitempty"`
+}
+
+// Alert is the state of a rule at its last evaluation
+type Alert struct {
+	Rule        string  `json:"rule"`
+	Type        string  `json:"type"`
+	Firing      bool    `json:"firing"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+	Message     string  `json:"message"`
+	Error       string  `json:"error,omitempty"` // the rule couldn't be evaluated, the last state is kept
+	FiringSince *int64  `json:"firing_since,omitempty"`
+	NotifiedAt  *int64  `json:"notified_at,omitempty"`
+	EvaluatedAt int64   `json:"evaluated_at"`
+}
@@ -0,0 +1,16 @@
+package model
+
+// OperationAnnotation is the user's own bookkeeping of an operation: tags to group
+// operations by and a free-form note
+type OperationAnnotation struct {
+	OperationID int64    `json:"operation_id"`
+	UserID      int      `json:"-"`
+	Tags        []string `json:"tags"`
+	Note        string   `json:"note"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+type SetOperationAnnotationRequest struct {
+	Tags []string `json:"tags"`
+	Note string   `json:"note" binding:"max=500"`
+}
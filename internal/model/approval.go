@@ -0,0 +1,43 @@
+package model
+
+const (
+	// Statuses of withdrawal requests held for admin approval. Approved requests are
+	// sent by their withdrawal_queue entry; sending and sent are those of requests
+	// approved before approvals went through the queue.
+	WithdrawalStatusPendingApproval = "pending_approval"
+	WithdrawalStatusApproved        = "approved"
+	WithdrawalStatusSending         = "sending"
+	WithdrawalStatusSent            = "sent"
+	WithdrawalStatusRejected        = "rejected"
+	WithdrawalStatusFailed          = "failed"
+)
+
+// WithdrawalApprovalConfig holds large withdrawals until an admin approves them
+type WithdrawalApprovalConfig struct {
+	Threshold float64 `json:"threshold"` // TON; withdrawals above it wait for approval, 0 disables
+}
+
+// HeldWithdrawal is a withdrawal request above the approval threshold.
+// Funds are reserved from the user balance until it is sent or rejected.
+type HeldWithdrawal struct {
+	ID         int64   `json:"id"`
+	UserID     int     `json:"user_id"`
+	PubKey     string  `json:"pub_key,omitempty"`
+	Amount     float64 `json:"amount"`
+	Status     string  `json:"status"`
+	TxHash     string  `json:"tx_hash,omitempty"`
+	Reason     string  `json:"reason,omitempty"` // rejection reason or send error
+	CreatedAt  int64   `json:"created_at"`
+	ReviewedAt *int64  `json:"reviewed_at,omitempty"`
+	// TreasuryWallet is the wallet the withdrawal was sent from, empty for the main wallet
+	TreasuryWallet string `json:"treasury_wallet,omitempty"`
+	// Destination is the address book address the withdrawal goes to, empty for the user's wallet
+	Destination string `json:"destination,omitempty"`
+	// QueueID is the withdrawal_queue entry an approved request is sent by
+	QueueID int64 `json:"queue_id,omitempty"`
+}
+
+// RejectWithdrawalRequest is the body of a withdrawal rejection
+type RejectWithdrawalRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
@@ -0,0 +1,45 @@
+package model
+
+// AuthConfig configures TON Connect sign-in and the wallet sessions it issues
+type AuthConfig struct {
+	JWTSecret         string   `json:"jwt_secret"`
+	SessionTTLMinutes int      `json:"session_ttl_minutes"` // default: 60
+	ProofTTLSeconds   int      `json:"proof_ttl_seconds"`   // how long a ton_proof payload stays valid; default: 900
+	AllowedDomains    []string `json:"allowed_domains"`     // app domains accepted in proofs; default: host of telegram.web_app_url
+}
+
+// TonProofPayload is the single-use payload the wallet has to include in its ton_proof
+type TonProofPayload struct {
+	Payload   string `json:"payload"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// TonProofRequest is the account and ton_proof returned by TON Connect
+type TonProofRequest struct {
+	Address   string   `json:"address" binding:"required"` // raw form, e.g. 0:<hex>
+	Network   string   `json:"network"`                    // -239 for mainnet, -3 for testnet
+	PublicKey string   `json:"public_key" binding:"required"`
+	Proof     TonProof `json:"proof" binding:"required"`
+}
+
+// TonProof is the signed proof of wallet ownership
+type TonProof struct {
+	Timestamp int64          `json:"timestamp"`
+	Domain    TonProofDomain `json:"domain"`
+	Payload   string         `json:"payload"`
+	Signature string         `json:"signature"`  // base64
+	StateInit string         `json:"state_init"` // base64 BOC of the wallet state init
+}
+
+type TonProofDomain struct {
+	LengthBytes uint32 `json:"lengthBytes"`
+	Value       string `json:"value"`
+}
+
+// AuthSession is a JWT authorizing requests for the wallet's account
+type AuthSession struct {
+	Token     string `json:"token"`
+	PubKey    string `json:"pub_key"`
+	Address   string `json:"address"`
+	ExpiresAt int64  `json:"expires_at"`
+}
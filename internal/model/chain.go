@@ -0,0 +1,108 @@
+package model
+
+// IndexerConfig controls ingestion of treasury wallet transactions
+type IndexerConfig struct {
+	Enabled         bool     `json:"enabled"`
+	IntervalSeconds int      `json:"interval_seconds"`
+	BackfillLimit   int      `json:"backfill_limit"` // transactions to import on the first run of a wallet
+	ExtraWallets    []string `json:"extra_wallets"`  // indexed besides the main and fee wallets
+}
+
+// ChainWebhooksConfig accepts account event subscriptions of tonapi and toncenter v3.
+// An event for a treasury wallet indexes it and matches its pending deposits right
+// away; the indexer interval and deposit confirmations keep working as the fallback.
+type ChainWebhooksConfig struct {
+	TonAPI    ChainWebhookConfig `json:"tonapi"`
+	Toncenter ChainWebhookConfig `json:"toncenter"`
+}
+
+// ChainWebhookConfig enables the webhook of one provider, whose requests are signed
+// with an HMAC-SHA256 of the body using Secret
+type ChainWebhookConfig struct {
+	Enabled bool   `json:"enabled"`
+	Secret  string `json:"secret"`
+}
+
+// ChainWebhookStats counts the events received from a provider since start
+type ChainWebhookStats struct {
+	Provider    string `json:"provider"`
+	Events      int    `json:"events"`
+	Rejected    int    `json:"rejected"` // bad signature or body
+	LastEventAt *int64 `json:"last_event_at"`
+}
+
+// ChainWebhookStatus is the webhook part of the indexer status
+type ChainWebhookStatus struct {
+	Providers       []ChainWebhookStats `json:"providers"`
+	MatchedDeposits int                 `json:"matched_deposits"` // completed by the worker since start
+	QueuedWallets   int                 `json:"queued_wallets"`
+}
+
+// ChainTransaction is an indexed treasury wallet transaction
+type ChainTransaction struct {
+	ID             int64   `json:"id"`
+	Wallet         string  `json:"wallet"`
+	LT             uint64  `json:"lt"`
+	Hash           string  `json:"hash"`
+	Utime          int64   `json:"utime"`
+	InSource       string  `json:"in_source,omitempty"`
+	InAmount       float64 `json:"in_amount"`
+	InComment      string  `json:"in_comment,omitempty"`
+	Bounced        bool    `json:"bounced"`
+	OutDestination string  `json:"out_destination,omitempty"`
+	OutAmount      float64 `json:"out_amount"`
+	OutComment     string  `json:"out_comment,omitempty"`
+	Fee            float64 `json:"fee"`
+}
+
+// IndexerCursor is the last ingested transaction of a wallet
+type IndexerCursor struct {
+	Wallet    string `json:"wallet"`
+	LastLT    uint64 `json:"last_lt"`
+	LastHash  string `json:"last_hash"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+const (
+	// Investigation statuses of indexed transactions
+	InvestigationStatusOpen     = "open"
+	InvestigationStatusResolved = "resolved"
+)
+
+// ChainInvestigation is an admin note on a transaction that needs a closer look
+type ChainInvestigation struct {
+	Status    string `json:"status"`
+	Note      string `json:"note"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// ExplorerTransaction is an indexed transaction linked to internal records
+type ExplorerTransaction struct {
+	ChainTransaction
+	DepositID             *int                `json:"deposit_id,omitempty"`
+	DepositUserID         *int                `json:"deposit_user_id,omitempty"`
+	WithdrawalOperationID *int64              `json:"withdrawal_operation_id,omitempty"`
+	WithdrawalUserID      *int                `json:"withdrawal_user_id,omitempty"`
+	Unmatched             bool                `json:"unmatched"` // inflow without a matching deposit request
+	Investigation         *ChainInvestigation `json:"investigation,omitempty"`
+}
+
+// ExplorerFilter selects indexed transactions for the admin explorer
+type ExplorerFilter struct {
+	Wallet        string
+	Direction     string // "in", "out" or empty for both
+	UnmatchedOnly bool
+	Investigation string
+}
+
+type ExplorerPage struct {
+	Transactions []ExplorerTransaction `json:"transactions"`
+	Total        int                   `json:"total"`
+	PageSize     int                   `json:"page_size"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+}
+
+type SetInvestigationRequest struct {
+	Status string `json:"status" binding:"required"`
+	Note   string `json:"note"`
+}
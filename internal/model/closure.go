@@ -0,0 +1,19 @@
+package model
+
+const OperationTypeAccountClosed OperationType = "account_closed"
+
+// CloseAccountRequest carries the wallet signature of an account closure challenge.
+// KeepBalance closes the account without paying out and anonymizing it.
+type CloseAccountRequest struct {
+	Nonce       string `json:"nonce" binding:"required"`
+	Signature   string `json:"signature" binding:"required"`
+	KeepBalance bool   `json:"keep_balance"`
+}
+
+// LockedInvestment is an investment that blocks account closure until it unlocks
+type LockedInvestment struct {
+	ID        int     `json:"id"`
+	Type      string  `json:"type"`
+	Amount    float64 `json:"amount"`
+	UnlocksAt int64   `json:"unlocks_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// ConfigIssue is a problem the config check found in config.json
+type ConfigIssue struct {
+	Fatal   bool   `json:"fatal"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ConfigReload is the result of reloading config.json. A file with fatal issues isn't
+// applied. RestartRequired names the changed sections the running server keeps.
+type ConfigReload struct {
+	Applied         bool          `json:"applied"`
+	LoadedAt        int64         `json:"loaded_at"`
+	Issues          []ConfigIssue `json:"issues,omitempty"`
+	RestartRequired []string      `json:"restart_required,omitempty"`
+}
@@ -1,15 +1,40 @@
 package model
 
-import "time"
-
 type DepositRequest struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Amount    float64   `json:"amount"`
-	Status    string    `json:"status"` // pending, completed, failed
-	Memo      string    `json:"memo"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int     `json:"id"`
+	UserID    int     `json:"user_id"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"` // pending, processing, review, completed, failed, expired, cancelled
+	Memo      string  `json:"memo"`
+	CreatedAt int64   `json:"created_at"`
+	// TreasuryWallet is the wallet the deposit is paid to, empty for the main wallet
+	TreasuryWallet string `json:"treasury_wallet,omitempty"`
+	// DepositAddress is the user's personal address the deposit is paid to without a
+	// memo, empty for deposits matched by memo
+	DepositAddress string `json:"deposit_address,omitempty"`
+	// RequestedAmount is the amount the request was created for when the transfer
+	// credited differed from it, see DepositMatchingConfig. Amount is then the amount
+	// received.
+	RequestedAmount *float64 `json:"requested_amount,omitempty"`
+	// TxHash is the hex hash of the transaction the user confirmed the deposit with, see
+	// ConfirmDepositRequest.TxHash
+	TxHash string `json:"tx_hash,omitempty"`
+}
+
+// DepositEvent is a status update of a deposit request streamed by the deposit events
+// route. Status is pending, detected (the transfer arrived and awaits confirmations),
+// review, completed, failed, expired or cancelled.
+type DepositEvent struct {
+	ID     int     `json:"id"`
+	Status string  `json:"status"`
+	Amount float64 `json:"amount"`
+}
+
+// DepositHistory is a page of a user's deposit requests, newest first
+type DepositHistory struct {
+	Deposits   []DepositRequest `json:"deposits"`
+	PageSize   int              `json:"page_size"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
 
 type DepositResponse struct {
@@ -18,14 +43,157 @@ type DepositResponse struct {
 	Status        string  `json:"status"`
 	Memo          string  `json:"memo"`
 	WalletAddress string  `json:"wallet_address"`
+	// PaymentLink is the ton://transfer link paying the request, with the amount and
+	// memo filled in
+	PaymentLink string `json:"payment_link"`
 }
 
 type CreateDepositRequest struct {
 	PubKey string  `json:"pub_key" binding:"required"`
 	Amount float64 `json:"amount" binding:"required,min=1"`
+	// InvestmentType routes the deposit to the treasury wallet of that product
+	InvestmentType string `json:"investment_type,omitempty"`
 }
 
 type ConfirmDepositRequest struct {
 	PubKey string `json:"pub_key" binding:"required"`
 	ID     int    `json:"deposit_id" binding:"required"`
+	// TxHash is the hash of the transfer as the wallet shows it, in hex or base64. The
+	// transaction is then looked up directly instead of searching the latest ones.
+	TxHash string `json:"tx_hash,omitempty"`
+}
+
+// DepositConfirmationTier defines the minimal transaction age required
+// before crediting deposits starting from MinAmount
+type DepositConfirmationTier struct {
+	MinAmount     float64 `json:"min_amount"`
+	MinAgeSeconds int     `json:"min_age_seconds"`
+}
+
+type DepositConfig struct {
+	ConfirmationTiers   []DepositConfirmationTier  `json:"confirmation_tiers"`
+	AbandonAfterMinutes int                        `json:"abandon_after_minutes"` // unfunded requests count as abandoned after this; default: 60
+	ExpireAfterMinutes  int                        `json:"expire_after_minutes"`  // unfunded requests expire after this; default: 1440
+	AmountBuckets       []float64                  `json:"amount_buckets"`        // bucket upper bounds for abandonment stats; default: 10, 100, 1000
+	Reminder            DepositReminderConfig      `json:"reminder"`
+	ArchiveLookup       DepositArchiveLookupConfig `json:"archive_lookup"`
+	Limits              DepositLimitsConfig        `json:"limits"`
+	Matching            DepositMatchingConfig      `json:"matching"`
+}
+
+// DepositMatchingConfig credits transfers that don't match the amount of their deposit
+// request exactly, at the amount received. By default only transfers of the exact
+// amount are credited.
+type DepositMatchingConfig struct {
+	Tolerance float64 `json:"tolerance"` // TON a transfer may differ from the requested amount by
+	// AcceptOverpayment credits transfers above the amount plus tolerance
+	AcceptOverpayment bool `json:"accept_overpayment"`
+	// CreditPartial credits transfers below the amount minus tolerance. Without it they
+	// are reported as partial payments and the request stays pending.
+	CreditPartial bool `json:"credit_partial"`
+}
+
+// DepositConfirmationAge returns the confirmation depth in seconds for a deposit amount,
+// taken from the highest tier the amount reaches
+func DepositConfirmationAge(tiers []DepositConfirmationTier, amount float64) int {
+	minAge := 0
+	bestTier := -1.0
+	for _, tier := range tiers {
+		if amount >= tier.MinAmount && tier.MinAmount > bestTier {
+			bestTier = tier.MinAmount
+			minAge = tier.MinAgeSeconds
+		}
+	}
+	return minAge
+}
+
+// DepositArchiveLookupConfig searches the wallet history of archive nodes for deposits
+// confirmed after their transfer dropped out of the latest transactions
+type DepositArchiveLookupConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxPages bounds the pages of 50 transactions searched per confirmation; deposits
+	// beyond them are escalated to an admin. Default: 20
+	MaxPages int `json:"max_pages"`
+}
+
+// DepositReminderConfig reminds users of deposit requests they haven't funded yet
+type DepositReminderConfig struct {
+	Enabled              bool `json:"enabled"`
+	AfterMinutes         int  `json:"after_minutes"`          // default: 30
+	CheckIntervalSeconds int  `json:"check_interval_seconds"` // default: 300
+}
+
+// DepositIntent is a deposit request as seen by abandonment analytics
+type DepositIntent struct {
+	ID         int
+	UserID     int
+	Amount     float64
+	Memo       string
+	Status     string
+	CreatedAt  int64
+	FundedAt   *int64
+	RemindedAt *int64
+	// TreasuryWallet, DepositAddress, RequestedAmount and TxHash are only kept by the
+	// in-memory store
+	TreasuryWallet  string
+	DepositAddress  string
+	RequestedAmount *float64
+	TxHash          string
+}
+
+// DepositIntentStats summarizes funded and abandoned deposit requests
+type DepositIntentStats struct {
+	Since               int64                 `json:"since"`
+	AbandonAfterMinutes int                   `json:"abandon_after_minutes"`
+	Total               DepositIntentBucket   `json:"total"`
+	Buckets             []DepositIntentBucket `json:"buckets"`
+}
+
+// DepositIntentBucket holds deposit request outcomes for an amount range
+type DepositIntentBucket struct {
+	MinAmount           float64  `json:"min_amount"`
+	MaxAmount           *float64 `json:"max_amount"` // nil for the open-ended last bucket
+	Created             int      `json:"created"`
+	Funded              int      `json:"funded"`
+	Pending             int      `json:"pending"`   // unfunded, still within abandon_after_minutes
+	Abandoned           int      `json:"abandoned"` // unfunded for longer than abandon_after_minutes
+	AbandonmentRate     float64  `json:"abandonment_rate"`
+	AvgMinutesToFund    float64  `json:"avg_minutes_to_fund"`
+	Reminded            int      `json:"reminded"`
+	FundedAfterReminder int      `json:"funded_after_reminder"`
+}
+
+// DepositSubwalletBase is the subwallet ID before the first personal deposit address,
+// far from the default subwallet ID of the main wallet
+const DepositSubwalletBase = 100000
+
+// DepositAddressesConfig gives every user a personal deposit address, a subwallet of the
+// main wallet, so deposits to the main wallet don't need a memo. Funds are swept from
+// the personal addresses to the main wallet.
+type DepositAddressesConfig struct {
+	Enabled              bool    `json:"enabled"`
+	SweepIntervalSeconds int     `json:"sweep_interval_seconds"` // default: 300
+	MinSweepAmount       float64 `json:"min_sweep_amount"`       // balance left on an address below this; default: 0.05
+	// SweepWindowHours is how long after a deposit request an address is checked for
+	// funds to sweep; default: 24
+	SweepWindowHours int `json:"sweep_window_hours"`
+}
+
+// DepositAddress is the personal deposit address of a user
+type DepositAddress struct {
+	UserID      int     `json:"user_id"`
+	SubwalletID uint32  `json:"subwallet_id"`
+	Address     string  `json:"address,omitempty"`
+	CreatedAt   int64   `json:"created_at"`
+	UsedAt      int64   `json:"used_at"` // last deposit request paid to the address
+	SweptAt     *int64  `json:"swept_at,omitempty"`
+	Swept       float64 `json:"swept"` // total swept to the main wallet
+}
+
+// DepositSweepResult summarizes a sweep of the personal deposit addresses
+type DepositSweepResult struct {
+	Checked int     `json:"checked"`
+	Swept   int     `json:"swept"`
+	Amount  float64 `json:"amount"`
+	Failed  int     `json:"failed"`
 }
@@ -0,0 +1,40 @@
+package model
+
+// DepositLimitVerified is the tier of deposit limits of users whose identity an admin verified
+const DepositLimitVerified = "verified"
+
+// DepositLimitsConfig bounds the amount of deposit requests and payment top-ups.
+// Users of a tier get its limits instead, with the largest maximum when they are in
+// several.
+type DepositLimitsConfig struct {
+	MinAmount float64                 `json:"min_amount"` // 0: no minimum
+	MaxAmount float64                 `json:"max_amount"` // 0: no maximum
+	Tiers     map[string]DepositLimit `json:"tiers"`      // by tier name, e.g. "verified"
+}
+
+// DepositLimit is the bounds of one tier, 0 takes the default of deposit.limits
+type DepositLimit struct {
+	MinAmount float64 `json:"min_amount"`
+	MaxAmount float64 `json:"max_amount"`
+}
+
+// UserDepositLimits is the bounds applied to the deposits of a user
+type UserDepositLimits struct {
+	Tier      string  `json:"tier,omitempty"` // empty for the defaults
+	MinAmount float64 `json:"min_amount"`
+	MaxAmount float64 `json:"max_amount,omitempty"` // omitted without a maximum
+}
+
+// UserVerification is the identity (KYC) check of a user, done outside the app
+type UserVerification struct {
+	UserID    int    `json:"user_id"`
+	Verified  bool   `json:"verified"`
+	Note      string `json:"note,omitempty"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// SetUserVerificationRequest marks a user verified or not
+type SetUserVerificationRequest struct {
+	Verified *bool  `json:"verified" binding:"required"`
+	Note     string `json:"note"` // e.g. the case number of the KYC provider
+}
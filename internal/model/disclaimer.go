@@ -0,0 +1,29 @@
+package model
+
+// RiskDisclaimerConfig requires an explicit risk acknowledgment before each investment
+// into a product paying more than WeeklyPercentThreshold per week, 0 disables it.
+// Acknowledging returns a single-use token the investment has to carry.
+type RiskDisclaimerConfig struct {
+	WeeklyPercentThreshold float64 `json:"weekly_percent_threshold"`
+	Version                string  `json:"version"`
+	Text                   string  `json:"text"`
+	TokenTTLMinutes        int     `json:"token_ttl_minutes"` // 0 means 15
+}
+
+// RiskAcknowledgment records that a user acknowledged the risk disclaimer of a product
+// at the weekly percent they were offered
+type RiskAcknowledgment struct {
+	ID             int64   `json:"id"`
+	UserID         int     `json:"user_id"`
+	Type           string  `json:"type"`
+	WeeklyPercent  float64 `json:"weekly_percent"`
+	Version        string  `json:"version"`
+	IP             string  `json:"ip,omitempty"`
+	AcknowledgedAt int64   `json:"acknowledged_at"`
+	ExpiresAt      int64   `json:"expires_at"`
+	UsedAt         *int64  `json:"used_at,omitempty"` // when an investment consumed the token
+}
+
+type AcknowledgeRiskRequest struct {
+	Acknowledged bool `json:"acknowledged" binding:"required"`
+}
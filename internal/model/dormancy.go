@@ -0,0 +1,40 @@
+package model
+
+const (
+	// Dormancy rule actions
+	DormancyActionNotify                   = "notify"
+	DormancyActionCloseFlexibleInvestments = "close_flexible_investments"
+
+	OperationTypeDormancyNotice OperationType = "dormancy_notice"
+	OperationTypeDormancyAction OperationType = "dormancy_action"
+)
+
+// DormancyConfig holds the inactivity rules checked by the dormancy job
+type DormancyConfig struct {
+	Enabled              bool           `json:"enabled"`
+	CheckIntervalSeconds int            `json:"check_interval_seconds"`
+	Rules                []DormancyRule `json:"rules"`
+}
+
+// DormancyRule applies Action to users inactive for InactiveDays. Users are
+// notified GraceDays before that and the rule is reset once they come back.
+type DormancyRule struct {
+	Name         string `json:"name"`
+	InactiveDays int    `json:"inactive_days"`
+	GraceDays    int    `json:"grace_days"`
+	Action       string `json:"action"`
+}
+
+// DormantUser is a user with their last activity time
+type DormantUser struct {
+	UserID       int   `json:"user_id"`
+	LastActiveAt int64 `json:"last_active_at"`
+}
+
+// DormancyNotice tracks the progress of a rule for a user
+type DormancyNotice struct {
+	UserID     int    `json:"user_id"`
+	Rule       string `json:"rule"`
+	NotifiedAt int64  `json:"notified_at"`
+	ExecutedAt *int64 `json:"executed_at,omitempty"`
+}
@@ -0,0 +1,242 @@
+package model
+
+import "net/http"
+
+// ErrorCode identifies an error response, so clients can show their own message for it
+// instead of the English error text, which may change
+type ErrorCode string
+
+// Codes of errors any route may return, set from the HTTP status when a response has
+// no more specific code
+const (
+	ErrorInvalidRequest     ErrorCode = "invalid_request"
+	ErrorUnauthorized       ErrorCode = "unauthorized"
+	ErrorForbidden          ErrorCode = "forbidden"
+	ErrorNotFound           ErrorCode = "not_found"
+	ErrorConflict           ErrorCode = "conflict"
+	ErrorRateLimited        ErrorCode = "rate_limited"
+	ErrorInternal           ErrorCode = "internal_error"
+	ErrorServiceUnavailable ErrorCode = "service_unavailable"
+)
+
+// Codes of specific errors
+const (
+	ErrorUserNotFound          ErrorCode = "user_not_found"
+	ErrorSessionMissing        ErrorCode = "session_missing"
+	ErrorSessionExpired        ErrorCode = "session_expired"
+	ErrorSessionInvalid        ErrorCode = "session_invalid"
+	ErrorSessionWalletMismatch ErrorCode = "session_wallet_mismatch"
+	ErrorTonProofFailed        ErrorCode = "ton_proof_failed"
+	ErrorAPITokenMissing       ErrorCode = "api_token_missing"
+	ErrorAPITokenInvalid       ErrorCode = "api_token_invalid"
+	ErrorAPITokenReadOnly      ErrorCode = "api_token_read_only"
+	ErrorAdminKeyInvalid       ErrorCode = "admin_key_invalid"
+	ErrorAdminRoleForbidden    ErrorCode = "admin_role_forbidden"
+	ErrorReadOnly              ErrorCode = "read_only"
+	ErrorIdempotencyKeyInvalid ErrorCode = "idempotency_key_invalid"
+	ErrorIdempotencyKeyReused  ErrorCode = "idempotency_key_reused"
+	ErrorIdempotencyInProgress ErrorCode = "idempotency_in_progress"
+	ErrorInsufficientBalance   ErrorCode = "insufficient_balance"
+	ErrorDepositLimit          ErrorCode = "deposit_limit"
+	ErrorDepositNotFound       ErrorCode = "deposit_not_found"
+	ErrorDepositPartial        ErrorCode = "deposit_partial"
+	ErrorInvestmentPaused      ErrorCode = "investment_paused"
+	ErrorInvestmentRetired     ErrorCode = "investment_retired"
+	ErrorTermsNotAccepted      ErrorCode = "terms_not_accepted"
+	ErrorTermsOutdated         ErrorCode = "terms_outdated"
+	ErrorRiskNotAcknowledged   ErrorCode = "risk_not_acknowledged"
+	ErrorAccountClosed         ErrorCode = "account_closed"
+	ErrorAccountFrozen         ErrorCode = "account_frozen"
+	ErrorWithdrawalUnconfirmed ErrorCode = "withdrawal_unconfirmed"
+	ErrorAddressNotWhitelisted ErrorCode = "address_not_whitelisted"
+	ErrorWithdrawalLimit       ErrorCode = "withdrawal_limit"
+	ErrorWithdrawalCooldown    ErrorCode = "withdrawal_cooldown"
+)
+
+// ErrorCodeInfo is an entry of the error catalog served by GET /api/v1/errors
+type ErrorCodeInfo struct {
+	Code   ErrorCode `json:"code"`
+	Status int       `json:"status"` // HTTP status of responses with the code
+	// Messages are the default texts to show, by language of SupportedLanguages
+	Messages map[string]string `json:"messages"`
+}
+
+// ErrorCatalog is the registry of every error code, generic codes first. A new code
+// needs an entry here with a message in each of SupportedLanguages.
+var ErrorCatalog = []ErrorCodeInfo{
+	{ErrorInvalidRequest, http.StatusBadRequest, map[string]string{
+		"en": "The request is invalid.",
+		"ru": "Некорректный запрос.",
+	}},
+	{ErrorUnauthorized, http.StatusUnauthorized, map[string]string{
+		"en": "Authentication is required.",
+		"ru": "Требуется авторизация.",
+	}},
+	{ErrorForbidden, http.StatusForbidden, map[string]string{
+		"en": "You are not allowed to do this.",
+		"ru": "Это действие запрещено.",
+	}},
+	{ErrorNotFound, http.StatusNotFound, map[string]string{
+		"en": "Not found.",
+		"ru": "Не найдено.",
+	}},
+	{ErrorConflict, http.StatusConflict, map[string]string{
+		"en": "This can't be done right now, refresh and try again.",
+		"ru": "Сейчас это невозможно, обновите данные и попробуйте снова.",
+	}},
+	{ErrorRateLimited, http.StatusTooManyRequests, map[string]string{
+		"en": "Too many requests, try again in a moment.",
+		"ru": "Слишком много запросов, попробуйте чуть позже.",
+	}},
+	{ErrorInternal, http.StatusInternalServerError, map[string]string{
+		"en": "Something went wrong on our side, please try again later.",
+		"ru": "Что-то пошло не так, попробуйте позже.",
+	}},
+	{ErrorServiceUnavailable, http.StatusServiceUnavailable, map[string]string{
+		"en": "The service is temporarily unavailable, please try again later.",
+		"ru": "Сервис временно недоступен, попробуйте позже.",
+	}},
+
+	{ErrorUserNotFound, http.StatusNotFound, map[string]string{
+		"en": "No account was found for this wallet.",
+		"ru": "Аккаунт для этого кошелька не найден.",
+	}},
+	{ErrorSessionMissing, http.StatusUnauthorized, map[string]string{
+		"en": "Connect your wallet to continue.",
+		"ru": "Подключите кошелёк, чтобы продолжить.",
+	}},
+	{ErrorSessionExpired, http.StatusUnauthorized, map[string]string{
+		"en": "Your session expired, connect your wallet again.",
+		"ru": "Сессия истекла, подключите кошелёк заново.",
+	}},
+	{ErrorSessionInvalid, http.StatusUnauthorized, map[string]string{
+		"en": "Your session is invalid, connect your wallet again.",
+		"ru": "Сессия недействительна, подключите кошелёк заново.",
+	}},
+	{ErrorSessionWalletMismatch, http.StatusForbidden, map[string]string{
+		"en": "You are connected with another wallet.",
+		"ru": "Вы подключены с другим кошельком.",
+	}},
+	{ErrorTonProofFailed, http.StatusUnauthorized, map[string]string{
+		"en": "The wallet signature couldn't be verified, try connecting again.",
+		"ru": "Не удалось проверить подпись кошелька, подключитесь снова.",
+	}},
+	{ErrorAPITokenMissing, http.StatusUnauthorized, map[string]string{
+		"en": "An API token is required.",
+		"ru": "Требуется API-токен.",
+	}},
+	{ErrorAPITokenInvalid, http.StatusUnauthorized, map[string]string{
+		"en": "The API token is invalid or was revoked.",
+		"ru": "API-токен недействителен или отозван.",
+	}},
+	{ErrorAPITokenReadOnly, http.StatusForbidden, map[string]string{
+		"en": "The API token only allows reading.",
+		"ru": "API-токен разрешает только чтение.",
+	}},
+	{ErrorAdminKeyInvalid, http.StatusUnauthorized, map[string]string{
+		"en": "The admin key is invalid.",
+		"ru": "Неверный ключ администратора.",
+	}},
+	{ErrorAdminRoleForbidden, http.StatusForbidden, map[string]string{
+		"en": "The role of this admin key doesn't allow this.",
+		"ru": "Роль этого ключа администратора не позволяет это действие.",
+	}},
+	{ErrorReadOnly, http.StatusServiceUnavailable, map[string]string{
+		"en": "Maintenance in progress, balances and history can still be viewed.",
+		"ru": "Идут технические работы, баланс и история по-прежнему доступны.",
+	}},
+	{ErrorIdempotencyKeyInvalid, http.StatusBadRequest, map[string]string{
+		"en": "The Idempotency-Key header is invalid.",
+		"ru": "Некорректный заголовок Idempotency-Key.",
+	}},
+	{ErrorIdempotencyKeyReused, http.StatusUnprocessableEntity, map[string]string{
+		"en": "This Idempotency-Key was already used for another request.",
+		"ru": "Этот Idempotency-Key уже использован для другого запроса.",
+	}},
+	{ErrorIdempotencyInProgress, http.StatusConflict, map[string]string{
+		"en": "The same request is still being processed.",
+		"ru": "Такой же запрос ещё обрабатывается.",
+	}},
+	{ErrorInsufficientBalance, http.StatusBadRequest, map[string]string{
+		"en": "Your balance is too low.",
+		"ru": "Недостаточно средств на балансе.",
+	}},
+	{ErrorDepositLimit, http.StatusBadRequest, map[string]string{
+		"en": "The amount is outside your deposit limits.",
+		"ru": "Сумма выходит за лимиты пополнения.",
+	}},
+	{ErrorDepositNotFound, http.StatusNotFound, map[string]string{
+		"en": "The deposit request wasn't found.",
+		"ru": "Заявка на пополнение не найдена.",
+	}},
+	{ErrorDepositPartial, http.StatusBadRequest, map[string]string{
+		"en": "Less than the deposit amount arrived, please contact support.",
+		"ru": "Поступило меньше суммы пополнения, обратитесь в поддержку.",
+	}},
+	{ErrorInvestmentPaused, http.StatusServiceUnavailable, map[string]string{
+		"en": "New investments in this product are temporarily paused.",
+		"ru": "Новые инвестиции в этот продукт временно приостановлены.",
+	}},
+	{ErrorInvestmentRetired, http.StatusConflict, map[string]string{
+		"en": "This product no longer accepts investments.",
+		"ru": "Этот продукт больше не принимает инвестиции.",
+	}},
+	{ErrorTermsNotAccepted, http.StatusPreconditionRequired, map[string]string{
+		"en": "Accept the terms of this product first.",
+		"ru": "Сначала примите условия этого продукта.",
+	}},
+	{ErrorTermsOutdated, http.StatusConflict, map[string]string{
+		"en": "The terms changed, review and accept the new version.",
+		"ru": "Условия изменились, ознакомьтесь с новой версией и примите её.",
+	}},
+	{ErrorRiskNotAcknowledged, http.StatusPreconditionRequired, map[string]string{
+		"en": "Acknowledge the risk disclaimer of this product first.",
+		"ru": "Сначала подтвердите ознакомление с рисками этого продукта.",
+	}},
+	{ErrorAccountClosed, http.StatusForbidden, map[string]string{
+		"en": "Your account is closed, you can only withdraw the remaining balance.",
+		"ru": "Ваш аккаунт закрыт, можно только вывести оставшийся баланс.",
+	}},
+	{ErrorAccountFrozen, http.StatusForbidden, map[string]string{
+		"en": "Your account is frozen, please contact support.",
+		"ru": "Ваш аккаунт заморожен, обратитесь в поддержку.",
+	}},
+	{ErrorWithdrawalUnconfirmed, http.StatusUnauthorized, map[string]string{
+		"en": "Confirm the withdrawal with your wallet and try again.",
+		"ru": "Подтвердите вывод кошельком и попробуйте снова.",
+	}},
+	{ErrorAddressNotWhitelisted, http.StatusForbidden, map[string]string{
+		"en": "Add this address to your address book first, withdrawals to it are allowed once it is activated.",
+		"ru": "Сначала добавьте адрес в адресную книгу, вывод на него станет доступен после активации.",
+	}},
+	{ErrorWithdrawalLimit, http.StatusBadRequest, map[string]string{
+		"en": "The amount is outside your withdrawal limits.",
+		"ru": "Сумма выходит за лимиты вывода.",
+	}},
+	{ErrorWithdrawalCooldown, http.StatusTooManyRequests, map[string]string{
+		"en": "You withdrew recently, try again once the waiting time is over.",
+		"ru": "Вы недавно выводили средства, попробуйте снова после окончания ожидания.",
+	}},
+}
+
+// ErrorCodeForStatus returns the generic code of an error status
+func ErrorCodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusUnauthorized:
+		return ErrorUnauthorized
+	case http.StatusForbidden:
+		return ErrorForbidden
+	case http.StatusNotFound:
+		return ErrorNotFound
+	case http.StatusConflict:
+		return ErrorConflict
+	case http.StatusTooManyRequests:
+		return ErrorRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrorServiceUnavailable
+	}
+	if status >= 500 {
+		return ErrorInternal
+	}
+	return ErrorInvalidRequest
+}
@@ -0,0 +1,59 @@
+package model
+
+// ExperimentConfig tests variant terms of an investment type on cohorts of users.
+// Users are assigned a variant deterministically the first time they see the product
+// and keep it. Disabling an experiment stops new assignments, assigned users keep their
+// variant terms until the experiment is removed from the config.
+type ExperimentConfig struct {
+	Name           string              `json:"name"`
+	InvestmentType string              `json:"investment_type"`
+	Enabled        bool                `json:"enabled"`
+	Variants       []ExperimentVariant `json:"variants"`
+}
+
+// ExperimentVariant is a cohort of an experiment. Weight is its share of the assigned
+// users relative to the other variants.
+type ExperimentVariant struct {
+	Name          string  `json:"name"`
+	Weight        int     `json:"weight"`
+	WeeklyPercent float64 `json:"weekly_percent"` // 0 keeps the investment type's percent
+}
+
+// ExperimentExposure is the variant assigned to a user and how often it was shown
+type ExperimentExposure struct {
+	Experiment     string `json:"experiment"`
+	UserID         int    `json:"user_id"`
+	Variant        string `json:"variant"`
+	FirstExposedAt int64  `json:"first_exposed_at"`
+	LastExposedAt  int64  `json:"last_exposed_at"`
+	Exposures      int    `json:"exposures"`
+}
+
+// ExperimentVariantStats counts the users of a variant and what they did after their
+// first exposure
+type ExperimentVariantStats struct {
+	Variant       string  `json:"variant"`
+	WeeklyPercent float64 `json:"weekly_percent"`
+	Users         int     `json:"users"`
+	Exposures     int     `json:"exposures"`
+	Depositors    int     `json:"depositors"`
+	Deposited     float64 `json:"deposited"`
+	Investors     int     `json:"investors"` // users who invested into the tested product
+	Invested      float64 `json:"invested"`
+	// Conversions are percentages of the variant's users
+	DepositConversion    float64 `json:"deposit_conversion"`
+	InvestmentConversion float64 `json:"investment_conversion"`
+	// Configured is false for variants removed from the config since users were assigned
+	Configured bool `json:"configured"`
+}
+
+// ExperimentReport compares the conversion of the variants of an experiment
+type ExperimentReport struct {
+	Experiment        string                   `json:"experiment"`
+	InvestmentType    string                   `json:"investment_type"`
+	Enabled           bool                     `json:"enabled"`
+	BaseWeeklyPercent float64                  `json:"base_weekly_percent"`
+	Users             int                      `json:"users"`
+	Variants          []ExperimentVariantStats `json:"variants"`
+	GeneratedAt       int64                    `json:"generated_at"`
+}
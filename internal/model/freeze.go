@@ -0,0 +1,14 @@
+package model
+
+// UserFreeze is whether an admin froze an account, e.g. during a fraud investigation
+type UserFreeze struct {
+	UserID   int    `json:"user_id"`
+	Frozen   bool   `json:"frozen"`
+	Reason   string `json:"reason,omitempty"`
+	FrozenAt *int64 `json:"frozen_at,omitempty"`
+}
+
+// FreezeUserRequest freezes an account
+type FreezeUserRequest struct {
+	Reason string `json:"reason" binding:"required"` // e.g. the case number of the investigation
+}
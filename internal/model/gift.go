@@ -0,0 +1,46 @@
+package model
+
+const (
+	// Gift statuses
+	GiftStatusActive   = "active"
+	GiftStatusClaimed  = "claimed"
+	GiftStatusRefunded = "refunded"
+
+	OperationTypeGiftSent     OperationType = "gift_sent"
+	OperationTypeGiftClaimed  OperationType = "gift_claimed"
+	OperationTypeGiftRefunded OperationType = "gift_refunded"
+)
+
+// GiftConfig controls investment gifts
+type GiftConfig struct {
+	ExpiryDays           int `json:"expiry_days"`     // default lifetime of an unclaimed gift
+	MaxExpiryDays        int `json:"max_expiry_days"` // upper bound for a sender-chosen lifetime
+	CheckIntervalSeconds int `json:"check_interval_seconds"`
+}
+
+// Gift is an investment paid by the sender and claimed by a recipient with a one-time code
+type Gift struct {
+	ID          int64   `json:"id"`
+	Code        string  `json:"code,omitempty"`
+	SenderID    int     `json:"sender_id"`
+	RecipientID *int    `json:"recipient_id,omitempty"`
+	Amount      float64 `json:"amount"`
+	Type        string  `json:"type"`
+	Status      string  `json:"status"`
+	ClaimLink   string  `json:"claim_link,omitempty"`
+	CreatedAt   int64   `json:"created_at"`
+	ExpiresAt   int64   `json:"expires_at"`
+	ClaimedAt   *int64  `json:"claimed_at,omitempty"`
+}
+
+type CreateGiftRequest struct {
+	Type          string  `json:"type" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	ExpiresInDays int     `json:"expires_in_days"`
+}
+
+type ClaimGiftRequest struct {
+	Code               string `json:"code" binding:"required"`
+	AcceptTermsVersion string `json:"accept_terms_version"`
+	RiskToken          string `json:"risk_token"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// IdempotencyConfig controls the Idempotency-Key header of the deposit, withdrawal and
+// investment routes
+type IdempotencyConfig struct {
+	TTLHours int `json:"ttl_hours"` // how long a key replays its response, default: 24
+}
+
+// IdempotencyRecord is the response stored for an Idempotency-Key. Status is 0 while
+// the first request with the key is still running.
+type IdempotencyRecord struct {
+	Scope       string // wallet of the session, or the client IP without one
+	Key         string
+	Route       string
+	RequestHash string // sha256 of the method, path and body
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   int64
+}
@@ -0,0 +1,67 @@
+package model
+
+// Integrity checks
+const (
+	// IntegrityOrphanedOperations are operations of users that no longer exist
+	IntegrityOrphanedOperations = "orphaned_operations"
+	// IntegrityOrphanedEarnings are referral earnings of referrers that no longer exist
+	IntegrityOrphanedEarnings = "orphaned_earnings"
+	// IntegrityNegativeBalances are users with a balance below zero
+	IntegrityNegativeBalances = "negative_balances"
+	// IntegrityPendingWithdrawalsWithTxHash are withdrawals still pending or processing
+	// although their transfer was sent
+	IntegrityPendingWithdrawalsWithTxHash = "pending_withdrawals_with_tx_hash"
+	// IntegrityUnsettledWithdrawalsWithTxHash are withdrawal requests and queued
+	// withdrawals with a sent transfer that weren't marked sent
+	IntegrityUnsettledWithdrawalsWithTxHash = "unsettled_withdrawals_with_tx_hash"
+	// IntegrityDuplicatePubKeys are wallets with more than one user, pub keys compared
+	// ignoring case
+	IntegrityDuplicatePubKeys = "duplicate_pub_keys"
+)
+
+// IntegrityConfig controls the integrity check run at startup
+type IntegrityConfig struct {
+	CheckOnStartup bool `json:"check_on_startup"`
+	// AutoRepair lists the checks repaired at startup when they find something, only
+	// checks with an automatic repair are allowed
+	AutoRepair []string `json:"auto_repair"`
+	SampleSize int      `json:"sample_size"` // records listed per check, default: 10
+}
+
+// IntegritySample is a record found by an integrity check
+type IntegritySample struct {
+	ID     int64   `json:"id,omitempty"` // row in the table of the check
+	UserID int     `json:"user_id,omitempty"`
+	Amount float64 `json:"amount,omitempty"`
+	Detail string  `json:"detail,omitempty"`
+}
+
+// IntegrityCheck is the outcome of one integrity check
+type IntegrityCheck struct {
+	Name    string            `json:"name"`
+	Tables  []string          `json:"tables"`
+	Count   int               `json:"count"`
+	Samples []IntegritySample `json:"samples"`
+	// Repairable is true when POST /admin/integrity/repair can fix what the check found,
+	// Advice says what the repair does or how to fix it by hand
+	Repairable bool   `json:"repairable"`
+	Advice     string `json:"advice,omitempty"`
+}
+
+// IntegrityReport is the result of the integrity checks
+type IntegrityReport struct {
+	CheckedAt int64            `json:"checked_at"`
+	Healthy   bool             `json:"healthy"`
+	Checks    []IntegrityCheck `json:"checks"`
+}
+
+// IntegrityRepairRequest lists the checks to repair
+type IntegrityRepairRequest struct {
+	Checks []string `json:"checks" binding:"required,min=1"`
+}
+
+// IntegrityRepair is the number of records a repair fixed
+type IntegrityRepair struct {
+	Check    string `json:"check"`
+	Repaired int    `json:"repaired"`
+}
@@ -0,0 +1,137 @@
+package model
+
+// Ledger accounts. Every balance movement is a transfer between two of them,
+// recorded as a debit on one account and a credit on the other, so the
+// credits minus debits of all accounts always sum to zero.
+const (
+	// LedgerAccountUser is the balance of one user, identified by the entry user ID
+	LedgerAccountUser = "user"
+	// LedgerAccountExternal is TON entering or leaving the platform wallets
+	LedgerAccountExternal = "external"
+	// LedgerAccountPayments is value bought through alternative payment rails
+	LedgerAccountPayments = "payments"
+	// LedgerAccountInvestments holds the principal of open investments
+	LedgerAccountInvestments = "investments"
+	// LedgerAccountProfit pays out investment profit
+	LedgerAccountProfit = "profit"
+	// LedgerAccountReferrals pays out referral earnings
+	LedgerAccountReferrals = "referrals"
+	// LedgerAccountGifts holds the amount of unclaimed gifts
+	LedgerAccountGifts = "gifts"
+	// LedgerAccountWithdrawalQueue holds withdrawals reserved in the liquidity queue
+	LedgerAccountWithdrawalQueue = "withdrawal_queue"
+	// LedgerAccountWithdrawalApproval holds withdrawals waiting for admin approval
+	LedgerAccountWithdrawalApproval = "withdrawal_approval"
+	// LedgerAccountAdjustments is the counterpart of admin balance changes and opening balances
+	LedgerAccountAdjustments = "adjustments"
+)
+
+// Ledger transfer kinds
+const (
+	LedgerKindOpeningBalance     = "opening_balance"
+	LedgerKindAdjustment         = "adjustment"
+	LedgerKindDeposit            = "deposit"
+	LedgerKindPayment            = "payment"
+	LedgerKindWithdrawal         = "withdrawal"
+	LedgerKindWithdrawalQueued   = "withdrawal_queued"
+	LedgerKindWithdrawalSent     = "withdrawal_sent"
+	LedgerKindWithdrawalFailed   = "withdrawal_failed"
+	LedgerKindWithdrawalHeld     = "withdrawal_held"
+	LedgerKindWithdrawalRejected = "withdrawal_rejected"
+	LedgerKindWithdrawalApproved = "withdrawal_approved"
+	LedgerKindInvestmentCreated  = "investment_created"
+	LedgerKindInvestmentClosed   = "investment_closed"
+	LedgerKindInvestmentProfit   = "investment_profit"
+	LedgerKindReferralEarning    = "referral_earning"
+	LedgerKindReferralClawback   = "referral_clawback"
+	LedgerKindGiftSent           = "gift_sent"
+	LedgerKindGiftClaimed        = "gift_claimed"
+	LedgerKindGiftRefunded       = "gift_refunded"
+	LedgerKindAccountClosure     = "account_closure"
+	LedgerKindUserDeleted        = "user_deleted"
+)
+
+// LedgerEntry is one side of a ledger transfer
+type LedgerEntry struct {
+	ID         int64   `json:"id"`
+	TransferID int64   `json:"transfer_id"`
+	Account    string  `json:"account"`
+	UserID     *int    `json:"user_id,omitempty"`
+	Debit      float64 `json:"debit"`
+	Credit     float64 `json:"credit"`
+	Kind       string  `json:"kind"`
+	Reference  string  `json:"reference,omitempty"`
+	// Wallet is the treasury wallet of transfers from or to the external account,
+	// empty for the main wallet
+	Wallet    string `json:"wallet,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// LedgerHistory is a page of ledger entries
+type LedgerHistory struct {
+	Entries    []LedgerEntry `json:"entries"`
+	Balance    float64       `json:"balance"`
+	PageSize   int           `json:"page_size"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// LedgerAccountBalance is the credits minus debits of a system account
+type LedgerAccountBalance struct {
+	Account  string   `json:"account"`
+	Balance  float64  `json:"balance"`
+	Entries  int      `json:"entries"`
+	Expected *float64 `json:"expected,omitempty"` // what the account should hold according to its table
+}
+
+// LedgerMismatch is a user whose stored balance differs from the ledger sum
+type LedgerMismatch struct {
+	UserID        int     `json:"user_id"`
+	Balance       float64 `json:"balance"`
+	LedgerBalance float64 `json:"ledger_balance"`
+	Difference    float64 `json:"difference"`
+}
+
+// LedgerReconciliation is the result of checking user balances against the ledger
+type LedgerReconciliation struct {
+	CheckedAt  int64                  `json:"checked_at"`
+	Balanced   bool                   `json:"balanced"`
+	Total      float64                `json:"total"` // sum over all accounts, zero unless entries are missing
+	Users      float64                `json:"users"` // sum of all user accounts
+	Accounts   []LedgerAccountBalance `json:"accounts"`
+	Mismatches []LedgerMismatch       `json:"mismatches"`
+}
+
+// Sources of a reconstructed balance
+const (
+	// BalanceSourceLedger sums the user's ledger entries up to the requested time
+	BalanceSourceLedger = "ledger"
+	// BalanceSourceSnapshot is the last daily snapshot before the requested time,
+	// for times before the ledger was opened
+	BalanceSourceSnapshot = "snapshot"
+	// BalanceSourceNone means neither the ledger nor a snapshot covers the requested time
+	BalanceSourceNone = "none"
+)
+
+// HistoricalInvestment is an investment that was open at the requested time
+type HistoricalInvestment struct {
+	ID        int64   `json:"id"`
+	Type      string  `json:"type"`
+	Amount    float64 `json:"amount"`
+	CreatedAt int64   `json:"created_at"`
+	ClosedAt  *int64  `json:"closed_at,omitempty"` // closed later, nil while still open
+	ClosedBy  string  `json:"closed_by,omitempty"` // policy or user_deleted, empty when closed by the user
+}
+
+// BalanceAsOf is a user's balance and open investments at a past time
+type BalanceAsOf struct {
+	UserID        int                    `json:"user_id"`
+	At            int64                  `json:"at"`
+	Balance       float64                `json:"balance"`
+	Source        string                 `json:"source"`
+	LedgerEntries int                    `json:"ledger_entries"` // entries up to At
+	LedgerStart   *int64                 `json:"ledger_start,omitempty"`
+	Invested      float64                `json:"invested"`
+	Investments   []HistoricalInvestment `json:"investments"`
+	// Snapshot is the last daily snapshot taken before At, to cross-check the balance
+	Snapshot *BalanceSnapshot `json:"snapshot,omitempty"`
+}
@@ -0,0 +1,7 @@
+package model
+
+// LoggingConfig sets up the structured logger
+type LoggingConfig struct {
+	Level  string `json:"level"`  // debug, info (default), warn or error
+	Format string `json:"format"` // text (default) or json, one object per line
+}
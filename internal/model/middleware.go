@@ -0,0 +1,17 @@
+package model
+
+// MiddlewareConfig controls the global middleware pipeline
+type MiddlewareConfig struct {
+	Pipeline []MiddlewareStep `json:"pipeline"` // in order of execution; empty for the default pipeline
+}
+
+// MiddlewareStep enables or disables one middleware of the pipeline
+type MiddlewareStep struct {
+	Name    string `json:"name"`
+	Enabled *bool  `json:"enabled"` // default: true
+}
+
+// IsEnabled reports whether the step runs
+func (s MiddlewareStep) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
@@ -26,41 +26,56 @@ type UpdateItemRequest struct {
 }
 
 type User struct {
-	ID                     int            `json:"id"`
-	PubKey                 string         `json:"pub_key"`
-	Name                   *string        `json:"name"`
-	Photo                  *string        `json:"photo"`
-	Balance                float64        `json:"balance"`
-	RefID                  *int           `json:"ref_id,omitempty"`
-	CreatedAt              int64          `json:"created_at"`
-	TotalEarnings          float64        `json:"total_earnings"`
-	CurrentInvestments     float64        `json:"current_investments"`
-	AvailableForWithdrawal float64        `json:"available_for_withdrawal"`
-	Investments            []Investment   `json:"investments,omitempty"`
-	ReferralStats          *ReferralStats `json:"referral_stats,omitempty"`
+	ID                     int             `json:"id"`
+	PubKey                 string          `json:"pub_key"`
+	AccountNumber          string          `json:"account_number"` // sequential, for support and statements
+	Name                   *string         `json:"name"`
+	Photo                  *string         `json:"photo"`
+	Balance                float64         `json:"balance"`
+	RefID                  *int            `json:"ref_id,omitempty"`
+	CreatedAt              int64           `json:"created_at"`
+	TotalEarnings          float64         `json:"total_earnings"`
+	CurrentInvestments     float64         `json:"current_investments"`
+	AvailableForWithdrawal float64         `json:"available_for_withdrawal"`
+	Preferences            UserPreferences `json:"preferences"`
+	Investments            []Investment    `json:"investments,omitempty"`
+	// ClosedAt is set once the user closed the account, it then only allows withdrawals
+	ClosedAt *int64 `json:"closed_at,omitempty"`
+	// FrozenAt is set while an admin froze the account, it then only allows reading
+	FrozenAt      *int64         `json:"frozen_at,omitempty"`
+	ReferralStats *ReferralStats `json:"referral_stats,omitempty"`
+	// DepositLimits, WithdrawalLimits and VIPTier are only set by
+	// GET /users/by-pubkey/:pub_key and GET /me
+	DepositLimits    *UserDepositLimits    `json:"deposit_limits,omitempty"`
+	WithdrawalLimits *UserWithdrawalLimits `json:"withdrawal_limits,omitempty"`
+	VIPTier          *UserVIPTier          `json:"vip_tier,omitempty"`
 }
 
 type Investment struct {
-	ID        int     `json:"id"`
-	UserID    int     `json:"user_id"`
-	Type      string  `json:"type"`
-	Amount    float64 `json:"amount"`
-	CreatedAt int64   `json:"created_at"`
+	ID            int     `json:"id"`
+	UserID        int     `json:"user_id"`
+	Type          string  `json:"type"`
+	Amount        float64 `json:"amount"`
+	CreatedAt     int64   `json:"created_at"`
+	LastAccruedAt int64   `json:"last_accrued_at,omitempty"`
 }
 
 // ReferralStats represents referral statistics
 type ReferralStats struct {
-	TotalReferrals   int              `json:"total_referrals"`
-	TotalEarnings    float64          `json:"total_earnings"`
-	TotalEarningsUSD float64          `json:"total_earnings_usd"`
-	ReferralsByLevel []ReferralDetail `json:"referrals_by_level"`
+	TotalReferrals    int              `json:"total_referrals"`
+	TotalEarnings     float64          `json:"total_earnings"`
+	TotalEarningsUSD  float64          `json:"total_earnings_usd"`
+	FiatCurrency      string           `json:"fiat_currency"`
+	FiatRate          float64          `json:"fiat_rate"`
+	TotalEarningsFiat float64          `json:"total_earnings_fiat"`
+	ReferralsByLevel  []ReferralDetail `json:"referrals_by_level"`
 }
 
 // ReferralDetail represents detailed information about a referral
 type ReferralDetail struct {
 	UserID              int     `json:"user_id"`
-	Name                *string  `json:"name"`
-	Photo               *string  `json:"photo"`
+	Name                *string `json:"name"`
+	Photo               *string `json:"photo"`
 	Level               int     `json:"level"`
 	TotalInvested       float64 `json:"total_invested"`
 	TotalInvestedUSD    float64 `json:"total_invested_usd"`
@@ -84,6 +99,29 @@ type ReferralEarning struct {
 	Amount     float64 `json:"amount"`
 	Level      int     `json:"level"`
 	CreatedAt  int64   `json:"created_at"`
+	// PeriodEnd is the end of the accrual period the earning was paid on, 0 for earnings
+	// recorded before it was tracked and for corrections
+	PeriodEnd int64 `json:"period_end,omitempty"`
+	// CorrectionID is the recomputation run that paid the earning as a compensation
+	CorrectionID *int64 `json:"correction_id,omitempty"`
+	// ReversalOf is the earning a clawback entry reverses and Reason why, the amount of
+	// a clawback entry is negative
+	ReversalOf *int64 `json:"reversal_of,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Referrer is a referrer in a user's referral chain. Closed accounts earn no referral
+// rewards from ClosedAt on.
+type Referrer struct {
+	ID       int
+	ClosedAt *int64
+}
+
+// ReferralEarningHistory is a page of a user's referral earnings, newest first
+type ReferralEarningHistory struct {
+	Earnings   []ReferralEarning `json:"earnings"`
+	PageSize   int               `json:"page_size"`
+	NextCursor string            `json:"next_cursor,omitempty"`
 }
 
 type Referral struct {
@@ -103,6 +141,8 @@ type Response struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    ErrorCode   `json:"code,omitempty"` // set on every error, see ErrorCatalog
+	Message string      `json:"message,omitempty"`
 }
 
 type ReferralTier struct {
@@ -114,6 +154,21 @@ type InvestmentTypeConfig struct {
 	WeeklyPercent float64 `json:"weekly_percent"`
 	MinAmount     float64 `json:"min_amount"`
 	LockPeriod    int     `json:"lock_period_days"` // 0 means can withdraw anytime
+	// TreasuryWallet routes deposits for this product to a wallet of ton.treasury_wallets
+	// instead of the main wallet
+	TreasuryWallet string `json:"treasury_wallet,omitempty"`
+	// SunsetAt retires the product at a unix time: new investments are refused and open
+	// ones are closed and refunded with their profit up to then
+	SunsetAt int64 `json:"sunset_at,omitempty"`
+}
+
+// AccrualConfig enables the weekly profit accrual of investments. Only time from StartAt
+// on is accrued, investments made before it accrue their first week from then.
+type AccrualConfig struct {
+	Enabled bool  `json:"enabled"`
+	StartAt int64 `json:"start_at"` // unix time, required when enabled
+	// PlatformFeePercent is the share of profit kept by the platform (default: 20)
+	PlatformFeePercent float64 `json:"platform_fee_percent,omitempty"`
 }
 
 type TelegramConfig struct {
@@ -121,6 +176,10 @@ type TelegramConfig struct {
 	WebAppURL   string `json:"web_app_url"`
 	WelcomeText string `json:"welcome_text"`
 	ButtonText  string `json:"button_text"`
+	// BotEnabled answers /start, /balance and /deposits in private chats with the bot
+	BotEnabled bool `json:"bot_enabled"`
+	// PollTimeoutSeconds is how long a getUpdates long poll waits (default: 30)
+	PollTimeoutSeconds int `json:"poll_timeout_seconds,omitempty"`
 }
 
 type TONConfig struct {
@@ -129,6 +188,53 @@ type TONConfig struct {
 	APIKey           string `json:"api_key"`
 	WalletVersion    string `json:"wallet_version"`
 	FeeWalletAddress string `json:"fee_wallet_address"`
+
+	Toncenter ToncenterBudgetConfig `json:"toncenter"`
+	// TreasuryWallets are segregated wallets products can route deposits to, by name
+	TreasuryWallets map[string]TreasuryWalletConfig `json:"treasury_wallets"`
+	// Jettons held by the treasury wallets, by symbol, reported next to their TON balances
+	Jettons map[string]JettonConfig `json:"jettons"`
+}
+
+// TreasuryWalletConfig is a treasury wallet besides the main wallet
+type TreasuryWalletConfig struct {
+	Mnemonic      string `json:"mnemonic"`
+	WalletVersion string `json:"wallet_version"` // default: ton.wallet_version
+}
+
+// ToncenterBudgetConfig paces toncenter API calls
+type ToncenterBudgetConfig struct {
+	RequestsPerSecond      float64 `json:"requests_per_second"` // default: 1 without API key, 10 with
+	MaxQueueWaitMs         int     `json:"max_queue_wait_ms"`
+	BalanceCacheTTLSeconds int     `json:"balance_cache_ttl_seconds"` // how stale a balance may be served when the budget is exhausted
+	// Failed calls (network errors, timeouts, 5xx, 429 with a short Retry-After) are retried
+	// with exponential backoff, each attempt within RequestTimeoutMs
+	MaxRetries       int `json:"max_retries"`        // default: 2
+	RetryBackoffMs   int `json:"retry_backoff_ms"`   // first delay, doubled per retry up to max_queue_wait_ms; default: 250
+	RequestTimeoutMs int `json:"request_timeout_ms"` // default: 10000
+	// After BreakerFailures failed attempts in a row, calls fail fast for
+	// BreakerCooldownSeconds, then a single call probes whether toncenter recovered
+	BreakerFailures        int `json:"breaker_failures"`         // default: 5
+	BreakerCooldownSeconds int `json:"breaker_cooldown_seconds"` // default: 30
+}
+
+// ToncenterBudgetStats reports toncenter request pacing
+type ToncenterBudgetStats struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	QueueDepth        int     `json:"queue_depth"`
+	MaxQueueDepth     int     `json:"max_queue_depth"`
+	Requests          uint64  `json:"requests"`
+	Throttled         uint64  `json:"throttled"` // 429 responses
+	Rejected          uint64  `json:"rejected"`  // calls not made to stay within the budget
+	Remaining         *int    `json:"remaining,omitempty"`
+	BlockedUntil      *int64  `json:"blocked_until,omitempty"`
+	CachedBalances    int     `json:"cached_balances"`
+	CacheHits         uint64  `json:"cache_hits"`
+	Retries           uint64  `json:"retries"`
+	Failures          uint64  `json:"failures"` // failed attempts: network errors, timeouts, 5xx
+	Circuit           string  `json:"circuit"`  // closed, open or half_open
+	CircuitOpened     uint64  `json:"circuit_opened"`
+	CircuitOpenUntil  *int64  `json:"circuit_open_until,omitempty"`
 }
 
 type DistributionWallet struct {
@@ -137,30 +243,144 @@ type DistributionWallet struct {
 }
 
 type RateLimitConfig struct {
+	RequestsPerSecond int                   `json:"requests_per_second"`
+	BurstSize         int                   `json:"burst_size"` // Максимальное количество запросов в пике
+	Bypass            RateLimitBypassConfig `json:"bypass"`
+	// Tiers are the buckets of requests carrying an API token, by tier name.
+	// Partner tokens are assigned a tier on approval, personal tokens use TokenTier.
+	Tiers     map[string]RateLimitTier `json:"tiers"`
+	TokenTier string                   `json:"token_tier"` // empty keeps personal tokens in the anonymous bucket
+	Store     RateLimitStoreConfig     `json:"store"`
+	Cleanup   RateLimitCleanupConfig   `json:"cleanup"`
+	// Routes are stricter buckets of expensive routes, taken in addition to the bucket above
+	Routes []RateLimitRoute `json:"routes"`
+}
+
+// RateLimitRoute is the bucket of a group of routes, e.g. withdrawals or deposits
+type RateLimitRoute struct {
+	Name string `json:"name"`
+	// Routes are gin route patterns like "/api/v1/users/by-pubkey/:pub_key/deposit",
+	// optionally preceded by a method: "POST /api/v1/users/withdraw"
+	Routes            []string `json:"routes"`
+	RequestsPerSecond int      `json:"requests_per_second"`
+	BurstSize         int      `json:"burst_size"`
+	// PerPubKey counts requests with a wallet session per wallet instead of per IP, so
+	// a user gets the same limit from every network
+	PerPubKey bool `json:"per_pub_key"`
+}
+
+// RateLimitCleanupConfig bounds the buckets kept in memory, one per client IP and token
+type RateLimitCleanupConfig struct {
+	IntervalSeconds int `json:"interval_seconds"` // default: 60
+	IdleTTLSeconds  int `json:"idle_ttl_seconds"` // buckets unused for longer are dropped, default: 600
+	MaxEntries      int `json:"max_entries"`      // the least recently used buckets over it are dropped, default: 100000
+}
+
+// RateLimitStoreConfig selects where the token buckets are kept
+type RateLimitStoreConfig struct {
+	// Backend is "memory" (default), limits count per instance, or "redis", limits are
+	// shared by every instance using the same server and key prefix
+	Backend   string      `json:"backend"`
+	Redis     RedisConfig `json:"redis"`
+	KeyPrefix string      `json:"key_prefix"` // default: "tonapp:ratelimit:"
+}
+
+// RateLimitTier is the bucket of one API token, shared by all of its clients
+type RateLimitTier struct {
 	RequestsPerSecond int `json:"requests_per_second"`
-	BurstSize         int `json:"burst_size"` // Максимальное количество запросов в пике
+	BurstSize         int `json:"burst_size"`
+}
+
+// RateLimitBypassConfig controls signed tokens issued to the official frontend
+// which grant a larger bucket for legitimate bursts
+type RateLimitBypassConfig struct {
+	Secret            string   `json:"secret"`
+	AllowedOrigins    []string `json:"allowed_origins"`
+	TTLSeconds        int      `json:"ttl_seconds"`
+	RequestsPerSecond int      `json:"requests_per_second"`
+	BurstSize         int      `json:"burst_size"`
+	// IssuePerHour and IssueBurstSize limit the tokens issued to one IP (defaults: 90 and 5)
+	IssuePerHour   int `json:"issue_per_hour"`
+	IssueBurstSize int `json:"issue_burst_size"`
 }
 
 type ReferralConfig struct {
-	Level1Percent float64 `json:"level1_percent"` // 7% for direct referrals
-	Level2Percent float64 `json:"level2_percent"` // 3% for second level
-	Level3Percent float64 `json:"level3_percent"` // 1% for third level
+	Level1Percent      float64 `json:"level1_percent"`       // 7% for direct referrals
+	Level2Percent      float64 `json:"level2_percent"`       // 3% for second level
+	Level3Percent      float64 `json:"level3_percent"`       // 1% for third level
+	AttributionFixDays int     `json:"attribution_fix_days"` // Days after registration admins may correct the referrer
+	// Caps limit the referral earnings of each referrer
+	Caps ReferralCaps `json:"caps"`
+}
+
+// Sources of attribution changes
+const (
+	AttributionByRegistration = "registration"
+	AttributionByAdmin        = "admin"
+)
+
+// AttributionChange is an entry of a user's referrer attribution history
+type AttributionChange struct {
+	ID        int64  `json:"id"`
+	UserID    int    `json:"user_id"`
+	OldRefID  *int   `json:"old_ref_id"`
+	NewRefID  *int   `json:"new_ref_id"`
+	Reason    string `json:"reason"`
+	ChangedBy string `json:"changed_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type ChangeReferrerRequest struct {
+	RefID  *int   `json:"ref_id"`
+	Reason string `json:"reason" binding:"required"`
 }
 
 // Configuration for investment types and their rules
 type Config struct {
-	InvestmentTypes map[string]InvestmentTypeConfig `json:"investment_types"`
-	ReferralConfig  ReferralConfig                  `json:"referral_config"`
-	AdminAPIKey     string                          `json:"admin_api_key"`
-	Telegram        TelegramConfig                  `json:"telegram"`
-	TON             TONConfig                       `json:"ton"`
-	RateLimit       RateLimitConfig                 `json:"rate_limit"`
+	InvestmentTypes    map[string]InvestmentTypeConfig `json:"investment_types"`
+	ReferralConfig     ReferralConfig                  `json:"referral_config"`
+	Accrual            AccrualConfig                   `json:"accrual"`
+	AdminAPIKey        string                          `json:"admin_api_key"`
+	Auth               AuthConfig                      `json:"auth"`
+	Telegram           TelegramConfig                  `json:"telegram"`
+	TON                TONConfig                       `json:"ton"`
+	RateLimit          RateLimitConfig                 `json:"rate_limit"`
+	Middleware         MiddlewareConfig                `json:"middleware"`
+	Deposit            DepositConfig                   `json:"deposit"`
+	DepositAddresses   DepositAddressesConfig          `json:"deposit_addresses"`
+	Liquidity          LiquidityConfig                 `json:"liquidity"`
+	WithdrawalApproval WithdrawalApprovalConfig        `json:"withdrawal_approval"`
+	WithdrawalBatching WithdrawalBatchingConfig        `json:"withdrawal_batching"`
+	WithdrawalLimits   WithdrawalLimitsConfig          `json:"withdrawal_limits"`
+	WithdrawalRetry    WithdrawalRetryConfig           `json:"withdrawal_retry"`
+	Gifts              GiftConfig                      `json:"gifts"`
+	Payments           PaymentsConfig                  `json:"payments"`
+	Indexer            IndexerConfig                   `json:"indexer"`
+	ChainWebhooks      ChainWebhooksConfig             `json:"chain_webhooks"`
+	AddressBook        AddressBookConfig               `json:"address_book"`
+	Dormancy           DormancyConfig                  `json:"dormancy"`
+	Alerts             AlertsConfig                    `json:"alerts"`
+	Readiness          ReadinessConfig                 `json:"readiness"`
+	Experiments        []ExperimentConfig              `json:"experiments"`
+	Terms              map[string]TermsDocument        `json:"terms"` // by investment type
+	RiskDisclaimer     RiskDisclaimerConfig            `json:"risk_disclaimer"`
+	Rates              RatesConfig                     `json:"rates"`
+	Logging            LoggingConfig                   `json:"logging"`
+	AccessLog          AccessLogConfig                 `json:"access_log"`
+	Integrity          IntegrityConfig                 `json:"integrity"`
+	ReadOnly           ReadOnlyConfig                  `json:"read_only"`
+	Idempotency        IdempotencyConfig               `json:"idempotency"`
+	VIP                VIPConfig                       `json:"vip"`
 }
 
 // Public Config
 type ConfigPublic struct {
-	InvestmentTypes map[string]InvestmentTypeConfig `json:"investment_types"`
-	ReferralConfig  ReferralConfig                  `json:"referral_config"`
+	InvestmentTypes  map[string]InvestmentTypeConfig `json:"investment_types"`
+	ReferralConfig   ReferralConfig                  `json:"referral_config"`
+	Pauses           []InvestmentPause               `json:"pauses"`
+	TermsVersions    map[string]string               `json:"terms_versions,omitempty"`
+	DepositLimits    DepositLimitsConfig             `json:"deposit_limits"`
+	WithdrawalLimits WithdrawalLimitsConfig          `json:"withdrawal_limits"`
 }
 
 // OperationType represents the type of operation
@@ -171,6 +391,7 @@ const (
 	OperationTypeInvestmentClosed  OperationType = "investment_closed"
 	OperationTypeDeposit           OperationType = "deposit"
 	OperationTypeWithdrawal        OperationType = "withdrawal"
+	OperationTypeInvestmentProfit  OperationType = "investment_profit"
 )
 
 // Operation represents a user operation in the system
@@ -183,12 +404,25 @@ type Operation struct {
 	CreatedAt   int64         `json:"created_at"`
 	Status      string        `json:"status,omitempty"`
 	Extra       interface{}   `json:"extra,omitempty"`
+	// Tags and Note are the user's annotation of the operation
+	Tags []string `json:"tags,omitempty"`
+	Note string   `json:"note,omitempty"`
+}
+
+// OperationFilter selects operations of a user, zero values match everything
+type OperationFilter struct {
+	Type      OperationType
+	Tag       string  // operations the user tagged with it
+	From      int64   // created_at >= From
+	To        int64   // created_at < To
+	MinAmount float64 // amount >= MinAmount
+	MaxAmount float64 // amount <= MaxAmount
 }
 
-// OperationHistory represents a list of operations with pagination info
+// OperationHistory represents a page of operations with the cursor of the next page
 type OperationHistory struct {
 	Operations []Operation `json:"operations"`
 	Total      int         `json:"total"`
-	Page       int         `json:"page"`
 	PageSize   int         `json:"page_size"`
+	NextCursor string      `json:"next_cursor,omitempty"` // empty on the last page
 }
@@ -0,0 +1,62 @@
+package model
+
+// Notification is a message for a user generated by the system
+type Notification struct {
+	ID        int64  `json:"id"`
+	UserID    int    `json:"user_id"`
+	Kind      string `json:"kind"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	CreatedAt int64  `json:"created_at"`
+	ReadAt    *int64 `json:"read_at,omitempty"`
+}
+
+// NotificationInbox is a page of a user's notifications, newest first.
+// Unread counts all unread notifications of the user, not just those of the page.
+type NotificationInbox struct {
+	Notifications []Notification `json:"notifications"`
+	Unread        int            `json:"unread"`
+	PageSize      int            `json:"page_size"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+// MarkNotificationsReadRequest marks the listed notifications as read, or all of them
+type MarkNotificationsReadRequest struct {
+	IDs []int64 `json:"ids"`
+	All bool    `json:"all"`
+}
+
+type MarkNotificationsReadResponse struct {
+	Marked int `json:"marked"`
+	Unread int `json:"unread"`
+}
+
+// NotificationKinds are the kinds of notifications, users can opt out of Telegram
+// delivery for each of them. The in-app inbox keeps every notification.
+var NotificationKinds = []string{
+	"deposit_credited",
+	"deposit_rejected",
+	"deposit_reminder",
+	"withdrawal_sent",
+	"withdrawal_failed",
+	"withdrawal_rejected",
+	"address_added",
+	"profit_accrued",
+	"referral_clawback",
+	"gift_claimed",
+	"vip_tier",
+	"investment_sunset",
+	"dormancy",
+}
+
+// NotificationPreferences are where a user's notifications are delivered besides the inbox
+type NotificationPreferences struct {
+	TelegramBound bool     `json:"telegram_bound"` // Whether the user messaged the bot, which binds their chat
+	Kinds         []string `json:"kinds"`          // Every kind of NotificationKinds
+	OptedOut      []string `json:"opted_out"`      // Kinds not sent to Telegram
+}
+
+// UpdateNotificationPreferencesRequest replaces the kinds a user opted out of
+type UpdateNotificationPreferencesRequest struct {
+	OptedOut []string `json:"opted_out"`
+}
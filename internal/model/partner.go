@@ -0,0 +1,38 @@
+package model
+
+const (
+	PartnerStatusPending  = "pending"
+	PartnerStatusApproved = "approved"
+	PartnerStatusRevoked  = "revoked"
+)
+
+// Partner is a bot or integration that applied for an API token with a larger
+// rate limit tier than anonymous traffic
+type Partner struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Contact     string `json:"contact"`
+	UseCase     string `json:"use_case"`
+	Status      string `json:"status"`
+	Tier        string `json:"tier,omitempty"`
+	TokenPrefix string `json:"token_prefix,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	ReviewedAt  *int64 `json:"reviewed_at"`
+	LastUsedAt  *int64 `json:"last_used_at"`
+}
+
+type PartnerApplicationRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Contact string `json:"contact" binding:"required"`
+	UseCase string `json:"use_case"`
+}
+
+type ApprovePartnerRequest struct {
+	Tier string `json:"tier" binding:"required"`
+}
+
+// ApprovePartnerResponse contains the plain partner token, which is only shown once
+type ApprovePartnerResponse struct {
+	Partner
+	Token string `json:"token"`
+}
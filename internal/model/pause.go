@@ -0,0 +1,19 @@
+package model
+
+// PauseScopeGlobal is the scope of switches applied to all investment types
+const PauseScopeGlobal = "global"
+
+// InvestmentPause holds incident switches for a product or for all of them
+type InvestmentPause struct {
+	Scope            string `json:"scope"` // "global" or investment type
+	PauseInvestments bool   `json:"pause_investments"`
+	PauseAccrual     bool   `json:"pause_accrual"`
+	Reason           string `json:"reason"`
+	UpdatedAt        int64  `json:"updated_at"`
+}
+
+type SetInvestmentPauseRequest struct {
+	PauseInvestments bool   `json:"pause_investments"`
+	PauseAccrual     bool   `json:"pause_accrual"`
+	Reason           string `json:"reason"`
+}
@@ -0,0 +1,42 @@
+package model
+
+const (
+	// Provider payment statuses
+	PaymentStatusPending   = "pending"
+	PaymentStatusCompleted = "completed"
+	// PaymentStatusReview is a payment the provider charged that couldn't be credited,
+	// an admin has to look into it
+	PaymentStatusReview = "review"
+)
+
+// PaymentsConfig enables alternative deposit rails
+type PaymentsConfig struct {
+	TelegramStars TelegramStarsConfig `json:"telegram_stars"`
+}
+
+// TelegramStarsConfig configures top-ups paid in Telegram Stars
+type TelegramStarsConfig struct {
+	Enabled       bool    `json:"enabled"`
+	WebhookSecret string  `json:"webhook_secret"` // secret_token set with setWebhook
+	TONPerStar    float64 `json:"ton_per_star"`
+}
+
+// Payment is a balance top-up collected by an external provider
+type Payment struct {
+	ID             int64   `json:"id"`
+	UserID         int     `json:"user_id"`
+	Provider       string  `json:"provider"`
+	Amount         float64 `json:"amount"`
+	ProviderAmount int64   `json:"provider_amount"`
+	Currency       string  `json:"currency"`
+	Status         string  `json:"status"`
+	ExternalID     string  `json:"external_id,omitempty"`
+	Error          string  `json:"error,omitempty"` // why a payment under review wasn't credited
+	CheckoutURL    string  `json:"checkout_url,omitempty"`
+	CreatedAt      int64   `json:"created_at"`
+	CompletedAt    *int64  `json:"completed_at,omitempty"`
+}
+
+type CreatePaymentRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"strings"
+
+	"tonapp/internal/money"
+)
+
+const (
+	// Number formats for amounts shown to the user
+	NumberFormatCommaDot   = "comma_dot"   // 1,234.56
+	NumberFormatSpaceComma = "space_comma" // 1 234,56
+	NumberFormatDotComma   = "dot_comma"   // 1.234,56
+)
+
+// SupportedFiatCurrencies lists currencies amounts can be converted to
+var SupportedFiatCurrencies = map[string]bool{
+	"usd": true, "eur": true, "gbp": true, "rub": true, "uah": true,
+	"kzt": true, "try": true, "inr": true, "cny": true, "aed": true,
+}
+
+// SupportedLanguages lists languages of statements and notifications
+var SupportedLanguages = map[string]bool{
+	"en": true, "ru": true,
+}
+
+var SupportedNumberFormats = map[string]bool{
+	NumberFormatCommaDot:   true,
+	NumberFormatSpaceComma: true,
+	NumberFormatDotComma:   true,
+}
+
+// UserPreferences are display preferences of a user
+type UserPreferences struct {
+	FiatCurrency string `json:"fiat_currency"`
+	NumberFormat string `json:"number_format"`
+	Language     string `json:"language"`
+}
+
+// DefaultPreferences are used for users who haven't set their preferences
+var DefaultPreferences = UserPreferences{
+	FiatCurrency: "usd",
+	NumberFormat: NumberFormatCommaDot,
+	Language:     "en",
+}
+
+// UpdateProfileRequest updates user profile fields; omitted fields are kept
+type UpdateProfileRequest struct {
+	Name         *string `json:"name"`
+	Photo        *string `json:"photo"`
+	FiatCurrency *string `json:"fiat_currency"`
+	NumberFormat *string `json:"number_format"`
+	Language     *string `json:"language"`
+}
+
+// numberSeparators are the thousands and decimal separators of each number format. The
+// space is a no-break space, so messages don't wrap inside an amount.
+var numberSeparators = map[string][2]string{
+	NumberFormatCommaDot:   {",", "."},
+	NumberFormatSpaceComma: {"\u00a0", ","},
+	NumberFormatDotComma:   {".", ","},
+}
+
+// separators returns the thousands and decimal separators of the user's number format
+func (p UserPreferences) separators() (string, string) {
+	sep, ok := numberSeparators[p.NumberFormat]
+	if !ok {
+		sep = numberSeparators[DefaultPreferences.NumberFormat]
+	}
+	return sep[0], sep[1]
+}
+
+// DecimalSeparator returns the decimal separator of the user's number format
+func (p UserPreferences) DecimalSeparator() string {
+	_, decimal := p.separators()
+	return decimal
+}
+
+// FormatAmount formats an amount like money.Format, with the separators of the user's
+// number format: 1234.5 is "1,234.50" in comma_dot and "1 234,50" in space_comma
+func (p UserPreferences) FormatAmount(v float64) string {
+	thousands, decimal := p.separators()
+	s := money.Format(v)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String() + decimal + fraction
+}
@@ -0,0 +1,78 @@
+package model
+
+const (
+	// Queued withdrawal statuses
+	QueueStatusQueued  = "queued"
+	QueueStatusSending = "sending"
+	QueueStatusSent    = "sent"
+	QueueStatusFailed  = "failed"
+	QueueStatusBatched = "batched" // waiting for the next batch transfer
+	// QueueStatusProcessing is a withdrawal the withdrawal worker sends right away
+	QueueStatusProcessing = "processing"
+)
+
+// LiquidityConfig controls queueing of withdrawals the hot wallet can't cover
+type LiquidityConfig struct {
+	QueueEnabled         bool    `json:"queue_enabled"`
+	MinHotWalletReserve  float64 `json:"min_hot_wallet_reserve"` // TON kept in the hot wallet for fees
+	CheckIntervalSeconds int     `json:"check_interval_seconds"`
+}
+
+// WithdrawalBatchingConfig controls grouping small withdrawals into one multi-message
+// transfer per wallet every interval, so they share the external message fee
+type WithdrawalBatchingConfig struct {
+	Enabled         bool    `json:"enabled"`
+	IntervalMinutes int     `json:"interval_minutes"` // batches are sent at multiples of the interval since midnight UTC
+	MaxAmount       float64 `json:"max_amount"`       // withdrawals up to this amount are batched
+	MaxMessages     int     `json:"max_messages"`     // per transfer, capped by what the wallet version can send
+}
+
+// WithdrawalRetryConfig controls retrying withdrawals whose transfer failed. The delay
+// between attempts doubles from backoff_seconds up to max_backoff_seconds; after
+// max_attempts the withdrawal fails and is refunded.
+type WithdrawalRetryConfig struct {
+	MaxAttempts       int `json:"max_attempts"`
+	BackoffSeconds    int `json:"backoff_seconds"`
+	MaxBackoffSeconds int `json:"max_backoff_seconds"`
+	// StuckAfterMinutes is how long a transfer may be sending before admins see it as stuck
+	StuckAfterMinutes int `json:"stuck_after_minutes"`
+}
+
+// WithdrawalTransfers lists the open withdrawals whose transfer failed or hangs
+type WithdrawalTransfers struct {
+	Retrying []QueuedWithdrawal `json:"retrying"` // failed attempts, waiting for the next one
+	Stuck    []QueuedWithdrawal `json:"stuck"`    // sending for longer than stuck_after_minutes
+}
+
+// WithdrawalBatchInfo tells users when batched withdrawals are sent
+type WithdrawalBatchInfo struct {
+	Enabled         bool    `json:"enabled"`
+	MaxAmount       float64 `json:"max_amount,omitempty"`
+	IntervalMinutes int     `json:"interval_minutes,omitempty"`
+	NextBatchAt     int64   `json:"next_batch_at,omitempty"`
+	Pending         int     `json:"pending"` // withdrawals waiting for the next batch
+}
+
+// QueuedWithdrawal is a withdrawal waiting for hot wallet liquidity.
+// Funds are reserved from the user balance when queued.
+type QueuedWithdrawal struct {
+	ID          int64   `json:"id"`
+	UserID      int     `json:"user_id"`
+	PubKey      string  `json:"-"`
+	Amount      float64 `json:"amount"`
+	Status      string  `json:"status"`
+	Position    int     `json:"position,omitempty"`
+	TxHash      string  `json:"tx_hash,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	CreatedAt   int64   `json:"created_at"`
+	ProcessedAt *int64  `json:"processed_at,omitempty"`
+	ScheduledAt int64   `json:"scheduled_at,omitempty"` // when a batched withdrawal is sent
+	// TreasuryWallet is the wallet the withdrawal was sent from, empty for the main wallet
+	TreasuryWallet string `json:"treasury_wallet,omitempty"`
+	// Destination is the address book address the withdrawal goes to, empty for the user's wallet
+	Destination string `json:"destination,omitempty"`
+	// Attempts counts the transfers tried, a failed one is retried at NextAttemptAt
+	Attempts      int   `json:"attempts,omitempty"`
+	LastAttemptAt int64 `json:"last_attempt_at,omitempty"`
+	NextAttemptAt int64 `json:"next_attempt_at,omitempty"`
+}
@@ -0,0 +1,33 @@
+package model
+
+// RatesConfig configures the TON price providers used to convert amounts to fiat.
+// Providers are asked in order until one returns a price, an empty list means
+// coingecko, coinmarketcap when it has an API key, then tonapi.
+type RatesConfig struct {
+	Providers              []string `json:"providers"` // coingecko, coinmarketcap, tonapi
+	CoinGeckoAPIKey        string   `json:"coingecko_api_key"`
+	CoinMarketCapAPIKey    string   `json:"coinmarketcap_api_key"`
+	TonAPIKey              string   `json:"tonapi_key"`
+	TTLSeconds             int      `json:"ttl_seconds"`              // how long a price is served before it is fetched again, 0 means 300
+	RefreshIntervalSeconds int      `json:"refresh_interval_seconds"` // background refresh, 0 means 240
+	MaxStaleSeconds        int      `json:"max_stale_seconds"`        // how old a price may be served when every provider fails, 0 means 3600
+	RequestTimeoutMs       int      `json:"request_timeout_ms"`       // 0 means 5000
+}
+
+// TONRate is the TON price in a fiat currency
+type TONRate struct {
+	Currency  string  `json:"currency"`
+	Price     float64 `json:"price"`
+	Provider  string  `json:"provider"`
+	FetchedAt int64   `json:"fetched_at"`
+	// Stale is set when the price is older than the TTL because no provider answered
+	Stale bool `json:"stale"`
+}
+
+// TONRates is the response of the rates endpoint
+type TONRates struct {
+	Base       string            `json:"base"`
+	Rates      []TONRate         `json:"rates"`
+	Errors     map[string]string `json:"errors,omitempty"` // currencies without a price
+	TTLSeconds int               `json:"ttl_seconds"`
+}
@@ -0,0 +1,37 @@
+package model
+
+const (
+	// Readiness statuses reported by /readyz
+	ReadinessStatusWarmingUp = "warming_up"
+	ReadinessStatusReady     = "ready"
+)
+
+// ReadinessConfig tunes the start-up warm-up that gates /readyz
+type ReadinessConfig struct {
+	// RetryIntervalSeconds is the pause between warm-up rounds while a check fails (default: 5)
+	RetryIntervalSeconds int `json:"retry_interval_seconds"`
+	// StepTimeoutSeconds bounds every warm-up check (default: 30)
+	StepTimeoutSeconds int `json:"step_timeout_seconds"`
+}
+
+// ReadinessCheck is the outcome of a warm-up step. The service turns ready once every
+// required check passed, optional ones only fill caches.
+type ReadinessCheck struct {
+	Name       string `json:"name"`
+	Required   bool   `json:"required"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	Attempts   int    `json:"attempts"`
+	DurationMs int64  `json:"duration_ms"` // of the last attempt
+	CheckedAt  int64  `json:"checked_at"`
+}
+
+// ReadinessStatus is the body of /readyz
+type ReadinessStatus struct {
+	Status    string           `json:"status"`
+	StartedAt int64            `json:"started_at,omitempty"`
+	ReadyAt   *int64           `json:"ready_at,omitempty"`
+	Checks    []ReadinessCheck `json:"checks"`
+	// ReadOnly is set while mutations are rejected, the service still serves reads
+	ReadOnly bool `json:"read_only,omitempty"`
+}
@@ -0,0 +1,25 @@
+package model
+
+// ReadOnlyConfig tunes the read-only mode the API switches to when database writes fail
+type ReadOnlyConfig struct {
+	// ProbeIntervalSeconds is how often a test write checks the database (default: 30)
+	ProbeIntervalSeconds int `json:"probe_interval_seconds"`
+}
+
+// ReadOnlyStatus is the state of the read-only mode
+type ReadOnlyStatus struct {
+	Enabled bool `json:"enabled"`
+	// Manual is set when an admin switched the mode on, it then stays on until an
+	// admin switches it off. Otherwise it ends with the first successful test write.
+	Manual         bool   `json:"manual"`
+	Reason         string `json:"reason,omitempty"`
+	Since          *int64 `json:"since,omitempty"`
+	LastProbeAt    int64  `json:"last_probe_at,omitempty"`
+	LastProbeError string `json:"last_probe_error,omitempty"`
+}
+
+// SetReadOnlyRequest switches the read-only mode on or off
+type SetReadOnlyRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Reason  string `json:"reason"`
+}
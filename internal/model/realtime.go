@@ -0,0 +1,23 @@
+package model
+
+// BalanceEvent is the balance of a user pushed after an operation changed it
+type BalanceEvent struct {
+	Balance            float64 `json:"balance"`
+	CurrentInvestments float64 `json:"current_investments"`
+	TotalEarnings      float64 `json:"total_earnings"`
+}
+
+// WithdrawalEvent is a status transition of a withdrawal pushed as it happens
+type WithdrawalEvent struct {
+	ID     int64   `json:"id,omitempty"`
+	Source string  `json:"source"` // queue (withdrawal worker, liquidity queue and batches) or approval
+	Status string  `json:"status"`
+	Amount float64 `json:"amount"`
+	TxHash string  `json:"tx_hash,omitempty"`
+}
+
+// WebSocketAuth is the first message of a connection without an Authorization header
+type WebSocketAuth struct {
+	Type  string `json:"type"` // auth
+	Token string `json:"token"`
+}
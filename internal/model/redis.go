@@ -0,0 +1,9 @@
+package model
+
+// RedisConfig is the connection to a Redis server
+type RedisConfig struct {
+	Address   string `json:"address"` // host:port
+	Password  string `json:"password"`
+	DB        int    `json:"db"`
+	TimeoutMs int    `json:"timeout_ms"` // per command, default: 100
+}
@@ -0,0 +1,43 @@
+package model
+
+// ReferralCaps limit the referral earnings of a referrer in TON: Daily per UTC day and
+// Total over all time, both net of clawbacks. 0 is no limit.
+type ReferralCaps struct {
+	Daily float64 `json:"daily"`
+	Total float64 `json:"total"`
+}
+
+// Remaining returns how much more a referrer who earned earnedToday today and earned
+// in total can be paid, ok is false when no cap applies
+func (c ReferralCaps) Remaining(earnedToday, earned float64) (remaining float64, ok bool) {
+	if c.Daily > 0 {
+		remaining, ok = c.Daily-earnedToday, true
+	}
+	if c.Total > 0 && (!ok || c.Total-earned < remaining) {
+		remaining, ok = c.Total-earned, true
+	}
+	if ok && remaining < 0 {
+		remaining = 0
+	}
+	return remaining, ok
+}
+
+// ReferralClawbackRequest reverses the referral earnings paid on a referred user's
+// profit, e.g. after their deposit was reversed or found to be fraud
+type ReferralClawbackRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	// DepositID limits the clawback to earnings recorded since the deposit was created
+	DepositID int `json:"deposit_id"`
+}
+
+// ReferralClawback is the result of a clawback. Entries are the negative referral
+// earnings recorded, each linked to the earning it reverses. What referrers no longer
+// had on their balance couldn't be recovered.
+type ReferralClawback struct {
+	ReferredID  int               `json:"referred_id"`
+	Reason      string            `json:"reason"`
+	Since       int64             `json:"since"`
+	Entries     []ReferralEarning `json:"entries"`
+	Recovered   float64           `json:"recovered"`
+	Unrecovered float64           `json:"unrecovered"`
+}
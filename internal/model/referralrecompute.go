@@ -0,0 +1,58 @@
+package model
+
+// ReferralRecomputeRequest asks to recompute the referral earnings of the profit accrued
+// in [From, To)
+type ReferralRecomputeRequest struct {
+	From int64 `json:"from" binding:"required"`
+	To   int64 `json:"to" binding:"required"`
+	// ReferralConfig holds the percents to recompute with, the current config if omitted
+	ReferralConfig *ReferralConfig `json:"referral_config,omitempty"`
+	// Apply pays the underpaid earnings as compensations, otherwise only the report is returned
+	Apply bool `json:"apply"`
+}
+
+// ReferralEarningDiff compares what a referrer earned on a referred user's profit with
+// what they should have earned
+type ReferralEarningDiff struct {
+	ReferrerID  int     `json:"referrer_id"`
+	ReferredID  int     `json:"referred_id"`
+	Level       int     `json:"level"`
+	Accruals    int     `json:"accruals"` // accruals of the referred user in the period
+	Expected    float64 `json:"expected"`
+	Actual      float64 `json:"actual"`
+	Difference  float64 `json:"difference"` // expected - actual, positive when underpaid
+	Compensated float64 `json:"compensated"`
+	Note        string  `json:"note,omitempty"`
+}
+
+// ReferralRecomputationRun is an applied recomputation
+type ReferralRecomputationRun struct {
+	ID             int64          `json:"id"`
+	From           int64          `json:"from"`
+	To             int64          `json:"to"`
+	ReferralConfig ReferralConfig `json:"referral_config"`
+	Compensated    float64        `json:"compensated"`
+	CreatedAt      int64          `json:"created_at"`
+}
+
+// ReferralRecomputation is the diff report of a recomputation
+type ReferralRecomputation struct {
+	ID             int64          `json:"id,omitempty"` // run ID once applied
+	From           int64          `json:"from"`
+	To             int64          `json:"to"`
+	ReferralConfig ReferralConfig `json:"referral_config"`
+	Accruals       int            `json:"accruals"`
+	Expected       float64        `json:"expected"`
+	Actual         float64        `json:"actual"`
+	Underpaid      float64        `json:"underpaid"`
+	Overpaid       float64        `json:"overpaid"`
+	Compensated    float64        `json:"compensated"`
+	Applied        bool           `json:"applied"`
+	// IncludedRuns are earlier runs within the period, their compensations count as actual
+	IncludedRuns []int64 `json:"included_runs"`
+	// ConflictingRuns are earlier runs partly overlapping the period, which the report
+	// can't account for; the period can't be applied while there are any
+	ConflictingRuns []ReferralRecomputationRun `json:"conflicting_runs"`
+	Diffs           []ReferralEarningDiff      `json:"diffs"` // only pairs with a difference
+	CreatedAt       int64                      `json:"created_at"`
+}
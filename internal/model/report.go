@@ -0,0 +1,30 @@
+package model
+
+// ProfitFairnessRow compares configured and distributed profit for
+// a product and weekly cohort of investments
+type ProfitFairnessRow struct {
+	Type                string  `json:"type"`
+	Cohort              string  `json:"cohort"` // ISO week of investment creation, e.g. 2024-W15
+	Investments         int     `json:"investments"`
+	Principal           float64 `json:"principal"`
+	WeeklyPercent       float64 `json:"weekly_percent"`
+	ExpectedProfit      float64 `json:"expected_profit"`
+	DistributedProfit   float64 `json:"distributed_profit"`
+	Drift               float64 `json:"drift"`
+	DriftPercent        float64 `json:"drift_percent"`
+	MissedAccrualsWeeks int     `json:"missed_accrual_weeks"`
+}
+
+// ProfitFairnessReport is the admin report of configured APY vs distributed profit
+type ProfitFairnessReport struct {
+	GeneratedAt int64               `json:"generated_at"`
+	Rows        []ProfitFairnessRow `json:"rows"`
+	Totals      ProfitFairnessRow   `json:"totals"`
+}
+
+// InvestmentProfitStat holds an open investment with the gross profit already distributed for it
+type InvestmentProfitStat struct {
+	Investment
+	DistributedProfit float64 `json:"distributed_profit"`
+	Accruals          int     `json:"accruals"`
+}
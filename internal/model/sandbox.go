@@ -0,0 +1,16 @@
+package model
+
+// SandboxWallet is a demo account seeded by the sandbox, with a session to call its
+// account routes
+type SandboxWallet struct {
+	Name    string       `json:"name"`
+	UserID  int          `json:"user_id"`
+	PubKey  string       `json:"pub_key"`
+	Address string       `json:"address"`
+	Session *AuthSession `json:"session"`
+}
+
+// SandboxSessionRequest asks the sandbox for a session of any wallet, skipping TON Connect
+type SandboxSessionRequest struct {
+	PubKey string `json:"pub_key" binding:"required"` // hex ed25519 public key
+}
@@ -0,0 +1,73 @@
+package model
+
+// SimulationRequest describes config changes to replay against past accruals.
+// Omitted values keep the current configuration.
+type SimulationRequest struct {
+	Weeks              int                `json:"weeks"`
+	WeeklyPercents     map[string]float64 `json:"weekly_percents"` // by investment type
+	ReferralConfig     *ReferralConfig    `json:"referral_config"`
+	PlatformFeePercent *float64           `json:"platform_fee_percent"`
+}
+
+// ProfitAccrual is a past investment_profit operation
+type ProfitAccrual struct {
+	UserID        int
+	Type          string
+	GrossProfit   float64
+	Fee           float64
+	NetProfit     float64
+	WeeklyPercent float64
+	CreatedAt     int64
+}
+
+// ReferralEarningEntry is a past referral payout
+type ReferralEarningEntry struct {
+	Level     int
+	Amount    float64
+	CreatedAt int64
+}
+
+// SimulationTypeRow compares actual and simulated profit of an investment type
+type SimulationTypeRow struct {
+	Type                   string  `json:"type"`
+	Accruals               int     `json:"accruals"`
+	ActualWeeklyPercent    float64 `json:"actual_weekly_percent"`
+	SimulatedWeeklyPercent float64 `json:"simulated_weekly_percent"`
+	ActualGross            float64 `json:"actual_gross"`
+	SimulatedGross         float64 `json:"simulated_gross"`
+	ActualFee              float64 `json:"actual_fee"`
+	SimulatedFee           float64 `json:"simulated_fee"`
+	ActualNet              float64 `json:"actual_net"`
+	SimulatedNet           float64 `json:"simulated_net"`
+}
+
+// SimulationReferralRow compares actual and simulated referral payouts of a level
+type SimulationReferralRow struct {
+	Level            int     `json:"level"`
+	ActualPercent    float64 `json:"actual_percent"`
+	SimulatedPercent float64 `json:"simulated_percent"`
+	Actual           float64 `json:"actual"`
+	Simulated        float64 `json:"simulated"`
+}
+
+// SimulationWeek holds total payouts (profit + referral) of one week
+type SimulationWeek struct {
+	WeekStart       int64   `json:"week_start"`
+	ActualPayouts   float64 `json:"actual_payouts"`
+	SimulatedPayout float64 `json:"simulated_payouts"`
+}
+
+// SimulationReport is the financial impact of a config change over past weeks
+type SimulationReport struct {
+	From                int64                   `json:"from"`
+	To                  int64                   `json:"to"`
+	Weeks               int                     `json:"weeks"`
+	Types               []SimulationTypeRow     `json:"types"`
+	Referrals           []SimulationReferralRow `json:"referrals"`
+	WeeklyTotals        []SimulationWeek        `json:"weekly_totals"`
+	ActualPayouts       float64                 `json:"actual_payouts"`
+	SimulatedPayouts    float64                 `json:"simulated_payouts"`
+	PayoutDelta         float64                 `json:"payout_delta"`
+	ActualFeeRevenue    float64                 `json:"actual_fee_revenue"`
+	SimulatedFeeRevenue float64                 `json:"simulated_fee_revenue"`
+}
@@ -0,0 +1,12 @@
+package model
+
+// BalanceSnapshot represents a user's balance state at the end of a day, taken at the
+// following midnight UTC
+type BalanceSnapshot struct {
+	UserID        int     `json:"user_id"`
+	Date          string  `json:"date"` // YYYY-MM-DD, UTC
+	Balance       float64 `json:"balance"`
+	Invested      float64 `json:"invested"`
+	TotalEarnings float64 `json:"total_earnings"`
+	CreatedAt     int64   `json:"created_at"`
+}
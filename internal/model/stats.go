@@ -0,0 +1,27 @@
+package model
+
+// AdminStats is returned by the admin stats endpoint
+type AdminStats struct {
+	Database *QueryStats         `json:"database"` // nil unless query logging is enabled
+	Deposits *DepositIntentStats `json:"deposits"`
+	Reserves []CurrencyReserves  `json:"reserves,omitempty"` // with ?reserves=true
+}
+
+// QueryStats aggregates SQL query timings per call site
+type QueryStats struct {
+	SlowThresholdMs int64           `json:"slow_threshold_ms"`
+	Since           int64           `json:"since"`
+	Sites           []QuerySiteStat `json:"sites"`
+}
+
+// QuerySiteStat holds timings of the queries issued from one place in the code
+type QuerySiteStat struct {
+	Site    string  `json:"site"` // file:line of the database method issuing the query
+	Query   string  `json:"query"`
+	Count   int64   `json:"count"`
+	Errors  int64   `json:"errors"`
+	Slow    int64   `json:"slow"`
+	TotalMs float64 `json:"total_ms"`
+	AvgMs   float64 `json:"avg_ms"`
+	MaxMs   float64 `json:"max_ms"`
+}
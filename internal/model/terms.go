@@ -0,0 +1,20 @@
+package model
+
+// TermsDocument is the versioned terms of an investment type. The document is
+// either a local markdown/PDF file (Path) or an external link (URL).
+type TermsDocument struct {
+	Version string `json:"version"`
+	Path    string `json:"path,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// TermsAcceptance records that a user acknowledged a terms version
+type TermsAcceptance struct {
+	Type       string `json:"type"`
+	Version    string `json:"version"`
+	AcceptedAt int64  `json:"accepted_at"`
+}
+
+type AcceptTermsRequest struct {
+	Version string `json:"version" binding:"required"`
+}
@@ -0,0 +1,43 @@
+package model
+
+// SignatureChallenge is a server-issued message the wallet owner must sign
+// with their private key to prove ownership of pub_key
+type SignatureChallenge struct {
+	Nonce     string `json:"nonce"`
+	UserID    int    `json:"-"`
+	Purpose   string `json:"purpose"`
+	Message   string `json:"message"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type ChallengeRequest struct {
+	Purpose string `json:"purpose" binding:"required"`
+	// The withdrawal a "withdrawal" challenge confirms, the message includes both
+	Amount        float64 `json:"amount"`
+	AddressBookID int64   `json:"address_book_id"`
+	Destination   string  `json:"destination"`
+}
+
+// APIToken is a personal read-only API token of a user
+type APIToken struct {
+	ID         int64  `json:"id"`
+	UserID     int    `json:"user_id"`
+	Name       string `json:"name"`
+	Scope      string `json:"scope"`
+	Prefix     string `json:"prefix"`
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt *int64 `json:"last_used_at"`
+	RevokedAt  *int64 `json:"revoked_at,omitempty"`
+}
+
+type CreateAPITokenRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Nonce     string `json:"nonce" binding:"required"`
+	Signature string `json:"signature" binding:"required"` // hex ed25519 signature of the challenge message
+}
+
+// CreateAPITokenResponse contains the plain token, which is only shown once
+type CreateAPITokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
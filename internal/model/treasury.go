@@ -0,0 +1,81 @@
+package model
+
+// TreasuryForecast projects obligations against expected inflows over a horizon
+type TreasuryForecast struct {
+	HorizonDays        int     `json:"horizon_days"`
+	AccrualsDue        float64 `json:"accruals_due"`
+	ReferralPayouts    float64 `json:"referral_payouts"`
+	UnlockingPrincipal float64 `json:"unlocking_principal"`
+	UnlockingCount     int     `json:"unlocking_count"`
+	QueuedWithdrawals  float64 `json:"queued_withdrawals"`
+	TotalObligations   float64 `json:"total_obligations"`
+	ExpectedInflows    float64 `json:"expected_inflows"`
+	PendingDeposits    float64 `json:"pending_deposits"`
+	HotWalletBalance   float64 `json:"hot_wallet_balance"`
+	ProjectedBalance   float64 `json:"projected_balance"`
+	FundingGap         float64 `json:"funding_gap"`
+}
+
+// TreasuryForecastReport contains forecasts for several horizons
+type TreasuryForecastReport struct {
+	GeneratedAt           int64              `json:"generated_at"`
+	AverageDailyInflow    float64            `json:"average_daily_inflow"`
+	HotWalletBalanceKnown bool               `json:"hot_wallet_balance_known"`
+	Forecasts             []TreasuryForecast `json:"forecasts"`
+}
+
+// TreasuryWalletMain names the main wallet in treasury wallet reports
+const TreasuryWalletMain = "main"
+
+// TreasuryWalletFlow is the TON the ledger recorded entering and leaving a treasury wallet
+type TreasuryWalletFlow struct {
+	Wallet    string  `json:"wallet"` // empty for the main wallet
+	Deposited float64 `json:"deposited"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+// TreasuryWalletReconciliation compares the ledger flows of a treasury wallet with its on-chain balance
+type TreasuryWalletReconciliation struct {
+	Wallet          string   `json:"wallet"`
+	Address         string   `json:"address"`
+	InvestmentTypes []string `json:"investment_types"`
+	Deposited       float64  `json:"deposited"`
+	Withdrawn       float64  `json:"withdrawn"`
+	Net             float64  `json:"net"`                        // deposited minus withdrawn
+	OnChainBalance  *float64 `json:"on_chain_balance,omitempty"` // unset if the balance couldn't be fetched
+	Difference      *float64 `json:"difference,omitempty"`       // on-chain balance minus net
+	Error           string   `json:"error,omitempty"`
+
+	// Jettons are the on-chain balances of the configured jettons
+	Jettons []JettonBalance `json:"jettons,omitempty"`
+}
+
+// JettonConfig is a jetton the treasury wallets hold
+type JettonConfig struct {
+	Master   string `json:"master"`   // jetton master contract address
+	Decimals int    `json:"decimals"` // default: 9
+}
+
+// JettonBalance is the on-chain balance of a jetton in a treasury wallet
+type JettonBalance struct {
+	Symbol  string   `json:"symbol"`
+	Balance *float64 `json:"balance,omitempty"` // unset if the balance couldn't be fetched
+	Error   string   `json:"error,omitempty"`
+}
+
+// CurrencyReserves compares what the treasury wallets hold of a currency with what the
+// platform owes in it
+type CurrencyReserves struct {
+	Currency    string   `json:"currency"` // TON or a jetton symbol
+	Reserves    float64  `json:"reserves"` // sum over the wallets whose balance could be fetched
+	Liabilities float64  `json:"liabilities"`
+	Surplus     float64  `json:"surplus"`            // reserves minus liabilities
+	Coverage    *float64 `json:"coverage,omitempty"` // reserves per unit of liabilities, unset without liabilities
+	Complete    bool     `json:"complete"`           // false if a wallet balance couldn't be fetched
+}
+
+// TreasuryReserves compares reserves and liabilities per currency
+type TreasuryReserves struct {
+	GeneratedAt int64              `json:"generated_at"`
+	Currencies  []CurrencyReserves `json:"currencies"`
+}
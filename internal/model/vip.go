@@ -0,0 +1,38 @@
+package model
+
+// VIPConfig ranks users into tiers by the amount they have invested
+type VIPConfig struct {
+	Enabled                    bool      `json:"enabled"`
+	RecalculateIntervalSeconds int       `json:"recalculate_interval_seconds"` // default: 3600
+	Tiers                      []VIPTier `json:"tiers"`                        // ascending by min_invested
+}
+
+// VIPTier is a tier and what it grants
+type VIPTier struct {
+	Name        string  `json:"name"`
+	MinInvested float64 `json:"min_invested"` // TON in open investments
+	// FeeDiscountPercent is the share of the platform fee on profit waived, 25 lowers
+	// the 20% fee to 15%
+	FeeDiscountPercent float64 `json:"fee_discount_percent"`
+	// WeeklyPercentBonus is added to the weekly percent of every investment of the user
+	WeeklyPercentBonus float64 `json:"weekly_percent_bonus"`
+}
+
+// UserTier is the tier a user was last ranked in
+type UserTier struct {
+	UserID    int
+	Tier      string
+	Invested  float64 // open investments when the tier was computed
+	UpdatedAt int64
+}
+
+// UserVIPTier is a user's tier as shown to them
+type UserVIPTier struct {
+	Tier               string  `json:"tier,omitempty"` // empty below the first tier
+	Invested           float64 `json:"invested"`
+	FeeDiscountPercent float64 `json:"fee_discount_percent"`
+	WeeklyPercentBonus float64 `json:"weekly_percent_bonus"`
+	NextTier           string  `json:"next_tier,omitempty"`
+	NextTierInvested   float64 `json:"next_tier_invested,omitempty"` // min_invested of the next tier
+	UpdatedAt          int64   `json:"updated_at,omitempty"`
+}
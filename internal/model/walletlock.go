@@ -0,0 +1,14 @@
+package model
+
+// UnlockWalletsRequest carries the passphrase of the encrypted wallet mnemonics
+type UnlockWalletsRequest struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// WalletUnlock describes the wallets opened by an unlock
+type WalletUnlock struct {
+	Unlocked        bool     `json:"unlocked"`
+	UnlockedAt      int64    `json:"unlocked_at"`
+	DepositAddress  string   `json:"deposit_address"`
+	TreasuryWallets []string `json:"treasury_wallets"`
+}
@@ -4,17 +4,12 @@ import "time"
 
 // WithdrawalRequest represents the request body for withdrawing TON
 type WithdrawalRequest struct {
-	PubKey string  `json:"pub_key" binding:"required"`
-	Amount float64 `json:"amount" binding:"required,gt=0"`
-}
-
-// WithdrawalResponse represents the response for a withdrawal request
-type WithdrawalResponse struct {
-	Success   bool    `json:"success"`
-	Error     string  `json:"error,omitempty"`
-	Amount    float64 `json:"amount,omitempty"`
-	Address   string  `json:"address,omitempty"`
-	TxHash    string  `json:"tx_hash,omitempty"`
+	PubKey        string  `json:"pub_key" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	AddressBookID int64   `json:"address_book_id"` // saved address to send to, the user's wallet if 0
+	Destination   string  `json:"destination"`     // or the address itself, which must be saved too
+	Nonce         string  `json:"nonce" binding:"required"`
+	Signature     string  `json:"signature" binding:"required"` // hex ed25519 signature of the withdrawal challenge message
 }
 
 type WithdrawalStorage struct {
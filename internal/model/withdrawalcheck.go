@@ -0,0 +1,26 @@
+package model
+
+// WithdrawalCheckRequest asks what would happen if a user withdrew an amount
+type WithdrawalCheckRequest struct {
+	Amount        float64 `json:"amount" binding:"required,gt=0"`
+	AddressBookID int64   `json:"address_book_id"` // saved address to send to, the user's wallet if 0
+	Destination   string  `json:"destination"`     // or the address itself, which must be saved too
+}
+
+// WithdrawalCheck is the outcome of one step of the withdrawal validation
+type WithdrawalCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// WithdrawalCheckResult lists every check a withdrawal goes through and what the
+// withdrawal would do: "sent", "pending_approval", "batched", "queued" or "rejected"
+type WithdrawalCheckResult struct {
+	UserID  int               `json:"user_id"`
+	Amount  float64           `json:"amount"`
+	Allowed bool              `json:"allowed"`
+	Outcome string            `json:"outcome"`
+	Wallet  string            `json:"wallet"` // treasury wallet it would be sent from
+	Checks  []WithdrawalCheck `json:"checks"`
+}
@@ -0,0 +1,65 @@
+package model
+
+import "errors"
+
+// WithdrawalLimitsConfig bounds the withdrawals of users, 0 meaning no limit. An admin
+// can override them for a user.
+type WithdrawalLimitsConfig struct {
+	MinAmount   float64 `json:"min_amount"`   // per withdrawal
+	MaxAmount   float64 `json:"max_amount"`   // per withdrawal
+	DailyAmount float64 `json:"daily_amount"` // per user and UTC day, all withdrawals together
+	// CooldownHours is how long a user waits after a withdrawal before the next one
+	CooldownHours int `json:"cooldown_hours"`
+}
+
+// WithdrawalLimitOverride replaces withdrawal_limits for one user. Nil fields keep the
+// limit of the config, 0 lifts it.
+type WithdrawalLimitOverride struct {
+	UserID      int      `json:"user_id"`
+	MinAmount   *float64 `json:"min_amount"`
+	MaxAmount   *float64 `json:"max_amount"`
+	DailyAmount *float64 `json:"daily_amount"`
+	Note        string   `json:"note,omitempty"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+// SetWithdrawalLimitsRequest overrides the withdrawal limits of a user
+type SetWithdrawalLimitsRequest struct {
+	MinAmount   *float64 `json:"min_amount"`
+	MaxAmount   *float64 `json:"max_amount"`
+	DailyAmount *float64 `json:"daily_amount"`
+	Note        string   `json:"note"` // e.g. why the user needs higher limits
+}
+
+// UserWithdrawalLimits is the bounds applied to the withdrawals of a user, with what
+// is left of the daily limit
+type UserWithdrawalLimits struct {
+	MinAmount      float64 `json:"min_amount"`
+	MaxAmount      float64 `json:"max_amount,omitempty"`   // omitted without a maximum
+	DailyAmount    float64 `json:"daily_amount,omitempty"` // omitted without a daily limit
+	WithdrawnToday float64 `json:"withdrawn_today"`
+	// RemainingToday is nil without a daily limit
+	RemainingToday *float64 `json:"remaining_today,omitempty"`
+	ResetsAt       int64    `json:"resets_at"` // next midnight UTC
+	CooldownHours  int      `json:"cooldown_hours,omitempty"`
+	// NextWithdrawalAt is when the cooldown of the last withdrawal ends, omitted outside it
+	NextWithdrawalAt int64 `json:"next_withdrawal_at,omitempty"`
+	Overridden       bool  `json:"overridden"`
+}
+
+// WithdrawalCaps are the daily limit and cooldown a store checks in the transaction that
+// reserves a withdrawal, so concurrent withdrawals can't pass them together. Zero fields
+// don't limit.
+type WithdrawalCaps struct {
+	// DailyAmount bounds the withdrawals since DayStart, the new one included
+	DailyAmount float64
+	DayStart    int64
+	// CooldownSince rejects the withdrawal when another one was requested after it
+	CooldownSince int64
+}
+
+// Errors of withdrawals rejected by their WithdrawalCaps
+var (
+	ErrDailyWithdrawalLimitReached = errors.New("daily withdrawal limit reached")
+	ErrWithdrawalCooldownActive    = errors.New("withdrawal cooldown active")
+)
@@ -0,0 +1,71 @@
+// Package money is the rounding and formatting policy of TON amounts.
+//
+// Amounts are float64 TON with nanoton precision (9 decimals). Every computed amount
+// is rounded to a whole nanoton before it is stored or sent: fees with banker's
+// rounding, so halves don't always go to the platform, and payouts down, so the
+// platform never pays out more than it computed. Amounts shown to people keep all
+// their decimals instead of being cut to cents.
+package money
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Decimals is the precision of TON amounts
+const Decimals = 9
+
+const nanoPerTON = 1e9
+
+// epsilon absorbs the float error of v*1e9, e.g. 0.3*1e9 = 299999999.99999994,
+// so a floor doesn't lose a whole nanoton
+const epsilon = 1e-6
+
+// Round rounds an amount to the nearest nanoton, halves away from zero
+func Round(v float64) float64 {
+	return fromNanoFloat(math.Round(v * nanoPerTON))
+}
+
+// RoundFee rounds a fee to the nearest nanoton, halves to even
+func RoundFee(v float64) float64 {
+	return fromNanoFloat(math.RoundToEven(v * nanoPerTON))
+}
+
+// FloorPayout rounds an amount paid out to a user down to a whole nanoton
+func FloorPayout(v float64) float64 {
+	return fromNanoFloat(math.Floor(v*nanoPerTON + epsilon))
+}
+
+// ToNano converts an amount to nanotons, rounding to the nearest one
+func ToNano(v float64) int64 {
+	return int64(math.Round(v * nanoPerTON))
+}
+
+// FromNano converts nanotons to an amount
+func FromNano(nano int64) float64 {
+	return float64(nano) / nanoPerTON
+}
+
+func fromNanoFloat(nano float64) float64 {
+	if nano == 0 {
+		return 0 // not -0
+	}
+	return nano / nanoPerTON
+}
+
+// Format formats an amount for messages and descriptions: rounded to a nanoton with
+// trailing zeros trimmed to at least 2 decimals, so 1.5 is "1.50" and 0.001 is "0.001"
+func Format(v float64) string {
+	s := FormatFixed(v)
+	trimmed := strings.TrimRight(s, "0")
+	if dot := strings.IndexByte(trimmed, '.'); len(trimmed)-dot-1 < 2 {
+		return s[:dot+3]
+	}
+	return trimmed
+}
+
+// FormatFixed formats an amount with all 9 decimals, for exports and reports
+func FormatFixed(v float64) string {
+	return strconv.FormatFloat(Round(v), 'f', Decimals, 64)
+}
@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Message is an operator notification
+type Message struct {
+	Title string
+	Body  string
+	// Fields carries the structured details for channels that keep them, like webhooks
+	Fields map[string]interface{}
+}
+
+// Notifier delivers operator notifications to one channel
+type Notifier interface {
+	// Name identifies the channel in logs
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// Notifiers sends a message to every configured channel
+type Notifiers []Notifier
+
+// Send delivers the message to all channels, trying each one even if an earlier one failed
+func (n Notifiers) Send(ctx context.Context, msg Message) error {
+	var failed []string
+	for _, notifier := range n {
+		if err := notifier.Send(ctx, msg); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", notifier.Name(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to notify %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
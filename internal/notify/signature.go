@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the timestamp and body
+	SignatureHeader = "X-Signature"
+	// SignatureTimestampHeader carries the Unix time the payload was signed at
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+
+	// DefaultSignatureTolerance is how old a signature VerifySignature accepts by default
+	DefaultSignatureTolerance = 5 * time.Minute
+)
+
+// Sign returns the X-Signature value of a body sent at timestamp: the HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the shared secret. Covering the timestamp keeps a
+// captured request from being replayed later with a new one.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the X-Signature and X-Signature-Timestamp headers of a
+// received webhook against its raw body, for receivers written in Go. Signatures
+// older or further in the future than tolerance are rejected, 0 uses
+// DefaultSignatureTolerance.
+func VerifySignature(secret string, body []byte, timestamp, signature string, tolerance time.Duration) error {
+	if secret == "" {
+		return errors.New("no secret to verify the signature with")
+	}
+	if signature == "" || timestamp == "" {
+		return errors.New("missing signature")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+	if math.Abs(float64(time.Now().Unix()-ts)) > tolerance.Seconds() {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(strings.ToLower(signature))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const telegramAPIURL = "https://api.telegram.org"
+
+// Telegram sends notifications to a chat through the bot API
+type Telegram struct {
+	botToken   string
+	chatID     string
+	httpClient *http.Client
+}
+
+// NewTelegram creates a notifier posting to chatID. The bot has to be a member of the chat.
+func NewTelegram(botToken string, chatID string) *Telegram {
+	return &Telegram{
+		botToken:   botToken,
+		chatID:     chatID,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+func (t *Telegram) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id": t.chatID,
+		"text":    msg.Title + "\n\n" + msg.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	reqURL := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPIURL, t.botToken)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var apiResp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("telegram sendMessage failed: %s", apiResp.Description)
+	}
+	return nil
+}
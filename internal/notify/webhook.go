@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook posts notifications as JSON to an URL, signed when it has a secret
+type Webhook struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+// NewWebhook creates a webhook channel. With a secret, every request carries the
+// SignatureHeader and SignatureTimestampHeader the receiver checks with VerifySignature.
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		url:        url,
+		secret:     secret,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Send posts {"title", "body", ...fields}. Any 2xx status counts as delivered.
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	payload := make(map[string]interface{}, len(msg.Fields)+2)
+	for k, v := range msg.Fields {
+		payload[k] = v
+	}
+	payload["title"] = msg.Title
+	payload["body"] = msg.Body
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		timestamp := time.Now().Unix()
+		req.Header.Set(SignatureTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(w.secret, timestamp, body))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package pagination implements keyset pagination with opaque cursors.
+//
+// Listings are ordered newest first by (created_at, id). A cursor encodes the
+// created_at and id of the last item of a page, and the next page continues
+// strictly after it, so pages stay fast and stable as tables grow, unlike
+// OFFSET pagination.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for cursors that weren't issued by Cursor.Encode
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at the last item of a page
+type Cursor struct {
+	CreatedAt int64
+	ID        int64
+}
+
+// Encode returns the opaque representation of the cursor
+func (c Cursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.CreatedAt, c.ID)))
+}
+
+// Decode parses a cursor returned by Encode
+func Decode(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if c.CreatedAt, err = strconv.ParseInt(createdAt, 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Params selects one page of a listing
+type Params struct {
+	After *Cursor // nil for the first page
+	Limit int
+}
+
+// Parse builds Params from the cursor and page size query values.
+// An empty or out of range page size falls back to defaultLimit.
+func Parse(cursor, pageSize string, defaultLimit, maxLimit int) (Params, error) {
+	p := Params{Limit: defaultLimit}
+	if cursor != "" {
+		after, err := Decode(cursor)
+		if err != nil {
+			return p, err
+		}
+		p.After = after
+	}
+	if pageSize != "" {
+		if n, err := strconv.Atoi(pageSize); err == nil && n > 0 && n <= maxLimit {
+			p.Limit = n
+		}
+	}
+	return p, nil
+}
+
+// Where returns the condition selecting rows after the cursor for listings
+// ordered by createdAtColumn DESC, idColumn DESC. It is empty on the first page.
+func (p Params) Where(createdAtColumn, idColumn string) (string, []interface{}) {
+	if p.After == nil {
+		return "", nil
+	}
+	cond := fmt.Sprintf("(%s < ? OR (%s = ? AND %s < ?))", createdAtColumn, createdAtColumn, idColumn)
+	return cond, []interface{}{p.After.CreatedAt, p.After.CreatedAt, p.After.ID}
+}
+
+// WhereID is Where for tables whose ids grow with creation time, ordered by idColumn DESC
+func (p Params) WhereID(idColumn string) (string, []interface{}) {
+	if p.After == nil {
+		return "", nil
+	}
+	return idColumn + " < ?", []interface{}{p.After.ID}
+}
+
+// FetchLimit is the number of rows to query: one more than the page size
+// to find out whether there is a next page
+func (p Params) FetchLimit() int {
+	return p.Limit + 1
+}
+
+// Trim cuts items fetched with FetchLimit down to the page size and returns
+// the cursor of the next page, or an empty string on the last page
+func Trim[T any](items []T, p Params, cursor func(T) Cursor) ([]T, string) {
+	if len(items) <= p.Limit {
+		return items, ""
+	}
+	items = items[:p.Limit]
+	return items, cursor(items[len(items)-1]).Encode()
+}
@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrInvalidWebhook is returned when a webhook request can't be authenticated or parsed
+var ErrInvalidWebhook = errors.New("invalid webhook request")
+
+// Invoice is a pending top-up the provider has to collect
+type Invoice struct {
+	PaymentID   int64
+	UserID      int
+	Amount      float64 // TON credited to the balance once paid
+	Description string
+}
+
+// Checkout is what the user needs to pay an invoice with the provider
+type Checkout struct {
+	URL            string
+	ProviderAmount int64 // amount in the provider's smallest unit
+	Currency       string
+}
+
+// Event is a confirmed payment reported by a provider webhook
+type Event struct {
+	PaymentID      int64
+	ExternalID     string
+	ProviderAmount int64
+	Currency       string
+	// PreCheckout is set when the provider asks whether the payment may be charged
+	// before it charges the user, instead of confirming it. The handler answers with
+	// ok, or declines with a reason shown to the user.
+	PreCheckout func(ctx context.Context, ok bool, reason string) error
+}
+
+// Provider is an alternative deposit rail. Handlers only talk to this interface,
+// so adding a rail means implementing it and registering it in Providers.
+type Provider interface {
+	// Name identifies the rail in routes and stored payments
+	Name() string
+	// CreateInvoice registers the invoice with the provider and returns how to pay it
+	CreateInvoice(ctx context.Context, invoice Invoice) (*Checkout, error)
+	// HandleWebhook authenticates and parses a provider callback.
+	// It returns a nil event for callbacks that aren't about a payment.
+	HandleWebhook(ctx context.Context, r *http.Request) (*Event, error)
+}
+
+// Providers holds the enabled rails by name
+type Providers map[string]Provider
+
+// Register adds a provider under its name
+func (p Providers) Register(provider Provider) {
+	p[provider.Name()] = provider
+}
@@ -0,0 +1,190 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tonapp/internal/money"
+)
+
+const (
+	// ProviderTelegramStars is the name of the Telegram Stars rail
+	ProviderTelegramStars = "telegram_stars"
+	// currencyStars is the Telegram currency code for Stars
+	currencyStars = "XTR"
+
+	telegramAPIURL = "https://api.telegram.org"
+)
+
+// TelegramStars collects top-ups in Telegram Stars through the bot payments API
+type TelegramStars struct {
+	botToken      string
+	webhookSecret string
+	tonPerStar    float64
+	httpClient    *http.Client
+}
+
+// NewTelegramStars creates the Stars rail. The webhook secret must match the
+// secret_token passed to setWebhook.
+func NewTelegramStars(botToken string, webhookSecret string, tonPerStar float64) *TelegramStars {
+	return &TelegramStars{
+		botToken:      botToken,
+		webhookSecret: webhookSecret,
+		tonPerStar:    tonPerStar,
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *TelegramStars) Name() string {
+	return ProviderTelegramStars
+}
+
+func (t *TelegramStars) CreateInvoice(ctx context.Context, invoice Invoice) (*Checkout, error) {
+	if t.tonPerStar <= 0 {
+		return nil, fmt.Errorf("stars rate is not configured")
+	}
+
+	stars := int64(math.Ceil(invoice.Amount / t.tonPerStar))
+	if stars < 1 {
+		stars = 1
+	}
+
+	var link string
+	err := t.call(ctx, "createInvoiceLink", map[string]interface{}{
+		"title":       "Balance top-up",
+		"description": invoice.Description,
+		"payload":     strconv.FormatInt(invoice.PaymentID, 10),
+		"currency":    currencyStars,
+		"prices": []map[string]interface{}{
+			{"label": money.Format(invoice.Amount) + " TON", "amount": stars},
+		},
+	}, &link)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Checkout{
+		URL:            link,
+		ProviderAmount: stars,
+		Currency:       currencyStars,
+	}, nil
+}
+
+type telegramUpdate struct {
+	PreCheckoutQuery *struct {
+		ID             string `json:"id"`
+		Currency       string `json:"currency"`
+		TotalAmount    int64  `json:"total_amount"`
+		InvoicePayload string `json:"invoice_payload"`
+	} `json:"pre_checkout_query"`
+	Message *struct {
+		SuccessfulPayment *struct {
+			Currency                string `json:"currency"`
+			TotalAmount             int64  `json:"total_amount"`
+			InvoicePayload          string `json:"invoice_payload"`
+			TelegramPaymentChargeID string `json:"telegram_payment_charge_id"`
+		} `json:"successful_payment"`
+	} `json:"message"`
+}
+
+func (t *TelegramStars) HandleWebhook(ctx context.Context, r *http.Request) (*Event, error) {
+	secret := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+	if t.webhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(t.webhookSecret)) != 1 {
+		return nil, ErrInvalidWebhook
+	}
+
+	var update telegramUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		return nil, ErrInvalidWebhook
+	}
+
+	// Telegram waits up to 10 seconds for an answer before charging the user
+	if query := update.PreCheckoutQuery; query != nil {
+		answer := func(ctx context.Context, ok bool, reason string) error {
+			params := map[string]interface{}{
+				"pre_checkout_query_id": query.ID,
+				"ok":                    ok,
+			}
+			if !ok {
+				params["error_message"] = reason
+			}
+			var answered bool
+			return t.call(ctx, "answerPreCheckoutQuery", params, &answered)
+		}
+		paymentID, err := strconv.ParseInt(query.InvoicePayload, 10, 64)
+		if err != nil {
+			return nil, answer(ctx, false, "This invoice is not valid.")
+		}
+		return &Event{
+			PaymentID:      paymentID,
+			ProviderAmount: query.TotalAmount,
+			Currency:       query.Currency,
+			PreCheckout:    answer,
+		}, nil
+	}
+
+	if update.Message == nil || update.Message.SuccessfulPayment == nil {
+		return nil, nil
+	}
+
+	paid := update.Message.SuccessfulPayment
+	paymentID, err := strconv.ParseInt(paid.InvoicePayload, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected invoice payload %q", paid.InvoicePayload)
+	}
+
+	return &Event{
+		PaymentID:      paymentID,
+		ExternalID:     paid.TelegramPaymentChargeID,
+		ProviderAmount: paid.TotalAmount,
+		Currency:       paid.Currency,
+	}, nil
+}
+
+// call invokes a Bot API method and decodes its result
+func (t *TelegramStars) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	reqURL := fmt.Sprintf("%s/bot%s/%s", telegramAPIURL, t.botToken, method)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var apiResp struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	if !apiResp.OK {
+		return fmt.Errorf("telegram %s failed: %s", method, apiResp.Description)
+	}
+
+	return json.Unmarshal(apiResp.Result, result)
+}
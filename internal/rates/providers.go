@@ -0,0 +1,124 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// getJSON sends a GET request and decodes the JSON response into v
+func getJSON(ctx context.Context, httpClient *http.Client, rawURL string, header http.Header, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("responded with status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// coinGecko asks the simple price API of coingecko, a demo API key raises its rate limit
+type coinGecko struct {
+	httpClient *http.Client
+	apiKey     string
+}
+
+func (p *coinGecko) Name() string { return "coingecko" }
+
+func (p *coinGecko) FetchRates(ctx context.Context, currencies []string) (map[string]float64, error) {
+	header := http.Header{}
+	if p.apiKey != "" {
+		header.Set("x-cg-demo-api-key", p.apiKey)
+	}
+
+	var data map[string]map[string]float64
+	err := getJSON(ctx, p.httpClient, "https://api.coingecko.com/api/v3/simple/price?ids=the-open-network&vs_currencies="+
+		url.QueryEscape(strings.Join(currencies, ",")), header, &data)
+	if err != nil {
+		return nil, err
+	}
+	return data["the-open-network"], nil
+}
+
+// coinMarketCapTONID is the coinmarketcap ID of Toncoin
+const coinMarketCapTONID = "11419"
+
+// coinMarketCap asks the quotes API of coinmarketcap, which requires an API key
+type coinMarketCap struct {
+	httpClient *http.Client
+	apiKey     string
+}
+
+func (p *coinMarketCap) Name() string { return "coinmarketcap" }
+
+func (p *coinMarketCap) FetchRates(ctx context.Context, currencies []string) (map[string]float64, error) {
+	header := http.Header{}
+	header.Set("X-CMC_PRO_API_KEY", p.apiKey)
+
+	var data struct {
+		Data map[string]struct {
+			Quote map[string]struct {
+				Price float64 `json:"price"`
+			} `json:"quote"`
+		} `json:"data"`
+	}
+	err := getJSON(ctx, p.httpClient, "https://pro-api.coinmarketcap.com/v2/cryptocurrency/quotes/latest?id="+coinMarketCapTONID+
+		"&convert="+url.QueryEscape(strings.ToUpper(strings.Join(currencies, ","))), header, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]float64)
+	for symbol, quote := range data.Data[coinMarketCapTONID].Quote {
+		rates[strings.ToLower(symbol)] = quote.Price
+	}
+	return rates, nil
+}
+
+// tonAPI asks the rates API of tonapi.io, which serves TON prices without an API key
+// at a low rate limit
+type tonAPI struct {
+	httpClient *http.Client
+	apiKey     string
+}
+
+func (p *tonAPI) Name() string { return "tonapi" }
+
+func (p *tonAPI) FetchRates(ctx context.Context, currencies []string) (map[string]float64, error) {
+	header := http.Header{}
+	if p.apiKey != "" {
+		header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	var data struct {
+		Rates map[string]struct {
+			Prices map[string]float64 `json:"prices"`
+		} `json:"rates"`
+	}
+	err := getJSON(ctx, p.httpClient, "https://tonapi.io/v2/rates?tokens=ton&currencies="+
+		url.QueryEscape(strings.Join(currencies, ",")), header, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]float64)
+	for symbol, price := range data.Rates["TON"].Prices {
+		rates[strings.ToLower(symbol)] = price
+	}
+	return rates, nil
+}
@@ -0,0 +1,244 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+const (
+	defaultTTL             = 5 * time.Minute
+	defaultRefreshInterval = 4 * time.Minute
+	defaultMaxStale        = time.Hour
+	defaultRequestTimeout  = 5 * time.Second
+)
+
+// ErrNoRate is returned when no provider has a price for a currency and no cached one is recent enough
+var ErrNoRate = errors.New("TON rate unavailable")
+
+// Provider fetches TON prices from one price API
+type Provider interface {
+	// Name identifies the provider in config and responses
+	Name() string
+	// FetchRates returns the TON price in as many of the given currencies as it knows
+	FetchRates(ctx context.Context, currencies []string) (map[string]float64, error)
+}
+
+type cachedRate struct {
+	price     float64
+	provider  string
+	fetchedAt time.Time
+}
+
+// Service caches TON prices per fiat currency. Missing or expired prices are fetched
+// from the providers in order, a currency the first provider doesn't return is asked
+// from the next one. When every provider fails the last price is served until it is
+// older than maxStale.
+type Service struct {
+	providers []Provider
+	ttl       time.Duration
+	refresh   time.Duration
+	maxStale  time.Duration
+
+	mu    sync.Mutex
+	rates map[string]cachedRate
+
+	// fetching serializes provider calls, so concurrent misses fetch once
+	fetching sync.Mutex
+}
+
+// NewService creates a rate service with the providers of the config
+func NewService(cfg model.RatesConfig) *Service {
+	timeout := defaultRequestTimeout
+	if cfg.RequestTimeoutMs > 0 {
+		timeout = time.Duration(cfg.RequestTimeoutMs) * time.Millisecond
+	}
+	httpClient := &http.Client{Timeout: timeout}
+
+	names := cfg.Providers
+	if len(names) == 0 {
+		names = []string{"coingecko", "coinmarketcap", "tonapi"}
+	}
+	var providers []Provider
+	for _, name := range names {
+		switch name {
+		case "coingecko":
+			providers = append(providers, &coinGecko{httpClient: httpClient, apiKey: cfg.CoinGeckoAPIKey})
+		case "coinmarketcap":
+			if cfg.CoinMarketCapAPIKey != "" {
+				providers = append(providers, &coinMarketCap{httpClient: httpClient, apiKey: cfg.CoinMarketCapAPIKey})
+			}
+		case "tonapi":
+			providers = append(providers, &tonAPI{httpClient: httpClient, apiKey: cfg.TonAPIKey})
+		}
+	}
+
+	return &Service{
+		providers: providers,
+		ttl:       durationOr(cfg.TTLSeconds, defaultTTL),
+		refresh:   durationOr(cfg.RefreshIntervalSeconds, defaultRefreshInterval),
+		maxStale:  durationOr(cfg.MaxStaleSeconds, defaultMaxStale),
+		rates:     make(map[string]cachedRate),
+	}
+}
+
+func durationOr(seconds int, fallback time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
+
+// TTL is how long a price is served before it is fetched again
+func (s *Service) TTL() time.Duration {
+	return s.ttl
+}
+
+// ProviderNames lists the providers in the order they are asked
+func (s *Service) ProviderNames() []string {
+	names := make([]string, 0, len(s.providers))
+	for _, p := range s.providers {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// Rate returns the TON price in the given currency
+func (s *Service) Rate(ctx context.Context, currency string) (float64, error) {
+	rates, errs := s.Rates(ctx, []string{currency})
+	if len(rates) == 0 {
+		return 0, errs[currency]
+	}
+	return rates[0].Price, nil
+}
+
+// Rates returns the TON price in the given currencies, fetching the ones missing from
+// the cache. Currencies without a price are returned in the error map.
+func (s *Service) Rates(ctx context.Context, currencies []string) ([]model.TONRate, map[string]error) {
+	var fetchErr error
+	if missing := s.expired(currencies); len(missing) > 0 {
+		s.fetching.Lock()
+		// Another request may have fetched them while this one waited
+		if missing = s.expired(missing); len(missing) > 0 {
+			fetchErr = s.fetch(ctx, missing)
+		}
+		s.fetching.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rates := make([]model.TONRate, 0, len(currencies))
+	errs := make(map[string]error)
+	for _, currency := range currencies {
+		cached, ok := s.rates[currency]
+		age := time.Since(cached.fetchedAt)
+		if !ok || age > s.maxStale {
+			err := ErrNoRate
+			if fetchErr != nil {
+				err = fmt.Errorf("%w: %v", ErrNoRate, fetchErr)
+			}
+			errs[currency] = err
+			continue
+		}
+		rates = append(rates, model.TONRate{
+			Currency:  currency,
+			Price:     cached.price,
+			Provider:  cached.provider,
+			FetchedAt: cached.fetchedAt.Unix(),
+			Stale:     age > s.ttl,
+		})
+	}
+	return rates, errs
+}
+
+// Refresh fetches the TON price in the given currencies, cached or not
+func (s *Service) Refresh(ctx context.Context, currencies []string) error {
+	s.fetching.Lock()
+	defer s.fetching.Unlock()
+	return s.fetch(ctx, currencies)
+}
+
+// Run refreshes the given currencies every refresh interval until the context is done,
+// so requests are served from the cache
+func (s *Service) Run(ctx context.Context, currencies []string) {
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx, currencies); err != nil {
+				slog.ErrorContext(ctx, "Failed to refresh TON rates", "error", err)
+			}
+		}
+	}
+}
+
+// expired returns the currencies without a fresh cached price
+func (s *Service) expired(currencies []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missing []string
+	for _, currency := range currencies {
+		if cached, ok := s.rates[currency]; !ok || time.Since(cached.fetchedAt) > s.ttl {
+			missing = append(missing, currency)
+		}
+	}
+	return missing
+}
+
+// fetch asks the providers in order for the currencies, each one only for those the
+// previous ones didn't return. Must be called with fetching held.
+func (s *Service) fetch(ctx context.Context, currencies []string) error {
+	if len(s.providers) == 0 {
+		return errors.New("no rate providers configured")
+	}
+
+	missing := currencies
+	var failures []string
+	for _, p := range s.providers {
+		if len(missing) == 0 {
+			break
+		}
+		prices, err := p.FetchRates(ctx, missing)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", p.Name(), err))
+			continue
+		}
+
+		now := time.Now()
+		var rest []string
+		s.mu.Lock()
+		for _, currency := range missing {
+			price, ok := prices[currency]
+			if !ok || price <= 0 {
+				rest = append(rest, currency)
+				continue
+			}
+			s.rates[currency] = cachedRate{price: price, provider: p.Name(), fetchedAt: now}
+		}
+		s.mu.Unlock()
+		if len(rest) > 0 {
+			failures = append(failures, fmt.Sprintf("%s: no %s price", p.Name(), strings.Join(rest, ", ")))
+		}
+		missing = rest
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("no %s price from any provider (%s)", strings.Join(missing, ", "), strings.Join(failures, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	apiURL = "https://api.telegram.org"
+	// requestTimeout bounds calls, getUpdates gets it on top of its long polling timeout
+	requestTimeout = 10 * time.Second
+)
+
+// Update is an incoming update of the bot, only messages are requested
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+// Message is a message sent to the bot
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+// User is the Telegram account that sent a message
+type User struct {
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	Username     string `json:"username"`
+	LanguageCode string `json:"language_code"`
+}
+
+// Chat is where a message was sent, the private chat with the user for commands
+type Chat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+// Button is an inline keyboard button opening the web app or a link
+type Button struct {
+	Text   string  `json:"text"`
+	WebApp *WebApp `json:"web_app,omitempty"`
+	URL    string  `json:"url,omitempty"`
+}
+
+// WebApp is the Mini App a button opens, the URL has to be https
+type WebApp struct {
+	URL string `json:"url"`
+}
+
+// Bot calls the Bot API methods the command bot needs
+type Bot struct {
+	token      string
+	httpClient *http.Client
+}
+
+// NewBot creates a client of the bot with token
+func NewBot(token string) *Bot {
+	return &Bot{
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// GetUpdates long polls for messages after offset, waiting up to timeout for one
+func (b *Bot) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout+requestTimeout)
+	defer cancel()
+
+	var updates []Update
+	err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// SendMessage sends a text to a chat, with one button per row when buttons are given
+func (b *Bot) SendMessage(ctx context.Context, chatID int64, text string, buttons ...Button) error {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if len(buttons) > 0 {
+		rows := make([][]Button, len(buttons))
+		for i, button := range buttons {
+			rows[i] = []Button{button}
+		}
+		params["reply_markup"] = map[string]interface{}{"inline_keyboard": rows}
+	}
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var sent json.RawMessage
+	return b.call(ctx, "sendMessage", params, &sent)
+}
+
+// APIError is a failed Bot API call
+type APIError struct {
+	Method      string
+	Code        int
+	Description string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram %s failed: %s", e.Method, e.Description)
+}
+
+// IsBlocked reports whether a message couldn't be sent because the user blocked the
+// bot or deleted their account, so there is no point in sending them more
+func IsBlocked(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden
+}
+
+// call invokes a Bot API method and decodes its result
+func (b *Bot) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	reqURL := fmt.Sprintf("%s/bot%s/%s", apiURL, b.token, method)
+	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var apiResp struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+	}
+	if err := json.Unmarshal(respBody, &apiResp); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	if !apiResp.OK {
+		return &APIError{Method: method, Code: apiResp.ErrorCode, Description: apiResp.Description}
+	}
+
+	return json.Unmarshal(apiResp.Result, result)
+}
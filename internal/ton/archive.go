@@ -0,0 +1,149 @@
+package ton
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"tonapp/internal/money"
+	"tonapp/internal/tracing"
+)
+
+// ArchivePageSize is the number of transactions requested per page of an archive lookup
+const ArchivePageSize = 50
+
+// ErrArchiveLookupCapped is returned when an archive lookup searched its maximum number
+// of pages without reaching the start of the searched range
+var ErrArchiveLookupCapped = errors.New("archive lookup reached its page limit")
+
+type archivedTransactionsResponse struct {
+	OK     bool          `json:"ok"`
+	Result []Transaction `json:"result"`
+	Error  string        `json:"error"`
+}
+
+// FindArchivedDeposit looks for a deposit older than the latest transactions CheckDeposit
+// sees. It pages back through the wallet history from archive nodes by lt, newest first,
+// until it reaches transactions before since, and returns ErrArchiveLookupCapped after
+// maxPages pages of ArchivePageSize. A found deposit forwards the platform share and
+// returns the amount received like CheckDeposit.
+func (c *Client) FindArchivedDeposit(ctx context.Context, walletAddress string, match DepositMatch, memo string, since int64, maxPages int) (received float64, err error) {
+	ctx, span := tracing.Start(ctx, "toncenter archive lookup", tracing.KindClient)
+	span.SetAttr("ton.wallet", walletAddress)
+	pages := 0
+	defer func() {
+		span.SetAttr("toncenter.pages", pages)
+		span.SetAttr("ton.found", received > 0)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	now := time.Now().Unix()
+	awaiting := false
+	partial := 0.0
+	var lt, hash string
+	for pages < maxPages {
+		page, err := c.archivedTransactions(ctx, walletAddress, lt, hash)
+		if err != nil {
+			return 0, err
+		}
+		pages++
+		more := len(page) == ArchivePageSize
+
+		// Pages start at the cursor transaction, which ended the previous page
+		if lt != "" && len(page) > 0 && page[0].TransactionID.LT == lt {
+			page = page[1:]
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		for _, tx := range page {
+			if tx.Utime < since {
+				continue
+			}
+			if memo != "" && tx.InMsg.Message != memo {
+				continue
+			}
+			amountNano, err := strconv.ParseInt(tx.InMsg.Value, 10, 64)
+			if err != nil {
+				continue
+			}
+			amountTON := money.FromNano(amountNano)
+			credited, short := match.Credits(amountTON)
+			if short && partial == 0 {
+				partial = amountTON
+			}
+			if !credited {
+				continue
+			}
+			if tx.Utime > now-int64(match.MinAgeSeconds(amountTON)) {
+				awaiting = true
+				continue
+			}
+			if claimed, err := match.ClaimTransaction(tx.TransactionID.Hash); err != nil {
+				return 0, err
+			} else if !claimed {
+				continue
+			}
+			if err := c.TransferFundsWithSplit(ctx, amountTON, c.feeWalletAddress); err != nil {
+				return 0, err
+			}
+			return amountTON, nil
+		}
+
+		last := page[len(page)-1]
+		if !more || last.Utime < since {
+			break
+		}
+		lt, hash = last.TransactionID.LT, last.TransactionID.Hash
+		if pages == maxPages {
+			return 0, fmt.Errorf("%w of %d", ErrArchiveLookupCapped, maxPages)
+		}
+	}
+
+	if awaiting {
+		return 0, ErrAwaitingConfirmations
+	}
+	if partial > 0 {
+		return 0, &PartialDepositError{Expected: match.Amount, Received: partial}
+	}
+	return 0, nil
+}
+
+// archivedTransactions returns a page of wallet transactions from archive nodes, newest
+// first, starting at the transaction of lt and hash, or at the newest one without them
+func (c *Client) archivedTransactions(ctx context.Context, walletAddress string, lt string, hash string) ([]Transaction, error) {
+	params := url.Values{
+		"address":  {walletAddress},
+		"limit":    {strconv.Itoa(ArchivePageSize)},
+		"archival": {"true"},
+	}
+	if lt != "" {
+		params.Set("lt", lt)
+		params.Set("hash", hash)
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/getTransactions?%s", c.baseURL, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	body, err := c.doToncenter(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	var result archivedTransactionsResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("API returned not OK status: %s", result.Error)
+	}
+	return result.Result, nil
+}
@@ -0,0 +1,55 @@
+package ton
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+// Payout is one message of a batch transfer
+type Payout struct {
+	Destination string
+	Amount      float64
+}
+
+// maxMessages returns how many messages a wallet contract accepts in one external message
+func maxMessages(version wallet.Version) int {
+	if version == wallet.HighloadV2R2 {
+		return 254
+	}
+	return 4
+}
+
+// MaxBatchMessages returns how many payouts WithdrawBatch can send at once from a
+// treasury wallet, or from the main wallet for an empty name. Returns 0 for unknown wallets.
+func (c *Client) MaxBatchMessages(name string) int {
+	if name == "" {
+		return maxMessages(c.walletType)
+	}
+	if w, ok := c.treasuryWallets[name]; ok {
+		return maxMessages(w.version)
+	}
+	return 0
+}
+
+// WithdrawBatch sends the payouts from a treasury wallet, or from the main wallet for an
+// empty name, as one multi-message transfer so they pay a single external message fee.
+// All payouts share the returned transaction hash.
+func (c *Client) WithdrawBatch(ctx context.Context, name string, payouts []Payout) (string, error) {
+	seedPhrase, version, fromAddress, label := c.seedPhrase, c.walletType, c.address, "main wallet"
+	if name != "" {
+		w, ok := c.treasuryWallets[name]
+		if !ok {
+			return "", fmt.Errorf("unknown treasury wallet %s", name)
+		}
+		seedPhrase, version, fromAddress, label = w.seedPhrase, w.version, w.address, "treasury wallet "+name
+	}
+	if len(payouts) == 0 {
+		return "", fmt.Errorf("empty batch")
+	}
+	if max := maxMessages(version); len(payouts) > max {
+		return "", fmt.Errorf("batch of %d payouts exceeds the %d messages %s can send", len(payouts), max, label)
+	}
+	return c.send(ctx, seedPhrase, version, fromAddress, label, payouts)
+}
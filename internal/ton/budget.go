@@ -0,0 +1,241 @@
+package ton
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+)
+
+// ErrBudgetExhausted is returned when a toncenter call can't be made within the
+// request budget, either because the queue is too long or toncenter asked us to back off
+var ErrBudgetExhausted = errors.New("toncenter request budget exhausted")
+
+const (
+	defaultToncenterRPS        = 1 // toncenter limit without an API key
+	defaultToncenterRPSWithKey = 10
+	defaultMaxQueueWait        = 5 * time.Second
+	defaultBalanceCacheTTL     = 5 * time.Minute
+	defaultThrottleBackoff     = 2 * time.Second
+)
+
+// requestBudget paces outgoing toncenter calls to stay within the RPS limit.
+// Calls reserve evenly spaced slots; a call whose slot is further away than
+// maxWait is rejected instead of queued.
+type requestBudget struct {
+	mu           sync.Mutex
+	interval     time.Duration
+	maxWait      time.Duration
+	nextSlot     time.Time
+	blockedUntil time.Time
+
+	queueDepth    int
+	maxQueueDepth int
+	requests      uint64
+	throttled     uint64
+	rejected      uint64
+	remaining     int // last X-RateLimit-Remaining reported by toncenter, -1 if unknown
+}
+
+func newRequestBudget(rps float64, maxWait time.Duration) *requestBudget {
+	return &requestBudget{
+		interval:  time.Duration(float64(time.Second) / rps),
+		maxWait:   maxWait,
+		remaining: -1,
+	}
+}
+
+// acquire waits for the next free slot
+func (b *requestBudget) acquire(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	if now.Before(b.blockedUntil) {
+		b.rejected++
+		b.mu.Unlock()
+		return ErrBudgetExhausted
+	}
+
+	slot := b.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	wait := slot.Sub(now)
+	if wait > b.maxWait {
+		b.rejected++
+		b.mu.Unlock()
+		return ErrBudgetExhausted
+	}
+
+	b.nextSlot = slot.Add(b.interval)
+	b.queueDepth++
+	if b.queueDepth > b.maxQueueDepth {
+		b.maxQueueDepth = b.queueDepth
+	}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.queueDepth--
+		b.mu.Unlock()
+	}()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	b.mu.Lock()
+	b.requests++
+	b.mu.Unlock()
+	return nil
+}
+
+// observe records quota headers and backs off after a 429
+func (b *requestBudget) observe(resp *http.Response) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if v, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		b.remaining = v
+	}
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+
+	b.throttled++
+	backoff := defaultThrottleBackoff
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		backoff = time.Duration(secs) * time.Second
+	}
+	b.blockedUntil = time.Now().Add(backoff)
+}
+
+// blockedFor returns how long toncenter asked us to back off after a 429
+func (b *requestBudget) blockedFor() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Until(b.blockedUntil)
+}
+
+func (b *requestBudget) stats() model.ToncenterBudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := model.ToncenterBudgetStats{
+		RequestsPerSecond: float64(time.Second) / float64(b.interval),
+		QueueDepth:        b.queueDepth,
+		MaxQueueDepth:     b.maxQueueDepth,
+		Requests:          b.requests,
+		Throttled:         b.throttled,
+		Rejected:          b.rejected,
+	}
+	if b.remaining >= 0 {
+		remaining := b.remaining
+		stats.Remaining = &remaining
+	}
+	if time.Now().Before(b.blockedUntil) {
+		until := b.blockedUntil.Unix()
+		stats.BlockedUntil = &until
+	}
+	return stats
+}
+
+type cachedBalance struct {
+	balance   float64
+	fetchedAt time.Time
+}
+
+// ConfigureBudget sets toncenter pacing, retry and circuit breaker limits; zero values keep the defaults
+func (c *Client) ConfigureBudget(cfg model.ToncenterBudgetConfig) {
+	rps := cfg.RequestsPerSecond
+	if rps <= 0 {
+		rps = defaultToncenterRPS
+		if c.apiKey != "" {
+			rps = defaultToncenterRPSWithKey
+		}
+	}
+	maxWait := time.Duration(cfg.MaxQueueWaitMs) * time.Millisecond
+	if maxWait <= 0 {
+		maxWait = defaultMaxQueueWait
+	}
+	c.budget = newRequestBudget(rps, maxWait)
+
+	c.balanceCacheTTL = time.Duration(cfg.BalanceCacheTTLSeconds) * time.Second
+	if c.balanceCacheTTL <= 0 {
+		c.balanceCacheTTL = defaultBalanceCacheTTL
+	}
+
+	c.retry = retryPolicy{
+		maxRetries: cfg.MaxRetries,
+		backoff:    time.Duration(cfg.RetryBackoffMs) * time.Millisecond,
+		maxBackoff: maxWait,
+		timeout:    time.Duration(cfg.RequestTimeoutMs) * time.Millisecond,
+	}
+	if c.retry.maxRetries <= 0 {
+		c.retry.maxRetries = defaultMaxRetries
+	}
+	if c.retry.backoff <= 0 {
+		c.retry.backoff = defaultRetryBackoff
+	}
+	if c.retry.timeout <= 0 {
+		c.retry.timeout = defaultRequestTimeout
+	}
+
+	failures := cfg.BreakerFailures
+	if failures <= 0 {
+		failures = defaultBreakerFailures
+	}
+	cooldown := time.Duration(cfg.BreakerCooldownSeconds) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	c.breaker = newCircuitBreaker(failures, cooldown)
+}
+
+// BudgetStats returns toncenter request metrics
+func (c *Client) BudgetStats() model.ToncenterBudgetStats {
+	stats := c.budget.stats()
+
+	c.breaker.mu.Lock()
+	stats.Retries = c.breaker.retries
+	stats.Failures = c.breaker.failed
+	stats.CircuitOpened = c.breaker.opened
+	c.breaker.mu.Unlock()
+	stats.Circuit, stats.CircuitOpenUntil = c.breaker.state()
+
+	c.cacheMu.Lock()
+	stats.CachedBalances = len(c.balanceCache)
+	stats.CacheHits = c.cacheHits
+	c.cacheMu.Unlock()
+
+	return stats
+}
+
+func (c *Client) cacheBalance(addr string, balance float64) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.balanceCache[addr] = cachedBalance{balance: balance, fetchedAt: time.Now()}
+}
+
+// cachedBalanceFor returns a recent enough cached balance
+func (c *Client) cachedBalanceFor(addr string) (float64, bool) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	cached, ok := c.balanceCache[addr]
+	if !ok || time.Since(cached.fetchedAt) > c.balanceCacheTTL {
+		return 0, false
+	}
+	c.cacheHits++
+	return cached.balance, true
+}
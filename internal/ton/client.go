@@ -5,16 +5,21 @@ import (
 	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"math"
+	"log/slog"
 	"math/big"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/tracing"
+
 	"github.com/xssnick/tonutils-go/address"
 	"github.com/xssnick/tonutils-go/liteclient"
 	"github.com/xssnick/tonutils-go/tlb"
@@ -22,6 +27,14 @@ import (
 	"github.com/xssnick/tonutils-go/ton/wallet"
 )
 
+// ErrAwaitingConfirmations is returned when a matching deposit transaction
+// was found but has not reached the required confirmation depth yet
+var ErrAwaitingConfirmations = errors.New("deposit awaiting confirmations")
+
+// ErrInsufficientWalletBalance is returned when the wallet a withdrawal is sent from
+// can't cover the amount
+var ErrInsufficientWalletBalance = errors.New("insufficient balance")
+
 type Client struct {
 	apiKey           string
 	baseURL          string
@@ -30,6 +43,20 @@ type Client struct {
 	address          string
 	walletType       wallet.Version
 	feeWalletAddress string
+	treasuryWallets  map[string]*treasuryWallet
+
+	// api is the shared liteserver client, see getAPIClient
+	apiMu sync.Mutex
+	api   *ton.APIClient
+
+	httpClient      *http.Client
+	budget          *requestBudget
+	retry           retryPolicy
+	breaker         *circuitBreaker
+	balanceCacheTTL time.Duration
+	cacheMu         sync.Mutex
+	balanceCache    map[string]cachedBalance
+	cacheHits       uint64
 }
 
 func NewClient(apiKey string, isTestnet bool, seedPhrase string, walletVersion string, feeWalletAddress string) *Client {
@@ -39,35 +66,24 @@ func NewClient(apiKey string, isTestnet bool, seedPhrase string, walletVersion s
 		baseURL = "https://testnet.toncenter.com/api/v2"
 	}
 
-	// Parse wallet version
-	version := wallet.V4R2
-	switch walletVersion {
-	case "V3R1":
-		version = wallet.V3R1
-	case "V3R2":
-		version = wallet.V3R2
-	case "V4R1":
-		version = wallet.V4R1
-	case "V4R2":
-		version = wallet.V4R2
-	case "HighloadV2R2":
-		version = wallet.HighloadV2R2
-	}
-
 	c := &Client{
 		apiKey:           apiKey,
 		baseURL:          baseURL,
 		isTestnet:        isTestnet,
 		seedPhrase:       seedPhrase,
-		walletType:       version,
+		walletType:       parseWalletVersion(walletVersion),
 		feeWalletAddress: feeWalletAddress,
+		treasuryWallets:  make(map[string]*treasuryWallet),
+		httpClient:       &http.Client{Timeout: 15 * time.Second},
+		balanceCache:     make(map[string]cachedBalance),
 	}
+	c.ConfigureBudget(model.ToncenterBudgetConfig{})
 
 	// Generate wallet address from seed phrase
 	addr, err := c.generateWalletAddress()
 	if err != nil {
 		// Log error but don't fail - we'll try to generate address again when needed
-		fmt.Printf("Failed to generate initial wallet address: %v\n", err)
+		slog.Error("Failed to generate initial wallet address", "error", err)
 	} else {
 		c.address = addr
 	}
@@ -75,6 +91,21 @@ func NewClient(apiKey string, isTestnet bool, seedPhrase string, walletVersion s
 	return c
 }
 
+// parseWalletVersion maps a configured wallet version to its contract, V4R2 by default
+func parseWalletVersion(walletVersion string) wallet.Version {
+	switch walletVersion {
+	case "V3R1":
+		return wallet.V3R1
+	case "V3R2":
+		return wallet.V3R2
+	case "V4R1":
+		return wallet.V4R1
+	case "HighloadV2R2":
+		return wallet.HighloadV2R2
+	}
+	return wallet.V4R2
+}
+
 type Wallet struct {
 	PrivateKey string
 	PublicKey  string
@@ -89,20 +120,9 @@ func (c *Client) generateWalletAddress() (string, error) {
 	// Split seed phrase into words
 	words := strings.Split(c.seedPhrase, " ")
 
-	// Initialize TON connection
-	client := liteclient.NewConnectionPool()
-	configUrl := "https://ton.org/global.config.json"
-	if c.isTestnet {
-		configUrl = "https://ton-blockchain.github.io/testnet-global.config.json"
-	}
-	err := client.AddConnectionsFromConfigUrl(context.Background(), configUrl)
-	if err != nil {
-		panic(err)
-	}
-	api := ton.NewAPIClient(client)
-
-	// Create wallet from seed phrase using specified version
-	w, err := wallet.FromSeed(api, words, c.walletType)
+	// Create wallet from seed phrase using specified version. The address is derived
+	// from the key, so no connection is needed.
+	w, err := wallet.FromSeed(nil, words, c.walletType)
 	if err != nil {
 		return "", fmt.Errorf("failed to create wallet from seed phrase: %v", err)
 	}
@@ -120,7 +140,7 @@ func (c *Client) GetDepositAddress() string {
 	if c.address == "" {
 		addr, err := c.generateWalletAddress()
 		if err != nil {
-			fmt.Printf("Failed to generate wallet address: %v\n", err)
+			slog.Error("Failed to generate wallet address", "error", err)
 			return ""
 		}
 		c.address = addr
@@ -134,6 +154,10 @@ type Message struct {
 }
 
 type Transaction struct {
+	TransactionID struct {
+		LT   string `json:"lt"`
+		Hash string `json:"hash"`
+	} `json:"transaction_id"`
 	Utime int64   `json:"utime"`
 	InMsg Message `json:"in_msg"`
 }
@@ -147,8 +171,25 @@ type BalanceResponse struct {
 	Result string `json:"result"`
 }
 
-// CheckDeposit verifies if a deposit transaction exists
-func (c *Client) CheckDeposit(walletAddress string, expectedAmount float64, memo string, withinLastMinutes int) (bool, error) {
+// CheckDeposit verifies if a deposit transaction exists and returns the amount received,
+// 0 when no transfer is credited for the deposit.
+// A matching transaction younger than the confirmation tier of its amount is not
+// credited yet and ErrAwaitingConfirmations is returned instead. A transfer short of
+// the amount returns a *PartialDepositError unless partial payments are credited.
+func (c *Client) CheckDeposit(walletAddress string, match DepositMatch, memo string, withinLastMinutes int) (float64, error) {
+	threshold := time.Now().Add(-time.Duration(withinLastMinutes) * time.Minute).Unix()
+	return c.checkDeposit(walletAddress, match, memo, threshold)
+}
+
+// CheckAddressDeposit verifies if a transfer for the deposit arrived at a personal
+// deposit address since the given time, whatever its comment, like CheckDeposit
+func (c *Client) CheckAddressDeposit(walletAddress string, match DepositMatch, since int64) (float64, error) {
+	return c.checkDeposit(walletAddress, match, "", since)
+}
+
+// checkDeposit looks for a transfer credited for the deposit with the memo after
+// threshold, any comment matches an empty memo
+func (c *Client) checkDeposit(walletAddress string, match DepositMatch, memo string, threshold int64) (float64, error) {
 
 	// Build URL with parameters
 	endpoint := fmt.Sprintf("%s/getTransactions", c.baseURL)
@@ -159,52 +200,45 @@ func (c *Client) CheckDeposit(walletAddress string, expectedAmount float64, memo
 	}
 
 	reqURL := fmt.Sprintf("%s?%s", endpoint, params.Encode())
-	fmt.Printf("Checking transactions at URL: %s\n", reqURL)
+	slog.Debug("Checking transactions", "wallet", walletAddress, "endpoint", endpoint)
 
 	// Create request
 	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
-		return false, fmt.Errorf("failed to create request: %v", err)
+		return 0, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	// Add API key
-	req.Header.Set("X-API-Key", c.apiKey)
-
 	// Make request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("failed to make request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("failed to read response: %v", err)
-	}
+	// Without toncenter budget or while it is down the liteserver check below still runs
+	var result TransactionsResponse
+	body, err := c.doToncenter(context.Background(), req)
+	if err == ErrBudgetExhausted || err == ErrToncenterUnavailable {
+		slog.Warn("Toncenter call skipped, checking deposit via liteclient only", "wallet", walletAddress, "error", err)
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to make request: %w", err)
+	} else {
+		slog.Debug("Response from TON Center", "wallet", walletAddress, "body", string(body))
 
-	fmt.Printf("Response from TON Center: %s\n", string(body))
+		// Parse response
+		if err := json.Unmarshal(body, &result); err != nil {
+			return 0, fmt.Errorf("failed to parse response: %v", err)
+		}
 
-	// Parse response
-	var result TransactionsResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return false, fmt.Errorf("failed to parse response: %v", err)
+		if !result.OK {
+			return 0, fmt.Errorf("API returned not OK status")
+		}
 	}
 
-	if !result.OK {
-		return false, fmt.Errorf("API returned not OK status")
-	}
+	slog.Debug("Looking for deposit transactions", "wallet", walletAddress, "after", time.Unix(threshold, 0), "memo", memo)
 
-	// Calculate time threshold
-	threshold := time.Now().Add(-time.Duration(withinLastMinutes) * time.Minute).Unix()
-	fmt.Printf("Looking for transactions after: %v with memo: %s\n",
-		time.Unix(threshold, 0), memo)
+	now := time.Now().Unix()
+	awaiting := false
+	partial := 0.0
 
 	// Check transactions
 	for _, tx := range result.Result {
-		fmt.Printf("Found transaction at %v with amount %s and memo: %s\n",
-			time.Unix(tx.Utime, 0), tx.InMsg.Value, tx.InMsg.Message)
+		slog.Debug("Found transaction",
+			"wallet", walletAddress, "time", time.Unix(tx.Utime, 0), "amount_nano", tx.InMsg.Value, "memo", tx.InMsg.Message)
 
 		// Skip if transaction is too old
 		if tx.Utime < threshold {
@@ -212,45 +246,215 @@ func (c *Client) CheckDeposit(walletAddress string, expectedAmount float64, memo
 		}
 
 		// Skip if memo doesn't match
-		if tx.InMsg.Message != memo {
+		if memo != "" && tx.InMsg.Message != memo {
 			continue
 		}
 
 		// Parse amount in nanotons
 		amountNano, err := strconv.ParseInt(tx.InMsg.Value, 10, 64)
 		if err != nil {
-			fmt.Printf("Failed to parse amount: %v\n", err)
+			slog.Warn("Failed to parse transaction amount", "wallet", walletAddress, "amount_nano", tx.InMsg.Value, "error", err)
 			continue // Skip if amount cannot be parsed
 		}
 
-		amountTON := fromNano(amountNano)
-		fmt.Printf("Transaction amount in TON: %v, expected: %v\n", amountTON, expectedAmount)
+		amountTON := money.FromNano(amountNano)
+		slog.Debug("Transaction amount", "amount", money.Format(amountTON), "expected", money.Format(match.Amount))
 
-		// Compare amounts in TON with small epsilon for float comparison
-		if math.Abs(amountTON-expectedAmount) < 0.000001 {
-			err := c.TransferFundsWithSplit(context.Background(), amountTON, c.feeWalletAddress)
-			if err != nil {
-				return false, err
-			}
-			return true, nil
+		credited, short := match.Credits(amountTON)
+		if short && partial == 0 {
+			partial = amountTON
+		}
+		if !credited {
+			continue
+		}
+		// Transactions younger than their tier are not deep enough to be credited
+		if tx.Utime > now-int64(match.MinAgeSeconds(amountTON)) {
+			awaiting = true
+			continue
+		}
+		if claimed, err := match.ClaimTransaction(tx.TransactionID.Hash); err != nil {
+			return 0, err
+		} else if !claimed {
+			continue
+		}
+		err = c.TransferFundsWithSplit(context.Background(), amountTON, c.feeWalletAddress)
+		if err != nil {
+			return 0, err
+		}
+		return amountTON, nil
+	}
+
+	// toncenter only exposes plain text comments, so cross-check via liteserver
+	// where message bodies (binary comment cells, forward payloads) are parsed properly
+	amountTON, found, err := c.findDepositViaLiteclient(context.Background(), walletAddress, match, memo, threshold, now)
+	var partialErr *PartialDepositError
+	if errors.As(err, &partialErr) {
+		if partial == 0 {
+			partial = partialErr.Received
+		}
+		err = nil
+	}
+	if err == ErrAwaitingConfirmations {
+		return 0, err
+	}
+	if err != nil {
+		slog.Error("Failed to cross-check deposit via liteclient", "wallet", walletAddress, "error", err)
+		return 0, nil
+	}
+	if found {
+		err := c.TransferFundsWithSplit(context.Background(), amountTON, c.feeWalletAddress)
+		if err != nil {
+			return 0, err
 		}
+		return amountTON, nil
+	}
+
+	if awaiting {
+		return 0, ErrAwaitingConfirmations
+	}
+	if partial > 0 {
+		return 0, &PartialDepositError{Expected: match.Amount, Received: partial}
 	}
 
-	return false, nil
+	return 0, nil
 }
-func (c *Client) GetMainWalletAddress() (string, error) {
+
+// findDepositViaLiteclient scans the latest wallet transactions via liteserver
+// and matches the memo against the decoded incoming message body
+func (c *Client) findDepositViaLiteclient(ctx context.Context, walletAddress string, match DepositMatch, memo string, threshold int64, now int64) (amount float64, found bool, err error) {
+	ctx, span := tracing.Start(ctx, "liteserver find deposit", tracing.KindClient)
+	span.SetAttr("ton.wallet", walletAddress)
+	defer func() {
+		span.SetAttr("ton.found", found)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	api, err := c.getAPIClient(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	addr, err := address.ParseAddr(walletAddress)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to parse wallet address: %v", err)
+	}
+
+	block, err := api.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get masterchain info: %v", err)
+	}
+
+	account, err := api.GetAccount(ctx, block, addr)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get account: %v", err)
+	}
+	if !account.IsActive || account.LastTxLT == 0 {
+		return 0, false, nil
+	}
+
+	txs, err := api.ListTransactions(ctx, addr, 50, account.LastTxLT, account.LastTxHash)
+	if err != nil {
+		if err == ton.ErrNoTransactionsWereFound {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to list transactions: %v", err)
+	}
+
+	awaiting := false
+	partial := 0.0
+	for _, tx := range txs {
+		if int64(tx.Now) < threshold {
+			continue
+		}
+		if tx.IO.In == nil || tx.IO.In.MsgType != tlb.MsgTypeInternal {
+			continue
+		}
+
+		msg := tx.IO.In.AsInternal()
+		if msg.Bounced {
+			continue
+		}
+
+		if memo != "" && ParseComment(msg.Body) != memo {
+			continue
+		}
+
+		amountTON := money.FromNano(msg.Amount.Nano().Int64())
+		slog.Debug("Liteclient transaction amount", "amount", money.Format(amountTON), "expected", money.Format(match.Amount))
+
+		credited, short := match.Credits(amountTON)
+		if short && partial == 0 {
+			partial = amountTON
+		}
+		if !credited {
+			continue
+		}
+		if int64(tx.Now) > now-int64(match.MinAgeSeconds(amountTON)) {
+			awaiting = true
+			continue
+		}
+		if claimed, err := match.ClaimTransaction(hex.EncodeToString(tx.Hash)); err != nil {
+			return 0, false, err
+		} else if !claimed {
+			continue
+		}
+		return amountTON, true, nil
+	}
+
+	if awaiting {
+		return 0, false, ErrAwaitingConfirmations
+	}
+	if partial > 0 {
+		return 0, false, &PartialDepositError{Expected: match.Amount, Received: partial}
+	}
+
+	return 0, false, nil
+}
+
+// getAPIClient returns the liteserver client, connecting on first use. Connecting
+// downloads the global config and dials the liteservers, which takes seconds, so the
+// pool is kept for the lifetime of the client.
+func (c *Client) getAPIClient(ctx context.Context) (*ton.APIClient, error) {
+	c.apiMu.Lock()
+	defer c.apiMu.Unlock()
+	if c.api != nil {
+		return c.api, nil
+	}
+
 	client := liteclient.NewConnectionPool()
 	configUrl := "https://ton.org/global.config.json"
 	if c.isTestnet {
 		configUrl = "https://ton-blockchain.github.io/testnet-global.config.json"
 	}
 
-	err := client.AddConnectionsFromConfigUrl(context.Background(), configUrl)
+	err := client.AddConnectionsFromConfigUrl(ctx, configUrl)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to TON: %v", err)
+		return nil, fmt.Errorf("failed to connect to TON: %v", err)
 	}
 
-	api := ton.NewAPIClient(client)
+	c.api = ton.NewAPIClient(client)
+	return c.api, nil
+}
+
+// CheckConnectivity connects to the liteservers if needed and fetches the latest
+// masterchain block
+func (c *Client) CheckConnectivity(ctx context.Context) error {
+	api, err := c.getAPIClient(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := api.CurrentMasterchainInfo(ctx); err != nil {
+		return fmt.Errorf("failed to get masterchain info: %v", err)
+	}
+	return nil
+}
+
+func (c *Client) GetMainWalletAddress() (string, error) {
+	api, err := c.getAPIClient(context.Background())
+	if err != nil {
+		return "", err
+	}
 
 	// Create wallet instance from seed phrase
 	words := strings.Split(c.seedPhrase, " ")
@@ -262,21 +466,19 @@ func (c *Client) GetMainWalletAddress() (string, error) {
 }
 
 // TransferFundsWithSplit transfers TON from the main wallet to fee addresse with 20% split
-func (c *Client) TransferFundsWithSplit(ctx context.Context, amount float64, feeAddress string) error {
-	// Initialize connection
-	client := liteclient.NewConnectionPool()
-	configUrl := "https://ton.org/global.config.json"
-	if c.isTestnet {
-		configUrl = "https://ton-blockchain.github.io/testnet-global.config.json"
-	}
-
-	err := client.AddConnectionsFromConfigUrl(ctx, configUrl)
+func (c *Client) TransferFundsWithSplit(ctx context.Context, amount float64, feeAddress string) (err error) {
+	ctx, span := tracing.Start(ctx, "ton fee transfer", tracing.KindClient)
+	span.SetAttr("ton.amount", money.Format(amount))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	api, err := c.getAPIClient(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to connect to TON: %v", err)
+		return err
 	}
 
-	api := ton.NewAPIClient(client)
-
 	// Create wallet instance from seed phrase
 	words := strings.Split(c.seedPhrase, " ")
 	w, err := wallet.FromSeed(api, words, c.walletType)
@@ -284,9 +486,9 @@ func (c *Client) TransferFundsWithSplit(ctx context.Context, amount float64, fee
 		return fmt.Errorf("failed to create wallet from seed: %v", err)
 	}
 
-	feeAmount := amount * 0.2 // 20%
+	feeAmount := money.RoundFee(amount * 0.2) // 20%
 
-	feeNano := toNano(feeAmount)
+	feeNano := money.ToNano(feeAmount)
 
 	addr := address.MustParseAddr(feeAddress)
 	err = w.Transfer(context.Background(), addr, tlb.MustFromNano(big.NewInt(feeNano), 0), "")
@@ -298,16 +500,6 @@ func (c *Client) TransferFundsWithSplit(ctx context.Context, amount float64, fee
 	return nil
 }
 
-// Helper function to convert TON amount to nanotons
-func toNano(tons float64) int64 {
-	return int64(tons * 1000000000) // 1 TON = 10^9 nanotons
-}
-
-// Helper function to convert nanotons to TON
-func fromNano(nanotons int64) float64 {
-	return float64(nanotons) / 1000000000 // 1 TON = 10^9 nanotons
-}
-
 // GetWalletBalance returns the balance of a wallet in TON
 func (c *Client) GetWalletBalance(ctx context.Context, addr string) (float64, error) {
 	endpoint := fmt.Sprintf("%s/getAddressBalance", c.baseURL)
@@ -316,7 +508,7 @@ func (c *Client) GetWalletBalance(ctx context.Context, addr string) (float64, er
 	}
 
 	reqURL := fmt.Sprintf("%s?%s", endpoint, params.Encode())
-	fmt.Printf("Checking balance at URL: %s\n", reqURL)
+	slog.DebugContext(ctx, "Checking balance", "wallet", addr, "endpoint", endpoint)
 
 	// Create request
 	req, err := http.NewRequest("GET", reqURL, nil)
@@ -324,21 +516,17 @@ func (c *Client) GetWalletBalance(ctx context.Context, addr string) (float64, er
 		return 0, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	// Add API key
-	req.Header.Set("X-API-Key", c.apiKey)
-
 	// Make request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("failed to make request: %v", err)
+	body, err := c.doToncenter(ctx, req)
+	if err == ErrBudgetExhausted || err == ErrToncenterUnavailable {
+		// Degrade to the last known balance rather than failing the caller
+		if balance, ok := c.cachedBalanceFor(addr); ok {
+			slog.WarnContext(ctx, "Toncenter call skipped, serving cached balance", "wallet", addr, "error", err)
+			return balance, nil
+		}
 	}
-	defer resp.Body.Close()
-
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read response: %v", err)
+		return 0, fmt.Errorf("failed to make request: %w", err)
 	}
 
 	// Parse response
@@ -358,48 +546,78 @@ func (c *Client) GetWalletBalance(ctx context.Context, addr string) (float64, er
 	}
 
 	// Convert from nanotons to TON
-	balance := fromNano(balanceNano)
+	balance := money.FromNano(balanceNano)
+	c.cacheBalance(addr, balance)
 	return balance, nil
 }
 
 // WithdrawUserFunds transfers TON from main wallet to user's wallet with validations
 func (c *Client) WithdrawUserFunds(ctx context.Context, pubKey string, amount float64) (string, error) {
-	// Get user's wallet address
-	userAddress, err := c.GenerateWalletAddressFromPubKey(pubKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to generate user wallet address: %v", err)
+	return c.WithdrawFromWallet(ctx, "", pubKey, amount)
+}
+
+// withdraw transfers TON from the wallet of the seed phrase to the destination address.
+// label names the wallet in errors.
+func (c *Client) withdraw(ctx context.Context, seedPhrase string, version wallet.Version, fromAddress string, label string, destination string, amount float64) (string, error) {
+	return c.send(ctx, seedPhrase, version, fromAddress, label, []Payout{{Destination: destination, Amount: amount}})
+}
+
+// send transfers TON from the wallet of the seed phrase to every payout in one external
+// message, after checking the wallet covers their total. label names the wallet in errors.
+func (c *Client) send(ctx context.Context, seedPhrase string, version wallet.Version, fromAddress string, label string, payouts []Payout) (txHash string, err error) {
+	ctx, span := tracing.Start(ctx, "ton send", tracing.KindClient)
+	span.SetAttr("ton.wallet", label)
+	span.SetAttr("ton.messages", len(payouts))
+	defer func() {
+		span.SetAttr("ton.tx_hash", txHash)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	addrs := make([]*address.Address, len(payouts))
+	total := 0.0
+	for i, p := range payouts {
+		addr, err := address.ParseAddr(p.Destination)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse destination address: %v", err)
+		}
+		addrs[i] = addr
+		total += p.Amount
 	}
+	span.SetAttr("ton.amount", money.Format(total))
 
-	// Get main wallet
-	w, err := c.getMainWallet(ctx)
+	w, err := c.openWallet(ctx, seedPhrase, version)
 	if err != nil {
-		return "", fmt.Errorf("failed to get main wallet: %v", err)
+		return "", fmt.Errorf("failed to get %s: %v", label, err)
 	}
 
-	// Check if main wallet has enough balance
-	mainBalance, err := c.GetWalletBalance(ctx, c.address)
+	// Check if the wallet has enough balance
+	balance, err := c.GetWalletBalance(ctx, fromAddress)
 	if err != nil {
-		return "", fmt.Errorf("failed to get main wallet balance: %v", err)
+		return "", fmt.Errorf("failed to get %s balance: %v", label, err)
 	}
 
-	if mainBalance < amount {
-		return "", fmt.Errorf("insufficient balance in main wallet")
+	if balance < total {
+		return "", fmt.Errorf("%w in %s", ErrInsufficientWalletBalance, label)
 	}
 
-	// Convert amount to nanotons
-	amountNano := toNano(amount)
+	messages := make([]*wallet.Message, len(payouts))
+	for i, p := range payouts {
+		// Convert amount to nanotons
+		amountNano := money.ToNano(p.Amount)
 
-	// Send transaction
-	addr := address.MustParseAddr(userAddress)
-	message, err := w.BuildTransfer(addr, tlb.MustFromNano(big.NewInt(amountNano), 0), false, "")
-	if err != nil {
-		return "", fmt.Errorf("failed to build transfer message: %v", err)
+		message, err := w.BuildTransfer(addrs[i], tlb.MustFromNano(big.NewInt(amountNano), 0), false, "")
+		if err != nil {
+			return "", fmt.Errorf("failed to build transfer message: %v", err)
+		}
+		messages[i] = message
 	}
-	messages := []*wallet.Message{message}
-	// Send transaction
+
+	// Send transaction. It may have been broadcast when this fails, e.g. while waiting
+	// for it to be included.
 	tx, err := w.SendManyWaitTxHash(ctx, messages)
 	if err != nil {
-		return "", fmt.Errorf("failed to send withdrawal: %v", err)
+		return "", fmt.Errorf("%w: failed to send withdrawal: %v", ErrTransferUnconfirmed, err)
 	}
 
 	return hex.EncodeToString(tx), nil
@@ -425,24 +643,16 @@ func (c *Client) GenerateWalletAddressFromPubKey(pubKey string) (string, error)
 	return addr.String(), nil
 }
 
-func (c *Client) getMainWallet(ctx context.Context) (*wallet.Wallet, error) {
-	// Initialize connection
-	client := liteclient.NewConnectionPool()
-	configUrl := "https://ton.org/global.config.json"
-	if c.isTestnet {
-		configUrl = "https://ton-blockchain.github.io/testnet-global.config.json"
-	}
-
-	err := client.AddConnectionsFromConfigUrl(ctx, configUrl)
+// openWallet connects to the network and opens the wallet of a seed phrase for sending
+func (c *Client) openWallet(ctx context.Context, seedPhrase string, version wallet.Version) (*wallet.Wallet, error) {
+	api, err := c.getAPIClient(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to TON: %v", err)
+		return nil, err
 	}
 
-	api := ton.NewAPIClient(client)
-
 	// Create wallet instance from seed phrase
-	words := strings.Split(c.seedPhrase, " ")
-	w, err := wallet.FromSeed(api, words, c.walletType)
+	words := strings.Split(seedPhrase, " ")
+	w, err := wallet.FromSeed(api, words, version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create wallet from seed: %v", err)
 	}
@@ -0,0 +1,78 @@
+package ton
+
+import (
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+const (
+	// opTextComment marks a plain text comment body
+	opTextComment = 0x00000000
+	// opJettonTransferNotification is sent by jetton wallets to the recipient
+	// and carries the sender's forward payload
+	opJettonTransferNotification = 0x7362d09c
+)
+
+// ParseComment extracts a text comment from an incoming message body.
+// It supports plain text comments (op 0) stored as snake cells, and
+// comments nested inside the forward payload of a jetton transfer notification.
+// Returns an empty string if the body has no readable comment.
+func ParseComment(body *cell.Cell) string {
+	if body == nil {
+		return ""
+	}
+	return parseCommentSlice(body.BeginParse())
+}
+
+func parseCommentSlice(s *cell.Slice) string {
+	if s.BitsLeft() < 32 {
+		return ""
+	}
+
+	op, err := s.LoadUInt(32)
+	if err != nil {
+		return ""
+	}
+
+	switch op {
+	case opTextComment:
+		text, err := s.LoadStringSnake()
+		if err != nil {
+			return ""
+		}
+		return text
+	case opJettonTransferNotification:
+		payload, err := loadForwardPayload(s)
+		if err != nil || payload == nil {
+			return ""
+		}
+		return parseCommentSlice(payload)
+	}
+
+	return ""
+}
+
+// loadForwardPayload skips transfer_notification fields and returns the
+// forward_payload slice (Either Cell ^Cell)
+func loadForwardPayload(s *cell.Slice) (*cell.Slice, error) {
+	// query_id
+	if _, err := s.LoadUInt(64); err != nil {
+		return nil, err
+	}
+	// amount
+	if _, err := s.LoadBigCoins(); err != nil {
+		return nil, err
+	}
+	// sender
+	if _, err := s.LoadAddr(); err != nil {
+		return nil, err
+	}
+
+	isRef, err := s.LoadBoolBit()
+	if err != nil {
+		return nil, err
+	}
+	if isRef {
+		return s.LoadRef()
+	}
+	return s, nil
+}
@@ -0,0 +1,85 @@
+package ton
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"tonapp/internal/money"
+	"tonapp/internal/tracing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+// sweepMode sends the whole balance of the wallet, gas included
+const sweepMode = 128
+
+// DepositWalletAddress returns the personal deposit address of a subwallet of the main
+// wallet. It is derived from the seed phrase without connecting to the network and is
+// non-bounceable, as the subwallet isn't deployed until its first sweep.
+func (c *Client) DepositWalletAddress(subwalletID uint32) (string, error) {
+	w, err := wallet.FromSeed(nil, strings.Split(c.seedPhrase, " "), c.walletType)
+	if err != nil {
+		return "", fmt.Errorf("failed to create wallet from seed phrase: %v", err)
+	}
+	sub, err := w.GetSubwallet(subwalletID)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive deposit subwallet %d: %v", subwalletID, err)
+	}
+	return sub.WalletAddress().Bounce(false).String(), nil
+}
+
+// SweepDepositWallet sends the balance of a personal deposit address to the main wallet,
+// deploying the subwallet if needed. Balances below minAmount are left for later and
+// 0 is returned.
+func (c *Client) SweepDepositWallet(ctx context.Context, subwalletID uint32, minAmount float64) (swept float64, txHash string, err error) {
+	ctx, span := tracing.Start(ctx, "ton sweep deposit address", tracing.KindClient)
+	span.SetAttr("ton.subwallet_id", subwalletID)
+	defer func() {
+		span.SetAttr("ton.amount", money.Format(swept))
+		span.SetAttr("ton.tx_hash", txHash)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	from, err := c.DepositWalletAddress(subwalletID)
+	if err != nil {
+		return 0, "", err
+	}
+	balance, err := c.GetWalletBalance(ctx, from)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get deposit address balance: %v", err)
+	}
+	if balance <= 0 || balance < minAmount {
+		return 0, "", nil
+	}
+
+	to, err := address.ParseAddr(c.GetDepositAddress())
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to parse main wallet address: %v", err)
+	}
+
+	w, err := c.openWallet(ctx, c.seedPhrase, c.walletType)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get main wallet: %v", err)
+	}
+	sub, err := w.GetSubwallet(subwalletID)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to derive deposit subwallet %d: %v", subwalletID, err)
+	}
+
+	message, err := sub.BuildTransfer(to, tlb.ZeroCoins, false, "")
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to build sweep message: %v", err)
+	}
+	message.Mode = sweepMode
+	tx, err := sub.SendManyWaitTxHash(ctx, []*wallet.Message{message})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to send sweep: %v", err)
+	}
+
+	return balance, hex.EncodeToString(tx), nil
+}
@@ -0,0 +1,119 @@
+package ton
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/tracing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+)
+
+// FetchTransactionsSince returns wallet transactions with lt greater than afterLT,
+// oldest first. At most limit transactions are returned when limit > 0; in that
+// case the newest are kept.
+func (c *Client) FetchTransactionsSince(ctx context.Context, walletAddress string, afterLT uint64, limit int) (txs []model.ChainTransaction, err error) {
+	ctx, span := tracing.Start(ctx, "liteserver transactions", tracing.KindClient)
+	span.SetAttr("ton.wallet", walletAddress)
+	defer func() {
+		span.SetAttr("ton.transactions", len(txs))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	api, err := c.getAPIClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := address.ParseAddr(walletAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wallet address: %v", err)
+	}
+
+	block, err := api.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get masterchain info: %v", err)
+	}
+
+	account, err := api.GetAccount(ctx, block, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+	if account.LastTxLT <= afterLT {
+		return nil, nil
+	}
+
+	// Walk back from the newest transaction until the cursor is reached
+	var collected []*tlb.Transaction
+	lt, hash := account.LastTxLT, account.LastTxHash
+	for lt > afterLT && (limit <= 0 || len(collected) < limit) {
+		txs, err := api.ListTransactions(ctx, addr, 16, lt, hash)
+		if err != nil {
+			if err == ton.ErrNoTransactionsWereFound {
+				break
+			}
+			return nil, fmt.Errorf("failed to list transactions: %v", err)
+		}
+		if len(txs) == 0 {
+			break
+		}
+
+		for i := len(txs) - 1; i >= 0; i-- {
+			if txs[i].LT <= afterLT || (limit > 0 && len(collected) >= limit) {
+				break
+			}
+			collected = append(collected, txs[i])
+		}
+
+		lt, hash = txs[0].PrevTxLT, txs[0].PrevTxHash
+	}
+
+	result := make([]model.ChainTransaction, 0, len(collected))
+	for i := len(collected) - 1; i >= 0; i-- {
+		result = append(result, flattenTransaction(walletAddress, collected[i]))
+	}
+	return result, nil
+}
+
+func flattenTransaction(walletAddress string, tx *tlb.Transaction) model.ChainTransaction {
+	ct := model.ChainTransaction{
+		Wallet: walletAddress,
+		LT:     tx.LT,
+		Hash:   hex.EncodeToString(tx.Hash),
+		Utime:  int64(tx.Now),
+		Fee:    money.FromNano(tx.TotalFees.Coins.Nano().Int64()),
+	}
+
+	if tx.IO.In != nil && tx.IO.In.MsgType == tlb.MsgTypeInternal {
+		msg := tx.IO.In.AsInternal()
+		ct.InSource = msg.SrcAddr.String()
+		ct.InAmount = money.FromNano(msg.Amount.Nano().Int64())
+		ct.InComment = ParseComment(msg.Body)
+		ct.Bounced = msg.Bounced
+	}
+
+	if tx.IO.Out != nil {
+		outs, err := tx.IO.Out.ToSlice()
+		if err == nil {
+			for _, out := range outs {
+				if out.MsgType != tlb.MsgTypeInternal {
+					continue
+				}
+				msg := out.AsInternal()
+				ct.OutAmount += money.FromNano(msg.Amount.Nano().Int64())
+				if ct.OutDestination == "" {
+					ct.OutDestination = msg.DstAddr.String()
+					ct.OutComment = ParseComment(msg.Body)
+				}
+			}
+		}
+	}
+
+	return ct
+}
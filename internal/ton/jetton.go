@@ -0,0 +1,50 @@
+package ton
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"tonapp/internal/tracing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/ton/jetton"
+)
+
+// JettonBalance returns how many jettons of a master contract a wallet holds, in whole
+// jettons of the given decimals. A wallet that never received the jetton holds 0.
+func (c *Client) JettonBalance(ctx context.Context, master string, owner string, decimals int) (amount float64, err error) {
+	ctx, span := tracing.Start(ctx, "liteserver jetton balance", tracing.KindClient)
+	span.SetAttr("ton.jetton_master", master)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	masterAddr, err := address.ParseAddr(master)
+	if err != nil {
+		return 0, fmt.Errorf("invalid jetton master address: %v", err)
+	}
+	ownerAddr, err := address.ParseAddr(owner)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wallet address: %v", err)
+	}
+
+	api, err := c.getAPIClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	jettonWallet, err := jetton.NewJettonMasterClient(api, masterAddr).GetJettonWallet(ctx, ownerAddr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get jetton wallet: %v", err)
+	}
+	balance, err := jettonWallet.GetBalance(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get jetton balance: %v", err)
+	}
+
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	amount, _ = new(big.Float).Quo(new(big.Float).SetInt(balance), new(big.Float).SetInt(unit)).Float64()
+	return amount, nil
+}
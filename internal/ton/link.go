@@ -0,0 +1,19 @@
+package ton
+
+import (
+	"net/url"
+	"strconv"
+
+	"tonapp/internal/money"
+)
+
+// TransferLink returns the ton://transfer deep link of a payment, which wallets open
+// with the address, the amount in nanotons and the comment filled in. The comment is
+// left out when text is empty.
+func TransferLink(address string, amount float64, text string) string {
+	params := url.Values{"amount": {strconv.FormatInt(money.ToNano(amount), 10)}}
+	if text != "" {
+		params.Set("text", text)
+	}
+	return "ton://transfer/" + address + "?" + params.Encode()
+}
@@ -0,0 +1,73 @@
+package ton
+
+import (
+	"fmt"
+	"math"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+)
+
+// amountEpsilon absorbs the float error of amounts converted from nanotons
+const amountEpsilon = 0.000001
+
+// DepositMatch is the amount of a deposit request and the transfers credited for it
+type DepositMatch struct {
+	Amount float64
+	model.DepositMatchingConfig
+	// ConfirmationTiers set the age a transfer needs before it is credited, by the
+	// amount received
+	ConfirmationTiers []model.DepositConfirmationTier
+	// Claim reserves the transaction of a credited transfer, by its hex hash, for the
+	// deposit before the platform share is forwarded. It returns false when the
+	// transaction already credited another deposit, which is then skipped. Nil credits
+	// any transaction.
+	Claim func(txHash string) (bool, error)
+}
+
+// Credits reports whether a transfer of received TON is credited for the deposit.
+// Transfers short of the amount that aren't credited are partial.
+func (m DepositMatch) Credits(received float64) (credited bool, partial bool) {
+	switch {
+	case math.Abs(received-m.Amount) < math.Max(m.Tolerance, 0)+amountEpsilon:
+		return true, false
+	case received > m.Amount:
+		return m.AcceptOverpayment, false
+	default:
+		return m.CreditPartial, !m.CreditPartial
+	}
+}
+
+// MinAgeSeconds returns how old a credited transfer of received TON has to be
+func (m DepositMatch) MinAgeSeconds(received float64) int {
+	return model.DepositConfirmationAge(m.ConfirmationTiers, received)
+}
+
+// ClaimTransaction reserves the transaction of a credited transfer for the deposit, see
+// Claim. The hash may be hex or base64 like toncenter returns it.
+func (m DepositMatch) ClaimTransaction(hash string) (bool, error) {
+	if m.Claim == nil {
+		return true, nil
+	}
+	txHash, err := ParseTransactionHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return m.Claim(txHash)
+}
+
+// PartialDepositError is returned when no transfer is credited for a deposit and a
+// transfer short of its amount arrived
+type PartialDepositError struct {
+	Expected float64
+	Received float64
+}
+
+func (e *PartialDepositError) Error() string {
+	return fmt.Sprintf("received %s of %s TON", money.Format(e.Received), money.Format(e.Expected))
+}
+
+// Missing returns the TON the partial payment lacks
+func (e *PartialDepositError) Missing() float64 {
+	return money.Round(e.Expected - e.Received)
+}
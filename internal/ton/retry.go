@@ -0,0 +1,223 @@
+package ton
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"tonapp/internal/tracing"
+)
+
+// ErrToncenterUnavailable is returned without calling toncenter while the circuit
+// breaker is open after too many failed calls in a row
+var ErrToncenterUnavailable = errors.New("toncenter unavailable, circuit breaker open")
+
+const (
+	defaultMaxRetries      = 2
+	defaultRetryBackoff    = 250 * time.Millisecond
+	defaultRequestTimeout  = 10 * time.Second
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// retryPolicy is how often and how long failed toncenter calls are retried
+type retryPolicy struct {
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	timeout    time.Duration
+}
+
+// delay returns the backoff before a retry, doubled per attempt with up to 20% jitter
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.backoff << attempt
+	if d <= 0 || d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+// circuitBreaker stops calling toncenter after failures failed attempts in a row.
+// Calls fail fast until the cooldown is over, then one call at a time probes
+// toncenter (half open) until an attempt succeeds.
+type circuitBreaker struct {
+	mu          sync.Mutex
+	failures    int
+	cooldown    time.Duration
+	consecutive int
+	openUntil   time.Time
+	probing     bool
+
+	failed  uint64
+	retries uint64
+	opened  uint64
+}
+
+func newCircuitBreaker(failures int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{failures: failures, cooldown: cooldown}
+}
+
+// allow reports whether a call may be made
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutive < b.failures {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return ErrToncenterUnavailable
+	}
+	b.probing = true
+	return nil
+}
+
+// success closes the breaker
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutive >= b.failures {
+		slog.Info("Toncenter recovered, circuit breaker closed")
+	}
+	b.consecutive = 0
+	b.probing = false
+}
+
+// failure counts a failed attempt and opens the breaker once there are too many in a row
+func (b *circuitBreaker) failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failed++
+	b.consecutive++
+	b.probing = false
+	if b.consecutive >= b.failures {
+		if time.Now().After(b.openUntil) {
+			b.opened++
+			slog.Warn("Toncenter circuit breaker open", "cooldown", b.cooldown, "failed_calls", b.consecutive, "error", err)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// skip releases a probe that ended without telling whether toncenter works, e.g. throttled
+func (b *circuitBreaker) skip() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *circuitBreaker) retried() {
+	b.mu.Lock()
+	b.retries++
+	b.mu.Unlock()
+}
+
+// state returns closed, open or half_open, and until when the breaker is open
+func (b *circuitBreaker) state() (string, *int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutive < b.failures {
+		return "closed", nil
+	}
+	if time.Now().Before(b.openUntil) {
+		until := b.openUntil.Unix()
+		return "open", &until
+	}
+	return "half_open", nil
+}
+
+// doToncenter sends a toncenter request within the budget and returns the response body.
+// Network errors, timeouts and 5xx responses are retried with backoff, and so are 429s
+// while Retry-After is within the queue wait; a 429 that can't be retried returns
+// ErrBudgetExhausted.
+func (c *Client) doToncenter(ctx context.Context, req *http.Request) (body []byte, err error) {
+	ctx, span := tracing.Start(ctx, "toncenter "+path.Base(req.URL.Path), tracing.KindClient)
+	span.SetAttr("http.request.method", req.Method)
+	span.SetAttr("url.path", req.URL.Path)
+	attempts := 0
+	defer func() {
+		span.SetAttr("toncenter.attempts", attempts)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	for attempt := 0; ; attempt++ {
+		attempts++
+		if err := c.breaker.allow(); err != nil {
+			return nil, err
+		}
+		if err := c.budget.acquire(ctx); err != nil {
+			c.breaker.skip()
+			return nil, err
+		}
+
+		body, status, err := c.sendToncenter(ctx, req)
+		switch {
+		case err != nil:
+			c.breaker.failure(err)
+		case status == http.StatusTooManyRequests:
+			c.breaker.skip()
+			err = ErrBudgetExhausted
+		case status >= http.StatusInternalServerError:
+			err = fmt.Errorf("toncenter responded with status %d", status)
+			c.breaker.failure(err)
+		default:
+			c.breaker.success()
+			return body, nil
+		}
+
+		if attempt >= c.retry.maxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+		wait := c.retry.delay(attempt)
+		if err == ErrBudgetExhausted {
+			blocked := c.budget.blockedFor()
+			if blocked > c.budget.maxWait {
+				return nil, err
+			}
+			if blocked > wait {
+				wait = blocked
+			}
+		}
+
+		c.breaker.retried()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendToncenter makes a single attempt of a toncenter request within the request timeout
+func (c *Client) sendToncenter(ctx context.Context, req *http.Request) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.retry.timeout)
+	defer cancel()
+
+	req = req.Clone(ctx)
+	req.Header.Set("X-API-Key", c.apiKey)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	c.budget.observe(resp)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
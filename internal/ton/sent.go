@@ -0,0 +1,110 @@
+package ton
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"tonapp/internal/money"
+	"tonapp/internal/tracing"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/ton"
+)
+
+// ErrTransferUnconfirmed is returned when a transfer failed after its external message
+// may have been broadcast, so it can't be told whether it was sent. Callers must look it
+// up with SentMessages instead of sending it again.
+var ErrTransferUnconfirmed = errors.New("transfer unconfirmed")
+
+// sentMessagesMaxPages bounds the pages of 16 transactions SentMessages walks back through
+const sentMessagesMaxPages = 20
+
+// SentMessage is a transfer sent by a wallet
+type SentMessage struct {
+	TxHash      string
+	Destination string
+	Amount      float64
+	Utime       int64
+}
+
+// SentMessages returns the transfers a treasury wallet, or the main wallet for an empty
+// name, sent since a time, newest first. Fails rather than returning part of them when
+// the wallet made too many transactions since then.
+func (c *Client) SentMessages(ctx context.Context, name string, since int64) (messages []SentMessage, err error) {
+	ctx, span := tracing.Start(ctx, "liteserver sent messages", tracing.KindClient)
+	span.SetAttr("ton.wallet", name)
+	defer func() {
+		span.SetAttr("ton.messages", len(messages))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	walletAddress := c.TreasuryAddress(name)
+	if walletAddress == "" {
+		return nil, fmt.Errorf("unknown treasury wallet %s", name)
+	}
+	api, err := c.getAPIClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := address.ParseAddr(walletAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse wallet address: %v", err)
+	}
+	block, err := api.CurrentMasterchainInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get masterchain info: %v", err)
+	}
+	account, err := api.GetAccount(ctx, block, addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account: %v", err)
+	}
+
+	lt, hash := account.LastTxLT, account.LastTxHash
+	for page := 0; page < sentMessagesMaxPages; page++ {
+		if lt == 0 {
+			return messages, nil
+		}
+		txs, err := api.ListTransactions(ctx, addr, 16, lt, hash)
+		if err != nil {
+			if err == ton.ErrNoTransactionsWereFound {
+				return messages, nil
+			}
+			return nil, fmt.Errorf("failed to list transactions: %v", err)
+		}
+		if len(txs) == 0 {
+			return messages, nil
+		}
+
+		for i := len(txs) - 1; i >= 0; i-- {
+			tx := txs[i]
+			if int64(tx.Now) < since {
+				return messages, nil
+			}
+			if tx.IO.Out == nil {
+				continue
+			}
+			outs, err := tx.IO.Out.ToSlice()
+			if err != nil {
+				continue
+			}
+			for _, out := range outs {
+				if out.MsgType != tlb.MsgTypeInternal {
+					continue
+				}
+				msg := out.AsInternal()
+				messages = append(messages, SentMessage{
+					TxHash:      hex.EncodeToString(tx.Hash),
+					Destination: msg.DstAddr.String(),
+					Amount:      money.FromNano(msg.Amount.Nano().Int64()),
+					Utime:       int64(tx.Now),
+				})
+			}
+		}
+		lt, hash = txs[0].PrevTxLT, txs[0].PrevTxHash
+	}
+	return nil, fmt.Errorf("%s made more than %d transactions since %d", walletAddress, sentMessagesMaxPages*16, since)
+}
@@ -0,0 +1,79 @@
+package ton
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xssnick/tonutils-go/ton/wallet"
+)
+
+// treasuryWallet is a wallet besides the main wallet that deposits of some products are routed to
+type treasuryWallet struct {
+	seedPhrase string
+	version    wallet.Version
+	address    string
+}
+
+// AddTreasuryWallet registers a named treasury wallet. Its address is derived from the
+// seed phrase without connecting to the network.
+func (c *Client) AddTreasuryWallet(name string, seedPhrase string, walletVersion string) error {
+	version := parseWalletVersion(walletVersion)
+	w, err := wallet.FromSeed(nil, strings.Split(seedPhrase, " "), version)
+	if err != nil {
+		return fmt.Errorf("failed to create treasury wallet %s from seed phrase: %v", name, err)
+	}
+
+	c.treasuryWallets[name] = &treasuryWallet{
+		seedPhrase: seedPhrase,
+		version:    version,
+		address:    w.WalletAddress().String(),
+	}
+	return nil
+}
+
+// TreasuryWalletNames returns the names of the registered treasury wallets, sorted
+func (c *Client) TreasuryWalletNames() []string {
+	names := make([]string, 0, len(c.treasuryWallets))
+	for name := range c.treasuryWallets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TreasuryAddress returns the address of a treasury wallet, or of the main wallet for
+// an empty name. Returns an empty string for unknown wallets.
+func (c *Client) TreasuryAddress(name string) string {
+	if name == "" {
+		return c.GetDepositAddress()
+	}
+	if w, ok := c.treasuryWallets[name]; ok {
+		return w.address
+	}
+	return ""
+}
+
+// WithdrawFromWallet transfers TON from a treasury wallet to the user's wallet,
+// from the main wallet for an empty name
+func (c *Client) WithdrawFromWallet(ctx context.Context, name string, pubKey string, amount float64) (string, error) {
+	userAddress, err := c.GenerateWalletAddressFromPubKey(pubKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate user wallet address: %v", err)
+	}
+	return c.WithdrawToAddress(ctx, name, userAddress, amount)
+}
+
+// WithdrawToAddress transfers TON from a treasury wallet to any address, from the main
+// wallet for an empty name
+func (c *Client) WithdrawToAddress(ctx context.Context, name string, destination string, amount float64) (string, error) {
+	if name == "" {
+		return c.withdraw(ctx, c.seedPhrase, c.walletType, c.address, "main wallet", destination, amount)
+	}
+	w, ok := c.treasuryWallets[name]
+	if !ok {
+		return "", fmt.Errorf("unknown treasury wallet %s", name)
+	}
+	return c.withdraw(ctx, w.seedPhrase, w.version, w.address, "treasury wallet "+name, destination, amount)
+}
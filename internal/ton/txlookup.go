@@ -0,0 +1,141 @@
+package ton
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/tracing"
+
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+// ErrTransactionNotFound is returned when toncenter doesn't know a transaction hash
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// indexedTransactionsResponse is the body of toncenter v3 /transactions, where hashes
+// are base64 and amounts and lt strings
+type indexedTransactionsResponse struct {
+	Transactions []struct {
+		Account string `json:"account"`
+		Hash    string `json:"hash"`
+		LT      string `json:"lt"`
+		Now     int64  `json:"now"`
+		InMsg   *struct {
+			Source         string `json:"source"`
+			Value          string `json:"value"`
+			Bounced        bool   `json:"bounced"`
+			MessageContent struct {
+				Body    string `json:"body"`
+				Decoded *struct {
+					Type    string `json:"type"`
+					Comment string `json:"comment"`
+				} `json:"decoded"`
+			} `json:"message_content"`
+		} `json:"in_msg"`
+	} `json:"transactions"`
+	Error string `json:"error"`
+}
+
+// ParseTransactionHash returns a transaction hash given in hex, base64 or base64url,
+// as wallets and explorers show it, in lowercase hex
+func ParseTransactionHash(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if data, err := hex.DecodeString(s); err == nil && len(data) == 32 {
+		return hex.EncodeToString(data), nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+		if data, err := enc.DecodeString(s); err == nil && len(data) == 32 {
+			return hex.EncodeToString(data), nil
+		}
+	}
+	return "", fmt.Errorf("invalid transaction hash %q", s)
+}
+
+// GetTransaction fetches a transaction by its hex hash from toncenter's v3 index. The
+// wallet of the result is the account in raw form, the comment of the incoming message
+// is parsed like the liteserver check does.
+func (c *Client) GetTransaction(ctx context.Context, hash string) (tx *model.ChainTransaction, err error) {
+	ctx, span := tracing.Start(ctx, "toncenter transaction by hash", tracing.KindClient)
+	span.SetAttr("ton.tx_hash", hash)
+	defer func() {
+		span.SetAttr("ton.found", tx != nil)
+		span.RecordError(err)
+		span.End()
+	}()
+
+	params := url.Values{
+		"hash":  {hash},
+		"limit": {"1"},
+	}
+	baseURL := strings.TrimSuffix(c.baseURL, "/v2") + "/v3"
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/transactions?%s", baseURL, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	body, err := c.doToncenter(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	var result indexedTransactionsResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("API returned an error: %s", result.Error)
+	}
+	if len(result.Transactions) == 0 {
+		return nil, ErrTransactionNotFound
+	}
+
+	t := result.Transactions[0]
+	account, err := RawAddress(t.Account)
+	if err != nil {
+		return nil, err
+	}
+	lt, err := strconv.ParseUint(t.LT, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lt %q", t.LT)
+	}
+	tx = &model.ChainTransaction{Wallet: account, LT: lt, Hash: hash, Utime: t.Now}
+	if in := t.InMsg; in != nil && in.Source != "" {
+		amountNano, err := strconv.ParseInt(in.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q", in.Value)
+		}
+		tx.InSource = in.Source
+		tx.InAmount = money.FromNano(amountNano)
+		tx.Bounced = in.Bounced
+		tx.InComment = messageComment(in.MessageContent.Body)
+		if tx.InComment == "" && in.MessageContent.Decoded != nil && in.MessageContent.Decoded.Type == "text_comment" {
+			tx.InComment = in.MessageContent.Decoded.Comment
+		}
+	}
+	return tx, nil
+}
+
+// messageComment parses the comment of a base64 BOC message body, empty if it has none
+func messageComment(body string) string {
+	if body == "" {
+		return ""
+	}
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return ""
+	}
+	root, err := cell.FromBOC(data)
+	if err != nil {
+		return ""
+	}
+	return ParseComment(root)
+}
@@ -0,0 +1,116 @@
+package ton
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xssnick/tonutils-go/address"
+)
+
+const (
+	WebhookProviderTonAPI    = "tonapi"
+	WebhookProviderToncenter = "toncenter"
+
+	// WebhookSignatureHeader carries the hex HMAC-SHA256 of the webhook body
+	WebhookSignatureHeader = "X-Signature"
+)
+
+// AccountEvent is a new transaction of an account reported by a webhook subscription.
+// It only says where to look, the transaction itself is read from the chain.
+type AccountEvent struct {
+	Account string // raw form, "0:<hex>"
+	LT      uint64
+	Hash    string
+}
+
+// VerifyWebhookSignature checks the hex HMAC-SHA256 of body with the subscription
+// secret, an optional "sha256=" prefix is accepted
+func VerifyWebhookSignature(body []byte, signature string, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(strings.TrimPrefix(signature, "sha256="))))
+}
+
+// tonapiEvent is the body of a tonapi account transaction webhook
+type tonapiEvent struct {
+	AccountID string `json:"account_id"`
+	LT        uint64 `json:"lt"`
+	TxHash    string `json:"tx_hash"`
+}
+
+// toncenterEvent is the body of a toncenter v3 transactions notification, which may
+// batch several transactions; lt is a string like everywhere in the v3 API
+type toncenterEvent struct {
+	Transactions []struct {
+		Account string `json:"account"`
+		LT      string `json:"lt"`
+		Hash    string `json:"hash"`
+	} `json:"transactions"`
+}
+
+// ParseAccountEvents decodes the body of a tonapi or toncenter v3 webhook
+func ParseAccountEvents(provider string, body []byte) ([]AccountEvent, error) {
+	switch provider {
+	case WebhookProviderTonAPI:
+		var e tonapiEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, err
+		}
+		account, err := RawAddress(e.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		return []AccountEvent{{Account: account, LT: e.LT, Hash: e.TxHash}}, nil
+
+	case WebhookProviderToncenter:
+		var e toncenterEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			return nil, err
+		}
+		events := make([]AccountEvent, 0, len(e.Transactions))
+		for _, tx := range e.Transactions {
+			account, err := RawAddress(tx.Account)
+			if err != nil {
+				return nil, err
+			}
+			lt, err := strconv.ParseUint(tx.LT, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid lt %q", tx.LT)
+			}
+			events = append(events, AccountEvent{Account: account, LT: lt, Hash: tx.Hash})
+		}
+		return events, nil
+	}
+	return nil, fmt.Errorf("unknown webhook provider %q", provider)
+}
+
+// RawAddress converts a user-friendly or raw address to the raw "<workchain>:<hex>" form,
+// so addresses reported by indexers can be compared with the configured wallets
+func RawAddress(addr string) (string, error) {
+	if wc, hash, ok := strings.Cut(addr, ":"); ok {
+		workchain, err := strconv.ParseInt(wc, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid address %q", addr)
+		}
+		data, err := hex.DecodeString(hash)
+		if err != nil || len(data) != 32 {
+			return "", fmt.Errorf("invalid address %q", addr)
+		}
+		return fmt.Sprintf("%d:%x", workchain, data), nil
+	}
+
+	parsed, err := address.ParseAddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	return fmt.Sprintf("%d:%x", parsed.Workchain(), parsed.Data()), nil
+}
@@ -0,0 +1,568 @@
+// Package tonmock is a fake of the TON client used by the handler.
+//
+// Wallets, balances and transactions only exist in memory: deposits are simulated with
+// Deposit, withdrawals are recorded instead of sent, and any call can be made to fail
+// with FailNext. It is meant for handler tests and for local development without a
+// mnemonic or testnet TON.
+package tonmock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"tonapp/internal/model"
+	"tonapp/internal/money"
+	"tonapp/internal/ton"
+
+	"github.com/xssnick/tonutils-go/address"
+)
+
+// maxBatchMessages is what a V4 wallet sends in one external message
+const maxBatchMessages = 4
+
+// Transfer kinds recorded by the client
+const (
+	TransferWithdrawal = "withdrawal"
+	TransferFeeSplit   = "fee_split"
+	TransferSweep      = "sweep"
+)
+
+// Options configures a fake client
+type Options struct {
+	// WalletBalance is the starting balance of the main wallet
+	WalletBalance float64
+	// AutoConfirmDeposits makes every direct deposit check succeed without a simulated
+	// transfer. With the indexer enabled deposits are matched from indexed transactions,
+	// so they still need Deposit.
+	AutoConfirmDeposits bool
+	// FeeWalletAddress receives the platform share of found deposits, as ton.fee_wallet_address
+	FeeWalletAddress string
+}
+
+// Transfer is a transfer the client was asked to send
+type Transfer struct {
+	Kind   string  `json:"kind"`
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+	Hash   string  `json:"hash"`
+}
+
+// Client fakes the TON client behind a single mutex
+type Client struct {
+	mu          sync.Mutex
+	autoConfirm bool
+	feeAddress  string
+	address     string
+	treasury    map[string]string // name -> address
+	balances    map[string]float64
+	jettons     map[string]float64 // master/owner -> balance
+	txs         []model.ChainTransaction
+	transfers   []Transfer
+	failures    map[string]error // method -> error of its next call
+	lastLT      uint64
+}
+
+// New creates a fake client with freshly derived wallet addresses
+func New(opts Options) *Client {
+	c := &Client{
+		autoConfirm: opts.AutoConfirmDeposits,
+		feeAddress:  opts.FeeWalletAddress,
+		address:     Address("main"),
+		treasury:    make(map[string]string),
+		balances:    make(map[string]float64),
+		jettons:     make(map[string]float64),
+		failures:    make(map[string]error),
+	}
+	c.balances[c.address] = opts.WalletBalance
+	return c
+}
+
+// AddTreasuryWallet registers a named treasury wallet with a starting balance
+func (c *Client) AddTreasuryWallet(name string, balance float64) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	addr := Address("treasury:" + name)
+	c.treasury[name] = addr
+	c.balances[addr] = balance
+	return addr
+}
+
+// Address derives a valid, deterministic wallet address from a seed text
+func Address(seed string) string {
+	hash := sha256.Sum256([]byte(seed))
+	return address.NewAddress(0, 0, hash[:]).String()
+}
+
+// FailNext makes the next call of the named method, e.g. "WithdrawToAddress", return err
+func (c *Client) FailNext(method string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[method] = err
+}
+
+// failure returns and clears the error set for the next call of a method.
+// Must be called with mu held.
+func (c *Client) failure(method string) error {
+	err := c.failures[method]
+	delete(c.failures, method)
+	return err
+}
+
+// SetBalance sets the TON balance of an address
+func (c *Client) SetBalance(addr string, amount float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.balances[addr] = amount
+}
+
+// SetJettonBalance sets the balance of a jetton held by an address
+func (c *Client) SetJettonBalance(master string, owner string, amount float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.jettons[master+"/"+owner] = amount
+}
+
+// Deposit simulates an incoming transfer to a wallet agedSeconds ago and credits its balance
+func (c *Client) Deposit(walletAddress string, amount float64, comment string, agedSeconds int64) model.ChainTransaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tx := c.record(walletAddress, time.Now().Unix()-agedSeconds)
+	tx.InSource = Address(fmt.Sprintf("sender:%d", tx.LT))
+	tx.InAmount = amount
+	tx.InComment = comment
+	c.txs = append(c.txs, tx)
+	c.balances[walletAddress] = money.Round(c.balances[walletAddress] + amount)
+	return tx
+}
+
+// Transfers returns the transfers sent so far, oldest first
+func (c *Client) Transfers() []Transfer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Transfer(nil), c.transfers...)
+}
+
+// record returns a new transaction of a wallet. Must be called with mu held.
+func (c *Client) record(wallet string, utime int64) model.ChainTransaction {
+	c.lastLT++
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", wallet, c.lastLT)))
+	return model.ChainTransaction{
+		Wallet: wallet,
+		LT:     c.lastLT,
+		Hash:   hex.EncodeToString(hash[:]),
+		Utime:  utime,
+	}
+}
+
+// send moves TON from one address to another and records the transfer.
+// Must be called with mu held.
+func (c *Client) send(kind string, from string, to string, amount float64) string {
+	tx := c.record(from, time.Now().Unix())
+	tx.OutDestination = to
+	tx.OutAmount = amount
+	c.txs = append(c.txs, tx)
+	c.balances[from] = money.Round(c.balances[from] - amount)
+	c.balances[to] = money.Round(c.balances[to] + amount)
+	c.transfers = append(c.transfers, Transfer{Kind: kind, From: from, To: to, Amount: amount, Hash: tx.Hash})
+	return tx.Hash
+}
+
+// GetDepositAddress returns the address of the main wallet
+func (c *Client) GetDepositAddress() string {
+	return c.address
+}
+
+// TreasuryWalletNames returns the names of the treasury wallets, sorted
+func (c *Client) TreasuryWalletNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.treasury))
+	for name := range c.treasury {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TreasuryAddress returns the address of a treasury wallet, or of the main wallet for
+// an empty name. Returns an empty string for unknown wallets.
+func (c *Client) TreasuryAddress(name string) string {
+	if name == "" {
+		return c.address
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.treasury[name]
+}
+
+// DepositWalletAddress returns the personal deposit address of a subwallet
+func (c *Client) DepositWalletAddress(subwalletID uint32) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("DepositWalletAddress"); err != nil {
+		return "", err
+	}
+	return Address(fmt.Sprintf("deposit:%d", subwalletID)), nil
+}
+
+// GenerateWalletAddressFromPubKey returns the wallet address of a hex public key
+func (c *Client) GenerateWalletAddressFromPubKey(pubKey string) (string, error) {
+	key, err := hex.DecodeString(pubKey)
+	if err != nil || len(key) != 32 {
+		return "", fmt.Errorf("invalid public key")
+	}
+	return Address("user:" + pubKey), nil
+}
+
+// GetWalletBalance returns the balance of an address, 0 for unknown ones
+func (c *Client) GetWalletBalance(ctx context.Context, addr string) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("GetWalletBalance"); err != nil {
+		return 0, err
+	}
+	return c.balances[addr], nil
+}
+
+// JettonBalance returns the jetton balance set with SetJettonBalance
+func (c *Client) JettonBalance(ctx context.Context, master string, owner string, decimals int) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("JettonBalance"); err != nil {
+		return 0, err
+	}
+	return c.jettons[master+"/"+owner], nil
+}
+
+// CheckDeposit looks for a simulated transfer credited for the deposit with the memo
+// within the last minutes, like the real client. A match younger than its confirmation
+// tier returns ton.ErrAwaitingConfirmations, a transfer short of the amount a
+// *ton.PartialDepositError. Found deposits forward the platform share to the fee wallet.
+func (c *Client) CheckDeposit(walletAddress string, match ton.DepositMatch, memo string, withinLastMinutes int) (float64, error) {
+	since := time.Now().Add(-time.Duration(withinLastMinutes) * time.Minute).Unix()
+	return c.checkDeposit("CheckDeposit", walletAddress, match, memo, since)
+}
+
+// CheckAddressDeposit looks for a simulated transfer credited for the deposit at a
+// personal deposit address since the given time, whatever its comment
+func (c *Client) CheckAddressDeposit(walletAddress string, match ton.DepositMatch, since int64) (float64, error) {
+	return c.checkDeposit("CheckAddressDeposit", walletAddress, match, "", since)
+}
+
+func (c *Client) checkDeposit(method string, walletAddress string, match ton.DepositMatch, memo string, since int64) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure(method); err != nil {
+		return 0, err
+	}
+	if c.autoConfirm {
+		c.splitFee(match.Amount)
+		return match.Amount, nil
+	}
+
+	now := time.Now().Unix()
+	awaiting := false
+	partial := 0.0
+	for _, tx := range c.txs {
+		if tx.Wallet != walletAddress || tx.InAmount == 0 || tx.Utime < since {
+			continue
+		}
+		if memo != "" && tx.InComment != memo {
+			continue
+		}
+		if received, err := c.matchTransfer(tx, match, &awaiting, &partial, now); received > 0 || err != nil {
+			return received, err
+		}
+	}
+	return 0, depositLookupError(match, awaiting, partial)
+}
+
+// matchTransfer credits a simulated transfer if it matches the deposit, is old enough and
+// didn't credit another deposit, and notes why it wasn't credited otherwise
+func (c *Client) matchTransfer(tx model.ChainTransaction, match ton.DepositMatch, awaiting *bool, partial *float64, now int64) (float64, error) {
+	credited, short := match.Credits(tx.InAmount)
+	if short && *partial == 0 {
+		*partial = tx.InAmount
+	}
+	if !credited {
+		return 0, nil
+	}
+	if tx.Utime > now-int64(match.MinAgeSeconds(tx.InAmount)) {
+		*awaiting = true
+		return 0, nil
+	}
+	if claimed, err := match.ClaimTransaction(tx.Hash); err != nil || !claimed {
+		return 0, err
+	}
+	c.splitFee(tx.InAmount)
+	return tx.InAmount, nil
+}
+
+// depositLookupError is the error of a lookup that credited no transfer
+func depositLookupError(match ton.DepositMatch, awaiting bool, partial float64) error {
+	if awaiting {
+		return ton.ErrAwaitingConfirmations
+	}
+	if partial > 0 {
+		return &ton.PartialDepositError{Expected: match.Amount, Received: partial}
+	}
+	return nil
+}
+
+// FindArchivedDeposit looks for a simulated transfer since the given time like
+// CheckDeposit, newest first, and returns ton.ErrArchiveLookupCapped when more than
+// maxPages pages of ton.ArchivePageSize wallet transactions would have to be searched
+func (c *Client) FindArchivedDeposit(ctx context.Context, walletAddress string, match ton.DepositMatch, memo string, since int64, maxPages int) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("FindArchivedDeposit"); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	awaiting := false
+	partial := 0.0
+	searched := 0
+	for i := len(c.txs) - 1; i >= 0; i-- {
+		tx := c.txs[i]
+		if tx.Wallet != walletAddress || tx.Utime < since {
+			continue
+		}
+		if searched == maxPages*ton.ArchivePageSize {
+			return 0, fmt.Errorf("%w of %d", ton.ErrArchiveLookupCapped, maxPages)
+		}
+		searched++
+		if tx.InAmount == 0 || (memo != "" && tx.InComment != memo) {
+			continue
+		}
+		if received, err := c.matchTransfer(tx, match, &awaiting, &partial, now); received > 0 || err != nil {
+			return received, err
+		}
+	}
+	return 0, depositLookupError(match, awaiting, partial)
+}
+
+// splitFee forwards 20% of a found deposit to the fee wallet. Must be called with mu held.
+func (c *Client) splitFee(amount float64) {
+	if c.feeAddress != "" {
+		c.send(TransferFeeSplit, c.address, c.feeAddress, money.RoundFee(amount*0.2))
+	}
+}
+
+// SweepDepositWallet moves the balance of a personal deposit address to the main wallet,
+// leaving balances below minAmount
+func (c *Client) SweepDepositWallet(ctx context.Context, subwalletID uint32, minAmount float64) (float64, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("SweepDepositWallet"); err != nil {
+		return 0, "", err
+	}
+
+	from := Address(fmt.Sprintf("deposit:%d", subwalletID))
+	balance := c.balances[from]
+	if balance <= 0 || balance < minAmount {
+		return 0, "", nil
+	}
+	return balance, c.send(TransferSweep, from, c.address, balance), nil
+}
+
+// TransferFundsWithSplit sends 20% of the amount from the main wallet to the fee address
+func (c *Client) TransferFundsWithSplit(ctx context.Context, amount float64, feeAddress string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("TransferFundsWithSplit"); err != nil {
+		return err
+	}
+	c.send(TransferFeeSplit, c.address, feeAddress, money.RoundFee(amount*0.2))
+	return nil
+}
+
+// FetchTransactionsSince returns the wallet transactions with lt greater than afterLT,
+// oldest first, keeping the newest limit ones when limit > 0
+func (c *Client) FetchTransactionsSince(ctx context.Context, walletAddress string, afterLT uint64, limit int) ([]model.ChainTransaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("FetchTransactionsSince"); err != nil {
+		return nil, err
+	}
+
+	var txs []model.ChainTransaction
+	for _, tx := range c.txs {
+		if tx.Wallet == walletAddress && tx.LT > afterLT {
+			txs = append(txs, tx)
+		}
+	}
+	if limit > 0 && len(txs) > limit {
+		txs = txs[len(txs)-limit:]
+	}
+	return txs, nil
+}
+
+// GetTransaction returns a simulated transaction by hash, its wallet in raw form like
+// the real client, or ton.ErrTransactionNotFound
+func (c *Client) GetTransaction(ctx context.Context, hash string) (*model.ChainTransaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("GetTransaction"); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range c.txs {
+		if tx.Hash != hash {
+			continue
+		}
+		raw, err := ton.RawAddress(tx.Wallet)
+		if err != nil {
+			return nil, err
+		}
+		tx.Wallet = raw
+		return &tx, nil
+	}
+	return nil, ton.ErrTransactionNotFound
+}
+
+// WithdrawFromWallet sends TON from a treasury wallet, or the main wallet for an empty
+// name, to the wallet of a public key
+func (c *Client) WithdrawFromWallet(ctx context.Context, name string, pubKey string, amount float64) (string, error) {
+	destination, err := c.GenerateWalletAddressFromPubKey(pubKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate user wallet address: %v", err)
+	}
+	return c.withdraw("WithdrawFromWallet", name, destination, amount)
+}
+
+// WithdrawToAddress sends TON from a treasury wallet, or the main wallet for an empty
+// name, to any address. Wallets that can't cover the amount return
+// ton.ErrInsufficientWalletBalance.
+func (c *Client) WithdrawToAddress(ctx context.Context, name string, destination string, amount float64) (string, error) {
+	return c.withdraw("WithdrawToAddress", name, destination, amount)
+}
+
+func (c *Client) withdraw(method string, name string, destination string, amount float64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure(method); err != nil {
+		return "", err
+	}
+
+	from, label, err := c.wallet(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := address.ParseAddr(destination); err != nil {
+		return "", fmt.Errorf("invalid destination address: %v", err)
+	}
+	if c.balances[from] < amount {
+		return "", fmt.Errorf("%w in %s", ton.ErrInsufficientWalletBalance, label)
+	}
+	return c.send(TransferWithdrawal, from, destination, amount), nil
+}
+
+// wallet returns the address and label of a treasury wallet, or of the main wallet for
+// an empty name. Must be called with mu held.
+func (c *Client) wallet(name string) (string, string, error) {
+	if name == "" {
+		return c.address, "main wallet", nil
+	}
+	from, ok := c.treasury[name]
+	if !ok {
+		return "", "", fmt.Errorf("unknown treasury wallet %s", name)
+	}
+	return from, "treasury wallet " + name, nil
+}
+
+// MaxBatchMessages returns the message limit of a V4 wallet, 0 for unknown treasury wallets
+func (c *Client) MaxBatchMessages(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.treasury[name]; name != "" && !ok {
+		return 0
+	}
+	return maxBatchMessages
+}
+
+// WithdrawBatch records one transfer per payout, all with the same hash, if the wallet
+// covers their total
+func (c *Client) WithdrawBatch(ctx context.Context, name string, payouts []ton.Payout) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("WithdrawBatch"); err != nil {
+		return "", err
+	}
+
+	from, label, err := c.wallet(name)
+	if err != nil {
+		return "", err
+	}
+	if len(payouts) == 0 || len(payouts) > maxBatchMessages {
+		return "", fmt.Errorf("batch of %d payouts, %s can send 1 to %d", len(payouts), label, maxBatchMessages)
+	}
+	total := 0.0
+	for _, p := range payouts {
+		if _, err := address.ParseAddr(p.Destination); err != nil {
+			return "", fmt.Errorf("invalid destination address: %v", err)
+		}
+		total += p.Amount
+	}
+	if c.balances[from] < total {
+		return "", fmt.Errorf("%w in %s", ton.ErrInsufficientWalletBalance, label)
+	}
+
+	// One transaction of the wallet with a message per payout
+	tx := c.record(from, time.Now().Unix())
+	tx.OutAmount = money.Round(total)
+	c.txs = append(c.txs, tx)
+	for _, p := range payouts {
+		c.balances[from] = money.Round(c.balances[from] - p.Amount)
+		c.balances[p.Destination] = money.Round(c.balances[p.Destination] + p.Amount)
+		c.transfers = append(c.transfers, Transfer{Kind: TransferWithdrawal, From: from, To: p.Destination, Amount: p.Amount, Hash: tx.Hash})
+	}
+	return tx.Hash, nil
+}
+
+// SentMessages returns the recorded transfers of a treasury wallet, or of the main wallet
+// for an empty name, sent since a time, newest first
+func (c *Client) SentMessages(ctx context.Context, name string, since int64) ([]ton.SentMessage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.failure("SentMessages"); err != nil {
+		return nil, err
+	}
+
+	from, _, err := c.wallet(name)
+	if err != nil {
+		return nil, err
+	}
+	utimes := make(map[string]int64)
+	for _, tx := range c.txs {
+		utimes[tx.Hash] = tx.Utime
+	}
+	var messages []ton.SentMessage
+	for i := len(c.transfers) - 1; i >= 0; i-- {
+		t := c.transfers[i]
+		if t.From != from || utimes[t.Hash] < since {
+			continue
+		}
+		messages = append(messages, ton.SentMessage{TxHash: t.Hash, Destination: t.To, Amount: t.Amount, Utime: utimes[t.Hash]})
+	}
+	return messages, nil
+}
+
+// CheckConnectivity succeeds unless a failure was set
+func (c *Client) CheckConnectivity(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.failure("CheckConnectivity")
+}
+
+// BudgetStats reports an idle request budget, the fake doesn't call toncenter
+func (c *Client) BudgetStats() model.ToncenterBudgetStats {
+	return model.ToncenterBudgetStats{Circuit: "closed"}
+}
@@ -0,0 +1,111 @@
+// Package tonproof implements the TON Connect ton_proof message format and the
+// check that a public key belongs to a wallet address.
+package tonproof
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-go/tvm/cell"
+)
+
+const (
+	itemPrefix       = "ton-proof-item-v2/"
+	tonConnectPrefix = "ton-connect"
+)
+
+// walletKeyOffsets are the bit offsets of the public key in the data of supported
+// wallet contracts: v2 (seqno), v3/v4 (seqno, wallet id), v5 (signature flag,
+// seqno, wallet id), highload v2 (wallet id, last cleaned)
+var walletKeyOffsets = []uint{32, 64, 65, 96}
+
+// Message builds the hash the wallet signs:
+// sha256(0xffff ++ "ton-connect" ++ sha256("ton-proof-item-v2/" ++ address ++ domain ++ timestamp ++ payload))
+func Message(workchain int32, hash []byte, domain string, timestamp int64, payload string) []byte {
+	var msg bytes.Buffer
+	msg.WriteString(itemPrefix)
+	binary.Write(&msg, binary.BigEndian, workchain)
+	msg.Write(hash)
+	binary.Write(&msg, binary.LittleEndian, uint32(len(domain)))
+	msg.WriteString(domain)
+	binary.Write(&msg, binary.LittleEndian, uint64(timestamp))
+	msg.WriteString(payload)
+	msgHash := sha256.Sum256(msg.Bytes())
+
+	var full bytes.Buffer
+	full.Write([]byte{0xff, 0xff})
+	full.WriteString(tonConnectPrefix)
+	full.Write(msgHash[:])
+	fullHash := sha256.Sum256(full.Bytes())
+	return fullHash[:]
+}
+
+// Sign signs the proof message with a wallet key and returns it base64 encoded
+func Sign(key ed25519.PrivateKey, workchain int32, hash []byte, domain string, timestamp int64, payload string) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, Message(workchain, hash, domain, timestamp, payload)))
+}
+
+// ParseAddress parses a raw (0:<hex>) or user-friendly address into workchain and hash
+func ParseAddress(addr string) (int32, []byte, error) {
+	if wc, hashHex, ok := strings.Cut(addr, ":"); ok {
+		workchain, err := strconv.ParseInt(wc, 10, 32)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid address workchain")
+		}
+		hash, err := hex.DecodeString(hashHex)
+		if err != nil || len(hash) != 32 {
+			return 0, nil, fmt.Errorf("invalid address")
+		}
+		return int32(workchain), hash, nil
+	}
+
+	parsed, err := address.ParseAddr(addr)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid address")
+	}
+	return parsed.Workchain(), parsed.Data(), nil
+}
+
+// CheckStateInit verifies the base64 BOC state init deploys the contract at the
+// account hash and that its data holds the public key, so the key belongs to the address
+func CheckStateInit(stateInitB64 string, accountHash, pubKey []byte) error {
+	boc, err := base64.StdEncoding.DecodeString(stateInitB64)
+	if err != nil {
+		return fmt.Errorf("invalid state_init")
+	}
+	root, err := cell.FromBOC(boc)
+	if err != nil {
+		return fmt.Errorf("invalid state_init")
+	}
+	if !bytes.Equal(root.Hash(), accountHash) {
+		return fmt.Errorf("state_init doesn't match the address")
+	}
+
+	var stateInit tlb.StateInit
+	if err := tlb.LoadFromCell(&stateInit, root.BeginParse()); err != nil || stateInit.Data == nil {
+		return fmt.Errorf("invalid state_init")
+	}
+
+	for _, offset := range walletKeyOffsets {
+		data := stateInit.Data.BeginParse()
+		if data.BitsLeft() < offset+256 {
+			continue
+		}
+		if _, err := data.LoadSlice(offset); err != nil {
+			continue
+		}
+		if key, err := data.LoadSlice(256); err == nil && bytes.Equal(key, pubKey) {
+			return nil
+		}
+	}
+	return fmt.Errorf("public_key doesn't belong to the wallet")
+}
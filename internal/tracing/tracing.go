@@ -0,0 +1,230 @@
+// Package tracing records spans of HTTP requests, SQLite queries and TON calls and exports
+// them to an OpenTelemetry collector.
+//
+// Spans are sent over OTLP/HTTP with the JSON encoding, which every collector accepts, so
+// traces end up in Jaeger, Tempo or any other backend behind it. A span started under a
+// context carrying another span becomes its child; the HTTP middleware continues traces of
+// callers sending a W3C traceparent header. Without Setup nothing is recorded.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanKind tells the backend whether a span serves, makes or is part of a call
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Config selects where spans are exported and which traces are sampled
+type Config struct {
+	Endpoint    string            // OTLP/HTTP traces URL, e.g. http://localhost:4318/v1/traces
+	ServiceName string            // service.name resource attribute
+	SampleRatio float64           // share of traces recorded, 0 to 1
+	Headers     map[string]string // sent with every export, e.g. an API key of a hosted backend
+}
+
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type contextKey struct{}
+
+type tracer struct {
+	config   Config
+	exporter *exporter
+}
+
+var current atomic.Pointer[tracer]
+
+// Setup starts exporting spans. The returned function flushes the spans recorded so far
+// and stops the export.
+func Setup(cfg Config) func(ctx context.Context) error {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "tonapp"
+	}
+	t := &tracer{config: cfg, exporter: newExporter(cfg)}
+	current.Store(t)
+	return func(ctx context.Context) error {
+		current.CompareAndSwap(t, nil)
+		return t.exporter.shutdown(ctx)
+	}
+}
+
+// Start starts a span, a child of the span in ctx or the root of a new trace. The span is
+// nil, which is fine to use, when tracing is off or the trace isn't sampled.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := current.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	parent, ok := ctx.Value(contextKey{}).(spanContext)
+	if !ok {
+		parent = spanContext{traceID: randomTraceID(), sampled: t.sample()}
+	}
+	return t.start(ctx, parent, name, kind)
+}
+
+// StartChild starts a span only as the child of a span in ctx. It is used for frequent
+// operations like queries, which are only interesting as part of a larger trace.
+func StartChild(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	t := current.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	parent, ok := ctx.Value(contextKey{}).(spanContext)
+	if !ok {
+		return ctx, nil
+	}
+	return t.start(ctx, parent, name, kind)
+}
+
+func (t *tracer) start(ctx context.Context, parent spanContext, name string, kind SpanKind) (context.Context, *Span) {
+	if !parent.sampled {
+		return context.WithValue(ctx, contextKey{}, parent), nil
+	}
+	s := &Span{
+		tracer:   t,
+		context:  spanContext{traceID: parent.traceID, spanID: randomSpanID(), sampled: true},
+		parentID: parent.spanID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+	}
+	return context.WithValue(ctx, contextKey{}, s.context), s
+}
+
+func (t *tracer) sample() bool {
+	ratio := t.config.SampleRatio
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	var b [8]byte
+	rand.Read(b[:])
+	return float64(binary.BigEndian.Uint64(b[:])>>11)/(1<<53) < ratio
+}
+
+// WithTraceparent continues the trace of a W3C traceparent header, e.g. one sent by a
+// proxy or the Mini App. Invalid headers are ignored.
+func WithTraceparent(ctx context.Context, header string) context.Context {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+
+	var sc spanContext
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil || sc.traceID == [16]byte{} {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil || sc.spanID == [8]byte{} {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return ctx
+	}
+	sc.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// TraceID returns the ID of the sampled trace ctx belongs to, empty if there is none
+func TraceID(ctx context.Context) string {
+	sc, ok := ctx.Value(contextKey{}).(spanContext)
+	if !ok || !sc.sampled {
+		return ""
+	}
+	return hex.EncodeToString(sc.traceID[:])
+}
+
+func randomTraceID() [16]byte {
+	var id [16]byte
+	rand.Read(id[:])
+	return id
+}
+
+func randomSpanID() [8]byte {
+	var id [8]byte
+	rand.Read(id[:])
+	return id
+}
+
+// Span is a timed operation of a trace. All methods do nothing on a nil span.
+type Span struct {
+	tracer   *tracer
+	context  spanContext
+	parentID [8]byte
+	name     string
+	kind     SpanKind
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  []attribute
+	failed bool
+	status string
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// SetAttr adds an attribute, e.g. "user.id" or "ton.tx_hash"
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// RecordError marks the span as failed, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Fail(err.Error())
+}
+
+// Fail marks the span as failed with a message
+func (s *Span) Fail(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed = true
+	s.status = message
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.tracer.exporter.enqueue(s)
+}